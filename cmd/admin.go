@@ -7,16 +7,20 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/knadh/listmonk/models"
 	"github.com/labstack/echo/v4"
 )
 
 type serverConfig struct {
-	Messengers   []string   `json:"messengers"`
-	Langs        []i18nLang `json:"langs"`
-	Lang         string     `json:"lang"`
-	Update       *AppUpdate `json:"update"`
-	NeedsRestart bool       `json:"needs_restart"`
-	Version      string     `json:"version"`
+	Messengers      []string             `json:"messengers"`
+	TrackingDomains []string             `json:"tracking_domains"`
+	AttribSchema    []models.AttribField `json:"attrib_schema"`
+	Langs           []i18nLang           `json:"langs"`
+	Lang            string               `json:"lang"`
+	Update          *AppUpdate           `json:"update"`
+	NeedsRestart    bool                 `json:"needs_restart"`
+	Version         string               `json:"version"`
+	TemplateGallery bool                 `json:"template_gallery"`
 }
 
 // handleGetServerConfig returns general server config.
@@ -46,6 +50,9 @@ func handleGetServerConfig(c echo.Context) error {
 	sort.Strings(names)
 	out.Messengers = append(out.Messengers, emailMsgr)
 	out.Messengers = append(out.Messengers, names...)
+	out.TrackingDomains = append([]string{}, app.constants.Privacy.TrackingDomains...)
+	out.AttribSchema = append([]models.AttribField{}, app.constants.AttribSchema...)
+	out.TemplateGallery = app.constants.TemplateGalleryURL != ""
 
 	app.Lock()
 	out.NeedsRestart = app.needsRestart
@@ -56,6 +63,60 @@ func handleGetServerConfig(c echo.Context) error {
 	return c.JSON(http.StatusOK, okResp{out})
 }
 
+// handleGetMessengerUsage returns the number of messages sent through every
+// messenger on the current day and in the current month, in the default
+// timezone, and their send quotas.
+func handleGetMessengerUsage(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+	)
+
+	tz, err := time.LoadLocation(ko.String("app.default_timezone"))
+	if err != nil {
+		tz = time.UTC
+	}
+	var (
+		now   = time.Now().In(tz)
+		month = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, tz)
+	)
+
+	usage, err := app.core.GetMessengerUsage(now.Format("2006-01-02"), month.Format("2006-01-02"))
+	if err != nil {
+		return err
+	}
+
+	// Every messenger is in the list, including the ones that are yet to be
+	// used, with `email` as the first item.
+	byName := make(map[string]models.MessengerUsage, len(usage))
+	for _, u := range usage {
+		byName[u.Messenger] = u
+	}
+	var names []string
+	for name := range app.messengers {
+		if name != emailMsgr {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	quotas := app.manager.Quotas()
+	out := make([]models.MessengerUsage, 0, len(names)+1)
+	for _, name := range append([]string{emailMsgr}, names...) {
+		u := byName[name]
+		u.Messenger = name
+		if q, ok := quotas[name]; ok {
+			u.DailyQuota, u.MonthlyQuota = q.Daily, q.Monthly
+			u.QuotaAction = models.QuotaActionQueue
+			if q.Refuse {
+				u.QuotaAction = models.QuotaActionRefuse
+			}
+		}
+		out = append(out, u)
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
 // handleGetDashboardCharts returns chart data points to render ont he dashboard.
 func handleGetDashboardCharts(c echo.Context) error {
 	var (
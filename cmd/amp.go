@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// ampMaxSize is the maximum size of an AMP for Email MIME part that
+// e-mail clients render.
+const ampMaxSize = 200 * 1024
+
+var (
+	regexpAMPDoctype     = regexp.MustCompile(`(?i)^\s*<!doctype\s+html\s*>`)
+	regexpAMPHTML        = regexp.MustCompile(`(?i)<html[^>]*\s(⚡4email|amp4email)[\s>=]`)
+	regexpAMPCharset     = regexp.MustCompile(`(?i)<meta\s+charset=["']?utf-8["']?\s*/?>`)
+	regexpAMPRuntime     = regexp.MustCompile(`(?i)<script\s+async\s+src=["']https://cdn\.ampproject\.org/v0\.js["']\s*>\s*</script>`)
+	regexpAMPBoilerplate = regexp.MustCompile(`(?i)<style\s+amp4email-boilerplate\s*>`)
+	regexpAMPScript      = regexp.MustCompile(`(?i)<script\b[^>]*>`)
+	regexpAMPScriptOK    = regexp.MustCompile(`(?i)src=["']https://cdn\.ampproject\.org/v0(/amp-[a-z0-9-]+-[0-9.]+)?\.js["']|type=["']application/json["']`)
+	regexpAMPBadTag      = regexp.MustCompile(`(?i)<(img|iframe|frame|frameset|object|embed|video|audio|base|link)\b`)
+	regexpAMPFormAction  = regexp.MustCompile(`(?i)<form\b[^>]*\saction=`)
+)
+
+// validateAMP checks an AMP for Email document for the required markup and
+// the constructs that AMP for Email doesn't allow. It doesn't replace the
+// official AMP validator, but catches common errors that'd cause e-mail
+// clients to silently drop the AMP part.
+func validateAMP(body string) error {
+	if len(body) > ampMaxSize {
+		return fmt.Errorf("AMP body exceeds %d KB", ampMaxSize/1024)
+	}
+
+	if !regexpAMPDoctype.MatchString(body) {
+		return fmt.Errorf("missing <!doctype html>")
+	}
+	if !regexpAMPHTML.MatchString(body) {
+		return fmt.Errorf("missing <html ⚡4email>")
+	}
+	if !regexpAMPCharset.MatchString(body) {
+		return fmt.Errorf(`missing <meta charset="utf-8">`)
+	}
+	if !regexpAMPRuntime.MatchString(body) {
+		return fmt.Errorf(`missing <script async src="https://cdn.ampproject.org/v0.js"></script>`)
+	}
+	if !regexpAMPBoilerplate.MatchString(body) {
+		return fmt.Errorf("missing <style amp4email-boilerplate>")
+	}
+
+	for _, s := range regexpAMPScript.FindAllString(body, -1) {
+		if !regexpAMPScriptOK.MatchString(s) {
+			return fmt.Errorf("script not allowed: %s", s)
+		}
+	}
+
+	if m := regexpAMPBadTag.FindString(body); m != "" {
+		return fmt.Errorf("tag not allowed: %s>", m)
+	}
+	if regexpAMPFormAction.MatchString(body) {
+		return fmt.Errorf("forms should use action-xhr instead of action")
+	}
+	if strings.Contains(body, "!important") {
+		return fmt.Errorf("!important is not allowed")
+	}
+
+	return nil
+}
+
+// validateCampaignAMP renders a campaign's AMP body, if there's one, with
+// a dummy subscriber and validates it.
+func validateCampaignAMP(id int, app *App) error {
+	camp, err := app.core.GetCampaignForPreview(id, 0)
+	if err != nil {
+		return err
+	}
+
+	if camp.ContentType == models.CampaignContentTypePlain || strings.TrimSpace(camp.BodyAMP.String) == "" {
+		return nil
+	}
+
+	// Use a dummy campaign ID to prevent views and clicks from being registered.
+	camp.UUID = dummySubscriber.UUID
+	if err := camp.CompileTemplate(app.manager.TemplateFuncs(&camp)); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			app.i18n.Ts("templates.errorCompiling", "error", err.Error()))
+	}
+
+	msg, err := app.manager.NewCampaignMessage(&camp, dummySubscriber)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			app.i18n.Ts("templates.errorRendering", "error", err.Error()))
+	}
+
+	if err := validateAMP(string(msg.AMPBody())); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			app.i18n.Ts("campaigns.invalidAMP", "error", err.Error()))
+	}
+
+	return nil
+}
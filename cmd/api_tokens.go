@@ -0,0 +1,248 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+const (
+	apiTokenLen = 32
+
+	// Context key of the API token that a request is authenticated with.
+	apiTokenCtxKey = "api_token"
+)
+
+var regexpAPITokenUsername = regexp.MustCompile(`^[a-z0-9_.\-]{1,100}$`)
+
+// handleGetAPITokens handles retrieval of API tokens.
+func handleGetAPITokens(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	out, err := app.core.GetAPITokens()
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleCreateAPIToken handles API token creation. The token is only
+// returned in the response and can't be retrieved later.
+func handleCreateAPIToken(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		o   = models.APIToken{}
+	)
+
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	o.Username = strings.TrimSpace(o.Username)
+	if !regexpAPITokenUsername.MatchString(o.Username) || o.Username == string(app.constants.AdminUsername) {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "username"))
+	}
+	o, err := validateAPIToken(o, app)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	token, err := generateRandomString(apiTokenLen)
+	if err != nil {
+		app.log.Printf("error generating api token: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			app.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.apiToken}", "error", err.Error()))
+	}
+
+	out, err := app.core.CreateAPIToken(o, hashAPIToken(token))
+	if err != nil {
+		return err
+	}
+	out.Token = token
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleUpdateAPIToken handles modification of the name, role, and lists of an API token.
+func handleUpdateAPIToken(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	var o models.APIToken
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	o, err := validateAPIToken(o, app)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	out, err := app.core.UpdateAPIToken(id, o)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleDeleteAPIToken handles API token deletion.
+func handleDeleteAPIToken(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	if err := app.core.DeleteAPIToken(id); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// validateAPIToken validates the name, role, lists, and list folders of an
+// API token. Analyst tokens can't add subscribers and have no lists.
+func validateAPIToken(o models.APIToken, app *App) (models.APIToken, error) {
+	o.Name = strings.TrimSpace(o.Name)
+	if !strHasLen(o.Name, 1, stdInputMaxLen) {
+		return o, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "name"))
+	}
+
+	if o.ListIDs == nil {
+		o.ListIDs = pq.Int64Array{}
+	}
+	if o.FolderIDs == nil {
+		o.FolderIDs = pq.Int64Array{}
+	}
+
+	switch o.Role {
+	case models.APITokenRoleSubscribe, "":
+		o.Role = models.APITokenRoleSubscribe
+	case models.APITokenRoleAnalyst:
+		o.ListIDs = pq.Int64Array{}
+		o.FolderIDs = pq.Int64Array{}
+		return o, nil
+	default:
+		return o, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "role"))
+	}
+
+	if len(o.ListIDs) == 0 && len(o.FolderIDs) == 0 {
+		return o, errors.New(app.i18n.T("apiTokens.noLists"))
+	}
+	if len(o.ListIDs) > 0 {
+		lists, err := app.core.GetListsByOptin(int64sToInts(o.ListIDs), "")
+		if err != nil {
+			return o, err
+		}
+		if len(lists) != len(o.ListIDs) {
+			return o, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "list_ids"))
+		}
+	}
+
+	// The token can add subscribers to the lists in its folders.
+	if len(o.FolderIDs) > 0 {
+		folders, err := app.core.GetListFolders()
+		if err != nil {
+			return o, err
+		}
+		for _, id := range o.FolderIDs {
+			found := false
+			for _, f := range folders {
+				if int64(f.ID) == id {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return o, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "folder_ids"))
+			}
+		}
+	}
+
+	return o, nil
+}
+
+// hashAPIToken returns the hash of an API token that's stored instead of it.
+func hashAPIToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// checkAPITokenScope middleware restricts requests authenticated with an API
+// token to the routes that the token's role can access.
+func checkAPITokenScope(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		tok, ok := c.Get(apiTokenCtxKey).(models.APIToken)
+		if !ok {
+			return next(c)
+		}
+
+		if !tok.CanAccess(c.Request().Method, c.Path()) {
+			app := c.Get("app").(*App)
+			return echo.NewHTTPError(http.StatusForbidden, app.i18n.T("apiTokens.notAllowed"))
+		}
+
+		return next(c)
+	}
+}
+
+// checkAPITokenLists checks that the lists of a request authenticated with an
+// API token, if it is, are all lists of the token.
+func checkAPITokenLists(c echo.Context, listIDs []int, listUUIDs []string) error {
+	tok, ok := c.Get(apiTokenCtxKey).(models.APIToken)
+	if !ok {
+		return nil
+	}
+
+	app := c.Get("app").(*App)
+	if len(listIDs) == 0 && len(listUUIDs) == 0 {
+		return echo.NewHTTPError(http.StatusForbidden, app.i18n.T("apiTokens.listNotAllowed"))
+	}
+
+	for _, id := range listIDs {
+		found := false
+		for _, l := range tok.ListIDs {
+			if int64(id) == l {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return echo.NewHTTPError(http.StatusForbidden, app.i18n.T("apiTokens.listNotAllowed"))
+		}
+	}
+
+	for _, u := range listUUIDs {
+		if !inArray(strings.ToLower(u), tok.ListUUIDs) {
+			return echo.NewHTTPError(http.StatusForbidden, app.i18n.T("apiTokens.listNotAllowed"))
+		}
+	}
+
+	return nil
+}
+
+// apiTokenMasksPII returns whether a request is authenticated with an API
+// token that the personal data of subscribers is masked for.
+func apiTokenMasksPII(c echo.Context) bool {
+	tok, ok := c.Get(apiTokenCtxKey).(models.APIToken)
+	return ok && tok.MasksPII()
+}
@@ -2,7 +2,11 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"html/template"
 	"net/http"
 	"net/url"
@@ -11,9 +15,23 @@ import (
 	"github.com/knadh/listmonk/internal/manager"
 	"github.com/knadh/listmonk/models"
 	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
 	null "gopkg.in/volatiletech/null.v6"
 )
 
+const (
+	tplArchivePassword = "archive-password"
+
+	// Prefix of the cookie that holds the access key of a password protected
+	// campaign on the archive.
+	archiveCookiePrefix = "listmonk_archive_"
+)
+
+type archivePasswordTpl struct {
+	publicTpl
+	Error string
+}
+
 type campArchive struct {
 	UUID      string    `json:"uuid"`
 	Subject   string    `json:"subject"`
@@ -21,6 +39,10 @@ type campArchive struct {
 	CreatedAt null.Time `json:"created_at"`
 	SendAt    null.Time `json:"send_at"`
 	URL       string    `json:"url"`
+
+	// Protected campaigns require a password or a subscriber token to view
+	// and their content isn't included in listings and feeds.
+	Protected bool `json:"protected"`
 }
 
 // handleGetCampaignArchives renders the public campaign archives page.
@@ -63,6 +85,17 @@ func handleGetCampaignArchivesFeed(c echo.Context) error {
 		return err
 	}
 
+	feed := makeArchiveFeed(camps, app.constants.RootURL, app)
+	if err := feed.WriteRss(c.Response().Writer); err != nil {
+		app.log.Printf("error generating archive RSS feed: %v", err)
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("public.errorProcessingRequest"))
+	}
+
+	return nil
+}
+
+// makeArchiveFeed returns the RSS feed of the given campaign archives.
+func makeArchiveFeed(camps []campArchive, rootURL string, app *App) *feeds.Feed {
 	out := make([]*feeds.Item, 0, len(camps))
 	for _, c := range camps {
 		pubDate := c.CreatedAt.Time
@@ -79,19 +112,12 @@ func handleGetCampaignArchivesFeed(c echo.Context) error {
 		})
 	}
 
-	feed := &feeds.Feed{
+	return &feeds.Feed{
 		Title:       app.constants.SiteName,
-		Link:        &feeds.Link{Href: app.constants.RootURL},
+		Link:        &feeds.Link{Href: rootURL},
 		Description: app.i18n.T("public.archiveTitle"),
 		Items:       out,
 	}
-
-	if err := feed.WriteRss(c.Response().Writer); err != nil {
-		app.log.Printf("error generating archive RSS feed: %v", err)
-		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("public.errorProcessingRequest"))
-	}
-
-	return nil
 }
 
 // handleCampaignArchivesPage renders the public campaign archives page.
@@ -153,6 +179,31 @@ func handleCampaignArchivePage(c echo.Context) error {
 			makeMsgTpl(app.i18n.T("public.errorTitle"), "", app.i18n.Ts("public.errorFetchingCampaign")))
 	}
 
+	switch pubCamp.ArchiveAccess {
+	case models.CampaignArchiveAccessSubscriber:
+		// ?token= should be the UUID of a subscriber of the campaign's lists.
+		token := c.QueryParam("token")
+		ok := false
+		if reUUID.MatchString(token) {
+			if ok, err = app.core.IsCampaignSubscriber(pubCamp.ID, token); err != nil {
+				return c.Render(http.StatusInternalServerError, tplMessage,
+					makeMsgTpl(app.i18n.T("public.errorTitle"), "", app.i18n.Ts("public.errorFetchingCampaign")))
+			}
+		}
+		if !ok {
+			return c.Render(http.StatusForbidden, tplMessage,
+				makeMsgTpl(app.i18n.T("public.archiveRestrictedTitle"), "", app.i18n.T("public.archiveSubscribersOnly")))
+		}
+
+	case models.CampaignArchiveAccessPassword:
+		ck, err := c.Cookie(archiveCookiePrefix + pubCamp.UUID)
+		if err != nil || subtle.ConstantTimeCompare([]byte(ck.Value), []byte(makeArchiveAccessKey(pubCamp))) != 1 {
+			return c.Render(http.StatusUnauthorized, tplArchivePassword, archivePasswordTpl{
+				publicTpl: publicTpl{Title: app.i18n.T("public.archiveRestrictedTitle")},
+			})
+		}
+	}
+
 	out, err := compileArchiveCampaigns([]models.Campaign{pubCamp}, app)
 	if err != nil {
 		return c.Render(http.StatusInternalServerError, tplMessage,
@@ -171,6 +222,59 @@ func handleCampaignArchivePage(c echo.Context) error {
 	return c.HTML(http.StatusOK, string(msg.Body()))
 }
 
+// handleCampaignArchivePassword checks the password of a password protected
+// campaign on the archive and on success, sets the cookie that grants access
+// to it and redirects to the campaign page.
+func handleCampaignArchivePassword(c echo.Context) error {
+	var (
+		app      = c.Get("app").(*App)
+		id       = c.Param("id")
+		password = c.FormValue("password")
+		uuid     = ""
+		slug     = ""
+	)
+
+	// ID can be the UUID or slug.
+	if reUUID.MatchString(id) {
+		uuid = id
+	} else {
+		slug = id
+	}
+
+	pubCamp, err := app.core.GetArchivedCampaign(0, uuid, slug)
+	if err != nil || pubCamp.Type != models.CampaignTypeRegular {
+		return c.Render(http.StatusNotFound, tplMessage,
+			makeMsgTpl(app.i18n.T("public.notFoundTitle"), "", app.i18n.T("public.campaignNotFound")))
+	}
+
+	// Campaigns that aren't password protected don't need the cookie.
+	if pubCamp.ArchiveAccess != models.CampaignArchiveAccessPassword {
+		return c.Redirect(http.StatusSeeOther, c.Request().URL.Path)
+	}
+
+	if password == "" || bcrypt.CompareHashAndPassword([]byte(pubCamp.ArchivePassword), []byte(password)) != nil {
+		return c.Render(http.StatusUnauthorized, tplArchivePassword, archivePasswordTpl{
+			publicTpl: publicTpl{Title: app.i18n.T("public.archiveRestrictedTitle")},
+			Error:     app.i18n.T("public.archiveInvalidPassword"),
+		})
+	}
+
+	ckPath := "/"
+	if u, err := url.Parse(app.constants.ArchiveURL); err == nil && u.Path != "" {
+		ckPath = u.Path
+	}
+	c.SetCookie(&http.Cookie{
+		Name:     archiveCookiePrefix + pubCamp.UUID,
+		Value:    makeArchiveAccessKey(pubCamp),
+		Path:     ckPath,
+		Secure:   c.Scheme() == "https",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return c.Redirect(http.StatusSeeOther, c.Request().URL.Path)
+}
+
 // handleCampaignArchivePageLatest renders the latest public campaign.
 func handleCampaignArchivePageLatest(c echo.Context) error {
 	var (
@@ -189,6 +293,11 @@ func handleCampaignArchivePageLatest(c echo.Context) error {
 
 	camp := camps[0]
 
+	// Protected campaigns are only viewable on their own pages.
+	if camp.Protected {
+		return c.Redirect(http.StatusFound, camp.URL)
+	}
+
 	return c.HTML(http.StatusOK, camp.Content)
 }
 
@@ -212,6 +321,7 @@ func getCampaignArchives(offset, limit int, renderBody bool, app *App) ([]campAr
 			Subject:   camp.Subject,
 			CreatedAt: camp.CreatedAt,
 			SendAt:    camp.SendAt,
+			Protected: camp.ArchiveAccess != "" && camp.ArchiveAccess != models.CampaignArchiveAccessPublic,
 		}
 
 		if camp.ArchiveSlug.Valid {
@@ -220,7 +330,7 @@ func getCampaignArchives(offset, limit int, renderBody bool, app *App) ([]campAr
 			archive.URL, _ = url.JoinPath(app.constants.ArchiveURL, camp.UUID)
 		}
 
-		if renderBody {
+		if renderBody && !archive.Protected {
 			msg, err := app.manager.NewCampaignMessage(camp, m.Subscriber)
 			if err != nil {
 				return []campArchive{}, total, err
@@ -274,3 +384,49 @@ func compileArchiveCampaigns(camps []models.Campaign, app *App) ([]manager.Campa
 
 	return out, nil
 }
+
+// makeArchiveAccessKey returns the value of the cookie that grants access to
+// a password protected campaign on the archive. It's derived from the
+// password's hash so that changing the password revokes earlier access.
+func makeArchiveAccessKey(c models.Campaign) string {
+	h := sha256.Sum256([]byte(c.UUID + ":" + c.ArchivePassword))
+	return hex.EncodeToString(h[:])
+}
+
+// makeArchivePassword returns the password hash of a campaign on the archive
+// with the given access. A new password, if given, is hashed, or else, the
+// existing hash is retained. Campaigns that aren't password protected don't
+// have a hash.
+func makeArchivePassword(access, password, hash string, app *App) (string, error) {
+	if access != models.CampaignArchiveAccessPassword {
+		return "", nil
+	}
+
+	if password == "" {
+		if hash == "" {
+			return "", errors.New(app.i18n.T("campaigns.archivePasswordRequired"))
+		}
+		return hash, nil
+	}
+
+	if !strHasLen(password, 4, stdInputMaxLen) {
+		return "", errors.New(app.i18n.T("campaigns.archivePasswordRequired"))
+	}
+
+	b, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// isArchiveAccess checks if the given campaign archive access is valid.
+func isArchiveAccess(access string) bool {
+	switch access {
+	case models.CampaignArchiveAccessPublic, models.CampaignArchiveAccessPassword, models.CampaignArchiveAccessSubscriber:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/knadh/listmonk/internal/media"
+	"github.com/knadh/listmonk/internal/media/providers/s3"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	archiveExportFilesystem = "filesystem"
+	archiveExportS3         = "s3"
+
+	// Number of campaigns on every page of the exported archive index.
+	archiveExportPerPage = 20
+)
+
+// archiveExportReq represents a static archive export request. Files are
+// written to Path under the app.archive_export_dir directory on the
+// filesystem, or to Path in the S3 Bucket that's accessed with the
+// upload.s3 credentials.
+type archiveExportReq struct {
+	Target  string `json:"target"`
+	Path    string `json:"path"`
+	Bucket  string `json:"bucket"`
+	RootURL string `json:"root_url"`
+}
+
+// archiveWriter writes a file of the static archive export.
+type archiveWriter func(name string, b []byte) error
+
+// handleExportCampaignArchives exports the public campaign archive as a
+// static HTML site to a directory or an S3 bucket.
+func handleExportCampaignArchives(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		req archiveExportReq
+	)
+
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	w, err := makeArchiveWriter(req, app)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	n, err := exportArchive(w, req.RootURL, app)
+	if err != nil {
+		app.log.Printf("error exporting campaign archive: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			app.i18n.Ts("campaigns.archiveExportError", "error", err.Error()))
+	}
+
+	return c.JSON(http.StatusOK, okResp{struct {
+		Files int `json:"files"`
+	}{n}})
+}
+
+// makeArchiveWriter returns an archiveWriter for the export target.
+func makeArchiveWriter(req archiveExportReq, app *App) (archiveWriter, error) {
+	switch req.Target {
+	case archiveExportFilesystem, "":
+		dir, err := archiveExportPath(app.constants.ArchiveExportDir, req.Path)
+		if err != nil {
+			return nil, errors.New(app.i18n.T("campaigns.archiveExportInvalidPath"))
+		}
+		return makeArchiveDirWriter(dir), nil
+
+	case archiveExportS3:
+		if req.Bucket == "" {
+			return nil, errors.New(app.i18n.T("campaigns.archiveExportInvalidBucket"))
+		}
+
+		o := app.constants.MediaUpload.S3
+		o.Bucket = req.Bucket
+		o.BucketPath = req.Path
+		o.BucketType = "public"
+
+		st, err := s3.NewS3Store(o)
+		if err != nil {
+			return nil, err
+		}
+		return makeArchiveS3Writer(st), nil
+	}
+
+	return nil, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "target"))
+}
+
+// archiveExportPath returns the directory to export to, which is the given
+// path relative to, or an absolute path under, the configured export
+// directory. Paths that leave the export directory are rejected.
+func archiveExportPath(root, p string) (string, error) {
+	if root == "" || !filepath.IsAbs(root) {
+		return "", errors.New("archive exports to the filesystem are disabled")
+	}
+	root = filepath.Clean(root)
+
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(root, p)
+	}
+	p = filepath.Clean(p)
+
+	rel, err := filepath.Rel(root, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %s is outside the export directory", p)
+	}
+
+	return p, nil
+}
+
+func makeArchiveDirWriter(dir string) archiveWriter {
+	return func(name string, b []byte) error {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(p, b, 0644)
+	}
+}
+
+func makeArchiveS3Writer(st media.Store) archiveWriter {
+	return func(name string, b []byte) error {
+		cType := mime.TypeByExtension(path.Ext(name))
+		if cType == "" {
+			cType = "application/octet-stream"
+		}
+		_, err := st.Put(name, cType, bytes.NewReader(b))
+		return err
+	}
+}
+
+// exportArchive writes the public campaign archive as static files: the
+// paginated index, every campaign's page (by slug and UUID), the latest
+// campaign, the RSS feed, and the public static assets. The files are laid
+// out in the same paths as the live archive, linked to rootURL, which defaults
+// to the app's root URL. Password and subscriber protected campaigns are left
+// out. It returns the number of files written.
+func exportArchive(w archiveWriter, rootURL string, app *App) (int, error) {
+	rootURL = strings.TrimRight(rootURL, "/")
+	if rootURL == "" {
+		rootURL = app.constants.RootURL
+	}
+
+	// Subscription pages aren't available in the static archive.
+	tpl := *initPublicTemplates(app)
+	tpl.RootURL = rootURL
+	tpl.EnablePublicSubPage = false
+
+	var (
+		archiveURL = rootURL + "/archive"
+		title      = app.i18n.T("public.archiveTitle")
+		n          = 0
+		b          bytes.Buffer
+	)
+
+	write := func(name string, data []byte) error {
+		if err := w(name, data); err != nil {
+			return fmt.Errorf("error writing %s: %v", name, err)
+		}
+		n++
+		return nil
+	}
+
+	for page := 1; ; page++ {
+		pg := app.paginator.New(page, archiveExportPerPage)
+
+		camps, total, err := getCampaignArchives(pg.Offset, pg.Limit, true, app)
+		if err != nil {
+			return n, err
+		}
+		pg.SetTotal(total)
+
+		// Protected campaigns can't be access controlled on a static site.
+		pub := camps[:0]
+		for _, c := range camps {
+			if !c.Protected {
+				pub = append(pub, c)
+			}
+		}
+		camps = pub
+
+		for i, c := range camps {
+			body := []byte(c.Content)
+			c.URL = archiveURL + strings.TrimPrefix(c.URL, app.constants.ArchiveURL)
+			camps[i] = c
+
+			// Campaign pages are reachable by their slugs (or UUIDs) and
+			// UUIDs, like on the live archive.
+			if err := write(strings.TrimPrefix(c.URL, rootURL+"/")+"/index.html", body); err != nil {
+				return n, err
+			}
+			if !strings.HasSuffix(c.URL, "/"+c.UUID) {
+				if err := write("archive/"+c.UUID+"/index.html", body); err != nil {
+					return n, err
+				}
+			}
+
+			if page == 1 && i == 0 {
+				if err := write("archive/latest/index.html", body); err != nil {
+					return n, err
+				}
+			}
+		}
+
+		// The archive index page.
+		b.Reset()
+		if err := tpl.render(&b, "archive", struct {
+			Title       string
+			Description string
+			Campaigns   []campArchive
+			TotalPages  int
+			Pagination  template.HTML
+		}{title, title, camps, pg.TotalPages, template.HTML(pg.HTML(archiveURL + "/page/%d/"))}, app.i18n); err != nil {
+			return n, err
+		}
+		if page == 1 {
+			if err := write("archive/index.html", b.Bytes()); err != nil {
+				return n, err
+			}
+
+			// The RSS feed of the latest campaigns.
+			items := make([]campArchive, len(camps))
+			for i, c := range camps {
+				if !app.constants.EnablePublicArchiveRSSContent {
+					c.Content = ""
+				}
+				items[i] = c
+			}
+
+			var feed bytes.Buffer
+			if err := makeArchiveFeed(items, rootURL, app).WriteRss(&feed); err != nil {
+				return n, err
+			}
+			if err := write("archive.xml", feed.Bytes()); err != nil {
+				return n, err
+			}
+		}
+		if err := write(fmt.Sprintf("archive/page/%d/index.html", page), b.Bytes()); err != nil {
+			return n, err
+		}
+
+		if page >= pg.TotalPages {
+			break
+		}
+	}
+
+	// Public static assets.
+	files, err := app.fs.Glob("/public/static/*")
+	if err != nil {
+		return n, err
+	}
+	for _, f := range files {
+		data, err := app.fs.Read(f)
+		if err != nil {
+			return n, err
+		}
+		if err := write(strings.TrimPrefix(f, "/"), data); err != nil {
+			return n, err
+		}
+	}
+	if err := write("public/custom.css", app.constants.Appearance.PublicCSS); err != nil {
+		return n, err
+	}
+	if err := write("public/custom.js", app.constants.Appearance.PublicJS); err != nil {
+		return n, err
+	}
+
+	return n, nil
+}
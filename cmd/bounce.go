@@ -30,6 +30,9 @@ func handleGetBounces(c echo.Context) error {
 		if err != nil {
 			return err
 		}
+		if apiTokenMasksPII(c) {
+			out.MaskPII()
+		}
 		return c.JSON(http.StatusOK, okResp{out})
 	}
 
@@ -37,6 +40,11 @@ func handleGetBounces(c echo.Context) error {
 	if err != nil {
 		return err
 	}
+	if apiTokenMasksPII(c) {
+		for i := range res {
+			res[i].MaskPII()
+		}
+	}
 
 	// No results.
 	var out models.PageResults
@@ -54,6 +62,22 @@ func handleGetBounces(c echo.Context) error {
 	return c.JSON(http.StatusOK, okResp{out})
 }
 
+// handleGetBounceAuthStats returns bounce counts grouped by the SPF/DKIM/DMARC/ARC
+// authentication results found in bounce e-mails.
+func handleGetBounceAuthStats(c echo.Context) error {
+	var (
+		app       = c.Get("app").(*App)
+		campID, _ = strconv.Atoi(c.QueryParam("campaign_id"))
+	)
+
+	out, err := app.core.GetBounceAuthStats(campID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
 // handleGetSubscriberBounces retrieves a subscriber's bounce records.
 func handleGetSubscriberBounces(c echo.Context) error {
 	var (
@@ -69,6 +93,11 @@ func handleGetSubscriberBounces(c echo.Context) error {
 	if err != nil {
 		return err
 	}
+	if apiTokenMasksPII(c) {
+		for i := range out {
+			out[i].MaskPII()
+		}
+	}
 
 	return c.JSON(http.StatusOK, okResp{out})
 }
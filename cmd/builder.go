@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"github.com/knadh/listmonk/internal/builder"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// handleRenderBuilderDoc renders a posted visual builder document to HTML.
+func handleRenderBuilderDoc(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	doc, err := bindBuilderDoc(c, app)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{struct {
+		HTML string `json:"html"`
+	}{builder.Render(doc)}})
+}
+
+// handleGetCampaignBuilderDoc returns the visual builder document of a campaign.
+func handleGetCampaignBuilderDoc(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	out, err := app.core.GetBuilderDoc(id, 0)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleUpdateCampaignBuilderDoc saves the visual builder document of a
+// campaign and renders it to the campaign's body as HTML.
+func handleUpdateCampaignBuilderDoc(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	doc, err := bindBuilderDoc(c, app)
+	if err != nil {
+		return err
+	}
+
+	// The content placeholder is only for templates.
+	if doc.HasBlock(builder.BlockContent) {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			app.i18n.Ts("templates.builder.invalid", "error", app.i18n.T("templates.builder.contentBlock")))
+	}
+
+	cm, err := app.core.GetCampaign(id, "", "")
+	if err != nil {
+		return err
+	}
+
+	if isCampaignalMutable(cm.Status) {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("campaigns.cantUpdate"))
+	}
+
+	cm.Body = builder.Render(doc)
+	cm.ContentType = models.CampaignContentTypeHTML
+
+	// The campaign's lists and media stay as they are.
+	listIDs, mediaIDs, err := campaignListMediaIDs(cm)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	if _, err := app.core.UpdateCampaign(id, cm, listIDs, mediaIDs, cm.SendAt.Valid); err != nil {
+		return err
+	}
+
+	return saveBuilderDoc(c, id, 0, doc, app)
+}
+
+// handleDeleteCampaignBuilderDoc deletes the visual builder document of a
+// campaign, leaving the body that was rendered from it to be edited as HTML.
+func handleDeleteCampaignBuilderDoc(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	if err := app.core.DeleteBuilderDoc(id, 0); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// handleGetTemplateBuilderDoc returns the visual builder document of a template.
+func handleGetTemplateBuilderDoc(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	out, err := app.core.GetBuilderDoc(0, id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleUpdateTemplateBuilderDoc saves the visual builder document of a
+// template and renders it to the template's body. The body is saved like
+// any other edit, which snapshots it as a revision.
+func handleUpdateTemplateBuilderDoc(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	doc, err := bindBuilderDoc(c, app)
+	if err != nil {
+		return err
+	}
+
+	o, err := app.core.GetTemplate(id, false)
+	if err != nil {
+		return err
+	}
+	o.Body = builder.Render(doc)
+	o.BodyMJML = ""
+
+	if err := validateTemplate(o, app); err != nil {
+		return err
+	}
+
+	var f template.FuncMap
+	if o.Type == models.TemplateTypeCampaign {
+		f = app.manager.TemplateFuncs(nil)
+	} else {
+		f = app.manager.GenericTemplateFuncs()
+	}
+	if err := o.Compile(f); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	out, err := app.core.UpdateTemplate(id, o.Name, o.Subject, o.Preheader, []byte(o.Body), []byte(o.BodyAMP), []byte(o.BodyMJML), o.LangVariants)
+	if err != nil {
+		return err
+	}
+
+	// If it's a transactional template, cache it.
+	if o.Type == models.TemplateTypeTx {
+		app.manager.CacheTpl(out.ID, &o)
+	}
+
+	return saveBuilderDoc(c, 0, id, doc, app)
+}
+
+// handleDeleteTemplateBuilderDoc deletes the visual builder document of a
+// template, leaving the body that was rendered from it to be edited as HTML.
+func handleDeleteTemplateBuilderDoc(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	if err := app.core.DeleteBuilderDoc(0, id); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// bindBuilderDoc binds and validates the posted visual builder document.
+func bindBuilderDoc(c echo.Context, app *App) (builder.Doc, error) {
+	var doc builder.Doc
+	if err := c.Bind(&doc); err != nil {
+		return doc, err
+	}
+
+	if err := builder.Validate(&doc); err != nil {
+		return doc, echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("templates.builder.invalid", "error", err.Error()))
+	}
+
+	return doc, nil
+}
+
+// saveBuilderDoc saves the visual builder document of a campaign or a template.
+func saveBuilderDoc(c echo.Context, campID, tplID int, doc builder.Doc, app *App) error {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	out, err := app.core.UpsertBuilderDoc(campID, tplID, b)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"gopkg.in/volatiletech/null.v6"
+)
+
+// Version of the campaign bundle format.
+const campBundleVersion = 1
+
+// campBundle is a portable export of a campaign that can be imported into
+// another instance. Lists and media are referenced by their IDs and names in
+// the source instance and are remapped on import.
+type campBundle struct {
+	Version         int             `json:"version"`
+	Campaign        bundleCampaign  `json:"campaign"`
+	Template        *bundleTemplate `json:"template"`
+	ArchiveTemplate *bundleTemplate `json:"archive_template"`
+	Lists           []bundleList    `json:"lists"`
+	Media           []bundleMedia   `json:"media"`
+}
+
+type bundleCampaign struct {
+	Name          string               `json:"name"`
+	Subject       string               `json:"subject"`
+	FromEmail     string               `json:"from_email"`
+	ContentType   string               `json:"content_type"`
+	Body          string               `json:"body"`
+	AltBody       null.String          `json:"altbody"`
+	BodyAMP       null.String          `json:"body_amp"`
+	Preheader     string               `json:"preheader"`
+	Headers       models.Headers       `json:"headers"`
+	ListIDHeader  string               `json:"list_id_header"`
+	Tags          []string             `json:"tags"`
+	Messenger     string               `json:"messenger"`
+	Failover      []string             `json:"failover_messengers"`
+	ContentBlocks models.ContentBlocks `json:"content_blocks"`
+	UTMParams     models.UTMParams     `json:"utm_params"`
+	Archive       bool                 `json:"archive"`
+	ArchiveSlug   null.String          `json:"archive_slug"`
+	ArchiveMeta   json.RawMessage      `json:"archive_meta"`
+}
+
+type bundleTemplate struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Subject   string `json:"subject"`
+	Body      string `json:"body"`
+	BodyAMP   string `json:"body_amp"`
+	BodyMJML  string `json:"body_mjml,omitempty"`
+	Preheader string `json:"preheader"`
+}
+
+type bundleList struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type bundleMedia struct {
+	ID       int    `json:"id"`
+	Filename string `json:"filename"`
+	URL      string `json:"url"`
+}
+
+// campBundleImport is a campaign bundle import request. Lists and Media map
+// the IDs of lists and media in the source instance to the IDs in this
+// instance. Unmapped lists and media are matched by their names.
+type campBundleImport struct {
+	Bundle campBundle     `json:"bundle"`
+	Lists  map[string]int `json:"lists"`
+	Media  map[string]int `json:"media"`
+}
+
+// handleExportCampaignBundle exports a campaign as a JSON bundle.
+func handleExportCampaignBundle(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	camp, err := app.core.GetCampaign(id, "", "")
+	if err != nil {
+		return err
+	}
+
+	out := campBundle{
+		Version: campBundleVersion,
+		Campaign: bundleCampaign{
+			Name:          camp.Name,
+			Subject:       camp.Subject,
+			FromEmail:     camp.FromEmail,
+			ContentType:   camp.ContentType,
+			Body:          camp.Body,
+			AltBody:       camp.AltBody,
+			BodyAMP:       camp.BodyAMP,
+			Preheader:     camp.Preheader,
+			Headers:       camp.Headers,
+			ListIDHeader:  camp.ListIDHeader,
+			Tags:          camp.Tags,
+			Messenger:     camp.Messenger,
+			Failover:      camp.Failover,
+			ContentBlocks: camp.ContentBlocks,
+			UTMParams:     camp.UTMParams,
+			Archive:       camp.Archive,
+			ArchiveSlug:   camp.ArchiveSlug,
+			ArchiveMeta:   camp.ArchiveMeta,
+		},
+		Lists: []bundleList{},
+		Media: []bundleMedia{},
+	}
+
+	if out.Template, err = getBundleTemplate(camp.TemplateID, app); err != nil {
+		return err
+	}
+	if camp.ArchiveTemplateID != camp.TemplateID {
+		if out.ArchiveTemplate, err = getBundleTemplate(camp.ArchiveTemplateID, app); err != nil {
+			return err
+		}
+	} else {
+		out.ArchiveTemplate = out.Template
+	}
+
+	if len(camp.Lists) > 0 {
+		if err := camp.Lists.Unmarshal(&out.Lists); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+	}
+	if len(camp.Media) > 0 {
+		if err := camp.Media.Unmarshal(&out.Media); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+	}
+	for i, m := range out.Media {
+		out.Media[i].URL = app.media.GetURL(m.Filename)
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=campaign-%d.json", camp.ID))
+	return c.JSON(http.StatusOK, out)
+}
+
+// handleImportCampaignBundle creates a draft campaign from a campaign bundle,
+// remapping its lists, media, and templates to the ones in this instance.
+func handleImportCampaignBundle(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		req campBundleImport
+	)
+
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	b := req.Bundle
+	if b.Version != campBundleVersion {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			app.i18n.Ts("campaigns.bundleInvalidVersion", "version", strconv.Itoa(b.Version)))
+	}
+
+	// Map the lists.
+	listIDs, err := mapBundleLists(b.Lists, req.Lists, app)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	// Map the templates, creating the ones that don't exist.
+	tplID, err := importBundleTemplate(b.Template, app)
+	if err != nil {
+		return err
+	}
+	archiveTplID := tplID
+	if b.ArchiveTemplate != nil && (b.Template == nil || *b.ArchiveTemplate != *b.Template) {
+		if archiveTplID, err = importBundleTemplate(b.ArchiveTemplate, app); err != nil {
+			return err
+		}
+	}
+
+	camp := b.Campaign
+	o := campaignReq{
+		Campaign: models.Campaign{
+			Type:              models.CampaignTypeRegular,
+			Name:              camp.Name,
+			Subject:           camp.Subject,
+			FromEmail:         camp.FromEmail,
+			ContentType:       camp.ContentType,
+			Body:              camp.Body,
+			AltBody:           camp.AltBody,
+			BodyAMP:           camp.BodyAMP,
+			Preheader:         camp.Preheader,
+			Headers:           camp.Headers,
+			ListIDHeader:      camp.ListIDHeader,
+			Tags:              camp.Tags,
+			Messenger:         camp.Messenger,
+			Failover:          pq.StringArray(camp.Failover),
+			ContentBlocks:     camp.ContentBlocks,
+			UTMParams:         camp.UTMParams,
+			TemplateID:        tplID,
+			Archive:           camp.Archive,
+			ArchiveSlug:       camp.ArchiveSlug,
+			ArchiveTemplateID: archiveTplID,
+			ArchiveMeta:       camp.ArchiveMeta,
+		},
+		ListIDs: listIDs,
+	}
+	if o.ContentType == "" {
+		o.ContentType = models.CampaignContentTypeRichtext
+	}
+	if o.Messenger == "" {
+		o.Messenger = "email"
+	}
+	if len(o.ArchiveMeta) == 0 {
+		o.ArchiveMeta = json.RawMessage("{}")
+	}
+
+	// Archive slugs are unique. Drop the slug if it's taken in this instance.
+	if o.ArchiveSlug.String != "" {
+		if _, err := app.core.GetCampaign(0, "", o.ArchiveSlug.String); err == nil {
+			o.ArchiveSlug = null.String{}
+		}
+	}
+
+	// Map the media and replace the URLs of the source media in the content.
+	unmatched := []bundleMedia{}
+	for _, m := range b.Media {
+		med, ok, err := mapBundleMedia(m, req.Media, app)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			unmatched = append(unmatched, m)
+			continue
+		}
+
+		o.MediaIDs = append(o.MediaIDs, med.ID)
+		if m.URL != "" && m.URL != med.URL {
+			o.Body = strings.ReplaceAll(o.Body, m.URL, med.URL)
+			o.AltBody.String = strings.ReplaceAll(o.AltBody.String, m.URL, med.URL)
+			o.BodyAMP.String = strings.ReplaceAll(o.BodyAMP.String, m.URL, med.URL)
+			for i, bl := range o.ContentBlocks {
+				o.ContentBlocks[i].Body = strings.ReplaceAll(bl.Body, m.URL, med.URL)
+			}
+		}
+	}
+
+	if v, err := validateCampaignFields(o, app); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	} else {
+		o = v
+	}
+
+	out, err := app.core.CreateCampaign(o.Campaign, o.ListIDs, o.MediaIDs)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{struct {
+		Campaign       models.Campaign `json:"campaign"`
+		UnmatchedMedia []bundleMedia   `json:"unmatched_media"`
+	}{out, unmatched}})
+}
+
+// getBundleTemplate returns the template with the given ID for a bundle.
+func getBundleTemplate(id int, app *App) (*bundleTemplate, error) {
+	if id < 1 {
+		return nil, nil
+	}
+
+	t, err := app.core.GetTemplate(id, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &bundleTemplate{Name: t.Name, Type: t.Type, Subject: t.Subject, Body: t.Body, BodyAMP: t.BodyAMP, BodyMJML: t.BodyMJML, Preheader: t.Preheader}, nil
+}
+
+// importBundleTemplate returns the ID of the template in this instance
+// with the same name and type as the bundle's template, creating it if it
+// doesn't exist. Without a template, the default template (0) is used.
+func importBundleTemplate(t *bundleTemplate, app *App) (int, error) {
+	if t == nil {
+		return 0, nil
+	}
+
+	tpls, err := app.core.GetTemplates(t.Type, true)
+	if err != nil {
+		return 0, err
+	}
+	for _, tp := range tpls {
+		if tp.Name == t.Name {
+			return tp.ID, nil
+		}
+	}
+
+	o := models.Template{Name: t.Name, Type: t.Type, Subject: t.Subject, Body: t.Body, BodyAMP: t.BodyAMP, BodyMJML: t.BodyMJML, Preheader: t.Preheader}
+	if err := validateTemplate(o, app); err != nil {
+		return 0, err
+	}
+
+	f := app.manager.GenericTemplateFuncs()
+	if o.Type == models.TemplateTypeCampaign {
+		o.Subject = ""
+		f = app.manager.TemplateFuncs(nil)
+	}
+	if err := o.Compile(f); err != nil {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	out, err := app.core.CreateTemplate(o.Name, o.Type, o.Subject, o.Preheader, []byte(o.Body), []byte(o.BodyAMP), []byte(o.BodyMJML), o.LangVariants)
+	if err != nil {
+		return 0, err
+	}
+
+	return out.ID, nil
+}
+
+// mapBundleLists maps the lists of a bundle to the lists in this instance,
+// by the given ID map or by their names.
+func mapBundleLists(lists []bundleList, idMap map[string]int, app *App) ([]int, error) {
+	all, err := app.core.GetLists("")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		ids    = make(map[int]bool, len(all))
+		byName = make(map[string]int, len(all))
+	)
+	for _, l := range all {
+		ids[l.ID] = true
+		byName[l.Name] = l.ID
+	}
+
+	out := make([]int, 0, len(lists))
+	for _, l := range lists {
+		if id, ok := idMap[strconv.Itoa(l.ID)]; ok {
+			if !ids[id] {
+				return nil, errors.New(app.i18n.Ts("campaigns.bundleListNotFound", "name", strconv.Itoa(id)))
+			}
+			out = append(out, id)
+			continue
+		}
+
+		id, ok := byName[l.Name]
+		if !ok {
+			return nil, errors.New(app.i18n.Ts("campaigns.bundleListNotFound", "name", l.Name))
+		}
+		out = append(out, id)
+	}
+
+	return out, nil
+}
+
+// mapBundleMedia maps a bundle's media item to a media item in this instance,
+// by the given ID map or by its filename.
+func mapBundleMedia(m bundleMedia, idMap map[string]int, app *App) (bundleMedia, bool, error) {
+	if id, ok := idMap[strconv.Itoa(m.ID)]; ok {
+		med, err := app.core.GetMedia(id, "", app.media)
+		if err != nil {
+			return bundleMedia{}, false, err
+		}
+		return bundleMedia{ID: med.ID, Filename: med.Filename, URL: med.URL}, true, nil
+	}
+
+	res, _, err := app.core.QueryMedia(app.constants.MediaUpload.Provider, app.media, m.Filename, 0, 100)
+	if err != nil {
+		return bundleMedia{}, false, err
+	}
+	for _, med := range res {
+		if med.Filename == m.Filename {
+			return bundleMedia{ID: med.ID, Filename: med.Filename, URL: med.URL}, true, nil
+		}
+	}
+
+	return bundleMedia{}, false, nil
+}
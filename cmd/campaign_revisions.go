@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/knadh/listmonk/internal/textdiff"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// campRevisionDiff is a content revision of a campaign with the line by line
+// diffs of its content against another revision, by default, the one before it.
+type campRevisionDiff struct {
+	models.CampaignRevision
+
+	Against int64 `json:"against"`
+	Diff    struct {
+		Subject []textdiff.Line `json:"subject"`
+		Body    []textdiff.Line `json:"body"`
+		AltBody []textdiff.Line `json:"altbody"`
+		BodyAMP []textdiff.Line `json:"body_amp"`
+	} `json:"diff"`
+}
+
+// handleGetCampaignRevisions returns the content revisions of a campaign.
+func handleGetCampaignRevisions(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	out, err := app.core.GetCampaignRevisions(id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleGetCampaignRevision returns a content revision of a campaign and its
+// diff against the revision in ?against, or the one before it.
+func handleGetCampaignRevision(c echo.Context) error {
+	var (
+		app          = c.Get("app").(*App)
+		id, _        = strconv.Atoi(c.Param("id"))
+		revID, _     = strconv.ParseInt(c.Param("revID"), 10, 64)
+		againstID, _ = strconv.ParseInt(c.QueryParam("against"), 10, 64)
+	)
+
+	if id < 1 || revID < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	rev, err := app.core.GetCampaignRevision(id, revID, false)
+	if err != nil {
+		return err
+	}
+
+	var against *models.CampaignRevision
+	if againstID > 0 {
+		against, err = app.core.GetCampaignRevision(id, againstID, false)
+	} else {
+		against, err = app.core.GetCampaignRevision(id, revID, true)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The first revision is diffed against nothing.
+	if against == nil {
+		against = &models.CampaignRevision{}
+	}
+
+	out := campRevisionDiff{CampaignRevision: *rev, Against: against.ID}
+	out.Diff.Subject = textdiff.Lines(against.Subject, rev.Subject)
+	out.Diff.Body = textdiff.Lines(against.Body, rev.Body)
+	out.Diff.AltBody = textdiff.Lines(against.AltBody.String, rev.AltBody.String)
+	out.Diff.BodyAMP = textdiff.Lines(against.BodyAMP.String, rev.BodyAMP.String)
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleRestoreCampaignRevision restores the content of a campaign to that of
+// one of its revisions. The restored content is saved like any other edit,
+// which snapshots it as a new revision.
+func handleRestoreCampaignRevision(c echo.Context) error {
+	var (
+		app      = c.Get("app").(*App)
+		id, _    = strconv.Atoi(c.Param("id"))
+		revID, _ = strconv.ParseInt(c.Param("revID"), 10, 64)
+	)
+
+	if id < 1 || revID < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	cm, err := app.core.GetCampaign(id, "", "")
+	if err != nil {
+		return err
+	}
+
+	if isCampaignalMutable(cm.Status) {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("campaigns.cantUpdate"))
+	}
+
+	rev, err := app.core.GetCampaignRevision(id, revID, false)
+	if err != nil {
+		return err
+	}
+
+	cm.Subject = rev.Subject
+	cm.Body = rev.Body
+	cm.AltBody = rev.AltBody
+	cm.BodyAMP = rev.BodyAMP
+	cm.ContentType = rev.ContentType
+	cm.ContentBlocks = rev.ContentBlocks
+	if rev.TemplateID.Valid {
+		cm.TemplateID = int(rev.TemplateID.Int)
+	}
+
+	// The campaign's lists and media stay as they are.
+	listIDs, mediaIDs, err := campaignListMediaIDs(cm)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	out, err := app.core.UpdateCampaign(id, cm, listIDs, mediaIDs, cm.SendAt.Valid)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// campaignListMediaIDs returns the IDs of the lists and media of a campaign.
+func campaignListMediaIDs(cm models.Campaign) ([]int, []int, error) {
+	var (
+		lists []struct {
+			ID int `json:"id"`
+		}
+		media []struct {
+			ID int `json:"id"`
+		}
+	)
+	if len(cm.Lists) > 0 {
+		if err := json.Unmarshal(cm.Lists, &lists); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(cm.Media) > 0 {
+		if err := json.Unmarshal(cm.Media, &media); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	listIDs := make([]int, 0, len(lists))
+	for _, l := range lists {
+		if l.ID > 0 {
+			listIDs = append(listIDs, l.ID)
+		}
+	}
+	mediaIDs := make([]int, 0, len(media))
+	for _, m := range media {
+		if m.ID > 0 {
+			mediaIDs = append(mediaIDs, m.ID)
+		}
+	}
+
+	return listIDs, mediaIDs, nil
+}
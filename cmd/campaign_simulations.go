@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// Max number of the rendering errors of a dry run that are recorded.
+	simulationMaxErrorSamples = 100
+
+	// Interval at which the progress of a dry run is recorded.
+	simulationSaveInterval = time.Second * 5
+)
+
+// handleGetCampaignSimulation returns the last dry run of a campaign.
+func handleGetCampaignSimulation(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	out, err := app.core.GetCampaignSimulation(id)
+	if err != nil {
+		return err
+	}
+
+	// A dry run that was interrupted, eg: by a restart, is no longer running.
+	if out.Status == models.SimulationStatusRunning {
+		app.Lock()
+		_, ok := app.simulations[id]
+		app.Unlock()
+
+		if !ok {
+			out.Status = models.SimulationStatusCancelled
+		}
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleStartCampaignSimulation starts a dry run of a campaign in the
+// background, which renders the messages to all its recipients without
+// sending them.
+func handleStartCampaignSimulation(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	camp, err := app.core.GetCampaignForPreview(id, 0)
+	if err != nil {
+		return err
+	}
+
+	app.Lock()
+	if _, ok := app.simulations[id]; ok {
+		app.Unlock()
+		return echo.NewHTTPError(http.StatusConflict, app.i18n.T("campaigns.simulationRunning"))
+	}
+	stop := make(chan struct{})
+	app.simulations[id] = stop
+	app.Unlock()
+
+	out, err := app.core.StartCampaignSimulation(id)
+	if err != nil {
+		app.Lock()
+		delete(app.simulations, id)
+		app.Unlock()
+		return err
+	}
+
+	go runCampaignSimulation(camp, out, stop, app)
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleCancelCampaignSimulation stops the running dry run of a campaign.
+func handleCancelCampaignSimulation(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	// The dry run removes itself once it has stopped, so that another one
+	// can't be started before then.
+	app.Lock()
+	stop, ok := app.simulations[id]
+	if ok {
+		select {
+		case <-stop:
+		default:
+			close(stop)
+		}
+	}
+	app.Unlock()
+
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("campaigns.simulationNotRunning"))
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// runCampaignSimulation walks all the recipients of a campaign in batches and
+// renders the message to each of them, recording the number of messages per
+// recipient domain and the rendering errors, until it's done or stopped.
+func runCampaignSimulation(camp models.Campaign, sim models.CampaignSimulation, stop chan struct{}, app *App) {
+	var (
+		domains  = make(map[string]int)
+		samples  = []models.SimulationError{}
+		lastSave = time.Now()
+	)
+
+	save := func(status, errMsg string) {
+		sim.Status, sim.Error = status, errMsg
+		sim.Domains = simulationDomains(domains)
+		sim.ErrorSamples, _ = json.Marshal(samples)
+
+		// Errors are logged by core.
+		_ = app.core.UpdateCampaignSimulation(sim)
+		lastSave = time.Now()
+	}
+
+	finish := func(status, errMsg string) {
+		save(status, errMsg)
+
+		app.Lock()
+		delete(app.simulations, camp.ID)
+		app.Unlock()
+	}
+
+	// Use a dummy campaign ID to prevent views and clicks from {{ TrackView }}
+	// and {{ TrackLink }} being registered.
+	camp.UUID = dummySubscriber.UUID
+	if err := camp.CompileTemplate(app.manager.TemplateFuncs(&camp)); err != nil {
+		finish(models.SimulationStatusFailed, app.i18n.Ts("templates.errorCompiling", "error", err.Error()))
+		return
+	}
+
+	afterID := 0
+	for {
+		select {
+		case <-stop:
+			finish(models.SimulationStatusCancelled, "")
+			return
+		default:
+		}
+
+		subs, err := app.core.GetCampaignSimulationSubscribers(camp.ID, afterID, app.constants.DBBatchSize)
+		if err == nil {
+			err = app.core.LoadSubscriberEngagement(subs)
+		}
+		if err != nil {
+			msg := err.Error()
+			if e, ok := err.(*echo.HTTPError); ok {
+				msg = fmt.Sprintf("%v", e.Message)
+			}
+			finish(models.SimulationStatusFailed, msg)
+			return
+		}
+		if len(subs) == 0 {
+			break
+		}
+
+		for _, s := range subs {
+			if _, err := app.manager.NewCampaignMessage(&camp, s); err != nil {
+				sim.Errors++
+				if len(samples) < simulationMaxErrorSamples {
+					samples = append(samples, models.SimulationError{SubscriberID: s.ID, Email: s.Email, Error: err.Error()})
+				}
+				continue
+			}
+
+			sim.Rendered++
+			domains[emailDomain(s.Email)]++
+		}
+		afterID = subs[len(subs)-1].ID
+
+		if time.Since(lastSave) >= simulationSaveInterval {
+			save(models.SimulationStatusRunning, "")
+		}
+	}
+
+	finish(models.SimulationStatusFinished, "")
+}
+
+// simulationDomains returns the number of messages per recipient domain of
+// a dry run as a JSON list of models.SimulationDomain, in descending order of
+// the count.
+func simulationDomains(domains map[string]int) []byte {
+	out := make([]models.SimulationDomain, 0, len(domains))
+	for d, n := range domains {
+		out = append(out, models.SimulationDomain{Domain: d, Count: n})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Domain < out[j].Domain
+	})
+
+	b, _ := json.Marshal(out)
+	return b
+}
+
+// emailDomain returns the lowercased domain of an e-mail address.
+func emailDomain(email string) string {
+	if i := strings.LastIndexByte(email, '@'); i >= 0 {
+		return strings.ToLower(email[i+1:])
+	}
+	return ""
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/knadh/listmonk/internal/core"
+	"github.com/knadh/listmonk/internal/manager"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// Max number of subscribers on the QA list that a test batch is sent to.
+const testBatchMaxSubs = 1000
+
+// testVariant is a variant of campaign test batches that's sent to its own
+// seed addresses, for instance, inboxes on a particular e-mail client, with
+// its marker prefixed to the subject.
+type testVariant struct {
+	Name          string
+	SubjectPrefix string
+	Emails        []string
+}
+
+// handleGetCampaignTests returns the test batches of a campaign.
+func handleGetCampaignTests(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	out, err := app.core.GetCampaignTests(id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// sendTestBatch sends a campaign to the subscribers on the QA list, and to
+// the seed addresses of the test variants (all of them, or the given ones)
+// with their subject prefixes, and records the batch against the version of
+// the campaign's content.
+func sendTestBatch(camp models.Campaign, variants []string, app *App) (models.CampaignTest, error) {
+	// Pick the variants.
+	vars := app.constants.TestVariants
+	if len(variants) > 0 {
+		vars = make([]testVariant, 0, len(variants))
+		for _, name := range variants {
+			found := false
+			for _, v := range app.constants.TestVariants {
+				if v.Name == name {
+					vars = append(vars, v)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return models.CampaignTest{}, echo.NewHTTPError(http.StatusBadRequest,
+					app.i18n.Ts("globals.messages.invalidFields", "name", "variants"))
+			}
+		}
+	}
+
+	// Subscribers on the QA list.
+	subs := models.Subscribers{}
+	if app.constants.TestListID > 0 {
+		s, _, err := app.core.QuerySubscribers("subscribers.status != 'blocklisted'",
+			[]int{app.constants.TestListID}, "", false, core.SortAsc, "subscribers.id", 0, testBatchMaxSubs)
+		if err != nil {
+			return models.CampaignTest{}, err
+		}
+		if err := app.core.LoadSubscriberEngagement(s); err != nil {
+			return models.CampaignTest{}, err
+		}
+		subs = s
+	}
+
+	n := len(subs)
+	for _, v := range vars {
+		n += len(v.Emails)
+	}
+	if n == 0 {
+		return models.CampaignTest{}, echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("campaigns.noTestBatch"))
+	}
+
+	for _, s := range subs {
+		c := camp
+		if err := sendTestMessage(s, &c, app); err != nil {
+			app.log.Printf("error sending test message: %v", err)
+			return models.CampaignTest{}, echo.NewHTTPError(http.StatusInternalServerError,
+				app.i18n.Ts("campaigns.errorSendTest", "error", err.Error()))
+		}
+	}
+
+	// Variants are rendered for a seed subscriber with the variant's address.
+	names := make([]string, 0, len(vars))
+	for _, v := range vars {
+		for _, email := range v.Emails {
+			c := camp
+			if v.SubjectPrefix != "" {
+				c.Subject = v.SubjectPrefix + " " + c.Subject
+			}
+
+			name := email
+			if i := strings.IndexByte(email, '@'); i > 0 {
+				name = email[:i]
+			}
+			sub := models.Subscriber{
+				UUID:    manager.SeedUUID,
+				Email:   email,
+				Name:    name,
+				Attribs: models.JSON{},
+				Status:  models.SubscriberStatusEnabled,
+			}
+			if err := sendTestMessage(sub, &c, app); err != nil {
+				app.log.Printf("error sending test message: %v", err)
+				return models.CampaignTest{}, echo.NewHTTPError(http.StatusInternalServerError,
+					app.i18n.Ts("campaigns.errorSendTest", "error", err.Error()))
+			}
+		}
+		names = append(names, v.Name)
+	}
+
+	return app.core.CreateCampaignTest(camp.ID, camp.ContentVersion, camp.Subject, names, n)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,6 +14,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/knadh/listmonk/internal/darkmode"
+	"github.com/knadh/listmonk/internal/manager"
 	"github.com/knadh/listmonk/models"
 	"github.com/labstack/echo/v4"
 	"github.com/lib/pq"
@@ -35,8 +38,15 @@ type campaignReq struct {
 
 	MediaIDs []int `json:"media"`
 
-	// This is only relevant to campaign test requests.
+	// Plaintext password of a password protected campaign on the archive.
+	// It's hashed into Campaign.ArchivePassword.
+	NewArchivePassword string `json:"archive_password"`
+
+	// These are only relevant to campaign test requests. A test batch is sent
+	// to the QA list and the seed addresses of the (given) test variants.
 	SubscriberEmails pq.StringArray `json:"subscribers"`
+	TestBatch        bool           `json:"test_batch"`
+	TestVariants     []string       `json:"test_variants"`
 }
 
 // campaignContentReq wraps params coming from API requests for converting
@@ -47,9 +57,24 @@ type campaignContentReq struct {
 	To   string `json:"to"`
 }
 
+const (
+	// Number of subscribers in the sample of a campaign's audience.
+	audienceSampleDefault = 5
+	audienceSampleMax     = 50
+
+	// Interval at which campaign stats are pushed to stream clients.
+	campStatsStreamInterval = time.Second * 2
+)
+
 var (
 	regexFromAddress = regexp.MustCompile(`((.+?)\s)?<(.+?)@(.+?)>`)
 	regexSlug        = regexp.MustCompile(`[^\p{L}\p{M}\p{N}]`)
+	regexBlockName   = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+	regexLang        = regexp.MustCompile(`^[a-zA-Z]{2,3}([-_][a-zA-Z0-9]{2,8}){0,2}$`)
+	regexHeaderName  = regexp.MustCompile("^[!#$%&'*+\\-.^_`|~0-9A-Za-z]+$")
+
+	// List-ID header (RFC 2919) with an optional description, eg: Newsletter <news.site.com>
+	regexListID = regexp.MustCompile(`^(?:(.*?)\s*<)?([a-zA-Z0-9_-]+(?:\.[a-zA-Z0-9_-]+)+)>?$`)
 )
 
 // handleGetCampaigns handles retrieval of campaigns.
@@ -60,13 +85,14 @@ func handleGetCampaigns(c echo.Context) error {
 
 		status    = c.QueryParams()["status"]
 		tags      = c.QueryParams()["tag"]
+		tagMatch  = c.QueryParam("tag_match")
 		query     = strings.TrimSpace(c.FormValue("query"))
 		orderBy   = c.FormValue("order_by")
 		order     = c.FormValue("order")
 		noBody, _ = strconv.ParseBool(c.QueryParam("no_body"))
 	)
 
-	res, total, err := app.core.QueryCampaigns(query, status, tags, orderBy, order, pg.Offset, pg.Limit)
+	res, total, err := app.core.QueryCampaigns(query, status, tags, tagMatch, orderBy, order, pg.Offset, pg.Limit)
 	if err != nil {
 		return err
 	}
@@ -113,27 +139,518 @@ func handleGetCampaign(c echo.Context) error {
 	return c.JSON(http.StatusOK, okResp{out})
 }
 
+// handleGetCampaignDeliveries returns the counts of a campaign's messages by the
+// messenger (or failover messenger) they were delivered through.
+func handleGetCampaignDeliveries(c echo.Context) error {
+	var (
+		app      = c.Get("app").(*App)
+		id, _    = strconv.Atoi(c.Param("id"))
+		subID, _ = strconv.Atoi(c.QueryParam("subscriber_id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	out, err := app.core.GetCampaignDeliveries(id, subID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleGetCampaignLinkClicks returns the clicks on a campaign's links by
+// their positions in the body, for rendering a click heatmap.
+func handleGetCampaignLinkClicks(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	out, err := app.core.GetCampaignLinkClicks(id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleGetCampaignVersions returns the versions of a campaign's content that
+// were sent and the number of messages sent with each.
+func handleGetCampaignVersions(c echo.Context) error {
+	var (
+		app      = c.Get("app").(*App)
+		id, _    = strconv.Atoi(c.Param("id"))
+		subID, _ = strconv.Atoi(c.QueryParam("subscriber_id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	out, err := app.core.GetCampaignVersions(id, subID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleGetCampaignRecipients returns the recipients of a campaign that were
+// frozen when it was scheduled or started.
+func handleGetCampaignRecipients(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+		pg    = app.paginator.NewFromURL(c.Request().URL.Query())
+		query = strings.TrimSpace(c.FormValue("query"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	if query != "" {
+		query = "%" + query + "%"
+	}
+
+	res, total, err := app.core.GetCampaignRecipients(id, query, pg.Offset, pg.Limit)
+	if err != nil {
+		return err
+	}
+
+	// No results.
+	var out models.PageResults
+	if len(res) == 0 {
+		out.Results = []models.CampaignRecipient{}
+		return c.JSON(http.StatusOK, okResp{out})
+	}
+
+	// Meta.
+	out.Results = res
+	out.Total = total
+	out.Page = pg.Page
+	out.PerPage = pg.PerPage
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleGetCampaignDeliveryLog returns the paginated outcomes of a campaign's
+// messages to individual subscribers, optionally filtered by one or more
+// status params, a subscriber_id, or an e-mail query.
+func handleGetCampaignDeliveryLog(c echo.Context) error {
+	var (
+		app      = c.Get("app").(*App)
+		id, _    = strconv.Atoi(c.Param("id"))
+		subID, _ = strconv.Atoi(c.QueryParam("subscriber_id"))
+		pg       = app.paginator.NewFromURL(c.Request().URL.Query())
+		query    = strings.TrimSpace(c.FormValue("query"))
+		statuses = []string{}
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	for _, s := range c.QueryParams()["status"] {
+		switch s {
+		case models.DeliveryStatusQueued, models.DeliveryStatusSent, models.DeliveryStatusErrored, models.DeliveryStatusBounced,
+			models.DeliveryStatusSkipped:
+			statuses = append(statuses, s)
+		default:
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "status"))
+		}
+	}
+
+	if query != "" {
+		query = "%" + query + "%"
+	}
+
+	res, total, err := app.core.QueryCampaignDeliveryLog(id, statuses, subID, query, pg.Offset, pg.Limit)
+	if err != nil {
+		return err
+	}
+
+	// No results.
+	var out models.PageResults
+	if len(res) == 0 {
+		out.Results = []models.CampaignDeliveryLog{}
+		return c.JSON(http.StatusOK, okResp{out})
+	}
+
+	// Meta.
+	out.Results = res
+	out.Total = total
+	out.Page = pg.Page
+	out.PerPage = pg.PerPage
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleGetCampaignAudience returns the number of subscribers a campaign
+// would be sent to right now, and a random sample of them with the subjects
+// rendered for each to sanity check the targeting before the campaign is
+// started. Optional list_id params are used instead of the campaign's lists,
+// and exclude_list_id, segment_id, and subscriber_tag params instead of its
+// excluded lists, segments, and subscriber tags.
+func handleGetCampaignAudience(c echo.Context) error {
+	var (
+		app       = c.Get("app").(*App)
+		id, _     = strconv.Atoi(c.Param("id"))
+		sample, _ = strconv.Atoi(c.QueryParam("sample"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	if sample < 1 {
+		sample = audienceSampleDefault
+	} else if sample > audienceSampleMax {
+		sample = audienceSampleMax
+	}
+
+	listIDs, err := parseStringIDs(c.Request().URL.Query()["list_id"])
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "list_id"))
+	}
+
+	camp, err := app.core.GetCampaignForPreview(id, 0)
+	if err != nil {
+		return err
+	}
+
+	excludeListIDs, err := parseStringIDs(c.Request().URL.Query()["exclude_list_id"])
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "exclude_list_id"))
+	}
+
+	segmentIDs, err := parseStringIDs(c.Request().URL.Query()["segment_id"])
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "segment_id"))
+	}
+
+	tags, err := sanitizeTags(c.Request().URL.Query()["subscriber_tag"])
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "subscriber_tag"))
+	}
+
+	subs, total, err := app.core.GetCampaignAudience(id, listIDs, excludeListIDs, segmentIDs, tags, sample)
+	if err != nil {
+		return err
+	}
+	if err := app.core.LoadSubscriberEngagement(subs); err != nil {
+		return err
+	}
+
+	// Use a dummy campaign ID to prevent views and clicks from {{ TrackView }}
+	// and {{ TrackLink }} being registered.
+	camp.UUID = dummySubscriber.UUID
+	if err := camp.CompileTemplate(app.manager.TemplateFuncs(&camp)); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("templates.errorCompiling", "error", err.Error()))
+	}
+
+	type audienceSub struct {
+		ID      int    `json:"id"`
+		UUID    string `json:"uuid"`
+		Email   string `json:"email"`
+		Name    string `json:"name"`
+		Subject string `json:"subject"`
+	}
+
+	out := struct {
+		Total  int           `json:"total"`
+		Sample []audienceSub `json:"sample"`
+	}{total, make([]audienceSub, 0, len(subs))}
+
+	for _, s := range subs {
+		msg, err := app.manager.NewCampaignMessage(&camp, s)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("templates.errorRendering", "error", err.Error()))
+		}
+
+		out.Sample = append(out.Sample, audienceSub{
+			ID:      s.ID,
+			UUID:    s.UUID,
+			Email:   s.Email,
+			Name:    s.Name,
+			Subject: msg.Subject(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handlePreviewCampaignSubjects renders a campaign's subject and preheader, or
+// the given ones that are yet to be saved, for a random sample of the
+// subscribers it would be sent to. Subscribers for whom they can't be
+// rendered are in the sample with the error instead of failing the request.
+func handlePreviewCampaignSubjects(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+		req   struct {
+			Subject        null.String `json:"subject"`
+			Preheader      null.String `json:"preheader"`
+			Sample         int         `json:"sample"`
+			ListIDs        []int       `json:"list_ids"`
+			ExcludeListIDs []int       `json:"exclude_list_ids"`
+			SegmentIDs     []int       `json:"segment_ids"`
+			SubscriberTags []string    `json:"subscriber_tags"`
+		}
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	if req.Sample < 1 {
+		req.Sample = audienceSampleDefault
+	} else if req.Sample > audienceSampleMax {
+		req.Sample = audienceSampleMax
+	}
+
+	camp, err := app.core.GetCampaignForPreview(id, 0)
+	if err != nil {
+		return err
+	}
+	if req.Subject.Valid {
+		if !strHasLen(req.Subject.String, 1, stdInputMaxLen) {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "subject"))
+		}
+		camp.Subject = req.Subject.String
+	}
+	if req.Preheader.Valid {
+		camp.Preheader = strings.TrimSpace(req.Preheader.String)
+	}
+
+	tags, err := sanitizeTags(req.SubscriberTags)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "subscriber_tags"))
+	}
+
+	subs, total, err := app.core.GetCampaignAudience(id, req.ListIDs, req.ExcludeListIDs, req.SegmentIDs, tags, req.Sample)
+	if err != nil {
+		return err
+	}
+	if err := app.core.LoadSubscriberEngagement(subs); err != nil {
+		return err
+	}
+
+	// Use a dummy campaign ID to prevent views and clicks from {{ TrackView }}
+	// and {{ TrackLink }} being registered.
+	camp.UUID = dummySubscriber.UUID
+	if err := camp.CompileTemplate(app.manager.TemplateFuncs(&camp)); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("templates.errorCompiling", "error", err.Error()))
+	}
+
+	type subjectSub struct {
+		ID        int    `json:"id"`
+		UUID      string `json:"uuid"`
+		Email     string `json:"email"`
+		Name      string `json:"name"`
+		Subject   string `json:"subject"`
+		Preheader string `json:"preheader"`
+		Error     string `json:"error"`
+
+		// Whether the subject is empty, or has values that are missing in
+		// the subscriber's data (rendered as <no value>).
+		Empty   bool `json:"empty"`
+		NoValue bool `json:"no_value"`
+	}
+
+	out := struct {
+		Total  int          `json:"total"`
+		Sample []subjectSub `json:"sample"`
+	}{total, make([]subjectSub, 0, len(subs))}
+
+	for _, s := range subs {
+		o := subjectSub{ID: s.ID, UUID: s.UUID, Email: s.Email, Name: s.Name}
+
+		subj, pre, err := app.manager.RenderCampaignSubject(&camp, s)
+		if err != nil {
+			o.Error = err.Error()
+		} else {
+			o.Subject, o.Preheader = subj, pre
+			o.Empty = strings.TrimSpace(subj) == ""
+			o.NoValue = strings.Contains(subj, "<no value>") || strings.Contains(pre, "<no value>")
+		}
+
+		out.Sample = append(out.Sample, o)
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleGetCampaignTags returns the tags of all campaigns with the number of
+// campaigns, messages sent, and average open and click rates for each.
+func handleGetCampaignTags(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	out, err := app.core.GetCampaignTags()
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleAddCampaignTag adds a tag to the given campaigns.
+func handleAddCampaignTag(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		req struct {
+			Tag     string `json:"tag"`
+			CampIDs []int  `json:"campaign_ids"`
+		}
+	)
+
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	req.Tag = strings.TrimSpace(req.Tag)
+	if !strHasLen(req.Tag, 1, 100) {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "tag"))
+	}
+	if len(req.CampIDs) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	n, err := app.core.AddCampaignTag(req.Tag, req.CampIDs)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{struct {
+		Campaigns int `json:"campaigns"`
+	}{n}})
+}
+
+// handleRenameCampaignTag renames a tag on all campaigns.
+func handleRenameCampaignTag(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		req struct {
+			Name string `json:"name"`
+		}
+	)
+
+	tag, err := url.PathUnescape(c.Param("tag"))
+	if err != nil || tag == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "tag"))
+	}
+
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if !strHasLen(req.Name, 1, 100) {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "name"))
+	}
+
+	n, err := app.core.RenameCampaignTag(tag, req.Name)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{struct {
+		Campaigns int `json:"campaigns"`
+	}{n}})
+}
+
+// handleDeleteCampaignTag removes a tag from all campaigns.
+func handleDeleteCampaignTag(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	tag, err := url.PathUnescape(c.Param("tag"))
+	if err != nil || tag == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "tag"))
+	}
+
+	n, err := app.core.DeleteCampaignTag(tag)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{struct {
+		Campaigns int `json:"campaigns"`
+	}{n}})
+}
+
 // handlePreviewCampaign renders the HTML preview of a campaign body.
 func handlePreviewCampaign(c echo.Context) error {
 	var (
 		app      = c.Get("app").(*App)
 		id, _    = strconv.Atoi(c.Param("id"))
 		tplID, _ = strconv.Atoi(c.FormValue("template_id"))
+
+		// Preview the plain text alternative instead, which is generated
+		// from the HTML body if the campaign doesn't have one.
+		plainText = c.FormValue("plain_text") == "true"
+
+		// Preview the body as it's rendered by dark mode e-mail clients.
+		darkMode = c.FormValue("dark_mode")
 	)
 
 	if id < 1 {
 		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
 	}
+	if darkMode != "" && !darkmode.Valid(darkMode) {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "dark_mode"))
+	}
 
 	camp, err := app.core.GetCampaignForPreview(id, tplID)
 	if err != nil {
 		return err
 	}
 
-	// There's a body in the request to preview instead of the body in the DB.
-	if c.Request().Method == http.MethodPost {
-		camp.ContentType = c.FormValue("content_type")
-		camp.Body = c.FormValue("body")
+	// There's a body in the request to preview instead of the body in the DB.
+	if c.Request().Method == http.MethodPost {
+		camp.ContentType = c.FormValue("content_type")
+		camp.Body = c.FormValue("body")
+		// The preheader is previewed only if it's posted.
+		if _, ok := c.Request().PostForm["preheader"]; ok {
+			camp.Preheader = c.FormValue("preheader")
+		}
+
+		if b := c.FormValue("content_blocks"); b != "" {
+			var blocks models.ContentBlocks
+			if err := json.Unmarshal([]byte(b), &blocks); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest,
+					app.i18n.Ts("globals.messages.invalidFields", "name", "content_blocks"))
+			}
+			camp.ContentBlocks = blocks
+		}
+
+		if plainText {
+			a := c.FormValue("altbody")
+			camp.AltBody = null.NewString(a, a != "")
+		}
+	}
+
+	// Render the exact variant a subscriber would receive, optionally.
+	sub := dummySubscriber
+	if subID, _ := strconv.Atoi(c.FormValue("subscriber_id")); subID > 0 {
+		s, err := app.core.GetSubscriber(subID, "", "")
+		if err != nil {
+			return err
+		}
+
+		subs := models.Subscribers{s}
+		if err := app.core.LoadSubscriberEngagement(subs); err != nil {
+			return err
+		}
+		sub = subs[0]
 	}
 
 	// Use a dummy campaign ID to prevent views and clicks from {{ TrackView }}
@@ -146,7 +663,7 @@ func handlePreviewCampaign(c echo.Context) error {
 	}
 
 	// Render the message body.
-	msg, err := app.manager.NewCampaignMessage(&camp, dummySubscriber)
+	msg, err := app.manager.NewCampaignMessage(&camp, sub)
 	if err != nil {
 		app.log.Printf("error rendering message: %v", err)
 		return echo.NewHTTPError(http.StatusBadRequest,
@@ -156,8 +673,11 @@ func handlePreviewCampaign(c echo.Context) error {
 	if camp.ContentType == models.CampaignContentTypePlain {
 		return c.String(http.StatusOK, string(msg.Body()))
 	}
+	if plainText {
+		return c.String(http.StatusOK, string(msg.AltBody()))
+	}
 
-	return c.HTML(http.StatusOK, string(msg.Body()))
+	return c.HTML(http.StatusOK, string(darkmode.Render(msg.Body(), darkMode)))
 }
 
 // handleCampaignContent handles campaign content (body) format conversions.
@@ -210,6 +730,12 @@ func handleCreateCampaign(c echo.Context) error {
 	if o.ContentType == "" {
 		o.ContentType = models.CampaignContentTypeRichtext
 	}
+
+	// Fill the fields that aren't set with the defaults of the campaign's lists.
+	o, err := applyListDefaults(o, app)
+	if err != nil {
+		return err
+	}
 	if o.Messenger == "" {
 		o.Messenger = "email"
 	}
@@ -296,18 +822,58 @@ func handleUpdateCampaignStatus(c echo.Context) error {
 		return err
 	}
 
+	// Validate the AMP body before the campaign is launched.
+	if o.Status == models.CampaignStatusRunning || o.Status == models.CampaignStatusScheduled {
+		if err := validateCampaignAMP(id, app); err != nil {
+			return err
+		}
+	}
+
 	out, err := app.core.UpdateCampaignStatus(id, o.Status)
 	if err != nil {
 		return err
 	}
 
-	if o.Status == models.CampaignStatusPaused || o.Status == models.CampaignStatusCancelled {
-		app.manager.StopCampaign(id)
+	// Campaigns that are being processed fire their paused and cancelled
+	// events when the manager stops processing them.
+	switch o.Status {
+	case models.CampaignStatusScheduled:
+		go fireCampaignEvent(manager.EventCampaignScheduled, id, "", app)
+	case models.CampaignStatusPaused:
+		if !app.manager.StopCampaign(id) {
+			go fireCampaignEvent(manager.EventCampaignPaused, id, "", app)
+		}
+	case models.CampaignStatusCancelled:
+		if !app.manager.StopCampaign(id) {
+			go fireCampaignEvent(manager.EventCampaignCancelled, id, "", app)
+		}
 	}
 
 	return c.JSON(http.StatusOK, okResp{out})
 }
 
+// handleRetryCampaignErrors re-runs a finished campaign to retry its messages
+// that errored with recoverable errors.
+func handleRetryCampaignErrors(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	n, err := app.core.RetryCampaignErrors(id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{struct {
+		Retried int `json:"retried"`
+	}{n}})
+}
+
 // handleUpdateCampaignArchive handles campaign status modification.
 func handleUpdateCampaignArchive(c echo.Context) error {
 	var (
@@ -320,6 +886,8 @@ func handleUpdateCampaignArchive(c echo.Context) error {
 		TemplateID  int         `json:"archive_template_id"`
 		Meta        models.JSON `json:"archive_meta"`
 		ArchiveSlug string      `json:"archive_slug"`
+		Access      string      `json:"archive_access"`
+		Password    string      `json:"archive_password,omitempty"`
 	}{}
 
 	// Get and validate fields.
@@ -327,6 +895,24 @@ func handleUpdateCampaignArchive(c echo.Context) error {
 		return err
 	}
 
+	cm, err := app.core.GetCampaign(id, "", "")
+	if err != nil {
+		return err
+	}
+
+	if req.Access == "" {
+		req.Access = cm.ArchiveAccess
+	}
+	if !isArchiveAccess(req.Access) {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "archive_access"))
+	}
+
+	hash, err := makeArchivePassword(req.Access, req.Password, cm.ArchivePassword, app)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	req.Password = ""
+
 	if req.ArchiveSlug != "" {
 		// Format the slug to be alpha-numeric-dash.
 		s := strings.ToLower(req.ArchiveSlug)
@@ -335,7 +921,7 @@ func handleUpdateCampaignArchive(c echo.Context) error {
 		req.ArchiveSlug = s
 	}
 
-	if err := app.core.UpdateCampaignArchive(id, req.Archive, req.TemplateID, req.Meta, req.ArchiveSlug); err != nil {
+	if err := app.core.UpdateCampaignArchive(id, req.Archive, req.TemplateID, req.Meta, req.ArchiveSlug, req.Access, hash); err != nil {
 		return err
 	}
 
@@ -377,27 +963,90 @@ func handleGetRunningCampaignStats(c echo.Context) error {
 	}
 
 	// Compute rate.
-	for i, c := range out {
-		if c.Started.Valid && c.UpdatedAt.Valid {
-			diff := int(c.UpdatedAt.Time.Sub(c.Started.Time).Minutes())
-			if diff < 1 {
-				diff = 1
-			}
+	for i := range out {
+		setCampaignRates(&out[i], app)
+	}
 
-			rate := c.Sent / diff
-			if rate > c.Sent || rate > c.ToSend {
-				rate = c.Sent
-			}
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleStreamCampaignStats streams the progress stats of a campaign as
+// server-sent events (text/event-stream) until it's finished or cancelled.
+func handleStreamCampaignStats(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
 
-			// Rate since the starting of the campaign.
-			out[i].NetRate = rate
+	s, err := app.core.GetCampaignProgress(id)
+	if err != nil {
+		return err
+	}
+
+	h := c.Response().Header()
+	h.Set(echo.HeaderContentType, "text/event-stream")
+	h.Set(echo.HeaderCacheControl, "no-store")
+	h.Set(echo.HeaderConnection, "keep-alive")
+	c.Response().WriteHeader(http.StatusOK)
+
+	t := time.NewTicker(campStatsStreamInterval)
+	defer t.Stop()
+
+	ctx := c.Request().Context()
+	for {
+		setCampaignRates(&s, app)
+		s.Errors = app.manager.GetCampaignStats(id).Errors
+
+		b, err := json.Marshal(s)
+		if err != nil {
+			app.log.Printf("error marshalling campaign stats: %v", err)
+			return nil
+		}
+
+		c.Response().Write([]byte(fmt.Sprintf("retry: 3000\nevent: stats\ndata: %s\n\n", b)))
+		c.Response().Flush()
+
+		if s.Status == models.CampaignStatusFinished || s.Status == models.CampaignStatusCancelled {
+			return nil
+		}
 
-			// Realtime running rate over the last minute.
-			out[i].Rate = app.manager.GetCampaignStats(c.ID).SendRate
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return nil
+		}
+
+		if s, err = app.core.GetCampaignProgress(id); err != nil {
+			return nil
 		}
 	}
+}
 
-	return c.JSON(http.StatusOK, okResp{out})
+// setCampaignRates sets the send rates of a campaign that has started.
+func setCampaignRates(s *models.CampaignStats, app *App) {
+	if !s.Started.Valid || !s.UpdatedAt.Valid {
+		return
+	}
+
+	diff := int(s.UpdatedAt.Time.Sub(s.Started.Time).Minutes())
+	if diff < 1 {
+		diff = 1
+	}
+
+	rate := s.Sent / diff
+	if rate > s.Sent || rate > s.ToSend {
+		rate = s.Sent
+	}
+
+	// Rate since the starting of the campaign.
+	s.NetRate = rate
+
+	// Realtime running rate over the last minute.
+	s.Rate = app.manager.GetCampaignStats(s.ID).SendRate
 }
 
 // handleTestCampaign handles the sending of a campaign message to
@@ -425,7 +1074,7 @@ func handleTestCampaign(c echo.Context) error {
 	} else {
 		req = c
 	}
-	if len(req.SubscriberEmails) == 0 {
+	if len(req.SubscriberEmails) == 0 && !req.TestBatch {
 		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("campaigns.noSubsToTest"))
 	}
 
@@ -434,9 +1083,16 @@ func handleTestCampaign(c echo.Context) error {
 		req.SubscriberEmails[i] = strings.ToLower(strings.TrimSpace(req.SubscriberEmails[i]))
 	}
 
-	subs, err := app.core.GetSubscribersByEmail(req.SubscriberEmails)
-	if err != nil {
-		return err
+	var subs models.Subscribers
+	if !req.TestBatch {
+		s, err := app.core.GetSubscribersByEmail(req.SubscriberEmails)
+		if err != nil {
+			return err
+		}
+		if err := app.core.LoadSubscriberEngagement(s); err != nil {
+			return err
+		}
+		subs = s
 	}
 
 	// The campaign.
@@ -451,16 +1107,30 @@ func handleTestCampaign(c echo.Context) error {
 	camp.FromEmail = req.FromEmail
 	camp.Body = req.Body
 	camp.AltBody = req.AltBody
+	camp.BodyAMP = req.BodyAMP
+	camp.Preheader = req.Preheader
 	camp.Messenger = req.Messenger
 	camp.ContentType = req.ContentType
 	camp.Headers = req.Headers
+	camp.ListIDHeader = req.ListIDHeader
 	camp.TemplateID = req.TemplateID
+	camp.ContentBlocks = req.ContentBlocks
+	camp.LangVariants = req.LangVariants
+	camp.UTMParams = req.UTMParams
 	for _, id := range req.MediaIDs {
 		if id > 0 {
 			camp.MediaIDs = append(camp.MediaIDs, int64(id))
 		}
 	}
 
+	if req.TestBatch {
+		out, err := sendTestBatch(camp, req.TestVariants, app)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, okResp{out})
+	}
+
 	// Send the test messages.
 	for _, s := range subs {
 		sub := s
@@ -519,6 +1189,73 @@ func handleGetCampaignViewAnalytics(c echo.Context) error {
 	return c.JSON(http.StatusOK, okResp{out})
 }
 
+// handleGetCampaignCosts returns the estimated costs of campaigns started
+// between two dates.
+func handleGetCampaignCosts(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+
+		from = c.QueryParams().Get("from")
+		to   = c.QueryParams().Get("to")
+	)
+
+	out, err := app.core.GetCampaignCosts(from, to)
+	if err != nil {
+		return err
+	}
+
+	var total float64
+	for _, c := range out {
+		total += c.Cost
+	}
+
+	return c.JSON(http.StatusOK, okResp{struct {
+		Currency  string                `json:"currency"`
+		Total     float64               `json:"total"`
+		Campaigns []models.CampaignCost `json:"campaigns"`
+	}{app.constants.CostCurrency, total, out}})
+}
+
+// handleExportCampaignCosts streams the estimated costs of campaigns started
+// between two dates as CSV.
+func handleExportCampaignCosts(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+
+		from = c.QueryParams().Get("from")
+		to   = c.QueryParams().Get("to")
+	)
+
+	out, err := app.core.GetCampaignCosts(from, to)
+	if err != nil {
+		return err
+	}
+
+	var (
+		h  = c.Response().Header()
+		wr = csv.NewWriter(c.Response())
+	)
+
+	h.Set(echo.HeaderContentType, echo.MIMEOctetStream)
+	h.Set("Content-type", "text/csv")
+	h.Set(echo.HeaderContentDisposition, "attachment; filename="+"campaign-costs.csv")
+	h.Set("Content-Transfer-Encoding", "binary")
+	h.Set("Cache-Control", "no-cache")
+	wr.Write([]string{"id", "name", "tags", "messenger", "status", "sent", "segments", "cost", "currency", "started_at"})
+
+	for _, r := range out {
+		if err := wr.Write([]string{strconv.Itoa(r.ID), r.Name, strings.Join(r.Tags, ","), r.Messenger, r.Status,
+			strconv.Itoa(r.Sent), strconv.Itoa(r.Segments), strconv.FormatFloat(r.Cost, 'f', -1, 64),
+			app.constants.CostCurrency, r.StartedAt.Time.String()}); err != nil {
+			app.log.Printf("error streaming CSV export: %v", err)
+			break
+		}
+	}
+	wr.Flush()
+
+	return nil
+}
+
 // sendTestMessage takes a campaign and a subscriber and sends out a sample campaign message.
 func sendTestMessage(sub models.Subscriber, camp *models.Campaign, app *App) error {
 	if err := camp.CompileTemplate(app.manager.TemplateFuncs(camp)); err != nil {
@@ -535,7 +1272,15 @@ func sendTestMessage(sub models.Subscriber, camp *models.Campaign, app *App) err
 			app.i18n.Ts("templates.errorRendering", "error", err.Error()))
 	}
 
-	return app.manager.PushCampaignMessage(msg)
+	if err := app.manager.PushCampaignMessage(msg); err != nil {
+		if errors.Is(err, manager.ErrQuotaExceeded) {
+			return echo.NewHTTPError(http.StatusTooManyRequests,
+				app.i18n.Ts("globals.messages.quotaExceeded", "name", camp.Messenger))
+		}
+		return err
+	}
+
+	return nil
 }
 
 // validateCampaignFields validates incoming campaign field values.
@@ -554,35 +1299,316 @@ func validateCampaignFields(c campaignReq, app *App) (campaignReq, error) {
 	if !strHasLen(c.Subject, 1, stdInputMaxLen) {
 		return c, errors.New(app.i18n.T("campaigns.fieldInvalidSubject"))
 	}
+	c.Preheader = strings.TrimSpace(c.Preheader)
+	if !strHasLen(c.Preheader, 0, stdInputMaxLen) {
+		return c, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "preheader"))
+	}
 
-	// If there's a "send_at" date, it should be in the future.
-	if c.SendAt.Valid {
+	// If there's a "send_at" date, it should be in the future, unless the
+	// campaign has already started and is paused.
+	if c.SendAt.Valid && c.Status != models.CampaignStatusPaused {
 		if c.SendAt.Time.Before(time.Now()) {
 			return c, errors.New(app.i18n.T("campaigns.fieldInvalidSendAt"))
 		}
 	}
 
+	// The send deadline should be after the scheduled date, or in the future.
+	if c.SendUntil.Valid {
+		start := time.Now()
+		if c.SendAt.Valid && c.SendAt.Time.After(start) {
+			start = c.SendAt.Time
+		}
+		if !c.SendUntil.Time.After(start) {
+			return c, errors.New(app.i18n.T("campaigns.fieldInvalidSendUntil"))
+		}
+	}
+
+	c.SendWindow.Start = strings.TrimSpace(c.SendWindow.Start)
+	c.SendWindow.End = strings.TrimSpace(c.SendWindow.End)
+	c.SendWindow.Timezone = strings.TrimSpace(c.SendWindow.Timezone)
+	if err := manager.ValidateSendWindow(c.SendWindow); err != nil {
+		return c, errors.New(app.i18n.Ts("campaigns.fieldInvalidSendWindow", "error", err.Error()))
+	}
+
+	if c.Priority == 0 {
+		c.Priority = models.CampaignPriorityDefault
+	}
+	if c.Priority < models.CampaignPriorityMin || c.Priority > models.CampaignPriorityMax {
+		return c, errors.New(app.i18n.Ts("campaigns.fieldInvalidPriority",
+			"min", strconv.Itoa(models.CampaignPriorityMin), "max", strconv.Itoa(models.CampaignPriorityMax)))
+	}
+
+	// Staged sending is to a percentage of the subscribers, held for a duration,
+	// with optional max bounce and complaint rates (%).
+	if r := c.Rollout; r.Percent != 0 {
+		if r.Percent < 1 || r.Percent > 99 {
+			return c, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "rollout.percent"))
+		}
+		if d, err := time.ParseDuration(strings.TrimSpace(r.Hold)); err != nil || d < time.Minute {
+			return c, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "rollout.hold"))
+		}
+		if r.MaxBounceRate < 0 || r.MaxBounceRate > 100 || r.MaxComplaintRate < 0 || r.MaxComplaintRate > 100 {
+			return c, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "rollout"))
+		}
+		c.Rollout.Hold = strings.TrimSpace(r.Hold)
+	} else {
+		c.Rollout = models.Rollout{}
+	}
+
+	// Local time delivery is relative to the scheduled date.
+	if c.SendAtLocal && !c.SendAt.Valid {
+		return c, errors.New(app.i18n.T("campaigns.needsSendAt"))
+	}
+
+	// The scheduled date's wall-clock time is kept in its timezone.
+	c.SendAtTimezone = strings.TrimSpace(c.SendAtTimezone)
+	if !c.SendAt.Valid {
+		c.SendAtTimezone = ""
+	}
+	if c.SendAtTimezone != "" {
+		if _, err := time.LoadLocation(c.SendAtTimezone); err != nil {
+			return c, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "send_at_timezone"))
+		}
+	}
+
 	if len(c.ListIDs) == 0 {
 		return c, errors.New(app.i18n.T("campaigns.fieldInvalidListIDs"))
 	}
 
+	// Archived lists can't be targeted.
+	lists, err := app.core.GetListsByOptin(c.ListIDs, "")
+	if err != nil {
+		return c, err
+	}
+	for _, l := range lists {
+		if l.Archived {
+			return c, errors.New(app.i18n.Ts("campaigns.listArchived", "name", l.Name))
+		}
+	}
+
+	// Excluded lists can't also be the lists the campaign is sent to.
+	excl := make(pq.Int64Array, 0, len(c.ExcludeListIDs))
+	for _, id := range c.ExcludeListIDs {
+		if id < 1 {
+			return c, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "exclude_list_ids"))
+		}
+		for _, l := range c.ListIDs {
+			if int64(l) == id {
+				return c, errors.New(app.i18n.T("campaigns.excludeListOverlap"))
+			}
+		}
+		excl = append(excl, id)
+	}
+	c.ExcludeListIDs = excl
+
+	segs := make(pq.Int64Array, 0, len(c.SegmentIDs))
+	for _, id := range c.SegmentIDs {
+		if id < 1 {
+			return c, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "segment_ids"))
+		}
+		segs = append(segs, id)
+	}
+	c.SegmentIDs = segs
+
+	tags, err := sanitizeTags(c.SubscriberTags)
+	if err != nil {
+		return c, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "subscriber_tags"))
+	}
+	c.SubscriberTags = tags
+
 	if !app.manager.HasMessenger(c.Messenger) {
 		return c, errors.New(app.i18n.Ts("campaigns.fieldInvalidMessenger", "name", c.Messenger))
 	}
 
+	// Failover messengers should be known, unique, and not the primary messenger.
+	seen := map[string]bool{c.Messenger: true}
+	for _, m := range c.Failover {
+		if !app.manager.HasMessenger(m) {
+			return c, errors.New(app.i18n.Ts("campaigns.fieldInvalidMessenger", "name", m))
+		}
+		if seen[m] {
+			return c, errors.New(app.i18n.Ts("campaigns.duplicateFailover", "name", m))
+		}
+		seen[m] = true
+	}
+	if c.Failover == nil {
+		c.Failover = pq.StringArray{}
+	}
+
+	// Content blocks are referenced in the body by their names.
+	names := map[string]bool{}
+	for i, b := range c.ContentBlocks {
+		b.Name = strings.TrimSpace(b.Name)
+		if !regexBlockName.MatchString(b.Name) {
+			return c, errors.New(app.i18n.Ts("campaigns.invalidBlockName", "name", b.Name))
+		}
+		if names[b.Name] {
+			return c, errors.New(app.i18n.Ts("campaigns.duplicateBlock", "name", b.Name))
+		}
+		names[b.Name] = true
+
+		b.Condition = strings.TrimSpace(b.Condition)
+		if b.Condition == "" {
+			b.Condition = "true"
+		}
+		c.ContentBlocks[i] = b
+	}
+	if c.ContentBlocks == nil {
+		c.ContentBlocks = models.ContentBlocks{}
+	}
+
+	// Language variants are picked by the subscribers' locales.
+	langs := map[string]bool{}
+	for i, v := range c.LangVariants {
+		v.Lang = strings.TrimSpace(v.Lang)
+		if !regexLang.MatchString(v.Lang) {
+			return c, errors.New(app.i18n.Ts("campaigns.invalidLangVariant", "name", v.Lang))
+		}
+		l := strings.ToLower(strings.ReplaceAll(v.Lang, "_", "-"))
+		if langs[l] {
+			return c, errors.New(app.i18n.Ts("campaigns.duplicateLangVariant", "name", v.Lang))
+		}
+		langs[l] = true
+
+		if strings.TrimSpace(v.Body) == "" {
+			return c, errors.New(app.i18n.Ts("campaigns.emptyLangVariant", "name", v.Lang))
+		}
+		v.Subject = strings.TrimSpace(v.Subject)
+		c.LangVariants[i] = v
+	}
+	if c.LangVariants == nil {
+		c.LangVariants = models.LangVariants{}
+	}
+
+	// Engagement rules are applied to subscribers on views and clicks.
+	for i, r := range c.EngagementRules {
+		if r.Event != models.EngagementEventView && r.Event != models.EngagementEventClick {
+			return c, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "engagement_rules.event"))
+		}
+		// Views have no link to match.
+		r.URL = strings.TrimSpace(r.URL)
+		if r.Event == models.EngagementEventView {
+			r.URL = ""
+		}
+
+		switch r.Action {
+		case models.EngagementActionAddList, models.EngagementActionUnsubList:
+			if r.ListID < 1 {
+				return c, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "engagement_rules.list_id"))
+			}
+			r.Attrib, r.Value = "", ""
+		case models.EngagementActionSetAttrib:
+			r.Attrib = strings.TrimSpace(r.Attrib)
+			if !strHasLen(r.Attrib, 1, stdInputMaxLen) {
+				return c, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "engagement_rules.attrib"))
+			}
+			r.ListID = 0
+		default:
+			return c, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "engagement_rules.action"))
+		}
+		c.EngagementRules[i] = r
+	}
+	if c.EngagementRules == nil {
+		c.EngagementRules = models.EngagementRules{}
+	}
+
+	// UTM params should have names and their values should be valid templates.
+	utm := make(models.UTMParams, len(c.UTMParams))
+	for k, v := range c.UTMParams {
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if k == "" {
+			return c, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "utm_params"))
+		}
+		if _, err := template.New("utm").Parse(v); err != nil {
+			return c, errors.New(app.i18n.Ts("campaigns.invalidUTMParam", "name", k, "error", err.Error()))
+		}
+		utm[k] = v
+	}
+	c.UTMParams = utm
+
+	// The tracking domain should be one of the configured tracking domains.
+	c.TrackingDomain = strings.TrimRight(strings.TrimSpace(c.TrackingDomain), "/")
+	if c.TrackingDomain != "" && !inArray(c.TrackingDomain, app.constants.Privacy.TrackingDomains) {
+		return c, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "tracking_domain"))
+	}
+
+	// Validate the total size of attachments against the messenger's limits.
+	if max := app.manager.MaxAttachmentSize(c.Messenger); max > 0 && len(c.MediaIDs) > 0 {
+		var size int64
+		for _, id := range c.MediaIDs {
+			m, err := app.core.GetMedia(id, "", app.media)
+			if err != nil {
+				if er, ok := err.(*echo.HTTPError); ok {
+					return c, errors.New(fmt.Sprintf("%s", er.Message))
+				}
+				return c, err
+			}
+
+			// Media uploaded before sizes were recorded are checked when the campaign is sent.
+			if n, ok := m.Meta["size"].(float64); ok {
+				size += int64(n)
+			}
+		}
+
+		if size > max {
+			return c, errors.New(app.i18n.Ts("campaigns.attachmentsTooLarge", "size", fmt.Sprintf("%d KB", max/1024)))
+		}
+	}
+
 	camp := models.Campaign{Body: c.Body, TemplateBody: tplTag}
 	if err := c.CompileTemplate(app.manager.TemplateFuncs(&camp)); err != nil {
 		return c, errors.New(app.i18n.Ts("campaigns.fieldInvalidBody", "error", err.Error()))
 	}
 
+	// An empty AMP body is stored as NULL.
+	if strings.TrimSpace(c.BodyAMP.String) == "" {
+		c.BodyAMP = null.String{}
+	}
+
 	if len(c.Headers) == 0 {
 		c.Headers = make([]map[string]string, 0)
 	}
 
+	// Custom header names should be valid, and values shouldn't have line
+	// breaks that'd inject headers.
+	for _, set := range c.Headers {
+		for hdr, val := range set {
+			if !regexHeaderName.MatchString(hdr) || strings.ContainsAny(val, "\r\n") {
+				return c, errors.New(app.i18n.Ts("campaigns.fieldInvalidHeader", "name", hdr))
+			}
+		}
+	}
+
+	// Normalize the List-ID to "description <id>".
+	if c.ListIDHeader = strings.TrimSpace(c.ListIDHeader); c.ListIDHeader != "" {
+		m := regexListID.FindStringSubmatch(c.ListIDHeader)
+		if m == nil || strings.ContainsAny(m[1], "<>\r\n") {
+			return c, errors.New(app.i18n.Ts("campaigns.fieldInvalidListID", "name", c.ListIDHeader))
+		}
+
+		c.ListIDHeader = "<" + m[2] + ">"
+		if m[1] != "" {
+			c.ListIDHeader = m[1] + " " + c.ListIDHeader
+		}
+	}
+
 	if len(c.ArchiveMeta) == 0 {
 		c.ArchiveMeta = json.RawMessage("{}")
 	}
 
+	if c.ArchiveAccess == "" {
+		c.ArchiveAccess = models.CampaignArchiveAccessPublic
+	}
+	if !isArchiveAccess(c.ArchiveAccess) {
+		return c, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "archive_access"))
+	}
+
+	hash, err := makeArchivePassword(c.ArchiveAccess, c.NewArchivePassword, c.ArchivePassword, app)
+	if err != nil {
+		return c, err
+	}
+	c.ArchivePassword = hash
+
 	if c.ArchiveSlug.String != "" {
 		// Format the slug to be alpha-numeric-dash.
 		s := strings.ToLower(c.ArchiveSlug.String)
@@ -606,6 +1632,56 @@ func isCampaignalMutable(status string) bool {
 		status == models.CampaignStatusFinished
 }
 
+// applyListDefaults fills the sender, template, messenger, and Reply-To header
+// that aren't set in a new campaign with the sending defaults of its lists,
+// taking each one from the first list that has it.
+func applyListDefaults(o campaignReq, app *App) (campaignReq, error) {
+	if len(o.ListIDs) == 0 {
+		return o, nil
+	}
+
+	lists, err := app.core.GetListsByOptin(o.ListIDs, "")
+	if err != nil {
+		return o, err
+	}
+	byID := make(map[int]models.List, len(lists))
+	for _, l := range lists {
+		byID[l.ID] = l
+	}
+
+	hasReplyTo := false
+	for _, h := range o.Headers {
+		for k := range h {
+			if strings.EqualFold(k, "Reply-To") {
+				hasReplyTo = true
+			}
+		}
+	}
+
+	for _, id := range o.ListIDs {
+		l, ok := byID[id]
+		if !ok {
+			continue
+		}
+
+		if o.FromEmail == "" {
+			o.FromEmail = l.DefaultFromEmail
+		}
+		if o.TemplateID == 0 && l.DefaultTemplateID.Valid {
+			o.TemplateID = l.DefaultTemplateID.Int
+		}
+		if o.Messenger == "" && app.manager.HasMessenger(l.DefaultMessenger) {
+			o.Messenger = l.DefaultMessenger
+		}
+		if !hasReplyTo && l.DefaultReplyTo != "" {
+			o.Headers = append(o.Headers, map[string]string{"Reply-To": l.DefaultReplyTo})
+			hasReplyTo = true
+		}
+	}
+
+	return o, nil
+}
+
 // makeOptinCampaignMessage makes a default opt-in campaign message body.
 func makeOptinCampaignMessage(o campaignReq, app *App) (campaignReq, error) {
 	if len(o.ListIDs) == 0 {
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/knadh/listmonk/internal/crmsync"
+	"github.com/knadh/listmonk/internal/subimporter"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// Syncs can't run more often than this.
+	crmSyncMinInterval = time.Minute * 5
+	crmSyncTimeout     = time.Second * 30
+
+	// Whose data is kept when a pulled contact is an existing subscriber.
+	crmSyncConflictListmonk = "listmonk"
+	crmSyncConflictCRM      = "crm"
+)
+
+// handleGetCRMSyncs handles retrieval of CRM syncs.
+func handleGetCRMSyncs(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	// Fetch one sync.
+	if id > 0 {
+		out, err := app.core.GetCRMSync(id)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, okResp{maskCRMSync(out)})
+	}
+
+	out, err := app.core.GetCRMSyncs(false)
+	if err != nil {
+		return err
+	}
+
+	for i := range out {
+		out[i] = maskCRMSync(out[i])
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleCreateCRMSync handles CRM sync creation.
+func handleCreateCRMSync(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		o   = models.CRMSync{Enabled: true, Pull: true}
+	)
+
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	o, err := validateCRMSync(o, app)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if o.APIKey == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "api_key"))
+	}
+
+	out, err := app.core.CreateCRMSync(o)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{maskCRMSync(out)})
+}
+
+// handleUpdateCRMSync handles CRM sync modification. An empty or masked API
+// key retains the existing one.
+func handleUpdateCRMSync(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	o, err := app.core.GetCRMSync(id)
+	if err != nil {
+		return err
+	}
+
+	// The existing API key is retained unless a new one is set, and the
+	// mapping is replaced as a whole.
+	o.APIKey = ""
+	o.Mapping = models.CRMSyncMapping{}
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	o, err = validateCRMSync(o, app)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	out, err := app.core.UpdateCRMSync(id, o)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{maskCRMSync(out)})
+}
+
+// handleDeleteCRMSync handles CRM sync deletion.
+func handleDeleteCRMSync(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	if err := app.core.DeleteCRMSync(id); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// handleRunCRMSync starts a CRM sync right away in the background.
+func handleRunCRMSync(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	s, err := app.core.GetCRMSync(id)
+	if err != nil {
+		return err
+	}
+
+	if !startCRMSync(s.ID, app) {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("crm.alreadyRunning"))
+	}
+	go runCRMSync(s, app)
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// pollCRMSyncs is a blocking function that runs the enabled CRM syncs that
+// are due at the given intervals.
+func pollCRMSyncs(interval time.Duration, app *App) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		syncs, err := app.core.GetCRMSyncs(true)
+		if err != nil {
+			continue
+		}
+
+		for _, s := range syncs {
+			d, err := time.ParseDuration(s.SyncInterval)
+			if err != nil || (s.RanAt.Valid && time.Since(s.RanAt.Time) < d) {
+				continue
+			}
+
+			if startCRMSync(s.ID, app) {
+				runCRMSync(s, app)
+			}
+		}
+	}
+}
+
+// startCRMSync marks a CRM sync as running and returns false if it's
+// already running.
+func startCRMSync(id int, app *App) bool {
+	app.Lock()
+	defer app.Unlock()
+
+	if app.crmSyncs[id] {
+		return false
+	}
+	app.crmSyncs[id] = true
+
+	return true
+}
+
+// runCRMSync runs a CRM sync that's been marked as running with startCRMSync()
+// and records the run.
+func runCRMSync(s models.CRMSync, app *App) {
+	defer func() {
+		app.Lock()
+		delete(app.crmSyncs, s.ID)
+		app.Unlock()
+	}()
+
+	var (
+		start               = time.Now()
+		pulled, pushed, err = syncCRM(s, start, app)
+		lastErr             = ""
+	)
+	if err != nil {
+		lastErr = err.Error()
+		app.log.Printf("error running crm sync (%s): %v", s.Name, err)
+	} else {
+		app.log.Printf("crm sync (%s): pulled %d contacts and pushed %d changes", s.Name, pulled, pushed)
+	}
+
+	_ = app.core.UpdateCRMSyncRan(s.ID, start, lastErr, pulled, pushed)
+}
+
+// syncCRM pushes the unsubscriptions and bounces of the subscribers of a sync's
+// list up to the given time to the CRM, and then pulls the contacts in
+// the CRM segment into the list. It returns the number of contacts that
+// were newly subscribed to the list and the number of changes pushed.
+func syncCRM(s models.CRMSync, upto time.Time, app *App) (int, int, error) {
+	m := crmsync.Mapping{Name: s.Mapping.Name, Attribs: s.Mapping.Attribs, Status: s.Mapping.Status}
+	p, err := crmsync.New(s.Provider, s.APIKey, m, &http.Client{Timeout: crmSyncTimeout})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	pushed := 0
+	if s.Mapping.Status != "" && (s.PushUnsubscribes || s.PushBounces) {
+		from := s.CreatedAt.Time
+		if s.SyncedAt.Valid {
+			from = s.SyncedAt.Time
+		}
+
+		changes, err := app.core.GetCRMSyncChanges(s.ListID, from, upto, s.PushUnsubscribes, s.PushBounces)
+		if err != nil {
+			if er, ok := err.(*echo.HTTPError); ok {
+				return 0, 0, errors.New(fmt.Sprintf("%s", er.Message))
+			}
+			return 0, 0, err
+		}
+
+		// Subscribers that aren't contacts in the CRM are skipped.
+		for _, c := range changes {
+			if err := p.SetStatus(c.Email, c.Status); err != nil && err != crmsync.ErrNotFound {
+				return 0, pushed, err
+			}
+			pushed++
+		}
+	}
+
+	if !s.Pull {
+		return 0, pushed, nil
+	}
+
+	pulled := 0
+	err = p.Contacts(s.Segment, func(contacts []crmsync.Contact) error {
+		for _, c := range contacts {
+			// Contacts with invalid or blocklisted e-mails, or attributes, are skipped.
+			req, err := app.importer.ValidateFields(subimporter.SubReq{
+				Subscriber: models.Subscriber{Email: c.Email, Name: c.Name},
+			})
+			if err != nil {
+				continue
+			}
+			if req.Attribs, err = app.importer.ValidateAttribs(models.JSON(c.Attribs)); err != nil {
+				continue
+			}
+
+			ok, err := app.core.UpsertCRMContact(s.ListID, req.Subscriber, s.Conflict == crmSyncConflictCRM, c.Name != "")
+			if err != nil {
+				if er, ok := err.(*echo.HTTPError); ok {
+					return errors.New(fmt.Sprintf("%s", er.Message))
+				}
+				return err
+			}
+			if ok {
+				pulled++
+			}
+		}
+
+		return nil
+	})
+
+	return pulled, pushed, err
+}
+
+// validateCRMSync validates incoming CRM sync fields.
+func validateCRMSync(o models.CRMSync, app *App) (models.CRMSync, error) {
+	o.Name = strings.TrimSpace(o.Name)
+	if !strHasLen(o.Name, 1, stdInputMaxLen) {
+		return o, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "name"))
+	}
+
+	if !strSliceContains(o.Provider, crmsync.Providers) {
+		return o, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "provider"))
+	}
+
+	o.Segment = strings.TrimSpace(o.Segment)
+	if !strHasLen(o.Segment, 1, stdInputMaxLen) {
+		return o, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "segment"))
+	}
+
+	// A masked key is the existing one that's sent back unchanged.
+	o.APIKey = strings.TrimSpace(o.APIKey)
+	if strings.Trim(o.APIKey, pwdMask) == "" {
+		o.APIKey = ""
+	}
+
+	if _, err := app.core.GetList(o.ListID, ""); err != nil {
+		return o, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "list_id"))
+	}
+
+	if o.Conflict == "" {
+		o.Conflict = crmSyncConflictListmonk
+	}
+	if o.Conflict != crmSyncConflictListmonk && o.Conflict != crmSyncConflictCRM {
+		return o, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "conflict"))
+	}
+
+	if o.SyncInterval == "" {
+		o.SyncInterval = "1h"
+	}
+	if d, err := time.ParseDuration(o.SyncInterval); err != nil || d < crmSyncMinInterval {
+		return o, errors.New(app.i18n.Ts("crm.invalidInterval", "min", crmSyncMinInterval.String()))
+	}
+
+	// Mapping.
+	var name []string
+	for _, p := range o.Mapping.Name {
+		if p = strings.TrimSpace(p); p != "" {
+			name = append(name, p)
+		}
+	}
+	o.Mapping.Name = name
+
+	attribs := make(map[string]string, len(o.Mapping.Attribs))
+	for p, a := range o.Mapping.Attribs {
+		p, a = strings.TrimSpace(p), strings.TrimSpace(a)
+		if p == "" || a == "" {
+			return o, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "mapping.attribs"))
+		}
+		attribs[p] = a
+	}
+	o.Mapping.Attribs = attribs
+
+	o.Mapping.Status = strings.TrimSpace(o.Mapping.Status)
+	if o.Mapping.Status == "" && (o.PushUnsubscribes || o.PushBounces) {
+		return o, errors.New(app.i18n.T("crm.statusPropertyRequired"))
+	}
+
+	return o, nil
+}
+
+// maskCRMSync masks the API key of a CRM sync for API responses.
+func maskCRMSync(s models.CRMSync) models.CRMSync {
+	s.APIKey = strings.Repeat(pwdMask, utf8.RuneCountInString(s.APIKey))
+	return s
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// Interval at which the domain blocklist hits are recorded in the DB.
+	domainBlocklistFlushInterval = time.Second * 30
+
+	// Interval at which the disposable e-mail domains are fetched again, the
+	// timeout for fetching them, and the max size of the fetched list.
+	disposableDomainsInterval = time.Hour * 24
+	disposableDomainsTimeout  = time.Second * 30
+	disposableDomainsMaxSize  = 10 * 1024 * 1024
+)
+
+// A domain, optionally with *. as the subdomain prefix, eg: *.example.com.
+var regexpBlocklistDomain = regexp.MustCompile(`^(\*\.)?([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)+[a-z0-9-]{2,}$`)
+
+type domainBlocklistReq struct {
+	Domains []string `json:"domains"`
+}
+
+type disposableDomainsResp struct {
+	Enabled bool   `json:"enabled"`
+	URL     string `json:"url"`
+	Count   int    `json:"count"`
+}
+
+// handleGetDomainBlocklist returns the domain blocklist entries with the
+// number of e-mails that each has blocked.
+func handleGetDomainBlocklist(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+	)
+
+	// Record the pending hits so that the counts are current.
+	flushDomainBlocklistHits(app)
+
+	out, err := app.core.GetDomainBlocklist()
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleAddDomainBlocklist adds domains to the domain blocklist. It takes
+// effect immediately without reloading the app.
+func handleAddDomainBlocklist(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		req domainBlocklistReq
+	)
+
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	set, err := app.core.GetSettings()
+	if err != nil {
+		return err
+	}
+
+	var (
+		doms = append([]string{}, set.DomainBlocklist...)
+		seen = make(map[string]bool, len(doms))
+	)
+	for _, d := range doms {
+		seen[d] = true
+	}
+	for _, d := range req.Domains {
+		d = strings.TrimSpace(strings.ToLower(d))
+		if !regexpBlocklistDomain.MatchString(d) {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("settings.privacy.invalidBlocklistDomain", "name", d))
+		}
+		if !seen[d] {
+			doms = append(doms, d)
+			seen[d] = true
+		}
+	}
+
+	return updateDomainBlocklist(doms, c, app)
+}
+
+// handleDeleteDomainBlocklist removes the domains given in the `domain`
+// query params from the domain blocklist, along with their hit counters.
+func handleDeleteDomainBlocklist(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		del = make(map[string]bool)
+	)
+
+	for _, d := range c.QueryParams()["domain"] {
+		del[strings.TrimSpace(strings.ToLower(d))] = true
+	}
+	if len(del) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.missingFields", "name", "`domain`"))
+	}
+
+	set, err := app.core.GetSettings()
+	if err != nil {
+		return err
+	}
+
+	doms := make([]string, 0, len(set.DomainBlocklist))
+	for _, d := range set.DomainBlocklist {
+		if !del[d] {
+			doms = append(doms, d)
+		}
+	}
+
+	return updateDomainBlocklist(doms, c, app)
+}
+
+// updateDomainBlocklist saves the domain blocklist and swaps it in the importer,
+// which enforces it on imports, subscriptions, and campaign sends.
+func updateDomainBlocklist(doms []string, c echo.Context, app *App) error {
+	// Record the pending hits of domains that may be removed before their counters are cleared.
+	flushDomainBlocklistHits(app)
+
+	if err := app.core.UpdateDomainBlocklist(doms); err != nil {
+		return err
+	}
+	app.importer.SetDomainBlocklist(doms)
+
+	out, err := app.core.GetDomainBlocklist()
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// recordDomainBlocklistHits is a blocking function that records the number
+// of e-mails blocked by the domain blocklist in the DB at the given intervals.
+func recordDomainBlocklistHits(interval time.Duration, app *App) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		flushDomainBlocklistHits(app)
+	}
+}
+
+// flushDomainBlocklistHits records the domain blocklist hits since the last flush.
+func flushDomainBlocklistHits(app *App) {
+	hits := app.importer.TakeDomainBlocklistHits()
+	if len(hits) == 0 {
+		return
+	}
+
+	// Errors are logged by core.
+	_ = app.core.AddDomainBlocklistHits(hits)
+}
+
+// handleGetDisposableDomains returns whether disposable e-mail domains are
+// blocked and the number of domains.
+func handleGetDisposableDomains(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+	)
+
+	doms, err := app.core.GetDisposableDomains()
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{disposableDomainsResp{
+		Enabled: app.constants.Privacy.BlockDisposableEmails,
+		URL:     app.constants.Privacy.DisposableDomainsURL,
+		Count:   len(doms),
+	}})
+}
+
+// handleRefreshDisposableDomains fetches the disposable e-mail domains from
+// the URL in the settings and replaces the existing ones. It takes effect
+// immediately without reloading the app.
+func handleRefreshDisposableDomains(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+	)
+
+	n, err := refreshDisposableDomains(app)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{disposableDomainsResp{
+		Enabled: app.constants.Privacy.BlockDisposableEmails,
+		URL:     app.constants.Privacy.DisposableDomainsURL,
+		Count:   n,
+	}})
+}
+
+// syncDisposableDomains is a blocking function that fetches the disposable
+// e-mail domains at startup if there are none yet, and at the given intervals
+// thereafter, if blocking them is enabled.
+func syncDisposableDomains(interval time.Duration, app *App) {
+	if !app.constants.Privacy.BlockDisposableEmails || app.constants.Privacy.DisposableDomainsURL == "" {
+		return
+	}
+
+	// Errors are logged.
+	if doms, err := app.core.GetDisposableDomains(); err == nil && len(doms) == 0 {
+		_, _ = refreshDisposableDomains(app)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		_, _ = refreshDisposableDomains(app)
+	}
+}
+
+// refreshDisposableDomains fetches the disposable e-mail domains, saves them,
+// and swaps them in the importer if blocking them is enabled. It returns the
+// number of domains.
+func refreshDisposableDomains(app *App) (int, error) {
+	u := app.constants.Privacy.DisposableDomainsURL
+	if u == "" {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.missingFields", "name", "disposable_domains_url"))
+	}
+
+	doms, err := fetchDisposableDomains(u)
+	if err != nil {
+		app.log.Printf("error fetching disposable domains from %s: %v", u, err)
+		return 0, echo.NewHTTPError(http.StatusBadGateway, app.i18n.Ts("settings.privacy.errorFetchingDisposable", "error", err.Error()))
+	}
+
+	if err := app.core.ReplaceDisposableDomains(doms); err != nil {
+		return 0, err
+	}
+	if app.constants.Privacy.BlockDisposableEmails {
+		app.importer.SetDisposableDomains(doms)
+	}
+
+	return len(doms), nil
+}
+
+// fetchDisposableDomains fetches a list of domains with one domain per line.
+// Blank lines, # comments, and lines that aren't domains are skipped.
+func fetchDisposableDomains(u string) ([]string, error) {
+	client := &http.Client{Timeout: disposableDomainsTimeout}
+	resp, err := client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	var (
+		out  []string
+		seen = make(map[string]bool)
+		sc   = bufio.NewScanner(io.LimitReader(resp.Body, disposableDomainsMaxSize))
+	)
+	for sc.Scan() {
+		d := strings.ToLower(strings.TrimSpace(sc.Text()))
+		if d == "" || strings.HasPrefix(d, "#") || strings.HasPrefix(d, "*.") || seen[d] || !regexpBlocklistDomain.MatchString(d) {
+			continue
+		}
+		out = append(out, d)
+		seen[d] = true
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	// Don't replace the existing domains with an empty list, eg: when the URL returns a page.
+	if len(out) == 0 {
+		return nil, errors.New("no domains in the list")
+	}
+
+	return out, nil
+}
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"crypto/subtle"
 	"net/http"
+	"net/url"
 	"path"
 	"regexp"
+	"strings"
 
 	"github.com/knadh/paginator"
 	"github.com/labstack/echo/v4"
@@ -54,7 +56,7 @@ func initHTTPHandlers(e *echo.Echo, app *App) {
 		len(app.constants.AdminPassword) == 0 {
 		g = e.Group("")
 	} else {
-		g = e.Group("", middleware.BasicAuth(basicAuth))
+		g = e.Group("", middleware.BasicAuth(basicAuth), checkAPITokenScope)
 	}
 
 	e.HTTPErrorHandler = func(err error, c echo.Context) {
@@ -79,6 +81,7 @@ func initHTTPHandlers(e *echo.Echo, app *App) {
 	// API endpoints.
 	g.GET("/api/health", handleHealthCheck)
 	g.GET("/api/config", handleGetServerConfig)
+	g.GET("/api/messengers/usage", handleGetMessengerUsage)
 	g.GET("/api/lang/:lang", handleGetI18nLang)
 	g.GET("/api/dashboard/charts", handleGetDashboardCharts)
 	g.GET("/api/dashboard/counts", handleGetDashboardCounts)
@@ -86,25 +89,61 @@ func initHTTPHandlers(e *echo.Echo, app *App) {
 	g.GET("/api/settings", handleGetSettings)
 	g.PUT("/api/settings", handleUpdateSettings)
 	g.POST("/api/settings/smtp/test", handleTestSMTPSettings)
+	g.GET("/api/domain-blocklist", handleGetDomainBlocklist)
+	g.POST("/api/domain-blocklist", handleAddDomainBlocklist)
+	g.DELETE("/api/domain-blocklist", handleDeleteDomainBlocklist)
+	g.GET("/api/domain-blocklist/disposable", handleGetDisposableDomains)
+	g.POST("/api/domain-blocklist/disposable/refresh", handleRefreshDisposableDomains)
+	g.GET("/api/tokens", handleGetAPITokens)
+	g.POST("/api/tokens", handleCreateAPIToken)
+	g.PUT("/api/tokens/:id", handleUpdateAPIToken)
+	g.DELETE("/api/tokens/:id", handleDeleteAPIToken)
 	g.POST("/api/admin/reload", handleReloadApp)
 	g.GET("/api/logs", handleGetLogs)
 	g.GET("/api/about", handleGetAboutInfo)
 
+	g.GET("/api/subscribers/erasures", handleGetSubscriberErasures)
+	g.GET("/api/subscribers/duplicates", handleGetSubscriberDuplicates)
+	g.GET("/api/subscribers/sample", handleSampleSubscribers)
+	g.GET("/api/subscribers/tags", handleGetSubscriberTags)
+	g.PUT("/api/subscribers/tags", handleManageSubscriberTags)
+	g.PUT("/api/subscribers/tags/:tag", handleRenameSubscriberTag)
+	g.DELETE("/api/subscribers/tags/:tag", handleDeleteSubscriberTag)
 	g.GET("/api/subscribers/:id", handleGetSubscriber)
 	g.GET("/api/subscribers/:id/export", handleExportSubscriberData)
 	g.GET("/api/subscribers/:id/bounces", handleGetSubscriberBounces)
+	g.GET("/api/subscribers/:id/campaigns", handleGetSubscriberCampaigns)
+	g.GET("/api/subscribers/:id/consents", handleGetSubscriberConsents)
 	g.DELETE("/api/subscribers/:id/bounces", handleDeleteSubscriberBounces)
 	g.POST("/api/subscribers", handleCreateSubscriber)
 	g.PUT("/api/subscribers/:id", handleUpdateSubscriber)
+	g.PUT("/api/subscribers/by-external-id/:id", handleUpsertSubscriberByExternalID)
 	g.POST("/api/subscribers/:id/optin", handleSubscriberSendOptin)
+	g.POST("/api/subscribers/:id/resubscribe", handleResubscribeSubscriber)
+	g.GET("/api/subscribers/:id/email", handleGetSubscriberEmailChange)
+	g.POST("/api/subscribers/:id/email", handleChangeSubscriberEmail)
+	g.DELETE("/api/subscribers/:id/email", handleCancelSubscriberEmailChange)
+	g.GET("/api/subscribers/:id/emails", handleGetSubscriberEmails)
+	g.POST("/api/subscribers/:id/emails", handleAddSubscriberEmail)
+	g.POST("/api/subscribers/:id/emails/:emailID/verify", handleResendSubscriberEmailVerification)
+	g.PUT("/api/subscribers/:id/emails/:emailID/primary", handleSetPrimarySubscriberEmail)
+	g.DELETE("/api/subscribers/:id/emails/:emailID", handleDeleteSubscriberEmail)
+	g.GET("/api/subscribers/:id/notes", handleGetSubscriberNotes)
+	g.POST("/api/subscribers/:id/notes", handleCreateSubscriberNote)
+	g.PUT("/api/subscribers/:id/notes/:noteID", handleUpdateSubscriberNote)
+	g.DELETE("/api/subscribers/:id/notes/:noteID", handleDeleteSubscriberNote)
 	g.PUT("/api/subscribers/blocklist", handleBlocklistSubscribers)
+	g.PUT("/api/subscribers/restore", handleRestoreSubscribers)
 	g.PUT("/api/subscribers/:id/blocklist", handleBlocklistSubscribers)
 	g.PUT("/api/subscribers/lists/:id", handleManageSubscriberLists)
 	g.PUT("/api/subscribers/lists", handleManageSubscriberLists)
 	g.DELETE("/api/subscribers/:id", handleDeleteSubscribers)
+	g.POST("/api/subscribers/:id/erase", handleEraseSubscriber)
+	g.POST("/api/subscribers/merge", handleMergeSubscribers)
 	g.DELETE("/api/subscribers", handleDeleteSubscribers)
 
 	g.GET("/api/bounces", handleGetBounces)
+	g.GET("/api/bounces/auth-stats", handleGetBounceAuthStats)
 	g.GET("/api/bounces/:id", handleGetBounces)
 	g.DELETE("/api/bounces", handleDeleteBounces)
 	g.DELETE("/api/bounces/:id", handleDeleteBounces)
@@ -112,35 +151,91 @@ func initHTTPHandlers(e *echo.Echo, app *App) {
 	// Subscriber operations based on arbitrary SQL queries.
 	// These aren't very REST-like.
 	g.POST("/api/subscribers/query/delete", handleDeleteSubscribersByQuery)
+	g.POST("/api/subscribers/query/validate", handleValidateSubscriberQuery)
 	g.PUT("/api/subscribers/query/blocklist", handleBlocklistSubscribersByQuery)
+	g.PUT("/api/subscribers/query/restore", handleRestoreSubscribersByQuery)
 	g.PUT("/api/subscribers/query/lists", handleManageSubscriberListsByQuery)
+	g.PUT("/api/subscribers/query/tags", handleManageSubscriberTagsByQuery)
+	g.GET("/api/subscribers/jobs", handleGetSubscriberJobs)
+	g.GET("/api/subscribers/jobs/:id", handleGetSubscriberJob)
+	g.DELETE("/api/subscribers/jobs/:id", handleCancelSubscriberJob)
+	g.GET("/api/subscribers/notes", handleGetSubscriberNotes)
 	g.GET("/api/subscribers", handleQuerySubscribers)
 	g.GET("/api/subscribers/export",
 		middleware.GzipWithConfig(middleware.GzipConfig{Level: 9})(handleExportSubscribers))
 
 	g.GET("/api/import/subscribers", handleGetImportSubscribers)
 	g.GET("/api/import/subscribers/logs", handleGetImportSubscriberStats)
+	g.GET("/api/import/subscribers/report", handleGetImportSubscriberReport)
 	g.POST("/api/import/subscribers", handleImportSubscribers)
+	g.POST("/api/import/subscribers/mailchimp", handleImportMailchimp)
+	g.POST("/api/import/subscribers/mailchimp/audiences", handleGetMailchimpAudiences)
 	g.DELETE("/api/import/subscribers", handleStopImportSubscribers)
 
 	g.GET("/api/lists", handleGetLists)
+	g.GET("/api/lists/snapshots", handleGetListSnapshots)
+	g.GET("/api/lists/folders", handleGetListFolders)
+	g.GET("/api/lists/folders/:id", handleGetListFolders)
+	g.POST("/api/lists/folders", handleCreateListFolder)
+	g.PUT("/api/lists/folders/:id", handleUpdateListFolder)
+	g.DELETE("/api/lists/folders/:id", handleDeleteListFolder)
 	g.GET("/api/lists/:id", handleGetLists)
 	g.POST("/api/lists", handleCreateList)
+	g.POST("/api/lists/import", handleImportListBundle)
 	g.PUT("/api/lists/:id", handleUpdateList)
+	g.PUT("/api/lists/:id/archive", handleArchiveList)
+	g.PUT("/api/lists/:id/unarchive", handleUnarchiveList)
+	g.POST("/api/lists/:id/merge", handleMergeLists)
 	g.DELETE("/api/lists/:id", handleDeleteLists)
+	g.GET("/api/lists/:id/webhooks", handleGetListWebhooks)
+	g.POST("/api/lists/:id/webhooks", handleCreateListWebhook)
+	g.PUT("/api/lists/:id/webhooks/:hookID", handleUpdateListWebhook)
+	g.DELETE("/api/lists/:id/webhooks/:hookID", handleDeleteListWebhook)
+	g.GET("/api/lists/:id/optin-reminders", handleGetListOptinReminderStats)
+	g.GET("/api/lists/:id/stats", handleGetListStats)
+	g.GET("/api/lists/:id/export", handleExportListBundle)
 
 	g.GET("/api/campaigns", handleGetCampaigns)
 	g.GET("/api/campaigns/running/stats", handleGetRunningCampaignStats)
+	g.GET("/api/campaigns/costs", handleGetCampaignCosts)
+	g.GET("/api/campaigns/costs/export", handleExportCampaignCosts)
+	g.POST("/api/campaigns/archives/export", handleExportCampaignArchives)
+	g.GET("/api/campaigns/tags", handleGetCampaignTags)
+	g.POST("/api/campaigns/import", handleImportCampaignBundle)
+	g.POST("/api/campaigns/tags", handleAddCampaignTag)
+	g.PUT("/api/campaigns/tags/:tag", handleRenameCampaignTag)
+	g.DELETE("/api/campaigns/tags/:tag", handleDeleteCampaignTag)
 	g.GET("/api/campaigns/:id", handleGetCampaign)
 	g.GET("/api/campaigns/analytics/:type", handleGetCampaignViewAnalytics)
+	g.GET("/api/campaigns/:id/stats/stream", handleStreamCampaignStats)
+	g.GET("/api/campaigns/:id/deliveries", handleGetCampaignDeliveries)
+	g.GET("/api/campaigns/:id/versions", handleGetCampaignVersions)
+	g.GET("/api/campaigns/:id/links", handleGetCampaignLinkClicks)
+	g.GET("/api/campaigns/:id/recipients", handleGetCampaignRecipients)
+	g.GET("/api/campaigns/:id/deliveries/log", handleGetCampaignDeliveryLog)
+	g.GET("/api/campaigns/:id/audience", handleGetCampaignAudience)
+	g.POST("/api/campaigns/:id/subjects", handlePreviewCampaignSubjects)
+	g.GET("/api/campaigns/:id/simulation", handleGetCampaignSimulation)
+	g.POST("/api/campaigns/:id/simulation", handleStartCampaignSimulation)
+	g.DELETE("/api/campaigns/:id/simulation", handleCancelCampaignSimulation)
+	g.GET("/api/campaigns/:id/tests", handleGetCampaignTests)
+	g.GET("/api/campaigns/:id/revisions", handleGetCampaignRevisions)
+	g.GET("/api/campaigns/:id/revisions/:revID", handleGetCampaignRevision)
+	g.GET("/api/campaigns/:id/export", handleExportCampaignBundle)
 	g.GET("/api/campaigns/:id/preview", handlePreviewCampaign)
 	g.POST("/api/campaigns/:id/preview", handlePreviewCampaign)
 	g.POST("/api/campaigns/:id/content", handleCampaignContent)
 	g.POST("/api/campaigns/:id/text", handlePreviewCampaign)
 	g.POST("/api/campaigns/:id/test", handleTestCampaign)
+	g.POST("/api/campaigns/:id/preflight", handlePreflightCampaign)
+	g.POST("/api/campaigns/:id/revisions/:revID/restore", handleRestoreCampaignRevision)
+	g.GET("/api/campaigns/:id/builder", handleGetCampaignBuilderDoc)
+	g.PUT("/api/campaigns/:id/builder", handleUpdateCampaignBuilderDoc)
+	g.DELETE("/api/campaigns/:id/builder", handleDeleteCampaignBuilderDoc)
 	g.POST("/api/campaigns", handleCreateCampaign)
 	g.PUT("/api/campaigns/:id", handleUpdateCampaign)
 	g.PUT("/api/campaigns/:id/status", handleUpdateCampaignStatus)
+	g.POST("/api/campaigns/:id/retry", handleRetryCampaignErrors)
 	g.PUT("/api/campaigns/:id/archive", handleUpdateCampaignArchive)
 	g.DELETE("/api/campaigns/:id", handleDeleteCampaign)
 
@@ -153,14 +248,64 @@ func initHTTPHandlers(e *echo.Echo, app *App) {
 	g.GET("/api/templates/:id", handleGetTemplates)
 	g.GET("/api/templates/:id/preview", handlePreviewTemplate)
 	g.POST("/api/templates/preview", handlePreviewTemplate)
+	g.POST("/api/templates/render", handleRenderTemplate)
+	g.POST("/api/templates/:id/render", handleRenderTemplate)
+	g.POST("/api/templates/lint", handleLintTemplate)
+	g.POST("/api/templates/:id/lint", handleLintTemplate)
 	g.POST("/api/templates", handleCreateTemplate)
 	g.PUT("/api/templates/:id", handleUpdateTemplate)
 	g.PUT("/api/templates/:id/default", handleTemplateSetDefault)
+	g.GET("/api/templates/:id/revisions", handleGetTemplateRevisions)
+	g.GET("/api/templates/:id/revisions/:revID", handleGetTemplateRevision)
+	g.POST("/api/templates/:id/revisions/:revID/restore", handleRestoreTemplateRevision)
+	g.GET("/api/templates/:id/builder", handleGetTemplateBuilderDoc)
+	g.PUT("/api/templates/:id/builder", handleUpdateTemplateBuilderDoc)
+	g.DELETE("/api/templates/:id/builder", handleDeleteTemplateBuilderDoc)
+	g.POST("/api/builder/render", handleRenderBuilderDoc)
 	g.DELETE("/api/templates/:id", handleDeleteTemplate)
 
+	g.GET("/api/templates/partials", handleGetTemplatePartials)
+	g.GET("/api/templates/partials/:id", handleGetTemplatePartials)
+	g.POST("/api/templates/partials", handleCreateTemplatePartial)
+	g.PUT("/api/templates/partials/:id", handleUpdateTemplatePartial)
+	g.DELETE("/api/templates/partials/:id", handleDeleteTemplatePartial)
+
+	g.GET("/api/templates/gallery", handleGetTemplateGallery)
+	g.POST("/api/templates/gallery/import", handleImportGalleryTemplate)
+
+	g.GET("/api/rss", handleGetRSSFeeds)
+	g.GET("/api/rss/:id", handleGetRSSFeeds)
+	g.POST("/api/rss", handleCreateRSSFeed)
+	g.POST("/api/rss/:id/check", handleCheckRSSFeed)
+	g.PUT("/api/rss/:id", handleUpdateRSSFeed)
+	g.DELETE("/api/rss/:id", handleDeleteRSSFeed)
+
+	g.GET("/api/crm-syncs", handleGetCRMSyncs)
+	g.GET("/api/crm-syncs/:id", handleGetCRMSyncs)
+	g.POST("/api/crm-syncs", handleCreateCRMSync)
+	g.POST("/api/crm-syncs/:id/run", handleRunCRMSync)
+	g.PUT("/api/crm-syncs/:id", handleUpdateCRMSync)
+	g.DELETE("/api/crm-syncs/:id", handleDeleteCRMSync)
+
+	g.GET("/api/forms", handleGetSubscriptionForms)
+	g.GET("/api/forms/:id", handleGetSubscriptionForms)
+	g.GET("/api/forms/:id/stats", handleGetSubscriptionFormStats)
+	g.POST("/api/forms", handleCreateSubscriptionForm)
+	g.PUT("/api/forms/:id", handleUpdateSubscriptionForm)
+	g.DELETE("/api/forms/:id", handleDeleteSubscriptionForm)
+
+	g.GET("/api/segments", handleGetSegments)
+	g.GET("/api/segments/:id", handleGetSegments)
+	g.GET("/api/segments/:id/stats", handleGetSegmentStats)
+	g.POST("/api/segments", handleCreateSegment)
+	g.POST("/api/segments/:id/refresh", handleRefreshSegment)
+	g.PUT("/api/segments/:id", handleUpdateSegment)
+	g.DELETE("/api/segments/:id", handleDeleteSegment)
+
 	g.DELETE("/api/maintenance/subscribers/:type", handleGCSubscribers)
 	g.DELETE("/api/maintenance/analytics/:type", handleGCCampaignAnalytics)
 	g.DELETE("/api/maintenance/subscriptions/unconfirmed", handleGCSubscriptions)
+	g.GET("/api/maintenance/hygiene", handlePreviewSubscriberHygiene)
 
 	g.POST("/api/tx", handleSendTxMessage)
 
@@ -186,11 +331,22 @@ func initHTTPHandlers(e *echo.Echo, app *App) {
 	// Public subscriber facing views.
 	e.GET("/subscription/form", handleSubscriptionFormPage)
 	e.POST("/subscription/form", handleSubscriptionForm)
+	e.GET("/subscription/form/:uuid", validateUUID(handleHostedFormPage, "uuid"))
+	e.POST("/subscription/form/:uuid", validateUUID(handleHostedForm, "uuid"))
+	e.GET("/subscription/form/:uuid/embed.js", validateUUID(handleHostedFormEmbed, "uuid"))
 	e.GET("/subscription/:campUUID/:subUUID", noIndex(validateUUID(subscriberExists(handleSubscriptionPage),
 		"campUUID", "subUUID")))
 	e.POST("/subscription/:campUUID/:subUUID", validateUUID(subscriberExists(handleSubscriptionPrefs),
 		"campUUID", "subUUID"))
+	e.GET("/subscription/preferences/:subUUID", noIndex(validateUUID(subscriberExists(handlePreferencesPage), "subUUID")))
+	e.POST("/subscription/preferences/:subUUID", validateUUID(subscriberExists(handlePreferences), "subUUID"))
 	e.GET("/subscription/optin/:subUUID", noIndex(validateUUID(subscriberExists(handleOptinPage), "subUUID")))
+	e.GET("/subscription/email/:token", noIndex(validateUUID(handleEmailChangePage, "token")))
+	e.POST("/subscription/email/:token", validateUUID(handleEmailChangePage, "token"))
+	e.GET("/subscription/verify-email/:token", noIndex(validateUUID(handleEmailVerifyPage, "token")))
+	e.POST("/subscription/verify-email/:token", validateUUID(handleEmailVerifyPage, "token"))
+	e.GET("/subscription/renew/:subUUID", noIndex(validateUUID(subscriberExists(handleRepermissionPage), "subUUID")))
+	e.POST("/subscription/renew/:subUUID", validateUUID(subscriberExists(handleRepermissionPage), "subUUID"))
 	e.POST("/subscription/optin/:subUUID", validateUUID(subscriberExists(handleOptinPage), "subUUID"))
 	e.POST("/subscription/export/:subUUID", validateUUID(subscriberExists(handleSelfExportSubscriberData),
 		"subUUID"))
@@ -207,6 +363,7 @@ func initHTTPHandlers(e *echo.Echo, app *App) {
 		e.GET("/archive", handleCampaignArchivesPage)
 		e.GET("/archive.xml", handleGetCampaignArchivesFeed)
 		e.GET("/archive/:id", handleCampaignArchivePage)
+		e.POST("/archive/:id", handleCampaignArchivePassword)
 		e.GET("/archive/latest", handleCampaignArchivePageLatest)
 	}
 
@@ -295,7 +452,17 @@ func basicAuth(username, password string, c echo.Context) (bool, error) {
 		subtle.ConstantTimeCompare([]byte(password), app.constants.AdminPassword) == 1 {
 		return true, nil
 	}
-	return false, nil
+
+	// API tokens, whose requests are restricted by checkAPITokenScope.
+	tok, ok, err := app.core.AuthAPIToken(username, hashAPIToken(password))
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		c.Set(apiTokenCtxKey, tok)
+	}
+
+	return ok, nil
 }
 
 // validateUUID middleware validates the UUID string format for a given set of params.
@@ -345,3 +512,37 @@ func noIndex(next echo.HandlerFunc, params ...string) echo.HandlerFunc {
 		return next(c)
 	}
 }
+
+// trackingDomainsOnly restricts the requests on the alternate link and view
+// tracking domains to the link, view, and campaign message handlers.
+func trackingDomainsOnly(app *App) echo.MiddlewareFunc {
+	hosts := make(map[string]bool, len(app.constants.Privacy.TrackingDomains))
+	for _, d := range app.constants.Privacy.TrackingDomains {
+		if u, err := url.Parse(d); err == nil {
+			hosts[strings.ToLower(u.Host)] = true
+		}
+	}
+
+	// The root URL's host is never restricted.
+	if u, err := url.Parse(app.constants.RootURL); err == nil {
+		delete(hosts, strings.ToLower(u.Host))
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if len(hosts) == 0 {
+			return next
+		}
+
+		return func(c echo.Context) error {
+			if !hosts[strings.ToLower(c.Request().Host)] {
+				return next(c)
+			}
+
+			p := c.Request().URL.Path
+			if strings.HasPrefix(p, "/link/") || strings.HasPrefix(p, "/campaign/") {
+				return next(c)
+			}
+			return echo.ErrNotFound
+		}
+	}
+}
@@ -29,25 +29,9 @@ func handleImportSubscribers(c echo.Context) error {
 			app.i18n.Ts("import.invalidParams", "error", err.Error()))
 	}
 
-	// Validate mode.
-	if opt.Mode != subimporter.ModeSubscribe && opt.Mode != subimporter.ModeBlocklist {
-		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("import.invalidMode"))
-	}
-
-	// If no status is specified, pick a default one.
-	if opt.SubStatus == "" {
-		switch opt.Mode {
-		case subimporter.ModeSubscribe:
-			opt.SubStatus = models.SubscriptionStatusUnconfirmed
-		case subimporter.ModeBlocklist:
-			opt.SubStatus = models.SubscriptionStatusUnsubscribed
-		}
-	}
-
-	if opt.SubStatus != models.SubscriptionStatusUnconfirmed &&
-		opt.SubStatus != models.SubscriptionStatusConfirmed &&
-		opt.SubStatus != models.SubscriptionStatusUnsubscribed {
-		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("import.invalidSubStatus"))
+	opt, err := validateImportOpt(opt, app)
+	if err != nil {
+		return err
 	}
 
 	if len(opt.Delim) != 1 {
@@ -122,6 +106,24 @@ func handleGetImportSubscriberStats(c echo.Context) error {
 	return c.JSON(http.StatusOK, okResp{string(app.importer.GetLogs())})
 }
 
+// handleGetImportSubscriberReport returns the CSV report of the records
+// that were skipped or errored in the last import.
+func handleGetImportSubscriberReport(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	f, err := app.importer.GetReport()
+	if err != nil {
+		if err == subimporter.ErrIsImporting {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("import.alreadyRunning"))
+		}
+		return echo.NewHTTPError(http.StatusNotFound, app.i18n.T("import.noReport"))
+	}
+	defer f.Close()
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, "attachment; filename=import-report.csv")
+	return c.Stream(http.StatusOK, "text/csv", f)
+}
+
 // handleStopImportSubscribers sends a stop signal to the importer.
 // If there's an ongoing import, it'll be stopped, and if an import
 // is finished, it's state is cleared.
@@ -130,3 +132,123 @@ func handleStopImportSubscribers(c echo.Context) error {
 	app.importer.Stop()
 	return c.JSON(http.StatusOK, okResp{app.importer.GetStats()})
 }
+
+// handleImportMailchimp starts an import of the members of a Mailchimp
+// audience, that are pulled from the Mailchimp API.
+func handleImportMailchimp(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	// Is an import already running?
+	if app.importer.GetStats().Status == subimporter.StatusImporting {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("import.alreadyRunning"))
+	}
+
+	var req struct {
+		subimporter.SessionOpt
+		subimporter.MailchimpOpt
+	}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	opt, err := validateImportOpt(req.SessionOpt, app)
+	if err != nil {
+		return err
+	}
+
+	mc := req.MailchimpOpt
+	mc.APIKey = strings.TrimSpace(mc.APIKey)
+	if mc.APIKey == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "api_key"))
+	}
+	mc.AudienceID = strings.TrimSpace(mc.AudienceID)
+	if mc.AudienceID == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "audience_id"))
+	}
+	for _, ids := range mc.TagLists {
+		for _, id := range ids {
+			if id < 1 {
+				return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "tag_lists"))
+			}
+		}
+	}
+	mc.TagsAttrib = strings.TrimSpace(mc.TagsAttrib)
+
+	// Start the importer session.
+	opt.Filename = "Mailchimp: " + mc.AudienceID
+	impSess, err := app.importer.NewSession(opt)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			app.i18n.Ts("import.errorStarting", "error", err.Error()))
+	}
+	go impSess.Start()
+	go impSess.LoadMailchimp(mc)
+
+	return c.JSON(http.StatusOK, okResp{app.importer.GetStats()})
+}
+
+// handleGetMailchimpAudiences retrieves the audiences of a Mailchimp account
+// with their merge fields and tags for mapping them on import.
+func handleGetMailchimpAudiences(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	var req struct {
+		APIKey string `json:"api_key"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(req.APIKey) == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "api_key"))
+	}
+
+	out, err := subimporter.GetMailchimpAudiences(req.APIKey)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			app.i18n.Ts("import.errorMailchimp", "error", err.Error()))
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// validateImportOpt validates the mode and the subscription status of an
+// import, picking the default status if there's none.
+func validateImportOpt(opt subimporter.SessionOpt, app *App) (subimporter.SessionOpt, error) {
+	// Validate mode.
+	if opt.Mode != subimporter.ModeSubscribe && opt.Mode != subimporter.ModeBlocklist {
+		return opt, echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("import.invalidMode"))
+	}
+
+	// If no status is specified, pick a default one.
+	if opt.SubStatus == "" {
+		switch opt.Mode {
+		case subimporter.ModeSubscribe:
+			opt.SubStatus = models.SubscriptionStatusUnconfirmed
+		case subimporter.ModeBlocklist:
+			opt.SubStatus = models.SubscriptionStatusUnsubscribed
+		}
+	}
+
+	if opt.SubStatus != models.SubscriptionStatusUnconfirmed &&
+		opt.SubStatus != models.SubscriptionStatusConfirmed &&
+		opt.SubStatus != models.SubscriptionStatusUnsubscribed {
+		return opt, echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("import.invalidSubStatus"))
+	}
+
+	// Strategies only apply to subscribe imports.
+	if opt.Strategy == "" {
+		opt.Strategy = subimporter.StrategyUpsert
+	}
+	switch opt.Strategy {
+	case subimporter.StrategyUpsert:
+	case subimporter.StrategyUpdateOnly, subimporter.StrategySkipExisting:
+		if opt.Mode != subimporter.ModeSubscribe {
+			return opt, echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("import.invalidStrategy"))
+		}
+	default:
+		return opt, echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("import.invalidStrategy"))
+	}
+
+	return opt, nil
+}
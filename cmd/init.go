@@ -28,6 +28,7 @@ import (
 	"github.com/knadh/koanf/providers/file"
 	"github.com/knadh/koanf/providers/posflag"
 	"github.com/knadh/koanf/v2"
+	"github.com/knadh/listmonk/internal/avscan"
 	"github.com/knadh/listmonk/internal/bounce"
 	"github.com/knadh/listmonk/internal/bounce/mailbox"
 	"github.com/knadh/listmonk/internal/captcha"
@@ -39,6 +40,7 @@ import (
 	"github.com/knadh/listmonk/internal/media/providers/s3"
 	"github.com/knadh/listmonk/internal/messenger/email"
 	"github.com/knadh/listmonk/internal/messenger/postback"
+	"github.com/knadh/listmonk/internal/mjml"
 	"github.com/knadh/listmonk/internal/subimporter"
 	"github.com/knadh/listmonk/models"
 	"github.com/knadh/stuffbin"
@@ -68,15 +70,28 @@ type constants struct {
 	SendOptinConfirmation         bool     `koanf:"send_optin_confirmation"`
 	Lang                          string   `koanf:"lang"`
 	DBBatchSize                   int      `koanf:"batch_size"`
+	ArchiveExportDir              string   `koanf:"archive_export_dir"`
 	Privacy                       struct {
-		IndividualTracking bool            `koanf:"individual_tracking"`
-		AllowPreferences   bool            `koanf:"allow_preferences"`
-		AllowBlocklist     bool            `koanf:"allow_blocklist"`
-		AllowExport        bool            `koanf:"allow_export"`
-		AllowWipe          bool            `koanf:"allow_wipe"`
-		RecordOptinIP      bool            `koanf:"record_optin_ip"`
-		Exportable         map[string]bool `koanf:"-"`
-		DomainBlocklist    []string        `koanf:"-"`
+		IndividualTracking     bool            `koanf:"individual_tracking"`
+		AllowPreferences       bool            `koanf:"allow_preferences"`
+		AllowBlocklist         bool            `koanf:"allow_blocklist"`
+		AllowExport            bool            `koanf:"allow_export"`
+		AllowWipe              bool            `koanf:"allow_wipe"`
+		RecordOptinIP          bool            `koanf:"record_optin_ip"`
+		SoftDelete             bool            `koanf:"soft_delete"`
+		SoftDeletePurgeDays    int             `koanf:"soft_delete_purge_days"`
+		HygieneUnconfirmedDays int             `koanf:"hygiene_unconfirmed_days"`
+		HygieneUnengagedMonths int             `koanf:"hygiene_unengaged_months"`
+		HygieneBlocklistedDays int             `koanf:"hygiene_blocklisted_days"`
+		BlockDisposableEmails  bool            `koanf:"block_disposable_emails"`
+		DisposableDomainsURL   string          `koanf:"disposable_domains_url"`
+		Exportable             map[string]bool `koanf:"-"`
+		DomainBlocklist        []string        `koanf:"-"`
+		TrackingDomains        []string        `koanf:"-"`
+
+		// E-mail frequencies and topics on offer in the preference center.
+		Frequencies []string `koanf:"-"`
+		Topics      []string `koanf:"-"`
 	} `koanf:"privacy"`
 	Security struct {
 		EnableCaptcha bool   `koanf:"enable_captcha"`
@@ -86,6 +101,24 @@ type constants struct {
 	AdminUsername []byte `koanf:"admin_username"`
 	AdminPassword []byte `koanf:"admin_password"`
 
+	// QA list and variants of campaign test batches.
+	TestListID   int           `koanf:"test_list_id"`
+	TestVariants []testVariant `koanf:"-"`
+
+	// Block saving templates that fail lint checks.
+	TemplateLintBlock bool `koanf:"template_lint_block"`
+
+	// Index or Git repository URL of the remote template gallery.
+	TemplateGalleryURL string `koanf:"template_gallery_url"`
+
+	// Schema of subscriber attributes.
+	AttribSchema []models.AttribField `koanf:"-"`
+
+	// Subscriber attributes that are searched in addition to the e-mail and
+	// name, and the ones that the search text was last computed with.
+	SearchAttribs        []string `koanf:"search_attribs"`
+	SearchAttribsIndexed []string `koanf:"search_attribs_indexed"`
+
 	Appearance struct {
 		AdminCSS  []byte `koanf:"admin.custom_css"`
 		AdminJS   []byte `koanf:"admin.custom_js"`
@@ -93,19 +126,26 @@ type constants struct {
 		PublicJS  []byte `koanf:"public.custom_js"`
 	}
 
-	UnsubURL     string
-	LinkTrackURL string
-	ViewTrackURL string
-	OptinURL     string
-	MessageURL   string
-	ArchiveURL   string
-	AssetVersion string
+	UnsubURL        string
+	PrefsURL        string
+	LinkTrackURL    string
+	ViewTrackURL    string
+	OptinURL        string
+	EmailChangeURL  string
+	EmailVerifyURL  string
+	RepermissionURL string
+	MessageURL      string
+	ArchiveURL      string
+	AssetVersion    string
 
 	MediaUpload struct {
 		Provider   string
 		Extensions []string
+		S3         s3.Opt
 	}
 
+	CostCurrency string
+
 	BounceWebhooksEnabled bool
 	BounceSESEnabled      bool
 	BounceSendgridEnabled bool
@@ -137,6 +177,8 @@ func initFlags() {
 	f.String("i18n-dir", "", "(optional) path to directory with i18n language files")
 	f.Bool("yes", false, "assume 'yes' to prompts during --install/upgrade")
 	f.Bool("passive", false, "run in passive mode where campaigns are not processed")
+	f.String("export-archive", "", "export the public campaign archive as static HTML to the given directory and exit")
+	f.String("export-archive-url", "", "(optional) root URL the exported archive is hosted at. Defaults to app.root_url")
 	if err := f.Parse(os.Args[1:]); err != nil {
 		lo.Fatalf("error loading flags: %v", err)
 	}
@@ -394,7 +436,30 @@ func initConstants() *constants {
 	c.Privacy.Exportable = maps.StringSliceToLookupMap(ko.Strings("privacy.exportable"))
 	c.MediaUpload.Provider = ko.String("upload.provider")
 	c.MediaUpload.Extensions = ko.Strings("upload.extensions")
+	ko.Unmarshal("upload.s3", &c.MediaUpload.S3)
 	c.Privacy.DomainBlocklist = ko.Strings("privacy.domain_blocklist")
+	c.Privacy.Frequencies = ko.Strings("privacy.frequencies")
+	c.Privacy.Topics = ko.Strings("privacy.topics")
+	for _, d := range ko.Strings("privacy.tracking_domains") {
+		c.Privacy.TrackingDomains = append(c.Privacy.TrackingDomains, strings.TrimRight(d, "/"))
+	}
+	c.CostCurrency = ko.String("costs.currency")
+	for _, v := range ko.Slices("app.test_variants") {
+		c.TestVariants = append(c.TestVariants, testVariant{
+			Name:          v.String("name"),
+			SubjectPrefix: v.String("subject_prefix"),
+			Emails:        v.Strings("emails"),
+		})
+	}
+	for _, v := range ko.Slices("app.attrib_schema") {
+		c.AttribSchema = append(c.AttribSchema, models.AttribField{
+			Name:     v.String("name"),
+			Type:     v.String("type"),
+			Required: v.Bool("required"),
+			Default:  v.Get("default"),
+			Options:  v.Strings("options"),
+		})
+	}
 
 	// Static URLS.
 	// url.com/subscription/{campaign_uuid}/{subscriber_uuid}
@@ -403,6 +468,18 @@ func initConstants() *constants {
 	// url.com/subscription/optin/{subscriber_uuid}
 	c.OptinURL = fmt.Sprintf("%s/subscription/optin/%%s?%%s", c.RootURL)
 
+	// url.com/subscription/email/{token}
+	c.EmailChangeURL = fmt.Sprintf("%s/subscription/email/%%s", c.RootURL)
+
+	// url.com/subscription/verify-email/{token}
+	c.EmailVerifyURL = fmt.Sprintf("%s/subscription/verify-email/%%s", c.RootURL)
+
+	// url.com/subscription/renew/{subscriber_uuid}
+	c.RepermissionURL = fmt.Sprintf("%s/subscription/renew/%%s?%%s", c.RootURL)
+
+	// url.com/subscription/preferences/{subscriber_uuid}
+	c.PrefsURL = fmt.Sprintf("%s/subscription/preferences/%%s", c.RootURL)
+
 	// url.com/link/{campaign_uuid}/{subscriber_uuid}/{link_uuid}
 	c.LinkTrackURL = fmt.Sprintf("%s/link/%%s/%%s/%%s", c.RootURL)
 
@@ -459,14 +536,77 @@ func initCampaignManager(q *models.Queries, cs *constants, app *App) *manager.Ma
 		lo.Println("running in passive mode. won't process campaigns.")
 	}
 
+	tz, err := time.LoadLocation(ko.String("app.default_timezone"))
+	if err != nil {
+		lo.Printf("error loading app.default_timezone, using UTC: %v", err)
+		tz = time.UTC
+	}
+
+	// Per recipient domain send rate limits.
+	domLimits := make(map[string]manager.DomainLimit)
+	for _, d := range ko.Slices("app.domain_limits") {
+		dur, err := time.ParseDuration(d.String("duration"))
+		if err != nil {
+			lo.Printf("error parsing rate limit duration of domain %s: %v", d.String("domain"), err)
+			continue
+		}
+		domLimits[d.String("domain")] = manager.DomainLimit{
+			Rate:     d.Int("rate"),
+			Duration: dur,
+		}
+	}
+
+	// Daily volume ramps of the SMTP servers that are being warmed up.
+	warmups := initSMTPWarmups(tz)
+
+	// Per-messenger send quotas.
+	quotas := make(map[string]manager.Quota)
+	for _, q := range ko.Slices("app.messenger_quotas") {
+		quotas[q.String("messenger")] = manager.Quota{
+			Daily:   q.Int("daily"),
+			Monthly: q.Int("monthly"),
+			Refuse:  q.String("action") == models.QuotaActionRefuse,
+		}
+	}
+
+	// Subscriber frequency caps and quiet hours.
+	var (
+		freqCap = manager.FrequencyCap{
+			Daily:  ko.Int("app.frequency_cap_daily"),
+			Weekly: ko.Int("app.frequency_cap_weekly"),
+			Defer:  ko.String("app.frequency_cap_action") == models.FrequencyCapActionDefer,
+		}
+		quiet = manager.QuietHours{
+			Start: ko.String("app.quiet_hours_start"),
+			End:   ko.String("app.quiet_hours_end"),
+		}
+	)
+
+	// Per-messenger message costs.
+	costs := make(map[string]manager.MessageCost)
+	for _, c := range ko.Slices("costs.messengers") {
+		costs[c.String("messenger")] = manager.MessageCost{
+			Cost:       c.Float64("cost"),
+			PerSegment: c.Bool("per_segment"),
+		}
+	}
+
+	// Campaign messages to domains blocklisted after the subscribers were added are skipped.
+	domBlocklisted := func(email string) bool {
+		_, ok := app.importer.MatchBlocklistedDomain(email)
+		return ok
+	}
+
 	return manager.New(manager.Config{
 		BatchSize:             ko.Int("app.batch_size"),
 		Concurrency:           ko.Int("app.concurrency"),
 		MessageRate:           ko.Int("app.message_rate"),
 		MaxSendErrors:         ko.Int("app.max_send_errors"),
+		FailoverErrors:        ko.Int("app.failover_errors"),
 		FromEmail:             cs.FromEmail,
 		IndividualTracking:    ko.Bool("privacy.individual_tracking"),
 		UnsubURL:              cs.UnsubURL,
+		PrefsURL:              cs.PrefsURL,
 		OptinURL:              cs.OptinURL,
 		LinkTrackURL:          cs.LinkTrackURL,
 		ViewTrackURL:          cs.ViewTrackURL,
@@ -474,11 +614,24 @@ func initCampaignManager(q *models.Queries, cs *constants, app *App) *manager.Ma
 		ArchiveURL:            cs.ArchiveURL,
 		RootURL:               cs.RootURL,
 		UnsubHeader:           ko.Bool("privacy.unsubscribe_header"),
+		MaxAttachmentSize:     ko.Int64("app.max_attachment_size") * 1024,
+		AttachmentScanner:     initAttachmentScanner(),
+		DefaultTimezone:       tz,
+		DomainLimits:          domLimits,
+		DomainBlocklisted:     domBlocklisted,
+		SeedEmails:            ko.Strings("app.seed_emails"),
+		Warmups:               warmups,
+		Quotas:                quotas,
+		FrequencyCap:          freqCap,
+		QuietHours:            quiet,
+		Costs:                 costs,
+		DefaultCost:           ko.Float64("costs.default"),
 		SlidingWindow:         ko.Bool("app.message_sliding_window"),
 		SlidingWindowDuration: ko.Duration("app.message_sliding_window_duration"),
 		SlidingWindowRate:     ko.Int("app.message_sliding_window_rate"),
 		ScanInterval:          time.Second * 5,
 		ScanCampaigns:         !ko.Bool("passive"),
+		EventCB:               campaignEventHook(app),
 	}, newManagerStore(q, app.core, app.media), campNotifCB, app.i18n, lo)
 }
 
@@ -498,11 +651,30 @@ func initTxTemplates(m *manager.Manager, app *App) {
 	}
 }
 
+// initTemplatePartials loads the template partials into the manager.
+func initTemplatePartials(m *manager.Manager, app *App) {
+	partials, err := app.core.GetTemplatePartials()
+	if err != nil {
+		lo.Fatalf("error loading template partials: %v", err)
+	}
+
+	m.CachePartials(partials)
+}
+
 // initImporter initializes the bulk subscriber importer.
 func initImporter(q *models.Queries, db *sqlx.DB, core *core.Core, app *App) *subimporter.Importer {
+	// Disposable e-mail domains are only checked if blocking them is enabled.
+	var disposable []string
+	if app.constants.Privacy.BlockDisposableEmails {
+		// Errors are logged by core.
+		disposable, _ = core.GetDisposableDomains()
+	}
+
 	return subimporter.New(
 		subimporter.Options{
 			DomainBlocklist:    app.constants.Privacy.DomainBlocklist,
+			DisposableDomains:  disposable,
+			AttribSchema:       app.constants.AttribSchema,
 			UpsertStmt:         q.UpsertSubscriber.Stmt,
 			BlocklistStmt:      q.UpsertBlocklistSubscriber.Stmt,
 			UpdateListDateStmt: q.UpdateListsDate.Stmt,
@@ -516,8 +688,10 @@ func initImporter(q *models.Queries, db *sqlx.DB, core *core.Core, app *App) *su
 		}, db.DB, app.i18n)
 }
 
-// initSMTPMessenger initializes the SMTP messenger.
-func initSMTPMessenger(m *manager.Manager) manager.Messenger {
+// initSMTPMessengers initializes the default SMTP messenger (email) with all
+// the enabled SMTP servers and an individual messenger (email-$name) for
+// every enabled SMTP server that has a name.
+func initSMTPMessengers(m *manager.Manager) []manager.Messenger {
 	var (
 		mapKeys = ko.MapKeys("smtp")
 		servers = make([]email.Server, 0, len(mapKeys))
@@ -554,7 +728,64 @@ func initSMTPMessenger(m *manager.Manager) manager.Messenger {
 		lo.Fatalf("error loading e-mail messenger: %v", err)
 	}
 
-	return msgr
+	out := []manager.Messenger{msgr}
+	for _, s := range servers {
+		if s.Name == "" {
+			continue
+		}
+
+		name := emailMsgr + "-" + s.Name
+		msgr, err := email.NewNamed(name, s)
+		if err != nil {
+			lo.Fatalf("error loading e-mail messenger %s: %v", name, err)
+		}
+		out = append(out, msgr)
+		lo.Printf("loaded email (SMTP) messenger: %s", name)
+	}
+
+	return out
+}
+
+// initSMTPWarmups returns the daily volume ramps of the enabled SMTP servers
+// that are being warmed up, keyed by the messenger they're sent through. The
+// default messenger (email) is limited to the sum of its servers' volumes only
+// when all of them are being warmed up.
+func initSMTPWarmups(tz *time.Location) map[string][]manager.Warmup {
+	var (
+		out  = make(map[string][]manager.Warmup)
+		pool []manager.Warmup
+		all  = true
+	)
+	for _, item := range ko.Slices("smtp") {
+		if !item.Bool("enabled") {
+			continue
+		}
+
+		sched := item.Ints("warmup.schedule")
+		if !item.Bool("warmup.enabled") || len(sched) == 0 {
+			all = false
+			continue
+		}
+
+		start, err := time.ParseInLocation("2006-01-02", item.String("warmup.start"), tz)
+		if err != nil {
+			lo.Printf("error parsing warm-up start date of SMTP server %s: %v", item.String("host"), err)
+			all = false
+			continue
+		}
+
+		w := manager.Warmup{Start: start, Schedule: sched}
+		pool = append(pool, w)
+		if name := item.String("name"); name != "" {
+			out[emailMsgr+"-"+name] = []manager.Warmup{w}
+		}
+	}
+
+	if all && len(pool) > 0 {
+		out[emailMsgr] = pool
+	}
+
+	return out
 }
 
 // initPostbackMessengers initializes and returns all the enabled
@@ -759,21 +990,10 @@ func initHTTPServer(app *App) *echo.Echo {
 		}
 	})
 
-	tpl, err := stuffbin.ParseTemplatesGlob(initTplFuncs(app.i18n, app.constants), app.fs, "/public/templates/*.html")
-	if err != nil {
-		lo.Fatalf("error parsing public templates: %v", err)
-	}
-	srv.Renderer = &tplRenderer{
-		templates:           tpl,
-		SiteName:            app.constants.SiteName,
-		RootURL:             app.constants.RootURL,
-		LogoURL:             app.constants.LogoURL,
-		FaviconURL:          app.constants.FaviconURL,
-		AssetVersion:        app.constants.AssetVersion,
-		EnablePublicSubPage: app.constants.EnablePublicSubPage,
-		EnablePublicArchive: app.constants.EnablePublicArchive,
-		IndividualTracking:  app.constants.Privacy.IndividualTracking,
-	}
+	// Only tracking requests are served on the alternate tracking domains.
+	srv.Use(trackingDomainsOnly(app))
+
+	srv.Renderer = initPublicTemplates(app)
 
 	// Initialize the static file server.
 	fSrv := app.fs.FileServer()
@@ -812,6 +1032,46 @@ func initCaptcha() *captcha.Captcha {
 	})
 }
 
+// initAttachmentScanner initializes the optional scanner that attachments
+// are scanned with before they're sent.
+func initAttachmentScanner() manager.AttachmentScanner {
+	if !ko.Bool("security.scan_attachments") {
+		return nil
+	}
+
+	s, err := avscan.New(avscan.Opt{
+		Type:    ko.String("security.scan_type"),
+		URL:     ko.String("security.scan_url"),
+		Timeout: ko.Duration("security.scan_timeout"),
+	})
+	if err != nil {
+		lo.Fatalf("error initializing attachment scanner: %v", err)
+	}
+
+	lo.Printf("scanning attachments with %s (%s)", ko.String("security.scan_type"), ko.String("security.scan_url"))
+	return s
+}
+
+// initMJML initializes the optional compiler that MJML templates
+// are compiled to HTML with.
+func initMJML() *mjml.Compiler {
+	if ko.String("app.mjml_url") == "" {
+		return nil
+	}
+
+	c, err := mjml.New(mjml.Opt{
+		URL:      ko.String("app.mjml_url"),
+		Username: ko.String("app.mjml_username"),
+		Password: ko.String("app.mjml_password"),
+		Timeout:  ko.Duration("app.mjml_timeout"),
+	})
+	if err != nil {
+		lo.Fatalf("error initializing MJML compiler: %v", err)
+	}
+
+	return c
+}
+
 func initCron(core *core.Core) {
 	c := cron.New()
 	_, err := c.Add(ko.MustString("app.cache_slow_queries_interval"), func() {
@@ -872,6 +1132,26 @@ func joinFSPaths(root string, paths []string) []string {
 	return out
 }
 
+// initPublicTemplates compiles the public (subscriber facing) page templates.
+func initPublicTemplates(app *App) *tplRenderer {
+	tpl, err := stuffbin.ParseTemplatesGlob(initTplFuncs(app.i18n, app.constants), app.fs, "/public/templates/*.html")
+	if err != nil {
+		lo.Fatalf("error parsing public templates: %v", err)
+	}
+
+	return &tplRenderer{
+		templates:           tpl,
+		SiteName:            app.constants.SiteName,
+		RootURL:             app.constants.RootURL,
+		LogoURL:             app.constants.LogoURL,
+		FaviconURL:          app.constants.FaviconURL,
+		AssetVersion:        app.constants.AssetVersion,
+		EnablePublicSubPage: app.constants.EnablePublicSubPage,
+		EnablePublicArchive: app.constants.EnablePublicArchive,
+		IndividualTracking:  app.constants.Privacy.IndividualTracking,
+	}
+}
+
 func initTplFuncs(i *i18n.I18n, cs *constants) template.FuncMap {
 	funcs := template.FuncMap{
 		"RootURL": func() string {
@@ -9,6 +9,7 @@ import (
 
 	"github.com/gofrs/uuid/v5"
 	"github.com/jmoiron/sqlx"
+	"github.com/knadh/listmonk/internal/subimporter"
 	"github.com/knadh/listmonk/models"
 	"github.com/knadh/stuffbin"
 	"github.com/lib/pq"
@@ -74,6 +75,22 @@ func install(lastVer string, db *sqlx.DB, fs stuffbin.FileSystem, prompt, idempo
 		models.ListOptinSingle,
 		pq.StringArray{"test"},
 		"",
+		"",
+		nil,
+		"",
+		"",
+		"",
+		0,
+		0,
+		0,
+		repermissionGraceDefault,
+		nil,
+		"",
+		"",
+		nil,
+		"",
+		0,
+		optinReminderMaxDefault,
 	); err != nil {
 		lo.Fatalf("error creating list: %v", err)
 	}
@@ -84,6 +101,22 @@ func install(lastVer string, db *sqlx.DB, fs stuffbin.FileSystem, prompt, idempo
 		models.ListOptinDouble,
 		pq.StringArray{"test"},
 		"",
+		"",
+		nil,
+		"",
+		"",
+		"",
+		0,
+		0,
+		0,
+		repermissionGraceDefault,
+		nil,
+		"",
+		"",
+		nil,
+		"",
+		0,
+		optinReminderMaxDefault,
 	); err != nil {
 		lo.Fatalf("error creating list: %v", err)
 	}
@@ -96,7 +129,10 @@ func install(lastVer string, db *sqlx.DB, fs stuffbin.FileSystem, prompt, idempo
 		`{"type": "known", "good": true, "city": "Bengaluru"}`,
 		pq.Int64Array{int64(defList)},
 		models.SubscriptionStatusUnconfirmed,
-		true); err != nil {
+		true,
+		subimporter.StrategyUpsert,
+		"",
+		""); err != nil {
 		lo.Fatalf("Error creating subscriber: %v", err)
 	}
 	if _, err := q.UpsertSubscriber.Exec(
@@ -106,7 +142,10 @@ func install(lastVer string, db *sqlx.DB, fs stuffbin.FileSystem, prompt, idempo
 		`{"type": "unknown", "good": true, "city": "Bengaluru"}`,
 		pq.Int64Array{int64(optinList)},
 		models.SubscriptionStatusUnconfirmed,
-		true); err != nil {
+		true,
+		subimporter.StrategyUpsert,
+		"",
+		""); err != nil {
 		lo.Fatalf("error creating subscriber: %v", err)
 	}
 
@@ -117,7 +156,7 @@ func install(lastVer string, db *sqlx.DB, fs stuffbin.FileSystem, prompt, idempo
 	}
 
 	var campTplID int
-	if err := q.CreateTemplate.Get(&campTplID, "Default campaign template", models.TemplateTypeCampaign, "", campTpl.ReadBytes()); err != nil {
+	if err := q.CreateTemplate.Get(&campTplID, "Default campaign template", models.TemplateTypeCampaign, "", campTpl.ReadBytes(), "", "", "", models.TemplateLangVariants{}); err != nil {
 		lo.Fatalf("error creating default campaign template: %v", err)
 	}
 	if _, err := q.SetDefaultTemplate.Exec(campTplID); err != nil {
@@ -131,7 +170,7 @@ func install(lastVer string, db *sqlx.DB, fs stuffbin.FileSystem, prompt, idempo
 	}
 
 	var archiveTplID int
-	if err := q.CreateTemplate.Get(&archiveTplID, "Default archive template", models.TemplateTypeCampaign, "", archiveTpl.ReadBytes()); err != nil {
+	if err := q.CreateTemplate.Get(&archiveTplID, "Default archive template", models.TemplateTypeCampaign, "", archiveTpl.ReadBytes(), "", "", "", models.TemplateLangVariants{}); err != nil {
 		lo.Fatalf("error creating default campaign template: %v", err)
 	}
 
@@ -162,6 +201,27 @@ func install(lastVer string, db *sqlx.DB, fs stuffbin.FileSystem, prompt, idempo
 		archiveTplID,
 		`{"name": "Subscriber"}`,
 		nil,
+		false,
+		nil,
+		pq.StringArray{},
+		models.ContentBlocks{},
+		models.UTMParams{},
+		"",
+		nil,
+		models.SendWindow{},
+		models.CampaignPriorityDefault,
+		"",
+		models.CampaignArchiveAccessPublic,
+		"",
+		false,
+		models.LangVariants{},
+		models.EngagementRules{},
+		pq.Int64Array{},
+		models.Rollout{},
+		"",
+		"",
+		pq.Int64Array{},
+		pq.StringArray{},
 	); err != nil {
 		lo.Fatalf("error creating sample campaign: %v", err)
 	}
@@ -172,7 +232,7 @@ func install(lastVer string, db *sqlx.DB, fs stuffbin.FileSystem, prompt, idempo
 		lo.Fatalf("error reading default e-mail template: %v", err)
 	}
 
-	if _, err := q.CreateTemplate.Exec("Sample transactional template", models.TemplateTypeTx, "Welcome {{ .Subscriber.Name }}", txTpl.ReadBytes()); err != nil {
+	if _, err := q.CreateTemplate.Exec("Sample transactional template", models.TemplateTypeTx, "Welcome {{ .Subscriber.Name }}", txTpl.ReadBytes(), "", "", "", models.TemplateLangVariants{}); err != nil {
 		lo.Fatalf("error creating sample transactional template: %v", err)
 	}
 
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/knadh/listmonk/internal/subimporter"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"gopkg.in/volatiletech/null.v6"
+)
+
+// Version of the list bundle format.
+const listBundleVersion = 1
+
+// listBundle is a portable export of a list with its settings and subscribers
+// that can be imported into another instance. Templates and excluded lists are
+// referenced by their names and are matched on import.
+type listBundle struct {
+	Version         int                           `json:"version"`
+	List            bundleListSettings            `json:"list"`
+	OptinTemplate   *bundleTemplate               `json:"optin_template"`
+	DefaultTemplate *bundleTemplate               `json:"default_template"`
+	ExcludeLists    []bundleList                  `json:"exclude_lists"`
+	Subscribers     []models.ListBundleSubscriber `json:"subscribers,omitempty"`
+}
+
+type bundleListSettings struct {
+	Name               string   `json:"name"`
+	Type               string   `json:"type"`
+	Optin              string   `json:"optin"`
+	Tags               []string `json:"tags"`
+	Description        string   `json:"description"`
+	TrackingDomain     string   `json:"tracking_domain"`
+	OptinSubject       string   `json:"optin_subject"`
+	OptinFromEmail     string   `json:"optin_from_email"`
+	OptinRedirectURL   string   `json:"optin_redirect_url"`
+	DefaultFromEmail   string   `json:"default_from_email"`
+	DefaultReplyTo     string   `json:"default_reply_to"`
+	DefaultMessenger   string   `json:"default_messenger"`
+	FrequencyCapDaily  int      `json:"frequency_cap_daily"`
+	FrequencyCapWeekly int      `json:"frequency_cap_weekly"`
+	SubscriptionTTL    int      `json:"subscription_ttl"`
+	RepermissionGrace  int      `json:"repermission_grace"`
+	OptinReminderDays  int      `json:"optin_reminder_days"`
+	OptinReminderMax   int      `json:"optin_reminder_max"`
+	Query              string   `json:"query"`
+}
+
+// listBundleImport is a list bundle import request. Name, if set, is the name
+// of the new list instead of the one in the bundle.
+type listBundleImport struct {
+	Bundle listBundle `json:"bundle"`
+	Name   string     `json:"name"`
+}
+
+// handleExportListBundle exports a list with its settings and subscribers as a
+// JSON bundle. The subscribers are streamed in batches. The subscribers of
+// dynamic lists aren't exported as they're materialized from the list's query.
+func handleExportListBundle(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	l, err := app.core.GetList(id, "")
+	if err != nil {
+		return err
+	}
+
+	b := listBundle{
+		Version: listBundleVersion,
+		List: bundleListSettings{
+			Name:               l.Name,
+			Type:               l.Type,
+			Optin:              l.Optin,
+			Tags:               l.Tags,
+			Description:        l.Description,
+			TrackingDomain:     l.TrackingDomain,
+			OptinSubject:       l.OptinSubject,
+			OptinFromEmail:     l.OptinFromEmail,
+			OptinRedirectURL:   l.OptinRedirectURL,
+			DefaultFromEmail:   l.DefaultFromEmail,
+			DefaultReplyTo:     l.DefaultReplyTo,
+			DefaultMessenger:   l.DefaultMessenger,
+			FrequencyCapDaily:  l.FrequencyCapDaily,
+			FrequencyCapWeekly: l.FrequencyCapWeekly,
+			SubscriptionTTL:    l.SubscriptionTTL,
+			RepermissionGrace:  l.RepermissionGrace,
+			OptinReminderDays:  l.OptinReminderDays,
+			OptinReminderMax:   l.OptinReminderMax,
+			Query:              l.Query,
+		},
+		ExcludeLists: []bundleList{},
+	}
+
+	if b.OptinTemplate, err = getBundleTemplate(l.OptinTemplateID.Int, app); err != nil {
+		return err
+	}
+	if b.DefaultTemplate, err = getBundleTemplate(l.DefaultTemplateID.Int, app); err != nil {
+		return err
+	}
+
+	if len(l.ExcludeListIDs) > 0 {
+		lists, err := app.core.GetListsByOptin(int64sToInts(l.ExcludeListIDs), "")
+		if err != nil {
+			return err
+		}
+		for _, e := range lists {
+			b.ExcludeLists = append(b.ExcludeLists, bundleList{ID: e.ID, Name: e.Name})
+		}
+	}
+
+	// The bundle without the subscribers, which are written after it.
+	hdr, err := json.Marshal(b)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	h := c.Response().Header()
+	h.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	h.Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=list-%d.json", l.ID))
+	h.Set("Cache-Control", "no-cache")
+	c.Response().WriteHeader(http.StatusOK)
+
+	w := c.Response()
+	w.Write(hdr[:len(hdr)-1])
+	w.Write([]byte(`,"subscribers":[`))
+
+	afterID, n := 0, 0
+	for l.Type != models.ListTypeDynamic {
+		subs, err := app.core.GetListBundleSubscribers(l.ID, afterID, app.constants.DBBatchSize)
+		if err != nil || len(subs) == 0 {
+			break
+		}
+
+		for _, s := range subs {
+			r, err := json.Marshal(s)
+			if err != nil {
+				app.log.Printf("error encoding list bundle subscriber: %v", err)
+				continue
+			}
+			if n > 0 {
+				w.Write([]byte(","))
+			}
+			if _, err := w.Write(r); err != nil {
+				app.log.Printf("error streaming list bundle: %v", err)
+				return nil
+			}
+			n++
+		}
+		afterID = subs[len(subs)-1].ID
+		w.Flush()
+	}
+
+	w.Write([]byte("]}"))
+	return nil
+}
+
+// handleImportListBundle creates a list from a list bundle and imports its
+// subscribers. Subscribers that already exist are subscribed to the new list
+// as they are, and subscribers with invalid fields are skipped.
+func handleImportListBundle(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		req listBundleImport
+	)
+
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	b := req.Bundle
+	if b.Version != listBundleVersion {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			app.i18n.Ts("lists.bundleInvalidVersion", "version", strconv.Itoa(b.Version)))
+	}
+
+	l, err := makeBundleList(b, strings.TrimSpace(req.Name), app)
+	if err != nil {
+		return err
+	}
+
+	list, err := app.core.CreateList(l)
+	if err != nil {
+		return err
+	}
+
+	// Import the subscribers in batches.
+	var (
+		res  models.ListBundleImportResult
+		seen = make(map[string]bool, len(b.Subscribers))
+	)
+	for i := 0; i < len(b.Subscribers); i += app.constants.DBBatchSize {
+		end := i + app.constants.DBBatchSize
+		if end > len(b.Subscribers) {
+			end = len(b.Subscribers)
+		}
+		batch := b.Subscribers[i:end]
+
+		subs := make([]models.ListBundleSubscriber, 0, len(batch))
+		for _, s := range batch {
+			s, err := validateBundleSubscriber(s, list.Optin, app)
+			if err != nil || seen[s.Email] {
+				res.Skipped++
+				continue
+			}
+			seen[s.Email] = true
+			subs = append(subs, s)
+		}
+		if len(subs) == 0 {
+			continue
+		}
+
+		r, err := app.core.ImportListBundleSubscribers(list.ID, subs)
+		if err != nil {
+			return err
+		}
+		res.Created += r.Created
+		res.Subscribed += r.Subscribed
+	}
+
+	if list, err = app.core.GetList(list.ID, ""); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{struct {
+		List models.List `json:"list"`
+		models.ListBundleImportResult
+	}{list, res}})
+}
+
+// makeBundleList returns the list of a list bundle with its templates and
+// excluded lists mapped to the ones in this instance. Templates that don't exist
+// are created. Settings that don't apply to this instance, eg: a tracking domain
+// or messenger that isn't configured, and unmatched excluded lists are dropped.
+func makeBundleList(b listBundle, name string, app *App) (models.List, error) {
+	s := b.List
+	if name == "" {
+		name = s.Name
+	}
+	if !strHasLen(name, 1, stdInputMaxLen) {
+		return models.List{}, echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("lists.invalidName"))
+	}
+	if s.Type != "" && !inArray(s.Type, []string{models.ListTypePrivate, models.ListTypePublic, models.ListTypeDynamic}) {
+		return models.List{}, echo.NewHTTPError(http.StatusBadRequest,
+			app.i18n.Ts("globals.messages.invalidFields", "name", "type"))
+	}
+	if s.Optin != "" && !inArray(s.Optin, []string{models.ListOptinSingle, models.ListOptinDouble}) {
+		return models.List{}, echo.NewHTTPError(http.StatusBadRequest,
+			app.i18n.Ts("globals.messages.invalidFields", "name", "optin"))
+	}
+
+	l := models.List{
+		Name:               name,
+		Type:               s.Type,
+		Optin:              s.Optin,
+		Tags:               pq.StringArray(s.Tags),
+		Description:        s.Description,
+		OptinSubject:       s.OptinSubject,
+		OptinFromEmail:     s.OptinFromEmail,
+		OptinRedirectURL:   s.OptinRedirectURL,
+		DefaultFromEmail:   s.DefaultFromEmail,
+		DefaultReplyTo:     s.DefaultReplyTo,
+		FrequencyCapDaily:  s.FrequencyCapDaily,
+		FrequencyCapWeekly: s.FrequencyCapWeekly,
+		SubscriptionTTL:    s.SubscriptionTTL,
+		RepermissionGrace:  s.RepermissionGrace,
+		OptinReminderDays:  s.OptinReminderDays,
+		OptinReminderMax:   s.OptinReminderMax,
+		Query:              s.Query,
+	}
+	if l.FrequencyCapDaily < 0 || l.FrequencyCapWeekly < 0 {
+		return models.List{}, echo.NewHTTPError(http.StatusBadRequest,
+			app.i18n.Ts("globals.messages.invalidFields", "name", "frequency_cap"))
+	}
+	if l.RepermissionGrace == 0 {
+		l.RepermissionGrace = repermissionGraceDefault
+	}
+	if l.SubscriptionTTL < 0 || l.RepermissionGrace < 0 {
+		return models.List{}, echo.NewHTTPError(http.StatusBadRequest,
+			app.i18n.Ts("globals.messages.invalidFields", "name", "subscription_ttl"))
+	}
+	if inArray(s.TrackingDomain, app.constants.Privacy.TrackingDomains) {
+		l.TrackingDomain = s.TrackingDomain
+	}
+	if s.DefaultMessenger != "" && app.manager.HasMessenger(s.DefaultMessenger) {
+		l.DefaultMessenger = s.DefaultMessenger
+	}
+	if l.Type == models.ListTypeDynamic {
+		l.Optin = models.ListOptinSingle
+	}
+
+	if b.OptinTemplate != nil && b.OptinTemplate.Type == models.TemplateTypeTx {
+		id, err := importBundleTemplate(b.OptinTemplate, app)
+		if err != nil {
+			return models.List{}, err
+		}
+		l.OptinTemplateID = null.IntFrom(id)
+	}
+	if b.DefaultTemplate != nil && b.DefaultTemplate.Type == models.TemplateTypeCampaign {
+		id, err := importBundleTemplate(b.DefaultTemplate, app)
+		if err != nil {
+			return models.List{}, err
+		}
+		l.DefaultTemplateID = null.IntFrom(id)
+	}
+
+	if len(b.ExcludeLists) > 0 {
+		all, err := app.core.GetLists("")
+		if err != nil {
+			return models.List{}, err
+		}
+		for _, e := range b.ExcludeLists {
+			for _, a := range all {
+				if a.Name == e.Name {
+					l.ExcludeListIDs = append(l.ExcludeListIDs, int64(a.ID))
+					break
+				}
+			}
+		}
+	}
+
+	l, err := validateListOptin(l, app)
+	if err != nil {
+		return models.List{}, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if l, err = validateListDefaults(l, app); err != nil {
+		return models.List{}, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if l, err = validateListExclusions(0, l, app); err != nil {
+		return models.List{}, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return l, nil
+}
+
+// validateBundleSubscriber validates and sanitizes a subscriber of a list
+// bundle. Subscriptions without a status are unconfirmed on double opt-in
+// lists and confirmed otherwise.
+func validateBundleSubscriber(s models.ListBundleSubscriber, optin string, app *App) (models.ListBundleSubscriber, error) {
+	sub, err := app.importer.ValidateFields(subimporter.SubReq{
+		Subscriber: models.Subscriber{Email: s.Email, Name: s.Name, Locale: s.Locale, Timezone: s.Timezone},
+	})
+	if err != nil {
+		return s, err
+	}
+	s.Email, s.Name, s.Locale, s.Timezone = sub.Email, sub.Name, sub.Locale, sub.Timezone
+
+	if s.Attribs, err = app.importer.ValidateAttribs(s.Attribs); err != nil {
+		return s, err
+	}
+	tags, err := sanitizeTags(s.Tags)
+	if err != nil {
+		return s, err
+	}
+	s.Tags = tags
+
+	if s.Status == "" {
+		s.Status = models.SubscriberStatusEnabled
+	}
+	if !inArray(s.Status, []string{models.SubscriberStatusEnabled, models.SubscriberStatusDisabled, models.SubscriberStatusBlockListed}) {
+		return s, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "status"))
+	}
+
+	if s.SubscriptionStatus == "" {
+		s.SubscriptionStatus = models.SubscriptionStatusConfirmed
+		if optin == models.ListOptinDouble {
+			s.SubscriptionStatus = models.SubscriptionStatusUnconfirmed
+		}
+	}
+	if !inArray(s.SubscriptionStatus, []string{models.SubscriptionStatusUnconfirmed, models.SubscriptionStatusConfirmed, models.SubscriptionStatusUnsubscribed}) {
+		return s, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "subscription_status"))
+	}
+
+	return s, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// handleGetListFolders handles retrieval of list folders.
+func handleGetListFolders(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	// Fetch one folder.
+	if id > 0 {
+		out, err := app.core.GetListFolder(id)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, okResp{out})
+	}
+
+	out, err := app.core.GetListFolders()
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleCreateListFolder handles list folder creation.
+func handleCreateListFolder(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		f   = models.ListFolder{}
+	)
+
+	if err := c.Bind(&f); err != nil {
+		return err
+	}
+
+	f, err := validateListFolder(f, app)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	out, err := app.core.CreateListFolder(f)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleUpdateListFolder handles renaming a list folder or moving it to
+// another parent folder.
+func handleUpdateListFolder(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	f, err := app.core.GetListFolder(id)
+	if err != nil {
+		return err
+	}
+
+	if err := c.Bind(&f); err != nil {
+		return err
+	}
+
+	f, err = validateListFolder(f, app)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	out, err := app.core.UpdateListFolder(id, f)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleDeleteListFolder handles list folder deletion.
+func handleDeleteListFolder(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	if err := app.core.DeleteListFolder(id); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// validateListFolder validates the name and the optional parent of a list folder.
+func validateListFolder(f models.ListFolder, app *App) (models.ListFolder, error) {
+	f.Name = strings.TrimSpace(f.Name)
+	if !strHasLen(f.Name, 1, stdInputMaxLen) {
+		return f, errors.New(app.i18n.T("lists.invalidName"))
+	}
+
+	if f.ParentID.Valid {
+		if _, err := app.core.GetListFolder(f.ParentID.Int); err != nil {
+			return f, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "parent_id"))
+		}
+	}
+
+	return f, nil
+}
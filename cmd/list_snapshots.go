@@ -0,0 +1,28 @@
+package main
+
+import (
+	"time"
+)
+
+// Interval at which the day's list subscriber snapshots are recorded. Every
+// run overwrites the day's counts, so the last run of a day records its closing counts.
+const listSnapshotInterval = time.Hour
+
+// recordListSnapshots records the subscriber counts of every list for the
+// current day in the default timezone at startup and periodically thereafter.
+func recordListSnapshots(interval time.Duration, app *App) {
+	tz, err := time.LoadLocation(ko.String("app.default_timezone"))
+	if err != nil {
+		tz = time.UTC
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := app.core.RecordListSnapshots(time.Now().In(tz)); err != nil {
+			app.log.Printf("error recording list snapshots: %v", err)
+		}
+		<-ticker.C
+	}
+}
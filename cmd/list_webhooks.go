@@ -0,0 +1,279 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/knadh/listmonk/internal/webhook"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"gopkg.in/volatiletech/null.v6"
+)
+
+// Subscription events of lists that list webhooks can be subscribed to. They're
+// recorded by the list_events_trigger() in the DB.
+const (
+	listEventSubscribed   = "list.subscribed"
+	listEventConfirmed    = "list.confirmed"
+	listEventUnsubscribed = "list.unsubscribed"
+)
+
+var listWebhookEvents = []string{listEventSubscribed, listEventConfirmed, listEventUnsubscribed}
+
+const (
+	// Interval at which the recorded list events are dispatched to the list webhooks.
+	listEventsInterval = time.Second * 5
+
+	// Max number of list events that are fetched and dispatched at once.
+	listEventsBatchSize = 500
+)
+
+type listWebhookReq struct {
+	URL     string   `json:"url"`
+	Events  []string `json:"events"`
+	Secret  string   `json:"secret"`
+	Enabled bool     `json:"enabled"`
+}
+
+// listEvent is the data in the payload of list webhook events with the list
+// and the subscriber whose subscription to it changed.
+type listEvent struct {
+	List       listEventList `json:"list"`
+	Subscriber listEventSub  `json:"subscriber"`
+	CreatedAt  null.Time     `json:"created_at"`
+}
+
+type listEventList struct {
+	ID   int    `json:"id"`
+	UUID string `json:"uuid"`
+	Name string `json:"name"`
+}
+
+type listEventSub struct {
+	ID      int         `json:"id"`
+	UUID    string      `json:"uuid"`
+	Email   string      `json:"email"`
+	Name    string      `json:"name"`
+	Attribs models.JSON `json:"attribs"`
+	Status  string      `json:"status"`
+}
+
+// handleGetListWebhooks retrieves the webhooks of a list with their secrets masked.
+func handleGetListWebhooks(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	out, err := app.core.GetListWebhooks([]int{id}, false)
+	if err != nil {
+		return err
+	}
+
+	for i := range out {
+		out[i] = maskListWebhook(out[i])
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleCreateListWebhook creates a webhook on a list.
+func handleCreateListWebhook(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	// Webhooks are enabled unless they're explicitly disabled.
+	req := listWebhookReq{Enabled: true}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	h, err := validateListWebhook(req, app)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	h.ListID = id
+
+	out, err := app.core.CreateListWebhook(h)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{maskListWebhook(out)})
+}
+
+// handleUpdateListWebhook updates a list's webhook. An empty or masked secret
+// retains the existing one.
+func handleUpdateListWebhook(c echo.Context) error {
+	var (
+		app       = c.Get("app").(*App)
+		id, _     = strconv.Atoi(c.Param("id"))
+		hookID, _ = strconv.Atoi(c.Param("hookID"))
+	)
+
+	if id < 1 || hookID < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	var req listWebhookReq
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	h, err := validateListWebhook(req, app)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	h.ID = hookID
+	h.ListID = id
+
+	out, err := app.core.UpdateListWebhook(h)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{maskListWebhook(out)})
+}
+
+// handleDeleteListWebhook deletes a list's webhook.
+func handleDeleteListWebhook(c echo.Context) error {
+	var (
+		app       = c.Get("app").(*App)
+		id, _     = strconv.Atoi(c.Param("id"))
+		hookID, _ = strconv.Atoi(c.Param("hookID"))
+	)
+
+	if id < 1 || hookID < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	if err := app.core.DeleteListWebhook(id, hookID); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// dispatchListEvents periodically dispatches the recorded subscription events
+// of lists to their enabled webhooks.
+func dispatchListEvents(interval time.Duration, app *App) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		// Keep going while there are full batches of events.
+		for {
+			n, err := dispatchListEventsBatch(app)
+			if err != nil || n < listEventsBatchSize {
+				break
+			}
+		}
+	}
+}
+
+// dispatchListEventsBatch dispatches the next batch of list events and
+// returns the number of events in it.
+func dispatchListEventsBatch(app *App) (int, error) {
+	events, err := app.core.NextListEvents(listEventsBatchSize)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+
+	// Get the enabled webhooks of all the lists in the batch.
+	var (
+		listIDs = []int{}
+		seen    = map[int]bool{}
+	)
+	for _, e := range events {
+		if !seen[e.ListID] {
+			listIDs = append(listIDs, e.ListID)
+			seen[e.ListID] = true
+		}
+	}
+
+	res, err := app.core.GetListWebhooks(listIDs, true)
+	if err != nil {
+		return 0, err
+	}
+
+	hooks := make(map[int][]webhook.Hook, len(listIDs))
+	for _, h := range res {
+		hooks[h.ListID] = append(hooks[h.ListID], webhook.Hook{
+			URL:    h.URL,
+			Events: h.Events,
+			Secret: h.Secret,
+		})
+	}
+
+	for _, e := range events {
+		if len(hooks[e.ListID]) == 0 {
+			continue
+		}
+
+		ev := listEvent{
+			List: listEventList{ID: e.ListID, UUID: e.ListUUID, Name: e.ListName},
+			Subscriber: listEventSub{
+				ID:      e.SubscriberID,
+				UUID:    e.SubscriberUUID,
+				Email:   e.Email,
+				Name:    e.Name,
+				Attribs: e.Attribs,
+				Status:  e.Status,
+			},
+			CreatedAt: e.CreatedAt,
+		}
+
+		app.webhooks.DispatchTo(hooks[e.ListID], e.Event, ev)
+	}
+
+	return len(events), nil
+}
+
+func validateListWebhook(req listWebhookReq, app *App) (models.ListWebhook, error) {
+	h := models.ListWebhook{
+		URL:     strings.TrimSpace(req.URL),
+		Events:  req.Events,
+		Enabled: req.Enabled,
+	}
+
+	if u, err := url.Parse(h.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return h, errors.New(app.i18n.Ts("settings.webhooks.invalidURL", "name", h.URL))
+	}
+
+	for _, e := range h.Events {
+		if !strSliceContains(e, listWebhookEvents) {
+			return h, errors.New(app.i18n.Ts("settings.webhooks.invalidEvent", "name", e))
+		}
+	}
+	if h.Events == nil {
+		h.Events = []string{}
+	}
+
+	// A masked secret is the existing one that's sent back unchanged.
+	if strings.Trim(req.Secret, pwdMask) != "" {
+		h.Secret = req.Secret
+	}
+
+	return h, nil
+}
+
+// maskListWebhook masks the secret of a list webhook for API responses.
+func maskListWebhook(h models.ListWebhook) models.ListWebhook {
+	h.Secret = strings.Repeat(pwdMask, utf8.RuneCountInString(h.Secret))
+	return h
+}
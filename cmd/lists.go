@@ -1,14 +1,41 @@
 package main
 
 import (
+	"errors"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/knadh/listmonk/models"
 	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
 )
 
+const (
+	listStatsDaysDefault = 30
+	listStatsDaysMax     = 365
+
+	// Interval at which the subscriptions of dynamic lists are refreshed.
+	dynamicListRefreshInterval = time.Minute * 10
+)
+
+var (
+	// Rules for the status of subscribers on both lists of a merge, and what's
+	// done with the merged list.
+	listMergeRules         = []string{"target", "source", "confirmed", "unsubscribed"}
+	listMergeSourceActions = []string{"archive", "delete"}
+)
+
+// listMergeReq is the request to merge a list into another one.
+type listMergeReq struct {
+	SourceID     int    `json:"source_id"`
+	StatusRule   string `json:"status_rule"`
+	SourceAction string `json:"source_action"`
+	DryRun       bool   `json:"dry_run"`
+}
+
 // handleGetLists retrieves lists with additional metadata like subscriber counts. This may be slow.
 func handleGetLists(c echo.Context) error {
 	var (
@@ -24,6 +51,10 @@ func handleGetLists(c echo.Context) error {
 		minimal, _ = strconv.ParseBool(c.FormValue("minimal"))
 		listID, _  = strconv.Atoi(c.Param("id"))
 
+		// Lists in a folder, where 0 is lists that aren't in any folder.
+		folderID      = -1
+		subfolders, _ = strconv.ParseBool(c.FormValue("subfolders"))
+
 		out models.PageResults
 	)
 
@@ -60,8 +91,17 @@ func handleGetLists(c echo.Context) error {
 		return c.JSON(http.StatusOK, okResp{out})
 	}
 
+	if v := c.FormValue("folder_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 0 {
+			return echo.NewHTTPError(http.StatusBadRequest,
+				app.i18n.Ts("globals.messages.invalidFields", "name", "folder_id"))
+		}
+		folderID = id
+	}
+
 	// Full list query.
-	res, total, err := app.core.QueryLists(query, typ, optin, tags, orderBy, order, pg.Offset, pg.Limit)
+	res, total, err := app.core.QueryLists(query, typ, optin, tags, folderID, subfolders, orderBy, order, pg.Offset, pg.Limit)
 	if err != nil {
 		return err
 	}
@@ -84,6 +124,71 @@ func handleGetLists(c echo.Context) error {
 	return c.JSON(http.StatusOK, okResp{out})
 }
 
+// handleGetListSnapshots returns the daily subscriber counts of the given lists,
+// or all lists, between the given days, which default to the last 30 days.
+func handleGetListSnapshots(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+	)
+
+	listIDs, err := getQueryInts("list_id", c.QueryParams())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	to := time.Now()
+	if v := c.QueryParam("to"); v != "" {
+		if to, err = time.Parse("2006-01-02", v); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "to"))
+		}
+	}
+
+	from := to.AddDate(0, 0, -30)
+	if v := c.QueryParam("from"); v != "" {
+		if from, err = time.Parse("2006-01-02", v); err != nil || from.After(to) {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "from"))
+		}
+	}
+
+	out, err := app.core.GetListSnapshots(listIDs, from, to)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleGetListStats returns the growth, churn, confirmation rate, and the
+// engagement of the campaigns of a list in the last given number of days.
+func handleGetListStats(c echo.Context) error {
+	var (
+		app     = c.Get("app").(*App)
+		id, _   = strconv.Atoi(c.Param("id"))
+		days, _ = strconv.Atoi(c.QueryParam("days"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	if days < 1 {
+		days = listStatsDaysDefault
+	} else if days > listStatsDaysMax {
+		days = listStatsDaysMax
+	}
+
+	if _, err := app.core.GetList(id, ""); err != nil {
+		return err
+	}
+
+	out, err := app.core.GetListStats(id, days)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
 // handleCreateList handles list creation.
 func handleCreateList(c echo.Context) error {
 	var (
@@ -99,6 +204,44 @@ func handleCreateList(c echo.Context) error {
 	if !strHasLen(l.Name, 1, stdInputMaxLen) {
 		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("lists.invalidName"))
 	}
+	l.TrackingDomain = strings.TrimRight(strings.TrimSpace(l.TrackingDomain), "/")
+	if l.TrackingDomain != "" && !inArray(l.TrackingDomain, app.constants.Privacy.TrackingDomains) {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			app.i18n.Ts("globals.messages.invalidFields", "name", "tracking_domain"))
+	}
+	if l.FrequencyCapDaily < 0 || l.FrequencyCapWeekly < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			app.i18n.Ts("globals.messages.invalidFields", "name", "frequency_cap"))
+	}
+	if l.RepermissionGrace == 0 {
+		l.RepermissionGrace = repermissionGraceDefault
+	}
+	if l.SubscriptionTTL < 0 || l.RepermissionGrace < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			app.i18n.Ts("globals.messages.invalidFields", "name", "subscription_ttl"))
+	}
+	if l.FolderID.Valid {
+		if _, err := app.core.GetListFolder(l.FolderID.Int); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest,
+				app.i18n.Ts("globals.messages.invalidFields", "name", "folder_id"))
+		}
+	}
+	// Dynamic lists' subscriptions are confirmed as they're materialized.
+	if l.Type == models.ListTypeDynamic {
+		l.Optin = models.ListOptinSingle
+	}
+	l, err := validateListOptin(l, app)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	l, err = validateListDefaults(l, app)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	l, err = validateListExclusions(0, l, app)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
 
 	out, err := app.core.CreateList(l)
 	if err != nil {
@@ -129,6 +272,44 @@ func handleUpdateList(c echo.Context) error {
 	if !strHasLen(l.Name, 1, stdInputMaxLen) {
 		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("lists.invalidName"))
 	}
+	l.TrackingDomain = strings.TrimRight(strings.TrimSpace(l.TrackingDomain), "/")
+	if l.TrackingDomain != "" && !inArray(l.TrackingDomain, app.constants.Privacy.TrackingDomains) {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			app.i18n.Ts("globals.messages.invalidFields", "name", "tracking_domain"))
+	}
+	if l.FrequencyCapDaily < 0 || l.FrequencyCapWeekly < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			app.i18n.Ts("globals.messages.invalidFields", "name", "frequency_cap"))
+	}
+	if l.RepermissionGrace == 0 {
+		l.RepermissionGrace = repermissionGraceDefault
+	}
+	if l.SubscriptionTTL < 0 || l.RepermissionGrace < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			app.i18n.Ts("globals.messages.invalidFields", "name", "subscription_ttl"))
+	}
+	if l.FolderID.Valid {
+		if _, err := app.core.GetListFolder(l.FolderID.Int); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest,
+				app.i18n.Ts("globals.messages.invalidFields", "name", "folder_id"))
+		}
+	}
+	// Dynamic lists' subscriptions are confirmed as they're materialized.
+	if l.Type == models.ListTypeDynamic {
+		l.Optin = models.ListOptinSingle
+	}
+	l, err := validateListOptin(l, app)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	l, err = validateListDefaults(l, app)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	l, err = validateListExclusions(id, l, app)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
 
 	out, err := app.core.UpdateList(id, l)
 	if err != nil {
@@ -160,3 +341,225 @@ func handleDeleteLists(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, okResp{true})
 }
+
+// handleArchiveList handles archiving of a list.
+func handleArchiveList(c echo.Context) error {
+	return archiveList(c, true)
+}
+
+// handleUnarchiveList handles unarchiving of a list.
+func handleUnarchiveList(c echo.Context) error {
+	return archiveList(c, false)
+}
+
+// archiveList archives or unarchives the list in the request.
+func archiveList(c echo.Context, archive bool) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	out, err := app.core.ArchiveList(id, archive)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleMergeLists handles merging of a list into the list in the request. The
+// merged list is archived or deleted after its subscriptions and campaigns are
+// moved. With dry_run, the changes that the merge would make are returned.
+func handleMergeLists(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	var req listMergeReq
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	if req.SourceID < 1 || req.SourceID == id {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "source_id"))
+	}
+	if req.StatusRule == "" {
+		req.StatusRule = listMergeRules[0]
+	}
+	if !inArray(req.StatusRule, listMergeRules) {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "status_rule"))
+	}
+	if req.SourceAction == "" {
+		req.SourceAction = listMergeSourceActions[0]
+	}
+	if !inArray(req.SourceAction, listMergeSourceActions) {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "source_action"))
+	}
+
+	target, err := app.core.GetList(id, "")
+	if err != nil {
+		return err
+	}
+	if target.Archived {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("lists.mergeArchived"))
+	}
+	if _, err := app.core.GetList(req.SourceID, ""); err != nil {
+		return err
+	}
+
+	out, err := app.core.MergeLists(id, req.SourceID, req.StatusRule, req.DryRun)
+	if err != nil {
+		return err
+	}
+	out.SourceAction = req.SourceAction
+
+	if req.DryRun {
+		return c.JSON(http.StatusOK, okResp{out})
+	}
+
+	if req.SourceAction == "delete" {
+		err = app.core.DeleteList(req.SourceID)
+	} else {
+		_, err = app.core.ArchiveList(req.SourceID, true)
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// refreshDynamicLists is a blocking function that refreshes the subscriptions
+// of dynamic lists at the given intervals.
+func refreshDynamicLists(interval time.Duration, app *App) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		lists, err := app.core.GetDynamicLists(0)
+		if err != nil {
+			continue
+		}
+
+		for _, l := range lists {
+			if err := app.core.RefreshDynamicList(l); err != nil {
+				app.log.Printf("error refreshing dynamic list (%s): %v", l.Name, err)
+			}
+		}
+	}
+}
+
+// validateListOptin validates the optional double opt-in e-mail template,
+// subject, sender, redirect URL, and reminders of a list.
+func validateListOptin(l models.List, app *App) (models.List, error) {
+	if l.OptinTemplateID.Valid {
+		tpl, err := app.core.GetTemplate(l.OptinTemplateID.Int, true)
+		if err != nil || tpl.Type != models.TemplateTypeTx {
+			return l, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "optin_template_id"))
+		}
+	}
+
+	l.OptinSubject = strings.TrimSpace(l.OptinSubject)
+	if len(l.OptinSubject) > stdInputMaxLen {
+		return l, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "optin_subject"))
+	}
+
+	l.OptinFromEmail = strings.TrimSpace(l.OptinFromEmail)
+	if l.OptinFromEmail != "" && !regexFromAddress.Match([]byte(l.OptinFromEmail)) {
+		if _, err := app.importer.SanitizeEmail(l.OptinFromEmail); err != nil {
+			return l, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "optin_from_email"))
+		}
+	}
+
+	l.OptinRedirectURL = strings.TrimSpace(l.OptinRedirectURL)
+	if l.OptinRedirectURL != "" {
+		if u, err := url.Parse(l.OptinRedirectURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return l, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "optin_redirect_url"))
+		}
+	}
+
+	if l.OptinReminderMax == 0 {
+		l.OptinReminderMax = optinReminderMaxDefault
+	}
+	if l.OptinReminderDays < 0 || l.OptinReminderDays > optinReminderMaxDays {
+		return l, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "optin_reminder_days"))
+	}
+	if l.OptinReminderMax < 0 || l.OptinReminderMax > optinReminderMaxCount {
+		return l, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "optin_reminder_max"))
+	}
+
+	return l, nil
+}
+
+// validateListDefaults validates the optional sender, Reply-To, template,
+// and messenger of a list's campaigns and e-mails.
+func validateListDefaults(l models.List, app *App) (models.List, error) {
+	l.DefaultFromEmail = strings.TrimSpace(l.DefaultFromEmail)
+	if l.DefaultFromEmail != "" && !regexFromAddress.Match([]byte(l.DefaultFromEmail)) {
+		if _, err := app.importer.SanitizeEmail(l.DefaultFromEmail); err != nil {
+			return l, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "default_from_email"))
+		}
+	}
+
+	l.DefaultReplyTo = strings.TrimSpace(l.DefaultReplyTo)
+	if l.DefaultReplyTo != "" && !regexFromAddress.Match([]byte(l.DefaultReplyTo)) {
+		if _, err := app.importer.SanitizeEmail(l.DefaultReplyTo); err != nil {
+			return l, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "default_reply_to"))
+		}
+	}
+
+	if l.DefaultTemplateID.Valid {
+		tpl, err := app.core.GetTemplate(l.DefaultTemplateID.Int, true)
+		if err != nil || tpl.Type != models.TemplateTypeCampaign {
+			return l, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "default_template_id"))
+		}
+	}
+
+	l.DefaultMessenger = strings.TrimSpace(l.DefaultMessenger)
+	if l.DefaultMessenger != "" && !app.manager.HasMessenger(l.DefaultMessenger) {
+		return l, errors.New(app.i18n.Ts("campaigns.fieldInvalidMessenger", "name", l.DefaultMessenger))
+	}
+
+	return l, nil
+}
+
+// validateListExclusions validates the lists excluded by the list with the
+// given ID (0 for a new list), which have to exist and can't be the list itself.
+func validateListExclusions(id int, l models.List, app *App) (models.List, error) {
+	var (
+		excl = make(pq.Int64Array, 0, len(l.ExcludeListIDs))
+		seen = make(map[int64]bool, len(l.ExcludeListIDs))
+	)
+	for _, x := range l.ExcludeListIDs {
+		if x < 1 || x == int64(id) {
+			return l, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "exclude_list_ids"))
+		}
+		if !seen[x] {
+			seen[x] = true
+			excl = append(excl, x)
+		}
+	}
+	l.ExcludeListIDs = excl
+
+	if len(excl) == 0 {
+		return l, nil
+	}
+	lists, err := app.core.GetListsByOptin(int64sToInts(excl), "")
+	if err != nil {
+		return l, err
+	}
+	if len(lists) != len(excl) {
+		return l, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "exclude_list_ids"))
+	}
+
+	return l, nil
+}
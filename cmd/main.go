@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"sync"
 	"syscall"
@@ -23,7 +24,9 @@ import (
 	"github.com/knadh/listmonk/internal/i18n"
 	"github.com/knadh/listmonk/internal/manager"
 	"github.com/knadh/listmonk/internal/media"
+	"github.com/knadh/listmonk/internal/mjml"
 	"github.com/knadh/listmonk/internal/subimporter"
+	"github.com/knadh/listmonk/internal/webhook"
 	"github.com/knadh/listmonk/models"
 	"github.com/knadh/paginator"
 	"github.com/knadh/stuffbin"
@@ -49,7 +52,9 @@ type App struct {
 	bounce     *bounce.Manager
 	paginator  *paginator.Paginator
 	captcha    *captcha.Captcha
+	mjml       *mjml.Compiler
 	events     *events.Events
+	webhooks   *webhook.Dispatcher
 	notifTpls  *notifTpls
 	about      about
 	log        *log.Logger
@@ -64,6 +69,15 @@ type App struct {
 
 	// Global state that stores data on an available remote update.
 	update *AppUpdate
+
+	// Stop signals of the campaign dry runs that are running, by campaign ID.
+	simulations map[int]chan struct{}
+
+	// Stop signals of the bulk subscriber jobs that are running, by job ID.
+	subscriberJobs map[int]chan struct{}
+
+	// CRM syncs that are running, by sync ID.
+	crmSyncs map[int]bool
 	sync.Mutex
 }
 
@@ -174,8 +188,13 @@ func main() {
 		log:        lo,
 		bufLog:     bufLog,
 		captcha:    initCaptcha(),
+		mjml:       initMJML(),
 		events:     evStream,
 
+		simulations:    make(map[int]chan struct{}),
+		subscriberJobs: make(map[int]chan struct{}),
+		crmSyncs:       make(map[int]bool),
+
 		paginator: paginator.New(paginator.Opt{
 			DefaultPerPage: 20,
 			MaxPerPage:     50,
@@ -202,15 +221,22 @@ func main() {
 	if err := ko.Unmarshal("bounce.actions", &cOpt.Constants.BounceActions); err != nil {
 		lo.Fatalf("error unmarshalling bounce config: %v", err)
 	}
+	if err := ko.UnmarshalWithConf("app.attrib_triggers", &cOpt.Constants.AttribTriggers, koanf.UnmarshalConf{Tag: "json"}); err != nil {
+		lo.Fatalf("error unmarshalling attribute triggers: %v", err)
+	}
 
 	app.core = core.New(cOpt, &core.Hooks{
 		SendOptinConfirmation: sendOptinConfirmationHook(app),
+		SubscriberEvent:       subscriberEventHook(app),
+		SendTemplate:          sendTemplateHook(app),
 	})
 
 	app.queries = queries
+	app.webhooks = initWebhooks()
 	app.manager = initCampaignManager(app.queries, app.constants, app)
 	app.importer = initImporter(app.queries, db, app.core, app)
 	app.notifTpls = initNotifTemplates("/email-templates/*.html", fs, app.i18n, app.constants)
+	initTemplatePartials(app.manager, app)
 	initTxTemplates(app.manager, app)
 
 	if ko.Bool("bounce.enabled") {
@@ -218,8 +244,11 @@ func main() {
 		go app.bounce.Run()
 	}
 
-	// Initialize the default SMTP (`email`) messenger.
-	app.messengers[emailMsgr] = initSMTPMessenger(app.manager)
+	// Initialize the default SMTP (`email`) messenger and any named
+	// SMTP server (`email-$name`) messengers.
+	for _, m := range initSMTPMessengers(app.manager) {
+		app.messengers[m.Name()] = m
+	}
 
 	// Initialize any additional postback messengers.
 	for _, m := range initPostbackMessengers(app.manager) {
@@ -231,6 +260,17 @@ func main() {
 		app.manager.AddMessenger(m)
 	}
 
+	// Export the public campaign archive to a directory and exit.
+	if dir := ko.String("export-archive"); dir != "" {
+		dir, _ = filepath.Abs(dir)
+		n, err := exportArchive(makeArchiveDirWriter(dir), ko.String("export-archive-url"), app)
+		if err != nil {
+			lo.Fatalf("error exporting campaign archive: %v", err)
+		}
+		lo.Printf("exported %d campaign archive files to %s", n, dir)
+		os.Exit(0)
+	}
+
 	// Load system information.
 	app.about = initAbout(queries, db)
 
@@ -243,6 +283,21 @@ func main() {
 	// messages) get processed at the specified interval.
 	go app.manager.Run()
 
+	// Check the RSS feeds that are due for new items every minute.
+	go pollRSSFeeds(time.Minute, app)
+	go pollCRMSyncs(time.Minute, app)
+	go refreshSegments(segmentRefreshInterval, app)
+	go refreshDynamicLists(dynamicListRefreshInterval, app)
+	go recordDomainBlocklistHits(domainBlocklistFlushInterval, app)
+	go syncDisposableDomains(disposableDomainsInterval, app)
+	go checkSubscriptionExpiry(subExpiryCheckInterval, app)
+	go checkOptinReminders(optinReminderCheckInterval, app)
+	go purgeDeletedSubscribers(subPurgeInterval, app)
+	go runSubscriberHygiene(subHygieneInterval, app)
+	go recordListSnapshots(listSnapshotInterval, app)
+	go dispatchListEvents(listEventsInterval, app)
+	go reindexSubscriberSearch(app)
+
 	// Start the app server.
 	srv := initHTTPServer(app)
 
@@ -267,6 +322,9 @@ func main() {
 		// Close the campaign manager.
 		app.manager.Close()
 
+		// Record the pending domain blocklist hits.
+		flushDomainBlocklistHits(app)
+
 		// Close the DB pool.
 		app.db.DB.Close()
 
@@ -2,6 +2,7 @@ package main
 
 import (
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -37,6 +38,43 @@ func handleGCSubscribers(c echo.Context) error {
 	}{n}})
 }
 
+// handlePreviewSubscriberHygiene returns the number of subscriptions and subscribers
+// that the list hygiene rules would be applied to right now without changing them.
+// The rules in the settings can be overridden in the query params to preview them.
+func handlePreviewSubscriberHygiene(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		r   = hygieneRules(app)
+	)
+
+	for _, p := range []struct {
+		name string
+		val  *int
+	}{
+		{"unconfirmed_days", &r.UnconfirmedDays},
+		{"unengaged_months", &r.UnengagedMonths},
+		{"blocklisted_days", &r.BlocklistedDays},
+	} {
+		v := c.QueryParam(p.name)
+		if v == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", p.name))
+		}
+		*p.val = n
+	}
+
+	out, err := app.core.RunSubscriberHygiene(r, true)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
 // handleGCSubscriptions garbage collects (deletes) orphaned or blocklisted subscribers.
 func handleGCSubscriptions(c echo.Context) error {
 	var (
@@ -2,6 +2,7 @@ package main
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gofrs/uuid/v5"
 	"github.com/knadh/listmonk/internal/core"
@@ -31,19 +32,21 @@ func newManagerStore(q *models.Queries, c *core.Core, m media.Store) *store {
 // NextCampaigns retrieves active campaigns ready to be processed excluding
 // campaigns that are also being processed. Additionally, it takes a map of campaignID:sentCount
 // of campaigns that are being processed and updates them in the DB.
-func (s *store) NextCampaigns(currentIDs []int64, sentCounts []int64) ([]*models.Campaign, error) {
+// Local time campaigns are retrieved localLead ahead of their send_at.
+func (s *store) NextCampaigns(currentIDs []int64, sentCounts []int64, segments []int64, costs []float64, localLead time.Duration) ([]*models.Campaign, error) {
 	var out []*models.Campaign
-	err := s.queries.NextCampaigns.Select(&out, pq.Int64Array(currentIDs), pq.Int64Array(sentCounts))
+	err := s.queries.NextCampaigns.Select(&out, pq.Int64Array(currentIDs), pq.Int64Array(sentCounts),
+		int(localLead.Seconds()), pq.Int64Array(segments), pq.Float64Array(costs))
 	return out, err
 }
 
 // NextSubscribers retrieves a subset of subscribers of a given campaign.
 // Since batches are processed sequentially, the retrieval is ordered by ID,
 // and every batch takes the last ID of the last batch and fetches the next
-// batch above that.
-func (s *store) NextSubscribers(campID, limit int) ([]models.Subscriber, error) {
+// batch above that. If timezones are given, only subscribers in them are retrieved.
+func (s *store) NextSubscribers(campID, limit int, timezones []string) ([]models.Subscriber, error) {
 	var out []models.Subscriber
-	err := s.queries.NextCampaignSubscribers.Select(&out, campID, limit)
+	err := s.queries.NextCampaignSubscribers.Select(&out, campID, limit, pq.StringArray(timezones))
 	return out, err
 }
 
@@ -54,18 +57,148 @@ func (s *store) GetCampaign(campID int) (*models.Campaign, error) {
 	return out, err
 }
 
+// GetCampaignTimezones fetches the distinct timezones of a campaign's subscribers.
+func (s *store) GetCampaignTimezones(campID int) ([]string, error) {
+	var out []string
+	err := s.queries.GetCampaignTimezones.Select(&out, campID)
+	return out, err
+}
+
+// UpdateCampaignTZBucket sets the timezone bucket being processed in a local time campaign.
+func (s *store) UpdateCampaignTZBucket(campID int, sendAt time.Time) error {
+	_, err := s.queries.UpdateCampaignTZBucket.Exec(campID, sendAt)
+	return err
+}
+
+// UpdateCampaignRollout records the time until which a staged campaign is held
+// after its initial stage and whether its rates have been checked after the hold.
+func (s *store) UpdateCampaignRollout(campID int, heldUntil time.Time, checked bool) error {
+	_, err := s.queries.UpdateCampaignRollout.Exec(campID, heldUntil, checked)
+	return err
+}
+
+// CountCampaignBounces returns the number of subscribers who bounced, and who
+// complained about, a campaign.
+func (s *store) CountCampaignBounces(campID int) (int, int, error) {
+	var out struct {
+		Bounces    int `db:"bounces"`
+		Complaints int `db:"complaints"`
+	}
+	err := s.queries.CountCampaignBounces.Get(&out, campID)
+	return out.Bounces, out.Complaints, err
+}
+
 // UpdateCampaignStatus updates a campaign's status.
 func (s *store) UpdateCampaignStatus(campID int, status string) error {
 	_, err := s.queries.UpdateCampaignStatus.Exec(campID, status)
 	return err
 }
 
+// ExpireCampaign finishes a running campaign that has reached its send deadline.
+func (s *store) ExpireCampaign(campID int) error {
+	_, err := s.queries.ExpireCampaign.Exec(campID)
+	return err
+}
+
 // UpdateCampaignCounts updates a campaign's status.
-func (s *store) UpdateCampaignCounts(campID int, toSend int, sent int, lastSubID int) error {
-	_, err := s.queries.UpdateCampaignCounts.Exec(campID, toSend, sent, lastSubID)
+func (s *store) UpdateCampaignCounts(campID int, toSend int, sent int, lastSubID int, segments int, cost float64) error {
+	_, err := s.queries.UpdateCampaignCounts.Exec(campID, toSend, sent, lastSubID, segments, cost)
+	return err
+}
+
+// RewindCampaign moves a campaign's subscriber checkpoint back to the given
+// subscriber so that the subscribers after it are fetched again.
+func (s *store) RewindCampaign(campID int, lastSubID int) error {
+	_, err := s.queries.RewindCampaignSubscribers.Exec(campID, lastSubID)
 	return err
 }
 
+// RecordDeliveries records the outcomes of a campaign's messages to the given
+// subscribers, the messengers through which they were delivered, the errors
+// and their categories, and the version of the campaign's content that was sent.
+func (s *store) RecordDeliveries(campID, contentVersion int, subIDs []int64, messengers, statuses, errs, errTypes []string) error {
+	_, err := s.queries.RecordCampaignDeliveries.Exec(campID, contentVersion, pq.Int64Array(subIDs),
+		pq.StringArray(messengers), pq.StringArray(statuses), pq.StringArray(errs), pq.StringArray(errTypes))
+	return err
+}
+
+// GetCampaignFrequencyCap returns the strictest of the daily and weekly
+// frequency caps of a campaign's lists.
+func (s *store) GetCampaignFrequencyCap(campID int) (int, int, error) {
+	var out struct {
+		Daily  int `db:"daily"`
+		Weekly int `db:"weekly"`
+	}
+	err := s.queries.GetCampaignFrequencyCap.Get(&out, campID)
+	return out.Daily, out.Weekly, err
+}
+
+// GetSubscriberSends returns the times (oldest first) at which campaigns
+// other than the given one were sent to the given subscribers in the past week.
+func (s *store) GetSubscriberSends(campID int, subIDs []int64) (map[int64][]time.Time, error) {
+	var res []struct {
+		SubscriberID int64         `db:"subscriber_id"`
+		SentAt       pq.Int64Array `db:"sent_at"`
+	}
+	if err := s.queries.GetSubscriberSends.Select(&res, campID, pq.Int64Array(subIDs)); err != nil {
+		return nil, err
+	}
+
+	out := make(map[int64][]time.Time, len(res))
+	for _, r := range res {
+		t := make([]time.Time, len(r.SentAt))
+		for i, ts := range r.SentAt {
+			t[i] = time.Unix(ts, 0)
+		}
+		out[r.SubscriberID] = t
+	}
+
+	return out, nil
+}
+
+// CountDeliveries returns the number of campaign messages delivered through
+// a messenger since the given time.
+func (s *store) CountDeliveries(messenger string, since time.Time) (int, error) {
+	var n int
+	err := s.queries.CountMessengerDeliveries.Get(&n, messenger, since)
+	return n, err
+}
+
+// AddMessengerUsage adds to the number of messages sent through messengers
+// on the given days (YYYY-MM-DD).
+func (s *store) AddMessengerUsage(messengers, dates []string, counts []int) error {
+	c := make(pq.Int64Array, len(counts))
+	for i, n := range counts {
+		c[i] = int64(n)
+	}
+
+	_, err := s.queries.AddMessengerUsage.Exec(pq.StringArray(messengers), pq.StringArray(dates), c)
+	return err
+}
+
+// CountMessengerUsage returns the number of messages sent through a messenger
+// on a day and in the month that starts on the given day.
+func (s *store) CountMessengerUsage(messenger string, day, month time.Time) (int, int, error) {
+	var out []models.MessengerUsage
+	if err := s.queries.GetMessengerUsage.Select(&out, day.Format("2006-01-02"), month.Format("2006-01-02"), messenger); err != nil {
+		return 0, 0, err
+	}
+	if len(out) == 0 {
+		return 0, 0, nil
+	}
+
+	return out[0].Daily, out[0].Monthly, nil
+}
+
+// LoadSubscriberMeta loads the list subscriptions and engagement of the
+// given subscribers.
+func (s *store) LoadSubscriberMeta(subs []models.Subscriber) error {
+	if err := models.Subscribers(subs).LoadLists(s.queries.GetSubscriberListsLazy); err != nil {
+		return err
+	}
+	return models.Subscribers(subs).LoadEngagement(s.queries.GetSubscriberEngagement)
+}
+
 // GetAttachment fetches a media attachment blob.
 func (s *store) GetAttachment(mediaID int) (models.Attachment, error) {
 	m, err := s.core.GetMedia(mediaID, "", s.media)
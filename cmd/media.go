@@ -2,13 +2,14 @@ package main
 
 import (
 	"bytes"
-	"mime/multipart"
+	"io"
 	"net/http"
 	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/disintegration/imaging"
+	"github.com/knadh/listmonk/internal/media"
 	"github.com/knadh/listmonk/models"
 	"github.com/labstack/echo/v4"
 )
@@ -25,10 +26,7 @@ var (
 
 // handleUploadMedia handles media file uploads.
 func handleUploadMedia(c echo.Context) error {
-	var (
-		app     = c.Get("app").(*App)
-		cleanUp = false
-	)
+	app := c.Get("app").(*App)
 	file, err := c.FormFile("file")
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest,
@@ -43,84 +41,13 @@ func handleUploadMedia(c echo.Context) error {
 	}
 	defer src.Close()
 
-	var (
-		// Naive check for content type and extension.
-		ext         = strings.TrimPrefix(strings.ToLower(filepath.Ext(file.Filename)), ".")
-		contentType = file.Header.Get("Content-Type")
-	)
-
 	// Validate file extension.
-	if !inArray("*", app.constants.MediaUpload.Extensions) {
-		if ok := inArray(ext, app.constants.MediaUpload.Extensions); !ok {
-			return echo.NewHTTPError(http.StatusBadRequest,
-				app.i18n.Ts("media.unsupportedFileType", "type", ext))
-		}
-	}
-
-	// Upload the file.
-	fName := makeFilename(file.Filename)
-	fName, err = app.media.Put(fName, contentType, src)
-	if err != nil {
-		app.log.Printf("error uploading file: %v", err)
-		return echo.NewHTTPError(http.StatusInternalServerError,
-			app.i18n.Ts("media.errorUploading", "error", err.Error()))
-	}
-
-	var (
-		thumbfName = ""
-		width      = 0
-		height     = 0
-	)
-	defer func() {
-		// If any of the subroutines in this function fail,
-		// the uploaded image should be removed.
-		if cleanUp {
-			app.media.Delete(fName)
-
-			if thumbfName != "" {
-				app.media.Delete(thumbfName)
-			}
-		}
-	}()
-
-	// Create thumbnail from file for non-vector formats.
-	isImage := inArray(ext, imageExts)
-	if isImage {
-		thumbFile, w, h, err := processImage(file)
-		if err != nil {
-			cleanUp = true
-			app.log.Printf("error resizing image: %v", err)
-			return echo.NewHTTPError(http.StatusInternalServerError,
-				app.i18n.Ts("media.errorResizing", "error", err.Error()))
-		}
-		width = w
-		height = h
-
-		// Upload thumbnail.
-		tf, err := app.media.Put(thumbPrefix+fName, contentType, thumbFile)
-		if err != nil {
-			cleanUp = true
-			app.log.Printf("error saving thumbnail: %v", err)
-			return echo.NewHTTPError(http.StatusInternalServerError,
-				app.i18n.Ts("media.errorSavingThumbnail", "error", err.Error()))
-		}
-		thumbfName = tf
-	}
-	if inArray(ext, vectorExts) {
-		thumbfName = fName
+	if err := validateMediaExt(file.Filename, app); err != nil {
+		return err
 	}
 
-	// Write to the DB.
-	meta := models.JSON{}
-	if isImage {
-		meta = models.JSON{
-			"width":  width,
-			"height": height,
-		}
-	}
-	m, err := app.core.InsertMedia(fName, thumbfName, contentType, meta, app.constants.MediaUpload.Provider, app.media)
+	m, err := insertMediaFile(file.Filename, file.Header.Get("Content-Type"), src, file.Size, app)
 	if err != nil {
-		cleanUp = true
 		return err
 	}
 	return c.JSON(http.StatusOK, okResp{m})
@@ -181,14 +108,105 @@ func handleDeleteMedia(c echo.Context) error {
 	return c.JSON(http.StatusOK, okResp{true})
 }
 
+// validateMediaExt checks whether the extension of a file name is one that
+// can be uploaded.
+func validateMediaExt(fileName string, app *App) error {
+	if inArray("*", app.constants.MediaUpload.Extensions) {
+		return nil
+	}
+
+	// Naive check for the extension.
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(fileName)), ".")
+	if ok := inArray(ext, app.constants.MediaUpload.Extensions); !ok {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			app.i18n.Ts("media.unsupportedFileType", "type", ext))
+	}
+
+	return nil
+}
+
+// insertMediaFile uploads a file to the media store with a thumbnail for
+// images and records it in the DB.
+func insertMediaFile(fileName, contentType string, src io.ReadSeeker, size int64, app *App) (media.Media, error) {
+	var (
+		cleanUp = false
+		ext     = strings.TrimPrefix(strings.ToLower(filepath.Ext(fileName)), ".")
+	)
+
+	// Upload the file.
+	fName := makeFilename(fileName)
+	fName, err := app.media.Put(fName, contentType, src)
+	if err != nil {
+		app.log.Printf("error uploading file: %v", err)
+		return media.Media{}, echo.NewHTTPError(http.StatusInternalServerError,
+			app.i18n.Ts("media.errorUploading", "error", err.Error()))
+	}
+
+	var (
+		thumbfName = ""
+		width      = 0
+		height     = 0
+	)
+	defer func() {
+		// If any of the subroutines in this function fail,
+		// the uploaded image should be removed.
+		if cleanUp {
+			app.media.Delete(fName)
+
+			if thumbfName != "" {
+				app.media.Delete(thumbfName)
+			}
+		}
+	}()
+
+	// Create thumbnail from file for non-vector formats.
+	isImage := inArray(ext, imageExts)
+	if isImage {
+		thumbFile, w, h, err := processImage(src)
+		if err != nil {
+			cleanUp = true
+			app.log.Printf("error resizing image: %v", err)
+			return media.Media{}, echo.NewHTTPError(http.StatusInternalServerError,
+				app.i18n.Ts("media.errorResizing", "error", err.Error()))
+		}
+		width = w
+		height = h
+
+		// Upload thumbnail.
+		tf, err := app.media.Put(thumbPrefix+fName, contentType, thumbFile)
+		if err != nil {
+			cleanUp = true
+			app.log.Printf("error saving thumbnail: %v", err)
+			return media.Media{}, echo.NewHTTPError(http.StatusInternalServerError,
+				app.i18n.Ts("media.errorSavingThumbnail", "error", err.Error()))
+		}
+		thumbfName = tf
+	}
+	if inArray(ext, vectorExts) {
+		thumbfName = fName
+	}
+
+	// Write to the DB. The size is used to validate attachment limits.
+	meta := models.JSON{"size": size}
+	if isImage {
+		meta["width"] = width
+		meta["height"] = height
+	}
+	m, err := app.core.InsertMedia(fName, thumbfName, contentType, meta, app.constants.MediaUpload.Provider, app.media)
+	if err != nil {
+		cleanUp = true
+		return media.Media{}, err
+	}
+
+	return m, nil
+}
+
 // processImage reads the image file and returns thumbnail bytes and
 // the original image's width, and height.
-func processImage(file *multipart.FileHeader) (*bytes.Reader, int, int, error) {
-	src, err := file.Open()
-	if err != nil {
+func processImage(src io.ReadSeeker) (*bytes.Reader, int, int, error) {
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
 		return nil, 0, 0, err
 	}
-	defer src.Close()
 
 	img, err := imaging.Decode(src)
 	if err != nil {
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"net/textproto"
 	"regexp"
 	"strings"
 
@@ -9,10 +10,14 @@ import (
 )
 
 const (
-	notifTplImport       = "import-status"
-	notifTplCampaign     = "campaign-status"
-	notifSubscriberOptin = "subscriber-optin"
-	notifSubscriberData  = "subscriber-data"
+	notifTplImport              = "import-status"
+	notifTplCampaign            = "campaign-status"
+	notifSubscriberOptin        = "subscriber-optin"
+	notifSubscriberData         = "subscriber-data"
+	notifSubscriberEmailChange  = "subscriber-email-change"
+	notifSubscriberEmailNotice  = "subscriber-email-change-notice"
+	notifSubscriberEmailVerify  = "subscriber-email-verify"
+	notifSubscriberRepermission = "subscriber-repermission"
 )
 
 var (
@@ -32,10 +37,44 @@ func (app *App) sendNotification(toEmails []string, subject, tplName string, dat
 		return nil
 	}
 
+	m, err := app.makeNotification(toEmails, subject, tplName, data)
+	if err != nil {
+		return err
+	}
+
+	if err := app.manager.PushMessage(m); err != nil {
+		app.log.Printf("error sending admin notification (%s): %v", m.Subject, err)
+		return err
+	}
+	return nil
+}
+
+// sendListNotification sends out an e-mail notification to subscribers about
+// a list with the list's sender, Reply-To, and messenger, if it has any.
+func (app *App) sendListNotification(toEmails []string, subject, tplName string, data interface{}, l models.List) error {
+	if len(toEmails) == 0 {
+		return nil
+	}
+
+	m, err := app.makeNotification(toEmails, subject, tplName, data)
+	if err != nil {
+		return err
+	}
+	app.setListSender(&m, l)
+
+	if err := app.manager.PushMessage(m); err != nil {
+		app.log.Printf("error sending list notification (%s): %v", m.Subject, err)
+		return err
+	}
+	return nil
+}
+
+// makeNotification renders a notification template into an e-mail message.
+func (app *App) makeNotification(toEmails []string, subject, tplName string, data interface{}) (models.Message, error) {
 	var buf bytes.Buffer
 	if err := app.notifTpls.tpls.ExecuteTemplate(&buf, tplName, data); err != nil {
 		app.log.Printf("error compiling notification template '%s': %v", tplName, err)
-		return err
+		return models.Message{}, err
 	}
 	body := buf.Bytes()
 
@@ -48,11 +87,30 @@ func (app *App) sendNotification(toEmails []string, subject, tplName string, dat
 	m.Subject = subject
 	m.Body = body
 	m.Messenger = emailMsgr
-	if err := app.manager.PushMessage(m); err != nil {
-		app.log.Printf("error sending admin notification (%s): %v", subject, err)
-		return err
+	return m, nil
+}
+
+// hasListSender returns whether a list has a sender, Reply-To, or messenger
+// for its e-mails.
+func hasListSender(l models.List) bool {
+	return l.DefaultFromEmail != "" || l.DefaultReplyTo != "" || l.DefaultMessenger != ""
+}
+
+// setListSender sets the sender, Reply-To header, and messenger of an e-mail
+// to a subscriber about a list to the list's sending defaults, if it has any.
+func (app *App) setListSender(m *models.Message, l models.List) {
+	if l.DefaultFromEmail != "" {
+		m.From = l.DefaultFromEmail
+	}
+	if l.DefaultReplyTo != "" {
+		if m.Headers == nil {
+			m.Headers = textproto.MIMEHeader{}
+		}
+		m.Headers.Set("Reply-To", l.DefaultReplyTo)
+	}
+	if l.DefaultMessenger != "" && app.manager.HasMessenger(l.DefaultMessenger) {
+		m.Messenger = l.DefaultMessenger
 	}
-	return nil
 }
 
 // getTplSubject extrcts any custom i18n subject rendered in the given rendered
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// Interval at which unconfirmed subscriptions are checked for reminders.
+	optinReminderCheckInterval = time.Hour
+
+	// Number of subscribers that are sent reminders in one go.
+	optinReminderBatchSize = 1000
+
+	// Default and max number of reminders, and the max reminder interval in days.
+	optinReminderMaxDefault = 2
+	optinReminderMaxCount   = 10
+	optinReminderMaxDays    = 365
+)
+
+// checkOptinReminders periodically re-sends the opt-in confirmation e-mail to the
+// unconfirmed subscribers of double opt-in lists with reminders who haven't
+// confirmed within the list's reminder interval.
+func checkOptinReminders(interval time.Duration, app *App) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		n := sendOptinReminders(app)
+		if n > 0 {
+			app.log.Printf("sent opt-in reminders to %d subscribers", n)
+		}
+	}
+}
+
+// sendOptinReminders sends the reminders that are due in batches and returns
+// the number of subscribers they were sent to. It stops on the first e-mail
+// that can't be sent, which is retried on the next check.
+func sendOptinReminders(app *App) int {
+	var (
+		sendOptin = sendOptinConfirmationHook(app)
+		total     = 0
+	)
+	for {
+		subs, err := app.core.GetDueOptinReminders(optinReminderBatchSize)
+		if err != nil || len(subs) == 0 {
+			return total
+		}
+
+		for _, s := range subs {
+			listIDs := int64sToInts(s.ListIDs)
+
+			sub, err := app.core.GetSubscriber(s.SubscriberID, "", "")
+			if err != nil {
+				return total
+			}
+			if _, err := sendOptin(sub, listIDs); err != nil {
+				return total
+			}
+
+			// Record the reminder even if there turned out to be nothing to
+			// confirm so that the subscriptions aren't picked up again.
+			if err := app.core.RecordOptinReminders(sub.ID, listIDs); err != nil {
+				return total
+			}
+			total++
+		}
+	}
+}
+
+// handleGetListOptinReminderStats returns the numbers of a list's subscribers
+// who were sent opt-in reminders and who confirmed after them.
+func handleGetListOptinReminderStats(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	out, err := app.core.GetListOptinReminderStats(id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
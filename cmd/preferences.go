@@ -0,0 +1,275 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// prefsTpl is the data of the subscriber preference center.
+type prefsTpl struct {
+	publicTpl
+	Subscriber models.Subscriber
+	SubUUID    string
+
+	// New e-mail of the subscriber that's pending confirmation.
+	PendingEmail string
+
+	Lists       []prefsOption
+	Frequencies []prefsOption
+	Topics      []prefsOption
+	Langs       []prefsOption
+}
+
+// prefsOption is a list, frequency, topic, or language in the preference
+// center and whether the subscriber has picked it.
+type prefsOption struct {
+	Value       string
+	Name        string
+	Description string
+	Checked     bool
+}
+
+// handlePreferencesPage renders the preference center where subscribers
+// manage their lists, e-mail frequency, topics, and language. This is the
+// view that {{ PreferencesURL }} in campaigns link to.
+func handlePreferencesPage(c echo.Context) error {
+	var (
+		app     = c.Get("app").(*App)
+		subUUID = c.Param("subUUID")
+	)
+
+	if !app.constants.Privacy.AllowPreferences {
+		return c.Render(http.StatusBadRequest, tplMessage,
+			makeMsgTpl(app.i18n.T("public.errorTitle"), "", app.i18n.T("public.invalidFeature")))
+	}
+
+	sub, err := app.core.GetSubscriber(0, subUUID, "")
+	if err != nil {
+		return c.Render(http.StatusInternalServerError, tplMessage,
+			makeMsgTpl(app.i18n.T("public.errorTitle"), "", app.i18n.Ts("public.errorProcessingRequest")))
+	}
+	if sub.Status == models.SubscriberStatusBlockListed {
+		return c.Render(http.StatusOK, tplMessage,
+			makeMsgTpl(app.i18n.T("public.noSubTitle"), "", app.i18n.Ts("public.blocklisted")))
+	}
+
+	lists, _, err := getPrefsLists(subUUID, app)
+	if err != nil {
+		return c.Render(http.StatusInternalServerError, tplMessage,
+			makeMsgTpl(app.i18n.T("public.errorTitle"), "", app.i18n.T("public.errorFetchingLists")))
+	}
+
+	out := prefsTpl{
+		Subscriber: sub,
+		SubUUID:    subUUID,
+		Lists:      lists,
+	}
+	out.Title = app.i18n.T("public.prefsTitle")
+
+	if ch, ok, err := app.core.GetSubscriberEmailChange(sub.ID, ""); err == nil && ok {
+		out.PendingEmail = ch.Email
+	}
+
+	freq, _ := sub.Attribs[models.SubscriberFrequencyAttrib].(string)
+	for _, f := range app.constants.Privacy.Frequencies {
+		out.Frequencies = append(out.Frequencies, prefsOption{Value: f, Name: f, Checked: f == freq})
+	}
+
+	topics := map[string]bool{}
+	if t, ok := sub.Attribs[models.SubscriberTopicsAttrib].([]interface{}); ok {
+		for _, v := range t {
+			if s, ok := v.(string); ok {
+				topics[s] = true
+			}
+		}
+	}
+	for _, t := range app.constants.Privacy.Topics {
+		out.Topics = append(out.Topics, prefsOption{Value: t, Name: t, Checked: topics[t]})
+	}
+
+	langs, err := getI18nLangList(app.constants.Lang, app)
+	if err != nil {
+		app.log.Printf("error loading language list: %v", err)
+	}
+	for _, l := range langs {
+		out.Langs = append(out.Langs, prefsOption{Value: l.Code, Name: l.Name, Checked: l.Code == sub.Locale})
+	}
+
+	return c.Render(http.StatusOK, "preferences", out)
+}
+
+// handlePreferences saves the preferences from the preference center. The
+// frequency and topics are stored in the subscriber's attributes, and the
+// language is the subscriber's locale.
+// A new e-mail is only switched to once it's confirmed.
+func handlePreferences(c echo.Context) error {
+	var (
+		app     = c.Get("app").(*App)
+		subUUID = c.Param("subUUID")
+
+		req struct {
+			Name      string   `form:"name"`
+			Email     string   `form:"email"`
+			ListUUIDs []string `form:"l"`
+			Frequency string   `form:"frequency"`
+			Topics    []string `form:"topic"`
+			Locale    string   `form:"locale"`
+		}
+	)
+
+	if !app.constants.Privacy.AllowPreferences {
+		return c.Render(http.StatusBadRequest, tplMessage,
+			makeMsgTpl(app.i18n.T("public.errorTitle"), "", app.i18n.T("public.invalidFeature")))
+	}
+
+	if err := c.Bind(&req); err != nil {
+		return c.Render(http.StatusBadRequest, tplMessage,
+			makeMsgTpl(app.i18n.T("public.errorTitle"), "", app.i18n.T("globals.messages.invalidData")))
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 256 {
+		return c.Render(http.StatusBadRequest, tplMessage,
+			makeMsgTpl(app.i18n.T("public.errorTitle"), "", app.i18n.T("subscribers.invalidName")))
+	}
+
+	sub, err := app.core.GetSubscriber(0, subUUID, "")
+	if err != nil {
+		return c.Render(http.StatusInternalServerError, tplMessage,
+			makeMsgTpl(app.i18n.T("public.errorTitle"), "", app.i18n.T("public.errorProcessingRequest")))
+	}
+	if sub.Status == models.SubscriberStatusBlockListed {
+		return c.Render(http.StatusOK, tplMessage,
+			makeMsgTpl(app.i18n.T("public.noSubTitle"), "", app.i18n.Ts("public.blocklisted")))
+	}
+	sub.Name = req.Name
+
+	newEmail := ""
+	if req.Email = strings.TrimSpace(req.Email); req.Email != "" && !strings.EqualFold(req.Email, sub.Email) {
+		em, err := requestEmailChange(sub, req.Email, app)
+		if err != nil {
+			msg := app.i18n.T("public.errorProcessingRequest")
+			if er, ok := err.(*echo.HTTPError); ok && er.Code != http.StatusInternalServerError {
+				msg = er.Message.(string)
+			}
+
+			return c.Render(http.StatusBadRequest, tplMessage, makeMsgTpl(app.i18n.T("public.errorTitle"), "", msg))
+		}
+		newEmail = em
+	}
+
+	// Only the frequencies, topics, and languages that are on offer are saved.
+	if sub.Attribs == nil {
+		sub.Attribs = models.JSON{}
+	}
+	if len(app.constants.Privacy.Frequencies) > 0 {
+		setPrefsAttrib(sub.Attribs, models.SubscriberFrequencyAttrib, req.Frequency, app.constants.Privacy.Frequencies)
+	}
+	if len(app.constants.Privacy.Topics) > 0 {
+		topics := []string{}
+		for _, t := range req.Topics {
+			if strSliceContains(t, app.constants.Privacy.Topics) {
+				topics = append(topics, t)
+			}
+		}
+		sub.Attribs[models.SubscriberTopicsAttrib] = topics
+	}
+	if langs, err := getI18nLangList(app.constants.Lang, app); err == nil {
+		codes := make([]string, 0, len(langs))
+		for _, l := range langs {
+			codes = append(codes, l.Code)
+		}
+		if req.Locale == "" || strSliceContains(req.Locale, codes) {
+			sub.Locale = req.Locale
+		}
+	}
+
+	// Subscribe to the checked lists that the subscriber isn't on, and
+	// unsubscribe from the unchecked ones.
+	lists, subscribed, err := getPrefsLists(subUUID, app)
+	if err != nil {
+		return c.Render(http.StatusInternalServerError, tplMessage,
+			makeMsgTpl(app.i18n.T("public.errorTitle"), "", app.i18n.T("public.errorFetchingLists")))
+	}
+
+	var subUUIDs, unsubUUIDs []string
+	for _, l := range lists {
+		checked := strSliceContains(l.Value, req.ListUUIDs)
+		if checked && !l.Checked {
+			subUUIDs = append(subUUIDs, l.Value)
+		} else if !checked && subscribed[l.Value] {
+			unsubUUIDs = append(unsubUUIDs, l.Value)
+		}
+	}
+
+	hasOptin := false
+	if len(subUUIDs) > 0 {
+		_, hasOptin, err = app.core.UpdateSubscriberWithLists(sub.ID, sub, nil, subUUIDs, false, false)
+	} else {
+		_, err = app.core.UpdateSubscriber(sub.ID, sub)
+	}
+	if err != nil {
+		return c.Render(http.StatusInternalServerError, tplMessage,
+			makeMsgTpl(app.i18n.T("public.errorTitle"), "", app.i18n.T("public.errorProcessingRequest")))
+	}
+
+	if len(unsubUUIDs) > 0 {
+		if err := app.core.UnsubscribeLists([]int{sub.ID}, nil, unsubUUIDs); err != nil {
+			return c.Render(http.StatusInternalServerError, tplMessage,
+				makeMsgTpl(app.i18n.T("public.errorTitle"), "", app.i18n.T("public.errorProcessingRequest")))
+		}
+	}
+
+	msg := app.i18n.T("public.prefsSaved")
+	if hasOptin {
+		msg += " " + app.i18n.T("public.subOptinPending")
+	}
+	if newEmail != "" {
+		msg += " " + app.i18n.Ts("public.emailChangePending", "email", newEmail)
+	}
+
+	return c.Render(http.StatusOK, tplMessage, makeMsgTpl(app.i18n.T("globals.messages.done"), "", msg))
+}
+
+// getPrefsLists returns the public lists, checked if the subscriber is on
+// them, and the lists that the subscriber is on, including unconfirmed
+// subscriptions, by UUID.
+func getPrefsLists(subUUID string, app *App) ([]prefsOption, map[string]bool, error) {
+	lists, err := app.core.GetLists(models.ListTypePublic)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	subs, err := app.core.GetSubscriptions(0, subUUID, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	subscribed := make(map[string]bool, len(subs))
+	for _, s := range subs {
+		if s.SubscriptionStatus.String != models.SubscriptionStatusUnsubscribed {
+			subscribed[s.UUID] = true
+		}
+	}
+
+	out := make([]prefsOption, 0, len(lists))
+	for _, l := range lists {
+		out = append(out, prefsOption{Value: l.UUID, Name: l.Name, Description: l.Description, Checked: subscribed[l.UUID]})
+	}
+
+	return out, subscribed, nil
+}
+
+// setPrefsAttrib sets a preference attribute to the given value if it's one
+// of the allowed ones, or removes it if the value is empty.
+func setPrefsAttrib(attribs models.JSON, key, val string, allowed []string) {
+	if val == "" {
+		delete(attribs, key)
+		return
+	}
+	if strSliceContains(val, allowed) {
+		attribs[key] = val
+	}
+}
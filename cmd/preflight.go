@@ -0,0 +1,318 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/knadh/listmonk/internal/manager"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// Size (bytes) of HTML bodies beyond which e-mail clients such as Gmail
+	// clip messages.
+	preflightMaxHTMLSize = 102 * 1024
+
+	// Max number of unique links in a campaign that are checked.
+	preflightMaxLinks = 100
+
+	// Number of links that are checked concurrently and the timeout for each.
+	preflightLinkConcurrency = 8
+	preflightLinkTimeout     = time.Second * 10
+
+	preflightOK    = "ok"
+	preflightWarn  = "warning"
+	preflightError = "error"
+)
+
+var (
+	regexpPreflightHref    = regexp.MustCompile(`(?i)<a\b[^>]*?\shref\s*=\s*["']([^"']*)["']`)
+	regexpPreflightURL     = regexp.MustCompile(`https?://[^\s<>"'\)\]]+`)
+	regexpPreflightImg     = regexp.MustCompile(`(?i)<img\b[^>]*>`)
+	regexpPreflightImgAlt  = regexp.MustCompile(`(?i)\salt\s*=\s*(["'])\s*\S[^"']*["']`)
+	regexpPreflightImgSrc  = regexp.MustCompile(`(?i)\ssrc\s*=\s*["']([^"']*)["']`)
+	regexpPreflightNoValue = regexp.MustCompile(`<no value>|&lt;no value&gt;`)
+)
+
+// preflightCheck is the result of an individual pre-flight check of
+// a campaign. Items are the offending links, images etc., if any.
+type preflightCheck struct {
+	Check   string   `json:"check"`
+	Status  string   `json:"status"`
+	Message string   `json:"message"`
+	Items   []string `json:"items"`
+}
+
+// preflightReport is the report of the pre-flight checks of a campaign.
+// A campaign with any check that has errored shouldn't be launched.
+type preflightReport struct {
+	Status    string           `json:"status"`
+	CanLaunch bool             `json:"can_launch"`
+	Checks    []preflightCheck `json:"checks"`
+}
+
+// handlePreflightCampaign renders a campaign for a sample subscriber, the given
+// one, or a dummy one, and runs checks on the output that should pass
+// before it's launched.
+func handlePreflightCampaign(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	var req struct {
+		SubscriberID int `json:"subscriber_id"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	camp, err := app.core.GetCampaignForPreview(id, 0)
+	if err != nil {
+		return err
+	}
+
+	sub := dummySubscriber
+	if req.SubscriberID > 0 {
+		s, err := app.core.GetSubscriber(req.SubscriberID, "", "")
+		if err != nil {
+			return err
+		}
+
+		subs := models.Subscribers{s}
+		if err := app.core.LoadSubscriberEngagement(subs); err != nil {
+			return err
+		}
+		sub = subs[0]
+	}
+
+	return c.JSON(http.StatusOK, okResp{preflightCampaign(camp, sub, app)})
+}
+
+// preflightCampaign runs the pre-flight checks on a campaign rendered for the
+// given subscriber.
+func preflightCampaign(camp models.Campaign, sub models.Subscriber, app *App) preflightReport {
+	out := preflightReport{Status: preflightOK, CanLaunch: true, Checks: []preflightCheck{}}
+	add := func(c preflightCheck) {
+		if c.Items == nil {
+			c.Items = []string{}
+		}
+		out.Checks = append(out.Checks, c)
+
+		switch c.Status {
+		case preflightError:
+			out.Status = preflightError
+			out.CanLaunch = false
+		case preflightWarn:
+			if out.Status == preflightOK {
+				out.Status = preflightWarn
+			}
+		}
+	}
+
+	// Links are checked as they are in the content, and not as the tracking
+	// links they're rewritten to. That also keeps the links from being
+	// registered and views from being tracked.
+	camp.UUID = dummySubscriber.UUID
+	funcs := app.manager.TemplateFuncs(&camp)
+	funcs["TrackLink"] = func(url string, msg *manager.CampaignMessage) string {
+		return url
+	}
+	funcs["TrackView"] = func(msg *manager.CampaignMessage) template.HTML {
+		return ""
+	}
+
+	// Template errors.
+	if err := camp.CompileTemplate(funcs); err != nil {
+		add(preflightCheck{Check: "template", Status: preflightError,
+			Message: app.i18n.Ts("templates.errorCompiling", "error", err.Error())})
+		return out
+	}
+
+	msg, err := app.manager.NewCampaignMessage(&camp, sub)
+	if err != nil {
+		add(preflightCheck{Check: "template", Status: preflightError,
+			Message: app.i18n.Ts("templates.errorRendering", "error", err.Error())})
+		return out
+	}
+
+	var (
+		body   = string(msg.Body())
+		isHTML = camp.ContentType != models.CampaignContentTypePlain
+	)
+
+	// Template expressions that resolved to nothing, for instance, a missing
+	// subscriber attribute.
+	if n := len(regexpPreflightNoValue.FindAllString(body, -1)); n > 0 {
+		add(preflightCheck{Check: "template", Status: preflightWarn,
+			Message: app.i18n.Ts("campaigns.preflight.noValue", "num", strconv.Itoa(n))})
+	} else {
+		add(preflightCheck{Check: "template", Status: preflightOK,
+			Message: app.i18n.T("campaigns.preflight.templateOK")})
+	}
+
+	// Unsubscribe link. {{ ManageURL }} also links to the unsubscribe page.
+	if strings.Contains(body, fmt.Sprintf(app.constants.UnsubURL, camp.UUID, sub.UUID)) {
+		add(preflightCheck{Check: "unsubscribe", Status: preflightOK,
+			Message: app.i18n.T("campaigns.preflight.unsubOK")})
+	} else {
+		add(preflightCheck{Check: "unsubscribe", Status: preflightError,
+			Message: app.i18n.T("campaigns.preflight.noUnsub")})
+	}
+
+	// Broken links.
+	if bad := checkPreflightLinks(body, isHTML, app); len(bad) > 0 {
+		add(preflightCheck{Check: "links", Status: preflightError,
+			Message: app.i18n.Ts("campaigns.preflight.brokenLinks", "num", strconv.Itoa(len(bad))), Items: bad})
+	} else {
+		add(preflightCheck{Check: "links", Status: preflightOK,
+			Message: app.i18n.T("campaigns.preflight.linksOK")})
+	}
+
+	if !isHTML {
+		return out
+	}
+
+	// Images without alt text.
+	var noAlt []string
+	for _, img := range regexpPreflightImg.FindAllString(body, -1) {
+		if regexpPreflightImgAlt.MatchString(img) {
+			continue
+		}
+
+		src := img
+		if m := regexpPreflightImgSrc.FindStringSubmatch(img); m != nil {
+			src = m[1]
+		}
+		noAlt = append(noAlt, src)
+	}
+	if len(noAlt) > 0 {
+		add(preflightCheck{Check: "alt_text", Status: preflightWarn,
+			Message: app.i18n.Ts("campaigns.preflight.noAlt", "num", strconv.Itoa(len(noAlt))), Items: noAlt})
+	} else {
+		add(preflightCheck{Check: "alt_text", Status: preflightOK,
+			Message: app.i18n.T("campaigns.preflight.altOK")})
+	}
+
+	// HTML size.
+	size := strconv.Itoa(len(body) / 1024)
+	if len(body) > preflightMaxHTMLSize {
+		add(preflightCheck{Check: "size", Status: preflightWarn,
+			Message: app.i18n.Ts("campaigns.preflight.oversized", "size", size, "max", strconv.Itoa(preflightMaxHTMLSize/1024))})
+	} else {
+		add(preflightCheck{Check: "size", Status: preflightOK,
+			Message: app.i18n.Ts("campaigns.preflight.sizeOK", "size", size)})
+	}
+
+	return out
+}
+
+// checkPreflightLinks requests the unique http(s) links in a rendered campaign
+// body concurrently and returns the ones that are empty, unreachable, or that
+// respond with an error. Links to listmonk itself, such as the unsubscribe
+// link, are skipped as they're rendered for a sample subscriber.
+func checkPreflightLinks(body string, isHTML bool, app *App) []string {
+	var (
+		links []string
+		bad   []string
+		seen  = map[string]bool{}
+	)
+
+	if isHTML {
+		for _, m := range regexpPreflightHref.FindAllStringSubmatch(body, -1) {
+			u := strings.TrimSpace(strings.ReplaceAll(m[1], "&amp;", "&"))
+			switch {
+			case u == "" || u == "#":
+				bad = append(bad, fmt.Sprintf("%q", m[1]))
+				continue
+			case strings.HasPrefix(u, "http://"), strings.HasPrefix(u, "https://"):
+				links = append(links, u)
+			}
+		}
+	} else {
+		links = regexpPreflightURL.FindAllString(body, -1)
+	}
+
+	var urls []string
+	for _, u := range links {
+		if seen[u] || strings.HasPrefix(u, app.constants.RootURL) {
+			continue
+		}
+		seen[u] = true
+
+		if len(urls) < preflightMaxLinks {
+			urls = append(urls, u)
+		}
+	}
+
+	var (
+		client = &http.Client{Timeout: preflightLinkTimeout}
+		sem    = make(chan struct{}, preflightLinkConcurrency)
+		wg     sync.WaitGroup
+		mut    sync.Mutex
+	)
+	for _, u := range urls {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(u string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if err := checkLink(client, u); err != nil {
+				mut.Lock()
+				bad = append(bad, fmt.Sprintf("%s (%v)", u, err))
+				mut.Unlock()
+			}
+		}(u)
+	}
+	wg.Wait()
+
+	return bad
+}
+
+// checkLink requests a link with HEAD, falling back to GET for servers that
+// don't support HEAD, and returns an error if it's unreachable or responds with
+// an error status.
+func checkLink(client *http.Client, u string) error {
+	var status int
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequest(method, u, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("User-Agent", "listmonk")
+
+		r, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		io.Copy(io.Discard, io.LimitReader(r.Body, 1024*64))
+		r.Body.Close()
+
+		status = r.StatusCode
+		if status != http.StatusMethodNotAllowed && status != http.StatusNotImplemented {
+			break
+		}
+	}
+
+	if status >= 400 {
+		return fmt.Errorf("%d %s", status, http.StatusText(status))
+	}
+
+	return nil
+}
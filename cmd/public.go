@@ -21,6 +21,9 @@ import (
 
 const (
 	tplMessage = "message"
+
+	// Maximum length of the user agent and page URL in consent records.
+	consentMaxLen = 1000
 )
 
 // tplRenderer wraps a template.tplRenderer for echo.
@@ -75,6 +78,11 @@ type optinTpl struct {
 	Lists     []models.List `query:"-" form:"-"`
 }
 
+type emailChangeTpl struct {
+	publicTpl
+	Email string
+}
+
 type msgTpl struct {
 	publicTpl
 	MessageTitle string
@@ -87,12 +95,27 @@ type subFormTpl struct {
 	CaptchaKey string
 }
 
+// subFormReq is a subscription request from a public form or the public
+// subscription API.
+type subFormReq struct {
+	Name          string   `form:"name" json:"name"`
+	Email         string   `form:"email" json:"email"`
+	FormListUUIDs []string `form:"l" json:"list_uuids"`
+	Locale        string   `form:"locale" json:"locale"`
+	Timezone      string   `form:"timezone" json:"timezone"`
+}
+
 var (
 	pixelPNG = drawTransparentImage(3, 14)
 )
 
 // Render executes and renders a template for echo.
 func (t *tplRenderer) Render(w io.Writer, name string, data interface{}, c echo.Context) error {
+	return t.render(w, name, data, c.Get("app").(*App).i18n)
+}
+
+// render executes the named template outside of an HTTP request.
+func (t *tplRenderer) render(w io.Writer, name string, data interface{}, i *i18n.I18n) error {
 	return t.templates.ExecuteTemplate(w, name, tplData{
 		SiteName:            t.SiteName,
 		RootURL:             t.RootURL,
@@ -103,7 +126,7 @@ func (t *tplRenderer) Render(w io.Writer, name string, data interface{}, c echo.
 		EnablePublicArchive: t.EnablePublicArchive,
 		IndividualTracking:  t.IndividualTracking,
 		Data:                data,
-		L:                   c.Get("app").(*App).i18n,
+		L:                   i,
 	})
 }
 
@@ -384,12 +407,8 @@ func handleOptinPage(c echo.Context) error {
 	// Confirm.
 	if confirm {
 		meta := models.JSON{}
-		if app.constants.Privacy.RecordOptinIP {
-			if h := c.Request().Header.Get("X-Forwarded-For"); h != "" {
-				meta["optin_ip"] = h
-			} else if h := c.Request().RemoteAddr; h != "" {
-				meta["optin_ip"] = strings.Split(h, ":")[0]
-			}
+		if ip := optinIP(c, app); ip != "" {
+			meta["optin_ip"] = ip
 		}
 
 		if err := app.core.ConfirmOptionSubscription(subUUID, out.ListUUIDs, meta); err != nil {
@@ -398,6 +417,20 @@ func handleOptinPage(c echo.Context) error {
 				makeMsgTpl(app.i18n.T("public.errorTitle"), "", app.i18n.Ts("public.errorProcessingRequest")))
 		}
 
+		listUUIDs := make([]string, 0, len(out.Lists))
+		for _, l := range out.Lists {
+			listUUIDs = append(listUUIDs, l.UUID)
+		}
+		_ = app.core.InsertSubscriberConsent(subUUID, listUUIDs,
+			makeConsent(c, models.ConsentTypeConfirmation, models.ConsentSourceOptin, app))
+
+		// Send the subscriber to the confirmation page of the list, if there's one.
+		for _, l := range out.Lists {
+			if l.OptinRedirectURL != "" {
+				return c.Redirect(http.StatusFound, l.OptinRedirectURL)
+			}
+		}
+
 		return c.Render(http.StatusOK, tplMessage,
 			makeMsgTpl(app.i18n.T("public.subConfirmedTitle"), "", app.i18n.Ts("public.subConfirmed")))
 	}
@@ -405,6 +438,143 @@ func handleOptinPage(c echo.Context) error {
 	return c.Render(http.StatusOK, "optin", out)
 }
 
+// handleRepermissionPage renders the page where subscribers renew their lapsed
+// subscriptions with the link in the re-permission e-mail, and renews them on
+// confirmation.
+func handleRepermissionPage(c echo.Context) error {
+	var (
+		app        = c.Get("app").(*App)
+		subUUID    = c.Param("subUUID")
+		confirm, _ = strconv.ParseBool(c.FormValue("confirm"))
+		out        = optinTpl{}
+	)
+	out.SubUUID = subUUID
+	out.Title = app.i18n.T("public.renewSubTitle")
+
+	// Get and validate fields.
+	if err := c.Bind(&out); err != nil {
+		return err
+	}
+	for _, l := range out.ListUUIDs {
+		if !reUUID.MatchString(l) {
+			return c.Render(http.StatusBadRequest, tplMessage,
+				makeMsgTpl(app.i18n.T("public.errorTitle"), "", app.i18n.T("globals.messages.invalidUUID")))
+		}
+	}
+
+	// Get the lists that the subscriber is still subscribed to.
+	lists, err := app.core.GetSubscriberLists(0, subUUID, nil, out.ListUUIDs, "", "")
+	if err != nil {
+		return c.Render(http.StatusInternalServerError, tplMessage,
+			makeMsgTpl(app.i18n.T("public.errorTitle"), "", app.i18n.Ts("public.errorFetchingLists")))
+	}
+	for _, l := range lists {
+		if l.SubscriptionStatus != models.SubscriptionStatusUnsubscribed {
+			out.Lists = append(out.Lists, l)
+		}
+	}
+
+	// There are no lists to renew.
+	if len(out.Lists) == 0 {
+		return c.Render(http.StatusOK, tplMessage,
+			makeMsgTpl(app.i18n.T("public.noSubTitle"), "", app.i18n.Ts("public.renewSubExpired")))
+	}
+
+	// Renew.
+	if confirm {
+		if err := app.core.RenewSubscriptions(subUUID, out.ListUUIDs); err != nil {
+			return c.Render(http.StatusInternalServerError, tplMessage,
+				makeMsgTpl(app.i18n.T("public.errorTitle"), "", app.i18n.Ts("public.errorProcessingRequest")))
+		}
+
+		return c.Render(http.StatusOK, tplMessage,
+			makeMsgTpl(app.i18n.T("public.renewedSubTitle"), "", app.i18n.Ts("public.renewedSub")))
+	}
+
+	return c.Render(http.StatusOK, "repermission", out)
+}
+
+// handleEmailChangePage renders the page where subscribers confirm the change
+// of their e-mail with the link that was sent to the new e-mail, and applies
+// the change on confirmation.
+func handleEmailChangePage(c echo.Context) error {
+	var (
+		app        = c.Get("app").(*App)
+		token      = c.Param("token")
+		confirm, _ = strconv.ParseBool(c.FormValue("confirm"))
+	)
+
+	ch, ok, err := app.core.GetSubscriberEmailChange(0, token)
+	if err != nil {
+		return c.Render(http.StatusInternalServerError, tplMessage,
+			makeMsgTpl(app.i18n.T("public.errorTitle"), "", app.i18n.Ts("public.errorProcessingRequest")))
+	}
+	if !ok {
+		return c.Render(http.StatusBadRequest, tplMessage,
+			makeMsgTpl(app.i18n.T("public.errorTitle"), "", app.i18n.T("public.emailChangeExpired")))
+	}
+
+	// Confirm.
+	if confirm {
+		if _, err := app.core.ConfirmSubscriberEmailChange(token); err != nil {
+			msg := app.i18n.Ts("public.errorProcessingRequest")
+			if er, ok := err.(*echo.HTTPError); ok && er.Code != http.StatusInternalServerError {
+				msg = er.Message.(string)
+			}
+
+			return c.Render(http.StatusBadRequest, tplMessage, makeMsgTpl(app.i18n.T("public.errorTitle"), "", msg))
+		}
+
+		return c.Render(http.StatusOK, tplMessage,
+			makeMsgTpl(app.i18n.T("public.emailChangedTitle"), "", app.i18n.Ts("public.emailChanged", "email", ch.Email)))
+	}
+
+	out := emailChangeTpl{Email: ch.Email}
+	out.Title = app.i18n.T("public.emailChangeTitle")
+
+	return c.Render(http.StatusOK, "email-change", out)
+}
+
+// handleEmailVerifyPage renders the page where subscribers verify an alternate
+// e-mail with the link that was sent to it, and verifies it on confirmation.
+func handleEmailVerifyPage(c echo.Context) error {
+	var (
+		app        = c.Get("app").(*App)
+		token      = c.Param("token")
+		confirm, _ = strconv.ParseBool(c.FormValue("confirm"))
+	)
+
+	em, ok, err := app.core.GetSubscriberEmail(0, 0, token)
+	if err != nil {
+		return c.Render(http.StatusInternalServerError, tplMessage,
+			makeMsgTpl(app.i18n.T("public.errorTitle"), "", app.i18n.Ts("public.errorProcessingRequest")))
+	}
+	if !ok {
+		return c.Render(http.StatusBadRequest, tplMessage,
+			makeMsgTpl(app.i18n.T("public.errorTitle"), "", app.i18n.T("public.emailVerifyExpired")))
+	}
+
+	// Confirm.
+	if confirm {
+		if _, err := app.core.VerifySubscriberEmail(token); err != nil {
+			msg := app.i18n.Ts("public.errorProcessingRequest")
+			if er, ok := err.(*echo.HTTPError); ok && er.Code != http.StatusInternalServerError {
+				msg = er.Message.(string)
+			}
+
+			return c.Render(http.StatusBadRequest, tplMessage, makeMsgTpl(app.i18n.T("public.errorTitle"), "", msg))
+		}
+
+		return c.Render(http.StatusOK, tplMessage,
+			makeMsgTpl(app.i18n.T("public.emailVerifiedTitle"), "", app.i18n.Ts("public.emailVerified", "email", em.Email)))
+	}
+
+	out := emailChangeTpl{Email: em.Email}
+	out.Title = app.i18n.T("public.emailVerifyTitle")
+
+	return c.Render(http.StatusOK, "email-verify", out)
+}
+
 // handleSubscriptionFormPage handles subscription requests coming from public
 // HTML subscription forms.
 func handleSubscriptionFormPage(c echo.Context) error {
@@ -465,7 +635,7 @@ func handleSubscriptionForm(c echo.Context) error {
 		}
 	}
 
-	hasOptin, err := processSubForm(c)
+	hasOptin, err := processSubForm(c, models.ConsentSourceForm)
 	if err != nil {
 		e, ok := err.(*echo.HTTPError)
 		if !ok {
@@ -495,7 +665,7 @@ func handlePublicSubscription(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("public.invalidFeature"))
 	}
 
-	hasOptin, err := processSubForm(c)
+	hasOptin, err := processSubForm(c, models.ConsentSourceAPI)
 	if err != nil {
 		return err
 	}
@@ -514,19 +684,35 @@ func handleLinkRedirect(c echo.Context) error {
 		linkUUID = c.Param("linkUUID")
 		campUUID = c.Param("campUUID")
 		subUUID  = c.Param("subUUID")
+
+		// Position of the link in the campaign body.
+		pos, _ = strconv.Atoi(c.QueryParam("p"))
 	)
 
 	// If individual tracking is disabled, do not record the subscriber ID.
-	if !app.constants.Privacy.IndividualTracking {
+	if !app.constants.Privacy.IndividualTracking && subUUID != manager.SeedUUID {
 		subUUID = ""
 	}
 
-	url, err := app.core.RegisterCampaignLinkClick(linkUUID, campUUID, subUUID)
+	// Clicks in messages sent to seed addresses aren't recorded.
+	var (
+		url string
+		err error
+	)
+	if subUUID == manager.SeedUUID {
+		url, err = app.core.GetLinkURL(linkUUID)
+	} else {
+		url, err = app.core.RegisterCampaignLinkClick(linkUUID, campUUID, subUUID, pos)
+	}
 	if err != nil {
 		e := err.(*echo.HTTPError)
 		return c.Render(e.Code, tplMessage, makeMsgTpl(app.i18n.T("public.errorTitle"), "", e.Error()))
 	}
 
+	if subUUID != manager.SeedUUID {
+		applyEngagementRules(campUUID, subUUID, models.EngagementEventClick, url, app)
+	}
+
 	return c.Redirect(http.StatusTemporaryRedirect, url)
 }
 
@@ -542,14 +728,16 @@ func handleRegisterCampaignView(c echo.Context) error {
 	)
 
 	// If individual tracking is disabled, do not record the subscriber ID.
-	if !app.constants.Privacy.IndividualTracking {
+	if !app.constants.Privacy.IndividualTracking && subUUID != manager.SeedUUID {
 		subUUID = ""
 	}
 
-	// Exclude dummy hits from template previews.
-	if campUUID != dummyUUID && subUUID != dummyUUID {
+	// Exclude dummy hits from template previews and seed messages.
+	if campUUID != dummyUUID && subUUID != dummyUUID && subUUID != manager.SeedUUID {
 		if err := app.core.RegisterCampaignView(campUUID, subUUID); err != nil {
 			app.log.Printf("error registering campaign view: %s", err)
+		} else {
+			applyEngagementRules(campUUID, subUUID, models.EngagementEventView, "", app)
 		}
 	}
 
@@ -557,6 +745,19 @@ func handleRegisterCampaignView(c echo.Context) error {
 	return c.Blob(http.StatusOK, "image/png", pixelPNG)
 }
 
+// applyEngagementRules applies the engagement rules of a campaign that match
+// a subscriber's view or click in the background, so that the tracking
+// response isn't held up. Anonymous hits have no subscriber to apply them to.
+func applyEngagementRules(campUUID, subUUID, event, url string, app *App) {
+	if subUUID == "" {
+		return
+	}
+
+	go func() {
+		_ = app.core.ApplyEngagementRules(campUUID, subUUID, event, url)
+	}()
+}
+
 // handleSelfExportSubscriberData pulls the subscriber's profile, list subscriptions,
 // campaign views and clicks and produces a JSON report that is then e-mailed
 // to the subscriber. This is a privacy feature and the data that's exported
@@ -657,24 +858,28 @@ func drawTransparentImage(h, w int) []byte {
 	return out.Bytes()
 }
 
-// processSubForm processes an incoming form/public API subscription request.
-// The bool indicates whether there was subscription to an optin list so that
-// an appropriate message can be shown.
-func processSubForm(c echo.Context) (bool, error) {
-	var (
-		app = c.Get("app").(*App)
-		req struct {
-			Name          string   `form:"name" json:"name"`
-			Email         string   `form:"email" json:"email"`
-			FormListUUIDs []string `form:"l" json:"list_uuids"`
-		}
-	)
+// processSubForm processes an incoming form/public API subscription request
+// and records the subscriber's consent with the given source. The bool indicates
+// whether there was subscription to an optin list so that an appropriate
+// message can be shown.
+func processSubForm(c echo.Context, source string) (bool, error) {
+	var req subFormReq
 
 	// Get and validate fields.
 	if err := c.Bind(&req); err != nil {
 		return false, err
 	}
 
+	return subscribe(c, req, nil, source)
+}
+
+// subscribe validates a public subscription request and subscribes the
+// subscriber to the requested lists, creating them with the given attributes
+// if they don't exist. The attributes of existing subscribers are left as
+// they are.
+func subscribe(c echo.Context, req subFormReq, attribs models.JSON, source string) (bool, error) {
+	app := c.Get("app").(*App)
+
 	if len(req.FormListUUIDs) == 0 {
 		return false, echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("public.noListsSelected"))
 	}
@@ -690,7 +895,7 @@ func processSubForm(c echo.Context) (bool, error) {
 		return false, echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("subscribers.invalidEmail"))
 	}
 
-	em, err := app.importer.SanitizeEmail(req.Email)
+	em, err := app.importer.SanitizeSubscriberEmail(req.Email)
 	if err != nil {
 		return false, echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
@@ -701,32 +906,102 @@ func processSubForm(c echo.Context) (bool, error) {
 		return false, echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("subscribers.invalidName"))
 	}
 
+	// The locale defaults to the browser's language. Invalid locales and timezones,
+	// eg: ones that are unknown to the server, are dropped instead of failing the subscription.
+	if req.Locale == "" {
+		req.Locale = acceptLanguage(c.Request().Header.Get("Accept-Language"))
+	}
+	req.Locale, _ = app.importer.SanitizeLocale(req.Locale)
+	req.Timezone, _ = app.importer.SanitizeTimezone(req.Timezone)
+
 	listUUIDs := pq.StringArray(req.FormListUUIDs)
 
+	consent := makeConsent(c, models.ConsentTypeSubscription, source, app)
+
+	// Subscribers in the trash who sign up again start afresh with a new record.
+	if err := app.core.PurgeDeletedSubscriberByEmail(req.Email); err != nil {
+		return false, err
+	}
+
 	// Insert the subscriber into the DB.
-	_, hasOptin, err := app.core.InsertSubscriber(models.Subscriber{
-		Name:   req.Name,
-		Email:  req.Email,
-		Status: models.SubscriberStatusEnabled,
+	sub, hasOptin, err := app.core.InsertSubscriber(models.Subscriber{
+		Name:     req.Name,
+		Email:    req.Email,
+		Attribs:  attribs,
+		Status:   models.SubscriberStatusEnabled,
+		Locale:   req.Locale,
+		Timezone: req.Timezone,
 	}, nil, listUUIDs, false)
 	if err != nil {
-		// Subscriber already exists. Update subscriptions.
+		// Subscriber already exists. Resubscribe them to the lists.
 		if e, ok := err.(*echo.HTTPError); ok && e.Code == http.StatusConflict {
-			sub, err := app.core.GetSubscriber(0, "", req.Email)
+			// The e-mail may be the verified alternate e-mail of a subscriber.
+			id, err := app.core.GetSubscriberEmailOwner(req.Email)
 			if err != nil {
 				return false, err
 			}
 
-			_, hasOptin, err := app.core.UpdateSubscriberWithLists(sub.ID, sub, nil, listUUIDs, false, false)
+			var sub models.Subscriber
+			if id > 0 {
+				sub, err = app.core.GetSubscriber(id, "", "")
+			} else {
+				sub, err = app.core.GetSubscriber(0, "", req.Email)
+			}
 			if err != nil {
 				return false, err
 			}
 
+			// Blocklisted subscribers aren't resubscribed. Don't let on.
+			if sub.Status == models.SubscriberStatusBlockListed {
+				return false, nil
+			}
+
+			hasOptin, err := app.core.ResubscribeSubscriber(sub, nil, listUUIDs)
+			if err != nil {
+				return false, err
+			}
+
+			_ = app.core.InsertSubscriberConsent(sub.UUID, listUUIDs, consent)
 			return hasOptin, nil
 		}
 
 		return false, echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("%s", err.(*echo.HTTPError).Message))
 	}
 
+	_ = app.core.InsertSubscriberConsent(sub.UUID, listUUIDs, consent)
 	return hasOptin, nil
 }
+
+// optinIP returns the IP address of an opt-in request if recording it is enabled.
+func optinIP(c echo.Context, app *App) string {
+	if !app.constants.Privacy.RecordOptinIP {
+		return ""
+	}
+
+	if h := c.Request().Header.Get("X-Forwarded-For"); h != "" {
+		return h
+	} else if h := c.Request().RemoteAddr; h != "" {
+		return strings.Split(h, ":")[0]
+	}
+
+	return ""
+}
+
+// makeConsent returns the record of a subscriber's consent with the IP address,
+// user agent, and page URL of the request.
+func makeConsent(c echo.Context, typ, source string, app *App) models.SubscriberConsent {
+	trunc := func(s string) string {
+		if len(s) > consentMaxLen {
+			return s[:consentMaxLen]
+		}
+		return s
+	}
+
+	return models.SubscriberConsent{
+		Type:      typ,
+		IP:        optinIP(c, app),
+		UserAgent: trunc(c.Request().UserAgent()),
+		Source:    source,
+		URL:       trunc(c.Request().Referer()),
+	}
+}
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	txttpl "text/template"
+	"time"
+
+	"github.com/knadh/listmonk/internal/rss"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// Feeds can't be checked more often than this.
+	rssMinPollInterval = time.Minute * 5
+	rssMaxItems        = 100
+	rssFetchTimeout    = time.Second * 30
+
+	rssDefaultSubject = `{{ .Feed.Title }}: {{ (index .Items 0).Title }}`
+	rssDefaultBody    = `<h2>{{ .Feed.Title }}</h2>
+{{ range .Items }}
+<h3><a href="{{ .URL }}">{{ .Title }}</a></h3>
+{{ .Description }}
+<p><a href="{{ .URL }}">{{ .URL }}</a></p>
+{{ end }}`
+)
+
+// rssTagEscaper escapes template tags in the rendered feed content so that
+// they're not executed when the campaign is compiled.
+var rssTagEscaper = strings.NewReplacer("{{", `{{ "{{" }}`)
+
+// rssTplData is the data available to the subject and body templates of
+// an RSS feed. The HTML in item descriptions and content is rendered as
+// it is.
+type rssTplData struct {
+	Feed struct {
+		Title       string
+		URL         string
+		Description string
+	}
+	Items []rssTplItem
+}
+
+type rssTplItem struct {
+	GUID        string
+	Title       string
+	URL         string
+	Description template.HTML
+	Content     template.HTML
+	Author      string
+	Published   time.Time
+}
+
+// handleGetRSSFeeds handles retrieval of RSS feeds.
+func handleGetRSSFeeds(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	// Fetch one feed.
+	if id > 0 {
+		out, err := app.core.GetRSSFeed(id)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, okResp{out})
+	}
+
+	out, err := app.core.GetRSSFeeds(false)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleCreateRSSFeed handles RSS feed creation.
+func handleCreateRSSFeed(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		o   = models.RSSFeed{Enabled: true, AutoSend: true}
+	)
+
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	o, err := validateRSSFeed(o, app)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	out, err := app.core.CreateRSSFeed(o)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleUpdateRSSFeed handles RSS feed modification.
+func handleUpdateRSSFeed(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	o, err := app.core.GetRSSFeed(id)
+	if err != nil {
+		return err
+	}
+
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	o, err = validateRSSFeed(o, app)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	out, err := app.core.UpdateRSSFeed(id, o)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleDeleteRSSFeed handles RSS feed deletion.
+func handleDeleteRSSFeed(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	if err := app.core.DeleteRSSFeed(id); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// handleCheckRSSFeed checks an RSS feed for new items right away, creating
+// a campaign if there are any.
+func handleCheckRSSFeed(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	f, err := app.core.GetRSSFeed(id)
+	if err != nil {
+		return err
+	}
+
+	if _, err := checkRSSFeed(f, app); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	out, err := app.core.GetRSSFeed(id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// pollRSSFeeds is a blocking function that checks the enabled RSS feeds
+// that are due at the given intervals.
+func pollRSSFeeds(interval time.Duration, app *App) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		feeds, err := app.core.GetRSSFeeds(true)
+		if err != nil {
+			continue
+		}
+
+		for _, f := range feeds {
+			d, err := time.ParseDuration(f.PollInterval)
+			if err != nil || (f.CheckedAt.Valid && time.Since(f.CheckedAt.Time) < d) {
+				continue
+			}
+
+			if _, err := checkRSSFeed(f, app); err != nil {
+				app.log.Printf("error checking rss feed (%s): %v", f.Name, err)
+			}
+		}
+	}
+}
+
+// checkRSSFeed fetches an RSS feed and sends its new items, if any, as
+// a campaign, and returns the ID of the campaign. Items that are in the feed
+// when it's checked for the first time are only recorded as seen.
+func checkRSSFeed(f models.RSSFeed, app *App) (int, error) {
+	feed, err := rss.Fetch(&http.Client{Timeout: rssFetchTimeout}, f.URL)
+
+	var campID int
+	if err == nil {
+		campID, err = sendRSSItems(f, feed, app)
+	}
+
+	lastErr := ""
+	if err != nil {
+		lastErr = err.Error()
+	}
+	if err := app.core.UpdateRSSFeedChecked(f.ID, lastErr); err != nil {
+		return 0, err
+	}
+
+	return campID, err
+}
+
+// sendRSSItems records the items of a feed as seen and creates a campaign
+// with the ones that weren't seen before (up to the feed's max items),
+// and starts it if the feed is set to send automatically.
+func sendRSSItems(f models.RSSFeed, feed rss.Feed, app *App) (int, error) {
+	var (
+		guids []string
+		seen  = map[string]bool{}
+	)
+	for _, i := range feed.Items {
+		if !seen[i.GUID] {
+			seen[i.GUID] = true
+			guids = append(guids, i.GUID)
+		}
+	}
+	if len(guids) == 0 {
+		return 0, nil
+	}
+
+	// Claiming the items before the campaign is created ensures that an item
+	// is never sent twice, even if the creation fails.
+	claimed, err := app.core.ClaimRSSFeedItems(f.ID, guids)
+	if err != nil {
+		return 0, err
+	}
+	if !f.CheckedAt.Valid || len(claimed) == 0 {
+		return 0, nil
+	}
+
+	isNew := make(map[string]bool, len(claimed))
+	for _, g := range claimed {
+		isNew[g] = true
+	}
+
+	var (
+		items []rss.Item
+		sent  []string
+	)
+	for _, i := range feed.Items {
+		if isNew[i.GUID] && len(items) < f.MaxItems {
+			items = append(items, i)
+			sent = append(sent, i.GUID)
+			delete(isNew, i.GUID)
+		}
+	}
+
+	subject, body, err := renderRSSFeed(f, feed, items, app)
+	if err != nil {
+		return 0, err
+	}
+
+	o := campaignReq{
+		Campaign: models.Campaign{
+			Type:        models.CampaignTypeRegular,
+			Name:        fmt.Sprintf("%s (%s)", f.Name, time.Now().Format("2006-01-02 15:04")),
+			Subject:     subject,
+			FromEmail:   f.FromEmail,
+			Body:        body,
+			ContentType: models.CampaignContentTypeHTML,
+			Messenger:   f.Messenger,
+			TemplateID:  f.TemplateID.Int,
+			Tags:        []string{"rss"},
+		},
+	}
+	for _, id := range f.ListIDs {
+		o.ListIDs = append(o.ListIDs, int(id))
+	}
+
+	o, err = validateCampaignFields(o, app)
+	if err != nil {
+		return 0, err
+	}
+
+	camp, err := app.core.CreateCampaign(o.Campaign, o.ListIDs, o.MediaIDs)
+	if err != nil {
+		if er, ok := err.(*echo.HTTPError); ok {
+			return 0, errors.New(fmt.Sprintf("%s", er.Message))
+		}
+		return 0, err
+	}
+	if err := app.core.SetRSSFeedItemsCampaign(f.ID, sent, camp.ID); err != nil {
+		return camp.ID, err
+	}
+
+	app.log.Printf("created campaign (%s) with %d new items from rss feed (%s)", camp.Name, len(items), f.Name)
+
+	if !f.AutoSend {
+		return camp.ID, nil
+	}
+
+	// Campaigns that fail the pre-flight checks are left as drafts to be
+	// reviewed, as they would be blocked from being launched by hand.
+	pc, err := app.core.GetCampaignForPreview(camp.ID, 0)
+	if err != nil {
+		return camp.ID, err
+	}
+	if r := preflightCampaign(pc, dummySubscriber, app); !r.CanLaunch {
+		for _, c := range r.Checks {
+			if c.Status == preflightError {
+				app.log.Printf("campaign (%s) from rss feed (%s) failed pre-flight check %s: %s", camp.Name, f.Name, c.Check, c.Message)
+			}
+		}
+		app.log.Printf("not auto-sending campaign (%s) from rss feed (%s) that failed pre-flight checks", camp.Name, f.Name)
+		return camp.ID, nil
+	}
+
+	if _, err := app.core.UpdateCampaignStatus(camp.ID, models.CampaignStatusRunning); err != nil {
+		if er, ok := err.(*echo.HTTPError); ok {
+			return camp.ID, errors.New(fmt.Sprintf("%s", er.Message))
+		}
+		return camp.ID, err
+	}
+
+	return camp.ID, nil
+}
+
+// renderRSSFeed renders the subject and body templates of a feed with the
+// given items.
+func renderRSSFeed(f models.RSSFeed, feed rss.Feed, items []rss.Item, app *App) (string, string, error) {
+	subjTpl, bodyTpl, err := compileRSSTemplates(f, app)
+	if err != nil {
+		return "", "", err
+	}
+
+	var data rssTplData
+	data.Feed.Title = feed.Title
+	data.Feed.URL = feed.URL
+	data.Feed.Description = feed.Description
+	for _, i := range items {
+		data.Items = append(data.Items, rssTplItem{
+			GUID:        i.GUID,
+			Title:       i.Title,
+			URL:         i.URL,
+			Description: template.HTML(i.Description),
+			Content:     template.HTML(i.Content),
+			Author:      i.Author,
+			Published:   i.Published,
+		})
+	}
+
+	var subj, body bytes.Buffer
+	if err := subjTpl.Execute(&subj, data); err != nil {
+		return "", "", errors.New(app.i18n.Ts("templates.errorRendering", "error", err.Error()))
+	}
+	if err := bodyTpl.Execute(&body, data); err != nil {
+		return "", "", errors.New(app.i18n.Ts("templates.errorRendering", "error", err.Error()))
+	}
+
+	s := strings.Join(strings.Fields(subj.String()), " ")
+	return rssTagEscaper.Replace(s), rssTagEscaper.Replace(body.String()), nil
+}
+
+// compileRSSTemplates compiles the subject and body templates of a feed,
+// or the default ones if they're empty.
+func compileRSSTemplates(f models.RSSFeed, app *App) (*txttpl.Template, *template.Template, error) {
+	subj, body := f.Subject, f.Body
+	if strings.TrimSpace(subj) == "" {
+		subj = rssDefaultSubject
+	}
+	if strings.TrimSpace(body) == "" {
+		body = rssDefaultBody
+	}
+
+	funcs := app.manager.GenericTemplateFuncs()
+	subjTpl, err := txttpl.New("subject").Funcs(txttpl.FuncMap(funcs)).Parse(subj)
+	if err != nil {
+		return nil, nil, errors.New(app.i18n.Ts("templates.errorCompiling", "error", err.Error()))
+	}
+
+	bodyTpl, err := template.New("body").Funcs(funcs).Parse(body)
+	if err != nil {
+		return nil, nil, errors.New(app.i18n.Ts("templates.errorCompiling", "error", err.Error()))
+	}
+
+	return subjTpl, bodyTpl, nil
+}
+
+// validateRSSFeed validates incoming RSS feed fields.
+func validateRSSFeed(o models.RSSFeed, app *App) (models.RSSFeed, error) {
+	o.Name = strings.TrimSpace(o.Name)
+	if !strHasLen(o.Name, 1, stdInputMaxLen) {
+		return o, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "name"))
+	}
+
+	o.URL = strings.TrimSpace(o.URL)
+	if u, err := url.Parse(o.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return o, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "url"))
+	}
+
+	if o.PollInterval == "" {
+		o.PollInterval = "1h"
+	}
+	if d, err := time.ParseDuration(o.PollInterval); err != nil || d < rssMinPollInterval {
+		return o, errors.New(app.i18n.Ts("rss.invalidInterval", "min", rssMinPollInterval.String()))
+	}
+
+	if len(o.ListIDs) == 0 {
+		return o, errors.New(app.i18n.T("campaigns.fieldInvalidListIDs"))
+	}
+
+	o.FromEmail = strings.TrimSpace(o.FromEmail)
+	if o.FromEmail != "" && !regexFromAddress.MatchString(o.FromEmail) {
+		if _, err := app.importer.SanitizeEmail(o.FromEmail); err != nil {
+			return o, errors.New(app.i18n.T("campaigns.fieldInvalidFromEmail"))
+		}
+	}
+
+	if o.Messenger == "" {
+		o.Messenger = "email"
+	}
+	if !app.manager.HasMessenger(o.Messenger) {
+		return o, errors.New(app.i18n.Ts("campaigns.fieldInvalidMessenger", "name", o.Messenger))
+	}
+
+	// The template should be a campaign template.
+	if o.TemplateID.Int > 0 {
+		tpl, err := app.core.GetTemplate(o.TemplateID.Int, true)
+		if err != nil || tpl.Type != models.TemplateTypeCampaign {
+			return o, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "template_id"))
+		}
+	}
+
+	if o.MaxItems == 0 {
+		o.MaxItems = 10
+	}
+	if o.MaxItems < 1 || o.MaxItems > rssMaxItems {
+		return o, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "max_items"))
+	}
+
+	if _, _, err := compileRSSTemplates(o, app); err != nil {
+		return o, err
+	}
+
+	return o, nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// Interval at which the subscribers and counts of segments are refreshed.
+	segmentRefreshInterval = time.Minute * 10
+
+	segmentStatsDaysDefault = 30
+	segmentStatsDaysMax     = 365
+)
+
+// handleGetSegments handles retrieval of segments.
+func handleGetSegments(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	// Fetch one segment.
+	if id > 0 {
+		out, err := app.core.GetSegment(id)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, okResp{out})
+	}
+
+	out, err := app.core.GetSegments()
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleCreateSegment handles segment creation.
+func handleCreateSegment(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		o   = models.Segment{}
+	)
+
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	o, err := validateSegment(o, app)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	out, err := app.core.CreateSegment(o)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleUpdateSegment handles segment modification.
+func handleUpdateSegment(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	o, err := app.core.GetSegment(id)
+	if err != nil {
+		return err
+	}
+
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	o, err = validateSegment(o, app)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	out, err := app.core.UpdateSegment(id, o)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleDeleteSegment handles segment deletion.
+func handleDeleteSegment(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	if err := app.core.DeleteSegment(id); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// handleRefreshSegment re-runs a segment's query right away and updates its
+// subscribers and their count.
+func handleRefreshSegment(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	s, err := app.core.GetSegment(id)
+	if err != nil {
+		return err
+	}
+
+	if err := app.core.RefreshSegment(s); err != nil {
+		return err
+	}
+
+	out, err := app.core.GetSegment(id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleGetSegmentStats returns the stats of the subscribers in a segment.
+// The optional days param is the period of the engagement stats.
+func handleGetSegmentStats(c echo.Context) error {
+	var (
+		app     = c.Get("app").(*App)
+		id, _   = strconv.Atoi(c.Param("id"))
+		days, _ = strconv.Atoi(c.QueryParam("days"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	if days < 1 {
+		days = segmentStatsDaysDefault
+	} else if days > segmentStatsDaysMax {
+		days = segmentStatsDaysMax
+	}
+
+	if _, err := app.core.GetSegment(id); err != nil {
+		return err
+	}
+
+	out, err := app.core.GetSegmentStats(id, days)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// refreshSegments is a blocking function that refreshes the subscribers and
+// counts of all segments at the given intervals.
+func refreshSegments(interval time.Duration, app *App) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		segs, err := app.core.GetSegments()
+		if err != nil {
+			continue
+		}
+
+		for _, s := range segs {
+			if err := app.core.RefreshSegment(s); err != nil {
+				app.log.Printf("error refreshing segment (%s): %v", s.Name, err)
+			}
+		}
+	}
+}
+
+// segmentSubQuery returns the query of the segment that's given in a bulk
+// subscriber action, or the action's own query if there's none.
+func segmentSubQuery(segID int, query string, app *App) (string, error) {
+	if segID < 1 {
+		return query, nil
+	}
+
+	s, err := app.core.GetSegment(segID)
+	if err != nil {
+		return "", err
+	}
+
+	return s.Query, nil
+}
+
+func validateSegment(o models.Segment, app *App) (models.Segment, error) {
+	o.Name = strings.TrimSpace(o.Name)
+	if !strHasLen(o.Name, 1, stdInputMaxLen) {
+		return o, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "name"))
+	}
+
+	o.Description = strings.TrimSpace(o.Description)
+
+	// The query of a segment with a filter is compiled from it.
+	o.Query = strings.TrimSpace(o.Query)
+	if o.Filter == nil && o.Query == "" {
+		return o, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "query"))
+	}
+
+	return o, nil
+}
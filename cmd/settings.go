@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"io"
 	"net/http"
+	"net/url"
 	"regexp"
 	"runtime"
 	"strings"
@@ -17,7 +18,11 @@ import (
 	"github.com/knadh/koanf/parsers/json"
 	"github.com/knadh/koanf/providers/rawbytes"
 	"github.com/knadh/koanf/v2"
+	"github.com/knadh/listmonk/internal/avscan"
+	"github.com/knadh/listmonk/internal/gallery"
+	"github.com/knadh/listmonk/internal/manager"
 	"github.com/knadh/listmonk/internal/messenger/email"
+	"github.com/knadh/listmonk/internal/mjml"
 	"github.com/knadh/listmonk/models"
 	"github.com/labstack/echo/v4"
 )
@@ -67,9 +72,13 @@ func handleGetSettings(c echo.Context) error {
 	for i := 0; i < len(s.Messengers); i++ {
 		s.Messengers[i].Password = strings.Repeat(pwdMask, utf8.RuneCountInString(s.Messengers[i].Password))
 	}
+	for i := 0; i < len(s.Webhooks); i++ {
+		s.Webhooks[i].Secret = strings.Repeat(pwdMask, utf8.RuneCountInString(s.Webhooks[i].Secret))
+	}
 	s.UploadS3AwsSecretAccessKey = strings.Repeat(pwdMask, utf8.RuneCountInString(s.UploadS3AwsSecretAccessKey))
 	s.SendgridKey = strings.Repeat(pwdMask, utf8.RuneCountInString(s.SendgridKey))
 	s.SecurityCaptchaSecret = strings.Repeat(pwdMask, utf8.RuneCountInString(s.SecurityCaptchaSecret))
+	s.AppMJMLPassword = strings.Repeat(pwdMask, utf8.RuneCountInString(s.AppMJMLPassword))
 	s.BouncePostmark.Password = strings.Repeat(pwdMask, utf8.RuneCountInString(s.BouncePostmark.Password))
 
 	return c.JSON(http.StatusOK, okResp{s})
@@ -93,6 +102,9 @@ func handleUpdateSettings(c echo.Context) error {
 		return err
 	}
 
+	// Messenger names. Duplicates are disallowed and "email" is a reserved name.
+	names := map[string]bool{emailMsgr: true}
+
 	// There should be at least one SMTP block that's enabled.
 	has := false
 	for i, s := range set.SMTP {
@@ -121,6 +133,38 @@ func handleUpdateSettings(c echo.Context) error {
 				}
 			}
 		}
+
+		// Named SMTP servers are also available as individual messengers (email-$name)
+		// that campaigns can be sent or failed over to.
+		if s.Name != "" {
+			n := reAlphaNum.ReplaceAllString(strings.ToLower(s.Name), "")
+			if len(n) == 0 {
+				return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("settings.invalidMessengerName"))
+			}
+
+			name := emailMsgr + "-" + n
+			if _, ok := names[name]; ok {
+				return echo.NewHTTPError(http.StatusBadRequest,
+					app.i18n.Ts("settings.duplicateMessengerName", "name", name))
+			}
+			set.SMTP[i].Name = n
+			names[name] = true
+		}
+
+		// The warm-up ramp should have a start date and positive daily volumes.
+		if s.Warmup.Enabled {
+			_, err := time.Parse("2006-01-02", s.Warmup.Start)
+			ok := err == nil && len(s.Warmup.Schedule) > 0
+			for _, n := range s.Warmup.Schedule {
+				ok = ok && n > 0
+			}
+			if !ok {
+				return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("settings.smtp.invalidWarmup", "host", s.Host))
+			}
+		}
+		if set.SMTP[i].Warmup.Schedule == nil {
+			set.SMTP[i].Warmup.Schedule = []int{}
+		}
 	}
 	if !has {
 		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("settings.errorNoSMTP"))
@@ -157,10 +201,7 @@ func handleUpdateSettings(c echo.Context) error {
 		}
 	}
 
-	// Validate and sanitize postback Messenger names. Duplicates are disallowed
-	// and "email" is a reserved name.
-	names := map[string]bool{emailMsgr: true}
-
+	// Validate and sanitize postback Messenger names.
 	for i, m := range set.Messengers {
 		// UUID to keep track of password changes similar to the SMTP logic above.
 		if m.UUID == "" {
@@ -184,10 +225,47 @@ func handleUpdateSettings(c echo.Context) error {
 			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("settings.invalidMessengerName"))
 		}
 
+		switch m.Channel {
+		case "", models.SubscriberChannelPhone, models.SubscriberChannelPush, models.SubscriberChannelMessenger:
+		default:
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "channel"))
+		}
+
 		set.Messengers[i].Name = name
 		names[name] = true
 	}
 
+	// Webhooks. Secrets are kept track of by UUID like SMTP passwords.
+	for i, h := range set.Webhooks {
+		if h.UUID == "" {
+			set.Webhooks[i].UUID = uuid.Must(uuid.NewV4()).String()
+		}
+
+		if h.Secret == "" {
+			for _, c := range cur.Webhooks {
+				if h.UUID == c.UUID {
+					set.Webhooks[i].Secret = c.Secret
+				}
+			}
+		}
+
+		h.URL = strings.TrimSpace(h.URL)
+		if u, err := url.Parse(h.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("settings.webhooks.invalidURL", "name", h.URL))
+		}
+		set.Webhooks[i].URL = h.URL
+		set.Webhooks[i].Name = strings.TrimSpace(h.Name)
+
+		for _, e := range h.Events {
+			if !isWebhookEvent(e) {
+				return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("settings.webhooks.invalidEvent", "name", e))
+			}
+		}
+		if h.Events == nil {
+			set.Webhooks[i].Events = []string{}
+		}
+	}
+
 	// S3 password?
 	if set.UploadS3AwsSecretAccessKey == "" {
 		set.UploadS3AwsSecretAccessKey = cur.UploadS3AwsSecretAccessKey
@@ -201,6 +279,9 @@ func handleUpdateSettings(c echo.Context) error {
 	if set.SecurityCaptchaSecret == "" {
 		set.SecurityCaptchaSecret = cur.SecurityCaptchaSecret
 	}
+	if set.AppMJMLPassword == "" {
+		set.AppMJMLPassword = cur.AppMJMLPassword
+	}
 
 	for n, v := range set.UploadExtensions {
 		set.UploadExtensions[n] = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(v), "."))
@@ -216,6 +297,239 @@ func handleUpdateSettings(c echo.Context) error {
 	}
 	set.DomainBlocklist = doms
 
+	// Seed addresses.
+	seeds := make([]string, 0, len(set.AppSeedEmails))
+	for _, e := range set.AppSeedEmails {
+		em, err := app.importer.SanitizeEmail(e)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("settings.general.invalidSeedEmail", "name", e))
+		}
+		seeds = append(seeds, em)
+	}
+	set.AppSeedEmails = seeds
+
+	// Subscriber attributes that are searched.
+	searchAttribs := make([]string, 0, len(set.AppSearchAttribs))
+	for _, a := range set.AppSearchAttribs {
+		a = strings.TrimSpace(a)
+		if a == "" || strSliceContains(a, searchAttribs) {
+			continue
+		}
+		if !strHasLen(a, 1, stdInputMaxLen) {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("settings.general.invalidAttrib", "name", a))
+		}
+		searchAttribs = append(searchAttribs, a)
+	}
+	set.AppSearchAttribs = searchAttribs
+
+	// Test variants have unique names and their own seed addresses.
+	testVars := make(map[string]bool, len(set.AppTestVariants))
+	for i, v := range set.AppTestVariants {
+		v.Name = strings.TrimSpace(v.Name)
+		if !strHasLen(v.Name, 1, stdInputMaxLen) || testVars[v.Name] {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("settings.general.invalidTestVariant", "name", v.Name))
+		}
+		testVars[v.Name] = true
+
+		emails := make([]string, 0, len(v.Emails))
+		for _, e := range v.Emails {
+			em, err := app.importer.SanitizeEmail(e)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("settings.general.invalidSeedEmail", "name", e))
+			}
+			emails = append(emails, em)
+		}
+		v.Emails = emails
+		v.SubjectPrefix = strings.TrimSpace(v.SubjectPrefix)
+		set.AppTestVariants[i] = v
+	}
+
+	// Attributes in the schema have unique names, known types, and defaults
+	// of their type.
+	attribNames := make(map[string]bool, len(set.AppAttribSchema))
+	for i, f := range set.AppAttribSchema {
+		f.Name = strings.TrimSpace(f.Name)
+		if !strHasLen(f.Name, 1, stdInputMaxLen) || attribNames[f.Name] {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("settings.general.invalidAttrib", "name", f.Name))
+		}
+		attribNames[f.Name] = true
+
+		switch f.Type {
+		case models.AttribTypeString, models.AttribTypeNumber, models.AttribTypeBool, models.AttribTypeDate:
+			f.Options = nil
+		case models.AttribTypeEnum:
+			if len(f.Options) == 0 {
+				return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("settings.general.invalidAttrib", "name", f.Name))
+			}
+		default:
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("settings.general.invalidAttrib", "name", f.Name))
+		}
+
+		// An empty default is no default.
+		if s, ok := f.Default.(string); ok && s == "" {
+			f.Default = nil
+		}
+		if f.Default != nil {
+			v, ok := f.Check(f.Default)
+			if !ok {
+				return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("settings.general.invalidAttribDefault", "name", f.Name))
+			}
+			f.Default = v
+		}
+		set.AppAttribSchema[i] = f
+	}
+
+	// Attribute triggers run at least one action with a transactional
+	// template and a list that exist.
+	for i, t := range set.AppAttribTriggers {
+		t.Attrib = strings.TrimSpace(t.Attrib)
+		t.Value = strings.TrimSpace(t.Value)
+		if !strHasLen(t.Attrib, 1, stdInputMaxLen) || (t.TemplateID < 1 && t.ListID < 1) {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("settings.general.invalidAttribTrigger", "name", t.Attrib))
+		}
+		if t.TemplateID > 0 {
+			if tpl, err := app.core.GetTemplate(t.TemplateID, true); err != nil || tpl.Type != models.TemplateTypeTx {
+				return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("settings.general.invalidAttribTrigger", "name", t.Attrib))
+			}
+		}
+		if t.ListID > 0 {
+			if _, err := app.core.GetList(t.ListID, ""); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("settings.general.invalidAttribTrigger", "name", t.Attrib))
+			}
+		}
+		set.AppAttribTriggers[i] = t
+	}
+
+	// Frequencies and topics in the preference center.
+	freqs := make([]string, 0, len(set.PrivacyFrequencies))
+	for _, v := range set.PrivacyFrequencies {
+		if v = strings.TrimSpace(v); v != "" && !strSliceContains(v, freqs) {
+			freqs = append(freqs, v)
+		}
+	}
+	set.PrivacyFrequencies = freqs
+
+	topics := make([]string, 0, len(set.PrivacyTopics))
+	for _, v := range set.PrivacyTopics {
+		if v = strings.TrimSpace(v); v != "" && !strSliceContains(v, topics) {
+			topics = append(topics, v)
+		}
+	}
+	set.PrivacyTopics = topics
+
+	// Link and view tracking domains are root URLs, eg: https://track.site.com
+	trackDoms := make([]string, 0, len(set.PrivacyTrackingDomains))
+	for _, d := range set.PrivacyTrackingDomains {
+		d = strings.TrimRight(strings.TrimSpace(d), "/")
+		if u, err := url.Parse(d); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("settings.privacy.invalidTrackingDomain", "name", d))
+		}
+		trackDoms = append(trackDoms, d)
+	}
+	set.PrivacyTrackingDomains = trackDoms
+
+	if set.PrivacySoftDeletePurgeDays < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "soft_delete_purge_days"))
+	}
+
+	// List hygiene rules.
+	if set.PrivacyHygieneUnconfirmedDays < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "hygiene_unconfirmed_days"))
+	}
+	if set.PrivacyHygieneUnengagedMonths < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "hygiene_unengaged_months"))
+	}
+	if set.PrivacyHygieneBlocklistedDays < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "hygiene_blocklisted_days"))
+	}
+
+	// Without individual tracking, views and clicks aren't recorded against
+	// subscribers and every subscriber would be unengaged.
+	if set.PrivacyHygieneUnengagedMonths > 0 && !set.PrivacyIndividualTracking {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("settings.privacy.hygieneNeedsTracking"))
+	}
+
+	// Disposable e-mail domains list.
+	set.PrivacyDisposableDomainsURL = strings.TrimSpace(set.PrivacyDisposableDomainsURL)
+	if d := set.PrivacyDisposableDomainsURL; d != "" {
+		if u, err := url.Parse(d); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "disposable_domains_url"))
+		}
+	}
+
+	// Per recipient domain rate limits.
+	for i, d := range set.AppDomainLimits {
+		dom := strings.TrimPrefix(strings.TrimSpace(strings.ToLower(d.Domain)), "@")
+		if dur, _ := time.ParseDuration(d.Duration); dom == "" || d.Rate < 1 || dur < time.Second {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("settings.performance.invalidDomainLimit", "name", d.Domain))
+		}
+		set.AppDomainLimits[i].Domain = dom
+	}
+
+	// Messenger send quotas.
+	for i, q := range set.AppMessengerQuotas {
+		name := strings.TrimSpace(q.Messenger)
+		if name == "" || q.Daily < 0 || q.Monthly < 0 || (q.Daily == 0 && q.Monthly == 0) ||
+			(q.Action != models.QuotaActionQueue && q.Action != models.QuotaActionRefuse) {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("settings.performance.invalidQuota", "name", q.Messenger))
+		}
+		set.AppMessengerQuotas[i].Messenger = name
+	}
+
+	// Subscriber frequency caps and quiet hours.
+	if set.AppFrequencyCapAction == "" {
+		set.AppFrequencyCapAction = models.FrequencyCapActionSkip
+	}
+	if set.AppFrequencyCapDaily < 0 || set.AppFrequencyCapWeekly < 0 ||
+		(set.AppFrequencyCapAction != models.FrequencyCapActionSkip && set.AppFrequencyCapAction != models.FrequencyCapActionDefer) {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "app.frequency_cap"))
+	}
+	set.AppQuietHoursStart = strings.TrimSpace(set.AppQuietHoursStart)
+	set.AppQuietHoursEnd = strings.TrimSpace(set.AppQuietHoursEnd)
+	if err := manager.ValidateQuietHours(manager.QuietHours{Start: set.AppQuietHoursStart, End: set.AppQuietHoursEnd}); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("settings.performance.invalidQuietHours", "error", err.Error()))
+	}
+
+	// Validate the default timezone.
+	set.AppDefaultTimezone = strings.TrimSpace(set.AppDefaultTimezone)
+	if set.AppDefaultTimezone == "" {
+		set.AppDefaultTimezone = "UTC"
+	}
+	if _, err := time.LoadLocation(set.AppDefaultTimezone); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("settings.invalidTimezone", "name", set.AppDefaultTimezone))
+	}
+
+	// Validate the attachment scanner.
+	if set.SecurityScanAttachments {
+		d, err := time.ParseDuration(set.SecurityScanTimeout)
+		if err == nil {
+			_, err = avscan.New(avscan.Opt{Type: set.SecurityScanType, URL: set.SecurityScanURL, Timeout: d})
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("settings.security.invalidScanner", "error", err.Error()))
+		}
+	}
+
+	// Validate the MJML compiler.
+	set.AppMJMLURL = strings.TrimSpace(set.AppMJMLURL)
+	if set.AppMJMLURL != "" {
+		d, err := time.ParseDuration(set.AppMJMLTimeout)
+		if err == nil {
+			_, err = mjml.New(mjml.Opt{URL: set.AppMJMLURL, Timeout: d})
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("settings.general.invalidMJML", "error", err.Error()))
+		}
+	}
+
+	// Validate the template gallery.
+	set.AppTemplateGalleryURL = strings.TrimSpace(set.AppTemplateGalleryURL)
+	if set.AppTemplateGalleryURL != "" {
+		if _, err := gallery.New(set.AppTemplateGalleryURL, 0); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("settings.general.invalidTemplateGallery", "error", err.Error()))
+		}
+	}
+
 	// Validate slow query caching cron.
 	if set.CacheSlowQueries {
 		if _, err := cron.ParseStandard(set.CacheSlowQueriesInterval); err != nil {
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// subEmailVerify contains the data of the verification e-mail that's sent
+// to a new alternate e-mail of a subscriber.
+type subEmailVerify struct {
+	models.Subscriber
+
+	Email     string
+	VerifyURL string
+}
+
+// handleGetSubscriberEmails retrieves the alternate e-mails of a subscriber.
+func handleGetSubscriberEmails(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	out, err := app.core.GetSubscriberEmails(id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleAddSubscriberEmail adds an alternate e-mail to a subscriber and sends
+// a verification link to it. The e-mail can be used to find the subscriber
+// and be made their primary e-mail once it's verified.
+func handleAddSubscriberEmail(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+		req   struct {
+			Email string `json:"email"`
+		}
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	sub, err := app.core.GetSubscriber(id, "", "")
+	if err != nil {
+		return err
+	}
+
+	if len(req.Email) > 1000 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("subscribers.invalidEmail"))
+	}
+	em, err := app.importer.SanitizeSubscriberEmail(req.Email)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if strings.EqualFold(em, sub.Email) {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("subscribers.emailIsPrimary"))
+	}
+
+	out, err := app.core.AddSubscriberEmail(sub.ID, em)
+	if err != nil {
+		return err
+	}
+
+	if err := sendSubscriberEmailVerification(sub, out, app); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleResendSubscriberEmailVerification renews the token of an unverified
+// alternate e-mail of a subscriber and sends the verification link again.
+func handleResendSubscriberEmailVerification(c echo.Context) error {
+	var (
+		app        = c.Get("app").(*App)
+		id, _      = strconv.Atoi(c.Param("id"))
+		emailID, _ = strconv.Atoi(c.Param("emailID"))
+	)
+
+	if id < 1 || emailID < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	sub, err := app.core.GetSubscriber(id, "", "")
+	if err != nil {
+		return err
+	}
+
+	em, ok, err := app.core.GetSubscriberEmail(sub.ID, emailID, "")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			app.i18n.Ts("globals.messages.notFound", "name", "{subscribers.alternateEmails}"))
+	}
+	if em.VerifiedAt.Valid {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("subscribers.emailAlreadyVerified"))
+	}
+
+	out, err := app.core.AddSubscriberEmail(sub.ID, em.Email)
+	if err != nil {
+		return err
+	}
+
+	if err := sendSubscriberEmailVerification(sub, out, app); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleSetPrimarySubscriberEmail swaps a verified alternate e-mail of a
+// subscriber with their primary e-mail.
+func handleSetPrimarySubscriberEmail(c echo.Context) error {
+	var (
+		app        = c.Get("app").(*App)
+		id, _      = strconv.Atoi(c.Param("id"))
+		emailID, _ = strconv.Atoi(c.Param("emailID"))
+	)
+
+	if id < 1 || emailID < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	if err := app.core.SetPrimarySubscriberEmail(id, emailID); err != nil {
+		return err
+	}
+
+	out, err := app.core.GetSubscriber(id, "", "")
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleDeleteSubscriberEmail deletes an alternate e-mail of a subscriber.
+func handleDeleteSubscriberEmail(c echo.Context) error {
+	var (
+		app        = c.Get("app").(*App)
+		id, _      = strconv.Atoi(c.Param("id"))
+		emailID, _ = strconv.Atoi(c.Param("emailID"))
+	)
+
+	if id < 1 || emailID < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	if err := app.core.DeleteSubscriberEmail(id, emailID); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// sendSubscriberEmailVerification sends the verification link of an
+// alternate e-mail to it.
+func sendSubscriberEmailVerification(sub models.Subscriber, em models.SubscriberEmail, app *App) error {
+	out := subEmailVerify{
+		Subscriber: sub,
+		Email:      em.Email,
+		VerifyURL:  fmt.Sprintf(app.constants.EmailVerifyURL, em.Token.String),
+	}
+	if err := app.sendNotification([]string{em.Email}, app.i18n.T("subscribers.emailVerifySubject"), notifSubscriberEmailVerify, out); err != nil {
+		app.log.Printf("error sending e-mail verification for subscriber %d (%s): %s", sub.ID, sub.UUID, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, app.i18n.T("subscribers.errorSendingEmailVerify"))
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"time"
+
+	"github.com/knadh/listmonk/models"
+)
+
+// Interval at which the list hygiene rules are applied.
+const subHygieneInterval = time.Hour
+
+// hygieneRules returns the list hygiene rules in the settings.
+func hygieneRules(app *App) models.HygieneRules {
+	return models.HygieneRules{
+		UnconfirmedDays: app.constants.Privacy.HygieneUnconfirmedDays,
+		UnengagedMonths: app.constants.Privacy.HygieneUnengagedMonths,
+		BlocklistedDays: app.constants.Privacy.HygieneBlocklistedDays,
+	}
+}
+
+// runSubscriberHygiene periodically deletes stale unconfirmed subscriptions,
+// unsubscribes unengaged subscribers, and deletes old blocklisted subscribers
+// as per the list hygiene rules in the settings.
+func runSubscriberHygiene(interval time.Duration, app *App) {
+	r := hygieneRules(app)
+	if r.UnconfirmedDays < 1 && r.UnengagedMonths < 1 && r.BlocklistedDays < 1 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		res, err := app.core.RunSubscriberHygiene(r, false)
+		if err != nil {
+			continue
+		}
+		if res.UnconfirmedSubscriptions > 0 || res.UnengagedSubscribers > 0 || res.BlocklistedSubscribers > 0 {
+			app.log.Printf("list hygiene: deleted %d unconfirmed subscriptions, unsubscribed %d unengaged subscribers, deleted %d blocklisted subscribers",
+				res.UnconfirmedSubscriptions, res.UnengagedSubscribers, res.BlocklistedSubscribers)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// Interval at which the progress of a bulk subscriber job is recorded.
+const subscriberJobSaveInterval = time.Second * 2
+
+// handleGetSubscriberJobs retrieves the bulk subscriber jobs, latest first.
+func handleGetSubscriberJobs(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		pg  = app.paginator.NewFromURL(c.Request().URL.Query())
+	)
+
+	res, total, err := app.core.QuerySubscriberJobs(pg.Offset, pg.Limit)
+	if err != nil {
+		return err
+	}
+	for i := range res {
+		res[i] = checkSubscriberJob(res[i], app)
+	}
+
+	out := models.PageResults{
+		Results: res,
+		Total:   total,
+		Page:    pg.Page,
+		PerPage: pg.PerPage,
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleGetSubscriberJob retrieves a bulk subscriber job.
+func handleGetSubscriberJob(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	out, err := app.core.GetSubscriberJob(id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{checkSubscriberJob(out, app)})
+}
+
+// handleCancelSubscriberJob stops a running bulk subscriber job. The
+// subscribers that have already been processed remain so.
+func handleCancelSubscriberJob(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	app.Lock()
+	stop, ok := app.subscriberJobs[id]
+	if ok {
+		select {
+		case <-stop:
+		default:
+			close(stop)
+		}
+	}
+	app.Unlock()
+
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("subscribers.jobNotRunning"))
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// startSubscriberJob records a bulk action on the subscribers that match
+// a query and runs it in the background.
+func startSubscriberJob(j models.SubscriberJob, c echo.Context, app *App) error {
+	// The admin user who started the job, if auth is enabled.
+	j.CreatedBy, _, _ = c.Request().BasicAuth()
+
+	out, err := app.core.StartSubscriberJob(j)
+	if err != nil {
+		return err
+	}
+
+	stop := make(chan struct{})
+	app.Lock()
+	app.subscriberJobs[out.ID] = stop
+	app.Unlock()
+
+	go runSubscriberJob(out, stop, app)
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// runSubscriberJob performs the action of a bulk subscriber job on the
+// subscribers that existed when it was started, in batches of ID ranges,
+// until it's done or stopped.
+func runSubscriberJob(j models.SubscriberJob, stop chan struct{}, app *App) {
+	lastSave := time.Now()
+
+	finish := func(status, errMsg string) {
+		j.Status, j.Error = status, errMsg
+
+		// Errors are logged by core.
+		_ = app.core.UpdateSubscriberJob(j)
+
+		app.Lock()
+		delete(app.subscriberJobs, j.ID)
+		app.Unlock()
+	}
+
+	fail := func(err error) {
+		msg := err.Error()
+		if e, ok := err.(*echo.HTTPError); ok {
+			msg = fmt.Sprintf("%v", e.Message)
+		}
+		finish(models.SubscriberJobStatusFailed, msg)
+	}
+
+	maxID, err := app.core.GetMaxSubscriberID()
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	for fromID := 0; fromID < maxID; fromID += app.constants.DBBatchSize {
+		select {
+		case <-stop:
+			finish(models.SubscriberJobStatusCancelled, "")
+			return
+		default:
+		}
+
+		n, err := app.core.RunSubscriberJobBatch(j, fromID, fromID+app.constants.DBBatchSize)
+		if err != nil {
+			fail(err)
+			return
+		}
+		j.Processed += n
+
+		if time.Since(lastSave) >= subscriberJobSaveInterval {
+			_ = app.core.UpdateSubscriberJob(j)
+			lastSave = time.Now()
+		}
+	}
+
+	finish(models.SubscriberJobStatusFinished, "")
+}
+
+// checkSubscriberJob marks a job that was interrupted, eg: by a restart,
+// as no longer running.
+func checkSubscriberJob(j models.SubscriberJob, app *App) models.SubscriberJob {
+	if j.Status != models.SubscriberJobStatusRunning {
+		return j
+	}
+
+	app.Lock()
+	_, ok := app.subscriberJobs[j.ID]
+	app.Unlock()
+
+	if !ok {
+		j.Status = models.SubscriberJobStatusCancelled
+	}
+
+	return j
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// Maximum length of a subscriber note.
+const subscriberNoteMaxLen = 10000
+
+type subscriberNoteReq struct {
+	Note string `json:"note"`
+}
+
+// handleGetSubscriberNotes retrieves the notes of a subscriber, or those of
+// all subscribers, optionally filtered by the text in the query param, latest first.
+func handleGetSubscriberNotes(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		pg    = app.paginator.NewFromURL(c.Request().URL.Query())
+		id, _ = strconv.Atoi(c.Param("id"))
+		query = strings.TrimSpace(c.FormValue("query"))
+	)
+
+	if c.Param("id") != "" && id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	if query != "" {
+		query = "%" + query + "%"
+	}
+
+	res, total, err := app.core.QuerySubscriberNotes(id, query, pg.Offset, pg.Limit)
+	if err != nil {
+		return err
+	}
+
+	out := models.PageResults{
+		Results: res,
+		Total:   total,
+		Page:    pg.Page,
+		PerPage: pg.PerPage,
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleCreateSubscriberNote records a note on a subscriber by the admin user.
+func handleCreateSubscriberNote(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	var req subscriberNoteReq
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	note, err := validateSubscriberNote(req.Note, app)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	// The admin user who wrote the note, if auth is enabled.
+	author, _, _ := c.Request().BasicAuth()
+
+	out, err := app.core.CreateSubscriberNote(id, author, note)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleUpdateSubscriberNote updates the text of a subscriber's note.
+func handleUpdateSubscriberNote(c echo.Context) error {
+	var (
+		app       = c.Get("app").(*App)
+		id, _     = strconv.Atoi(c.Param("id"))
+		noteID, _ = strconv.Atoi(c.Param("noteID"))
+	)
+
+	if id < 1 || noteID < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	var req subscriberNoteReq
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	note, err := validateSubscriberNote(req.Note, app)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	out, err := app.core.UpdateSubscriberNote(id, noteID, note)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleDeleteSubscriberNote deletes a subscriber's note.
+func handleDeleteSubscriberNote(c echo.Context) error {
+	var (
+		app       = c.Get("app").(*App)
+		id, _     = strconv.Atoi(c.Param("id"))
+		noteID, _ = strconv.Atoi(c.Param("noteID"))
+	)
+
+	if id < 1 || noteID < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	if err := app.core.DeleteSubscriberNote(id, noteID); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+func validateSubscriberNote(note string, app *App) (string, error) {
+	note = strings.TrimSpace(note)
+	if !strHasLen(note, 1, subscriberNoteMaxLen) {
+		return "", errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "note"))
+	}
+
+	return note, nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"time"
+)
+
+// Interval at which soft-deleted subscribers past their retention are purged.
+const subPurgeInterval = time.Hour
+
+// purgeDeletedSubscribers periodically deletes the soft-deleted subscribers that
+// have been in the trash for longer than the configured number of days.
+func purgeDeletedSubscribers(interval time.Duration, app *App) {
+	days := app.constants.Privacy.SoftDeletePurgeDays
+	if days < 1 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		n, err := app.core.PurgeDeletedSubscribers(days)
+		if err != nil {
+			continue
+		}
+		if n > 0 {
+			app.log.Printf("purged %d deleted subscribers", n)
+		}
+	}
+}
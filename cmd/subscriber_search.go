@@ -0,0 +1,81 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Number of subscribers whose search text is recomputed in one go.
+const subSearchReindexBatchSize = 10000
+
+// Characters that are stripped from search terms as they're operators in
+// full-text search queries.
+var reSearchTerm = regexp.MustCompile(`[^\pL\pN@._+\-]`)
+
+// searchSubQuery narrows down a subscriber query expression to the subscribers
+// whose e-mail, name, or searched attributes match a search string. The words
+// in it are matched as prefixes with full-text search, and the string as a
+// substring or a fuzzy match with trigrams, all of which are indexed.
+func searchSubQuery(query, search string) string {
+	// % is stripped as the expression is interpolated into query templates
+	// with %placeholder%s.
+	search = strings.ToLower(strings.TrimSpace(strings.ReplaceAll(search, "%", "")))
+	if search == "" {
+		return query
+	}
+
+	// Prefix lexemes of each word, eg: 'john':* & 'doe':*
+	var terms []string
+	for _, w := range strings.Fields(search) {
+		if w = reSearchTerm.ReplaceAllString(w, ""); w != "" {
+			terms = append(terms, "'"+w+"':*")
+		}
+	}
+
+	// Escape the wildcards in the substring match.
+	like := strings.NewReplacer(`\`, `\\`, "_", `\_`).Replace(search)
+
+	conds := []string{
+		"subscribers.search_text LIKE ('%' || " + pq.QuoteLiteral(like) + " || '%')",
+		pq.QuoteLiteral(search) + " <% subscribers.search_text",
+	}
+	if len(terms) > 0 {
+		conds = append(conds, "TO_TSVECTOR('simple', subscribers.search_text) @@ TO_TSQUERY('simple', "+
+			pq.QuoteLiteral(strings.Join(terms, " & "))+")")
+	}
+	cond := "(" + strings.Join(conds, " OR ") + ")"
+
+	query = sanitizeSQLExp(query)
+	if query == "" {
+		return cond
+	}
+
+	return cond + " AND (" + query + ")"
+}
+
+// reindexSubscriberSearch recomputes the search text of all subscribers in
+// batches if the searched attributes have changed since it was last computed.
+func reindexSubscriberSearch(app *App) {
+	if strings.Join(app.constants.SearchAttribs, ",") == strings.Join(app.constants.SearchAttribsIndexed, ",") {
+		return
+	}
+
+	maxID, err := app.core.GetMaxSubscriberID()
+	if err != nil {
+		return
+	}
+
+	app.log.Printf("reindexing subscriber search with attributes: %v", app.constants.SearchAttribs)
+	for fromID := 0; fromID < maxID; fromID += subSearchReindexBatchSize {
+		if _, err := app.core.ReindexSubscriberSearch(fromID, fromID+subSearchReindexBatchSize); err != nil {
+			return
+		}
+	}
+
+	if err := app.core.SetSubscriberSearchIndexed(app.constants.SearchAttribs); err != nil {
+		return
+	}
+	app.log.Println("finished reindexing subscriber search")
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+// Maximum length of a subscriber tag.
+const tagMaxLen = 100
+
+var errInvalidTag = errors.New("invalid tag")
+
+// handleGetSubscriberTags returns all the tags on subscribers with the
+// number of subscribers that have each.
+func handleGetSubscriberTags(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+	)
+
+	out, err := app.core.GetSubscriberTags()
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleRenameSubscriberTag renames a tag on all subscribers and in the
+// campaigns that are sent to it.
+func handleRenameSubscriberTag(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		tag = getTagParam(c)
+		req struct {
+			Name string `json:"name"`
+		}
+	)
+
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if tag == "" || !strHasLen(name, 1, tagMaxLen) {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "name"))
+	}
+
+	if name != tag {
+		if err := app.core.RenameSubscriberTag(tag, name); err != nil {
+			return err
+		}
+	}
+
+	return handleGetSubscriberTags(c)
+}
+
+// handleDeleteSubscriberTag removes a tag from all subscribers and the
+// campaigns that are sent to it.
+func handleDeleteSubscriberTag(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		tag = getTagParam(c)
+	)
+
+	if tag == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "tag"))
+	}
+
+	if err := app.core.DeleteSubscriberTag(tag); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// handleManageSubscriberTags adds or removes tags on one or more subscribers.
+func handleManageSubscriberTags(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		req subQueryReq
+	)
+
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	if len(req.SubscriberIDs) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("subscribers.errorNoIDs"))
+	}
+
+	tags, err := sanitizeTags(req.TargetTags)
+	if err != nil || len(tags) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "target_tags"))
+	}
+
+	switch req.Action {
+	case "add":
+		err = app.core.AddSubscriberTags(req.SubscriberIDs, tags)
+	case "remove":
+		err = app.core.RemoveSubscriberTags(req.SubscriberIDs, tags)
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("subscribers.invalidAction"))
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// handleManageSubscriberTagsByQuery bulk adds or removes tags on subscribers
+// based on an arbitrary SQL expression in a background job.
+func handleManageSubscriberTagsByQuery(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		req subQueryReq
+	)
+
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	tags, err := sanitizeTags(req.TargetTags)
+	if err != nil || len(tags) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "target_tags"))
+	}
+
+	// Action.
+	var action string
+	switch req.Action {
+	case "add":
+		action = models.SubscriberJobActionTag
+	case "remove":
+		action = models.SubscriberJobActionUntag
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("subscribers.invalidAction"))
+	}
+
+	q, err := subQueryReqQuery(req, app)
+	if err != nil {
+		return err
+	}
+
+	return startSubscriberJob(models.SubscriberJob{
+		Action:  action,
+		Query:   q,
+		ListIDs: intsToInt64s(req.ListIDs),
+		Tags:    tags,
+	}, c, app)
+}
+
+// subQueryReqQuery returns the subscriber query expression of a bulk by-query
+// request, which is that of its segment if there's one, filtered by its tags.
+func subQueryReqQuery(req subQueryReq, app *App) (string, error) {
+	q, err := segmentSubQuery(req.SegmentID, req.Query, app)
+	if err != nil {
+		return "", err
+	}
+
+	tags, err := sanitizeTags(req.Tags)
+	if err != nil {
+		return "", echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "tags"))
+	}
+
+	return tagSubQuery(searchSubQuery(q, req.Search), tags), nil
+}
+
+// tagSubQuery narrows down a subscriber query expression to the subscribers
+// that have any of the given tags.
+func tagSubQuery(query string, tags []string) string {
+	if len(tags) == 0 {
+		return query
+	}
+
+	// The array literal of the tags, eg: {"a","b c"}.
+	arr, _ := pq.StringArray(tags).Value()
+	cond := "subscribers.tags && " + pq.QuoteLiteral(arr.(string)) + "::VARCHAR(100)[]"
+
+	query = sanitizeSQLExp(query)
+	if query == "" {
+		return cond
+	}
+
+	return cond + " AND (" + query + ")"
+}
+
+// sanitizeTags trims the given tags and removes empty and duplicate ones.
+// It returns an error if any of them is too long.
+func sanitizeTags(tags []string) ([]string, error) {
+	var (
+		out  = make([]string, 0, len(tags))
+		seen = make(map[string]bool, len(tags))
+	)
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		if !strHasLen(t, 1, tagMaxLen) {
+			return nil, errInvalidTag
+		}
+
+		seen[t] = true
+		out = append(out, t)
+	}
+
+	return out, nil
+}
+
+// getTagParam returns the unescaped :tag param of a request.
+func getTagParam(c echo.Context) string {
+	tag := c.Param("tag")
+	if t, err := url.PathUnescape(tag); err == nil {
+		tag = t
+	}
+
+	return strings.TrimSpace(tag)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/csv"
 	"encoding/json"
 	"errors"
@@ -13,21 +14,33 @@ import (
 	"github.com/knadh/listmonk/internal/subimporter"
 	"github.com/knadh/listmonk/models"
 	"github.com/labstack/echo/v4"
+	null "gopkg.in/volatiletech/null.v6"
 )
 
 const (
 	dummyUUID = "00000000-0000-0000-0000-000000000000"
+
+	// Number of subscribers in a random sample of a subscriber query.
+	subSampleDefault = 10
+	subSampleMax     = 10000
+
+	// Prefix of the export columns of individual attributes, eg: attribs.city.
+	subExportAttribPrefix = "attribs."
 )
 
 // subQueryReq is a "catch all" struct for reading various
 // subscriber related requests.
 type subQueryReq struct {
-	Query         string `json:"query"`
-	ListIDs       []int  `json:"list_ids"`
-	TargetListIDs []int  `json:"target_list_ids"`
-	SubscriberIDs []int  `json:"ids"`
-	Action        string `json:"action"`
-	Status        string `json:"status"`
+	Query         string   `json:"query"`
+	ListIDs       []int    `json:"list_ids"`
+	TargetListIDs []int    `json:"target_list_ids"`
+	SubscriberIDs []int    `json:"ids"`
+	Action        string   `json:"action"`
+	Status        string   `json:"status"`
+	SegmentID     int      `json:"segment_id"`
+	Search        string   `json:"search"`
+	Tags          []string `json:"tags"`
+	TargetTags    []string `json:"target_tags"`
 }
 
 // subProfileData represents a subscriber's collated data in JSON
@@ -38,6 +51,7 @@ type subProfileData struct {
 	Subscriptions json.RawMessage `db:"subscriptions" json:"subscriptions,omitempty"`
 	CampaignViews json.RawMessage `db:"campaign_views" json:"campaign_views,omitempty"`
 	LinkClicks    json.RawMessage `db:"link_clicks" json:"link_clicks,omitempty"`
+	Consents      json.RawMessage `db:"consents" json:"consents,omitempty"`
 }
 
 // subOptin contains the data that's passed to the double opt-in e-mail template.
@@ -49,6 +63,15 @@ type subOptin struct {
 	Lists    []models.List
 }
 
+// subEmailChange contains the data of the confirmation e-mail that's sent
+// to the new e-mail of a subscriber.
+type subEmailChange struct {
+	models.Subscriber
+
+	Email      string
+	ConfirmURL string
+}
+
 var (
 	dummySubscriber = models.Subscriber{
 		Email:   "demo@listmonk.app",
@@ -57,7 +80,28 @@ var (
 		Attribs: models.JSON{"city": "Bengaluru"},
 	}
 
-	subQuerySortFields = []string{"email", "name", "created_at", "updated_at"}
+	subQuerySortFields = []string{"email", "name", "engagement_score", "created_at", "updated_at"}
+
+	// Sort fields that reveal the order of the personal data masked for API tokens.
+	subPIISortFields = []string{"email", "name"}
+
+	// Columns that subscribers can be exported with.
+	subExportColumns = map[string]func(models.SubscriberExport) string{
+		"uuid":             func(s models.SubscriberExport) string { return s.UUID },
+		"email":            func(s models.SubscriberExport) string { return s.Email },
+		"name":             func(s models.SubscriberExport) string { return s.Name },
+		"attributes":       func(s models.SubscriberExport) string { return s.Attribs },
+		"status":           func(s models.SubscriberExport) string { return s.Status },
+		"tags":             func(s models.SubscriberExport) string { return strings.Join(s.Tags, ",") },
+		"external_id":      func(s models.SubscriberExport) string { return s.ExternalID.String },
+		"locale":           func(s models.SubscriberExport) string { return s.Locale },
+		"timezone":         func(s models.SubscriberExport) string { return s.Timezone },
+		"engagement_score": func(s models.SubscriberExport) string { return strconv.FormatFloat(s.EngagementScore, 'f', -1, 64) },
+		"consents":         func(s models.SubscriberExport) string { return s.Consents },
+		"created_at":       func(s models.SubscriberExport) string { return s.CreatedAt.Time.String() },
+		"updated_at":       func(s models.SubscriberExport) string { return s.UpdatedAt.Time.String() },
+	}
+	subExportDefaultColumns = []string{"uuid", "email", "name", "attributes", "status", "created_at", "updated_at"}
 
 	errSubscriberExists = errors.New("subscriber already exists")
 )
@@ -77,6 +121,62 @@ func handleGetSubscriber(c echo.Context) error {
 	if err != nil {
 		return err
 	}
+	if apiTokenMasksPII(c) {
+		out.MaskPII()
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleGetSubscriberCampaigns returns the paginated campaigns that were sent
+// to a subscriber with whether they viewed and clicked them.
+func handleGetSubscriberCampaigns(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+		pg    = app.paginator.NewFromURL(c.Request().URL.Query())
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	res, total, err := app.core.QuerySubscriberCampaigns(id, pg.Offset, pg.Limit)
+	if err != nil {
+		return err
+	}
+
+	// No results.
+	var out models.PageResults
+	if len(res) == 0 {
+		out.Results = []models.SubscriberCampaign{}
+		return c.JSON(http.StatusOK, okResp{out})
+	}
+
+	// Meta.
+	out.Results = res
+	out.Total = total
+	out.Page = pg.Page
+	out.PerPage = pg.PerPage
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleGetSubscriberConsents retrieves the consent records of a subscriber.
+func handleGetSubscriberConsents(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	out, err := app.core.GetSubscriberConsents(id)
+	if err != nil {
+		return err
+	}
 
 	return c.JSON(http.StatusOK, okResp{out})
 }
@@ -88,23 +188,52 @@ func handleQuerySubscribers(c echo.Context) error {
 		pg  = app.paginator.NewFromURL(c.Request().URL.Query())
 
 		// The "WHERE ?" bit.
-		query     = sanitizeSQLExp(c.FormValue("query"))
-		subStatus = c.FormValue("subscription_status")
-		orderBy   = c.FormValue("order_by")
-		order     = c.FormValue("order")
-		out       models.PageResults
+		query      = sanitizeSQLExp(c.FormValue("query"))
+		subStatus  = c.FormValue("subscription_status")
+		orderBy    = c.FormValue("order_by")
+		order      = c.FormValue("order")
+		deleted, _ = strconv.ParseBool(c.FormValue("deleted"))
+		out        models.PageResults
 	)
 
+	// Arbitrary SQL expressions and searches can match the masked personal data,
+	// and sorting by it can reveal it.
+	masked := apiTokenMasksPII(c)
+	if masked && (query != "" || c.FormValue("search") != "" || strSliceContains(orderBy, subPIISortFields)) {
+		return echo.NewHTTPError(http.StatusForbidden, app.i18n.T("apiTokens.notAllowed"))
+	}
+
 	// Limit the subscribers to specific lists?
 	listIDs, err := getQueryInts("list_id", c.QueryParams())
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
 	}
 
-	res, total, err := app.core.QuerySubscribers(query, listIDs, subStatus, order, orderBy, pg.Offset, pg.Limit)
+	// Query the subscribers of a saved segment?
+	if segID, _ := strconv.Atoi(c.FormValue("segment_id")); segID > 0 {
+		q, err := segmentSubQuery(segID, query, app)
+		if err != nil {
+			return err
+		}
+		query = sanitizeSQLExp(q)
+	}
+
+	// Filter by tags?
+	tags, err := sanitizeTags(c.QueryParams()["tag"])
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "tag"))
+	}
+	query = tagSubQuery(searchSubQuery(query, c.FormValue("search")), tags)
+
+	res, total, err := app.core.QuerySubscribers(query, listIDs, subStatus, deleted, order, orderBy, pg.Offset, pg.Limit)
 	if err != nil {
 		return err
 	}
+	if masked {
+		for i := range res {
+			res[i].MaskPII()
+		}
+	}
 
 	out.Query = query
 	out.Results = res
@@ -115,7 +244,68 @@ func handleQuerySubscribers(c echo.Context) error {
 	return c.JSON(http.StatusOK, okResp{out})
 }
 
-// handleExportSubscribers handles querying subscribers based on an arbitrary SQL expression.
+// handleSampleSubscribers returns a random sample of the subscribers that match
+// an arbitrary SQL expression, for spot checks and for picking holdout groups.
+// The optional seed param makes the sample repeatable.
+func handleSampleSubscribers(c echo.Context) error {
+	var (
+		app    = c.Get("app").(*App)
+		num, _ = strconv.Atoi(c.FormValue("n"))
+
+		// The "WHERE ?" bit.
+		query     = sanitizeSQLExp(c.FormValue("query"))
+		subStatus = c.FormValue("subscription_status")
+		seed      = c.FormValue("seed")
+	)
+
+	if num < 1 {
+		num = subSampleDefault
+	} else if num > subSampleMax {
+		num = subSampleMax
+	}
+	if !strHasLen(seed, 0, stdInputMaxLen) {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "seed"))
+	}
+
+	// Limit the subscribers to specific lists?
+	listIDs, err := getQueryInts("list_id", c.QueryParams())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	// Sample the subscribers of a saved segment?
+	if segID, _ := strconv.Atoi(c.FormValue("segment_id")); segID > 0 {
+		q, err := segmentSubQuery(segID, query, app)
+		if err != nil {
+			return err
+		}
+		query = sanitizeSQLExp(q)
+	}
+
+	// Filter by tags?
+	tags, err := sanitizeTags(c.QueryParams()["tag"])
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "tag"))
+	}
+	query = tagSubQuery(searchSubQuery(query, c.FormValue("search")), tags)
+
+	res, total, err := app.core.SampleSubscribers(query, listIDs, subStatus, num, seed)
+	if err != nil {
+		return err
+	}
+
+	out := struct {
+		Results models.Subscribers `json:"results"`
+		Total   int                `json:"total"`
+		Seed    string             `json:"seed"`
+	}{res, total, seed}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleExportSubscribers handles querying subscribers based on an arbitrary SQL expression
+// and streams them as CSV with the column params, where attribs.<key> columns are the values
+// of individual attributes, or the default columns.
 func handleExportSubscribers(c echo.Context) error {
 	var (
 		app = c.Get("app").(*App)
@@ -136,8 +326,50 @@ func handleExportSubscribers(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
 	}
 
+	// Export the subscribers of a saved segment?
+	if segID, _ := strconv.Atoi(c.FormValue("segment_id")); segID > 0 {
+		q, err := segmentSubQuery(segID, query, app)
+		if err != nil {
+			return err
+		}
+		query = sanitizeSQLExp(q)
+	}
+
+	// Filter by tags?
+	tags, err := sanitizeTags(c.QueryParams()["tag"])
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "tag"))
+	}
+	query = tagSubQuery(searchSubQuery(query, c.FormValue("search")), tags)
+
+	// Columns to export.
+	cols := c.QueryParams()["column"]
+	if len(cols) == 0 {
+		cols = subExportDefaultColumns
+	}
+	var (
+		attribKeys = []string{}
+
+		// Index of each column's attribute in attribKeys, or -1 for regular columns.
+		attribIdx = make([]int, len(cols))
+	)
+	for i, col := range cols {
+		if key, ok := strings.CutPrefix(col, subExportAttribPrefix); ok {
+			if !strHasLen(key, 1, stdInputMaxLen) {
+				return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "column"))
+			}
+			attribIdx[i] = len(attribKeys)
+			attribKeys = append(attribKeys, key)
+			continue
+		}
+		if _, ok := subExportColumns[col]; !ok {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "column"))
+		}
+		attribIdx[i] = -1
+	}
+
 	// Get the batched export iterator.
-	exp, err := app.core.ExportSubscribers(query, subIDs, listIDs, app.constants.DBBatchSize)
+	exp, err := app.core.ExportSubscribers(query, subIDs, listIDs, attribKeys, app.constants.DBBatchSize)
 	if err != nil {
 		return err
 	}
@@ -152,8 +384,9 @@ func handleExportSubscribers(c echo.Context) error {
 	h.Set(echo.HeaderContentDisposition, "attachment; filename="+"subscribers.csv")
 	h.Set("Content-Transfer-Encoding", "binary")
 	h.Set("Cache-Control", "no-cache")
-	wr.Write([]string{"uuid", "email", "name", "attributes", "status", "created_at", "updated_at"})
+	wr.Write(cols)
 
+	row := make([]string, len(cols))
 loop:
 	// Iterate in batches until there are no more subscribers to export.
 	for {
@@ -166,8 +399,15 @@ loop:
 		}
 
 		for _, r := range out {
-			if err = wr.Write([]string{r.UUID, r.Email, r.Name, r.Attribs, r.Status,
-				r.CreatedAt.Time.String(), r.UpdatedAt.Time.String()}); err != nil {
+			for i, col := range cols {
+				if attribIdx[i] >= 0 {
+					row[i] = r.AttribValues[attribIdx[i]]
+				} else {
+					row[i] = subExportColumns[col](r)
+				}
+			}
+
+			if err = wr.Write(row); err != nil {
 				app.log.Printf("error streaming CSV export: %v", err)
 				break loop
 			}
@@ -192,11 +432,36 @@ func handleCreateSubscriber(c echo.Context) error {
 		return err
 	}
 
+	// Subscribers added with API tokens have to confirm their subscriptions,
+	// and the admin only fields are ignored.
+	if _, ok := c.Get(apiTokenCtxKey).(models.APIToken); ok {
+		req.PreconfirmSubs = false
+		req.Tags = nil
+		req.ExternalID = null.String{}
+	}
+
 	// Validate fields.
 	req, err := app.importer.ValidateFields(req)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
+	if req.Attribs, err = app.importer.ValidateAttribs(req.Attribs); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if req.Tags, err = sanitizeTags(req.Tags); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "tags"))
+	}
+	if req.Channels, err = app.importer.ValidateChannels(req.Channels); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if req.ExternalID.String != "" && !strHasLen(req.ExternalID.String, 1, stdInputMaxLen) {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("subscribers.invalidExternalID"))
+	}
+
+	// API tokens can only add subscribers to their lists.
+	if err := checkAPITokenLists(c, req.Lists, req.ListUUIDs); err != nil {
+		return err
+	}
 
 	// Insert the subscriber into the DB.
 	sub, _, err := app.core.InsertSubscriber(req.Subscriber, req.Lists, req.ListUUIDs, req.PreconfirmSubs)
@@ -238,6 +503,36 @@ func handleUpdateSubscriber(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("subscribers.invalidName"))
 	}
 
+	attribs, err := app.importer.ValidateAttribs(req.Attribs)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	req.Attribs = attribs
+
+	// Tags are retained if they're not in the request.
+	if req.Tags != nil {
+		if req.Tags, err = sanitizeTags(req.Tags); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "tags"))
+		}
+	}
+
+	// Channels are retained if they're not in the request.
+	if req.Channels, err = app.importer.ValidateChannels(req.Channels); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	// The external ID is retained if it's not in the request.
+	if req.ExternalID.String != "" && !strHasLen(req.ExternalID.String, 1, stdInputMaxLen) {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("subscribers.invalidExternalID"))
+	}
+
+	if req.Locale, err = app.importer.SanitizeLocale(req.Locale); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if req.Timezone, err = app.importer.SanitizeTimezone(req.Timezone); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
 	out, _, err := app.core.UpdateSubscriberWithLists(id, req.Subscriber, req.Lists, nil, req.PreconfirmSubs, true)
 	if err != nil {
 		return err
@@ -246,6 +541,96 @@ func handleUpdateSubscriber(c echo.Context) error {
 	return c.JSON(http.StatusOK, okResp{out})
 }
 
+// handleUpsertSubscriberByExternalID handles the creation or modification of a
+// subscriber identified by the ID they have in an external system. If there's no
+// subscriber with the external ID, the one with the e-mail that isn't linked to
+// another external ID is updated and linked to it. Otherwise, a new subscriber is created.
+func handleUpsertSubscriberByExternalID(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		extID = strings.TrimSpace(c.Param("id"))
+		req   subimporter.SubReq
+	)
+
+	// Get and validate fields.
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	if !strHasLen(extID, 1, stdInputMaxLen) {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("subscribers.invalidExternalID"))
+	}
+	req.ExternalID = null.StringFrom(extID)
+
+	// The name is derived from the e-mail only for new subscribers.
+	hasName := strings.TrimSpace(req.Name) != ""
+
+	req, err := app.importer.ValidateFields(req)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if req.Attribs, err = app.importer.ValidateAttribs(req.Attribs); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	// Tags and channels of existing subscribers are retained if they're not in the request.
+	if req.Tags != nil {
+		if req.Tags, err = sanitizeTags(req.Tags); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "tags"))
+		}
+	}
+	if req.Channels, err = app.importer.ValidateChannels(req.Channels); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	// Look up the subscriber by the external ID and then, by the e-mail.
+	sub, err := app.core.GetSubscriberByExternalID(extID)
+	if err != nil {
+		if er, ok := err.(*echo.HTTPError); !ok || er.Code != http.StatusBadRequest {
+			return err
+		}
+
+		sub, err = app.core.GetSubscriber(0, "", req.Email)
+		if err != nil {
+			if er, ok := err.(*echo.HTTPError); !ok || er.Code != http.StatusBadRequest {
+				return err
+			}
+
+			// There's no such subscriber. Create one.
+			out, _, err := app.core.InsertSubscriber(req.Subscriber, req.Lists, req.ListUUIDs, req.PreconfirmSubs)
+			if err != nil {
+				return err
+			}
+
+			return c.JSON(http.StatusOK, okResp{out})
+		}
+
+		// The e-mail belongs to a subscriber synced from elsewhere.
+		if sub.ExternalID.Valid {
+			return echo.NewHTTPError(http.StatusConflict, app.i18n.T("subscribers.emailExists"))
+		}
+	}
+
+	if !hasName {
+		req.Name = ""
+	}
+
+	// Existing subscribers retain their locale and timezone if they're not set.
+	if req.Locale == "" {
+		req.Locale = sub.Locale
+	}
+	if req.Timezone == "" {
+		req.Timezone = sub.Timezone
+	}
+
+	out, _, err := app.core.UpdateSubscriberWithLists(sub.ID, req.Subscriber, req.Lists, req.ListUUIDs, req.PreconfirmSubs, false)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
 // handleSubscriberSendOptin sends an optin confirmation e-mail to a subscriber.
 func handleSubscriberSendOptin(c echo.Context) error {
 	var (
@@ -270,6 +655,116 @@ func handleSubscriberSendOptin(c echo.Context) error {
 	return c.JSON(http.StatusOK, okResp{true})
 }
 
+// handleResubscribeSubscriber subscribes an existing subscriber to the given
+// lists again, reactivating the subscriptions that they had unsubscribed from
+// with double opt-in.
+func handleResubscribeSubscriber(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+		req   struct {
+			ListIDs []int `json:"list_ids"`
+		}
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	if len(req.ListIDs) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("subscribers.errorNoListsGiven"))
+	}
+
+	sub, err := app.core.GetSubscriber(id, "", "")
+	if err != nil {
+		return err
+	}
+
+	hasOptin, err := app.core.ResubscribeSubscriber(sub, req.ListIDs, nil)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{struct {
+		HasOptin bool `json:"has_optin"`
+	}{hasOptin}})
+}
+
+// handleChangeSubscriberEmail starts a change of a subscriber's e-mail. The
+// e-mail is switched once the subscriber confirms the new e-mail with the link
+// that's sent to it.
+func handleChangeSubscriberEmail(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+		req   struct {
+			Email string `json:"email"`
+		}
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	sub, err := app.core.GetSubscriber(id, "", "")
+	if err != nil {
+		return err
+	}
+
+	if _, err := requestEmailChange(sub, req.Email, app); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// handleGetSubscriberEmailChange returns the pending e-mail change of a
+// subscriber, or null if there's none.
+func handleGetSubscriberEmailChange(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	out, ok, err := app.core.GetSubscriberEmailChange(id, "")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return c.JSON(http.StatusOK, okResp{nil})
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleCancelSubscriberEmailChange cancels the pending e-mail change of a subscriber.
+func handleCancelSubscriberEmailChange(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	if err := app.core.DeleteSubscriberEmailChange(id); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
 // handleBlocklistSubscribers handles the blocklisting of one or more subscribers.
 // It takes either an ID in the URI, or a list of IDs in the request body.
 func handleBlocklistSubscribers(c echo.Context) error {
@@ -393,6 +888,14 @@ func handleDeleteSubscribers(c echo.Context) error {
 		subIDs = i
 	}
 
+	// Move the subscribers to the trash instead of deleting them?
+	if app.constants.Privacy.SoftDelete {
+		if err := app.core.SoftDeleteSubscribers(subIDs); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, okResp{true})
+	}
+
 	if err := app.core.DeleteSubscribers(subIDs, nil); err != nil {
 		return err
 	}
@@ -400,8 +903,150 @@ func handleDeleteSubscribers(c echo.Context) error {
 	return c.JSON(http.StatusOK, okResp{true})
 }
 
+// handleRestoreSubscribers restores one or more soft-deleted subscribers.
+func handleRestoreSubscribers(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		req subQueryReq
+	)
+
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			app.i18n.Ts("globals.messages.errorInvalidIDs", "error", err.Error()))
+	}
+	if len(req.SubscriberIDs) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("subscribers.errorNoIDs"))
+	}
+
+	if err := app.core.RestoreSubscribers(req.SubscriberIDs); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// handleEraseSubscriber irreversibly anonymizes a subscriber on an operator's
+// request (eg: a GDPR erasure request) and records the erasure in the audit trail.
+func handleEraseSubscriber(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.missingFields", "name", "reason"))
+	}
+
+	// The admin user who erased the subscriber, if auth is enabled.
+	user, _, _ := c.Request().BasicAuth()
+
+	out, err := app.core.EraseSubscriber(id, req.Reason, user)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleGetSubscriberErasures returns the audit trail of subscriber erasures.
+func handleGetSubscriberErasures(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		pg  = app.paginator.NewFromURL(c.Request().URL.Query())
+	)
+
+	res, total, err := app.core.QuerySubscriberErasures(pg.Offset, pg.Limit)
+	if err != nil {
+		return err
+	}
+
+	out := models.PageResults{
+		Results: res,
+		Total:   total,
+		Page:    pg.Page,
+		PerPage: pg.PerPage,
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleMergeSubscribers merges duplicate subscribers into one, consolidating
+// their list subscriptions, attribs, and engagement history, and deletes them.
+func handleMergeSubscribers(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		req struct {
+			TargetID      int   `json:"target_id"`
+			SubscriberIDs []int `json:"subscriber_ids"`
+		}
+	)
+
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	if req.TargetID < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "target_id"))
+	}
+	if len(req.SubscriberIDs) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.missingFields", "name", "subscriber_ids"))
+	}
+	for _, id := range req.SubscriberIDs {
+		if id < 1 || id == req.TargetID {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "subscriber_ids"))
+		}
+	}
+
+	out, err := app.core.MergeSubscribers(req.TargetID, req.SubscriberIDs)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleGetSubscriberDuplicates returns groups of likely duplicate subscribers.
+// The optional by param is either email (default) or name.
+func handleGetSubscriberDuplicates(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		pg  = app.paginator.NewFromURL(c.Request().URL.Query())
+		by  = c.QueryParam("by")
+	)
+
+	if by != "" && by != "email" && by != "name" {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "by"))
+	}
+
+	res, total, err := app.core.QuerySubscriberDuplicates(by == "name", pg.Offset, pg.Limit)
+	if err != nil {
+		return err
+	}
+
+	out := models.PageResults{
+		Results: res,
+		Total:   total,
+		Page:    pg.Page,
+		PerPage: pg.PerPage,
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
 // handleDeleteSubscribersByQuery bulk deletes based on an
-// arbitrary SQL expression.
+// arbitrary SQL expression in a background job.
 func handleDeleteSubscribersByQuery(c echo.Context) error {
 	var (
 		app = c.Get("app").(*App)
@@ -412,15 +1057,76 @@ func handleDeleteSubscribersByQuery(c echo.Context) error {
 		return err
 	}
 
-	if err := app.core.DeleteSubscribersByQuery(req.Query, req.ListIDs); err != nil {
+	q, err := subQueryReqQuery(req, app)
+	if err != nil {
 		return err
 	}
+	req.Query = q
 
-	return c.JSON(http.StatusOK, okResp{true})
+	action := models.SubscriberJobActionDelete
+	if app.constants.Privacy.SoftDelete {
+		action = models.SubscriberJobActionSoftDelete
+	}
+
+	return startSubscriberJob(models.SubscriberJob{
+		Action:  action,
+		Query:   req.Query,
+		ListIDs: intsToInt64s(req.ListIDs),
+	}, c, app)
+}
+
+// handleRestoreSubscribersByQuery restores the soft-deleted subscribers that
+// match an arbitrary SQL expression in a background job.
+func handleRestoreSubscribersByQuery(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		req subQueryReq
+	)
+
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	q, err := subQueryReqQuery(req, app)
+	if err != nil {
+		return err
+	}
+	req.Query = q
+
+	return startSubscriberJob(models.SubscriberJob{
+		Action:  models.SubscriberJobActionRestore,
+		Query:   req.Query,
+		ListIDs: intsToInt64s(req.ListIDs),
+	}, c, app)
+}
+
+// handleValidateSubscriberQuery validates an arbitrary SQL expression for
+// querying subscribers and returns its estimated match count and plan cost.
+func handleValidateSubscriberQuery(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		req subQueryReq
+	)
+
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	if req.Status != "" && req.Status != models.SubscriptionStatusUnconfirmed &&
+		req.Status != models.SubscriptionStatusConfirmed && req.Status != models.SubscriptionStatusUnsubscribed {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "status"))
+	}
+
+	out, err := app.core.ExplainSubscriberQuery(sanitizeSQLExp(req.Query), req.ListIDs, req.Status)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
 }
 
 // handleBlocklistSubscribersByQuery bulk blocklists subscribers
-// based on an arbitrary SQL expression.
+// based on an arbitrary SQL expression in a background job.
 func handleBlocklistSubscribersByQuery(c echo.Context) error {
 	var (
 		app = c.Get("app").(*App)
@@ -431,15 +1137,21 @@ func handleBlocklistSubscribersByQuery(c echo.Context) error {
 		return err
 	}
 
-	if err := app.core.BlocklistSubscribersByQuery(req.Query, req.ListIDs); err != nil {
+	q, err := subQueryReqQuery(req, app)
+	if err != nil {
 		return err
 	}
+	req.Query = q
 
-	return c.JSON(http.StatusOK, okResp{true})
+	return startSubscriberJob(models.SubscriberJob{
+		Action:  models.SubscriberJobActionBlocklist,
+		Query:   req.Query,
+		ListIDs: intsToInt64s(req.ListIDs),
+	}, c, app)
 }
 
 // handleManageSubscriberListsByQuery bulk adds/removes/unsubscribes subscribers
-// from one or more lists based on an arbitrary SQL expression.
+// from one or more lists based on an arbitrary SQL expression in a background job.
 func handleManageSubscriberListsByQuery(c echo.Context) error {
 	var (
 		app = c.Get("app").(*App)
@@ -454,24 +1166,25 @@ func handleManageSubscriberListsByQuery(c echo.Context) error {
 			app.i18n.T("subscribers.errorNoListsGiven"))
 	}
 
-	// Action.
-	var err error
-	switch req.Action {
-	case "add":
-		err = app.core.AddSubscriptionsByQuery(req.Query, req.ListIDs, req.TargetListIDs, req.Status)
-	case "remove":
-		err = app.core.DeleteSubscriptionsByQuery(req.Query, req.ListIDs, req.TargetListIDs)
-	case "unsubscribe":
-		err = app.core.UnsubscribeListsByQuery(req.Query, req.ListIDs, req.TargetListIDs)
-	default:
-		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("subscribers.invalidAction"))
-	}
-
+	q, err := subQueryReqQuery(req, app)
 	if err != nil {
 		return err
 	}
+	req.Query = q
 
-	return c.JSON(http.StatusOK, okResp{true})
+	// Action.
+	if req.Action != models.SubscriberJobActionAdd && req.Action != models.SubscriberJobActionRemove &&
+		req.Action != models.SubscriberJobActionUnsubscribe {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("subscribers.invalidAction"))
+	}
+
+	return startSubscriberJob(models.SubscriberJob{
+		Action:        req.Action,
+		Query:         req.Query,
+		ListIDs:       intsToInt64s(req.ListIDs),
+		TargetListIDs: intsToInt64s(req.TargetListIDs),
+		SubStatus:     req.Status,
+	}, c, app)
 }
 
 // handleDeleteSubscriberBounces deletes all the bounces on a subscriber.
@@ -525,7 +1238,7 @@ func handleExportSubscriberData(c echo.Context) error {
 }
 
 // exportSubscriberData collates the data of a subscriber including profile,
-// subscriptions, campaign_views, link_clicks (if they're enabled in the config)
+// subscriptions, campaign_views, link_clicks, consents (if they're enabled in the config)
 // and returns a formatted, indented JSON payload. Either takes a numeric id
 // and an empty subUUID or takes 0 and a string subUUID.
 func exportSubscriberData(id int, subUUID string, exportables map[string]bool, app *App) (models.SubscriberExportProfile, []byte, error) {
@@ -547,6 +1260,9 @@ func exportSubscriberData(id int, subUUID string, exportables map[string]bool, a
 	if _, ok := exportables["link_clicks"]; !ok {
 		data.LinkClicks = nil
 	}
+	if _, ok := exportables["consents"]; !ok {
+		data.Consents = nil
+	}
 
 	// Marshal the data into an indented payload.
 	b, err := json.MarshalIndent(data, "", "  ")
@@ -592,11 +1308,51 @@ func getQueryInts(param string, qp url.Values) ([]int, error) {
 	return out, nil
 }
 
+// requestEmailChange validates a new e-mail for a subscriber, records the pending
+// change, sends the confirmation link to the new e-mail, and notifies the current
+// e-mail of the change. It returns the sanitized e-mail.
+func requestEmailChange(sub models.Subscriber, email string, app *App) (string, error) {
+	if len(email) > 1000 {
+		return "", echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("subscribers.invalidEmail"))
+	}
+
+	em, err := app.importer.SanitizeSubscriberEmail(email)
+	if err != nil {
+		return "", echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if strings.EqualFold(em, sub.Email) {
+		return "", echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("subscribers.emailUnchanged"))
+	}
+
+	ch, err := app.core.ChangeSubscriberEmail(sub.ID, em)
+	if err != nil {
+		return "", err
+	}
+
+	out := subEmailChange{
+		Subscriber: sub,
+		Email:      em,
+		ConfirmURL: fmt.Sprintf(app.constants.EmailChangeURL, ch.Token),
+	}
+	if err := app.sendNotification([]string{em}, app.i18n.T("subscribers.emailChangeSubject"), notifSubscriberEmailChange, out); err != nil {
+		app.log.Printf("error sending e-mail change confirmation for subscriber %d (%s): %s", sub.ID, sub.UUID, err)
+		return "", echo.NewHTTPError(http.StatusInternalServerError, app.i18n.T("subscribers.errorSendingEmailChange"))
+	}
+
+	// The change can't be made without the new e-mail, so a failed notice doesn't fail it.
+	if err := app.sendNotification([]string{sub.Email}, app.i18n.T("subscribers.emailChangeNoticeSubject"), notifSubscriberEmailNotice, out); err != nil {
+		app.log.Printf("error sending e-mail change notice for subscriber %d (%s): %s", sub.ID, sub.UUID, err)
+	}
+
+	return em, nil
+}
+
 // sendOptinConfirmationHook returns an enclosed callback that sends optin confirmation e-mails.
 // This is plugged into the 'core' package to send optin confirmations when a new subscriber is
 // created via `core.CreateSubscriber()`.
 func sendOptinConfirmationHook(app *App) func(sub models.Subscriber, listIDs []int) (int, error) {
 	return func(sub models.Subscriber, listIDs []int) (int, error) {
+		// Subscriptions that are being rejoined are included irrespective of the lists' opt-in.
 		lists, err := app.core.GetSubscriberLists(sub.ID, "", listIDs, nil, models.SubscriptionStatusUnconfirmed, models.ListOptinDouble)
 		if err != nil {
 			return 0, err
@@ -607,24 +1363,108 @@ func sendOptinConfirmationHook(app *App) func(sub models.Subscriber, listIDs []i
 			return 0, nil
 		}
 
+		// Lists with their own opt-in template, subject, or sender, or different
+		// sending defaults are confirmed in separate e-mails.
+		type optinKey struct {
+			tplID         int
+			subject, from string
+
+			defFrom, defReplyTo, defMessenger string
+		}
 		var (
-			out      = subOptin{Subscriber: sub, Lists: lists}
-			qListIDs = url.Values{}
+			keys   []optinKey
+			groups = map[optinKey][]models.List{}
 		)
-
-		// Construct the opt-in URL with list IDs.
-		for _, l := range out.Lists {
-			qListIDs.Add("l", l.UUID)
+		for _, l := range lists {
+			k := optinKey{l.OptinTemplateID.Int, l.OptinSubject, l.OptinFromEmail,
+				l.DefaultFromEmail, l.DefaultReplyTo, l.DefaultMessenger}
+			if _, ok := groups[k]; !ok {
+				keys = append(keys, k)
+			}
+			groups[k] = append(groups[k], l)
 		}
-		out.OptinURL = fmt.Sprintf(app.constants.OptinURL, sub.UUID, qListIDs.Encode())
-		out.UnsubURL = fmt.Sprintf(app.constants.UnsubURL, dummyUUID, sub.UUID)
 
-		// Send the e-mail.
-		if err := app.sendNotification([]string{sub.Email}, app.i18n.T("subscribers.optinSubject"), notifSubscriberOptin, out); err != nil {
-			app.log.Printf("error sending opt-in e-mail for subscriber %d (%s): %s", sub.ID, sub.UUID, err)
-			return 0, err
+		for _, k := range keys {
+			if err := sendOptinConfirmation(sub, groups[k], app); err != nil {
+				app.log.Printf("error sending opt-in e-mail for subscriber %d (%s): %s", sub.ID, sub.UUID, err)
+				return 0, err
+			}
 		}
 
 		return len(lists), nil
 	}
 }
+
+// sendOptinConfirmation sends an opt-in confirmation e-mail for the given lists,
+// which have the same opt-in settings and sending defaults, with the lists'
+// template, subject, and sender, if any, or the default ones.
+func sendOptinConfirmation(sub models.Subscriber, lists []models.List, app *App) error {
+	var (
+		out      = subOptin{Subscriber: sub, Lists: lists}
+		qListIDs = url.Values{}
+	)
+
+	// Construct the opt-in URL with list IDs.
+	for _, l := range out.Lists {
+		qListIDs.Add("l", l.UUID)
+	}
+	out.OptinURL = fmt.Sprintf(app.constants.OptinURL, sub.UUID, qListIDs.Encode())
+	out.UnsubURL = fmt.Sprintf(app.constants.UnsubURL, dummyUUID, sub.UUID)
+
+	l := lists[0]
+	if !l.OptinTemplateID.Valid && l.OptinSubject == "" && l.OptinFromEmail == "" && !hasListSender(l) {
+		return app.sendNotification([]string{sub.Email}, app.i18n.T("subscribers.optinSubject"), notifSubscriberOptin, out)
+	}
+
+	m := models.Message{
+		Subscriber:  sub,
+		From:        app.constants.FromEmail,
+		To:          []string{sub.Email},
+		ContentType: app.notifTpls.contentType,
+		Messenger:   emailMsgr,
+	}
+
+	// Render the list's transactional template, falling back to the default
+	// template if it's been deleted.
+	var tpl *models.Template
+	if l.OptinTemplateID.Valid {
+		t, err := app.manager.GetTpl(l.OptinTemplateID.Int)
+		if err != nil {
+			app.log.Printf("opt-in template %d of list %d not found. Using the default template.", l.OptinTemplateID.Int, l.ID)
+		} else {
+			tpl = t
+		}
+	}
+
+	if tpl != nil {
+		tx := models.TxMessage{
+			Data: map[string]interface{}{
+				"optin_url": out.OptinURL,
+				"unsub_url": out.UnsubURL,
+				"lists":     lists,
+			},
+		}
+		if err := tx.Render(sub, tpl); err != nil {
+			return err
+		}
+
+		m.Subject, m.Body = tx.Subject, tx.Body
+		m.ContentType = models.CampaignContentTypeHTML
+	} else {
+		var buf bytes.Buffer
+		if err := app.notifTpls.tpls.ExecuteTemplate(&buf, notifSubscriberOptin, out); err != nil {
+			return err
+		}
+		m.Subject, m.Body = getTplSubject(app.i18n.T("subscribers.optinSubject"), buf.Bytes())
+	}
+
+	app.setListSender(&m, l)
+	if l.OptinSubject != "" {
+		m.Subject = l.OptinSubject
+	}
+	if l.OptinFromEmail != "" {
+		m.From = l.OptinFromEmail
+	}
+
+	return app.manager.PushMessage(m)
+}
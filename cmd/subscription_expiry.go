@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+)
+
+const (
+	// Interval at which lapsed subscriptions are checked for.
+	subExpiryCheckInterval = time.Hour
+
+	// Number of subscriptions that are marked for re-permission in one go.
+	subRepermissionBatchSize = 1000
+
+	// Default number of days that subscribers have to renew a lapsed subscription.
+	repermissionGraceDefault = 14
+)
+
+// subRepermission contains the data that's passed to the re-permission e-mail template.
+type subRepermission struct {
+	models.Subscriber
+
+	RenewURL string
+	UnsubURL string
+	Lists    []models.List
+}
+
+// checkSubscriptionExpiry periodically unsubscribes the subscriptions that weren't
+// renewed within their list's grace period and sends re-permission e-mails to the
+// subscribers of lists with a subscription TTL who haven't been active within it.
+func checkSubscriptionExpiry(interval time.Duration, app *App) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		n, err := app.core.ExpireSubscriptions()
+		if err != nil {
+			continue
+		}
+		if n > 0 {
+			app.log.Printf("unsubscribed %d subscriptions that weren't renewed", n)
+		}
+
+		sendRepermissions(app)
+	}
+}
+
+// sendRepermissions marks the lapsed subscriptions in batches and sends their
+// subscribers re-permission e-mails. It stops on the first e-mail that can't
+// be sent, which is retried on the next check.
+func sendRepermissions(app *App) {
+	for {
+		subs, err := app.core.MarkSubscriptionsRepermission(subRepermissionBatchSize)
+		if err != nil || len(subs) == 0 {
+			return
+		}
+
+		for i, s := range subs {
+			if err := sendRepermission(s.SubscriberID, int64sToInts(s.ListIDs), app); err != nil {
+				app.log.Printf("error sending re-permission e-mail for subscriber %d: %v", s.SubscriberID, err)
+
+				// Unmark the subscriptions whose e-mails weren't sent so that
+				// they aren't unsubscribed.
+				for _, s := range subs[i:] {
+					_ = app.core.ClearSubscriptionsRepermission(s.SubscriberID, int64sToInts(s.ListIDs))
+				}
+				return
+			}
+		}
+	}
+}
+
+// sendRepermission sends a subscriber the e-mail to renew their subscriptions
+// to the given lists.
+func sendRepermission(subID int, listIDs []int, app *App) error {
+	sub, err := app.core.GetSubscriber(subID, "", "")
+	if err != nil {
+		return err
+	}
+
+	lists, err := app.core.GetSubscriberLists(sub.ID, "", listIDs, nil, "", "")
+	if err != nil {
+		return err
+	}
+	if len(lists) == 0 {
+		return nil
+	}
+
+	// Lists with different sending defaults are renewed in separate e-mails.
+	type senderKey struct {
+		from, replyTo, messenger string
+	}
+	var (
+		keys   []senderKey
+		groups = map[senderKey][]models.List{}
+	)
+	for _, l := range lists {
+		k := senderKey{l.DefaultFromEmail, l.DefaultReplyTo, l.DefaultMessenger}
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], l)
+	}
+
+	for _, k := range keys {
+		lists := groups[k]
+
+		// Construct the renewal URL with list IDs.
+		var (
+			out      = subRepermission{Subscriber: sub, Lists: lists}
+			qListIDs = url.Values{}
+		)
+		for _, l := range lists {
+			qListIDs.Add("l", l.UUID)
+		}
+		out.RenewURL = fmt.Sprintf(app.constants.RepermissionURL, sub.UUID, qListIDs.Encode())
+		out.UnsubURL = fmt.Sprintf(app.constants.UnsubURL, dummyUUID, sub.UUID)
+
+		if err := app.sendListNotification([]string{sub.Email}, app.i18n.T("subscribers.repermissionSubject"),
+			notifSubscriberRepermission, out, lists[0]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	subFormMaxFields  = 50
+	subFormMaxOptions = 100
+
+	// Max. number of days of stats that can be retrieved at once.
+	subFormMaxStatDays = 366
+
+	tplHostedForm = "hosted-form"
+)
+
+var (
+	regexpHexColor = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+	subFormFieldTypes = []string{models.AttribTypeString, models.AttribTypeNumber, models.AttribTypeBool,
+		models.AttribTypeDate, models.AttribTypeEnum}
+)
+
+// hostedFormTpl is the data of the hosted page of a subscription form.
+type hostedFormTpl struct {
+	publicTpl
+	Form       models.SubscriptionForm
+	Lists      []models.List
+	CaptchaKey string
+	CSS        template.CSS
+
+	// Embed renders the form without the page's header and footer for
+	// embedding in an iframe.
+	Embed bool
+
+	// Values of the submitted form that failed, its error, and the message of
+	// a successful submission.
+	Values  url.Values
+	Error   string
+	Message string
+}
+
+// handleGetSubscriptionForms handles retrieval of subscription forms.
+func handleGetSubscriptionForms(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	// Fetch one form.
+	if id > 0 {
+		out, err := app.core.GetSubscriptionForm(id, "")
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, okResp{out})
+	}
+
+	out, err := app.core.GetSubscriptionForms()
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleCreateSubscriptionForm handles subscription form creation.
+func handleCreateSubscriptionForm(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		o   = models.SubscriptionForm{Enabled: true}
+	)
+
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	o, err := validateSubscriptionForm(o, app)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	out, err := app.core.CreateSubscriptionForm(o)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleUpdateSubscriptionForm handles subscription form modification.
+func handleUpdateSubscriptionForm(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	o, err := app.core.GetSubscriptionForm(id, "")
+	if err != nil {
+		return err
+	}
+
+	// The fields and the theme are replaced as a whole.
+	o.Fields = nil
+	o.Theme = models.SubscriptionFormTheme{}
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	o, err = validateSubscriptionForm(o, app)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	out, err := app.core.UpdateSubscriptionForm(id, o)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleDeleteSubscriptionForm handles subscription form deletion.
+func handleDeleteSubscriptionForm(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	if err := app.core.DeleteSubscriptionForm(id); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// handleGetSubscriptionFormStats returns the daily views and conversions of
+// a subscription form between the given days, which default to the last 30 days.
+func handleGetSubscriptionFormStats(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+		err   error
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	to := time.Now()
+	if v := c.QueryParam("to"); v != "" {
+		if to, err = time.Parse("2006-01-02", v); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "to"))
+		}
+	}
+
+	from := to.AddDate(0, 0, -30)
+	if v := c.QueryParam("from"); v != "" {
+		if from, err = time.Parse("2006-01-02", v); err != nil || from.After(to) ||
+			to.Sub(from) > time.Hour*24*subFormMaxStatDays {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "from"))
+		}
+	}
+
+	out, err := app.core.GetSubscriptionFormStats(id, from, to)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleHostedFormPage renders the hosted page of a subscription form and
+// records a view of it.
+func handleHostedFormPage(c echo.Context) error {
+	var (
+		app  = c.Get("app").(*App)
+		uuid = c.Param("uuid")
+	)
+
+	out, ok := makeHostedFormTpl(c, uuid, app)
+	if !ok {
+		return c.Render(http.StatusNotFound, tplMessage, makeMsgTpl(app.i18n.T("public.errorTitle"), "",
+			app.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.form}")))
+	}
+
+	// Previews from the admin aren't counted.
+	if c.QueryParam("preview") == "" {
+		_ = app.core.RecordSubscriptionFormStat(out.Form.ID, 1, 0)
+	}
+
+	return c.Render(http.StatusOK, tplHostedForm, out)
+}
+
+// handleHostedForm handles subscriptions from the hosted page of a subscription
+// form. The values of the form's custom fields are set as the attributes of
+// new subscribers.
+func handleHostedForm(c echo.Context) error {
+	var (
+		app  = c.Get("app").(*App)
+		uuid = c.Param("uuid")
+	)
+
+	out, ok := makeHostedFormTpl(c, uuid, app)
+	if !ok {
+		return c.Render(http.StatusNotFound, tplMessage, makeMsgTpl(app.i18n.T("public.errorTitle"), "",
+			app.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.form}")))
+	}
+
+	params, err := c.FormParams()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidData"))
+	}
+	out.Values = params
+
+	// Renders the form again with the error.
+	fail := func(code int, msg string) error {
+		out.Error = msg
+		return c.Render(code, tplHostedForm, out)
+	}
+
+	// If there's a nonce value, a bot could've filled the form.
+	if params.Get("nonce") != "" {
+		return fail(http.StatusBadRequest, app.i18n.T("public.invalidFeature"))
+	}
+
+	// Process CAPTCHA.
+	if app.constants.Security.EnableCaptcha {
+		err, ok := app.captcha.Verify(params.Get("h-captcha-response"))
+		if err != nil {
+			app.log.Printf("Captcha request failed: %v", err)
+		}
+
+		if !ok {
+			return fail(http.StatusBadRequest, app.i18n.T("public.invalidCaptcha"))
+		}
+	}
+
+	attribs, err := makeSubFormAttribs(out.Form.Fields, params, app)
+	if err != nil {
+		return fail(http.StatusBadRequest, err.Error())
+	}
+
+	// Subscribers can only pick from the form's lists.
+	req := subFormReq{
+		Name:     params.Get("name"),
+		Email:    params.Get("email"),
+		Locale:   params.Get("locale"),
+		Timezone: params.Get("timezone"),
+	}
+	for _, l := range out.Lists {
+		if !out.Form.ChooseLists || strSliceContains(l.UUID, params["l"]) {
+			req.FormListUUIDs = append(req.FormListUUIDs, l.UUID)
+		}
+	}
+
+	hasOptin, err := subscribe(c, req, attribs, models.ConsentSourceForm)
+	if err != nil {
+		if e, ok := err.(*echo.HTTPError); ok {
+			return fail(e.Code, fmt.Sprintf("%s", e.Message))
+		}
+		return fail(http.StatusInternalServerError, err.Error())
+	}
+
+	_ = app.core.RecordSubscriptionFormStat(out.Form.ID, 0, 1)
+
+	if out.Form.RedirectURL != "" {
+		return c.Redirect(http.StatusFound, out.Form.RedirectURL)
+	}
+
+	out.Message = out.Form.SuccessMessage
+	if out.Message == "" {
+		out.Message = app.i18n.T("public.subConfirmed")
+		if hasOptin {
+			out.Message = app.i18n.T("public.subOptinPending")
+		}
+	}
+
+	return c.Render(http.StatusOK, tplHostedForm, out)
+}
+
+// handleHostedFormEmbed returns the script that embeds the hosted page of a
+// subscription form in an iframe in place of the script tag. The iframe is
+// resized to the height of the form.
+func handleHostedFormEmbed(c echo.Context) error {
+	var (
+		app  = c.Get("app").(*App)
+		uuid = c.Param("uuid")
+	)
+
+	f, err := app.core.GetSubscriptionForm(0, uuid)
+	if err != nil || !f.Enabled {
+		return echo.NewHTTPError(http.StatusNotFound, app.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.form}"))
+	}
+
+	var (
+		src, _   = json.Marshal(fmt.Sprintf("%s/subscription/form/%s?embed=true", app.constants.RootURL, f.UUID))
+		id, _    = json.Marshal(f.UUID)
+		title, _ = json.Marshal(f.Name)
+	)
+
+	js := fmt.Sprintf(`(function() {
+	var s = document.currentScript, f = document.createElement("iframe");
+	f.src = %s;
+	f.title = %s;
+	f.style.cssText = "width: 100%%; height: 400px; border: 0;";
+	window.addEventListener("message", function(e) {
+		if (e.source === f.contentWindow && e.data && e.data.listmonkForm === %s) {
+			f.style.height = e.data.height + "px";
+		}
+	});
+	s.parentNode.insertBefore(f, s);
+})();
+`, src, title, id)
+
+	return c.Blob(http.StatusOK, "application/javascript; charset=utf-8", []byte(js))
+}
+
+// makeHostedFormTpl returns the template data of the hosted page of an enabled
+// subscription form. The bool is false if there's no such form.
+func makeHostedFormTpl(c echo.Context, uuid string, app *App) (hostedFormTpl, bool) {
+	f, err := app.core.GetSubscriptionForm(0, uuid)
+	if err != nil || !f.Enabled {
+		return hostedFormTpl{}, false
+	}
+
+	var lists []models.List
+	if err := json.Unmarshal(f.Lists, &lists); err != nil || len(lists) == 0 {
+		return hostedFormTpl{}, false
+	}
+
+	out := hostedFormTpl{
+		Form:  f,
+		Lists: lists,
+		CSS:   template.CSS(f.Theme.CSS),
+		Embed: c.QueryParam("embed") == "true" || c.FormValue("embed") == "true",
+	}
+	out.Title = f.Title
+	if out.Title == "" {
+		out.Title = app.i18n.T("public.subTitle")
+	}
+	out.Description = f.Description
+
+	if app.constants.Security.EnableCaptcha {
+		out.CaptchaKey = app.constants.Security.CaptchaKey
+	}
+
+	return out, true
+}
+
+// makeSubFormAttribs returns the subscriber attributes of the values of
+// a subscription form's custom fields in a submission.
+func makeSubFormAttribs(fields models.SubscriptionFormFields, params url.Values, app *App) (models.JSON, error) {
+	attribs := models.JSON{}
+	for _, f := range fields {
+		v := strings.TrimSpace(params.Get(f.Attrib))
+
+		// Unchecked checkboxes aren't submitted.
+		if f.Type == models.AttribTypeBool {
+			if v == "" && f.Required {
+				return nil, errors.New(app.i18n.Ts("subscribers.attribRequired", "name", f.Label))
+			}
+			attribs[f.Attrib] = v != ""
+			continue
+		}
+
+		if v == "" {
+			if f.Required {
+				return nil, errors.New(app.i18n.Ts("subscribers.attribRequired", "name", f.Label))
+			}
+			continue
+		}
+
+		var val interface{} = v
+		if f.Type == models.AttribTypeNumber {
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, errors.New(app.i18n.Ts("subscribers.invalidAttrib", "name", f.Label, "type", f.Type))
+			}
+			val = n
+		} else if len(v) > stdInputMaxLen {
+			return nil, errors.New(app.i18n.Ts("subscribers.invalidAttrib", "name", f.Label, "type", f.Type))
+		}
+
+		a := models.AttribField{Name: f.Attrib, Type: f.Type, Options: f.Options}
+		out, ok := a.Check(val)
+		if !ok {
+			return nil, errors.New(app.i18n.Ts("subscribers.invalidAttrib", "name", f.Label, "type", f.Type))
+		}
+		attribs[f.Attrib] = out
+	}
+
+	return attribs, nil
+}
+
+// validateSubscriptionForm validates incoming subscription form fields.
+func validateSubscriptionForm(o models.SubscriptionForm, app *App) (models.SubscriptionForm, error) {
+	o.Name = strings.TrimSpace(o.Name)
+	if !strHasLen(o.Name, 1, stdInputMaxLen) {
+		return o, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "name"))
+	}
+
+	if len(o.ListIDs) == 0 {
+		return o, errors.New(app.i18n.T("campaigns.fieldInvalidListIDs"))
+	}
+
+	o.Title = strings.TrimSpace(o.Title)
+	o.SubmitLabel = strings.TrimSpace(o.SubmitLabel)
+	o.SuccessMessage = strings.TrimSpace(o.SuccessMessage)
+	if len(o.Title) > stdInputMaxLen || len(o.SubmitLabel) > stdInputMaxLen || len(o.SuccessMessage) > 2000 {
+		return o, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "title"))
+	}
+	o.Description = strings.TrimSpace(o.Description)
+
+	o.RedirectURL = strings.TrimSpace(o.RedirectURL)
+	if o.RedirectURL != "" {
+		if u, err := url.Parse(o.RedirectURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return o, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "redirect_url"))
+		}
+	}
+
+	// Custom fields.
+	if len(o.Fields) > subFormMaxFields {
+		return o, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "fields"))
+	}
+
+	seen := map[string]bool{}
+	for i, f := range o.Fields {
+		// The fields that are on every form, and the ones that are used by it.
+		f.Attrib = strings.TrimSpace(f.Attrib)
+		if !strHasLen(f.Attrib, 1, stdInputMaxLen) || seen[f.Attrib] ||
+			strSliceContains(f.Attrib, []string{"email", "name", "l", "nonce", "timezone", "locale", "embed", "h-captcha-response"}) {
+			return o, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "fields.attrib"))
+		}
+		seen[f.Attrib] = true
+
+		if !strSliceContains(f.Type, subFormFieldTypes) {
+			return o, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "fields.type"))
+		}
+
+		f.Label = strings.TrimSpace(f.Label)
+		if f.Label == "" {
+			f.Label = f.Attrib
+		}
+		f.Placeholder = strings.TrimSpace(f.Placeholder)
+		if len(f.Label) > stdInputMaxLen || len(f.Placeholder) > stdInputMaxLen {
+			return o, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "fields.label"))
+		}
+
+		var opts []string
+		if f.Type == models.AttribTypeEnum {
+			for _, v := range f.Options {
+				if v = strings.TrimSpace(v); v != "" && !strSliceContains(v, opts) {
+					opts = append(opts, v)
+				}
+			}
+			if len(opts) == 0 || len(opts) > subFormMaxOptions {
+				return o, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "fields.options"))
+			}
+		}
+		f.Options = opts
+
+		o.Fields[i] = f
+	}
+
+	// Theme. Colors are put in CSS and have to be hex codes.
+	t := o.Theme
+	for _, c := range []string{t.AccentColor, t.BackgroundColor, t.TextColor} {
+		if c != "" && !regexpHexColor.MatchString(c) {
+			return o, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "theme"))
+		}
+	}
+
+	return o, nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/knadh/listmonk/internal/gallery"
+	"github.com/knadh/listmonk/internal/media"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+const galleryTimeout = time.Second * 15
+
+type galleryImportReq struct {
+	ID string `json:"id"`
+
+	// Optional name of the new template. Default is the gallery's name.
+	Name string `json:"name"`
+}
+
+type galleryImportResp struct {
+	Template models.Template `json:"template"`
+	Media    []media.Media   `json:"media"`
+}
+
+// handleGetTemplateGallery returns the index of templates in the
+// configured remote template gallery.
+func handleGetTemplateGallery(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	g, err := getGallery(app)
+	if err != nil {
+		return err
+	}
+
+	out, err := g.Index()
+	if err != nil {
+		app.log.Printf("error fetching template gallery: %v", err)
+		return echo.NewHTTPError(http.StatusBadGateway, app.i18n.Ts("templates.gallery.errorFetching", "error", err.Error()))
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleImportGalleryTemplate imports a template from the remote template
+// gallery. The files that the template's body references in the gallery,
+// such as images, are uploaded to the media library and the references are
+// replaced with their media URLs.
+func handleImportGalleryTemplate(c echo.Context) error {
+	app := c.Get("app").(*App)
+
+	var req galleryImportReq
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	if req.ID == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.missingFields", "name", "id"))
+	}
+
+	g, err := getGallery(app)
+	if err != nil {
+		return err
+	}
+
+	t, body, err := g.Template(req.ID)
+	if err != nil {
+		app.log.Printf("error fetching gallery template %s: %v", req.ID, err)
+		return echo.NewHTTPError(http.StatusBadGateway, app.i18n.Ts("templates.gallery.errorFetching", "error", err.Error()))
+	}
+
+	o := models.Template{
+		Name:      strings.TrimSpace(req.Name),
+		Type:      t.Type,
+		Subject:   t.Subject,
+		Preheader: t.Preheader,
+		Body:      body,
+	}
+	if o.Name == "" {
+		o.Name = t.Name
+	}
+
+	if err := validateTemplate(o, app); err != nil {
+		return err
+	}
+
+	var f template.FuncMap
+	if o.Type == models.TemplateTypeCampaign {
+		o.Subject = ""
+		f = app.manager.TemplateFuncs(nil)
+	} else {
+		o.Preheader = ""
+		f = app.manager.GenericTemplateFuncs()
+	}
+
+	// Compile the template to validate it before anything is uploaded.
+	if err := o.Compile(f); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	// Fetch all the assets first so that a missing or an unsupported file
+	// doesn't leave the others in the media library.
+	assets, err := g.Assets(t, body)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("templates.gallery.errorFetching", "error", err.Error()))
+	}
+
+	type file struct {
+		asset       gallery.Asset
+		name        string
+		contentType string
+		b           []byte
+	}
+	files := make([]file, 0, len(assets))
+	for _, a := range assets {
+		u, err := url.Parse(a.URL)
+		if err != nil {
+			continue
+		}
+
+		name := path.Base(u.Path)
+		if err := validateMediaExt(name, app); err != nil {
+			return err
+		}
+
+		b, typ, err := g.Fetch(a.URL, gallery.MaxAssetSize)
+		if err != nil {
+			app.log.Printf("error fetching gallery asset %s: %v", a.URL, err)
+			return echo.NewHTTPError(http.StatusBadGateway, app.i18n.Ts("templates.gallery.errorFetching", "error", err.Error()))
+		}
+		if typ == "" {
+			typ = mime.TypeByExtension(path.Ext(name))
+		}
+
+		files = append(files, file{asset: a, name: name, contentType: typ, b: b})
+	}
+
+	// Upload the assets to the media library.
+	var (
+		uploaded = make([]media.Media, 0, len(files))
+		urls     = make(map[string]string, len(files))
+	)
+	for _, fl := range files {
+		m, err := insertMediaFile(fl.name, fl.contentType, bytes.NewReader(fl.b), int64(len(fl.b)), app)
+		if err != nil {
+			deleteGalleryMedia(uploaded, app)
+			return err
+		}
+
+		uploaded = append(uploaded, m)
+		urls[fl.asset.Ref] = m.URL
+	}
+
+	o.Body = gallery.ReplaceAssets(o.Body, urls)
+	if err := o.Compile(f); err != nil {
+		deleteGalleryMedia(uploaded, app)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	out, err := app.core.CreateTemplate(o.Name, o.Type, o.Subject, o.Preheader, []byte(o.Body), []byte(o.BodyAMP), []byte(o.BodyMJML), o.LangVariants)
+	if err != nil {
+		deleteGalleryMedia(uploaded, app)
+		return err
+	}
+
+	// If it's a transactional template, cache it in the manager
+	// to be used for arbitrary incoming tx message pushes.
+	if o.Type == models.TemplateTypeTx {
+		app.manager.CacheTpl(out.ID, &o)
+	}
+
+	return c.JSON(http.StatusOK, okResp{galleryImportResp{Template: out, Media: uploaded}})
+}
+
+// getGallery returns the configured remote template gallery.
+func getGallery(app *App) (*gallery.Gallery, error) {
+	if app.constants.TemplateGalleryURL == "" {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("templates.gallery.notConfigured"))
+	}
+
+	g, err := gallery.New(app.constants.TemplateGalleryURL, galleryTimeout)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("settings.general.invalidTemplateGallery", "error", err.Error()))
+	}
+
+	return g, nil
+}
+
+// deleteGalleryMedia deletes the media files of a failed gallery import.
+func deleteGalleryMedia(files []media.Media, app *App) {
+	for _, m := range files {
+		fname, err := app.core.DeleteMedia(m.ID)
+		if err != nil {
+			continue
+		}
+
+		app.media.Delete(fname)
+		app.media.Delete(thumbPrefix + fname)
+	}
+}
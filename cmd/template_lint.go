@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+const tplTrackViewTag = `{{ TrackView }}`
+
+var (
+	regexpLintUndefinedFunc = regexp.MustCompile(`function "(.+?)" not defined`)
+	regexpLintTrackView     = regexp.MustCompile(`{{(\s+)?TrackView(\s+)?}}`)
+	regexpLintHiddenHTML    = regexp.MustCompile(`(?is)<(head|style|script|title)\b.*?</(head|style|script|title)>`)
+	regexpLintHTMLTag       = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// tplLintReport is the report of the lint checks of a template. The checks
+// are the same as the pre-flight checks of campaigns. If saves are blocked
+// on lint errors in the settings, a template with any check that has errored
+// can't be saved.
+type tplLintReport struct {
+	Status  string           `json:"status"`
+	CanSave bool             `json:"can_save"`
+	Checks  []preflightCheck `json:"checks"`
+}
+
+// handleLintTemplate runs the lint checks on a stored template, or the
+// posted template.
+func handleLintTemplate(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	var tpl models.Template
+	if c.Param("id") != "" {
+		if id < 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+		}
+
+		t, err := app.core.GetTemplate(id, false)
+		if err != nil {
+			return err
+		}
+		tpl = t
+	} else {
+		if err := c.Bind(&tpl); err != nil {
+			return err
+		}
+		if tpl.Type == "" {
+			tpl.Type = models.TemplateTypeCampaign
+		}
+
+		// Compile the MJML source, if any, to the HTML body.
+		if err := compileTemplateMJML(&tpl, app); err != nil {
+			return err
+		}
+	}
+
+	return c.JSON(http.StatusOK, okResp{lintTemplate(tpl, app)})
+}
+
+// lintTemplate checks a template for syntax errors, undefined functions,
+// missing unsubscribe and tracking tags, oversized output, and bodies with
+// only images.
+func lintTemplate(tpl models.Template, app *App) tplLintReport {
+	out := tplLintReport{Status: preflightOK, CanSave: true, Checks: []preflightCheck{}}
+	add := func(c preflightCheck) {
+		if c.Items == nil {
+			c.Items = []string{}
+		}
+		out.Checks = append(out.Checks, c)
+
+		switch c.Status {
+		case preflightError:
+			out.Status = preflightError
+			out.CanSave = false
+		case preflightWarn:
+			if out.Status == preflightOK {
+				out.Status = preflightWarn
+			}
+		}
+	}
+
+	isCampaign := tpl.Type == models.TemplateTypeCampaign
+
+	// Syntax errors, such as unclosed actions, and undefined functions.
+	var f template.FuncMap
+	if isCampaign {
+		f = app.manager.TemplateFuncs(nil)
+	} else {
+		f = app.manager.GenericTemplateFuncs()
+	}
+	if err := tpl.Compile(f); err != nil {
+		if m := regexpLintUndefinedFunc.FindAllStringSubmatch(err.Error(), -1); len(m) > 0 {
+			items := make([]string, 0, len(m))
+			for _, fn := range m {
+				items = append(items, fn[1])
+			}
+			add(preflightCheck{Check: "functions", Status: preflightError,
+				Message: app.i18n.Ts("templates.lint.undefinedFuncs", "num", strconv.Itoa(len(items))), Items: items})
+		} else {
+			add(preflightCheck{Check: "syntax", Status: preflightError,
+				Message: app.i18n.Ts("templates.errorCompiling", "error", err.Error())})
+		}
+		return out
+	}
+	add(preflightCheck{Check: "syntax", Status: preflightOK,
+		Message: app.i18n.T("templates.lint.syntaxOK")})
+
+	// Render the template for the dummy subscriber with empty content so that
+	// only the template's own output is checked.
+	var (
+		req = tplRenderReq{}
+		r   tplRenderResp
+	)
+	if isCampaign {
+		req.Campaign.Body = "<p></p>"
+		r, _ = renderCampaignTemplate(tpl, req, dummySubscriber, app)
+	} else {
+		r = renderTxTemplate(tpl, req, dummySubscriber, app)
+	}
+	if len(r.Errors) > 0 {
+		// Transactional templates are rendered without the data that they
+		// expect, which may not render.
+		status := preflightError
+		if !isCampaign {
+			status = preflightWarn
+		}
+		add(preflightCheck{Check: "render", Status: status, Message: r.Errors[0], Items: r.Errors[1:]})
+		return out
+	}
+
+	body := r.HTML
+	if isCampaign {
+		// Unsubscribe link. {{ ManageURL }} also links to the unsubscribe page.
+		if strings.Contains(body, fmt.Sprintf(app.constants.UnsubURL, dummyUUID, dummySubscriber.UUID)) {
+			add(preflightCheck{Check: "unsubscribe", Status: preflightOK,
+				Message: app.i18n.T("campaigns.preflight.unsubOK")})
+		} else {
+			add(preflightCheck{Check: "unsubscribe", Status: preflightError,
+				Message: app.i18n.T("templates.lint.noUnsub")})
+		}
+
+		// View tracking pixel.
+		if regexpLintTrackView.MatchString(tpl.Body) {
+			add(preflightCheck{Check: "tracking", Status: preflightOK,
+				Message: app.i18n.T("templates.lint.trackViewOK")})
+		} else {
+			add(preflightCheck{Check: "tracking", Status: preflightWarn,
+				Message: app.i18n.Ts("templates.lint.noTrackView", "tag", tplTrackViewTag)})
+		}
+	}
+
+	// HTML size.
+	size := strconv.Itoa(len(body) / 1024)
+	if len(body) > preflightMaxHTMLSize {
+		add(preflightCheck{Check: "size", Status: preflightError,
+			Message: app.i18n.Ts("campaigns.preflight.oversized", "size", size, "max", strconv.Itoa(preflightMaxHTMLSize/1024))})
+	} else {
+		add(preflightCheck{Check: "size", Status: preflightOK,
+			Message: app.i18n.Ts("campaigns.preflight.sizeOK", "size", size)})
+	}
+
+	// Bodies with images and no text are likely to be flagged as spam.
+	text := regexpLintHiddenHTML.ReplaceAllString(body, "")
+	text = strings.TrimSpace(html.UnescapeString(regexpLintHTMLTag.ReplaceAllString(text, "")))
+	if text == "" && regexpPreflightImg.MatchString(body) {
+		add(preflightCheck{Check: "images", Status: preflightWarn,
+			Message: app.i18n.T("templates.lint.imageOnly")})
+	} else {
+		add(preflightCheck{Check: "images", Status: preflightOK,
+			Message: app.i18n.T("templates.lint.textOK")})
+	}
+
+	return out
+}
+
+// checkTemplateLint returns an error with the failed checks if saving
+// templates that fail lint checks is blocked in the settings.
+func checkTemplateLint(o models.Template, app *App) error {
+	if !app.constants.TemplateLintBlock {
+		return nil
+	}
+
+	r := lintTemplate(o, app)
+	if r.CanSave {
+		return nil
+	}
+
+	var errs []string
+	for _, c := range r.Checks {
+		if c.Status == preflightError {
+			errs = append(errs, c.Message)
+		}
+	}
+
+	return echo.NewHTTPError(http.StatusBadRequest,
+		app.i18n.Ts("templates.lint.failed", "error", strings.Join(errs, " ")))
+}
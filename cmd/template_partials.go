@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	regexpPartialName = regexp.MustCompile(`^[a-z0-9_\-]{1,100}$`)
+
+	// Matches {{ Partial "name" }} and {{ Partial "name" . }}.
+	regexpPartialTag = regexp.MustCompile(`{{(\s+)?Partial(\s+)?"(.+?)"`)
+)
+
+// handleGetTemplatePartials handles retrieval of template partials.
+func handleGetTemplatePartials(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	// Fetch one partial.
+	if id > 0 {
+		out, err := app.core.GetTemplatePartial(id)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, okResp{out})
+	}
+
+	out, err := app.core.GetTemplatePartials()
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleCreateTemplatePartial handles template partial creation.
+func handleCreateTemplatePartial(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+		o   = models.TemplatePartial{}
+	)
+
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	o, err := validateTemplatePartial(o, app)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	out, err := app.core.CreateTemplatePartial(o)
+	if err != nil {
+		return err
+	}
+
+	if err := cacheTemplatePartials(app); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleUpdateTemplatePartial handles template partial modification.
+func handleUpdateTemplatePartial(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	var o models.TemplatePartial
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	o, err := validateTemplatePartial(o, app)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	// A partial that's in use can't be renamed.
+	cur, err := app.core.GetTemplatePartial(id)
+	if err != nil {
+		return err
+	}
+	if cur.Name != o.Name {
+		if err := checkTemplatePartialUnused(cur.Name, app); err != nil {
+			return err
+		}
+	}
+
+	out, err := app.core.UpdateTemplatePartial(id, o)
+	if err != nil {
+		return err
+	}
+
+	if err := cacheTemplatePartials(app); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleDeleteTemplatePartial handles template partial deletion. A partial
+// that's in use can't be deleted.
+func handleDeleteTemplatePartial(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	p, err := app.core.GetTemplatePartial(id)
+	if err != nil {
+		return err
+	}
+
+	if err := checkTemplatePartialUnused(p.Name, app); err != nil {
+		return err
+	}
+
+	if err := app.core.DeleteTemplatePartial(id); err != nil {
+		return err
+	}
+
+	if err := cacheTemplatePartials(app); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// validateTemplatePartial validates the name and body of a template partial.
+// Partials can't include other partials.
+func validateTemplatePartial(o models.TemplatePartial, app *App) (models.TemplatePartial, error) {
+	o.Name = strings.TrimSpace(o.Name)
+	if !regexpPartialName.MatchString(o.Name) {
+		return o, errors.New(app.i18n.Ts("globals.messages.invalidFields", "name", "name"))
+	}
+
+	if strings.TrimSpace(o.Body) == "" {
+		return o, errors.New(app.i18n.Ts("globals.messages.missingFields", "name", "body"))
+	}
+	if regexpPartialTag.MatchString(o.Body) {
+		return o, errors.New(app.i18n.T("templates.partialNested"))
+	}
+
+	if _, err := o.Compile(app.manager.TemplateFuncs(nil)); err != nil {
+		return o, errors.New(app.i18n.Ts("templates.errorCompiling", "error", err.Error()))
+	}
+
+	return o, nil
+}
+
+// validateTemplatePartials checks that the partials that a template
+// body includes exist.
+func validateTemplatePartials(body string, app *App) error {
+	for _, m := range regexpPartialTag.FindAllStringSubmatch(body, -1) {
+		if !app.manager.HasPartial(m[3]) {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("templates.partialNotFound", "name", m[3]))
+		}
+	}
+
+	return nil
+}
+
+// checkTemplatePartialUnused returns an error if template partial is
+// included in templates, or in campaigns that are yet to be sent or
+// are being sent.
+func checkTemplatePartialUnused(name string, app *App) error {
+	names, err := app.core.GetTemplatePartialUsage(name)
+	if err != nil {
+		return err
+	}
+
+	if len(names) > 0 {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			app.i18n.Ts("templates.partialInUse", "name", strings.Join(names, ", ")))
+	}
+
+	return nil
+}
+
+// cacheTemplatePartials (re)loads all template partials into the manager.
+func cacheTemplatePartials(app *App) error {
+	out, err := app.core.GetTemplatePartials()
+	if err != nil {
+		return err
+	}
+
+	app.manager.CachePartials(out)
+	return nil
+}
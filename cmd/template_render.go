@@ -0,0 +1,269 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/knadh/listmonk/internal/htmltext"
+	"github.com/knadh/listmonk/internal/manager"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	null "gopkg.in/volatiletech/null.v6"
+)
+
+// tplRenderReq is the request to render a template. The template content
+// fields, if set, are rendered instead of the stored template's.
+type tplRenderReq struct {
+	Type      string `json:"type"`
+	Subject   string `json:"subject"`
+	Body      string `json:"body"`
+	BodyAMP   string `json:"body_amp"`
+	BodyMJML  string `json:"body_mjml"`
+	Preheader string `json:"preheader"`
+
+	// A subscriber in the database, or a fixture. If neither is set,
+	// a dummy subscriber is used.
+	SubscriberID int                `json:"subscriber_id"`
+	Subscriber   *models.Subscriber `json:"subscriber"`
+
+	// Campaign fixture that a campaign template is rendered with.
+	Campaign struct {
+		Name        string `json:"name"`
+		Subject     string `json:"subject"`
+		FromEmail   string `json:"from_email"`
+		Body        string `json:"body"`
+		AltBody     string `json:"altbody"`
+		ContentType string `json:"content_type"`
+		Preheader   string `json:"preheader"`
+	} `json:"campaign"`
+
+	// Data that a transactional template is rendered with as {{ .Tx.Data }}.
+	Data map[string]interface{} `json:"data"`
+}
+
+// tplRenderResp is the output of a rendered template. Template errors are
+// returned in Errors and not as an error response.
+type tplRenderResp struct {
+	Subject   string   `json:"subject"`
+	Preheader string   `json:"preheader"`
+	HTML      string   `json:"html"`
+	AMP       string   `json:"amp"`
+	Text      string   `json:"text"`
+	Errors    []string `json:"errors"`
+}
+
+// handleRenderTemplate renders a stored template, or the posted template
+// content, for a subscriber and campaign fixture and returns the output
+// and any template errors.
+func handleRenderTemplate(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	var req tplRenderReq
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	// Stored template.
+	var tpl models.Template
+	if c.Param("id") != "" {
+		if id < 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+		}
+
+		t, err := app.core.GetTemplate(id, false)
+		if err != nil {
+			return err
+		}
+		tpl = t
+	}
+
+	// Posted content overrides the stored template's.
+	if req.Type != "" {
+		if req.Type != models.TemplateTypeCampaign && req.Type != models.TemplateTypeTx {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "type"))
+		}
+		tpl.Type = req.Type
+	}
+	if tpl.Type == "" {
+		tpl.Type = models.TemplateTypeCampaign
+	}
+	if req.Subject != "" {
+		tpl.Subject = req.Subject
+	}
+	if req.Body != "" || req.BodyMJML != "" {
+		tpl.Body = req.Body
+		tpl.BodyMJML = req.BodyMJML
+	}
+	if req.BodyAMP != "" {
+		tpl.BodyAMP = req.BodyAMP
+	}
+	if req.Preheader != "" {
+		tpl.Preheader = req.Preheader
+	}
+
+	// Posted MJML source is compiled to the body.
+	if req.BodyMJML != "" {
+		if err := compileTemplateMJML(&tpl, app); err != nil {
+			return err
+		}
+	}
+
+	if strings.TrimSpace(tpl.Body) == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.missingFields", "name", "body"))
+	}
+
+	sub, err := renderTemplateSubscriber(req, app)
+	if err != nil {
+		return err
+	}
+
+	var out tplRenderResp
+	if tpl.Type == models.TemplateTypeCampaign {
+		out, err = renderCampaignTemplate(tpl, req, sub, app)
+	} else {
+		out = renderTxTemplate(tpl, req, sub, app)
+	}
+	if err != nil {
+		return err
+	}
+
+	if out.Errors == nil {
+		out.Errors = []string{}
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// renderTemplateSubscriber returns the subscriber in the database or the
+// fixture that a template is rendered for.
+func renderTemplateSubscriber(req tplRenderReq, app *App) (models.Subscriber, error) {
+	if req.SubscriberID > 0 {
+		return app.core.GetSubscriber(req.SubscriberID, "", "")
+	}
+
+	if req.Subscriber == nil {
+		return dummySubscriber, nil
+	}
+
+	sub := *req.Subscriber
+	if sub.UUID == "" {
+		sub.UUID = dummyUUID
+	}
+	if sub.Attribs == nil {
+		sub.Attribs = models.JSON{}
+	}
+
+	return sub, nil
+}
+
+// renderCampaignTemplate renders a campaign template with the campaign
+// fixture in the request. Links aren't rewritten to tracking links, which
+// keeps them from being registered.
+func renderCampaignTemplate(tpl models.Template, req tplRenderReq, sub models.Subscriber, app *App) (tplRenderResp, error) {
+	var (
+		out = tplRenderResp{}
+		rc  = req.Campaign
+	)
+
+	camp := models.Campaign{
+		UUID:                 dummyUUID,
+		Name:                 rc.Name,
+		Subject:              rc.Subject,
+		FromEmail:            rc.FromEmail,
+		Body:                 rc.Body,
+		AltBody:              null.NewString(rc.AltBody, rc.AltBody != ""),
+		ContentType:          rc.ContentType,
+		Preheader:            rc.Preheader,
+		TemplateBody:         tpl.Body,
+		TemplateLangVariants: tpl.LangVariants,
+		TemplateBodyAMP:      tpl.BodyAMP,
+		TemplatePreheader:    tpl.Preheader,
+	}
+	if camp.Name == "" {
+		camp.Name = app.i18n.T("templates.dummyName")
+	}
+	if camp.Subject == "" {
+		camp.Subject = app.i18n.T("templates.dummySubject")
+	}
+	if camp.FromEmail == "" {
+		camp.FromEmail = "dummy-campaign@listmonk.app"
+	}
+	if camp.Body == "" {
+		camp.Body = dummyTpl
+	}
+
+	switch camp.ContentType {
+	case "":
+		camp.ContentType = models.CampaignContentTypeRichtext
+	case models.CampaignContentTypeRichtext, models.CampaignContentTypeHTML,
+		models.CampaignContentTypeMarkdown, models.CampaignContentTypePlain:
+	default:
+		return out, echo.NewHTTPError(http.StatusBadRequest,
+			app.i18n.Ts("globals.messages.invalidFields", "name", "content_type"))
+	}
+
+	if !regexpTplTag.MatchString(tpl.Body) {
+		out.Errors = append(out.Errors, app.i18n.Ts("templates.placeholderHelp", "placeholder", tplTag))
+	}
+
+	funcs := app.manager.TemplateFuncs(&camp)
+	funcs["TrackLink"] = func(url string, msg *manager.CampaignMessage) string {
+		return url
+	}
+	funcs["TrackView"] = func(msg *manager.CampaignMessage) template.HTML {
+		return ""
+	}
+
+	if err := camp.CompileTemplate(funcs); err != nil {
+		out.Errors = append(out.Errors, app.i18n.Ts("templates.errorCompiling", "error", err.Error()))
+		return out, nil
+	}
+
+	msg, err := app.manager.NewCampaignMessage(&camp, sub)
+	if err != nil {
+		out.Errors = append(out.Errors, app.i18n.Ts("templates.errorRendering", "error", err.Error()))
+		return out, nil
+	}
+
+	out.Subject = msg.Subject()
+	out.Preheader = msg.Preheader()
+	out.AMP = string(msg.AMPBody())
+	if camp.ContentType == models.CampaignContentTypePlain {
+		out.Text = string(msg.Body())
+	} else {
+		out.HTML = string(msg.Body())
+		out.Text = string(msg.AltBody())
+	}
+
+	return out, nil
+}
+
+// renderTxTemplate renders a transactional template with the data in the request.
+func renderTxTemplate(tpl models.Template, req tplRenderReq, sub models.Subscriber, app *App) tplRenderResp {
+	out := tplRenderResp{}
+
+	if err := tpl.Compile(app.manager.GenericTemplateFuncs()); err != nil {
+		out.Errors = append(out.Errors, err.Error())
+		return out
+	}
+
+	m := models.TxMessage{
+		Subject: tpl.Subject,
+		Data:    req.Data,
+	}
+	if err := m.Render(sub, &tpl); err != nil {
+		out.Errors = append(out.Errors, app.i18n.Ts("templates.errorRendering", "error", err.Error()))
+		return out
+	}
+
+	out.Subject = m.Subject
+	out.HTML = string(m.Body)
+	out.Text = string(htmltext.FromHTML(m.Body))
+
+	return out
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"github.com/knadh/listmonk/internal/textdiff"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// tplRevisionDiff is a content revision of a template with the line by line
+// diffs of its content against another revision, by default, the one before it.
+type tplRevisionDiff struct {
+	models.TemplateRevision
+
+	Against int64 `json:"against"`
+	Diff    struct {
+		Subject   []textdiff.Line `json:"subject"`
+		Body      []textdiff.Line `json:"body"`
+		BodyAMP   []textdiff.Line `json:"body_amp"`
+		BodyMJML  []textdiff.Line `json:"body_mjml"`
+		Preheader []textdiff.Line `json:"preheader"`
+	} `json:"diff"`
+}
+
+// handleGetTemplateRevisions returns the content revisions of a template.
+func handleGetTemplateRevisions(c echo.Context) error {
+	var (
+		app   = c.Get("app").(*App)
+		id, _ = strconv.Atoi(c.Param("id"))
+	)
+
+	if id < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	out, err := app.core.GetTemplateRevisions(id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleGetTemplateRevision returns a content revision of a template and its
+// diff against the revision in ?against, or the one before it.
+func handleGetTemplateRevision(c echo.Context) error {
+	var (
+		app          = c.Get("app").(*App)
+		id, _        = strconv.Atoi(c.Param("id"))
+		revID, _     = strconv.ParseInt(c.Param("revID"), 10, 64)
+		againstID, _ = strconv.ParseInt(c.QueryParam("against"), 10, 64)
+	)
+
+	if id < 1 || revID < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	rev, err := app.core.GetTemplateRevision(id, revID, false)
+	if err != nil {
+		return err
+	}
+
+	var against *models.TemplateRevision
+	if againstID > 0 {
+		against, err = app.core.GetTemplateRevision(id, againstID, false)
+	} else {
+		against, err = app.core.GetTemplateRevision(id, revID, true)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The first revision is diffed against nothing.
+	if against == nil {
+		against = &models.TemplateRevision{}
+	}
+
+	out := tplRevisionDiff{TemplateRevision: *rev, Against: against.ID}
+	out.Diff.Subject = textdiff.Lines(against.Subject, rev.Subject)
+	out.Diff.Body = textdiff.Lines(against.Body, rev.Body)
+	out.Diff.BodyAMP = textdiff.Lines(against.BodyAMP, rev.BodyAMP)
+	out.Diff.BodyMJML = textdiff.Lines(against.BodyMJML, rev.BodyMJML)
+	out.Diff.Preheader = textdiff.Lines(against.Preheader, rev.Preheader)
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// handleRestoreTemplateRevision restores the content of a template to that of
+// one of its revisions. The restored content is saved like any other edit,
+// which snapshots it as a new revision. The HTML body compiled from MJML
+// is restored as is and isn't recompiled.
+func handleRestoreTemplateRevision(c echo.Context) error {
+	var (
+		app      = c.Get("app").(*App)
+		id, _    = strconv.Atoi(c.Param("id"))
+		revID, _ = strconv.ParseInt(c.Param("revID"), 10, 64)
+	)
+
+	if id < 1 || revID < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("globals.messages.invalidID"))
+	}
+
+	o, err := app.core.GetTemplate(id, false)
+	if err != nil {
+		return err
+	}
+
+	rev, err := app.core.GetTemplateRevision(id, revID, false)
+	if err != nil {
+		return err
+	}
+
+	o.Subject = rev.Subject
+	o.Body = rev.Body
+	o.BodyAMP = rev.BodyAMP
+	o.BodyMJML = rev.BodyMJML
+	o.Preheader = rev.Preheader
+
+	if err := validateTemplate(o, app); err != nil {
+		return err
+	}
+
+	var f template.FuncMap
+	if o.Type == models.TemplateTypeCampaign {
+		f = app.manager.TemplateFuncs(nil)
+	} else {
+		f = app.manager.GenericTemplateFuncs()
+	}
+	if err := o.Compile(f); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	out, err := app.core.UpdateTemplate(id, o.Name, o.Subject, o.Preheader, []byte(o.Body), []byte(o.BodyAMP), []byte(o.BodyMJML), o.LangVariants)
+	if err != nil {
+		return err
+	}
+
+	// If it's a transactional template, cache it.
+	if o.Type == models.TemplateTypeTx {
+		app.manager.CacheTpl(out.ID, &o)
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
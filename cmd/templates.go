@@ -8,6 +8,8 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/knadh/listmonk/internal/darkmode"
+	"github.com/knadh/listmonk/internal/mjml"
 	"github.com/knadh/listmonk/models"
 	"github.com/labstack/echo/v4"
 )
@@ -63,11 +65,25 @@ func handlePreviewTemplate(c echo.Context) error {
 	var (
 		app   = c.Get("app").(*App)
 		id, _ = strconv.Atoi(c.Param("id"))
+
+		// Preview the body as it's rendered by dark mode e-mail clients.
+		darkMode = c.FormValue("dark_mode")
 	)
 
+	if darkMode != "" && !darkmode.Valid(darkMode) {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("globals.messages.invalidFields", "name", "dark_mode"))
+	}
+
 	tpl := models.Template{
-		Type: c.FormValue("template_type"),
-		Body: c.FormValue("body"),
+		Type:      c.FormValue("template_type"),
+		Body:      c.FormValue("body"),
+		BodyMJML:  c.FormValue("body_mjml"),
+		Preheader: c.FormValue("preheader"),
+	}
+
+	// MJML source is posted.
+	if err := compileTemplateMJML(&tpl, app); err != nil {
+		return err
 	}
 
 	// Body is posted.
@@ -94,16 +110,22 @@ func handlePreviewTemplate(c echo.Context) error {
 		tpl = t
 	}
 
+	// Preview the language variant for a locale, if there's one.
+	sub := dummySubscriber
+	sub.Locale = c.FormValue("lang")
+
 	// Compile the campaign template.
 	var out []byte
 	if tpl.Type == models.TemplateTypeCampaign {
 		camp := models.Campaign{
-			UUID:         dummyUUID,
-			Name:         app.i18n.T("templates.dummyName"),
-			Subject:      app.i18n.T("templates.dummySubject"),
-			FromEmail:    "dummy-campaign@listmonk.app",
-			TemplateBody: tpl.Body,
-			Body:         dummyTpl,
+			UUID:                 dummyUUID,
+			Name:                 app.i18n.T("templates.dummyName"),
+			Subject:              app.i18n.T("templates.dummySubject"),
+			FromEmail:            "dummy-campaign@listmonk.app",
+			TemplateBody:         tpl.Body,
+			TemplateLangVariants: tpl.LangVariants,
+			TemplatePreheader:    tpl.Preheader,
+			Body:                 dummyTpl,
 		}
 
 		if err := camp.CompileTemplate(app.manager.TemplateFuncs(&camp)); err != nil {
@@ -112,7 +134,7 @@ func handlePreviewTemplate(c echo.Context) error {
 		}
 
 		// Render the message body.
-		msg, err := app.manager.NewCampaignMessage(&camp, dummySubscriber)
+		msg, err := app.manager.NewCampaignMessage(&camp, sub)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusBadRequest,
 				app.i18n.Ts("templates.errorRendering", "error", err.Error()))
@@ -129,13 +151,13 @@ func handlePreviewTemplate(c echo.Context) error {
 		}
 
 		// Render the message.
-		if err := m.Render(dummySubscriber, &tpl); err != nil {
+		if err := m.Render(sub, &tpl); err != nil {
 			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 		}
 		out = m.Body
 	}
 
-	return c.HTML(http.StatusOK, string(out))
+	return c.HTML(http.StatusOK, string(darkmode.Render(out, darkMode)))
 }
 
 // handleCreateTemplate handles template creation.
@@ -149,6 +171,11 @@ func handleCreateTemplate(c echo.Context) error {
 		return err
 	}
 
+	// Compile the MJML source, if any, to the HTML body.
+	if err := compileTemplateMJML(&o, app); err != nil {
+		return err
+	}
+
 	if err := validateTemplate(o, app); err != nil {
 		return err
 	}
@@ -161,6 +188,7 @@ func handleCreateTemplate(c echo.Context) error {
 		o.Subject = ""
 		f = app.manager.TemplateFuncs(nil)
 	} else {
+		o.Preheader = ""
 		f = app.manager.GenericTemplateFuncs()
 	}
 
@@ -170,7 +198,7 @@ func handleCreateTemplate(c echo.Context) error {
 	}
 
 	// Create the template the in the DB.
-	out, err := app.core.CreateTemplate(o.Name, o.Type, o.Subject, []byte(o.Body))
+	out, err := app.core.CreateTemplate(o.Name, o.Type, o.Subject, o.Preheader, []byte(o.Body), []byte(o.BodyAMP), []byte(o.BodyMJML), o.LangVariants)
 	if err != nil {
 		return err
 	}
@@ -200,6 +228,11 @@ func handleUpdateTemplate(c echo.Context) error {
 		return err
 	}
 
+	// Compile the MJML source, if any, to the HTML body.
+	if err := compileTemplateMJML(&o, app); err != nil {
+		return err
+	}
+
 	if err := validateTemplate(o, app); err != nil {
 		return err
 	}
@@ -212,6 +245,7 @@ func handleUpdateTemplate(c echo.Context) error {
 		o.Subject = ""
 		f = app.manager.TemplateFuncs(nil)
 	} else {
+		o.Preheader = ""
 		f = app.manager.GenericTemplateFuncs()
 	}
 
@@ -220,7 +254,7 @@ func handleUpdateTemplate(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	out, err := app.core.UpdateTemplate(id, o.Name, o.Subject, []byte(o.Body))
+	out, err := app.core.UpdateTemplate(id, o.Name, o.Subject, o.Preheader, []byte(o.Body), []byte(o.BodyAMP), []byte(o.BodyMJML), o.LangVariants)
 	if err != nil {
 		return err
 	}
@@ -274,6 +308,30 @@ func handleDeleteTemplate(c echo.Context) error {
 }
 
 // compileTemplate validates template fields.
+// compileTemplateMJML compiles the MJML source of a template, if it has one,
+// to its HTML body. Errors in the MJML markup are returned line by line.
+func compileTemplateMJML(o *models.Template, app *App) error {
+	o.BodyMJML = strings.TrimSpace(o.BodyMJML)
+	if o.BodyMJML == "" {
+		return nil
+	}
+
+	if app.mjml == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.T("templates.mjmlDisabled"))
+	}
+
+	body, err := app.mjml.Compile(o.BodyMJML)
+	if err != nil {
+		if _, ok := err.(mjml.Errors); !ok {
+			app.log.Printf("error compiling MJML: %v", err)
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("templates.errorCompilingMJML", "error", err.Error()))
+	}
+	o.Body = body
+
+	return nil
+}
+
 func validateTemplate(o models.Template, app *App) error {
 	if !strHasLen(o.Name, 1, stdInputMaxLen) {
 		return errors.New(app.i18n.T("campaigns.fieldInvalidName"))
@@ -284,10 +342,55 @@ func validateTemplate(o models.Template, app *App) error {
 			app.i18n.Ts("templates.placeholderHelp", "placeholder", tplTag))
 	}
 
+	// The AMP body of a campaign template, if any, should have the content placeholder.
+	if o.Type == models.TemplateTypeCampaign && o.BodyAMP != "" && !regexpTplTag.MatchString(o.BodyAMP) {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			app.i18n.Ts("templates.placeholderHelp", "placeholder", tplTag))
+	}
+
+	// The partials that the template includes should exist.
+	if err := validateTemplatePartials(o.Body+o.BodyAMP, app); err != nil {
+		return err
+	}
+
+	if !strHasLen(o.Preheader, 0, stdInputMaxLen) {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			app.i18n.Ts("globals.messages.invalidFields", "name", "preheader"))
+	}
+
 	if o.Type == models.TemplateTypeTx && strings.TrimSpace(o.Subject) == "" {
 		return echo.NewHTTPError(http.StatusBadRequest,
 			app.i18n.Ts("globals.messages.missingFields", "name", "subject"))
 	}
 
+	// Language variants are picked by the subscribers' locales.
+	langs := map[string]bool{}
+	for _, v := range o.LangVariants {
+		if !regexLang.MatchString(strings.TrimSpace(v.Lang)) {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("campaigns.invalidLangVariant", "name", v.Lang))
+		}
+		l := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(v.Lang), "_", "-"))
+		if langs[l] {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("campaigns.duplicateLangVariant", "name", v.Lang))
+		}
+		langs[l] = true
+
+		if strings.TrimSpace(v.Body) == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("campaigns.emptyLangVariant", "name", v.Lang))
+		}
+		if o.Type == models.TemplateTypeCampaign && !regexpTplTag.MatchString(v.Body) {
+			return echo.NewHTTPError(http.StatusBadRequest,
+				v.Lang+": "+app.i18n.Ts("templates.placeholderHelp", "placeholder", tplTag))
+		}
+		if err := validateTemplatePartials(v.Body, app); err != nil {
+			return err
+		}
+	}
+
+	// Block templates that fail lint checks, if enabled.
+	if err := checkTemplateLint(o, app); err != nil {
+		return err
+	}
+
 	return nil
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -66,6 +67,11 @@ func handleSendTxMessage(c echo.Context) error {
 		return err
 	}
 
+	// Scan the attachments, if there's a scanner, and block the message if any are flagged.
+	if err := app.manager.ScanAttachments(m.Attachments); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, app.i18n.Ts("media.attachmentBlocked", "error", err.Error()))
+	}
+
 	// Validate input.
 	if r, err := validateTxMessage(m, app); err != nil {
 		return err
@@ -149,6 +155,10 @@ func handleSendTxMessage(c echo.Context) error {
 
 		if err := app.manager.PushMessage(msg); err != nil {
 			app.log.Printf("error sending message (%s): %v", msg.Subject, err)
+			if errors.Is(err, manager.ErrQuotaExceeded) {
+				return echo.NewHTTPError(http.StatusTooManyRequests,
+					app.i18n.Ts("globals.messages.quotaExceeded", "name", msg.Messenger))
+			}
 			return err
 		}
 	}
@@ -205,3 +215,29 @@ func validateTxMessage(m models.TxMessage, app *App) (models.TxMessage, error) {
 
 	return m, nil
 }
+
+// sendTemplateHook returns the callback that core calls to send a transactional
+// template to a subscriber, eg: on an attribute trigger.
+func sendTemplateHook(app *App) func(sub models.Subscriber, tplID int) error {
+	return func(sub models.Subscriber, tplID int) error {
+		tpl, err := app.manager.GetTpl(tplID)
+		if err != nil {
+			return err
+		}
+
+		tx := models.TxMessage{TemplateID: tplID, Data: map[string]interface{}{}}
+		if err := tx.Render(sub, tpl); err != nil {
+			return err
+		}
+
+		return app.manager.PushMessage(models.Message{
+			Subscriber:  sub,
+			From:        app.constants.FromEmail,
+			To:          []string{sub.Email},
+			Subject:     tx.Subject,
+			ContentType: models.CampaignContentTypeHTML,
+			Messenger:   emailMsgr,
+			Body:        tx.Body,
+		})
+	}
+}
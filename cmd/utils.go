@@ -70,6 +70,26 @@ func parseStringIDs(s []string) ([]int, error) {
 	return vals, nil
 }
 
+// intsToInt64s converts a slice of int IDs to a slice of int64s.
+func intsToInt64s(ids []int) []int64 {
+	out := make([]int64, len(ids))
+	for i, v := range ids {
+		out[i] = int64(v)
+	}
+
+	return out
+}
+
+// int64sToInts converts a slice of int64 IDs to a slice of ints.
+func int64sToInts(ids []int64) []int {
+	out := make([]int, len(ids))
+	for i, v := range ids {
+		out[i] = int(v)
+	}
+
+	return out
+}
+
 // generateRandomString generates a cryptographically random, alphanumeric string of length n.
 func generateRandomString(n int) (string, error) {
 	const dictionary = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
@@ -113,3 +133,17 @@ func titleCase(input string) string {
 
 	return strings.Join(parts, " ")
 }
+
+// acceptLanguage returns the most preferred language in an Accept-Language
+// header, eg: fr-CH from "fr-CH, fr;q=0.9, en;q=0.8", or an empty string.
+// Languages are listed in the order of preference by browsers.
+func acceptLanguage(h string) string {
+	for _, l := range strings.Split(h, ",") {
+		l, _, _ = strings.Cut(l, ";")
+		if l = strings.TrimSpace(l); l != "" && l != "*" {
+			return l
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx/types"
+	"github.com/knadh/koanf/v2"
+	"github.com/knadh/listmonk/internal/core"
+	"github.com/knadh/listmonk/internal/manager"
+	"github.com/knadh/listmonk/internal/webhook"
+	"github.com/knadh/listmonk/models"
+	"gopkg.in/volatiletech/null.v6"
+)
+
+// webhookEvents is the list of events that webhooks can be subscribed to.
+var webhookEvents = []string{
+	manager.EventCampaignScheduled,
+	manager.EventCampaignStarted,
+	manager.EventCampaignPaused,
+	manager.EventCampaignCancelled,
+	manager.EventCampaignFinished,
+	manager.EventCampaignError,
+	core.EventSubscriberCreated,
+	core.EventSubscriberUpdated,
+	core.EventSubscriberConfirmed,
+	core.EventSubscriberUnsubscribed,
+	core.EventSubscriberBlocklisted,
+	core.EventSubscriberBounced,
+}
+
+// campEvent is the data in the payload of campaign webhook events with
+// a summary of the campaign and its stats.
+type campEvent struct {
+	ID        int         `json:"id"`
+	UUID      string      `json:"uuid"`
+	Name      string      `json:"name"`
+	Subject   string      `json:"subject"`
+	Status    string      `json:"status"`
+	Reason    string      `json:"reason"`
+	Lists     interface{} `json:"lists"`
+	Tags      []string    `json:"tags"`
+	ToSend    int         `json:"to_send"`
+	Sent      int         `json:"sent"`
+	Views     int         `json:"views"`
+	Clicks    int         `json:"clicks"`
+	Bounces   int         `json:"bounces"`
+	Expired   bool        `json:"expired"`
+	SendAt    null.Time   `json:"send_at"`
+	StartedAt null.Time   `json:"started_at"`
+	UpdatedAt null.Time   `json:"updated_at"`
+}
+
+// subEvent is the data in the payload of subscriber webhook events with
+// the subscriber and their list subscriptions.
+type subEvent struct {
+	ID        int            `json:"id"`
+	UUID      string         `json:"uuid"`
+	Email     string         `json:"email"`
+	Name      string         `json:"name"`
+	Attribs   models.JSON    `json:"attribs"`
+	Status    string         `json:"status"`
+	Reason    string         `json:"reason"`
+	Lists     types.JSONText `json:"lists"`
+	CreatedAt null.Time      `json:"created_at"`
+	UpdatedAt null.Time      `json:"updated_at"`
+}
+
+// initWebhooks initializes the dispatcher of the enabled outgoing webhooks.
+func initWebhooks() *webhook.Dispatcher {
+	var hooks []webhook.Hook
+	for _, item := range ko.Slices("webhooks") {
+		if !item.Bool("enabled") {
+			continue
+		}
+
+		var h webhook.Hook
+		if err := item.UnmarshalWithConf("", &h, koanf.UnmarshalConf{Tag: "json"}); err != nil {
+			lo.Fatalf("error reading webhook config: %v", err)
+		}
+		hooks = append(hooks, h)
+
+		lo.Printf("loaded webhook: %s (%s)", h.Name, h.URL)
+	}
+
+	return webhook.New(hooks, webhook.Opt{
+		Timeout:    time.Second * 10,
+		MaxRetries: 3,
+	}, lo)
+}
+
+// campaignEventHook returns the callback that the campaign manager calls with
+// campaign lifecycle events, which are dispatched to the webhooks.
+func campaignEventHook(app *App) func(event string, campID int, reason string) {
+	return func(event string, campID int, reason string) {
+		go fireCampaignEvent(event, campID, reason, app)
+	}
+}
+
+// fireCampaignEvent dispatches a campaign event with a summary of the
+// campaign to the webhooks.
+func fireCampaignEvent(event string, campID int, reason string, app *App) {
+	if !app.webhooks.Enabled() {
+		return
+	}
+
+	c, err := app.core.GetCampaign(campID, "", "")
+	if err != nil {
+		app.log.Printf("error fetching campaign %d for webhook event %s: %v", campID, event, err)
+		return
+	}
+
+	app.webhooks.Dispatch(event, makeCampEvent(c, reason))
+}
+
+// subscriberEventHook returns the callback that core calls with subscriber
+// lifecycle events, which are dispatched to the webhooks.
+func subscriberEventHook(app *App) func(event string, subID int, subUUID, email, reason string) {
+	return func(event string, subID int, subUUID, email, reason string) {
+		if !app.webhooks.Enabled() {
+			return
+		}
+		go fireSubscriberEvent(event, subID, subUUID, email, reason, app)
+	}
+}
+
+// fireSubscriberEvent dispatches a subscriber event with the subscriber's
+// current data to the webhooks.
+func fireSubscriberEvent(event string, subID int, subUUID, email, reason string, app *App) {
+	s, err := app.core.GetSubscriber(subID, subUUID, email)
+	if err != nil {
+		app.log.Printf("error fetching subscriber (%d: %s%s) for webhook event %s: %v", subID, subUUID, email, event, err)
+		return
+	}
+
+	lists := s.Lists
+	if len(lists) == 0 {
+		lists = types.JSONText("[]")
+	}
+
+	app.webhooks.Dispatch(event, subEvent{
+		ID:        s.ID,
+		UUID:      s.UUID,
+		Email:     s.Email,
+		Name:      s.Name,
+		Attribs:   s.Attribs,
+		Status:    s.Status,
+		Reason:    reason,
+		Lists:     lists,
+		CreatedAt: s.CreatedAt,
+		UpdatedAt: s.UpdatedAt,
+	})
+}
+
+func makeCampEvent(c models.Campaign, reason string) campEvent {
+	var lists interface{} = []interface{}{}
+	if len(c.Lists) > 0 {
+		lists = c.Lists
+	}
+
+	return campEvent{
+		ID:        c.ID,
+		UUID:      c.UUID,
+		Name:      c.Name,
+		Subject:   c.Subject,
+		Status:    c.Status,
+		Reason:    reason,
+		Lists:     lists,
+		Tags:      c.Tags,
+		ToSend:    c.ToSend,
+		Sent:      c.Sent,
+		Views:     c.Views,
+		Clicks:    c.Clicks,
+		Bounces:   c.Bounces,
+		Expired:   c.Expired,
+		SendAt:    c.SendAt,
+		StartedAt: c.StartedAt,
+		UpdatedAt: c.UpdatedAt,
+	}
+}
+
+func isWebhookEvent(e string) bool {
+	for _, v := range webhookEvents {
+		if v == e {
+			return true
+		}
+	}
+	return false
+}
@@ -153,6 +153,50 @@ export const deleteList = (id) => http.delete(
   { loading: models.lists },
 );
 
+export const importList = async (data) => http.post(
+  '/api/lists/import',
+  data,
+  { loading: models.lists },
+);
+
+export const archiveList = (id, archive) => http.put(
+  `/api/lists/${id}/${archive ? 'archive' : 'unarchive'}`,
+  {},
+  { loading: models.lists },
+);
+
+export const getListFolders = () => http.get(
+  '/api/lists/folders',
+  { loading: models.lists },
+);
+
+export const createListFolder = (data) => http.post(
+  '/api/lists/folders',
+  data,
+  { loading: models.lists },
+);
+
+export const updateListFolder = (data) => http.put(
+  `/api/lists/folders/${data.id}`,
+  data,
+  { loading: models.lists },
+);
+
+export const deleteListFolder = (id) => http.delete(
+  `/api/lists/folders/${id}`,
+  { loading: models.lists },
+);
+
+export const getListWebhooks = async (id) => http.get(`/api/lists/${id}/webhooks`);
+
+export const createListWebhook = async (id, data) => http.post(`/api/lists/${id}/webhooks`, data);
+
+export const updateListWebhook = async (id, hookID, data) => http.put(`/api/lists/${id}/webhooks/${hookID}`, data);
+
+export const deleteListWebhook = async (id, hookID) => http.delete(`/api/lists/${id}/webhooks/${hookID}`);
+
+export const getListOptinReminderStats = async (id) => http.get(`/api/lists/${id}/optin-reminders`);
+
 // Subscribers.
 export const getSubscribers = async (params) => http.get(
   '/api/subscribers',
@@ -174,6 +218,16 @@ export const getSubscriberBounces = async (id) => http.get(
   { loading: models.bounces },
 );
 
+export const getSubscriberCampaigns = async (id, params) => http.get(
+  `/api/subscribers/${id}/campaigns`,
+  { params, loading: models.subscribers },
+);
+
+export const getSubscriberConsents = async (id) => http.get(
+  `/api/subscribers/${id}/consents`,
+  { loading: models.subscribers },
+);
+
 export const deleteSubscriberBounces = async (id) => http.delete(
   `/api/subscribers/${id}/bounces`,
   { loading: models.bounces },
@@ -207,11 +261,80 @@ export const sendSubscriberOptin = (id) => http.post(
   { loading: models.subscribers },
 );
 
+export const getSubscriberEmailChange = async (id) => http.get(`/api/subscribers/${id}/email`);
+
+export const changeSubscriberEmail = (id, email) => http.post(
+  `/api/subscribers/${id}/email`,
+  { email },
+  { loading: models.subscribers },
+);
+
+export const cancelSubscriberEmailChange = (id) => http.delete(
+  `/api/subscribers/${id}/email`,
+  { loading: models.subscribers },
+);
+
+export const getSubscriberEmails = async (id) => http.get(`/api/subscribers/${id}/emails`);
+
+export const addSubscriberEmail = (id, email) => http.post(
+  `/api/subscribers/${id}/emails`,
+  { email },
+  { loading: models.subscribers },
+);
+
+export const resendSubscriberEmailVerification = (id, emailID) => http.post(
+  `/api/subscribers/${id}/emails/${emailID}/verify`,
+  {},
+  { loading: models.subscribers },
+);
+
+export const setPrimarySubscriberEmail = (id, emailID) => http.put(
+  `/api/subscribers/${id}/emails/${emailID}/primary`,
+  {},
+  { loading: models.subscribers },
+);
+
+export const deleteSubscriberEmail = (id, emailID) => http.delete(
+  `/api/subscribers/${id}/emails/${emailID}`,
+  { loading: models.subscribers },
+);
+
+export const getSubscriberNotes = async (id, params) => http.get(
+  `/api/subscribers/${id}/notes`,
+  { params },
+);
+
+export const createSubscriberNote = async (id, data) => http.post(`/api/subscribers/${id}/notes`, data);
+
+export const deleteSubscriberNote = async (id, noteID) => http.delete(`/api/subscribers/${id}/notes/${noteID}`);
+
 export const deleteSubscriber = (id) => http.delete(
   `/api/subscribers/${id}`,
   { loading: models.subscribers },
 );
 
+export const eraseSubscriber = (id, reason) => http.post(
+  `/api/subscribers/${id}/erase`,
+  { reason },
+  { loading: models.subscribers },
+);
+
+export const getSubscriberErasures = async (params) => http.get(
+  '/api/subscribers/erasures',
+  { params },
+);
+
+export const getSubscriberDuplicates = async (params) => http.get(
+  '/api/subscribers/duplicates',
+  { params, loading: models.subscribers },
+);
+
+export const mergeSubscribers = (data) => http.post(
+  '/api/subscribers/merge',
+  data,
+  { loading: models.subscribers },
+);
+
 export const addSubscribersToLists = (data) => http.put(
   '/api/subscribers/lists',
   data,
@@ -237,6 +360,18 @@ export const blocklistSubscribersByQuery = (data) => http.put(
   { loading: models.subscribers },
 );
 
+export const restoreSubscribers = (data) => http.put(
+  '/api/subscribers/restore',
+  data,
+  { loading: models.subscribers },
+);
+
+export const restoreSubscribersByQuery = (data) => http.put(
+  '/api/subscribers/query/restore',
+  data,
+  { loading: models.subscribers },
+);
+
 export const deleteSubscribers = (params) => http.delete(
   '/api/subscribers',
   { params, loading: models.subscribers },
@@ -248,9 +383,49 @@ export const deleteSubscribersByQuery = (data) => http.post(
   { loading: models.subscribers },
 );
 
+export const getSubscriberTags = async () => http.get('/api/subscribers/tags');
+
+export const renameSubscriberTag = async (tag, name) => http.put(
+  `/api/subscribers/tags/${encodeURIComponent(tag)}`,
+  { name },
+);
+
+export const deleteSubscriberTag = async (tag) => http.delete(`/api/subscribers/tags/${encodeURIComponent(tag)}`);
+
+export const manageSubscriberTags = (data) => http.put(
+  '/api/subscribers/tags',
+  data,
+  { loading: models.subscribers },
+);
+
+export const manageSubscriberTagsByQuery = (data) => http.put(
+  '/api/subscribers/query/tags',
+  data,
+  { loading: models.subscribers },
+);
+
+export const getSubscriberJobs = async (params) => http.get(
+  '/api/subscribers/jobs',
+  { params },
+);
+
+export const getSubscriberJob = async (id) => http.get(
+  `/api/subscribers/jobs/${id}`,
+  { disableToast: true },
+);
+
+export const cancelSubscriberJob = async (id) => http.delete(`/api/subscribers/jobs/${id}`);
+
 // Subscriber import.
 export const importSubscribers = (data) => http.post('/api/import/subscribers', data);
 
+export const importMailchimp = (data) => http.post('/api/import/subscribers/mailchimp', data);
+
+export const getMailchimpAudiences = async (apiKey) => http.post(
+  '/api/import/subscribers/mailchimp/audiences',
+  { api_key: apiKey },
+);
+
 export const getImportStatus = () => http.get('/api/import/subscribers');
 
 export const getImportLogs = async () => http.get(
@@ -276,11 +451,56 @@ export const getCampaigns = async (params) => http.get('/api/campaigns', {
 
 export const getCampaign = async (id) => http.get(`/api/campaigns/${id}`, {
   loading: models.campaigns,
-  camelCase: (keyPath) => !keyPath.startsWith('.headers'),
+  camelCase: (keyPath) => !keyPath.startsWith('.headers') && !keyPath.startsWith('.utm_params.'),
 });
 
 export const getCampaignStats = async () => http.get('/api/campaigns/running/stats', {});
 
+export const getCampaignVersions = async (id) => http.get(`/api/campaigns/${id}/versions`, {});
+
+export const getCampaignLinkClicks = async (id) => http.get(`/api/campaigns/${id}/links`, {});
+
+export const getCampaignTests = async (id) => http.get(`/api/campaigns/${id}/tests`, {});
+
+export const getCampaignAudience = async (id, params) => http.get(
+  `/api/campaigns/${id}/audience`,
+  { params },
+);
+
+export const previewCampaignSubjects = async (id, data) => http.post(
+  `/api/campaigns/${id}/subjects`,
+  data,
+);
+
+export const getCampaignSimulation = async (id) => http.get(
+  `/api/campaigns/${id}/simulation`,
+  { disableToast: true },
+);
+
+export const startCampaignSimulation = async (id) => http.post(`/api/campaigns/${id}/simulation`);
+
+export const cancelCampaignSimulation = async (id) => http.delete(`/api/campaigns/${id}/simulation`);
+
+export const getCampaignRecipients = async (id, params) => http.get(
+  `/api/campaigns/${id}/recipients`,
+  { params },
+);
+
+export const getCampaignDeliveryLog = async (id, params) => http.get(
+  `/api/campaigns/${id}/deliveries/log`,
+  { params },
+);
+
+export const getCampaignRevisions = async (id) => http.get(`/api/campaigns/${id}/revisions`, {});
+
+export const getCampaignRevision = async (id, revID) => http.get(`/api/campaigns/${id}/revisions/${revID}`, {});
+
+export const restoreCampaignRevision = async (id, revID) => http.post(
+  `/api/campaigns/${id}/revisions/${revID}/restore`,
+  {},
+  { loading: models.campaigns },
+);
+
 export const createCampaign = async (data) => http.post(
   '/api/campaigns',
   data,
@@ -319,6 +539,12 @@ export const testCampaign = async (data) => http.post(
   { loading: models.campaigns },
 );
 
+export const preflightCampaign = async (id, data) => http.post(
+  `/api/campaigns/${id}/preflight`,
+  data,
+  { loading: models.campaigns },
+);
+
 export const updateCampaign = async (id, data) => http.put(
   `/api/campaigns/${id}`,
   data,
@@ -332,6 +558,12 @@ export const changeCampaignStatus = async (id, status) => http.put(
   { loading: models.campaigns },
 );
 
+export const retryCampaignErrors = async (id) => http.post(
+  `/api/campaigns/${id}/retry`,
+  {},
+  { loading: models.campaigns },
+);
+
 export const updateCampaignArchive = async (id, data) => http.put(
   `/api/campaigns/${id}/archive`,
   data,
@@ -343,6 +575,31 @@ export const deleteCampaign = async (id) => http.delete(
   { loading: models.campaigns },
 );
 
+export const importCampaign = async (data) => http.post(
+  '/api/campaigns/import',
+  data,
+  { loading: models.campaigns },
+);
+
+export const getCampaignTags = async () => http.get('/api/campaigns/tags', {});
+
+export const addCampaignTag = async (data) => http.post(
+  '/api/campaigns/tags',
+  data,
+  { loading: models.campaigns },
+);
+
+export const renameCampaignTag = async (tag, name) => http.put(
+  `/api/campaigns/tags/${encodeURIComponent(tag)}`,
+  { name },
+  { loading: models.campaigns },
+);
+
+export const deleteCampaignTag = async (tag) => http.delete(
+  `/api/campaigns/tags/${encodeURIComponent(tag)}`,
+  { loading: models.campaigns },
+);
+
 // Media.
 export const getMedia = async (params) => http.get(
   '/api/media',
@@ -384,17 +641,221 @@ export const makeTemplateDefault = async (id) => http.put(
   { loading: models.templates },
 );
 
+export const lintTemplate = async (data) => http.post(
+  '/api/templates/lint',
+  data,
+  { loading: models.templates },
+);
+
+export const getTemplateRevisions = async (id) => http.get(`/api/templates/${id}/revisions`, {});
+
+export const getTemplateRevision = async (id, revID) => http.get(`/api/templates/${id}/revisions/${revID}`, {});
+
+export const restoreTemplateRevision = async (id, revID) => http.post(
+  `/api/templates/${id}/revisions/${revID}/restore`,
+  {},
+  { loading: models.templates },
+);
+
+// Remote template gallery.
+export const getTemplateGallery = async () => http.get('/api/templates/gallery', { loading: models.templates });
+
+export const importGalleryTemplate = async (data) => http.post(
+  '/api/templates/gallery/import',
+  data,
+  { loading: models.templates },
+);
+
+// Visual builder documents of campaigns and templates, whose keys are
+// left as they are to be sent back as is.
+export const getBuilderDoc = async (type, id) => http.get(
+  `/api/${type}s/${id}/builder`,
+  { camelCase: (keyPath) => !keyPath.startsWith('.doc.') },
+);
+
+export const updateBuilderDoc = async (type, id, doc) => http.put(
+  `/api/${type}s/${id}/builder`,
+  doc,
+  { loading: models.templates, camelCase: (keyPath) => !keyPath.startsWith('.doc.') },
+);
+
+export const deleteBuilderDoc = async (type, id) => http.delete(
+  `/api/${type}s/${id}/builder`,
+  { loading: models.templates },
+);
+
+export const renderBuilderDoc = async (doc) => http.post('/api/builder/render', doc);
+
 export const deleteTemplate = async (id) => http.delete(
   `/api/templates/${id}`,
   { loading: models.templates },
 );
 
+// Template partials.
+export const getTemplatePartials = async () => http.get(
+  '/api/templates/partials',
+  { loading: models.templates },
+);
+
+export const createTemplatePartial = async (data) => http.post(
+  '/api/templates/partials',
+  data,
+  { loading: models.templates },
+);
+
+export const updateTemplatePartial = async (data) => http.put(
+  `/api/templates/partials/${data.id}`,
+  data,
+  { loading: models.templates },
+);
+
+export const deleteTemplatePartial = async (id) => http.delete(
+  `/api/templates/partials/${id}`,
+  { loading: models.templates },
+);
+
+// RSS feeds.
+export const getRSSFeeds = async () => http.get(
+  '/api/rss',
+  { loading: models.rssFeeds, store: models.rssFeeds },
+);
+
+export const createRSSFeed = async (data) => http.post(
+  '/api/rss',
+  data,
+  { loading: models.rssFeeds },
+);
+
+export const updateRSSFeed = async (data) => http.put(
+  `/api/rss/${data.id}`,
+  data,
+  { loading: models.rssFeeds },
+);
+
+export const checkRSSFeed = async (id) => http.post(
+  `/api/rss/${id}/check`,
+  {},
+  { loading: models.rssFeeds },
+);
+
+export const deleteRSSFeed = async (id) => http.delete(
+  `/api/rss/${id}`,
+  { loading: models.rssFeeds },
+);
+
+// CRM syncs. The CRM properties in the attribute mappings are left as they are.
+export const getCRMSyncs = async () => http.get(
+  '/api/crm-syncs',
+  {
+    loading: models.crmSyncs,
+    store: models.crmSyncs,
+    camelCase: (keyPath) => !keyPath.startsWith('.*.mapping.attribs.'),
+  },
+);
+
+export const createCRMSync = async (data) => http.post(
+  '/api/crm-syncs',
+  data,
+  { loading: models.crmSyncs },
+);
+
+export const updateCRMSync = async (data) => http.put(
+  `/api/crm-syncs/${data.id}`,
+  data,
+  { loading: models.crmSyncs },
+);
+
+export const runCRMSync = async (id) => http.post(
+  `/api/crm-syncs/${id}/run`,
+  {},
+  { loading: models.crmSyncs },
+);
+
+export const deleteCRMSync = async (id) => http.delete(
+  `/api/crm-syncs/${id}`,
+  { loading: models.crmSyncs },
+);
+
+// Subscription forms.
+export const getForms = async () => http.get(
+  '/api/forms',
+  { loading: models.forms, store: models.forms },
+);
+
+export const getFormStats = async (id, params) => http.get(
+  `/api/forms/${id}/stats`,
+  { params },
+);
+
+export const createForm = async (data) => http.post(
+  '/api/forms',
+  data,
+  { loading: models.forms },
+);
+
+export const updateForm = async (data) => http.put(
+  `/api/forms/${data.id}`,
+  data,
+  { loading: models.forms },
+);
+
+export const deleteForm = async (id) => http.delete(
+  `/api/forms/${id}`,
+  { loading: models.forms },
+);
+
+// Segments.
+export const getSegments = async () => http.get(
+  '/api/segments',
+  { loading: models.segments, store: models.segments },
+);
+
+export const createSegment = async (data) => http.post(
+  '/api/segments',
+  data,
+  { loading: models.segments },
+);
+
+export const updateSegment = async (data) => http.put(
+  `/api/segments/${data.id}`,
+  data,
+  { loading: models.segments },
+);
+
+export const refreshSegment = async (id) => http.post(
+  `/api/segments/${id}/refresh`,
+  {},
+  { loading: models.segments },
+);
+
+export const getSegmentStats = async (id, params) => http.get(
+  `/api/segments/${id}/stats`,
+  { params },
+);
+
+export const deleteSegment = async (id) => http.delete(
+  `/api/segments/${id}`,
+  { loading: models.segments },
+);
+
 // Settings.
 export const getServerConfig = async () => http.get(
   '/api/config',
   { loading: models.serverConfig, store: models.serverConfig, camelCase: false },
 );
 
+export const getMessengerUsage = async () => http.get('/api/messengers/usage', {});
+
+export const getDomainBlocklist = async () => http.get('/api/domain-blocklist', {});
+
+export const getDisposableDomains = async () => http.get('/api/domain-blocklist/disposable', {});
+
+export const refreshDisposableDomains = async () => http.post(
+  '/api/domain-blocklist/disposable/refresh',
+  {},
+  { loading: models.settings },
+);
+
 export const getSettings = async () => http.get(
   '/api/settings',
   { loading: models.settings, store: models.settings, camelCase: false },
@@ -412,6 +873,29 @@ export const testSMTP = async (data) => http.post(
   { loading: models.settings, disableToast: true },
 );
 
+// API tokens.
+export const getAPITokens = async () => http.get(
+  '/api/tokens',
+  { loading: models.apiTokens, store: models.apiTokens },
+);
+
+export const createAPIToken = async (data) => http.post(
+  '/api/tokens',
+  data,
+  { loading: models.apiTokens },
+);
+
+export const updateAPIToken = async (data) => http.put(
+  `/api/tokens/${data.id}`,
+  data,
+  { loading: models.apiTokens },
+);
+
+export const deleteAPIToken = async (id) => http.delete(
+  `/api/tokens/${id}`,
+  { loading: models.apiTokens },
+);
+
 export const getLogs = async () => http.get(
   '/api/logs',
   { loading: models.logs, camelCase: false },
@@ -440,3 +924,8 @@ export const deleteGCSubscriptions = async (beforeDate) => http.delete(
   '/api/maintenance/subscriptions/unconfirmed',
   { loading: models.maintenance, params: { before_date: beforeDate } },
 );
+
+export const previewSubscriberHygiene = async (params) => http.get(
+  '/api/maintenance/hygiene',
+  { loading: models.maintenance, params },
+);
@@ -6,9 +6,14 @@ export const models = Object.freeze({
   subscribers: 'subscribers',
   campaigns: 'campaigns',
   templates: 'templates',
+  rssFeeds: 'rssFeeds',
+  crmSyncs: 'crmSyncs',
+  forms: 'forms',
+  segments: 'segments',
   media: 'media',
   bounces: 'bounces',
   settings: 'settings',
+  apiTokens: 'apiTokens',
   logs: 'logs',
   maintenance: 'maintenance',
 });
@@ -23,6 +28,7 @@ export const uris = Object.freeze({
   previewRawTemplate: '/api/templates/preview',
   exportSubscribers: '/api/subscribers/export',
   errorEvents: '/api/events?type=error',
+  campaignStatsStream: '/api/campaigns/:id/stats/stream',
   base: `${baseURL}/static`,
   root: rootURL,
   static: `${baseURL}/static`,
@@ -29,6 +29,12 @@ const routes = [
     meta: { title: 'forms.title', group: 'lists' },
     component: () => import('../views/Forms.vue'),
   },
+  {
+    path: '/lists/crm-syncs',
+    name: 'crmSyncs',
+    meta: { title: 'globals.terms.crmSyncs', group: 'lists' },
+    component: () => import('../views/CRMSyncs.vue'),
+  },
   {
     path: '/lists/:id',
     name: 'list',
@@ -53,6 +59,18 @@ const routes = [
     meta: { title: 'globals.terms.bounces', group: 'subscribers' },
     component: () => import('../views/Bounces.vue'),
   },
+  {
+    path: '/subscribers/duplicates',
+    name: 'duplicates',
+    meta: { title: 'subscribers.duplicates', group: 'subscribers' },
+    component: () => import('../views/Duplicates.vue'),
+  },
+  {
+    path: '/subscribers/segments',
+    name: 'segments',
+    meta: { title: 'globals.terms.segments', group: 'subscribers' },
+    component: () => import('../views/Segments.vue'),
+  },
   {
     path: '/subscribers/lists/:listID',
     name: 'subscribers_list',
@@ -83,6 +101,12 @@ const routes = [
     meta: { title: 'globals.terms.templates', group: 'campaigns' },
     component: () => import('../views/Templates.vue'),
   },
+  {
+    path: '/campaigns/rss',
+    name: 'rssFeeds',
+    meta: { title: 'globals.terms.rssFeeds', group: 'campaigns' },
+    component: () => import('../views/RSSFeeds.vue'),
+  },
   {
     path: '/campaigns/analytics',
     name: 'campaignAnalytics',
@@ -107,6 +131,12 @@ const routes = [
     meta: { title: 'logs.title', group: 'settings' },
     component: () => import('../views/Logs.vue'),
   },
+  {
+    path: '/settings/api-tokens',
+    name: 'apiTokens',
+    meta: { title: 'globals.terms.apiTokens', group: 'settings' },
+    component: () => import('../views/APITokens.vue'),
+  },
   {
     path: '/settings/maintenance',
     name: 'maintenance',
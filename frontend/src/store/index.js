@@ -41,7 +41,12 @@ export default new Vuex.Store({
     [models.campaigns]: (state) => state[models.campaigns],
     [models.media]: (state) => state[models.media],
     [models.templates]: (state) => state[models.templates],
+    [models.rssFeeds]: (state) => state[models.rssFeeds],
+    [models.crmSyncs]: (state) => state[models.crmSyncs],
+    [models.forms]: (state) => state[models.forms],
+    [models.segments]: (state) => state[models.segments],
     [models.settings]: (state) => state[models.settings],
+    [models.apiTokens]: (state) => state[models.apiTokens],
     [models.serverConfig]: (state) => state[models.serverConfig],
     [models.logs]: (state) => state[models.logs],
   },
@@ -70,6 +70,50 @@ export default class Utils {
 
   duration = (start, end) => dayjs(end).from(dayjs(start), true);
 
+  // Returns the UTC offset (ms) of an IANA timezone at a date.
+  tzOffset = (d, tz) => {
+    const p = {};
+    new Intl.DateTimeFormat('en-US', {
+      timeZone: tz,
+      hourCycle: 'h23',
+      year: 'numeric',
+      month: 'numeric',
+      day: 'numeric',
+      hour: 'numeric',
+      minute: 'numeric',
+      second: 'numeric',
+    }).formatToParts(d).forEach((v) => { p[v.type] = parseInt(v.value, 10); });
+
+    return Date.UTC(p.year, p.month - 1, p.day, p.hour, p.minute, p.second) - Math.floor(d.getTime() / 1000) * 1000;
+  };
+
+  // Returns the date at which the wall-clock time of d (in the browser's
+  // timezone) occurs in the timezone tz. d is returned as it is if tz
+  // isn't a valid timezone.
+  wallTimeIn = (d, tz) => {
+    try {
+      const utc = Date.UTC(d.getFullYear(), d.getMonth(), d.getDate(), d.getHours(), d.getMinutes(), d.getSeconds());
+
+      // The offset at the resulting date is used, which differs from the one
+      // at utc close to DST changes.
+      const off = this.tzOffset(new Date(utc), tz);
+      return new Date(utc - this.tzOffset(new Date(utc - off), tz));
+    } catch (e) {
+      return d;
+    }
+  };
+
+  // Returns the date (in the browser's timezone) whose wall-clock time is
+  // that of d in the timezone tz. This is the inverse of wallTimeIn().
+  wallTimeOf = (d, tz) => {
+    try {
+      const t = new Date(d.getTime() + this.tzOffset(d, tz));
+      return new Date(t.getUTCFullYear(), t.getUTCMonth(), t.getUTCDate(), t.getUTCHours(), t.getUTCMinutes(), t.getUTCSeconds());
+    } catch (e) {
+      return d;
+    }
+  };
+
   // Simple, naive, e-mail address check.
   validateEmail = (e) => e.match(reEmail);
 
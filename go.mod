@@ -31,7 +31,9 @@ require (
 	github.com/spf13/pflag v1.0.5
 	github.com/yuin/goldmark v1.6.0
 	github.com/zerodha/easyjson v1.0.0
+	golang.org/x/crypto v0.21.0
 	golang.org/x/mod v0.17.0
+	golang.org/x/net v0.23.0
 	gopkg.in/volatiletech/null.v6 v6.0.0-20170828023728-0bef4e07ae1b
 )
 
@@ -57,9 +59,7 @@ require (
 	github.com/spf13/cast v1.5.0 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
 	github.com/valyala/fasttemplate v1.2.2 // indirect
-	golang.org/x/crypto v0.21.0 // indirect
 	golang.org/x/image v0.18.0 // indirect
-	golang.org/x/net v0.23.0 // indirect
 	golang.org/x/sys v0.18.0 // indirect
 	golang.org/x/text v0.16.0 // indirect
 	golang.org/x/time v0.5.0 // indirect
@@ -0,0 +1,203 @@
+// Package avscan scans files for malware using an external ClamAV (clamd)
+// or ICAP service.
+package avscan
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	TypeClamAV = "clamav"
+	TypeICAP   = "icap"
+
+	// Size of the chunks files are streamed to clamd in.
+	clamChunkSize = 64 * 1024
+)
+
+// Opt represents the scanner options.
+type Opt struct {
+	// clamav or icap.
+	Type string `json:"type"`
+
+	// clamav: tcp://localhost:3310 or unix:///var/run/clamav/clamd.ctl
+	// icap: icap://localhost:1344/avscan
+	URL string `json:"url"`
+
+	Timeout time.Duration `json:"timeout"`
+}
+
+// Scanner scans files with an external scanning service.
+type Scanner struct {
+	o   Opt
+	url *url.URL
+}
+
+// New returns a new instance of Scanner.
+func New(o Opt) (*Scanner, error) {
+	if o.Type != TypeClamAV && o.Type != TypeICAP {
+		return nil, fmt.Errorf("unknown scanner type: %s", o.Type)
+	}
+
+	u, err := url.Parse(o.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scanner URL: %v", err)
+	}
+
+	switch o.Type {
+	case TypeClamAV:
+		if u.Scheme != "tcp" && u.Scheme != "unix" {
+			return nil, fmt.Errorf("ClamAV URL should be tcp:// or unix://")
+		}
+	case TypeICAP:
+		if u.Scheme != "icap" {
+			return nil, fmt.Errorf("ICAP URL should be icap://")
+		}
+		if u.Port() == "" {
+			u.Host = net.JoinHostPort(u.Hostname(), "1344")
+		}
+	}
+
+	if o.Timeout == 0 {
+		o.Timeout = time.Second * 10
+	}
+
+	return &Scanner{o: o, url: u}, nil
+}
+
+// Scan scans the given file and returns the name of the threat found in it,
+// if any. An empty string means that the file is clean.
+func (s *Scanner) Scan(name string, b []byte) (string, error) {
+	if s.o.Type == TypeICAP {
+		return s.scanICAP(name, b)
+	}
+	return s.scanClamAV(b)
+}
+
+// scanClamAV scans a file with clamd's INSTREAM command.
+func (s *Scanner) scanClamAV(b []byte) (string, error) {
+	addr := s.url.Host
+	if s.url.Scheme == "unix" {
+		addr = s.url.Path
+	}
+
+	conn, err := net.DialTimeout(s.url.Scheme, addr, s.o.Timeout)
+	if err != nil {
+		return "", fmt.Errorf("error connecting to ClamAV: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(s.o.Timeout))
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return "", fmt.Errorf("error writing to ClamAV: %v", err)
+	}
+
+	// Stream the file as <4 byte length><data> chunks terminated by a 0 length chunk.
+	var l [4]byte
+	for i := 0; i < len(b); i += clamChunkSize {
+		end := i + clamChunkSize
+		if end > len(b) {
+			end = len(b)
+		}
+
+		binary.BigEndian.PutUint32(l[:], uint32(end-i))
+		if _, err := conn.Write(l[:]); err != nil {
+			return "", fmt.Errorf("error writing to ClamAV: %v", err)
+		}
+		if _, err := conn.Write(b[i:end]); err != nil {
+			return "", fmt.Errorf("error writing to ClamAV: %v", err)
+		}
+	}
+	binary.BigEndian.PutUint32(l[:], 0)
+	if _, err := conn.Write(l[:]); err != nil {
+		return "", fmt.Errorf("error writing to ClamAV: %v", err)
+	}
+
+	resp, err := io.ReadAll(conn)
+	if err != nil {
+		return "", fmt.Errorf("error reading from ClamAV: %v", err)
+	}
+
+	// stream: OK | stream: $threat FOUND | $error ERROR
+	r := strings.TrimSpace(strings.TrimRight(string(resp), "\x00"))
+	switch {
+	case strings.HasSuffix(r, "OK"):
+		return "", nil
+	case strings.HasSuffix(r, "FOUND"):
+		return strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(r, "stream:"), "FOUND")), nil
+	}
+
+	return "", fmt.Errorf("ClamAV error: %s", r)
+}
+
+// scanICAP scans a file with an ICAP RESPMOD request that encapsulates the
+// file as an HTTP response. A 204 response means the file is clean.
+func (s *Scanner) scanICAP(name string, b []byte) (string, error) {
+	conn, err := net.DialTimeout("tcp", s.url.Host, s.o.Timeout)
+	if err != nil {
+		return "", fmt.Errorf("error connecting to ICAP: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(s.o.Timeout))
+
+	resHdr := "HTTP/1.1 200 OK\r\n" +
+		"Content-Type: application/octet-stream\r\n" +
+		"Content-Disposition: attachment; filename=" + strconv.Quote(name) + "\r\n" +
+		"Content-Length: " + strconv.Itoa(len(b)) + "\r\n\r\n"
+
+	var req bytes.Buffer
+	fmt.Fprintf(&req, "RESPMOD %s ICAP/1.0\r\n", s.url.String())
+	fmt.Fprintf(&req, "Host: %s\r\n", s.url.Hostname())
+	req.WriteString("Allow: 204\r\n")
+	fmt.Fprintf(&req, "Encapsulated: res-hdr=0, res-body=%d\r\n\r\n", len(resHdr))
+	req.WriteString(resHdr)
+	fmt.Fprintf(&req, "%x\r\n", len(b))
+	req.Write(b)
+	req.WriteString("\r\n0\r\n\r\n")
+
+	if _, err := conn.Write(req.Bytes()); err != nil {
+		return "", fmt.Errorf("error writing to ICAP: %v", err)
+	}
+
+	tp := textproto.NewReader(bufio.NewReader(conn))
+	line, err := tp.ReadLine()
+	if err != nil {
+		return "", fmt.Errorf("error reading from ICAP: %v", err)
+	}
+
+	// ICAP/1.0 204 No Content
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) < 2 {
+		return "", fmt.Errorf("invalid ICAP response: %s", line)
+	}
+
+	hdr, err := tp.ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("error reading from ICAP: %v", err)
+	}
+
+	switch parts[1] {
+	case "204":
+		return "", nil
+	case "200":
+		// The service modified (blocked) the response. The threat name is in
+		// one of the non-standard headers that most services set.
+		for _, h := range []string{"X-Infection-Found", "X-Virus-Id", "X-Violations-Found"} {
+			if v := hdr.Get(h); v != "" {
+				return v, nil
+			}
+		}
+		return "blocked by ICAP service", nil
+	}
+
+	return "", fmt.Errorf("ICAP error: %s", line)
+}
@@ -0,0 +1,118 @@
+package mailbox
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/emersion/go-message"
+	"github.com/knadh/listmonk/models"
+)
+
+var (
+	// Headers with their folded continuation lines, eg: Authentication-Results: mx.site.com;\r\n\tspf=fail
+	reHdrAuthResults    = regexp.MustCompile(`(?m)(?:^` + models.EmailHeaderAuthResults + `:[ \t]*)(.*(?:\r?\n[ \t]+.*)*)`)
+	reHdrARCAuthResults = regexp.MustCompile(`(?m)(?:^` + models.EmailHeaderARCAuthResults + `:[ \t]*)(.*(?:\r?\n[ \t]+.*)*)`)
+	reHdrFolding        = regexp.MustCompile(`\r?\n[ \t]+`)
+
+	// Blank line that ends the header of a message.
+	reHdrEnd = regexp.MustCompile(`\r?\n\r?\n`)
+
+	// MIME types of the DSN (RFC 3464) parts that return the original message
+	// that bounced, or only its header.
+	origMsgTypes = map[string]bool{"message/rfc822": true, "text/rfc822-headers": true}
+
+	errOrigMsgFound = errors.New("original message found")
+
+	// Comments in Authentication-Results headers, eg: spf=pass (google.com: domain of ...).
+	reAuthComment = regexp.MustCompile(`\([^)]*\)`)
+
+	// Authentication methods that are inspected.
+	authMethods = map[string]bool{"spf": true, "dkim": true, "dmarc": true, "arc": true}
+
+	// Results that indicate an authentication failure.
+	authFailures = map[string]bool{"fail": true, "softfail": true, "permerror": true}
+)
+
+// getAuthHeaders returns the Authentication-Results and ARC-Authentication-Results
+// headers of the original message that a bounce e-mail returns. They're read from
+// the message/rfc822 or text/rfc822-headers part of a DSN and not from the header
+// of the DSN itself, which has the bounce mailbox's own results. If there's no such
+// part, they're looked up in the raw body of the bounce e-mail.
+func getAuthHeaders(b []byte) []string {
+	var orig *message.Entity
+	if m, _ := message.Read(bytes.NewReader(b)); m != nil {
+		_ = m.Walk(func(path []int, e *message.Entity, err error) error {
+			if t, _, _ := e.Header.ContentType(); !origMsgTypes[t] {
+				return nil
+			}
+			if o, _ := message.Read(e.Body); o != nil {
+				orig = o
+				return errOrigMsgFound
+			}
+			return nil
+		})
+	}
+
+	if orig != nil {
+		return append(orig.Header.Values(models.EmailHeaderAuthResults), orig.Header.Values(models.EmailHeaderARCAuthResults)...)
+	}
+
+	// Skip the bounce e-mail's own header.
+	if loc := reHdrEnd.FindIndex(b); loc != nil {
+		b = b[loc[1]:]
+	}
+	return append(findHeaders(reHdrAuthResults, b), findHeaders(reHdrARCAuthResults, b)...)
+}
+
+// findHeaders returns the unfolded values of all the headers that match the
+// given regexp in the raw bytes of a message.
+func findHeaders(re *regexp.Regexp, b []byte) []string {
+	var out []string
+	for _, m := range re.FindAllSubmatch(b, -1) {
+		out = append(out, strings.TrimSpace(reHdrFolding.ReplaceAllString(string(m[1]), " ")))
+	}
+	return out
+}
+
+// parseAuthResults parses Authentication-Results and ARC-Authentication-Results
+// header values (RFC 8601) and returns a map of method => result, eg: spf => fail.
+// Headers are expected in the order they appear in a message (the most recent
+// first) and the first result for a method is the one that's retained.
+func parseAuthResults(hdrs []string) map[string]string {
+	out := make(map[string]string)
+	for _, h := range hdrs {
+		h = reAuthComment.ReplaceAllString(h, "")
+
+		for _, part := range strings.Split(h, ";") {
+			// The first token in every part is the method=result pair. The rest are
+			// properties, eg: dkim=pass header.i=@site.com
+			f := strings.Fields(part)
+			if len(f) == 0 {
+				continue
+			}
+
+			method, result, ok := strings.Cut(strings.ToLower(f[0]), "=")
+			if !ok || !authMethods[method] {
+				continue
+			}
+
+			if _, ok := out[method]; !ok {
+				out[method] = result
+			}
+		}
+	}
+
+	return out
+}
+
+// hasAuthFailure checks whether any of the parsed authentication results is a failure.
+func hasAuthFailure(res map[string]string) bool {
+	for _, r := range res {
+		if authFailures[r] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package mailbox
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// dsn returns a DSN bounce e-mail whose own header has passing results, and
+// whose last part returns the header of the original message of the given type.
+func dsn(origType string) []byte {
+	msg := `From: MAILER-DAEMON@bounces.listmonk.app
+To: bounces@listmonk.app
+Subject: Undelivered Mail Returned to Sender
+Authentication-Results: mx.listmonk.app; spf=pass smtp.mailfrom=bounces.listmonk.app
+MIME-Version: 1.0
+Content-Type: multipart/report; report-type=delivery-status; boundary="b1"
+
+--b1
+Content-Type: text/plain
+
+The mail couldn't be delivered.
+
+--b1
+Content-Type: message/delivery-status
+
+Reporting-MTA: dns; mx.example.com
+Final-Recipient: rfc822; john@example.com
+Action: failed
+Status: 5.7.1
+
+--b1
+Content-Type: ` + origType + `
+
+Authentication-Results: mx.example.com;
+	spf=fail (example.com: domain of news@listmonk.app does not designate 10.0.0.1 as permitted sender) smtp.mailfrom=listmonk.app;
+	dkim=pass header.i=@listmonk.app
+ARC-Authentication-Results: i=1; mx.example.com; dmarc=fail
+From: news@listmonk.app
+To: john@example.com
+Subject: Hello
+
+--b1--
+`
+	return []byte(strings.ReplaceAll(msg, "\n", "\r\n"))
+}
+
+func TestGetAuthHeaders(t *testing.T) {
+	exp := []string{
+		"mx.example.com; spf=fail (example.com: domain of news@listmonk.app does not designate 10.0.0.1 as permitted sender) smtp.mailfrom=listmonk.app; dkim=pass header.i=@listmonk.app",
+		"i=1; mx.example.com; dmarc=fail",
+	}
+	expRes := map[string]string{"spf": "fail", "dkim": "pass", "dmarc": "fail"}
+
+	for _, typ := range []string{"message/rfc822", "text/rfc822-headers"} {
+		hdrs := getAuthHeaders(dsn(typ))
+		if !reflect.DeepEqual(hdrs, exp) {
+			t.Errorf("%s: expected headers %q, got %q", typ, exp, hdrs)
+		}
+		if res := parseAuthResults(hdrs); !reflect.DeepEqual(res, expRes) {
+			t.Errorf("%s: expected results %v, got %v", typ, expRes, res)
+		}
+	}
+}
+
+func TestGetAuthHeadersNoDSN(t *testing.T) {
+	// A bounce that quotes the original message in its body. Its own header isn't looked at.
+	msg := "From: postmaster@example.com\nAuthentication-Results: mx.listmonk.app; spf=pass\nSubject: Delivery failed\n\n" +
+		"The original message was:\n\nAuthentication-Results: mx.example.com;\n  dkim=fail header.i=@listmonk.app\nFrom: news@listmonk.app\n"
+
+	hdrs := getAuthHeaders([]byte(msg))
+	if exp := []string{"mx.example.com; dkim=fail header.i=@listmonk.app"}; !reflect.DeepEqual(hdrs, exp) {
+		t.Errorf("expected headers %q, got %q", exp, hdrs)
+	}
+}
@@ -142,6 +142,11 @@ func (p *POP) Scan(limit int, ch chan models.Bounce) error {
 			}
 		}
 
+		// Authentication-Results of the original message that help diagnose
+		// bounces caused by SPF/DKIM/DMARC misalignment.
+		authHdrs := getAuthHeaders(b.Bytes())
+		authRes := parseAuthResults(authHdrs)
+
 		date, _ := time.Parse("Mon, 02 Jan 2006 15:04:05 -0700", hdr[models.EmailHeaderDate])
 		if date.IsZero() {
 			date = time.Now()
@@ -149,17 +154,23 @@ func (p *POP) Scan(limit int, ch chan models.Bounce) error {
 
 		// Additional bounce e-mail metadata.
 		meta, _ := json.Marshal(struct {
-			From        string   `json:"from"`
-			Subject     string   `json:"subject"`
-			MessageID   string   `json:"message_id"`
-			DeliveredTo string   `json:"delivered_to"`
-			Received    []string `json:"received"`
+			From        string            `json:"from"`
+			Subject     string            `json:"subject"`
+			MessageID   string            `json:"message_id"`
+			DeliveredTo string            `json:"delivered_to"`
+			Received    []string          `json:"received"`
+			AuthHeaders []string          `json:"authentication_results,omitempty"`
+			AuthResults map[string]string `json:"auth_results,omitempty"`
+			AuthFailed  bool              `json:"auth_failed"`
 		}{
 			From:        hdr[models.EmailHeaderFrom],
 			Subject:     hdr[models.EmailHeaderSubject],
 			MessageID:   hdr[models.EmailHeaderMessageId],
 			DeliveredTo: hdr[models.EmailHeaderDeliveredTo],
 			Received:    msgReceived,
+			AuthHeaders: authHdrs,
+			AuthResults: authRes,
+			AuthFailed:  hasAuthFailure(authRes),
 		})
 
 		select {
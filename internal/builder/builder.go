@@ -0,0 +1,399 @@
+// Package builder renders the block-based e-mail documents that are put
+// together on the visual e-mail builder to e-mail HTML. Documents are
+// rendered server-side so that the same document always renders to the
+// same HTML.
+package builder
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Version is the current version of the document model.
+const Version = 1
+
+// Block types.
+const (
+	BlockHeading = "heading"
+	BlockText    = "text"
+	BlockImage   = "image"
+	BlockButton  = "button"
+	BlockDivider = "divider"
+	BlockSpacer  = "spacer"
+	BlockColumns = "columns"
+	BlockHTML    = "html"
+
+	// BlockContent is the placeholder for campaign content in campaign templates.
+	BlockContent = "content"
+)
+
+const (
+	maxBlocks  = 500
+	maxColumns = 4
+	maxWidth   = 1200
+	maxHeight  = 500
+
+	defaultWidth = 600
+)
+
+var (
+	regexpColor  = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+	regexpAction = regexp.MustCompile(`(?s){{.*?}}`)
+	regexpFont   = regexp.MustCompile(`^[a-zA-Z0-9 ,'\-]{1,200}$`)
+
+	headingSizes = map[int]int{1: 28, 2: 22, 3: 18}
+)
+
+// Doc is a block-based e-mail document.
+type Doc struct {
+	Version int     `json:"version"`
+	Style   Style   `json:"style"`
+	Blocks  []Block `json:"blocks"`
+}
+
+// Style is the global style of a document.
+type Style struct {
+	// Colors are hex codes, eg: #ffffff.
+	Background        string `json:"background"`
+	ContentBackground string `json:"content_background"`
+	Color             string `json:"color"`
+	LinkColor         string `json:"link_color"`
+	FontFamily        string `json:"font_family"`
+
+	// Width (px) of the content.
+	Width int `json:"width"`
+}
+
+// Block is a content block in a document. The fields that are relevant
+// depend on the type of the block.
+type Block struct {
+	Type string `json:"type"`
+
+	// Plain text of headings and labels of buttons. HTML of text and html blocks.
+	Text  string `json:"text,omitempty"`
+	Level int    `json:"level,omitempty"`
+
+	// Images.
+	Src string `json:"src,omitempty"`
+	Alt string `json:"alt,omitempty"`
+
+	// Link of images and buttons.
+	URL string `json:"url,omitempty"`
+
+	// Width (px) of images and height (px) of spacers.
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+
+	// left, center, or right.
+	Align      string `json:"align,omitempty"`
+	Color      string `json:"color,omitempty"`
+	Background string `json:"background,omitempty"`
+
+	// Blocks in each column of a columns block.
+	Columns [][]Block `json:"columns,omitempty"`
+}
+
+// Validate validates a document and sets the defaults of its optional fields.
+func Validate(d *Doc) error {
+	if d.Version == 0 {
+		d.Version = Version
+	}
+	if d.Version != Version {
+		return fmt.Errorf("unsupported document version %d", d.Version)
+	}
+
+	s := &d.Style
+	for _, c := range []string{s.Background, s.ContentBackground, s.Color, s.LinkColor} {
+		if c != "" && !regexpColor.MatchString(c) {
+			return fmt.Errorf("invalid color: %s", c)
+		}
+	}
+	if s.FontFamily != "" && !regexpFont.MatchString(s.FontFamily) {
+		return fmt.Errorf("invalid font family: %s", s.FontFamily)
+	}
+	if s.Width < 0 || s.Width > maxWidth {
+		return fmt.Errorf("width should be between 0 and %d", maxWidth)
+	}
+
+	n := 0
+	return validateBlocks(d.Blocks, false, &n)
+}
+
+// HasBlock checks whether a document has a block of the given type.
+func (d Doc) HasBlock(typ string) bool {
+	return hasBlock(d.Blocks, typ)
+}
+
+// Render renders a document to a complete HTML e-mail body. Template
+// expressions in the document, eg: {{ .Subscriber.FirstName }}, are left
+// as they are to be compiled with the template.
+func Render(d Doc) string {
+	s := d.Style
+	if s.Background == "" {
+		s.Background = "#f4f4f4"
+	}
+	if s.ContentBackground == "" {
+		s.ContentBackground = "#ffffff"
+	}
+	if s.Color == "" {
+		s.Color = "#333333"
+	}
+	if s.LinkColor == "" {
+		s.LinkColor = "#0055d4"
+	}
+	if s.FontFamily == "" {
+		s.FontFamily = "Helvetica, Arial, sans-serif"
+	}
+	if s.Width == 0 {
+		s.Width = defaultWidth
+	}
+
+	var b strings.Builder
+	b.WriteString("<!doctype html>\n<html>\n<head>\n")
+	b.WriteString(`<meta charset="utf-8">` + "\n")
+	b.WriteString(`<meta name="viewport" content="width=device-width, initial-scale=1">` + "\n")
+	fmt.Fprintf(&b, "<style>\nbody { margin: 0; padding: 0; }\na { color: %s; }\nimg { border: 0; max-width: 100%%; }\n</style>\n", s.LinkColor)
+	b.WriteString("</head>\n")
+	fmt.Fprintf(&b, `<body style="margin: 0; padding: 0; background: %s;">`+"\n", s.Background)
+	fmt.Fprintf(&b, `<table role="presentation" width="100%%" cellpadding="0" cellspacing="0" border="0" style="background: %s;">`+"\n", s.Background)
+	b.WriteString(`<tr><td align="center" style="padding: 20px 10px;">` + "\n")
+	fmt.Fprintf(&b, `<table role="presentation" width="%d" cellpadding="0" cellspacing="0" border="0" style="width: 100%%; max-width: %dpx; background: %s; font-family: %s; color: %s;">`+"\n",
+		s.Width, s.Width, s.ContentBackground, s.FontFamily, s.Color)
+
+	for _, bl := range d.Blocks {
+		fmt.Fprintf(&b, `<tr><td align="%s" style="padding: %s;">`, align(bl.Align), blockPadding(bl))
+		renderBlock(&b, bl, s)
+		b.WriteString("</td></tr>\n")
+	}
+
+	b.WriteString("</table>\n</td></tr>\n</table>\n</body>\n</html>\n")
+
+	return b.String()
+}
+
+func validateBlocks(blocks []Block, inColumn bool, n *int) error {
+	for i, b := range blocks {
+		*n++
+		if *n > maxBlocks {
+			return fmt.Errorf("documents can have up to %d blocks", maxBlocks)
+		}
+
+		if err := validateBlock(b, inColumn, n); err != nil {
+			return fmt.Errorf("block %d (%s): %v", i+1, b.Type, err)
+		}
+	}
+
+	return nil
+}
+
+func validateBlock(b Block, inColumn bool, n *int) error {
+	switch b.Align {
+	case "", "left", "center", "right":
+	default:
+		return fmt.Errorf("invalid align: %s", b.Align)
+	}
+	for _, c := range []string{b.Color, b.Background} {
+		if c != "" && !regexpColor.MatchString(c) {
+			return fmt.Errorf("invalid color: %s", c)
+		}
+	}
+
+	switch b.Type {
+	case BlockHeading:
+		if b.Level < 0 || b.Level > 3 {
+			return fmt.Errorf("level should be between 1 and 3")
+		}
+		if strings.TrimSpace(b.Text) == "" {
+			return fmt.Errorf("text is empty")
+		}
+
+	case BlockText, BlockHTML:
+		if strings.TrimSpace(b.Text) == "" {
+			return fmt.Errorf("text is empty")
+		}
+
+	case BlockImage:
+		if !isURL(b.Src) {
+			return fmt.Errorf("invalid image URL: %s", b.Src)
+		}
+		if b.URL != "" && !isURL(b.URL) {
+			return fmt.Errorf("invalid link: %s", b.URL)
+		}
+		if b.Width < 0 || b.Width > maxWidth {
+			return fmt.Errorf("width should be between 0 and %d", maxWidth)
+		}
+
+	case BlockButton:
+		if strings.TrimSpace(b.Text) == "" {
+			return fmt.Errorf("label is empty")
+		}
+		if !isURL(b.URL) {
+			return fmt.Errorf("invalid link: %s", b.URL)
+		}
+
+	case BlockSpacer:
+		if b.Height < 0 || b.Height > maxHeight {
+			return fmt.Errorf("height should be between 0 and %d", maxHeight)
+		}
+
+	case BlockDivider, BlockContent:
+
+	case BlockColumns:
+		if inColumn {
+			return fmt.Errorf("columns can't be nested")
+		}
+		if len(b.Columns) < 2 || len(b.Columns) > maxColumns {
+			return fmt.Errorf("there should be 2 to %d columns", maxColumns)
+		}
+		for _, col := range b.Columns {
+			if err := validateBlocks(col, true, n); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("unknown block type")
+	}
+
+	return nil
+}
+
+func hasBlock(blocks []Block, typ string) bool {
+	for _, b := range blocks {
+		if b.Type == typ {
+			return true
+		}
+		for _, col := range b.Columns {
+			if hasBlock(col, typ) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func renderBlock(b *strings.Builder, bl Block, s Style) {
+	color := bl.Color
+	if color == "" {
+		color = s.Color
+	}
+
+	switch bl.Type {
+	case BlockHeading:
+		level := bl.Level
+		if level == 0 {
+			level = 1
+		}
+		fmt.Fprintf(b, `<h%d style="margin: 0; font-size: %dpx; line-height: 1.3; text-align: %s; color: %s;">%s</h%d>`,
+			level, headingSizes[level], align(bl.Align), color, esc(bl.Text), level)
+
+	case BlockText:
+		fmt.Fprintf(b, `<div style="font-size: 16px; line-height: 1.6; text-align: %s; color: %s;">%s</div>`,
+			align(bl.Align), color, bl.Text)
+
+	case BlockHTML:
+		b.WriteString(bl.Text)
+
+	case BlockImage:
+		width := ""
+		if bl.Width > 0 {
+			width = fmt.Sprintf(` width="%d"`, bl.Width)
+		}
+		img := fmt.Sprintf(`<img src="%s" alt="%s"%s style="display: block; max-width: 100%%; height: auto; border: 0;" />`,
+			esc(bl.Src), esc(bl.Alt), width)
+		if bl.URL != "" {
+			fmt.Fprintf(b, `<a href="%s" target="_blank">%s</a>`, esc(bl.URL), img)
+		} else {
+			b.WriteString(img)
+		}
+
+	case BlockButton:
+		bg := bl.Background
+		if bg == "" {
+			bg = s.LinkColor
+		}
+		if bl.Color == "" {
+			color = "#ffffff"
+		}
+		fmt.Fprintf(b, `<table role="presentation" cellpadding="0" cellspacing="0" border="0" align="%s"><tr>`, align(bl.Align))
+		fmt.Fprintf(b, `<td style="border-radius: 4px; background: %s;">`, bg)
+		fmt.Fprintf(b, `<a href="%s" target="_blank" style="display: inline-block; padding: 12px 24px; font-size: 16px; font-weight: bold; color: %s; text-decoration: none;">%s</a>`,
+			esc(bl.URL), color, esc(bl.Text))
+		b.WriteString("</td></tr></table>")
+
+	case BlockDivider:
+		if bl.Color == "" {
+			color = "#dddddd"
+		}
+		fmt.Fprintf(b, `<hr style="border: 0; border-top: 1px solid %s; margin: 0;" />`, color)
+
+	case BlockSpacer:
+		h := bl.Height
+		if h == 0 {
+			h = 20
+		}
+		fmt.Fprintf(b, `<div style="height: %dpx; line-height: %dpx; font-size: 1px;">&nbsp;</div>`, h, h)
+
+	case BlockContent:
+		b.WriteString(`{{ template "content" . }}`)
+
+	case BlockColumns:
+		width := 100 / len(bl.Columns)
+		b.WriteString(`<table role="presentation" width="100%" cellpadding="0" cellspacing="0" border="0"><tr>`)
+		for _, col := range bl.Columns {
+			fmt.Fprintf(b, `<td valign="top" width="%d%%" style="padding: 0 5px;">`, width)
+			for _, c := range col {
+				fmt.Fprintf(b, `<div style="padding: 5px 0; text-align: %s;">`, align(c.Align))
+				renderBlock(b, c, s)
+				b.WriteString("</div>")
+			}
+			b.WriteString("</td>")
+		}
+		b.WriteString("</tr></table>")
+	}
+}
+
+// blockPadding returns the padding of a top-level block. Spacers and the
+// content placeholder are flush with the blocks around them.
+func blockPadding(b Block) string {
+	if b.Type == BlockSpacer || b.Type == BlockContent {
+		return "0 20px"
+	}
+
+	return "10px 20px"
+}
+
+func align(a string) string {
+	if a == "" {
+		return "left"
+	}
+	return a
+}
+
+// isURL checks whether s is an http(s) or mailto URL, or a template expression
+// such as {{ UnsubscribeURL }} or {{ RootURL }}/path.
+func isURL(s string) bool {
+	s = strings.TrimSpace(s)
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://") ||
+		strings.HasPrefix(s, "mailto:") || strings.HasPrefix(s, "{{")
+}
+
+// esc escapes text for use in HTML, leaving the template expressions in it
+// as they are.
+func esc(s string) string {
+	var (
+		b    strings.Builder
+		last = 0
+	)
+	for _, m := range regexpAction.FindAllStringIndex(s, -1) {
+		b.WriteString(html.EscapeString(s[last:m[0]]))
+		b.WriteString(s[m[0]:m[1]])
+		last = m[1]
+	}
+	b.WriteString(html.EscapeString(s[last:]))
+
+	return b.String()
+}
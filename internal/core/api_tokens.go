@@ -0,0 +1,100 @@
+package core
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+// GetAPITokens retrieves all API tokens.
+func (c *Core) GetAPITokens() ([]models.APIToken, error) {
+	out := []models.APIToken{}
+	if err := c.q.GetAPITokens.Select(&out, 0); err != nil {
+		c.log.Printf("error fetching api tokens: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.apiTokens}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// GetAPIToken retrieves a given API token.
+func (c *Core) GetAPIToken(id int) (models.APIToken, error) {
+	var out []models.APIToken
+	if err := c.q.GetAPITokens.Select(&out, id); err != nil {
+		c.log.Printf("error fetching api token: %v", err)
+		return models.APIToken{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.apiToken}", "error", pqErrMsg(err)))
+	}
+
+	if len(out) == 0 {
+		return models.APIToken{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.apiToken}"))
+	}
+
+	return out[0], nil
+}
+
+// CreateAPIToken creates a new API token with the hash of its token.
+func (c *Core) CreateAPIToken(o models.APIToken, tokenHash string) (models.APIToken, error) {
+	var newID int
+	if err := c.q.CreateAPIToken.Get(&newID, o.Name, o.Username, tokenHash, o.Role, o.ListIDs, o.FolderIDs); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Constraint == "api_tokens_username_key" {
+			return models.APIToken{}, echo.NewHTTPError(http.StatusConflict, c.i18n.T("apiTokens.usernameExists"))
+		}
+
+		c.log.Printf("error creating api token: %v", err)
+		return models.APIToken{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.apiToken}", "error", pqErrMsg(err)))
+	}
+
+	return c.GetAPIToken(newID)
+}
+
+// UpdateAPIToken updates the name, role, lists, and list folders of a given API token.
+func (c *Core) UpdateAPIToken(id int, o models.APIToken) (models.APIToken, error) {
+	res, err := c.q.UpdateAPIToken.Exec(id, o.Name, o.Role, o.ListIDs, o.FolderIDs)
+	if err != nil {
+		c.log.Printf("error updating api token: %v", err)
+		return models.APIToken{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.apiToken}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return models.APIToken{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.apiToken}"))
+	}
+
+	return c.GetAPIToken(id)
+}
+
+// DeleteAPIToken deletes a given API token.
+func (c *Core) DeleteAPIToken(id int) error {
+	if _, err := c.q.DeleteAPIToken.Exec(id); err != nil {
+		c.log.Printf("error deleting api token: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.apiToken}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// AuthAPIToken returns the API token with the given username and token hash,
+// and records its use. ok is false if there's no such token.
+func (c *Core) AuthAPIToken(username, tokenHash string) (models.APIToken, bool, error) {
+	var out models.APIToken
+	if err := c.q.AuthAPIToken.Get(&out, username, tokenHash); err != nil {
+		if err == sql.ErrNoRows {
+			return out, false, nil
+		}
+
+		c.log.Printf("error authenticating api token: %v", err)
+		return out, false, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.apiToken}", "error", pqErrMsg(err)))
+	}
+
+	return out, true, nil
+}
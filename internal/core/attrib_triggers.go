@@ -0,0 +1,72 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/knadh/listmonk/models"
+)
+
+// getAttribsForTriggers returns the current attributes of a subscriber that's
+// about to be updated, for the attribute triggers to compare the update with.
+// It returns false if there are no triggers to run.
+func (c *Core) getAttribsForTriggers(id int) (models.JSON, bool) {
+	if len(c.consts.AttribTriggers) == 0 {
+		return nil, false
+	}
+
+	sub, err := c.GetSubscriber(id, "", "")
+	if err != nil {
+		return nil, false
+	}
+
+	return sub.Attribs, true
+}
+
+// runAttribTriggers runs the attribute triggers that match the changes to a
+// subscriber's attributes from before (nil for new subscribers). Errors are
+// logged and don't fail the change.
+func (c *Core) runAttribTriggers(before models.JSON, sub models.Subscriber) {
+	for _, t := range c.consts.AttribTriggers {
+		v, ok := sub.Attribs[t.Attrib]
+		if !ok {
+			continue
+		}
+
+		val := attribString(v)
+		if t.Value != "" && val != t.Value {
+			continue
+		}
+		if old, ok := before[t.Attrib]; ok && attribString(old) == val {
+			continue
+		}
+
+		if t.ListID > 0 {
+			if err := c.AddSubscriptions([]int{sub.ID}, []int{t.ListID}, ""); err != nil {
+				c.log.Printf("error adding subscriber %d to list %d on attribute trigger (%s): %v", sub.ID, t.ListID, t.Attrib, err)
+			}
+		}
+
+		if t.TemplateID > 0 && c.h != nil && c.h.SendTemplate != nil {
+			if err := c.h.SendTemplate(sub, t.TemplateID); err != nil {
+				c.log.Printf("error sending template %d to subscriber %d on attribute trigger (%s): %v", t.TemplateID, sub.ID, t.Attrib, err)
+			}
+		}
+	}
+}
+
+// attribString returns an attribute value as a string to compare it with
+// the value of a trigger. Objects and arrays are compared as JSON.
+func attribString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64, bool, json.Number:
+		return fmt.Sprintf("%v", v)
+	}
+
+	b, _ := json.Marshal(v)
+	return string(b)
+}
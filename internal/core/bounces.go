@@ -1,6 +1,7 @@
 package core
 
 import (
+	"database/sql"
 	"fmt"
 	"net/http"
 	"strings"
@@ -57,6 +58,19 @@ func (c *Core) GetBounce(id int) (models.Bounce, error) {
 	return out[0], nil
 }
 
+// GetBounceAuthStats retrieves bounce counts by the authentication method and result
+// recorded from bounce e-mails, optionally filtered by a campaign.
+func (c *Core) GetBounceAuthStats(campID int) ([]models.BounceAuthStat, error) {
+	out := []models.BounceAuthStat{}
+	if err := c.q.GetBounceAuthStats.Select(&out, campID); err != nil {
+		c.log.Printf("error fetching bounce auth stats: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.bounces}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
 // RecordBounce records a new bounce.
 func (c *Core) RecordBounce(b models.Bounce) error {
 	action, ok := c.consts.BounceActions[b.Type]
@@ -64,6 +78,18 @@ func (c *Core) RecordBounce(b models.Bounce) error {
 		return echo.NewHTTPError(http.StatusBadRequest, c.i18n.Ts("globals.messages.invalidData")+": "+b.Type)
 	}
 
+	// A bounce of an alternate e-mail is only counted on the e-mail and doesn't
+	// affect the subscriber, whose primary e-mail is the one campaigns go to.
+	if b.Email != "" {
+		var subID int
+		if err := c.q.RecordSubscriberEmailBounce.Get(&subID, b.Email); err == nil {
+			return nil
+		} else if err != sql.ErrNoRows {
+			c.log.Printf("error recording bounce: %v", err)
+			return err
+		}
+	}
+
 	_, err := c.q.RecordBounce.Exec(b.SubscriberUUID,
 		b.Email,
 		b.CampaignUUID,
@@ -82,9 +108,12 @@ func (c *Core) RecordBounce(b models.Bounce) error {
 		}
 
 		c.log.Printf("error recording bounce: %v", err)
+		return err
 	}
 
-	return err
+	c.fireSubscriberEvent(EventSubscriberBounced, 0, b.SubscriberUUID, b.Email, b.Type)
+
+	return nil
 }
 
 // DeleteBounce deletes a list.
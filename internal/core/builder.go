@@ -0,0 +1,56 @@
+package core
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// GetBuilderDoc retrieves the visual builder document of a campaign or a
+// template. A nil document is returned if there's none.
+func (c *Core) GetBuilderDoc(campID, tplID int) (*models.BuilderDoc, error) {
+	var out models.BuilderDoc
+	if err := c.q.GetBuilderDoc.Get(&out, campID, tplID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+
+		c.log.Printf("error fetching builder document: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{templates.builder.title}", "error", pqErrMsg(err)))
+	}
+
+	return &out, nil
+}
+
+// UpsertBuilderDoc creates or updates the visual builder document of a
+// campaign or a template.
+func (c *Core) UpsertBuilderDoc(campID, tplID int, doc []byte) (*models.BuilderDoc, error) {
+	var err error
+	if campID > 0 {
+		_, err = c.q.UpsertCampaignBuilderDoc.Exec(campID, doc)
+	} else {
+		_, err = c.q.UpsertTemplateBuilderDoc.Exec(tplID, doc)
+	}
+	if err != nil {
+		c.log.Printf("error saving builder document: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{templates.builder.title}", "error", pqErrMsg(err)))
+	}
+
+	return c.GetBuilderDoc(campID, tplID)
+}
+
+// DeleteBuilderDoc deletes the visual builder document of a campaign or a
+// template. The body that was rendered from it remains as it is.
+func (c *Core) DeleteBuilderDoc(campID, tplID int) error {
+	if _, err := c.q.DeleteBuilderDoc.Exec(campID, tplID); err != nil {
+		c.log.Printf("error deleting builder document: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{templates.builder.title}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
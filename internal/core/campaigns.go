@@ -3,6 +3,7 @@ package core
 import (
 	"database/sql"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gofrs/uuid/v5"
@@ -23,7 +24,8 @@ const (
 
 // QueryCampaigns retrieves paginated campaigns optionally filtering them by the given arbitrary
 // query expression. It also returns the total number of records in the DB.
-func (c *Core) QueryCampaigns(searchStr string, statuses, tags []string, orderBy, order string, offset, limit int) (models.Campaigns, int, error) {
+// tagMatch is 'any' to match campaigns that have any of the given tags instead of all of them.
+func (c *Core) QueryCampaigns(searchStr string, statuses, tags []string, tagMatch, orderBy, order string, offset, limit int) (models.Campaigns, int, error) {
 	queryStr, stmt := makeSearchQuery(searchStr, orderBy, order, c.q.QueryCampaigns, campQuerySortFields)
 
 	if statuses == nil {
@@ -36,7 +38,7 @@ func (c *Core) QueryCampaigns(searchStr string, statuses, tags []string, orderBy
 
 	// Unsafe to ignore scanning fields not present in models.Campaigns.
 	var out models.Campaigns
-	if err := c.db.Select(&out, stmt, 0, pq.StringArray(statuses), pq.StringArray(tags), queryStr, offset, limit); err != nil {
+	if err := c.db.Select(&out, stmt, 0, pq.StringArray(statuses), pq.StringArray(tags), queryStr, offset, limit, tagMatch); err != nil {
 		c.log.Printf("error fetching campaigns: %v", err)
 		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
 			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.campaign}", "error", pqErrMsg(err)))
@@ -189,6 +191,27 @@ func (c *Core) CreateCampaign(o models.Campaign, listIDs []int, mediaIDs []int)
 		o.ArchiveTemplateID,
 		o.ArchiveMeta,
 		pq.Array(mediaIDs),
+		o.SendAtLocal,
+		o.BodyAMP,
+		pq.StringArray(o.Failover),
+		o.ContentBlocks,
+		o.UTMParams,
+		o.TrackingDomain,
+		o.SendUntil,
+		o.SendWindow,
+		o.Priority,
+		o.ListIDHeader,
+		o.ArchiveAccess,
+		o.ArchivePassword,
+		o.FreezeRecipients,
+		o.LangVariants,
+		o.EngagementRules,
+		o.ExcludeListIDs,
+		o.Rollout,
+		o.Preheader,
+		o.SendAtTimezone,
+		o.SegmentIDs,
+		o.SubscriberTags,
 	); err != nil {
 		if err == sql.ErrNoRows {
 			return models.Campaign{}, echo.NewHTTPError(http.StatusBadRequest, c.i18n.T("campaigns.noSubs"))
@@ -227,13 +250,43 @@ func (c *Core) UpdateCampaign(id int, o models.Campaign, listIDs []int, mediaIDs
 		o.ArchiveSlug,
 		o.ArchiveTemplateID,
 		o.ArchiveMeta,
-		pq.Array(mediaIDs))
+		pq.Array(mediaIDs),
+		o.SendAtLocal,
+		o.BodyAMP,
+		pq.StringArray(o.Failover),
+		o.ContentBlocks,
+		o.UTMParams,
+		o.TrackingDomain,
+		o.SendUntil,
+		o.SendWindow,
+		o.Priority,
+		o.ListIDHeader,
+		o.ArchiveAccess,
+		o.ArchivePassword,
+		o.FreezeRecipients,
+		o.LangVariants,
+		o.EngagementRules,
+		o.ExcludeListIDs,
+		o.Rollout,
+		o.Preheader,
+		o.SendAtTimezone,
+		o.SegmentIDs,
+		o.SubscriberTags)
 	if err != nil {
 		c.log.Printf("error updating campaign: %v", err)
 		return models.Campaign{}, echo.NewHTTPError(http.StatusInternalServerError,
 			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.campaign}", "error", pqErrMsg(err)))
 	}
 
+	// The lists or the freeze option of a campaign that hasn't started may
+	// have changed. Freeze its recipients again if it's still scheduled.
+	if err := c.unfreezeCampaignRecipients(id); err != nil {
+		return models.Campaign{}, err
+	}
+	if err := c.freezeCampaignRecipients(id); err != nil {
+		return models.Campaign{}, err
+	}
+
 	out, err := c.GetCampaign(id, "", "")
 	if err != nil {
 		return models.Campaign{}, err
@@ -294,13 +347,215 @@ func (c *Core) UpdateCampaignStatus(id int, status string) (models.Campaign, err
 			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.campaign}", "error", pqErrMsg(err)))
 	}
 
+	// Snapshot the recipients when the campaign is scheduled or started, and
+	// discard them when it's unscheduled.
+	switch status {
+	case models.CampaignStatusDraft:
+		err = c.unfreezeCampaignRecipients(cm.ID)
+	case models.CampaignStatusScheduled, models.CampaignStatusRunning:
+		// Segments and dynamic lists are refreshed before the campaign's
+		// recipients are picked for the first time.
+		if cm.Status == models.CampaignStatusDraft && len(cm.SegmentIDs) > 0 {
+			if err := c.RefreshSegments(cm.SegmentIDs); err != nil {
+				return models.Campaign{}, err
+			}
+		}
+		if cm.Status == models.CampaignStatusDraft {
+			if err := c.RefreshDynamicLists(cm.ID); err != nil {
+				return models.Campaign{}, err
+			}
+		}
+		err = c.freezeCampaignRecipients(cm.ID)
+	}
+	if err != nil {
+		return models.Campaign{}, err
+	}
+
 	cm.Status = status
 	return cm, nil
 }
 
+// GetCampaignRecipients retrieves the frozen recipients of a campaign,
+// optionally filtered by an e-mail (ILIKE) pattern.
+func (c *Core) GetCampaignRecipients(campID int, email string, offset, limit int) ([]models.CampaignRecipient, int, error) {
+	out := []models.CampaignRecipient{}
+	if err := c.q.GetCampaignRecipients.Select(&out, campID, email, offset, limit); err != nil {
+		c.log.Printf("error fetching campaign recipients: %v", err)
+		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	total := 0
+	if len(out) > 0 {
+		total = out[0].Total
+	}
+
+	return out, total, nil
+}
+
+// StartCampaignSimulation records the start of a dry run of a campaign,
+// replacing its last one.
+func (c *Core) StartCampaignSimulation(id int) (models.CampaignSimulation, error) {
+	var out models.CampaignSimulation
+	if err := c.q.StartCampaignSimulation.Get(&out, id); err != nil {
+		c.log.Printf("error starting campaign simulation: %v", err)
+		return out, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{campaigns.simulation}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// UpdateCampaignSimulation updates the progress and the status of a campaign's dry run.
+func (c *Core) UpdateCampaignSimulation(s models.CampaignSimulation) error {
+	if _, err := c.q.UpdateCampaignSimulation.Exec(s.CampaignID, s.Status, s.Error,
+		s.Rendered, s.Errors, s.Domains, s.ErrorSamples); err != nil {
+		c.log.Printf("error updating campaign simulation: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{campaigns.simulation}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// GetCampaignSimulation retrieves the last dry run of a campaign.
+func (c *Core) GetCampaignSimulation(id int) (models.CampaignSimulation, error) {
+	var out models.CampaignSimulation
+	if err := c.q.GetCampaignSimulation.Get(&out, id); err != nil {
+		if err == sql.ErrNoRows {
+			return out, echo.NewHTTPError(http.StatusNotFound,
+				c.i18n.Ts("globals.messages.notFound", "name", "{campaigns.simulation}"))
+		}
+
+		c.log.Printf("error fetching campaign simulation: %v", err)
+		return out, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{campaigns.simulation}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// GetCampaignSimulationSubscribers retrieves the next batch of subscribers,
+// after the given subscriber ID, that a campaign would be sent to right now.
+func (c *Core) GetCampaignSimulationSubscribers(campID, afterID, limit int) (models.Subscribers, error) {
+	var out models.Subscribers
+	if err := c.q.GetSimulationSubscribers.Select(&out, campID, afterID, limit); err != nil {
+		c.log.Printf("error fetching campaign simulation subscribers: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	if err := out.LoadLists(c.q.GetSubscriberListsLazy); err != nil {
+		c.log.Printf("error loading subscriber lists: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.lists}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// RetryCampaignErrors re-queues the messages of a finished campaign that
+// errored with recoverable (connection and 4xx) errors and re-runs the
+// campaign to send them again. It returns the number of re-queued messages.
+func (c *Core) RetryCampaignErrors(id int) (int, error) {
+	cm, err := c.GetCampaign(id, "", "")
+	if err != nil {
+		return 0, err
+	}
+
+	if cm.Status != models.CampaignStatusFinished {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, c.i18n.T("campaigns.onlyFinishedRetry"))
+	}
+
+	res, err := c.q.RetryCampaignErrors.Exec(cm.ID, pq.StringArray{models.DeliveryErrorConnection, models.DeliveryError4xx})
+	if err != nil {
+		c.log.Printf("error retrying campaign errors: %v", err)
+		return 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.campaign}", "error", pqErrMsg(err)))
+	}
+
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, c.i18n.T("campaigns.noRetryableErrors"))
+	}
+
+	return int(n), nil
+}
+
+// QueryCampaignDeliveryLog returns the outcomes of a campaign's messages,
+// optionally filtered by statuses, a subscriber, or an e-mail pattern.
+func (c *Core) QueryCampaignDeliveryLog(campID int, statuses []string, subID int, email string, offset, limit int) ([]models.CampaignDeliveryLog, int, error) {
+	out := []models.CampaignDeliveryLog{}
+	if err := c.q.QueryCampaignDeliveryLog.Select(&out, campID, pq.StringArray(statuses), subID, email, offset, limit); err != nil {
+		c.log.Printf("error fetching campaign delivery log: %v", err)
+		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{campaigns.deliveryLog}", "error", pqErrMsg(err)))
+	}
+
+	total := 0
+	if len(out) > 0 {
+		total = out[0].Total
+	}
+
+	return out, total, nil
+}
+
+// GetCampaignAudience returns the number of subscribers that a campaign would
+// be sent to right now and a random sample of them. If listIDs are given,
+// they're used instead of the campaign's lists, and excludeListIDs,
+// segmentIDs, and tags instead of its excluded lists, segments, and tags.
+func (c *Core) GetCampaignAudience(campID int, listIDs, excludeListIDs, segmentIDs []int, tags []string, sample int) (models.Subscribers, int, error) {
+	if tags == nil {
+		tags = []string{}
+	}
+
+	var res []struct {
+		models.Subscriber
+		Total int `db:"total"`
+	}
+	if err := c.q.GetCampaignAudience.Select(&res, campID, pq.Array(listIDs), sample, pq.Array(excludeListIDs), pq.Array(segmentIDs), pq.StringArray(tags)); err != nil {
+		c.log.Printf("error fetching campaign audience: %v", err)
+		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	out := make(models.Subscribers, 0, len(res))
+	total := 0
+	for _, r := range res {
+		out = append(out, r.Subscriber)
+		total = r.Total
+	}
+
+	return out, total, nil
+}
+
+// freezeCampaignRecipients snapshots the recipients of a scheduled or running
+// campaign that has freeze_recipients on, unless they're already frozen.
+func (c *Core) freezeCampaignRecipients(id int) error {
+	if _, err := c.q.FreezeCampaignRecipients.Exec(id); err != nil {
+		c.log.Printf("error freezing campaign recipients: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.campaign}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// unfreezeCampaignRecipients discards the frozen recipients of a campaign
+// that hasn't started.
+func (c *Core) unfreezeCampaignRecipients(id int) error {
+	if _, err := c.q.UnfreezeCampaignRecipients.Exec(id); err != nil {
+		c.log.Printf("error unfreezing campaign recipients: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.campaign}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
 // UpdateCampaignArchive updates a campaign's archive properties.
-func (c *Core) UpdateCampaignArchive(id int, enabled bool, tplID int, meta models.JSON, archiveSlug string) error {
-	if _, err := c.q.UpdateCampaignArchive.Exec(id, enabled, archiveSlug, tplID, meta); err != nil {
+func (c *Core) UpdateCampaignArchive(id int, enabled bool, tplID int, meta models.JSON, archiveSlug, access, passwordHash string) error {
+	if _, err := c.q.UpdateCampaignArchive.Exec(id, enabled, archiveSlug, tplID, meta, access, passwordHash); err != nil {
 		c.log.Printf("error updating campaign: %v", err)
 
 		return echo.NewHTTPError(http.StatusInternalServerError,
@@ -310,6 +565,19 @@ func (c *Core) UpdateCampaignArchive(id int, enabled bool, tplID int, meta model
 	return nil
 }
 
+// IsCampaignSubscriber checks if the subscriber with the given UUID is
+// subscribed to any of the lists of a campaign.
+func (c *Core) IsCampaignSubscriber(campID int, subUUID string) (bool, error) {
+	var ok bool
+	if err := c.q.IsCampaignSubscriber.Get(&ok, campID, subUUID); err != nil {
+		c.log.Printf("error checking campaign subscriber: %v", err)
+		return false, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.subscriber}", "error", pqErrMsg(err)))
+	}
+
+	return ok, nil
+}
+
 // DeleteCampaign deletes a campaign.
 func (c *Core) DeleteCampaign(id int) error {
 	res, err := c.q.DeleteCampaign.Exec(id)
@@ -328,6 +596,36 @@ func (c *Core) DeleteCampaign(id int) error {
 	return nil
 }
 
+// GetCampaignLinkClicks returns the clicks on a campaign's links by their
+// positions in the body.
+func (c *Core) GetCampaignLinkClicks(id int) ([]models.CampaignLinkClicks, error) {
+	out := []models.CampaignLinkClicks{}
+	if err := c.q.GetCampaignLinkClicks.Select(&out, id); err != nil {
+		c.log.Printf("error fetching campaign link clicks: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.campaign}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// GetCampaignProgress returns the progress stats of a campaign.
+func (c *Core) GetCampaignProgress(id int) (models.CampaignStats, error) {
+	var out models.CampaignStats
+	if err := c.q.GetCampaignProgress.Get(&out, id); err != nil {
+		if err == sql.ErrNoRows {
+			return out, echo.NewHTTPError(http.StatusBadRequest,
+				c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.campaign}"))
+		}
+
+		c.log.Printf("error fetching campaign stats: %v", err)
+		return out, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.campaign}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
 // GetRunningCampaignStats returns the progress stats of running campaigns.
 func (c *Core) GetRunningCampaignStats() ([]models.CampaignStats, error) {
 	out := []models.CampaignStats{}
@@ -346,6 +644,171 @@ func (c *Core) GetRunningCampaignStats() ([]models.CampaignStats, error) {
 	return out, nil
 }
 
+// GetCampaignCosts returns the estimated costs of campaigns started between the given dates.
+func (c *Core) GetCampaignCosts(fromDate, toDate string) ([]models.CampaignCost, error) {
+	if !strHasLen(fromDate, 10, 30) || !strHasLen(toDate, 10, 30) {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, c.i18n.T("analytics.invalidDates"))
+	}
+
+	out := []models.CampaignCost{}
+	if err := c.q.GetCampaignCosts.Select(&out, fromDate, toDate); err != nil {
+		c.log.Printf("error fetching campaign costs: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.campaigns}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// GetCampaignDeliveries returns the counts of a campaign's messages by the
+// messenger they were delivered through, optionally for a single subscriber.
+func (c *Core) GetCampaignDeliveries(campID, subID int) ([]models.CampaignDelivery, error) {
+	out := []models.CampaignDelivery{}
+	if err := c.q.GetCampaignDeliveries.Select(&out, campID, subID); err != nil {
+		c.log.Printf("error fetching campaign deliveries: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.campaign}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// GetCampaignVersions returns the previous and current versions of a campaign's
+// content with the number of messages sent with each, optionally to a single
+// subscriber.
+func (c *Core) GetCampaignVersions(campID, subID int) ([]models.CampaignVersion, error) {
+	out := []models.CampaignVersion{}
+	if err := c.q.GetCampaignVersions.Select(&out, campID, subID); err != nil {
+		c.log.Printf("error fetching campaign versions: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.campaign}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// GetCampaignRevisions returns the content revisions of a campaign, latest first.
+func (c *Core) GetCampaignRevisions(campID int) ([]models.CampaignRevision, error) {
+	out := []models.CampaignRevision{}
+	if err := c.q.GetCampaignRevisions.Select(&out, campID); err != nil {
+		c.log.Printf("error fetching campaign revisions: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.campaign}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// GetCampaignRevision returns a content revision of a campaign, or if prev is
+// true, the one before it, in which case, a nil revision is returned if there's
+// none.
+func (c *Core) GetCampaignRevision(campID int, id int64, prev bool) (*models.CampaignRevision, error) {
+	var out models.CampaignRevision
+	if err := c.q.GetCampaignRevision.Get(&out, campID, id, prev); err != nil {
+		if err == sql.ErrNoRows {
+			if prev {
+				return nil, nil
+			}
+			return nil, echo.NewHTTPError(http.StatusBadRequest,
+				c.i18n.Ts("globals.messages.notFound", "name", "{campaigns.revision}"))
+		}
+
+		c.log.Printf("error fetching campaign revision: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{campaigns.revision}", "error", pqErrMsg(err)))
+	}
+
+	return &out, nil
+}
+
+// CreateCampaignTest records a test batch of a campaign.
+func (c *Core) CreateCampaignTest(campID, contentVersion int, subject string, variants []string, recipients int) (models.CampaignTest, error) {
+	var out models.CampaignTest
+	if err := c.q.InsertCampaignTest.Get(&out, campID, contentVersion, subject, pq.StringArray(variants), recipients); err != nil {
+		c.log.Printf("error recording campaign test: %v", err)
+		return out, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.campaign}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// GetCampaignTests returns the test batches of a campaign, latest first.
+func (c *Core) GetCampaignTests(campID int) ([]models.CampaignTest, error) {
+	out := []models.CampaignTest{}
+	if err := c.q.GetCampaignTests.Select(&out, campID); err != nil {
+		c.log.Printf("error fetching campaign tests: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.campaign}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// GetCampaignTags returns the tags of all campaigns and their aggregate stats.
+func (c *Core) GetCampaignTags() ([]models.CampaignTag, error) {
+	out := []models.CampaignTag{}
+	if err := c.q.GetCampaignTags.Select(&out); err != nil {
+		c.log.Printf("error fetching campaign tags: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.tags}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// AddCampaignTag adds a tag to the given campaigns and returns the number of
+// campaigns that were tagged.
+func (c *Core) AddCampaignTag(tag string, campIDs []int) (int, error) {
+	res, err := c.q.AddCampaignTag.Exec(pq.Array(campIDs), tag)
+	if err != nil {
+		c.log.Printf("error adding campaign tag: %v", err)
+		return 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.tags}", "error", pqErrMsg(err)))
+	}
+
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+// RenameCampaignTag renames a tag on all campaigns and returns the number of
+// campaigns that were updated.
+func (c *Core) RenameCampaignTag(tag, name string) (int, error) {
+	res, err := c.q.RenameCampaignTag.Exec(tag, name)
+	if err != nil {
+		c.log.Printf("error renaming campaign tag: %v", err)
+		return 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.tags}", "error", pqErrMsg(err)))
+	}
+
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return 0, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", tag))
+	}
+
+	return int(n), nil
+}
+
+// DeleteCampaignTag removes a tag from all campaigns and returns the number of
+// campaigns that were updated.
+func (c *Core) DeleteCampaignTag(tag string) (int, error) {
+	res, err := c.q.DeleteCampaignTag.Exec(tag)
+	if err != nil {
+		c.log.Printf("error deleting campaign tag: %v", err)
+		return 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.tags}", "error", pqErrMsg(err)))
+	}
+
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return 0, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", tag))
+	}
+
+	return int(n), nil
+}
+
 func (c *Core) GetCampaignAnalyticsCounts(campIDs []int, typ, fromDate, toDate string) ([]models.CampaignAnalyticsCount, error) {
 	// Pick campaign view counts or click counts.
 	var stmt *sqlx.Stmt
@@ -401,9 +864,10 @@ func (c *Core) RegisterCampaignView(campUUID, subUUID string) error {
 }
 
 // RegisterCampaignLinkClick registers a subscriber's link click on a campaign.
-func (c *Core) RegisterCampaignLinkClick(linkUUID, campUUID, subUUID string) (string, error) {
+// pos is the position of the link in the campaign's body, or 0 if it's unknown.
+func (c *Core) RegisterCampaignLinkClick(linkUUID, campUUID, subUUID string, pos int) (string, error) {
 	var url string
-	if err := c.q.RegisterLinkClick.Get(&url, linkUUID, campUUID, subUUID); err != nil {
+	if err := c.q.RegisterLinkClick.Get(&url, linkUUID, campUUID, subUUID, pos); err != nil {
 		if pqErr, ok := err.(*pq.Error); ok && pqErr.Column == "link_id" {
 			return "", echo.NewHTTPError(http.StatusBadRequest, c.i18n.Ts("public.invalidLink"))
 		}
@@ -415,6 +879,65 @@ func (c *Core) RegisterCampaignLinkClick(linkUUID, campUUID, subUUID string) (st
 	return url, nil
 }
 
+// ApplyEngagementRules applies the actions of a campaign's engagement rules
+// that match a subscriber's view (event=view) or link click (event=click with
+// the link's URL) to the subscriber.
+func (c *Core) ApplyEngagementRules(campUUID, subUUID, event, url string) error {
+	var res []struct {
+		Rules        models.EngagementRules `db:"engagement_rules"`
+		SubscriberID int                    `db:"subscriber_id"`
+	}
+	if err := c.q.GetCampaignEngagementRules.Select(&res, campUUID, subUUID); err != nil {
+		c.log.Printf("error fetching campaign engagement rules: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.campaign}", "error", pqErrMsg(err)))
+	}
+	if len(res) == 0 {
+		return nil
+	}
+
+	subID := res[0].SubscriberID
+	for _, r := range res[0].Rules {
+		if r.Event != event || (event == models.EngagementEventClick && !strings.Contains(url, r.URL)) {
+			continue
+		}
+
+		var err error
+		switch r.Action {
+		case models.EngagementActionAddList:
+			err = c.AddSubscriptions([]int{subID}, []int{r.ListID}, "")
+		case models.EngagementActionUnsubList:
+			err = c.UnsubscribeLists([]int{subID}, []int{r.ListID}, nil)
+		case models.EngagementActionSetAttrib:
+			if _, err = c.q.SetSubscriberAttrib.Exec(subID, r.Attrib, r.Value); err != nil {
+				c.log.Printf("error setting subscriber attribute: %v", err)
+				err = echo.NewHTTPError(http.StatusInternalServerError,
+					c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscriber}", "error", pqErrMsg(err)))
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetLinkURL returns the URL of a tracked link without registering a click.
+func (c *Core) GetLinkURL(linkUUID string) (string, error) {
+	var url string
+	if err := c.q.GetLinkURL.Get(&url, linkUUID); err != nil {
+		if err == sql.ErrNoRows {
+			return "", echo.NewHTTPError(http.StatusBadRequest, c.i18n.Ts("public.invalidLink"))
+		}
+
+		c.log.Printf("error fetching link: %s", err)
+		return "", echo.NewHTTPError(http.StatusInternalServerError, c.i18n.Ts("public.errorProcessingRequest"))
+	}
+
+	return url, nil
+}
+
 // DeleteCampaignViews deletes campaign views older than a given date.
 func (c *Core) DeleteCampaignViews(before time.Time) error {
 	if _, err := c.q.DeleteCampaignViews.Exec(before); err != nil {
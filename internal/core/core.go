@@ -26,6 +26,16 @@ const (
 	matListSubStats    = "mat_list_subscriber_stats"
 )
 
+// Subscriber lifecycle events that are fired with the SubscriberEvent hook.
+const (
+	EventSubscriberCreated      = "subscriber.created"
+	EventSubscriberUpdated      = "subscriber.updated"
+	EventSubscriberConfirmed    = "subscriber.confirmed"
+	EventSubscriberUnsubscribed = "subscriber.unsubscribed"
+	EventSubscriberBlocklisted  = "subscriber.blocklisted"
+	EventSubscriberBounced      = "subscriber.bounced"
+)
+
 // Core represents the listmonk core with all shared, global functions.
 type Core struct {
 	h *Hooks
@@ -45,11 +55,22 @@ type Constants struct {
 		Action string
 	}
 	CacheSlowQueries bool
+
+	// Automations that are run on changes to subscriber attributes.
+	AttribTriggers []models.AttribTrigger
 }
 
 // Hooks contains external function hooks that are required by the core package.
 type Hooks struct {
 	SendOptinConfirmation func(models.Subscriber, []int) (int, error)
+
+	// SubscriberEvent is called with a subscriber lifecycle event (EventSubscriber*),
+	// the subscriber's ID, UUID, or e-mail, whichever is known, and the reason
+	// for the event, if any. It shouldn't block.
+	SubscriberEvent func(event string, subID int, subUUID, email, reason string)
+
+	// SendTemplate sends a transactional template to a subscriber.
+	SendTemplate func(sub models.Subscriber, tplID int) error
 }
 
 // Opt contains the controllers required to start the core.
@@ -81,6 +102,14 @@ func New(o *Opt, h *Hooks) *Core {
 	}
 }
 
+// fireSubscriberEvent passes a subscriber lifecycle event to the hook, if there's one.
+func (c *Core) fireSubscriberEvent(event string, subID int, subUUID, email, reason string) {
+	if c.h == nil || c.h.SubscriberEvent == nil {
+		return
+	}
+	c.h.SubscriberEvent(event, subID, subUUID, email, reason)
+}
+
 // RefreshMatViews refreshes all materialized views.
 func (c *Core) RefreshMatViews(concurrent bool) error {
 	for _, v := range []string{matDashboardCharts, matDashboardCounts, matListSubStats} {
@@ -0,0 +1,138 @@
+package core
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// GetCRMSyncs retrieves all CRM syncs, or only the enabled ones.
+func (c *Core) GetCRMSyncs(enabledOnly bool) ([]models.CRMSync, error) {
+	out := []models.CRMSync{}
+	if err := c.q.GetCRMSyncs.Select(&out, 0, enabledOnly); err != nil {
+		c.log.Printf("error fetching crm syncs: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.crmSyncs}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// GetCRMSync retrieves a given CRM sync.
+func (c *Core) GetCRMSync(id int) (models.CRMSync, error) {
+	var out []models.CRMSync
+	if err := c.q.GetCRMSyncs.Select(&out, id, false); err != nil {
+		c.log.Printf("error fetching crm sync: %v", err)
+		return models.CRMSync{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.crmSync}", "error", pqErrMsg(err)))
+	}
+
+	if len(out) == 0 {
+		return models.CRMSync{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.crmSync}"))
+	}
+
+	return out[0], nil
+}
+
+// CreateCRMSync creates a new CRM sync.
+func (c *Core) CreateCRMSync(o models.CRMSync) (models.CRMSync, error) {
+	uu, err := uuid.NewV4()
+	if err != nil {
+		c.log.Printf("error generating UUID: %v", err)
+		return models.CRMSync{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUUID", "error", err.Error()))
+	}
+
+	var newID int
+	if err := c.q.CreateCRMSync.Get(&newID, uu, o.Name, o.Provider, o.Segment, o.APIKey, o.ListID, o.Mapping,
+		o.Conflict, o.Pull, o.PushUnsubscribes, o.PushBounces, o.Enabled, o.SyncInterval); err != nil {
+		c.log.Printf("error creating crm sync: %v", err)
+		return models.CRMSync{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.crmSync}", "error", pqErrMsg(err)))
+	}
+
+	return c.GetCRMSync(newID)
+}
+
+// UpdateCRMSync updates a given CRM sync. An empty API key retains the existing one.
+func (c *Core) UpdateCRMSync(id int, o models.CRMSync) (models.CRMSync, error) {
+	res, err := c.q.UpdateCRMSync.Exec(id, o.Name, o.Provider, o.Segment, o.APIKey, o.ListID, o.Mapping,
+		o.Conflict, o.Pull, o.PushUnsubscribes, o.PushBounces, o.Enabled, o.SyncInterval)
+	if err != nil {
+		c.log.Printf("error updating crm sync: %v", err)
+		return models.CRMSync{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.crmSync}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return models.CRMSync{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.crmSync}"))
+	}
+
+	return c.GetCRMSync(id)
+}
+
+// UpdateCRMSyncRan records a run of a CRM sync that started at the given
+// time with the numbers of contacts pulled and changes pushed, and the error,
+// if any, with which it failed. If it succeeded, the changes up to the start
+// of the run are recorded as pushed.
+func (c *Core) UpdateCRMSyncRan(id int, ranAt time.Time, lastErr string, pulled, pushed int) error {
+	if _, err := c.q.UpdateCRMSyncRan.Exec(id, ranAt, lastErr, pulled, pushed); err != nil {
+		c.log.Printf("error updating crm sync: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.crmSync}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// DeleteCRMSync deletes a given CRM sync.
+func (c *Core) DeleteCRMSync(id int) error {
+	if _, err := c.q.DeleteCRMSync.Exec(id); err != nil {
+		c.log.Printf("error deleting crm sync: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.crmSync}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// GetCRMSyncChanges retrieves the unsubscriptions from a list and the bounces
+// of its subscribers, as chosen, in the given period that are to be pushed to a CRM.
+func (c *Core) GetCRMSyncChanges(listID int, from, to time.Time, unsubs, bounces bool) ([]models.CRMSyncChange, error) {
+	out := []models.CRMSyncChange{}
+	if err := c.q.GetCRMSyncChanges.Select(&out, listID, from, to, unsubs, bounces); err != nil {
+		c.log.Printf("error fetching crm sync changes: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// UpsertCRMContact upserts a contact pulled from a CRM as a subscriber and
+// subscribes them to a list. If crmWins is true, existing subscribers get
+// their attributes (and name, if hasName) overwritten with the contact's.
+// It returns whether the contact was newly subscribed to the list.
+func (c *Core) UpsertCRMContact(listID int, s models.Subscriber, crmWins, hasName bool) (bool, error) {
+	uu, err := uuid.NewV4()
+	if err != nil {
+		c.log.Printf("error generating UUID: %v", err)
+		return false, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUUID", "error", err.Error()))
+	}
+
+	res, err := c.q.UpsertCRMContact.Exec(uu, s.Email, s.Name, s.Attribs, listID, crmWins, hasName)
+	if err != nil {
+		c.log.Printf("error upserting crm contact: %v", err)
+		return false, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscriber}", "error", pqErrMsg(err)))
+	}
+
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
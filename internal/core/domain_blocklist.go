@@ -0,0 +1,122 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+// GetDomainBlocklist returns the domain blocklist entries from the settings
+// with the number of e-mails that they have blocked.
+func (c *Core) GetDomainBlocklist() ([]models.BlocklistedDomain, error) {
+	set, err := c.GetSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	var hits []models.BlocklistedDomain
+	if err := c.q.GetDomainBlocklistHits.Select(&hits, pq.StringArray(set.DomainBlocklist)); err != nil {
+		c.log.Printf("error fetching domain blocklist hits: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{settings.privacy.domainBlocklist}", "error", pqErrMsg(err)))
+	}
+
+	byDomain := make(map[string]models.BlocklistedDomain, len(hits))
+	for _, h := range hits {
+		byDomain[h.Domain] = h
+	}
+
+	out := make([]models.BlocklistedDomain, 0, len(set.DomainBlocklist))
+	for _, d := range set.DomainBlocklist {
+		h := byDomain[d]
+		h.Domain = d
+		out = append(out, h)
+	}
+
+	return out, nil
+}
+
+// UpdateDomainBlocklist replaces the domain blocklist in the settings. The hit
+// counters of the domains that are no longer in it are cleared.
+func (c *Core) UpdateDomainBlocklist(domains []string) error {
+	cur, err := c.GetSettings()
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(map[string][]string{"privacy.domain_blocklist": domains})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("settings.errorEncoding", "error", err.Error()))
+	}
+
+	if _, err := c.q.UpdateSettings.Exec(b); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{settings.privacy.domainBlocklist}", "error", pqErrMsg(err)))
+	}
+
+	keep := make(map[string]bool, len(domains))
+	for _, d := range domains {
+		keep[d] = true
+	}
+	var removed []string
+	for _, d := range cur.DomainBlocklist {
+		if !keep[d] {
+			removed = append(removed, d)
+		}
+	}
+	if len(removed) > 0 {
+		if _, err := c.q.ClearDomainBlocklistHits.Exec(pq.StringArray(removed)); err != nil {
+			c.log.Printf("error clearing domain blocklist hits: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// AddDomainBlocklistHits adds to the number of e-mails blocked by domain
+// blocklist entries.
+func (c *Core) AddDomainBlocklistHits(hits map[string]int) error {
+	var (
+		domains = make([]string, 0, len(hits))
+		counts  = make([]int64, 0, len(hits))
+	)
+	for d, n := range hits {
+		domains = append(domains, d)
+		counts = append(counts, int64(n))
+	}
+
+	if _, err := c.q.AddDomainBlocklistHits.Exec(pq.StringArray(domains), pq.Int64Array(counts)); err != nil {
+		c.log.Printf("error recording domain blocklist hits: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{settings.privacy.domainBlocklist}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// GetDisposableDomains returns the disposable e-mail domains.
+func (c *Core) GetDisposableDomains() ([]string, error) {
+	out := []string{}
+	if err := c.q.GetDisposableDomains.Select(&out); err != nil {
+		c.log.Printf("error fetching disposable domains: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{settings.privacy.disposableDomains}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// ReplaceDisposableDomains replaces the disposable e-mail domains.
+func (c *Core) ReplaceDisposableDomains(domains []string) error {
+	if _, err := c.q.ReplaceDisposableDomains.Exec(pq.StringArray(domains)); err != nil {
+		c.log.Printf("error updating disposable domains: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{settings.privacy.disposableDomains}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
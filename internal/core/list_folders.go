@@ -0,0 +1,78 @@
+package core
+
+import (
+	"net/http"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// GetListFolders retrieves all list folders.
+func (c *Core) GetListFolders() ([]models.ListFolder, error) {
+	out := []models.ListFolder{}
+	if err := c.q.GetListFolders.Select(&out, 0); err != nil {
+		c.log.Printf("error fetching list folders: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{lists.folders}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// GetListFolder retrieves a given list folder.
+func (c *Core) GetListFolder(id int) (models.ListFolder, error) {
+	var out []models.ListFolder
+	if err := c.q.GetListFolders.Select(&out, id); err != nil {
+		c.log.Printf("error fetching list folder: %v", err)
+		return models.ListFolder{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{lists.folder}", "error", pqErrMsg(err)))
+	}
+
+	if len(out) == 0 {
+		return models.ListFolder{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{lists.folder}"))
+	}
+
+	return out[0], nil
+}
+
+// CreateListFolder creates a new list folder.
+func (c *Core) CreateListFolder(f models.ListFolder) (models.ListFolder, error) {
+	var newID int
+	if err := c.q.CreateListFolder.Get(&newID, f.Name, f.ParentID); err != nil {
+		c.log.Printf("error creating list folder: %v", err)
+		return models.ListFolder{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{lists.folder}", "error", pqErrMsg(err)))
+	}
+
+	return c.GetListFolder(newID)
+}
+
+// UpdateListFolder renames a given list folder or moves it to another parent
+// folder, which can't be the folder itself or one of its subfolders.
+func (c *Core) UpdateListFolder(id int, f models.ListFolder) (models.ListFolder, error) {
+	res, err := c.q.UpdateListFolder.Exec(id, f.Name, f.ParentID)
+	if err != nil {
+		c.log.Printf("error updating list folder: %v", err)
+		return models.ListFolder{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{lists.folder}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return models.ListFolder{}, echo.NewHTTPError(http.StatusBadRequest, c.i18n.T("lists.invalidFolderParent"))
+	}
+
+	return c.GetListFolder(id)
+}
+
+// DeleteListFolder deletes a list folder. Its lists and subfolders are moved
+// to its parent folder.
+func (c *Core) DeleteListFolder(id int) error {
+	if _, err := c.q.DeleteListFolder.Exec(id); err != nil {
+		c.log.Printf("error deleting list folder: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{lists.folder}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package core
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+// GetListWebhooks retrieves the webhooks of the given lists, optionally only
+// the enabled ones.
+func (c *Core) GetListWebhooks(listIDs []int, enabledOnly bool) ([]models.ListWebhook, error) {
+	out := []models.ListWebhook{}
+	if err := c.q.GetListWebhooks.Select(&out, pq.Array(listIDs), enabledOnly); err != nil {
+		c.log.Printf("error fetching list webhooks: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{lists.webhooks}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// CreateListWebhook creates a webhook on a list.
+func (c *Core) CreateListWebhook(h models.ListWebhook) (models.ListWebhook, error) {
+	var out models.ListWebhook
+	if err := c.q.CreateListWebhook.Get(&out, h.ListID, h.URL, h.Events, h.Secret, h.Enabled); err != nil {
+		if err == sql.ErrNoRows {
+			return out, echo.NewHTTPError(http.StatusBadRequest,
+				c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.list}"))
+		}
+
+		c.log.Printf("error creating list webhook: %v", err)
+		return out, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{lists.webhook}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// UpdateListWebhook updates a list's webhook. An empty secret retains the existing one.
+func (c *Core) UpdateListWebhook(h models.ListWebhook) (models.ListWebhook, error) {
+	var out models.ListWebhook
+	if err := c.q.UpdateListWebhook.Get(&out, h.ListID, h.ID, h.URL, h.Events, h.Secret, h.Enabled); err != nil {
+		if err == sql.ErrNoRows {
+			return out, echo.NewHTTPError(http.StatusBadRequest,
+				c.i18n.Ts("globals.messages.notFound", "name", "{lists.webhook}"))
+		}
+
+		c.log.Printf("error updating list webhook: %v", err)
+		return out, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{lists.webhook}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// DeleteListWebhook deletes a list's webhook.
+func (c *Core) DeleteListWebhook(listID, id int) error {
+	if _, err := c.q.DeleteListWebhook.Exec(listID, id); err != nil {
+		c.log.Printf("error deleting list webhook: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{lists.webhook}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// NextListEvents removes and returns the oldest n list subscription events
+// that are yet to be dispatched to the lists' webhooks.
+func (c *Core) NextListEvents(n int) ([]models.ListEvent, error) {
+	out := []models.ListEvent{}
+	if err := c.q.NextListEvents.Select(&out, n); err != nil {
+		c.log.Printf("error fetching list events: %v", err)
+		return nil, err
+	}
+
+	return out, nil
+}
@@ -1,7 +1,9 @@
 package core
 
 import (
+	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/gofrs/uuid/v5"
 	"github.com/knadh/listmonk/models"
@@ -9,7 +11,7 @@ import (
 	"github.com/lib/pq"
 )
 
-// GetLists gets all lists optionally filtered by type.
+// GetLists gets all lists that aren't archived, optionally filtered by type.
 func (c *Core) GetLists(typ string) ([]models.List, error) {
 	out := []models.List{}
 
@@ -35,8 +37,9 @@ func (c *Core) GetLists(typ string) ([]models.List, error) {
 }
 
 // QueryLists gets multiple lists based on multiple query params. Along with the  paginated and sliced
-// results, the total number of lists in the DB is returned.
-func (c *Core) QueryLists(searchStr, typ, optin string, tags []string, orderBy, order string, offset, limit int) ([]models.List, int, error) {
+// results, the total number of lists in the DB is returned. folderID filters the lists in a folder,
+// and optionally its subfolders, where 0 is lists that aren't in any folder and -1 is all lists.
+func (c *Core) QueryLists(searchStr, typ, optin string, tags []string, folderID int, subfolders bool, orderBy, order string, offset, limit int) ([]models.List, int, error) {
 	_ = c.refreshCache(matListSubStats, false)
 
 	if tags == nil {
@@ -47,7 +50,7 @@ func (c *Core) QueryLists(searchStr, typ, optin string, tags []string, orderBy,
 		out            = []models.List{}
 		queryStr, stmt = makeSearchQuery(searchStr, orderBy, order, c.q.QueryLists, listQuerySortFields)
 	)
-	if err := c.db.Select(&out, stmt, 0, "", queryStr, typ, optin, pq.StringArray(tags), offset, limit); err != nil {
+	if err := c.db.Select(&out, stmt, 0, "", queryStr, typ, optin, pq.StringArray(tags), offset, limit, folderID, subfolders); err != nil {
 		c.log.Printf("error fetching lists: %v", err)
 		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
 			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.lists}", "error", pqErrMsg(err)))
@@ -82,7 +85,7 @@ func (c *Core) GetList(id int, uuid string) (models.List, error) {
 
 	var res []models.List
 	queryStr, stmt := makeSearchQuery("", "", "", c.q.QueryLists, nil)
-	if err := c.db.Select(&res, stmt, id, uu, queryStr, "", "", pq.StringArray{}, 0, 1); err != nil {
+	if err := c.db.Select(&res, stmt, id, uu, queryStr, "", "", pq.StringArray{}, 0, 1, -1, false); err != nil {
 		c.log.Printf("error fetching lists: %v", err)
 		return models.List{}, echo.NewHTTPError(http.StatusInternalServerError,
 			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.lists}", "error", pqErrMsg(err)))
@@ -133,21 +136,44 @@ func (c *Core) CreateList(l models.List) (models.List, error) {
 		l.Optin = models.ListOptinSingle
 	}
 
+	if err := c.validateListQuery(&l); err != nil {
+		return models.List{}, err
+	}
+
 	// Insert and read ID.
 	var newID int
 	l.UUID = uu.String()
-	if err := c.q.CreateList.Get(&newID, l.UUID, l.Name, l.Type, l.Optin, pq.StringArray(normalizeTags(l.Tags)), l.Description); err != nil {
+	if err := c.q.CreateList.Get(&newID, l.UUID, l.Name, l.Type, l.Optin, pq.StringArray(normalizeTags(l.Tags)), l.Description, l.TrackingDomain,
+		l.OptinTemplateID, l.OptinSubject, l.OptinFromEmail, l.OptinRedirectURL, l.FrequencyCapDaily, l.FrequencyCapWeekly,
+		l.SubscriptionTTL, l.RepermissionGrace, l.FolderID, l.DefaultFromEmail, l.DefaultReplyTo, l.DefaultTemplateID, l.DefaultMessenger,
+		l.OptinReminderDays, l.OptinReminderMax, l.Query, l.ExcludeListIDs); err != nil {
 		c.log.Printf("error creating list: %v", err)
 		return models.List{}, echo.NewHTTPError(http.StatusInternalServerError,
 			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.list}", "error", pqErrMsg(err)))
 	}
 
-	return c.GetList(newID, "")
+	return c.refreshNewDynamicList(newID)
 }
 
-// UpdateList updates a given list.
+// UpdateList updates a given list. A dynamic list whose query has changed is
+// refreshed.
 func (c *Core) UpdateList(id int, l models.List) (models.List, error) {
-	res, err := c.q.UpdateList.Exec(id, l.Name, l.Type, l.Optin, pq.StringArray(normalizeTags(l.Tags)), l.Description)
+	// The type isn't changed if it's not given.
+	if l.Type == "" {
+		cur, err := c.GetList(id, "")
+		if err != nil {
+			return models.List{}, err
+		}
+		l.Type = cur.Type
+	}
+	if err := c.validateListQuery(&l); err != nil {
+		return models.List{}, err
+	}
+
+	res, err := c.q.UpdateList.Exec(id, l.Name, l.Type, l.Optin, pq.StringArray(normalizeTags(l.Tags)), l.Description, l.TrackingDomain,
+		l.OptinTemplateID, l.OptinSubject, l.OptinFromEmail, l.OptinRedirectURL, l.FrequencyCapDaily, l.FrequencyCapWeekly,
+		l.SubscriptionTTL, l.RepermissionGrace, l.FolderID, l.DefaultFromEmail, l.DefaultReplyTo, l.DefaultTemplateID, l.DefaultMessenger,
+		l.OptinReminderDays, l.OptinReminderMax, l.Query, l.ExcludeListIDs)
 	if err != nil {
 		c.log.Printf("error updating list: %v", err)
 		return models.List{}, echo.NewHTTPError(http.StatusInternalServerError,
@@ -159,9 +185,172 @@ func (c *Core) UpdateList(id int, l models.List) (models.List, error) {
 			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.list}"))
 	}
 
+	return c.refreshNewDynamicList(id)
+}
+
+// GetDynamicLists returns the dynamic lists that aren't archived, or those of
+// the given campaign if campID is set.
+func (c *Core) GetDynamicLists(campID int) ([]models.List, error) {
+	out := []models.List{}
+	if err := c.q.GetDynamicLists.Select(&out, campID); err != nil {
+		c.log.Printf("error fetching dynamic lists: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.lists}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// RefreshDynamicList materializes the subscribers that match a dynamic list's
+// query as its subscriptions.
+func (c *Core) RefreshDynamicList(l models.List) error {
+	exp := "subscribers.status = 'enabled' AND (" + sanitizeSQLExp(l.Query) + ")"
+	if err := c.q.ExecSubQueryTpl(exp, c.q.RefreshDynamicList, nil, c.db, l.ID); err != nil {
+		c.log.Printf("error refreshing dynamic list (%s): %v", l.Name, err)
+		return echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("subscribers.errorPreparingQuery", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// RefreshDynamicLists refreshes the dynamic lists, or those of the given
+// campaign if campID is set.
+func (c *Core) RefreshDynamicLists(campID int) error {
+	lists, err := c.GetDynamicLists(campID)
+	if err != nil {
+		return err
+	}
+
+	for _, l := range lists {
+		if err := c.RefreshDynamicList(l); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateListQuery validates the query of a dynamic list and clears the
+// query of other lists.
+func (c *Core) validateListQuery(l *models.List) error {
+	if l.Type != models.ListTypeDynamic {
+		l.Query = ""
+		return nil
+	}
+
+	l.Query = sanitizeSQLExp(l.Query)
+	if l.Query == "" {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.invalidFields", "name", "query"))
+	}
+	if err := ValidateSQLExp(l.Query); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("subscribers.errorPreparingQuery", "error", err.Error()))
+	}
+
+	return nil
+}
+
+// refreshNewDynamicList returns a given list after refreshing it if it's a
+// dynamic list that hasn't been refreshed since its query was set.
+func (c *Core) refreshNewDynamicList(id int) (models.List, error) {
+	out, err := c.GetList(id, "")
+	if err != nil {
+		return models.List{}, err
+	}
+	if out.Type != models.ListTypeDynamic || out.RefreshedAt.Valid || out.Archived {
+		return out, nil
+	}
+
+	if err := c.RefreshDynamicList(out); err != nil {
+		return models.List{}, err
+	}
+
 	return c.GetList(id, "")
 }
 
+// ArchiveList archives or unarchives a given list.
+func (c *Core) ArchiveList(id int, archive bool) (models.List, error) {
+	res, err := c.q.ArchiveList.Exec(id, archive)
+	if err != nil {
+		c.log.Printf("error archiving list: %v", err)
+		return models.List{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.list}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return models.List{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.list}"))
+	}
+
+	return c.GetList(id, "")
+}
+
+// MergeLists merges the subscriptions and campaigns of the list sourceID into
+// the list targetID using the given status rule for subscribers on both lists.
+// Nothing is changed if dryRun is true.
+func (c *Core) MergeLists(targetID, sourceID int, statusRule string, dryRun bool) (models.ListMergeResult, error) {
+	var out models.ListMergeResult
+	if err := c.q.MergeLists.Get(&out, targetID, sourceID, statusRule, dryRun); err != nil {
+		c.log.Printf("error merging lists: %v", err)
+		return out, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.lists}", "error", pqErrMsg(err)))
+	}
+	out.StatusRule = statusRule
+	out.DryRun = dryRun
+
+	return out, nil
+}
+
+// GetListBundleSubscribers retrieves a batch of the subscribers of a list after
+// the given subscriber ID with their subscription statuses.
+func (c *Core) GetListBundleSubscribers(listID, afterID, limit int) ([]models.ListBundleSubscriber, error) {
+	out := []models.ListBundleSubscriber{}
+	if err := c.q.GetListBundleSubscribers.Select(&out, listID, afterID, limit); err != nil {
+		c.log.Printf("error fetching list bundle subscribers: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// ImportListBundleSubscribers creates the given subscribers that don't exist and
+// subscribes all of them to a list with their subscription statuses.
+func (c *Core) ImportListBundleSubscribers(listID int, subs []models.ListBundleSubscriber) (models.ListBundleImportResult, error) {
+	type sub struct {
+		models.ListBundleSubscriber
+		UUID string `json:"uuid"`
+	}
+
+	// New subscribers are created with these UUIDs.
+	rec := make([]sub, 0, len(subs))
+	for _, s := range subs {
+		uu, err := uuid.NewV4()
+		if err != nil {
+			c.log.Printf("error generating UUID: %v", err)
+			return models.ListBundleImportResult{}, echo.NewHTTPError(http.StatusInternalServerError,
+				c.i18n.Ts("globals.messages.errorUUID", "error", err.Error()))
+		}
+		rec = append(rec, sub{ListBundleSubscriber: s, UUID: uu.String()})
+	}
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return models.ListBundleImportResult{}, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	var out models.ListBundleImportResult
+	if err := c.q.ImportListBundleSubscribers.Get(&out, listID, string(b)); err != nil {
+		c.log.Printf("error importing list bundle subscribers: %v", err)
+		return out, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
 // DeleteList deletes a list.
 func (c *Core) DeleteList(id int) error {
 	return c.DeleteLists([]int{id})
@@ -176,3 +365,55 @@ func (c *Core) DeleteLists(ids []int) error {
 	}
 	return nil
 }
+
+// RecordListSnapshots records the counts of the subscribers in every list by
+// their status on the given day, overwriting the day's existing counts.
+func (c *Core) RecordListSnapshots(day time.Time) error {
+	if _, err := c.q.RecordListSnapshots.Exec(day.Format("2006-01-02")); err != nil {
+		c.log.Printf("error recording list snapshots: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.lists}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// GetListSnapshots returns the daily subscriber counts of the given lists, or
+// all lists if there are none, between the given days.
+func (c *Core) GetListSnapshots(listIDs []int, from, to time.Time) ([]models.ListSnapshot, error) {
+	out := []models.ListSnapshot{}
+	if err := c.q.GetListSnapshots.Select(&out, pq.Array(listIDs), from.Format("2006-01-02"), to.Format("2006-01-02")); err != nil {
+		c.log.Printf("error fetching list snapshots: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.lists}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// GetListOptinReminderStats returns the numbers of a list's subscribers who
+// were sent opt-in reminders and who confirmed after them.
+func (c *Core) GetListOptinReminderStats(id int) (models.OptinReminderStats, error) {
+	var out models.OptinReminderStats
+	if err := c.q.GetListOptinReminderStats.Get(&out, id); err != nil {
+		c.log.Printf("error fetching list opt-in reminder stats: %v", err)
+		return out, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.list}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// GetListStats returns the growth, churn, and engagement stats of a list in
+// the last given number of days.
+func (c *Core) GetListStats(id, days int) (models.ListStats, error) {
+	var out models.ListStats
+	if err := c.q.GetListStats.Get(&out, id, days); err != nil {
+		c.log.Printf("error fetching list stats: %v", err)
+		return out, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.list}", "error", pqErrMsg(err)))
+	}
+	out.Days = days
+
+	return out, nil
+}
@@ -0,0 +1,125 @@
+package core
+
+import (
+	"net/http"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+// GetRSSFeeds retrieves all RSS feeds, or only the enabled ones.
+func (c *Core) GetRSSFeeds(enabledOnly bool) ([]models.RSSFeed, error) {
+	out := []models.RSSFeed{}
+	if err := c.q.GetRSSFeeds.Select(&out, 0, enabledOnly); err != nil {
+		c.log.Printf("error fetching rss feeds: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.rssFeeds}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// GetRSSFeed retrieves a given RSS feed.
+func (c *Core) GetRSSFeed(id int) (models.RSSFeed, error) {
+	var out []models.RSSFeed
+	if err := c.q.GetRSSFeeds.Select(&out, id, false); err != nil {
+		c.log.Printf("error fetching rss feed: %v", err)
+		return models.RSSFeed{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.rssFeed}", "error", pqErrMsg(err)))
+	}
+
+	if len(out) == 0 {
+		return models.RSSFeed{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.rssFeed}"))
+	}
+
+	return out[0], nil
+}
+
+// CreateRSSFeed creates a new RSS feed.
+func (c *Core) CreateRSSFeed(o models.RSSFeed) (models.RSSFeed, error) {
+	uu, err := uuid.NewV4()
+	if err != nil {
+		c.log.Printf("error generating UUID: %v", err)
+		return models.RSSFeed{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUUID", "error", err.Error()))
+	}
+
+	var newID int
+	if err := c.q.CreateRSSFeed.Get(&newID, uu, o.Name, o.URL, o.Enabled, o.PollInterval, o.ListIDs,
+		o.TemplateID.Int, o.Subject, o.FromEmail, o.Messenger, o.Body, o.MaxItems, o.AutoSend); err != nil {
+		c.log.Printf("error creating rss feed: %v", err)
+		return models.RSSFeed{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.rssFeed}", "error", pqErrMsg(err)))
+	}
+
+	return c.GetRSSFeed(newID)
+}
+
+// UpdateRSSFeed updates a given RSS feed.
+func (c *Core) UpdateRSSFeed(id int, o models.RSSFeed) (models.RSSFeed, error) {
+	res, err := c.q.UpdateRSSFeed.Exec(id, o.Name, o.URL, o.Enabled, o.PollInterval, o.ListIDs,
+		o.TemplateID.Int, o.Subject, o.FromEmail, o.Messenger, o.Body, o.MaxItems, o.AutoSend)
+	if err != nil {
+		c.log.Printf("error updating rss feed: %v", err)
+		return models.RSSFeed{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.rssFeed}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return models.RSSFeed{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.rssFeed}"))
+	}
+
+	return c.GetRSSFeed(id)
+}
+
+// UpdateRSSFeedChecked records the time at which an RSS feed was checked
+// and the error, if any, with which the check failed.
+func (c *Core) UpdateRSSFeedChecked(id int, lastErr string) error {
+	if _, err := c.q.UpdateRSSFeedChecked.Exec(id, lastErr); err != nil {
+		c.log.Printf("error updating rss feed: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.rssFeed}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// DeleteRSSFeed deletes a given RSS feed.
+func (c *Core) DeleteRSSFeed(id int) error {
+	if _, err := c.q.DeleteRSSFeed.Exec(id); err != nil {
+		c.log.Printf("error deleting rss feed: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.rssFeed}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// ClaimRSSFeedItems records the given item GUIDs of an RSS feed as seen and
+// returns the ones that hadn't been seen before.
+func (c *Core) ClaimRSSFeedItems(feedID int, guids []string) ([]string, error) {
+	out := []string{}
+	if err := c.q.InsertRSSFeedItems.Select(&out, feedID, pq.StringArray(guids)); err != nil {
+		c.log.Printf("error recording rss feed items: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.rssFeed}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// SetRSSFeedItemsCampaign records the campaign in which the given items of
+// an RSS feed were sent.
+func (c *Core) SetRSSFeedItemsCampaign(feedID int, guids []string, campID int) error {
+	if _, err := c.q.UpdateRSSFeedItemsCampaign.Exec(feedID, pq.StringArray(guids), campID); err != nil {
+		c.log.Printf("error updating rss feed items: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.rssFeed}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
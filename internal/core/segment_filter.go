@@ -0,0 +1,354 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+)
+
+const (
+	// Maximum nesting of groups and total number of conditions in a segment filter.
+	segFilterMaxDepth = 5
+	segFilterMaxRules = 100
+
+	// Prefix of the fields that filter on subscriber attributes, eg: attribs.city.
+	segFilterAttribPrefix = "attribs."
+	segFilterMaxKeyLen    = 200
+)
+
+// Kinds of the subscriber fields in segment filters.
+const (
+	segFieldText = iota
+	segFieldStatus
+	segFieldNumber
+	segFieldDate
+	segFieldTags
+)
+
+var (
+	// Subscriber fields that segments can be filtered on and their kinds.
+	segFilterFields = map[string]int{
+		"email":            segFieldText,
+		"name":             segFieldText,
+		"external_id":      segFieldText,
+		"locale":           segFieldText,
+		"timezone":         segFieldText,
+		"status":           segFieldStatus,
+		"engagement_score": segFieldNumber,
+		"created_at":       segFieldDate,
+		"updated_at":       segFieldDate,
+		"tags":             segFieldTags,
+	}
+
+	segFilterStatuses = []string{models.SubscriberStatusEnabled, models.SubscriberStatusDisabled,
+		models.SubscriberStatusBlockListed}
+
+	segFilterCmpOps = map[string]string{
+		"eq": "=", "neq": "<>", "gt": ">", "gte": ">=", "lt": "<", "lte": "<=",
+	}
+
+	// Escapes the wildcards in LIKE patterns with the ESCAPE character, !.
+	segFilterLikeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+)
+
+// compileSegmentFilter validates a structured segment filter and compiles
+// it to an SQL expression on the subscribers table. Every value in the filter
+// is compiled to a quoted literal.
+func compileSegmentFilter(f models.SegmentFilter) (string, error) {
+	n := 0
+	return compileSegFilterNode(f, 0, &n)
+}
+
+func compileSegFilterNode(f models.SegmentFilter, depth int, n *int) (string, error) {
+	if f.Op != "and" && f.Op != "or" {
+		*n++
+		if *n > segFilterMaxRules {
+			return "", fmt.Errorf("more than %d conditions", segFilterMaxRules)
+		}
+		return compileSegFilterRule(f)
+	}
+
+	if depth >= segFilterMaxDepth {
+		return "", fmt.Errorf("groups nested deeper than %d levels", segFilterMaxDepth)
+	}
+	if len(f.Rules) == 0 {
+		return "", errors.New("empty group")
+	}
+
+	parts := make([]string, 0, len(f.Rules))
+	for _, r := range f.Rules {
+		s, err := compileSegFilterNode(r, depth+1, n)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, s)
+	}
+
+	return "(" + strings.Join(parts, " "+strings.ToUpper(f.Op)+" ") + ")", nil
+}
+
+func compileSegFilterRule(f models.SegmentFilter) (string, error) {
+	if key, ok := strings.CutPrefix(f.Field, segFilterAttribPrefix); ok {
+		return compileSegFilterAttrib(key, f)
+	}
+
+	kind, ok := segFilterFields[f.Field]
+	if !ok {
+		return "", fmt.Errorf("unknown field: %s", f.Field)
+	}
+
+	col := "subscribers." + f.Field
+	switch kind {
+	case segFieldText:
+		return compileSegFilterText(col, f)
+
+	case segFieldStatus:
+		vals, err := segFilterValues(f)
+		if err != nil {
+			return "", err
+		}
+		for _, v := range vals {
+			if !strSliceContains(v, segFilterStatuses) {
+				return "", fmt.Errorf("invalid status: %s", v)
+			}
+		}
+
+		switch f.Op {
+		case "eq", "in":
+			return col + " IN (" + sqlLiterals(vals) + ")", nil
+		case "neq", "not_in":
+			return col + " NOT IN (" + sqlLiterals(vals) + ")", nil
+		}
+
+	case segFieldNumber:
+		if op, ok := segFilterCmpOps[f.Op]; ok {
+			v, err := segFilterNumber(f)
+			if err != nil {
+				return "", err
+			}
+			return col + " " + op + " " + v, nil
+		}
+
+	case segFieldDate:
+		switch f.Op {
+		case "before", "after":
+			v, ok := f.Val.(string)
+			if !ok || !isSegFilterDate(v) {
+				return "", fmt.Errorf("%s: invalid date", f.Field)
+			}
+			op := "<"
+			if f.Op == "after" {
+				op = ">"
+			}
+			return col + " " + op + " " + sqlLiteral(v) + "::TIMESTAMPTZ", nil
+
+		case "within_days", "older_than_days":
+			v, ok := f.Val.(float64)
+			if !ok || v < 1 || v != float64(int(v)) {
+				return "", fmt.Errorf("%s: invalid number of days", f.Field)
+			}
+			op := ">"
+			if f.Op == "older_than_days" {
+				op = "<"
+			}
+			return fmt.Sprintf("%s %s NOW() - INTERVAL '%d days'", col, op, int(v)), nil
+		}
+
+	case segFieldTags:
+		vals, err := segFilterValues(f)
+		if err != nil {
+			return "", err
+		}
+
+		parts := make([]string, 0, len(vals))
+		for _, v := range vals {
+			parts = append(parts, sqlLiteral(v)+" = ANY("+col+")")
+		}
+		exp := "(" + strings.Join(parts, " OR ") + ")"
+
+		switch f.Op {
+		case "contains", "in":
+			return exp, nil
+		case "not_contains", "not_in":
+			return "NOT " + exp, nil
+		}
+	}
+
+	return "", fmt.Errorf("%s: unknown op: %s", f.Field, f.Op)
+}
+
+// compileSegFilterText compiles a condition on a text expression.
+func compileSegFilterText(exp string, f models.SegmentFilter) (string, error) {
+	switch f.Op {
+	case "in", "not_in":
+		vals, err := segFilterValues(f)
+		if err != nil {
+			return "", err
+		}
+		if f.Op == "in" {
+			return exp + " IN (" + sqlLiterals(vals) + ")", nil
+		}
+		return "(" + exp + " IS NULL OR " + exp + " NOT IN (" + sqlLiterals(vals) + "))", nil
+	}
+
+	v, ok := f.Val.(string)
+	if !ok {
+		return "", fmt.Errorf("%s: value should be a string", f.Field)
+	}
+
+	switch f.Op {
+	case "eq":
+		return exp + " = " + sqlLiteral(v), nil
+	case "neq":
+		return exp + " IS DISTINCT FROM " + sqlLiteral(v), nil
+	case "contains":
+		return exp + " ILIKE " + sqlLikePattern(v, true, true), nil
+	case "not_contains":
+		return "NOT (COALESCE(" + exp + ", '') ILIKE " + sqlLikePattern(v, true, true) + ")", nil
+	case "starts_with":
+		return exp + " ILIKE " + sqlLikePattern(v, false, true), nil
+	case "ends_with":
+		return exp + " ILIKE " + sqlLikePattern(v, true, false), nil
+	}
+
+	return "", fmt.Errorf("%s: unknown op: %s", f.Field, f.Op)
+}
+
+// compileSegFilterAttrib compiles a condition on a subscriber attribute. The
+// equality ops compare JSON values and the string and number ops compare
+// the attribute's text and numeric values.
+func compileSegFilterAttrib(key string, f models.SegmentFilter) (string, error) {
+	if !strHasLen(key, 1, segFilterMaxKeyLen) {
+		return "", fmt.Errorf("invalid attribute: %s", f.Field)
+	}
+
+	var (
+		col  = "subscribers.attribs->" + sqlLiteral(key)
+		text = "subscribers.attribs->>" + sqlLiteral(key)
+	)
+
+	switch f.Op {
+	case "exists":
+		return "subscribers.attribs ? " + sqlLiteral(key), nil
+	case "not_exists":
+		return "NOT (subscribers.attribs ? " + sqlLiteral(key) + ")", nil
+
+	case "eq", "neq", "in", "not_in":
+		vals := []interface{}{f.Val}
+		if f.Op == "in" || f.Op == "not_in" {
+			v, ok := f.Val.([]interface{})
+			if !ok || len(v) == 0 {
+				return "", fmt.Errorf("%s: value should be a list", f.Field)
+			}
+			vals = v
+		}
+
+		lits := make([]string, 0, len(vals))
+		for _, v := range vals {
+			switch v.(type) {
+			case string, float64, bool:
+			default:
+				return "", fmt.Errorf("%s: value should be a string, number, or boolean", f.Field)
+			}
+
+			b, _ := json.Marshal(v)
+			lits = append(lits, sqlLiteral(string(b))+"::JSONB")
+		}
+
+		switch f.Op {
+		case "eq":
+			return col + " = " + lits[0], nil
+		case "neq":
+			return col + " IS DISTINCT FROM " + lits[0], nil
+		case "in":
+			return col + " IN (" + strings.Join(lits, ", ") + ")", nil
+		default:
+			return "(" + col + " IS NULL OR " + col + " NOT IN (" + strings.Join(lits, ", ") + "))", nil
+		}
+
+	case "gt", "gte", "lt", "lte":
+		v, err := segFilterNumber(f)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("(CASE WHEN JSONB_TYPEOF(%s) = 'number' THEN (%s)::NUMERIC END) %s %s",
+			col, text, segFilterCmpOps[f.Op], v), nil
+	}
+
+	return compileSegFilterText(text, f)
+}
+
+// segFilterValues returns the string values of a condition, which is either
+// a single string, or a list of them with the in and not_in ops.
+func segFilterValues(f models.SegmentFilter) ([]string, error) {
+	if v, ok := f.Val.(string); ok {
+		return []string{v}, nil
+	}
+
+	vals, ok := f.Val.([]interface{})
+	if !ok || len(vals) == 0 {
+		return nil, fmt.Errorf("%s: value should be a string or a list of strings", f.Field)
+	}
+
+	out := make([]string, 0, len(vals))
+	for _, v := range vals {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: value should be a string or a list of strings", f.Field)
+		}
+		out = append(out, s)
+	}
+
+	return out, nil
+}
+
+// segFilterNumber returns the numeric value of a condition as an SQL literal.
+func segFilterNumber(f models.SegmentFilter) (string, error) {
+	v, ok := f.Val.(float64)
+	if !ok {
+		return "", fmt.Errorf("%s: value should be a number", f.Field)
+	}
+
+	return strconv.FormatFloat(v, 'f', -1, 64), nil
+}
+
+func isSegFilterDate(s string) bool {
+	if _, err := time.Parse(time.RFC3339, s); err == nil {
+		return true
+	}
+	_, err := time.Parse("2006-01-02", s)
+	return err == nil
+}
+
+// sqlLiteral quotes a string as an SQL string literal.
+func sqlLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func sqlLiterals(vals []string) string {
+	out := make([]string, len(vals))
+	for i, v := range vals {
+		out[i] = sqlLiteral(v)
+	}
+
+	return strings.Join(out, ", ")
+}
+
+// sqlLikePattern quotes a string as a LIKE pattern that matches it literally,
+// optionally with any prefix or suffix.
+func sqlLikePattern(s string, prefix, suffix bool) string {
+	p := segFilterLikeEscaper.Replace(s)
+	if prefix {
+		p = "%" + p
+	}
+	if suffix {
+		p = p + "%"
+	}
+
+	return sqlLiteral(p) + " ESCAPE '!'"
+}
@@ -0,0 +1,190 @@
+package core
+
+import (
+	"net/http"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// GetSegments retrieves all segments.
+func (c *Core) GetSegments() ([]models.Segment, error) {
+	out := []models.Segment{}
+	if err := c.q.GetSegments.Select(&out, 0); err != nil {
+		c.log.Printf("error fetching segments: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.segments}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// GetSegment retrieves a given segment.
+func (c *Core) GetSegment(id int) (models.Segment, error) {
+	var out []models.Segment
+	if err := c.q.GetSegments.Select(&out, id); err != nil {
+		c.log.Printf("error fetching segment: %v", err)
+		return models.Segment{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.segment}", "error", pqErrMsg(err)))
+	}
+
+	if len(out) == 0 {
+		return models.Segment{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.segment}"))
+	}
+
+	return out[0], nil
+}
+
+// CreateSegment creates a new segment and counts its subscribers. A segment
+// with a structured filter has its query compiled from it.
+func (c *Core) CreateSegment(o models.Segment) (models.Segment, error) {
+	if o.Filter != nil {
+		q, err := compileSegmentFilter(*o.Filter)
+		if err != nil {
+			return models.Segment{}, echo.NewHTTPError(http.StatusBadRequest,
+				c.i18n.Ts("segments.invalidFilter", "error", err.Error()))
+		}
+		o.Query = q
+	}
+
+	o.Query = sanitizeSQLExp(o.Query)
+	if err := ValidateSQLExp(o.Query); err != nil {
+		return models.Segment{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("subscribers.errorPreparingQuery", "error", err.Error()))
+	}
+
+	uu, err := uuid.NewV4()
+	if err != nil {
+		c.log.Printf("error generating UUID: %v", err)
+		return models.Segment{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUUID", "error", err.Error()))
+	}
+
+	var newID int
+	if err := c.q.CreateSegment.Get(&newID, uu, o.Name, o.Description, o.Query, o.Filter); err != nil {
+		c.log.Printf("error creating segment: %v", err)
+		return models.Segment{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.segment}", "error", pqErrMsg(err)))
+	}
+
+	o.ID = newID
+	if err := c.RefreshSegment(o); err != nil {
+		return models.Segment{}, err
+	}
+
+	return c.GetSegment(newID)
+}
+
+// UpdateSegment updates a given segment and counts its subscribers afresh
+// if its query has changed.
+func (c *Core) UpdateSegment(id int, o models.Segment) (models.Segment, error) {
+	if o.Filter != nil {
+		q, err := compileSegmentFilter(*o.Filter)
+		if err != nil {
+			return models.Segment{}, echo.NewHTTPError(http.StatusBadRequest,
+				c.i18n.Ts("segments.invalidFilter", "error", err.Error()))
+		}
+		o.Query = q
+	}
+
+	o.Query = sanitizeSQLExp(o.Query)
+	if err := ValidateSQLExp(o.Query); err != nil {
+		return models.Segment{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("subscribers.errorPreparingQuery", "error", err.Error()))
+	}
+
+	res, err := c.q.UpdateSegment.Exec(id, o.Name, o.Description, o.Query, o.Filter)
+	if err != nil {
+		c.log.Printf("error updating segment: %v", err)
+		return models.Segment{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.segment}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return models.Segment{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.segment}"))
+	}
+
+	out, err := c.GetSegment(id)
+	if err != nil {
+		return models.Segment{}, err
+	}
+	if out.RefreshedAt.Valid {
+		return out, nil
+	}
+
+	if err := c.RefreshSegment(out); err != nil {
+		return models.Segment{}, err
+	}
+
+	return c.GetSegment(id)
+}
+
+// DeleteSegment deletes a given segment and removes it from the campaigns
+// that are sent to it.
+func (c *Core) DeleteSegment(id int) error {
+	if _, err := c.q.DeleteSegment.Exec(id); err != nil {
+		c.log.Printf("error deleting segment: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.segment}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// RefreshSegment materializes the subscribers that match a segment's query
+// and caches their count.
+func (c *Core) RefreshSegment(o models.Segment) error {
+	if err := c.q.ExecSubQueryTpl(subQueryExp(o.Query, false), c.q.RefreshSegment, nil, c.db, o.ID); err != nil {
+		c.log.Printf("error refreshing segment (%s): %v", o.Name, err)
+		return echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("subscribers.errorPreparingQuery", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// RefreshSegments refreshes the given segments, or all of them if no IDs are given.
+func (c *Core) RefreshSegments(ids []int64) error {
+	segs, err := c.GetSegments()
+	if err != nil {
+		return err
+	}
+
+	for _, s := range segs {
+		if len(ids) > 0 && !inInt64s(int64(s.ID), ids) {
+			continue
+		}
+		if err := c.RefreshSegment(s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetSegmentStats returns the stats of the subscribers in a segment, with
+// their engagement in the last given number of days.
+func (c *Core) GetSegmentStats(id, days int) (models.SegmentStats, error) {
+	var out models.SegmentStats
+	if err := c.q.GetSegmentStats.Get(&out, id, days); err != nil {
+		c.log.Printf("error fetching segment stats: %v", err)
+		return out, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.segment}", "error", pqErrMsg(err)))
+	}
+	out.Days = days
+
+	return out, nil
+}
+
+func inInt64s(v int64, sl []int64) bool {
+	for _, s := range sl {
+		if s == v {
+			return true
+		}
+	}
+
+	return false
+}
@@ -31,6 +31,19 @@ func (c *Core) GetSettings() (models.Settings, error) {
 	return out, nil
 }
 
+// GetMessengerUsage returns the number of messages sent through messengers on
+// a day and in the month that starts on the given day (YYYY-MM-DD).
+func (c *Core) GetMessengerUsage(day, month string) ([]models.MessengerUsage, error) {
+	out := []models.MessengerUsage{}
+	if err := c.q.GetMessengerUsage.Select(&out, day, month, ""); err != nil {
+		c.log.Printf("error fetching messenger usage: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.messengers}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
 // UpdateSettings updates settings.
 func (c *Core) UpdateSettings(s models.Settings) error {
 	// Marshal settings.
@@ -0,0 +1,334 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// sqlTok is a token in an arbitrary SQL expression.
+type sqlTok struct {
+	typ int
+	val string
+}
+
+const (
+	tokIdent = iota
+	tokQuotedIdent
+	tokString
+	tokNumber
+	tokOperator
+	tokPunct
+)
+
+var (
+	// Columns that can be referenced in subscriber query expressions,
+	// qualified or unqualified.
+	sqlExpColumns = map[string]map[string]bool{
+		"subscribers": {
+			"id": true, "uuid": true, "email": true, "name": true, "attribs": true,
+			"status": true, "engagement_score": true, "engagement_updated_at": true,
+			"created_at": true, "updated_at": true, "search_text": true, "external_id": true,
+			"tags": true,
+		},
+		"subscriber_lists": {
+			"subscriber_id": true, "list_id": true, "status": true, "meta": true,
+			"created_at": true, "updated_at": true,
+		},
+	}
+
+	sqlExpKeywords = map[string]bool{
+		"and": true, "or": true, "not": true, "is": true, "null": true, "true": true,
+		"false": true, "in": true, "like": true, "ilike": true, "similar": true, "to": true,
+		"between": true, "symmetric": true, "any": true, "all": true, "some": true,
+		"case": true, "when": true, "then": true, "else": true, "end": true,
+		"distinct": true, "escape": true, "array": true, "unknown": true,
+		"current_date": true, "current_timestamp": true, "asc": true, "desc": true,
+	}
+
+	sqlExpFuncs = map[string]bool{
+		"lower": true, "upper": true, "length": true, "char_length": true, "trim": true,
+		"btrim": true, "ltrim": true, "rtrim": true, "substr": true, "left": true, "right": true,
+		"concat": true, "split_part": true, "replace": true, "strpos": true, "position": true,
+		"coalesce": true, "nullif": true, "greatest": true, "least": true,
+		"abs": true, "round": true, "floor": true, "ceil": true, "power": true,
+		"now": true, "date": true, "date_trunc": true, "date_part": true, "age": true, "to_char": true,
+		"to_date": true, "to_timestamp": true, "make_interval": true,
+		"jsonb_typeof": true, "jsonb_array_length": true, "jsonb_exists": true,
+		"array_length": true, "cardinality": true,
+		"to_tsvector": true, "to_tsquery": true, "plainto_tsquery": true, "websearch_to_tsquery": true,
+		"similarity": true, "word_similarity": true,
+	}
+
+	// Types that values can be cast to, eg: attribs->>'age'::INT.
+	sqlExpTypes = map[string]bool{
+		"text": true, "varchar": true, "int": true, "integer": true, "bigint": true, "smallint": true,
+		"numeric": true, "decimal": true, "float": true, "real": true, "boolean": true, "bool": true,
+		"date": true, "time": true, "timestamp": true, "timestamptz": true, "interval": true,
+		"json": true, "jsonb": true, "uuid": true,
+	}
+
+	sqlExpOperators = map[string]bool{
+		"=": true, "<>": true, "!=": true, "<": true, ">": true, "<=": true, ">=": true,
+		"+": true, "-": true, "*": true, "/": true, "%": true, "||": true,
+		"->": true, "->>": true, "#>": true, "#>>": true, "@>": true, "<@": true,
+		"?": true, "?|": true, "?&": true, "~": true, "~*": true, "!~": true, "!~*": true,
+		"::": true, "&&": true, "@@": true, "<%": true, "%>": true,
+	}
+
+	// Keywords of statements and clauses that can't appear in an expression.
+	// They're checked separately from the allowlist for clearer errors.
+	sqlExpDangerous = map[string]bool{
+		"select": true, "insert": true, "update": true, "delete": true, "drop": true,
+		"alter": true, "create": true, "truncate": true, "grant": true, "revoke": true,
+		"copy": true, "union": true, "intersect": true, "except": true, "into": true,
+		"execute": true, "do": true, "call": true, "from": true, "with": true,
+		"returning": true, "set": true, "lock": true, "vacuum": true, "listen": true,
+		"notify": true, "prepare": true, "declare": true, "begin": true, "commit": true,
+		"rollback": true, "savepoint": true, "reset": true, "load": true, "table": true,
+		"values": true, "lateral": true, "join": true,
+	}
+)
+
+// ValidateSQLExp checks an arbitrary SQL expression used to query subscribers
+// against an allowlist of columns, operators, and functions, and rejects
+// comments, multiple statements, subqueries, and other constructs that could
+// be used to do more than filter subscribers.
+func ValidateSQLExp(q string) error {
+	toks, err := lexSQLExp(q)
+	if err != nil {
+		return err
+	}
+
+	depth := 0
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		next := sqlTok{typ: -1}
+		if i+1 < len(toks) {
+			next = toks[i+1]
+		}
+
+		switch t.typ {
+		case tokString, tokNumber:
+
+		case tokOperator:
+			if !sqlExpOperators[t.val] {
+				return fmt.Errorf("operator not allowed: %s", t.val)
+			}
+
+			// Type cast.
+			if t.val == "::" {
+				n, err := checkSQLExpType(toks, i+1)
+				if err != nil {
+					return err
+				}
+				i += n
+			}
+
+		case tokPunct:
+			switch t.val {
+			case "(":
+				depth++
+			case ")":
+				depth--
+				if depth < 0 {
+					return fmt.Errorf("unbalanced parentheses")
+				}
+			}
+
+		case tokQuotedIdent, tokIdent:
+			name := t.val
+
+			// IS [NOT] DISTINCT FROM is a comparison.
+			if t.typ == tokIdent && name == "from" && i > 0 && toks[i-1].val == "distinct" {
+				continue
+			}
+
+			if t.typ == tokIdent && sqlExpDangerous[name] {
+				return fmt.Errorf("not allowed: %s", strings.ToUpper(name))
+			}
+
+			// Qualified column: table.column
+			if next.typ == tokPunct && next.val == "." {
+				if i+2 >= len(toks) || (toks[i+2].typ != tokIdent && toks[i+2].typ != tokQuotedIdent) {
+					return fmt.Errorf("invalid column reference: %s", name)
+				}
+
+				cols, ok := sqlExpColumns[name]
+				if !ok {
+					return fmt.Errorf("table not allowed: %s", name)
+				}
+				if col := toks[i+2].val; !cols[col] {
+					return fmt.Errorf("column not allowed: %s.%s", name, col)
+				}
+				i += 2
+				continue
+			}
+
+			if t.typ == tokIdent {
+				// Keywords, including those that precede parentheses, eg: AND (...), IN (...).
+				if sqlExpKeywords[name] {
+					continue
+				}
+
+				// Function call.
+				if next.typ == tokPunct && next.val == "(" {
+					if sqlExpFuncs[name] {
+						continue
+					}
+					return fmt.Errorf("function not allowed: %s", name)
+				}
+
+				// Typed literal, eg: INTERVAL '1 day'.
+				if sqlExpTypes[name] && next.typ == tokString {
+					continue
+				}
+			}
+
+			if !isSQLExpColumn(name) {
+				return fmt.Errorf("column not allowed: %s", name)
+			}
+		}
+	}
+
+	if depth != 0 {
+		return fmt.Errorf("unbalanced parentheses")
+	}
+
+	return nil
+}
+
+// checkSQLExpType checks the type name starting at toks[i] after a :: cast
+// and returns the number of tokens it spans.
+func checkSQLExpType(toks []sqlTok, i int) (int, error) {
+	if i >= len(toks) || toks[i].typ != tokIdent || !sqlExpTypes[toks[i].val] {
+		if i < len(toks) {
+			return 0, fmt.Errorf("type not allowed: %s", toks[i].val)
+		}
+		return 0, fmt.Errorf("missing type after ::")
+	}
+
+	n := 1
+
+	// TIMESTAMP WITH(OUT) TIME ZONE.
+	if t := toks[i].val; (t == "timestamp" || t == "time") && i+3 < len(toks) &&
+		(toks[i+1].val == "with" || toks[i+1].val == "without") && toks[i+2].val == "time" && toks[i+3].val == "zone" {
+		n += 3
+	}
+
+	// Array types, eg: TEXT[].
+	if i+n+1 < len(toks) && toks[i+n].val == "[" && toks[i+n+1].val == "]" {
+		n += 2
+	}
+
+	return n, nil
+}
+
+func isSQLExpColumn(name string) bool {
+	for _, cols := range sqlExpColumns {
+		if cols[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// lexSQLExp splits an SQL expression into tokens. Identifiers and keywords
+// are lowercased.
+func lexSQLExp(q string) ([]sqlTok, error) {
+	var (
+		toks []sqlTok
+		r    = []rune(q)
+	)
+
+	for i := 0; i < len(r); {
+		c := r[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c == '-' && i+1 < len(r) && r[i+1] == '-', c == '/' && i+1 < len(r) && r[i+1] == '*':
+			return nil, fmt.Errorf("comments are not allowed")
+
+		case c == ';':
+			return nil, fmt.Errorf("multiple statements are not allowed")
+
+		case c == '$':
+			return nil, fmt.Errorf("parameters and dollar quoted strings are not allowed")
+
+		case c == '\\':
+			return nil, fmt.Errorf("backslash commands are not allowed")
+
+		case c == '\'':
+			j := i + 1
+			for ; j < len(r); j++ {
+				if r[j] == '\'' {
+					// Escaped quote.
+					if j+1 < len(r) && r[j+1] == '\'' {
+						j++
+						continue
+					}
+					break
+				}
+			}
+			if j >= len(r) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			toks = append(toks, sqlTok{tokString, string(r[i+1 : j])})
+			i = j + 1
+
+		case c == '"':
+			j := i + 1
+			for j < len(r) && r[j] != '"' {
+				j++
+			}
+			if j >= len(r) {
+				return nil, fmt.Errorf("unterminated quoted identifier")
+			}
+			toks = append(toks, sqlTok{tokQuotedIdent, string(r[i+1 : j])})
+			i = j + 1
+
+		case unicode.IsDigit(c):
+			j := i
+			for j < len(r) && (unicode.IsDigit(r[j]) || r[j] == '.' || r[j] == 'e' || r[j] == 'E') {
+				j++
+			}
+			toks = append(toks, sqlTok{tokNumber, string(r[i:j])})
+			i = j
+
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(r) && (unicode.IsLetter(r[j]) || unicode.IsDigit(r[j]) || r[j] == '_') {
+				j++
+			}
+
+			// Prefixed strings and identifiers such as E'', U&'', B''.
+			if j < len(r) && (r[j] == '\'' || r[j] == '&' || r[j] == '"') {
+				return nil, fmt.Errorf("prefixed strings are not allowed: %s", string(r[i:j+1]))
+			}
+			toks = append(toks, sqlTok{tokIdent, strings.ToLower(string(r[i:j]))})
+			i = j
+
+		case strings.ContainsRune("(),[].", c):
+			toks = append(toks, sqlTok{tokPunct, string(c)})
+			i++
+
+		case strings.ContainsRune("+-*/<>=~!@#%^&|?:", c):
+			j := i
+			for j < len(r) && strings.ContainsRune("+-*/<>=~!@#%^&|?:", r[j]) {
+				// A - after another operator is a unary minus, eg: >-1.
+				if j > i && r[j] == '-' && !(r[j-1] == '-' || r[j-1] == '#') && !(j+1 < len(r) && r[j+1] == '>') {
+					break
+				}
+				j++
+			}
+			toks = append(toks, sqlTok{tokOperator, string(r[i:j])})
+			i = j
+
+		default:
+			return nil, fmt.Errorf("unexpected character: %c", c)
+		}
+	}
+
+	return toks, nil
+}
@@ -0,0 +1,93 @@
+package core
+
+import "testing"
+
+func TestValidateSQLExp(t *testing.T) {
+	valid := []string{
+		"",
+		"subscribers.email LIKE '%@example.com'",
+		"name ILIKE 'john%' AND status = 'enabled'",
+		"subscribers.attribs->>'city' = 'Bengaluru'",
+		"(attribs->>'age')::INT > 30",
+		"attribs->'projects' @> '[\"listmonk\"]'::JSONB",
+		"subscribers.created_at > NOW() - INTERVAL '30 days'",
+		"created_at::TIMESTAMP WITH TIME ZONE < CURRENT_TIMESTAMP",
+		"tags && ARRAY['vip']::TEXT[]",
+		"LOWER(email) IN ('a@example.com', 'b@example.com')",
+		"engagement_score >-1 AND engagement_score <= 10.5",
+		"subscriber_lists.list_id = 3 AND subscriber_lists.status != 'unsubscribed'",
+		"email IS NOT DISTINCT FROM 'john@example.com'",
+		"CASE WHEN status = 'enabled' THEN true ELSE false END",
+		"name = 'O''Brien'",
+		`"email" = 'john@example.com'`,
+	}
+	for _, q := range valid {
+		if err := ValidateSQLExp(q); err != nil {
+			t.Errorf("ValidateSQLExp(%q): unexpected error: %v", q, err)
+		}
+	}
+
+	invalid := []string{
+		// Statements, subqueries, and set operations.
+		"id = 1; DROP TABLE subscribers",
+		"id IN (SELECT id FROM subscribers)",
+		"id = 1 UNION SELECT 1",
+		"EXISTS (SELECT 1)",
+
+		// Comments and quoting tricks.
+		"id = 1 -- comment",
+		"id = 1 /* comment */",
+		"name = $$x$$",
+		"name = $1",
+		"name = E'\\x41'",
+		"name = 'unterminated",
+		`"unterminated = 1`,
+		"\\copy subscribers",
+
+		// Columns, tables, functions, and types outside the allowlists.
+		"password = 'x'",
+		"users.password = 'x'",
+		"subscribers.token_hash = 'x'",
+		"pg_sleep(10) IS NULL",
+		"email = CURRENT_USER",
+		"id::REGCLASS IS NULL",
+		"id::",
+
+		// Malformed expressions.
+		"(id = 1",
+		"id = 1)",
+		"subscribers. = 1",
+		"id = 1 `",
+	}
+	for _, q := range invalid {
+		if err := ValidateSQLExp(q); err == nil {
+			t.Errorf("ValidateSQLExp(%q): expected an error", q)
+		}
+	}
+}
+
+func TestLexSQLExp(t *testing.T) {
+	toks, err := lexSQLExp(`Subscribers."email" ->> 'a''b' >-1.5`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	exp := []sqlTok{
+		{tokIdent, "subscribers"},
+		{tokPunct, "."},
+		{tokQuotedIdent, "email"},
+		{tokOperator, "->>"},
+		{tokString, "a''b"},
+		{tokOperator, ">"},
+		{tokOperator, "-"},
+		{tokNumber, "1.5"},
+	}
+	if len(toks) != len(exp) {
+		t.Fatalf("expected %d tokens, got %d: %+v", len(exp), len(toks), toks)
+	}
+	for i, tok := range toks {
+		if tok != exp[i] {
+			t.Errorf("token %d: expected %+v, got %+v", i, exp[i], tok)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package core
+
+import (
+	"net/http"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+// GetSubscriberConsents retrieves the consent records of a subscriber, latest first.
+func (c *Core) GetSubscriberConsents(subID int) ([]models.SubscriberConsent, error) {
+	out := []models.SubscriberConsent{}
+	if err := c.q.GetSubscriberConsents.Select(&out, subID); err != nil {
+		c.log.Printf("error fetching subscriber consents: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{subscribers.consents}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// InsertSubscriberConsent records the consent of a subscriber to their
+// subscriptions to the given lists.
+func (c *Core) InsertSubscriberConsent(subUUID string, listUUIDs []string, o models.SubscriberConsent) error {
+	if _, err := c.q.InsertSubscriberConsent.Exec(subUUID, o.Type, pq.Array(listUUIDs), o.IP, o.UserAgent, o.Source, o.URL); err != nil {
+		c.log.Printf("error recording subscriber consent: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{subscribers.consents}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package core
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+// GetSubscriberEmails retrieves the alternate e-mails of a subscriber.
+func (c *Core) GetSubscriberEmails(subID int) ([]models.SubscriberEmail, error) {
+	out := []models.SubscriberEmail{}
+	if err := c.q.GetSubscriberEmails.Select(&out, subID, 0, "", subEmailChangeExpiry); err != nil {
+		c.log.Printf("error fetching subscriber e-mails: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{subscribers.alternateEmails}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// GetSubscriberEmail returns the alternate e-mail of a subscriber with the
+// given ID, or the unverified one with the given token if it hasn't expired.
+func (c *Core) GetSubscriberEmail(subID, id int, token string) (models.SubscriberEmail, bool, error) {
+	var out models.SubscriberEmail
+	if err := c.q.GetSubscriberEmails.Get(&out, subID, id, token, subEmailChangeExpiry); err != nil {
+		if err == sql.ErrNoRows {
+			return out, false, nil
+		}
+
+		c.log.Printf("error fetching subscriber e-mail: %v", err)
+		return out, false, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{subscribers.alternateEmails}", "error", pqErrMsg(err)))
+	}
+
+	return out, true, nil
+}
+
+// AddSubscriberEmail adds an unverified alternate e-mail to a subscriber and
+// returns it with the token that verifies it. Adding an e-mail that's already
+// an unverified alternate e-mail of the subscriber renews its token.
+func (c *Core) AddSubscriberEmail(subID int, email string) (models.SubscriberEmail, error) {
+	uu, err := uuid.NewV4()
+	if err != nil {
+		c.log.Printf("error generating UUID: %v", err)
+		return models.SubscriberEmail{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUUID", "error", err.Error()))
+	}
+
+	var out models.SubscriberEmail
+	if err := c.q.CreateSubscriberEmail.Get(&out, subID, email, uu.String()); err != nil {
+		// The e-mail belongs to a subscriber.
+		if err == sql.ErrNoRows {
+			return out, echo.NewHTTPError(http.StatusConflict, c.i18n.T("subscribers.emailExists"))
+		}
+
+		c.log.Printf("error creating subscriber e-mail: %v", err)
+		return out, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{subscribers.alternateEmails}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// VerifySubscriberEmail verifies the alternate e-mail with the given token.
+func (c *Core) VerifySubscriberEmail(token string) (models.SubscriberEmail, error) {
+	var out models.SubscriberEmail
+	if err := c.q.VerifySubscriberEmail.Get(&out, token, subEmailChangeExpiry); err != nil {
+		if err == sql.ErrNoRows {
+			return out, echo.NewHTTPError(http.StatusBadRequest, c.i18n.T("public.emailVerifyExpired"))
+		}
+
+		c.log.Printf("error verifying subscriber e-mail: %v", err)
+		return out, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{subscribers.alternateEmails}", "error", pqErrMsg(err)))
+	}
+	c.fireSubscriberEvent(EventSubscriberUpdated, out.SubscriberID, "", "", "")
+
+	return out, nil
+}
+
+// SetPrimarySubscriberEmail makes a verified alternate e-mail of a subscriber
+// their primary e-mail, and their primary e-mail an alternate one.
+func (c *Core) SetPrimarySubscriberEmail(subID, id int) error {
+	var out int
+	if err := c.q.SetPrimarySubscriberEmail.Get(&out, subID, id); err != nil {
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusBadRequest, c.i18n.T("subscribers.emailNotVerified"))
+		}
+
+		if pqErr, ok := err.(*pq.Error); ok && (pqErr.Constraint == "subscribers_email_key" || pqErr.Constraint == "idx_subs_email") {
+			return echo.NewHTTPError(http.StatusConflict, c.i18n.T("subscribers.emailExists"))
+		}
+
+		c.log.Printf("error setting primary subscriber e-mail: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscriber}", "error", pqErrMsg(err)))
+	}
+	c.fireSubscriberEvent(EventSubscriberUpdated, subID, "", "", "")
+
+	return nil
+}
+
+// DeleteSubscriberEmail deletes an alternate e-mail of a subscriber.
+func (c *Core) DeleteSubscriberEmail(subID, id int) error {
+	if _, err := c.q.DeleteSubscriberEmail.Exec(subID, id); err != nil {
+		c.log.Printf("error deleting subscriber e-mail: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{subscribers.alternateEmails}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// GetSubscriberEmailOwner returns the ID of the subscriber with the given
+// verified alternate e-mail, or 0 if there's none.
+func (c *Core) GetSubscriberEmailOwner(email string) (int, error) {
+	var id int
+	if err := c.q.GetSubscriberEmailOwner.Get(&id, email); err != nil && err != sql.ErrNoRows {
+		c.log.Printf("error fetching subscriber e-mail: %v", err)
+		return 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.subscriber}", "error", pqErrMsg(err)))
+	}
+
+	return id, nil
+}
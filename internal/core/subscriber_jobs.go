@@ -0,0 +1,160 @@
+package core
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+// StartSubscriberJob records a bulk action on the subscribers that match a
+// query with the number of them, after verifying that the query is read only.
+func (c *Core) StartSubscriberJob(j models.SubscriberJob) (models.SubscriberJob, error) {
+	j.Query = sanitizeSQLExp(j.Query)
+
+	// Restores act on the soft-deleted subscribers that are excluded from the rest.
+	matched, err := c.getSubscriberCount(j.Query, j.Action == models.SubscriberJobActionRestore, "", int64sToInts(j.ListIDs))
+	if err != nil {
+		return models.SubscriberJob{}, err
+	}
+
+	if j.ListIDs == nil {
+		j.ListIDs = pq.Int64Array{}
+	}
+	if j.TargetListIDs == nil {
+		j.TargetListIDs = pq.Int64Array{}
+	}
+	if j.Tags == nil {
+		j.Tags = pq.StringArray{}
+	}
+
+	var out models.SubscriberJob
+	if err := c.q.CreateSubscriberJob.Get(&out, j.Action, j.Query, j.ListIDs, j.TargetListIDs,
+		j.SubStatus, j.CreatedBy, matched, j.Tags); err != nil {
+		c.log.Printf("error creating subscriber job: %v", err)
+		return models.SubscriberJob{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{subscribers.job}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// UpdateSubscriberJob updates the progress and the status of a bulk subscriber job.
+func (c *Core) UpdateSubscriberJob(j models.SubscriberJob) error {
+	if _, err := c.q.UpdateSubscriberJob.Exec(j.ID, j.Status, j.Error, j.Processed); err != nil {
+		c.log.Printf("error updating subscriber job: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{subscribers.job}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// GetSubscriberJob retrieves a bulk subscriber job.
+func (c *Core) GetSubscriberJob(id int) (models.SubscriberJob, error) {
+	var out models.SubscriberJob
+	if err := c.q.GetSubscriberJob.Get(&out, id); err != nil {
+		if err == sql.ErrNoRows {
+			return out, echo.NewHTTPError(http.StatusBadRequest,
+				c.i18n.Ts("globals.messages.notFound", "name", "{subscribers.job}"))
+		}
+
+		c.log.Printf("error fetching subscriber job: %v", err)
+		return out, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{subscribers.job}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// QuerySubscriberJobs retrieves the bulk subscriber jobs, latest first.
+func (c *Core) QuerySubscriberJobs(offset, limit int) ([]models.SubscriberJob, int, error) {
+	out := []models.SubscriberJob{}
+	if err := c.q.QuerySubscriberJobs.Select(&out, offset, limit); err != nil {
+		c.log.Printf("error fetching subscriber jobs: %v", err)
+		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{subscribers.jobs}", "error", pqErrMsg(err)))
+	}
+
+	total := 0
+	if len(out) > 0 {
+		total = out[0].Total
+	}
+
+	return out, total, nil
+}
+
+// GetMaxSubscriberID returns the largest subscriber ID, up to which a bulk
+// subscriber job processes subscribers.
+func (c *Core) GetMaxSubscriberID() (int, error) {
+	var out int
+	if err := c.q.GetMaxSubscriberID.Get(&out); err != nil {
+		c.log.Printf("error fetching max subscriber ID: %v", err)
+		return 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// RunSubscriberJobBatch performs the action of a bulk subscriber job on the
+// matching subscribers with IDs in the range (fromID, toID], and returns the
+// number of them.
+func (c *Core) RunSubscriberJobBatch(j models.SubscriberJob, fromID, toID int) (int, error) {
+	query := fmt.Sprintf("subscribers.id > %d AND subscribers.id <= %d", fromID, toID)
+	if j.Query != "" {
+		query = "(" + j.Query + ") AND " + query
+	}
+
+	var (
+		listIDs   = int64sToInts(j.ListIDs)
+		targetIDs = int64sToInts(j.TargetListIDs)
+	)
+
+	// Count the subscribers before acting on them, as they may no longer
+	// match afterwards.
+	n, err := c.getSubscriberCount(query, j.Action == models.SubscriberJobActionRestore, "", listIDs)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+
+	switch j.Action {
+	case models.SubscriberJobActionBlocklist:
+		err = c.BlocklistSubscribersByQuery(query, listIDs)
+	case models.SubscriberJobActionDelete:
+		err = c.DeleteSubscribersByQuery(query, listIDs)
+	case models.SubscriberJobActionSoftDelete:
+		err = c.SoftDeleteSubscribersByQuery(query, listIDs)
+	case models.SubscriberJobActionRestore:
+		err = c.RestoreSubscribersByQuery(query, listIDs)
+	case models.SubscriberJobActionAdd:
+		err = c.AddSubscriptionsByQuery(query, listIDs, targetIDs, j.SubStatus)
+	case models.SubscriberJobActionRemove:
+		err = c.DeleteSubscriptionsByQuery(query, listIDs, targetIDs)
+	case models.SubscriberJobActionUnsubscribe:
+		err = c.UnsubscribeListsByQuery(query, listIDs, targetIDs)
+	case models.SubscriberJobActionTag:
+		err = c.AddSubscriberTagsByQuery(query, listIDs, j.Tags)
+	case models.SubscriberJobActionUntag:
+		err = c.RemoveSubscriberTagsByQuery(query, listIDs, j.Tags)
+	default:
+		err = echo.NewHTTPError(http.StatusBadRequest, c.i18n.T("subscribers.invalidAction"))
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+func int64sToInts(v []int64) []int {
+	out := make([]int, len(v))
+	for i, n := range v {
+		out[i] = int(n)
+	}
+
+	return out
+}
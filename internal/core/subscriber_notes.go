@@ -0,0 +1,73 @@
+package core
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// CreateSubscriberNote records a note on a subscriber.
+func (c *Core) CreateSubscriberNote(subID int, author, note string) (models.SubscriberNote, error) {
+	var out models.SubscriberNote
+	if err := c.q.CreateSubscriberNote.Get(&out, subID, author, note); err != nil {
+		if err == sql.ErrNoRows {
+			return out, echo.NewHTTPError(http.StatusBadRequest,
+				c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.subscriber}"))
+		}
+
+		c.log.Printf("error creating subscriber note: %v", err)
+		return out, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{subscribers.note}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// UpdateSubscriberNote updates the text of a subscriber's note.
+func (c *Core) UpdateSubscriberNote(subID, id int, note string) (models.SubscriberNote, error) {
+	var out models.SubscriberNote
+	if err := c.q.UpdateSubscriberNote.Get(&out, subID, id, note); err != nil {
+		if err == sql.ErrNoRows {
+			return out, echo.NewHTTPError(http.StatusBadRequest,
+				c.i18n.Ts("globals.messages.notFound", "name", "{subscribers.note}"))
+		}
+
+		c.log.Printf("error updating subscriber note: %v", err)
+		return out, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{subscribers.note}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// DeleteSubscriberNote deletes a subscriber's note.
+func (c *Core) DeleteSubscriberNote(subID, id int) error {
+	if _, err := c.q.DeleteSubscriberNote.Exec(subID, id); err != nil {
+		c.log.Printf("error deleting subscriber note: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{subscribers.note}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// QuerySubscriberNotes retrieves the notes of a subscriber, or of all
+// subscribers if subID is 0, optionally filtered by an (ILIKE) pattern,
+// latest first.
+func (c *Core) QuerySubscriberNotes(subID int, query string, offset, limit int) ([]models.SubscriberNote, int, error) {
+	out := []models.SubscriberNote{}
+	if err := c.q.QuerySubscriberNotes.Select(&out, subID, query, offset, limit); err != nil {
+		c.log.Printf("error fetching subscriber notes: %v", err)
+		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{subscribers.notes}", "error", pqErrMsg(err)))
+	}
+
+	total := 0
+	if len(out) > 0 {
+		total = out[0].Total
+	}
+
+	return out, total, nil
+}
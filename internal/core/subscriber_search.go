@@ -0,0 +1,35 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ReindexSubscriberSearch recomputes the search text of the subscribers with
+// IDs in the range (fromID, toID] and returns the number of them.
+func (c *Core) ReindexSubscriberSearch(fromID, toID int) (int, error) {
+	res, err := c.q.ReindexSubscriberSearch.Exec(fromID, toID)
+	if err != nil {
+		c.log.Printf("error reindexing subscriber search: %v", err)
+		return 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+// SetSubscriberSearchIndexed records the attributes that the subscriber
+// search text has been computed with.
+func (c *Core) SetSubscriberSearchIndexed(attribs []string) error {
+	b, _ := json.Marshal(attribs)
+	if _, err := c.q.SetSubscriberSearchIndexed.Exec(b); err != nil {
+		c.log.Printf("error updating subscriber search index: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.settings}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
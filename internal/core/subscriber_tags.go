@@ -0,0 +1,102 @@
+package core
+
+import (
+	"net/http"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+// GetSubscriberTags returns all the tags on subscribers with the number of
+// subscribers that have each.
+func (c *Core) GetSubscriberTags() ([]models.SubscriberTag, error) {
+	out := []models.SubscriberTag{}
+	if err := c.q.GetSubscriberTags.Select(&out); err != nil {
+		c.log.Printf("error fetching subscriber tags: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.tags}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// RenameSubscriberTag renames a tag on all subscribers and in the campaigns
+// that are sent to it. If a subscriber already has the new tag, the two are merged.
+func (c *Core) RenameSubscriberTag(tag, name string) error {
+	if _, err := c.q.RenameSubscriberTag.Exec(tag, name); err != nil {
+		c.log.Printf("error renaming subscriber tag: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.tags}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// DeleteSubscriberTag removes a tag from all subscribers and the campaigns
+// that are sent to it.
+func (c *Core) DeleteSubscriberTag(tag string) error {
+	if _, err := c.q.DeleteSubscriberTag.Exec(tag); err != nil {
+		c.log.Printf("error deleting subscriber tag: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.tags}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// AddSubscriberTags adds tags to the given subscribers.
+func (c *Core) AddSubscriberTags(subIDs []int, tags []string) error {
+	if _, err := c.q.AddSubscriberTags.Exec(pq.Array(subIDs), pq.StringArray(tags)); err != nil {
+		c.log.Printf("error adding subscriber tags: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// RemoveSubscriberTags removes tags from the given subscribers.
+func (c *Core) RemoveSubscriberTags(subIDs []int, tags []string) error {
+	if _, err := c.q.RemoveSubscriberTags.Exec(pq.Array(subIDs), pq.StringArray(tags)); err != nil {
+		c.log.Printf("error removing subscriber tags: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// AddSubscriberTagsByQuery adds tags to subscribers by a given arbitrary query expression.
+// sourceListIDs is the list of list IDs to filter the subscriber query with.
+func (c *Core) AddSubscriberTagsByQuery(query string, sourceListIDs []int, tags []string) error {
+	if sourceListIDs == nil {
+		sourceListIDs = []int{}
+	}
+
+	err := c.q.ExecSubQueryTpl(subQueryExp(query, false), c.q.AddSubscriberTagsByQuery, sourceListIDs, c.db, pq.StringArray(tags))
+	if err != nil {
+		c.log.Printf("error adding subscriber tags by query: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// RemoveSubscriberTagsByQuery removes tags from subscribers by a given arbitrary query expression.
+// sourceListIDs is the list of list IDs to filter the subscriber query with.
+func (c *Core) RemoveSubscriberTagsByQuery(query string, sourceListIDs []int, tags []string) error {
+	if sourceListIDs == nil {
+		sourceListIDs = []int{}
+	}
+
+	err := c.q.ExecSubQueryTpl(subQueryExp(query, false), c.q.RemoveSubscriberTagsByQuery, sourceListIDs, c.db, pq.StringArray(tags))
+	if err != nil {
+		c.log.Printf("error removing subscriber tags by query: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
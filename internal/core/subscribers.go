@@ -14,15 +14,27 @@ import (
 	"github.com/lib/pq"
 )
 
+// Period after which a pending subscriber e-mail change can no longer be confirmed.
+const subEmailChangeExpiry = "2 days"
+
 // GetSubscriber fetches a subscriber by one of the given params.
 func (c *Core) GetSubscriber(id int, uuid, email string) (models.Subscriber, error) {
+	return c.getSubscriber(id, uuid, email, "")
+}
+
+// GetSubscriberByExternalID fetches a subscriber by their external ID.
+func (c *Core) GetSubscriberByExternalID(extID string) (models.Subscriber, error) {
+	return c.getSubscriber(0, "", "", extID)
+}
+
+func (c *Core) getSubscriber(id int, uuid, email, extID string) (models.Subscriber, error) {
 	var uu interface{}
 	if uuid != "" {
 		uu = uuid
 	}
 
 	var out models.Subscribers
-	if err := c.q.GetSubscriber.Select(&out, id, uu, email); err != nil {
+	if err := c.q.GetSubscriber.Select(&out, id, uu, email, extID); err != nil {
 		c.log.Printf("error fetching subscriber: %v", err)
 		return models.Subscriber{}, echo.NewHTTPError(http.StatusInternalServerError,
 			c.i18n.Ts("globals.messages.errorFetching",
@@ -31,7 +43,7 @@ func (c *Core) GetSubscriber(id int, uuid, email string) (models.Subscriber, err
 	if len(out) == 0 {
 		return models.Subscriber{}, echo.NewHTTPError(http.StatusBadRequest,
 			c.i18n.Ts("globals.messages.notFound", "name",
-				fmt.Sprintf("{globals.terms.subscriber} (%d: %s%s)", id, uuid, email)))
+				fmt.Sprintf("{globals.terms.subscriber} (%d: %s%s%s)", id, uuid, email, extID)))
 	}
 	if err := out.LoadLists(c.q.GetSubscriberListsLazy); err != nil {
 		c.log.Printf("error loading subscriber lists: %v", err)
@@ -43,6 +55,36 @@ func (c *Core) GetSubscriber(id int, uuid, email string) (models.Subscriber, err
 	return out[0], nil
 }
 
+// LoadSubscriberEngagement loads the engagement of the given subscribers
+// across all campaigns.
+func (c *Core) LoadSubscriberEngagement(subs models.Subscribers) error {
+	if err := subs.LoadEngagement(c.q.GetSubscriberEngagement); err != nil {
+		c.log.Printf("error loading subscriber engagement: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching",
+				"name", "{globals.terms.subscriber}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// QuerySubscriberCampaigns returns the campaigns that were sent to a subscriber, latest first.
+func (c *Core) QuerySubscriberCampaigns(subID, offset, limit int) ([]models.SubscriberCampaign, int, error) {
+	out := []models.SubscriberCampaign{}
+	if err := c.q.QuerySubscriberCampaigns.Select(&out, subID, offset, limit); err != nil {
+		c.log.Printf("error fetching subscriber campaigns: %v", err)
+		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.campaigns}", "error", pqErrMsg(err)))
+	}
+
+	total := 0
+	if len(out) > 0 {
+		total = out[0].Total
+	}
+
+	return out, total, nil
+}
+
 // GetSubscribersByEmail fetches a subscriber by one of the given params.
 func (c *Core) GetSubscribersByEmail(emails []string) (models.Subscribers, error) {
 	var out models.Subscribers
@@ -66,12 +108,9 @@ func (c *Core) GetSubscribersByEmail(emails []string) (models.Subscribers, error
 }
 
 // QuerySubscribers queries and returns paginated subscrribers based on the given params including the total count.
-func (c *Core) QuerySubscribers(query string, listIDs []int, subStatus string, order, orderBy string, offset, limit int) (models.Subscribers, int, error) {
+func (c *Core) QuerySubscribers(query string, listIDs []int, subStatus string, deleted bool, order, orderBy string, offset, limit int) (models.Subscribers, int, error) {
 	// There's an arbitrary query condition.
-	cond := ""
-	if query != "" {
-		cond = " AND " + query
-	}
+	cond := " AND " + subQueryExp(query, deleted)
 
 	// Sort params.
 	if !strSliceContains(orderBy, subQuerySortFields) {
@@ -88,7 +127,7 @@ func (c *Core) QuerySubscribers(query string, listIDs []int, subStatus string, o
 
 	// Create a readonly transaction that just does COUNT() to obtain the count of results
 	// and to ensure that the arbitrary query is indeed readonly.
-	total, err := c.getSubscriberCount(cond, subStatus, listIDs)
+	total, err := c.getSubscriberCount(query, deleted, subStatus, listIDs)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -126,6 +165,50 @@ func (c *Core) QuerySubscribers(query string, listIDs []int, subStatus string, o
 	return out, total, nil
 }
 
+// SampleSubscribers returns a random sample of num subscribers that match an arbitrary
+// SQL expression, and the total number of matches. The sample is repeatable for a seed.
+func (c *Core) SampleSubscribers(query string, listIDs []int, subStatus string, num int, seed string) (models.Subscribers, int, error) {
+	cond := " AND " + subQueryExp(query, false)
+
+	// Required for pq.Array()
+	if listIDs == nil {
+		listIDs = []int{}
+	}
+
+	// Count the matches, which also ensures that the arbitrary query is readonly.
+	total, err := c.getSubscriberCount(query, false, subStatus, listIDs)
+	if err != nil {
+		return nil, 0, err
+	}
+	if total == 0 {
+		return models.Subscribers{}, 0, nil
+	}
+
+	tx, err := c.db.BeginTxx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		c.log.Printf("error preparing subscriber query: %v", err)
+		return nil, 0, echo.NewHTTPError(http.StatusBadRequest, c.i18n.Ts("subscribers.errorPreparingQuery", "error", pqErrMsg(err)))
+	}
+	defer tx.Rollback()
+
+	var (
+		out  models.Subscribers
+		stmt = strings.ReplaceAll(c.q.SampleSubscribers, "%query%", cond)
+	)
+	if err := tx.Select(&out, stmt, pq.Array(listIDs), subStatus, seed, num); err != nil {
+		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	if err := out.LoadLists(c.q.GetSubscriberListsLazy); err != nil {
+		c.log.Printf("error fetching subscriber lists: %v", err)
+		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	return out, total, nil
+}
+
 // GetSubscriberLists returns a subscriber's lists based on the given conditions.
 func (c *Core) GetSubscriberLists(subID int, uuid string, listIDs []int, listUUIDs []string, subStatus string, listType string) ([]models.List, error) {
 	if listIDs == nil {
@@ -175,18 +258,16 @@ func (c *Core) GetSubscriberProfileForExport(id int, uuid string) (models.Subscr
 // on the given criteria in an exportable form. The iterator function returned can be called
 // repeatedly until there are nil subscribers. It's an iterator because exports can be extremely
 // large and may have to be fetched in batches from the DB and streamed somewhere.
-func (c *Core) ExportSubscribers(query string, subIDs, listIDs []int, batchSize int) (func() ([]models.SubscriberExport, error), error) {
+// The values of the attributes attribKeys are returned in AttribValues in the same order.
+func (c *Core) ExportSubscribers(query string, subIDs, listIDs []int, attribKeys []string, batchSize int) (func() ([]models.SubscriberExport, error), error) {
 	// There's an arbitrary query condition.
-	cond := ""
-	if query != "" {
-		cond = " AND " + query
-	}
+	cond := " AND " + subQueryExp(query, false)
 
 	stmt := fmt.Sprintf(c.q.QuerySubscribersForExport, cond)
 	stmt = strings.ReplaceAll(c.q.QuerySubscribersForExport, "%query%", cond)
 
 	// Verify that the arbitrary SQL search expression is read only.
-	if cond != "" {
+	if query != "" {
 		tx, err := c.db.Unsafe().BeginTxx(context.Background(), &sql.TxOptions{ReadOnly: true})
 		if err != nil {
 			c.log.Printf("error preparing subscriber query: %v", err)
@@ -195,7 +276,7 @@ func (c *Core) ExportSubscribers(query string, subIDs, listIDs []int, batchSize
 		}
 		defer tx.Rollback()
 
-		if _, err := tx.Query(stmt, nil, 0, nil, 1); err != nil {
+		if _, err := tx.Query(stmt, nil, 0, nil, 1, nil); err != nil {
 			return nil, echo.NewHTTPError(http.StatusBadRequest,
 				c.i18n.Ts("subscribers.errorPreparingQuery", "error", pqErrMsg(err)))
 		}
@@ -207,6 +288,9 @@ func (c *Core) ExportSubscribers(query string, subIDs, listIDs []int, batchSize
 	if listIDs == nil {
 		listIDs = []int{}
 	}
+	if attribKeys == nil {
+		attribKeys = []string{}
+	}
 
 	// Prepare the actual query statement.
 	tx, err := c.db.Preparex(stmt)
@@ -219,12 +303,13 @@ func (c *Core) ExportSubscribers(query string, subIDs, listIDs []int, batchSize
 	id := 0
 	return func() ([]models.SubscriberExport, error) {
 		var out []models.SubscriberExport
-		if err := tx.Select(&out, pq.Array(listIDs), id, pq.Array(subIDs), batchSize); err != nil {
+		if err := tx.Select(&out, pq.Array(listIDs), id, pq.Array(subIDs), batchSize, pq.StringArray(attribKeys)); err != nil {
 			c.log.Printf("error exporting subscribers by query: %v", err)
 			return nil, echo.NewHTTPError(http.StatusInternalServerError,
 				c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
 		}
 		if len(out) == 0 {
+			tx.Close()
 			return nil, nil
 		}
 
@@ -261,6 +346,13 @@ func (c *Core) InsertSubscriber(sub models.Subscriber, listIDs []int, listUUIDs
 		listUUIDs = []string{}
 	}
 
+	// The e-mail is a verified alternate e-mail of an existing subscriber.
+	if id, err := c.GetSubscriberEmailOwner(sub.Email); err != nil {
+		return models.Subscriber{}, false, err
+	} else if id > 0 {
+		return models.Subscriber{}, false, echo.NewHTTPError(http.StatusConflict, c.i18n.T("subscribers.emailExists"))
+	}
+
 	if err = c.q.InsertSubscriber.Get(&sub.ID,
 		sub.UUID,
 		sub.Email,
@@ -269,9 +361,21 @@ func (c *Core) InsertSubscriber(sub models.Subscriber, listIDs []int, listUUIDs
 		sub.Attribs,
 		pq.Array(listIDs),
 		pq.Array(listUUIDs),
-		subStatus); err != nil {
-		if pqErr, ok := err.(*pq.Error); ok && pqErr.Constraint == "subscribers_email_key" {
+		subStatus,
+		sub.Tags,
+		sub.Channels,
+		sub.ExternalID.String,
+		sub.Locale,
+		sub.Timezone); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && (pqErr.Constraint == "subscribers_email_key" || pqErr.Constraint == "idx_subs_email") {
+			// The e-mail is taken by a subscriber in the trash, who isn't visible otherwise.
+			var id int
+			if err := c.q.GetDeletedSubscriber.Get(&id, sub.Email); err == nil && id > 0 {
+				return models.Subscriber{}, false, echo.NewHTTPError(http.StatusConflict, c.i18n.T("subscribers.emailDeleted"))
+			}
 			return models.Subscriber{}, false, echo.NewHTTPError(http.StatusConflict, c.i18n.T("subscribers.emailExists"))
+		} else if ok && pqErr.Constraint == "subscribers_external_id_key" {
+			return models.Subscriber{}, false, echo.NewHTTPError(http.StatusConflict, c.i18n.T("subscribers.externalIDExists"))
 		} else {
 			// return sub.Subscriber, errSubscriberExists
 			c.log.Printf("error inserting subscriber: %v", err)
@@ -286,6 +390,10 @@ func (c *Core) InsertSubscriber(sub models.Subscriber, listIDs []int, listUUIDs
 	if err != nil {
 		return models.Subscriber{}, false, err
 	}
+	if sub.ID > 0 {
+		c.fireSubscriberEvent(EventSubscriberCreated, out.ID, "", "", "")
+		c.runAttribTriggers(nil, out)
+	}
 
 	hasOptin := false
 	if !preconfirm && c.consts.SendOptinConfirmation {
@@ -311,13 +419,23 @@ func (c *Core) UpdateSubscriber(id int, sub models.Subscriber) (models.Subscribe
 		}
 	}
 
+	before, hasTriggers := c.getAttribsForTriggers(id)
+
 	_, err := c.q.UpdateSubscriber.Exec(id,
 		sub.Email,
 		strings.TrimSpace(sub.Name),
 		sub.Status,
 		json.RawMessage(attribs),
+		sub.Tags,
+		sub.Channels,
+		sub.ExternalID.String,
+		sub.Locale,
+		sub.Timezone,
 	)
 	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Constraint == "subscribers_external_id_key" {
+			return models.Subscriber{}, echo.NewHTTPError(http.StatusConflict, c.i18n.T("subscribers.externalIDExists"))
+		}
 		c.log.Printf("error updating subscriber: %v", err)
 		return models.Subscriber{}, echo.NewHTTPError(http.StatusInternalServerError,
 			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscriber}", "error", pqErrMsg(err)))
@@ -327,6 +445,10 @@ func (c *Core) UpdateSubscriber(id int, sub models.Subscriber) (models.Subscribe
 	if err != nil {
 		return models.Subscriber{}, err
 	}
+	c.fireSubscriberEvent(EventSubscriberUpdated, out.ID, "", "", "")
+	if hasTriggers {
+		c.runAttribTriggers(before, out)
+	}
 
 	return out, nil
 }
@@ -352,6 +474,8 @@ func (c *Core) UpdateSubscriberWithLists(id int, sub models.Subscriber, listIDs
 		}
 	}
 
+	before, hasTriggers := c.getAttribsForTriggers(id)
+
 	_, err := c.q.UpdateSubscriberWithLists.Exec(id,
 		sub.Email,
 		strings.TrimSpace(sub.Name),
@@ -360,8 +484,16 @@ func (c *Core) UpdateSubscriberWithLists(id int, sub models.Subscriber, listIDs
 		pq.Array(listIDs),
 		pq.Array(listUUIDs),
 		subStatus,
-		deleteLists)
+		deleteLists,
+		sub.Tags,
+		sub.Channels,
+		sub.ExternalID.String,
+		sub.Locale,
+		sub.Timezone)
 	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Constraint == "subscribers_external_id_key" {
+			return models.Subscriber{}, false, echo.NewHTTPError(http.StatusConflict, c.i18n.T("subscribers.externalIDExists"))
+		}
 		c.log.Printf("error updating subscriber: %v", err)
 		return models.Subscriber{}, false, echo.NewHTTPError(http.StatusInternalServerError,
 			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscriber}", "error", pqErrMsg(err)))
@@ -371,6 +503,10 @@ func (c *Core) UpdateSubscriberWithLists(id int, sub models.Subscriber, listIDs
 	if err != nil {
 		return models.Subscriber{}, false, err
 	}
+	c.fireSubscriberEvent(EventSubscriberUpdated, out.ID, "", "", "")
+	if hasTriggers {
+		c.runAttribTriggers(before, out)
+	}
 
 	hasOptin := false
 	if !preconfirm && c.consts.SendOptinConfirmation {
@@ -382,6 +518,44 @@ func (c *Core) UpdateSubscriberWithLists(id int, sub models.Subscriber, listIDs
 	return out, hasOptin, nil
 }
 
+// ResubscribeSubscriber subscribes an existing subscriber to the given lists
+// again, retaining their record and its history. The lists that they had
+// unsubscribed from are only rejoined once they confirm with the opt-in
+// confirmation, which is sent for them whatever the lists' opt-in is.
+// Blocklisted subscribers can't be resubscribed.
+func (c *Core) ResubscribeSubscriber(sub models.Subscriber, listIDs []int, listUUIDs []string) (bool, error) {
+	if sub.Status == models.SubscriberStatusBlockListed {
+		return false, echo.NewHTTPError(http.StatusBadRequest, c.i18n.T("subscribers.errorResubscribeBlocklisted"))
+	}
+
+	// For pq.Array()
+	if listIDs == nil {
+		listIDs = []int{}
+	}
+	if listUUIDs == nil {
+		listUUIDs = []string{}
+	}
+
+	var ids []int
+	if err := c.q.ResubscribeSubscriber.Select(&ids, sub.ID, pq.Array(listIDs), pq.Array(listUUIDs)); err != nil {
+		c.log.Printf("error resubscribing subscriber: %v", err)
+		return false, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscriber}", "error", pqErrMsg(err)))
+	}
+	if len(ids) == 0 {
+		return false, nil
+	}
+	c.fireSubscriberEvent(EventSubscriberUpdated, sub.ID, "", "", "")
+
+	hasOptin := false
+	if c.consts.SendOptinConfirmation {
+		num, _ := c.h.SendOptinConfirmation(sub, ids)
+		hasOptin = num > 0
+	}
+
+	return hasOptin, nil
+}
+
 // BlocklistSubscribers blocklists the given list of subscribers.
 func (c *Core) BlocklistSubscribers(subIDs []int) error {
 	if _, err := c.q.BlocklistSubscribers.Exec(pq.Array(subIDs)); err != nil {
@@ -390,12 +564,16 @@ func (c *Core) BlocklistSubscribers(subIDs []int) error {
 			c.i18n.Ts("subscribers.errorBlocklisting", "error", err.Error()))
 	}
 
+	for _, id := range subIDs {
+		c.fireSubscriberEvent(EventSubscriberBlocklisted, id, "", "", "")
+	}
+
 	return nil
 }
 
 // BlocklistSubscribersByQuery blocklists the given list of subscribers.
 func (c *Core) BlocklistSubscribersByQuery(query string, listIDs []int) error {
-	if err := c.q.ExecSubQueryTpl(sanitizeSQLExp(query), c.q.BlocklistSubscribersByQuery, listIDs, c.db); err != nil {
+	if err := c.q.ExecSubQueryTpl(subQueryExp(query, false), c.q.BlocklistSubscribersByQuery, listIDs, c.db); err != nil {
 		c.log.Printf("error blocklisting subscribers: %v", err)
 		return echo.NewHTTPError(http.StatusInternalServerError,
 			c.i18n.Ts("subscribers.errorBlocklisting", "error", pqErrMsg(err)))
@@ -422,9 +600,224 @@ func (c *Core) DeleteSubscribers(subIDs []int, subUUIDs []string) error {
 	return nil
 }
 
+// SoftDeleteSubscribers soft-deletes the given subscribers so that they can be
+// restored until they're purged. Subscribers that are already soft-deleted are
+// deleted permanently.
+func (c *Core) SoftDeleteSubscribers(subIDs []int) error {
+	if _, err := c.q.SoftDeleteSubscribers.Exec(pq.Array(subIDs)); err != nil {
+		c.log.Printf("error soft-deleting subscribers: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// RestoreSubscribers restores the given soft-deleted subscribers.
+func (c *Core) RestoreSubscribers(subIDs []int) error {
+	if _, err := c.q.RestoreSubscribers.Exec(pq.Array(subIDs)); err != nil {
+		c.log.Printf("error restoring subscribers: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// PurgeDeletedSubscribers permanently deletes the subscribers that were
+// soft-deleted more than the given number of days ago.
+func (c *Core) PurgeDeletedSubscribers(days int) (int, error) {
+	res, err := c.q.PurgeDeletedSubscribers.Exec(days)
+	if err != nil {
+		c.log.Printf("error purging deleted subscribers: %v", err)
+		return 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+// PurgeDeletedSubscriberByEmail permanently deletes the soft-deleted subscriber
+// with the given e-mail, if there's one, freeing up the e-mail.
+func (c *Core) PurgeDeletedSubscriberByEmail(email string) error {
+	if _, err := c.q.PurgeDeletedSubscriberByEmail.Exec(email); err != nil {
+		c.log.Printf("error purging deleted subscriber: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.subscriber}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// EraseSubscriber irreversibly anonymizes a subscriber, unlinking their campaign
+// views, link clicks, and deliveries, and returns the audit record of the erasure.
+func (c *Core) EraseSubscriber(id int, reason, erasedBy string) (models.SubscriberErasure, error) {
+	uu, err := uuid.NewV4()
+	if err != nil {
+		c.log.Printf("error generating UUID: %v", err)
+		return models.SubscriberErasure{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUUID", "error", err.Error()))
+	}
+
+	var out models.SubscriberErasure
+	if err := c.q.EraseSubscriber.Get(&out, id, uu.String(), reason, erasedBy); err != nil {
+		if err == sql.ErrNoRows {
+			return out, echo.NewHTTPError(http.StatusNotFound,
+				c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.subscriber}"))
+		}
+
+		c.log.Printf("error erasing subscriber: %v", err)
+		return out, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.subscriber}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// QuerySubscriberErasures returns the audit records of subscriber erasures.
+func (c *Core) QuerySubscriberErasures(offset, limit int) ([]models.SubscriberErasure, int, error) {
+	out := []models.SubscriberErasure{}
+	if err := c.q.QuerySubscriberErasures.Select(&out, offset, limit); err != nil {
+		c.log.Printf("error fetching subscriber erasures: %v", err)
+		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	total := 0
+	if len(out) > 0 {
+		total = out[0].Total
+	}
+
+	return out, total, nil
+}
+
+// MergeSubscribers merges the given subscribers into the target subscriber,
+// consolidating their subscriptions, attribs, and engagement history, deletes
+// them, and returns the merged subscriber.
+func (c *Core) MergeSubscribers(targetID int, subIDs []int) (models.Subscriber, error) {
+	var id int
+	if err := c.q.MergeSubscribers.Get(&id, targetID, pq.Array(subIDs)); err != nil {
+		if err == sql.ErrNoRows {
+			return models.Subscriber{}, echo.NewHTTPError(http.StatusBadRequest,
+				c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.subscriber}"))
+		}
+
+		c.log.Printf("error merging subscribers: %v", err)
+		return models.Subscriber{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("subscribers.errorMerging", "error", pqErrMsg(err)))
+	}
+
+	return c.GetSubscriber(id, "", "")
+}
+
+// ChangeSubscriberEmail records a pending change of a subscriber's e-mail,
+// replacing any earlier one, and returns it with the token that confirms it.
+func (c *Core) ChangeSubscriberEmail(subID int, email string) (models.SubscriberEmailChange, error) {
+	uu, err := uuid.NewV4()
+	if err != nil {
+		c.log.Printf("error generating UUID: %v", err)
+		return models.SubscriberEmailChange{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUUID", "error", err.Error()))
+	}
+
+	var out models.SubscriberEmailChange
+	if err := c.q.CreateSubscriberEmailChange.Get(&out, subID, email, uu.String()); err != nil {
+		// The e-mail belongs to another subscriber.
+		if err == sql.ErrNoRows {
+			return out, echo.NewHTTPError(http.StatusConflict, c.i18n.T("subscribers.emailExists"))
+		}
+
+		c.log.Printf("error creating subscriber e-mail change: %v", err)
+		return out, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscriber}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// GetSubscriberEmailChange returns the pending e-mail change of a subscriber,
+// or the one with the given token, if there's one that hasn't expired.
+func (c *Core) GetSubscriberEmailChange(subID int, token string) (models.SubscriberEmailChange, bool, error) {
+	var tk interface{}
+	if token != "" {
+		tk = token
+	}
+
+	var out models.SubscriberEmailChange
+	if err := c.q.GetSubscriberEmailChange.Get(&out, subID, tk, subEmailChangeExpiry); err != nil {
+		if err == sql.ErrNoRows {
+			return out, false, nil
+		}
+
+		c.log.Printf("error fetching subscriber e-mail change: %v", err)
+		return out, false, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.subscriber}", "error", pqErrMsg(err)))
+	}
+
+	return out, true, nil
+}
+
+// ConfirmSubscriberEmailChange applies the pending e-mail change with the given
+// token and returns the subscriber, who retains their UUID and history.
+func (c *Core) ConfirmSubscriberEmailChange(token string) (models.Subscriber, error) {
+	var id int
+	if err := c.q.ConfirmSubscriberEmailChange.Get(&id, token, subEmailChangeExpiry); err != nil {
+		if err == sql.ErrNoRows {
+			return models.Subscriber{}, echo.NewHTTPError(http.StatusBadRequest, c.i18n.T("public.emailChangeExpired"))
+		}
+
+		// The e-mail was taken by another subscriber in the meantime.
+		if pqErr, ok := err.(*pq.Error); ok && (pqErr.Constraint == "subscribers_email_key" || pqErr.Constraint == "idx_subs_email") {
+			return models.Subscriber{}, echo.NewHTTPError(http.StatusConflict, c.i18n.T("subscribers.emailExists"))
+		}
+
+		c.log.Printf("error confirming subscriber e-mail change: %v", err)
+		return models.Subscriber{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscriber}", "error", pqErrMsg(err)))
+	}
+	c.fireSubscriberEvent(EventSubscriberUpdated, id, "", "", "")
+
+	return c.GetSubscriber(id, "", "")
+}
+
+// DeleteSubscriberEmailChange cancels the pending e-mail change of a subscriber.
+func (c *Core) DeleteSubscriberEmailChange(subID int) error {
+	if _, err := c.q.DeleteSubscriberEmailChange.Exec(subID); err != nil {
+		c.log.Printf("error deleting subscriber e-mail change: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.subscriber}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// QuerySubscriberDuplicates returns groups of likely duplicate subscribers that
+// share a normalized e-mail, or a name if byName is set.
+func (c *Core) QuerySubscriberDuplicates(byName bool, offset, limit int) ([]models.SubscriberDuplicate, int, error) {
+	by := "email"
+	if byName {
+		by = "name"
+	}
+
+	out := []models.SubscriberDuplicate{}
+	if err := c.q.QuerySubscriberDuplicates.Select(&out, by, offset, limit); err != nil {
+		c.log.Printf("error fetching duplicate subscribers: %v", err)
+		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	total := 0
+	if len(out) > 0 {
+		total = out[0].Total
+	}
+
+	return out, total, nil
+}
+
 // DeleteSubscribersByQuery deletes subscribers by a given arbitrary query expression.
 func (c *Core) DeleteSubscribersByQuery(query string, listIDs []int) error {
-	err := c.q.ExecSubQueryTpl(sanitizeSQLExp(query), c.q.DeleteSubscribersByQuery, listIDs, c.db)
+	err := c.q.ExecSubQueryTpl(subQueryExp(query, false), c.q.DeleteSubscribersByQuery, listIDs, c.db)
 	if err != nil {
 		c.log.Printf("error deleting subscribers: %v", err)
 		return echo.NewHTTPError(http.StatusInternalServerError,
@@ -434,6 +827,31 @@ func (c *Core) DeleteSubscribersByQuery(query string, listIDs []int) error {
 	return err
 }
 
+// SoftDeleteSubscribersByQuery soft-deletes subscribers by a given arbitrary query expression.
+func (c *Core) SoftDeleteSubscribersByQuery(query string, listIDs []int) error {
+	err := c.q.ExecSubQueryTpl(subQueryExp(query, false), c.q.SoftDeleteSubscribersByQuery, listIDs, c.db)
+	if err != nil {
+		c.log.Printf("error soft-deleting subscribers: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// RestoreSubscribersByQuery restores the soft-deleted subscribers that match a given
+// arbitrary query expression.
+func (c *Core) RestoreSubscribersByQuery(query string, listIDs []int) error {
+	err := c.q.ExecSubQueryTpl(subQueryExp(query, true), c.q.RestoreSubscribersByQuery, listIDs, c.db)
+	if err != nil {
+		c.log.Printf("error restoring subscribers: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
 // UnsubscribeByCampaign unsubscribes a given subscriber from lists in a given campaign.
 func (c *Core) UnsubscribeByCampaign(subUUID, campUUID string, blocklist bool) error {
 	if _, err := c.q.UnsubscribeByCampaign.Exec(campUUID, subUUID, blocklist); err != nil {
@@ -442,6 +860,12 @@ func (c *Core) UnsubscribeByCampaign(subUUID, campUUID string, blocklist bool) e
 			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
 	}
 
+	if blocklist {
+		c.fireSubscriberEvent(EventSubscriberBlocklisted, 0, subUUID, "", "")
+	} else {
+		c.fireSubscriberEvent(EventSubscriberUnsubscribed, 0, subUUID, "", "")
+	}
+
 	return nil
 }
 
@@ -456,6 +880,7 @@ func (c *Core) ConfirmOptionSubscription(subUUID string, listUUIDs []string, met
 		return echo.NewHTTPError(http.StatusInternalServerError,
 			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
 	}
+	c.fireSubscriberEvent(EventSubscriberConfirmed, 0, subUUID, "", "")
 
 	return nil
 }
@@ -502,9 +927,64 @@ func (c *Core) DeleteBlocklistedSubscribers() (int, error) {
 	return int(n), nil
 }
 
-func (c *Core) getSubscriberCount(cond, subStatus string, listIDs []int) (int, error) {
+// ExplainSubscriberQuery validates an arbitrary subscriber query expression
+// and returns the query planner's estimate of matching subscribers and the
+// cost of the query. Invalid expressions are reported in the result.
+func (c *Core) ExplainSubscriberQuery(query string, listIDs []int, subStatus string) (models.SubscriberQueryPlan, error) {
+	if err := ValidateSQLExp(query); err != nil {
+		return models.SubscriberQueryPlan{Error: err.Error()}, nil
+	}
+
+	// Required for pq.Array()
+	if listIDs == nil {
+		listIDs = []int{}
+	}
+
+	cond := " AND " + subQueryExp(query, false)
+
+	tx, err := c.db.BeginTxx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		c.log.Printf("error preparing subscriber query: %v", err)
+		return models.SubscriberQueryPlan{}, echo.NewHTTPError(http.StatusBadRequest, c.i18n.Ts("subscribers.errorPreparingQuery", "error", pqErrMsg(err)))
+	}
+	defer tx.Rollback()
+
+	// EXPLAIN plans the query without running it.
+	var b []byte
+	if err := tx.Get(&b, "EXPLAIN (FORMAT JSON) "+fmt.Sprintf(c.q.QuerySubscribersCount, cond), pq.Array(listIDs), subStatus); err != nil {
+		return models.SubscriberQueryPlan{Error: pqErrMsg(err)}, nil
+	}
+
+	type plan struct {
+		Rows  float64 `json:"Plan Rows"`
+		Cost  float64 `json:"Total Cost"`
+		Plans []plan  `json:"Plans"`
+	}
+	var res []struct {
+		Plan plan `json:"Plan"`
+	}
+	if err := json.Unmarshal(b, &res); err != nil || len(res) == 0 {
+		c.log.Printf("error parsing subscriber query plan: %v", err)
+		return models.SubscriberQueryPlan{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("subscribers.errorPreparingQuery", "error", "invalid query plan"))
+	}
+
+	// The top node is the COUNT() aggregate. The rows are estimated by its child.
+	p := res[0].Plan
+	out := models.SubscriberQueryPlan{Valid: true, PlanCost: p.Cost, Count: int(p.Rows)}
+	if len(p.Plans) > 0 {
+		out.Count = int(p.Plans[0].Rows)
+	}
+
+	return out, nil
+}
+
+// getSubscriberCount returns the number of subscribers that match an arbitrary
+// query expression, excluding soft-deleted subscribers, or only counting them
+// if deleted is true.
+func (c *Core) getSubscriberCount(query string, deleted bool, subStatus string, listIDs []int) (int, error) {
 	// If there's no condition, it's a "get all" call which can probably be optionally pulled from cache.
-	if cond == "" {
+	if query == "" && !deleted {
 		_ = c.refreshCache(matListSubStats, false)
 
 		total := 0
@@ -518,7 +998,7 @@ func (c *Core) getSubscriberCount(cond, subStatus string, listIDs []int) (int, e
 
 	// Create a readonly transaction that just does COUNT() to obtain the count of results
 	// and to ensure that the arbitrary query is indeed readonly.
-	stmt := fmt.Sprintf(c.q.QuerySubscribersCount, cond)
+	stmt := fmt.Sprintf(c.q.QuerySubscribersCount, " AND "+subQueryExp(query, deleted))
 	tx, err := c.db.BeginTxx(context.Background(), &sql.TxOptions{ReadOnly: true})
 	if err != nil {
 		c.log.Printf("error preparing subscriber query: %v", err)
@@ -535,3 +1015,18 @@ func (c *Core) getSubscriberCount(cond, subStatus string, listIDs []int) (int, e
 
 	return total, nil
 }
+
+// subQueryExp returns an arbitrary subscriber query expression that excludes
+// soft-deleted subscribers, or only matches them if deleted is true.
+func subQueryExp(query string, deleted bool) string {
+	exp := "subscribers.status != 'deleted'"
+	if deleted {
+		exp = "subscribers.status = 'deleted'"
+	}
+
+	if query = sanitizeSQLExp(query); query != "" {
+		exp += " AND (" + query + ")"
+	}
+
+	return exp
+}
@@ -0,0 +1,113 @@
+package core
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// GetSubscriptionForms retrieves all subscription forms.
+func (c *Core) GetSubscriptionForms() ([]models.SubscriptionForm, error) {
+	out := []models.SubscriptionForm{}
+	if err := c.q.GetSubscriptionForms.Select(&out, 0, ""); err != nil {
+		c.log.Printf("error fetching subscription forms: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.forms}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// GetSubscriptionForm retrieves a given subscription form by its ID or UUID.
+func (c *Core) GetSubscriptionForm(id int, uuid string) (models.SubscriptionForm, error) {
+	var out []models.SubscriptionForm
+	if err := c.q.GetSubscriptionForms.Select(&out, id, uuid); err != nil {
+		c.log.Printf("error fetching subscription form: %v", err)
+		return models.SubscriptionForm{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.form}", "error", pqErrMsg(err)))
+	}
+
+	if len(out) == 0 {
+		return models.SubscriptionForm{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.form}"))
+	}
+
+	return out[0], nil
+}
+
+// CreateSubscriptionForm creates a new subscription form.
+func (c *Core) CreateSubscriptionForm(o models.SubscriptionForm) (models.SubscriptionForm, error) {
+	uu, err := uuid.NewV4()
+	if err != nil {
+		c.log.Printf("error generating UUID: %v", err)
+		return models.SubscriptionForm{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUUID", "error", err.Error()))
+	}
+
+	var newID int
+	if err := c.q.CreateSubscriptionForm.Get(&newID, uu, o.Name, o.Enabled, o.ListIDs, o.ChooseLists, o.Fields,
+		o.Title, o.Description, o.SubmitLabel, o.SuccessMessage, o.RedirectURL, o.Theme); err != nil {
+		c.log.Printf("error creating subscription form: %v", err)
+		return models.SubscriptionForm{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.form}", "error", pqErrMsg(err)))
+	}
+
+	return c.GetSubscriptionForm(newID, "")
+}
+
+// UpdateSubscriptionForm updates a given subscription form.
+func (c *Core) UpdateSubscriptionForm(id int, o models.SubscriptionForm) (models.SubscriptionForm, error) {
+	res, err := c.q.UpdateSubscriptionForm.Exec(id, o.Name, o.Enabled, o.ListIDs, o.ChooseLists, o.Fields,
+		o.Title, o.Description, o.SubmitLabel, o.SuccessMessage, o.RedirectURL, o.Theme)
+	if err != nil {
+		c.log.Printf("error updating subscription form: %v", err)
+		return models.SubscriptionForm{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.form}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return models.SubscriptionForm{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.form}"))
+	}
+
+	return c.GetSubscriptionForm(id, "")
+}
+
+// DeleteSubscriptionForm deletes a given subscription form.
+func (c *Core) DeleteSubscriptionForm(id int) error {
+	if _, err := c.q.DeleteSubscriptionForm.Exec(id); err != nil {
+		c.log.Printf("error deleting subscription form: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.form}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// GetSubscriptionFormStats retrieves the daily views and conversions of a
+// subscription form between the given dates.
+func (c *Core) GetSubscriptionFormStats(id int, from, to time.Time) ([]models.SubscriptionFormStat, error) {
+	out := []models.SubscriptionFormStat{}
+	if err := c.q.GetSubscriptionFormStats.Select(&out, id, from, to); err != nil {
+		c.log.Printf("error fetching subscription form stats: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.form}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// RecordSubscriptionFormStat adds views and conversions to the stats of
+// a subscription form.
+func (c *Core) RecordSubscriptionFormStat(id, views, conversions int) error {
+	if _, err := c.q.RecordSubscriptionFormStat.Exec(id, views, conversions); err != nil {
+		c.log.Printf("error recording subscription form stats: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.form}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
@@ -40,7 +40,7 @@ func (c *Core) AddSubscriptionsByQuery(query string, sourceListIDs, targetListID
 		sourceListIDs = []int{}
 	}
 
-	err := c.q.ExecSubQueryTpl(sanitizeSQLExp(query), c.q.AddSubscribersToListsByQuery, sourceListIDs, c.db, pq.Array(targetListIDs), status)
+	err := c.q.ExecSubQueryTpl(subQueryExp(query, false), c.q.AddSubscribersToListsByQuery, sourceListIDs, c.db, pq.Array(targetListIDs), status)
 	if err != nil {
 		c.log.Printf("error adding subscriptions by query: %v", err)
 		return echo.NewHTTPError(http.StatusInternalServerError,
@@ -69,7 +69,7 @@ func (c *Core) DeleteSubscriptionsByQuery(query string, sourceListIDs, targetLis
 		sourceListIDs = []int{}
 	}
 
-	err := c.q.ExecSubQueryTpl(sanitizeSQLExp(query), c.q.DeleteSubscriptionsByQuery, sourceListIDs, c.db, pq.Array(targetListIDs))
+	err := c.q.ExecSubQueryTpl(subQueryExp(query, false), c.q.DeleteSubscriptionsByQuery, sourceListIDs, c.db, pq.Array(targetListIDs))
 	if err != nil {
 		c.log.Printf("error deleting subscriptions by query: %v", err)
 		return echo.NewHTTPError(http.StatusInternalServerError,
@@ -87,6 +87,10 @@ func (c *Core) UnsubscribeLists(subIDs, listIDs []int, listUUIDs []string) error
 			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscribers}", "error", err.Error()))
 	}
 
+	for _, id := range subIDs {
+		c.fireSubscriberEvent(EventSubscriberUnsubscribed, id, "", "", "")
+	}
+
 	return nil
 }
 
@@ -97,7 +101,7 @@ func (c *Core) UnsubscribeListsByQuery(query string, sourceListIDs, targetListID
 		sourceListIDs = []int{}
 	}
 
-	err := c.q.ExecSubQueryTpl(sanitizeSQLExp(query), c.q.UnsubscribeSubscribersFromListsByQuery, sourceListIDs, c.db, pq.Array(targetListIDs))
+	err := c.q.ExecSubQueryTpl(subQueryExp(query, false), c.q.UnsubscribeSubscribersFromListsByQuery, sourceListIDs, c.db, pq.Array(targetListIDs))
 	if err != nil {
 		c.log.Printf("error unsubscribing from lists by query: %v", err)
 		return echo.NewHTTPError(http.StatusInternalServerError,
@@ -120,3 +124,106 @@ func (c *Core) DeleteUnconfirmedSubscriptions(beforeDate time.Time) (int, error)
 	n, _ := res.RowsAffected()
 	return int(n), nil
 }
+
+// RunSubscriberHygiene applies the list hygiene rules and returns the number of
+// subscriptions and subscribers they were applied to. With dryRun, nothing is
+// changed and the numbers are of those that they would be applied to.
+func (c *Core) RunSubscriberHygiene(r models.HygieneRules, dryRun bool) (models.HygieneResult, error) {
+	var out models.HygieneResult
+	if err := c.q.RunSubscriberHygiene.Get(&out, r.UnconfirmedDays, r.UnengagedMonths, r.BlocklistedDays, dryRun); err != nil {
+		c.log.Printf("error running subscriber hygiene: %v", err)
+		return out, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// MarkSubscriptionsRepermission marks a batch of up to num subscriptions whose
+// list's subscription TTL has lapsed without any activity as pending
+// re-permission, and returns them by subscriber.
+func (c *Core) MarkSubscriptionsRepermission(num int) ([]models.SubscriptionRepermission, error) {
+	var out []models.SubscriptionRepermission
+	if err := c.q.MarkSubscriptionsRepermission.Select(&out, num); err != nil {
+		c.log.Printf("error marking subscriptions for re-permission: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// ClearSubscriptionsRepermission clears the pending re-permission of a
+// subscriber's subscriptions to the given lists.
+func (c *Core) ClearSubscriptionsRepermission(subID int, listIDs []int) error {
+	if _, err := c.q.ClearSubscriptionsRepermission.Exec(subID, pq.Array(listIDs)); err != nil {
+		c.log.Printf("error clearing subscription re-permission: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// RenewSubscriptions renews a subscriber's subscriptions to the given lists,
+// or all the ones that are pending re-permission if no lists are given.
+func (c *Core) RenewSubscriptions(subUUID string, listUUIDs []string) error {
+	if listUUIDs == nil {
+		listUUIDs = []string{}
+	}
+
+	if _, err := c.q.RenewSubscriptions.Exec(subUUID, pq.StringArray(listUUIDs)); err != nil {
+		c.log.Printf("error renewing subscriptions: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// GetDueOptinReminders returns a batch of up to num subscribers' unconfirmed
+// subscriptions that are due an opt-in reminder.
+func (c *Core) GetDueOptinReminders(num int) ([]models.SubscriptionOptinReminder, error) {
+	var out []models.SubscriptionOptinReminder
+	if err := c.q.GetDueOptinReminders.Select(&out, num); err != nil {
+		c.log.Printf("error fetching due opt-in reminders: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// RecordOptinReminders records an opt-in reminder sent to a subscriber for
+// the given lists.
+func (c *Core) RecordOptinReminders(subID int, listIDs []int) error {
+	if _, err := c.q.RecordOptinReminders.Exec(subID, pq.Array(listIDs)); err != nil {
+		c.log.Printf("error recording opt-in reminders: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// ExpireSubscriptions unsubscribes the subscriptions that weren't renewed
+// within their list's grace period after the re-permission e-mail was sent,
+// and returns the number of subscriptions that were unsubscribed.
+func (c *Core) ExpireSubscriptions() (int, error) {
+	var subIDs []int
+	if err := c.q.ExpireSubscriptions.Select(&subIDs); err != nil {
+		c.log.Printf("error expiring subscriptions: %v", err)
+		return 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	seen := make(map[int]bool, len(subIDs))
+	for _, id := range subIDs {
+		if !seen[id] {
+			seen[id] = true
+			c.fireSubscriberEvent(EventSubscriberUnsubscribed, id, "", "", "expired")
+		}
+	}
+
+	return len(subIDs), nil
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/knadh/listmonk/models"
 	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
 )
 
 // GetTemplates retrieves all templates.
@@ -36,9 +37,9 @@ func (c *Core) GetTemplate(id int, noBody bool) (models.Template, error) {
 }
 
 // CreateTemplate creates a new template.
-func (c *Core) CreateTemplate(name, typ, subject string, body []byte) (models.Template, error) {
+func (c *Core) CreateTemplate(name, typ, subject, preheader string, body, bodyAMP, bodyMJML []byte, langVariants models.TemplateLangVariants) (models.Template, error) {
 	var newID int
-	if err := c.q.CreateTemplate.Get(&newID, name, typ, subject, body); err != nil {
+	if err := c.q.CreateTemplate.Get(&newID, name, typ, subject, body, bodyAMP, preheader, bodyMJML, langVariants); err != nil {
 		return models.Template{}, echo.NewHTTPError(http.StatusInternalServerError,
 			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.template}", "error", pqErrMsg(err)))
 	}
@@ -47,19 +48,53 @@ func (c *Core) CreateTemplate(name, typ, subject string, body []byte) (models.Te
 }
 
 // UpdateTemplate updates a given template.
-func (c *Core) UpdateTemplate(id int, name, subject string, body []byte) (models.Template, error) {
-	res, err := c.q.UpdateTemplate.Exec(id, name, subject, body)
-	if err != nil {
+func (c *Core) UpdateTemplate(id int, name, subject, preheader string, body, bodyAMP, bodyMJML []byte, langVariants models.TemplateLangVariants) (models.Template, error) {
+	var tplID int
+	if err := c.q.UpdateTemplate.Get(&tplID, id, name, subject, body, bodyAMP, preheader, bodyMJML, langVariants); err != nil {
+		if err == sql.ErrNoRows {
+			return models.Template{}, echo.NewHTTPError(http.StatusBadRequest,
+				c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.template}"))
+		}
+
 		return models.Template{}, echo.NewHTTPError(http.StatusInternalServerError,
 			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.template}", "error", pqErrMsg(err)))
 	}
 
-	if n, _ := res.RowsAffected(); n == 0 {
-		return models.Template{}, echo.NewHTTPError(http.StatusBadRequest,
-			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.template}"))
+	return c.GetTemplate(id, false)
+}
+
+// GetTemplateRevisions returns the content revisions of a template, latest first.
+func (c *Core) GetTemplateRevisions(tplID int) ([]models.TemplateRevision, error) {
+	out := []models.TemplateRevision{}
+	if err := c.q.GetTemplateRevisions.Select(&out, tplID); err != nil {
+		c.log.Printf("error fetching template revisions: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.template}", "error", pqErrMsg(err)))
 	}
 
-	return c.GetTemplate(id, false)
+	return out, nil
+}
+
+// GetTemplateRevision returns a content revision of a template, or if prev is
+// true, the one before it, in which case, a nil revision is returned if there's
+// none.
+func (c *Core) GetTemplateRevision(tplID int, id int64, prev bool) (*models.TemplateRevision, error) {
+	var out models.TemplateRevision
+	if err := c.q.GetTemplateRevision.Get(&out, tplID, id, prev); err != nil {
+		if err == sql.ErrNoRows {
+			if prev {
+				return nil, nil
+			}
+			return nil, echo.NewHTTPError(http.StatusBadRequest,
+				c.i18n.Ts("globals.messages.notFound", "name", "{campaigns.revision}"))
+		}
+
+		c.log.Printf("error fetching template revision: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{campaigns.revision}", "error", pqErrMsg(err)))
+	}
+
+	return &out, nil
 }
 
 // SetDefaultTemplate sets a template as default.
@@ -85,3 +120,93 @@ func (c *Core) DeleteTemplate(id int) error {
 
 	return nil
 }
+
+// GetTemplatePartials retrieves all template partials.
+func (c *Core) GetTemplatePartials() ([]models.TemplatePartial, error) {
+	out := []models.TemplatePartial{}
+	if err := c.q.GetTemplatePartials.Select(&out, 0); err != nil {
+		c.log.Printf("error fetching template partials: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{templates.partials}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// GetTemplatePartial retrieves a given template partial.
+func (c *Core) GetTemplatePartial(id int) (models.TemplatePartial, error) {
+	var out []models.TemplatePartial
+	if err := c.q.GetTemplatePartials.Select(&out, id); err != nil {
+		c.log.Printf("error fetching template partial: %v", err)
+		return models.TemplatePartial{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{templates.partial}", "error", pqErrMsg(err)))
+	}
+
+	if len(out) == 0 {
+		return models.TemplatePartial{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{templates.partial}"))
+	}
+
+	return out[0], nil
+}
+
+// CreateTemplatePartial creates a new template partial.
+func (c *Core) CreateTemplatePartial(o models.TemplatePartial) (models.TemplatePartial, error) {
+	var newID int
+	if err := c.q.CreateTemplatePartial.Get(&newID, o.Name, o.Body); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Constraint == "template_partials_name_key" {
+			return models.TemplatePartial{}, echo.NewHTTPError(http.StatusConflict, c.i18n.T("templates.partialExists"))
+		}
+
+		c.log.Printf("error creating template partial: %v", err)
+		return models.TemplatePartial{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{templates.partial}", "error", pqErrMsg(err)))
+	}
+
+	return c.GetTemplatePartial(newID)
+}
+
+// UpdateTemplatePartial updates a given template partial.
+func (c *Core) UpdateTemplatePartial(id int, o models.TemplatePartial) (models.TemplatePartial, error) {
+	res, err := c.q.UpdateTemplatePartial.Exec(id, o.Name, o.Body)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Constraint == "template_partials_name_key" {
+			return models.TemplatePartial{}, echo.NewHTTPError(http.StatusConflict, c.i18n.T("templates.partialExists"))
+		}
+
+		c.log.Printf("error updating template partial: %v", err)
+		return models.TemplatePartial{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{templates.partial}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return models.TemplatePartial{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{templates.partial}"))
+	}
+
+	return c.GetTemplatePartial(id)
+}
+
+// DeleteTemplatePartial deletes a given template partial.
+func (c *Core) DeleteTemplatePartial(id int) error {
+	if _, err := c.q.DeleteTemplatePartial.Exec(id); err != nil {
+		c.log.Printf("error deleting template partial: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{templates.partial}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// GetTemplatePartialUsage returns the names of the templates, and the campaigns
+// that are yet to be sent or are being sent, that include a template partial.
+func (c *Core) GetTemplatePartialUsage(name string) ([]string, error) {
+	out := []string{}
+	if err := c.q.GetTemplatePartialUsage.Select(&out, name); err != nil {
+		c.log.Printf("error fetching template partial usage: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{templates.partial}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
@@ -0,0 +1,156 @@
+// Package crmsync syncs listmonk lists with lists of contacts in CRMs. It reads
+// the contacts in a CRM list (segment) to be pulled into a listmonk list, and
+// writes the status of subscribers, eg: unsubscribed, to a contact property
+// in the CRM.
+package crmsync
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Statuses of subscribers that are pushed to CRM contacts.
+const (
+	StatusUnsubscribed = "unsubscribed"
+	StatusBounced      = "bounced"
+)
+
+// Max size of an API response that's read.
+const maxRespSize = 10 * 1024 * 1024
+
+// ErrNotFound is returned when there's no contact in the CRM with an e-mail.
+var ErrNotFound = errors.New("contact not found")
+
+// Contact is a contact in a CRM with its mapped subscriber fields.
+type Contact struct {
+	Email   string
+	Name    string
+	Attribs map[string]interface{}
+}
+
+// Mapping maps the properties of CRM contacts to subscriber fields.
+type Mapping struct {
+	// Properties whose values, joined by spaces, are the subscriber's name,
+	// eg: firstname, lastname. If empty, the provider's defaults are used.
+	Name []string
+
+	// Properties and the subscriber attributes they're copied to.
+	Attribs map[string]string
+
+	// Property that the statuses of subscribers are written to.
+	Status string
+}
+
+// Provider is a CRM that contacts are synced with.
+type Provider interface {
+	// Contacts calls fn with the batches of contacts in a CRM list (segment)
+	// until there are no more or fn returns an error.
+	Contacts(segment string, fn func([]Contact) error) error
+
+	// SetStatus writes a status to the status property of the contact with
+	// the given e-mail. It returns ErrNotFound if there's no such contact.
+	SetStatus(email, status string) error
+}
+
+// Providers is the list of supported CRMs.
+var Providers = []string{"hubspot", "pipedrive"}
+
+// New returns a Provider for the given CRM that's accessed with the API key.
+func New(provider, apiKey string, m Mapping, c *http.Client) (Provider, error) {
+	if apiKey == "" {
+		return nil, errors.New("API key is empty")
+	}
+
+	switch provider {
+	case "hubspot":
+		if len(m.Name) == 0 {
+			m.Name = []string{"firstname", "lastname"}
+		}
+		return &hubspot{key: apiKey, m: m, c: c}, nil
+	case "pipedrive":
+		if len(m.Name) == 0 {
+			m.Name = []string{"name"}
+		}
+		return &pipedrive{key: apiKey, m: m, c: c}, nil
+	}
+
+	return nil, fmt.Errorf("unknown CRM: %s", provider)
+}
+
+// mapContact returns a contact with its name and attributes picked from
+// the CRM properties.
+func mapContact(email string, props map[string]interface{}, m Mapping) Contact {
+	var name []string
+	for _, p := range m.Name {
+		if s, ok := props[p].(string); ok && strings.TrimSpace(s) != "" {
+			name = append(name, strings.TrimSpace(s))
+		}
+	}
+
+	attribs := make(map[string]interface{}, len(m.Attribs))
+	for p, a := range m.Attribs {
+		if v, ok := props[p]; ok && v != nil && v != "" {
+			attribs[a] = v
+		}
+	}
+
+	return Contact{Email: email, Name: strings.Join(name, " "), Attribs: attribs}
+}
+
+// doJSON makes a request with an optional JSON body and decodes the JSON
+// response into out, if it's not nil. A 404 response is ErrNotFound.
+func doJSON(c *http.Client, method, u string, hdr http.Header, body, out interface{}) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, u, r)
+	if err != nil {
+		return err
+	}
+	for k, v := range hdr {
+		req.Header[k] = v
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		// The URL in the error may have the API key in it.
+		if e, ok := err.(*url.Error); ok {
+			return e.Err
+		}
+		return err
+	}
+	defer func() {
+		// Drain and close the body to let the Transport reuse the connection.
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1000))
+		return fmt.Errorf("non-OK response: %d: %s", resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxRespSize)).Decode(out)
+}
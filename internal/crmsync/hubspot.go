@@ -0,0 +1,115 @@
+package crmsync
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const (
+	hubspotURL = "https://api.hubapi.com"
+
+	// Max number of contacts that can be read in a batch.
+	hubspotBatchSize = 100
+)
+
+// hubspot syncs with the lists of contacts in HubSpot. The API key is the
+// access token of a private app with the lists and contacts scopes.
+type hubspot struct {
+	key string
+	m   Mapping
+	c   *http.Client
+}
+
+type hubspotMemberships struct {
+	Results []struct {
+		RecordID string `json:"recordId"`
+	} `json:"results"`
+	Paging struct {
+		Next struct {
+			After string `json:"after"`
+		} `json:"next"`
+	} `json:"paging"`
+}
+
+type hubspotContacts struct {
+	Results []struct {
+		ID         string                 `json:"id"`
+		Properties map[string]interface{} `json:"properties"`
+	} `json:"results"`
+}
+
+// Contacts reads the memberships of a list and then the properties of the
+// member contacts, a batch at a time.
+func (h *hubspot) Contacts(segment string, fn func([]Contact) error) error {
+	props := []string{"email"}
+	props = append(props, h.m.Name...)
+	for p := range h.m.Attribs {
+		props = append(props, p)
+	}
+
+	after := ""
+	for {
+		q := url.Values{"limit": {fmt.Sprintf("%d", hubspotBatchSize)}}
+		if after != "" {
+			q.Set("after", after)
+		}
+
+		var mem hubspotMemberships
+		u := fmt.Sprintf("%s/crm/v3/lists/%s/memberships?%s", hubspotURL, url.PathEscape(segment), q.Encode())
+		if err := doJSON(h.c, http.MethodGet, u, h.header(), nil, &mem); err != nil {
+			return fmt.Errorf("error fetching hubspot list memberships: %v", err)
+		}
+
+		if len(mem.Results) > 0 {
+			inputs := make([]map[string]string, 0, len(mem.Results))
+			for _, r := range mem.Results {
+				inputs = append(inputs, map[string]string{"id": r.RecordID})
+			}
+
+			var res hubspotContacts
+			req := map[string]interface{}{"properties": props, "inputs": inputs}
+			if err := doJSON(h.c, http.MethodPost, hubspotURL+"/crm/v3/objects/contacts/batch/read", h.header(), req, &res); err != nil {
+				return fmt.Errorf("error fetching hubspot contacts: %v", err)
+			}
+
+			out := make([]Contact, 0, len(res.Results))
+			for _, r := range res.Results {
+				email, _ := r.Properties["email"].(string)
+				if email == "" {
+					continue
+				}
+				out = append(out, mapContact(email, r.Properties, h.m))
+			}
+
+			if err := fn(out); err != nil {
+				return err
+			}
+		}
+
+		after = mem.Paging.Next.After
+		if after == "" {
+			return nil
+		}
+	}
+}
+
+// SetStatus updates the status property of a contact, which is looked up
+// by its e-mail.
+func (h *hubspot) SetStatus(email, status string) error {
+	u := fmt.Sprintf("%s/crm/v3/objects/contacts/%s?idProperty=email", hubspotURL, url.PathEscape(email))
+	req := map[string]interface{}{"properties": map[string]string{h.m.Status: status}}
+
+	if err := doJSON(h.c, http.MethodPatch, u, h.header(), req, nil); err != nil {
+		if err == ErrNotFound {
+			return err
+		}
+		return fmt.Errorf("error updating hubspot contact: %v", err)
+	}
+
+	return nil
+}
+
+func (h *hubspot) header() http.Header {
+	return http.Header{"Authorization": {"Bearer " + h.key}}
+}
@@ -0,0 +1,134 @@
+package crmsync
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const (
+	pipedriveURL = "https://api.pipedrive.com/v1"
+
+	// Max number of persons that can be read in a page.
+	pipedriveBatchSize = 500
+)
+
+// pipedrive syncs with the persons in Pipedrive that match a filter. The
+// API key is a personal API token. Custom fields are referred to by their
+// API keys.
+type pipedrive struct {
+	key string
+	m   Mapping
+	c   *http.Client
+}
+
+type pipedrivePersons struct {
+	Data           []map[string]interface{} `json:"data"`
+	AdditionalData struct {
+		Pagination struct {
+			MoreItems bool `json:"more_items_in_collection"`
+			NextStart int  `json:"next_start"`
+		} `json:"pagination"`
+	} `json:"additional_data"`
+}
+
+type pipedriveSearch struct {
+	Data struct {
+		Items []struct {
+			Item struct {
+				ID int `json:"id"`
+			} `json:"item"`
+		} `json:"items"`
+	} `json:"data"`
+}
+
+// Contacts reads the persons that match a filter, a page at a time.
+func (p *pipedrive) Contacts(segment string, fn func([]Contact) error) error {
+	start := 0
+	for {
+		q := url.Values{
+			"filter_id": {segment},
+			"start":     {fmt.Sprintf("%d", start)},
+			"limit":     {fmt.Sprintf("%d", pipedriveBatchSize)},
+		}
+
+		var res pipedrivePersons
+		if err := doJSON(p.c, http.MethodGet, p.url("/persons", q), nil, nil, &res); err != nil {
+			return fmt.Errorf("error fetching pipedrive persons: %v", err)
+		}
+
+		out := make([]Contact, 0, len(res.Data))
+		for _, props := range res.Data {
+			if email := pipedriveEmail(props["email"]); email != "" {
+				out = append(out, mapContact(email, props, p.m))
+			}
+		}
+
+		if len(out) > 0 {
+			if err := fn(out); err != nil {
+				return err
+			}
+		}
+
+		pg := res.AdditionalData.Pagination
+		if !pg.MoreItems || pg.NextStart <= start {
+			return nil
+		}
+		start = pg.NextStart
+	}
+}
+
+// SetStatus looks up the person with an e-mail and updates their status field.
+func (p *pipedrive) SetStatus(email, status string) error {
+	q := url.Values{"term": {email}, "fields": {"email"}, "exact_match": {"true"}, "limit": {"1"}}
+
+	var res pipedriveSearch
+	if err := doJSON(p.c, http.MethodGet, p.url("/persons/search", q), nil, nil, &res); err != nil {
+		return fmt.Errorf("error searching pipedrive persons: %v", err)
+	}
+	if len(res.Data.Items) == 0 {
+		return ErrNotFound
+	}
+
+	u := p.url(fmt.Sprintf("/persons/%d", res.Data.Items[0].Item.ID), nil)
+	if err := doJSON(p.c, http.MethodPut, u, nil, map[string]string{p.m.Status: status}, nil); err != nil {
+		if err == ErrNotFound {
+			return err
+		}
+		return fmt.Errorf("error updating pipedrive person: %v", err)
+	}
+
+	return nil
+}
+
+func (p *pipedrive) url(path string, q url.Values) string {
+	if q == nil {
+		q = url.Values{}
+	}
+	q.Set("api_token", p.key)
+
+	return pipedriveURL + path + "?" + q.Encode()
+}
+
+// pipedriveEmail returns the primary e-mail, or the first one, of a person
+// from their list of e-mails.
+func pipedriveEmail(v interface{}) string {
+	emails, _ := v.([]interface{})
+
+	first := ""
+	for _, e := range emails {
+		m, _ := e.(map[string]interface{})
+		s, _ := m["value"].(string)
+		if s == "" {
+			continue
+		}
+		if p, _ := m["primary"].(bool); p {
+			return s
+		}
+		if first == "" {
+			first = s
+		}
+	}
+
+	return first
+}
@@ -0,0 +1,530 @@
+// Package darkmode approximates how e-mail clients render HTML bodies in
+// dark mode so that both renderings can be previewed without sending test
+// e-mails to several clients. Clients broadly do one of three things:
+// apply the body's own prefers-color-scheme: dark styles (Apple Mail,
+// Outlook for macOS), darken light backgrounds and lighten dark text while
+// leaving the rest alone (Outlook.com, Gmail for Android), or invert the
+// lightness of all colors (Gmail for iOS, Outlook for Windows).
+package darkmode
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	// ModeMedia applies the body's prefers-color-scheme: dark styles.
+	ModeMedia = "media"
+
+	// ModePartial darkens light backgrounds and lightens dark text.
+	ModePartial = "partial"
+
+	// ModeFull inverts the lightness of all colors.
+	ModeFull = "full"
+)
+
+// Dark mode clients render the canvas (and the text) in the dark scheme.
+// This goes before all the other styles so that the body can override it.
+const baseStyle = `<style>:root { color-scheme: dark; }</style>`
+
+// Always true and always false media features that replace
+// prefers-color-scheme in media queries.
+const (
+	mediaTrue  = "(min-width: 0px)"
+	mediaFalse = "(max-width: -1px)"
+)
+
+type role int
+
+const (
+	roleFg role = iota
+	roleBg
+)
+
+var (
+	regexpScheme = regexp.MustCompile(`(?i)\(\s*prefers-color-scheme\s*:\s*(dark|light)\s*\)`)
+
+	// CSS declarations of color properties. The property has to be at the
+	// start of a declaration so that eg: color doesn't match background-color.
+	regexpDecl = regexp.MustCompile(`(?i)(^|[\s;{])((?:background|border(?:-(?:top|right|bottom|left))?|outline)(?:-color)?|color)(\s*:\s*)([^;{}]*)`)
+
+	regexpColor = regexp.MustCompile(`(?i)#[0-9a-f]{3,8}\b|rgba?\([^)]*\)|\b[a-z]+\b`)
+	regexpURL   = regexp.MustCompile(`(?i)url\([^)]*\)`)
+)
+
+// Commonly used named colors. Other names are left as they are.
+var namedColors = map[string][3]uint8{
+	"white":       {255, 255, 255},
+	"black":       {0, 0, 0},
+	"whitesmoke":  {245, 245, 245},
+	"gainsboro":   {220, 220, 220},
+	"lightgray":   {211, 211, 211},
+	"lightgrey":   {211, 211, 211},
+	"silver":      {192, 192, 192},
+	"darkgray":    {169, 169, 169},
+	"darkgrey":    {169, 169, 169},
+	"gray":        {128, 128, 128},
+	"grey":        {128, 128, 128},
+	"red":         {255, 0, 0},
+	"maroon":      {128, 0, 0},
+	"orange":      {255, 165, 0},
+	"yellow":      {255, 255, 0},
+	"green":       {0, 128, 0},
+	"teal":        {0, 128, 128},
+	"blue":        {0, 0, 255},
+	"navy":        {0, 0, 128},
+	"purple":      {128, 0, 128},
+	"lightyellow": {255, 255, 224},
+}
+
+// Attributes whose values are colors, and their roles.
+var colorAttrs = map[string]role{
+	"bgcolor": roleBg,
+	"color":   roleFg,
+	"text":    roleFg,
+	"link":    roleFg,
+	"vlink":   roleFg,
+	"alink":   roleFg,
+}
+
+// Valid checks whether a dark mode is known.
+func Valid(mode string) bool {
+	return mode == ModeMedia || mode == ModePartial || mode == ModeFull
+}
+
+// Render returns an HTML body as it'd be rendered in the given dark mode.
+// In the partial mode, elements whose text or background colors are changed
+// are marked with the data-ogsc and data-ogsb attributes like Outlook.com
+// does, so that styles targeting them apply.
+func Render(body []byte, mode string) []byte {
+	if !Valid(mode) {
+		return body
+	}
+
+	var (
+		z   = html.NewTokenizer(bytes.NewReader(body))
+		out = bytes.Buffer{}
+
+		inStyle  = false
+		injected = false
+		insertAt = 0
+	)
+	out.Grow(len(body) + len(baseStyle))
+
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF {
+				// Don't lose whatever the tokenizer couldn't make sense of.
+				out.Write(z.Raw())
+			}
+			break
+		}
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			// TagName() and TagAttr() overwrite Raw().
+			raw := append([]byte(nil), z.Raw()...)
+			name, hasAttr := z.TagName()
+			tag := string(name)
+
+			if hasAttr {
+				out.WriteString(renderTag(z, tag, tt == html.SelfClosingTagToken, raw, mode))
+			} else {
+				out.Write(raw)
+			}
+
+			switch tag {
+			case "style":
+				inStyle = tt == html.StartTagToken
+			case "html":
+				insertAt = out.Len()
+			case "head":
+				if !injected {
+					out.WriteString(baseStyle)
+					injected = true
+				}
+			}
+
+		case html.EndTagToken:
+			inStyle = false
+			out.Write(z.Raw())
+
+		case html.DoctypeToken:
+			out.Write(z.Raw())
+			insertAt = out.Len()
+
+		case html.TextToken:
+			if inStyle {
+				out.WriteString(transformCSS(string(z.Raw()), mode))
+			} else {
+				out.Write(z.Raw())
+			}
+
+		default:
+			out.Write(z.Raw())
+		}
+	}
+
+	b := out.Bytes()
+	if !injected {
+		b = append(b[:insertAt], append([]byte(baseStyle), b[insertAt:]...)...)
+	}
+
+	return b
+}
+
+// renderTag returns a start tag with the colors in its attributes transformed.
+// Tags without color attributes are returned as they are.
+func renderTag(z *html.Tokenizer, tag string, selfClosing bool, raw []byte, mode string) string {
+	type attr struct {
+		key, val string
+	}
+
+	var (
+		attrs   []attr
+		changed = false
+		fg, bg  = false, false
+	)
+	for {
+		k, v, more := z.TagAttr()
+		key, val := string(k), string(v)
+
+		switch {
+		case key == "style":
+			var f, b bool
+			val, f, b = transformDecls(val, mode)
+			fg, bg = fg || f, bg || b
+			changed = changed || f || b
+
+		case key == "media":
+			if s := transformMedia(val, mode); s != val {
+				val = s
+				changed = true
+			}
+
+		default:
+			if r, ok := colorAttrs[key]; ok {
+				if s := transformColor(val, r, mode); s != val {
+					val = s
+					changed = true
+					fg, bg = fg || r == roleFg, bg || r == roleBg
+				}
+			}
+		}
+
+		attrs = append(attrs, attr{key, val})
+		if !more {
+			break
+		}
+	}
+
+	if !changed {
+		return string(raw)
+	}
+
+	if mode == ModePartial {
+		if fg {
+			attrs = append(attrs, attr{"data-ogsc", ""})
+		}
+		if bg {
+			attrs = append(attrs, attr{"data-ogsb", ""})
+		}
+	}
+
+	var s strings.Builder
+	s.WriteString("<" + tag)
+	for _, a := range attrs {
+		s.WriteString(" " + a.key + `="` + html.EscapeString(a.val) + `"`)
+	}
+	if selfClosing {
+		s.WriteString(" /")
+	}
+	s.WriteString(">")
+
+	return s.String()
+}
+
+// transformCSS transforms the colors and the media queries in a stylesheet.
+func transformCSS(css, mode string) string {
+	css = transformMedia(css, mode)
+	if mode == ModeMedia {
+		return css
+	}
+
+	css, _, _ = transformDecls(css, mode)
+	return css
+}
+
+// transformMedia replaces prefers-color-scheme in media queries. Clients that
+// transform colors themselves don't support it, so neither scheme applies.
+func transformMedia(s, mode string) string {
+	return regexpScheme.ReplaceAllStringFunc(s, func(m string) string {
+		if mode == ModeMedia && strings.EqualFold(regexpScheme.FindStringSubmatch(m)[1], "dark") {
+			return mediaTrue
+		}
+		return mediaFalse
+	})
+}
+
+// transformDecls transforms the colors in the color declarations in CSS
+// and returns whether any text (fg) or background (bg) colors were changed.
+func transformDecls(css, mode string) (string, bool, bool) {
+	if mode == ModeMedia {
+		return css, false, false
+	}
+
+	var fg, bg bool
+	out := regexpDecl.ReplaceAllStringFunc(css, func(m string) string {
+		sub := regexpDecl.FindStringSubmatch(m)
+
+		r := roleFg
+		if strings.HasPrefix(strings.ToLower(sub[2]), "background") {
+			r = roleBg
+		}
+
+		val := transformValue(sub[4], r, mode)
+		if val == sub[4] {
+			return m
+		}
+
+		if r == roleBg {
+			bg = true
+		} else {
+			fg = true
+		}
+		return sub[1] + sub[2] + sub[3] + val
+	})
+
+	return out, fg, bg
+}
+
+// transformValue transforms the colors in a CSS value, leaving url()s alone.
+func transformValue(val string, r role, mode string) string {
+	var (
+		out  strings.Builder
+		last = 0
+	)
+
+	replace := func(s string) string {
+		return regexpColor.ReplaceAllStringFunc(s, func(c string) string {
+			return transformColor(c, r, mode)
+		})
+	}
+
+	for _, loc := range regexpURL.FindAllStringIndex(val, -1) {
+		out.WriteString(replace(val[last:loc[0]]))
+		out.WriteString(val[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	out.WriteString(replace(val[last:]))
+
+	return out.String()
+}
+
+// transformColor returns a color as a dark mode client would render it.
+// Values that aren't colors are returned as they are.
+func transformColor(c string, r role, mode string) string {
+	if mode == ModeMedia {
+		return c
+	}
+
+	rgb, alpha, ok := parseColor(c)
+	if !ok {
+		return c
+	}
+
+	if mode == ModePartial {
+		// Only light backgrounds and dark text are changed.
+		light := brightness(rgb) >= 0.5
+		if (r == roleBg && !light) || (r == roleFg && light) {
+			return c
+		}
+	}
+
+	h, s, l := toHSL(rgb)
+
+	// Clients don't go all the way to black and white, which would
+	// be too harsh, eg: white becomes #1f1f1f and black #ebebeb.
+	l = 0.12 + (1-l)*0.8
+
+	out := fromHSL(h, s, l)
+	if alpha < 1 {
+		return fmt.Sprintf("rgba(%d, %d, %d, %s)", out[0], out[1], out[2], strconv.FormatFloat(alpha, 'f', -1, 64))
+	}
+	return fmt.Sprintf("#%02x%02x%02x", out[0], out[1], out[2])
+}
+
+// parseColor parses hex, rgb(), rgba(), and common named colors.
+func parseColor(c string) ([3]uint8, float64, bool) {
+	c = strings.ToLower(strings.TrimSpace(c))
+
+	if rgb, ok := namedColors[c]; ok {
+		return rgb, 1, true
+	}
+
+	if strings.HasPrefix(c, "#") {
+		return parseHex(c[1:])
+	}
+
+	if strings.HasPrefix(c, "rgb") {
+		start, end := strings.Index(c, "("), strings.LastIndex(c, ")")
+		if start < 0 || end < start {
+			return [3]uint8{}, 0, false
+		}
+
+		// rgb(1, 2, 3), rgba(1, 2, 3, 0.5), and rgb(1 2 3 / 50%).
+		parts := strings.FieldsFunc(c[start+1:end], func(r rune) bool {
+			return r == ',' || r == ' ' || r == '/'
+		})
+		if len(parts) != 3 && len(parts) != 4 {
+			return [3]uint8{}, 0, false
+		}
+
+		var rgb [3]uint8
+		for i := 0; i < 3; i++ {
+			v, ok := parseNum(parts[i], 255)
+			if !ok {
+				return [3]uint8{}, 0, false
+			}
+			rgb[i] = uint8(math.Round(math.Min(math.Max(v, 0), 255)))
+		}
+
+		alpha := 1.0
+		if len(parts) == 4 {
+			v, ok := parseNum(parts[3], 1)
+			if !ok {
+				return [3]uint8{}, 0, false
+			}
+			alpha = math.Min(math.Max(v, 0), 1)
+		}
+
+		return rgb, alpha, true
+	}
+
+	return [3]uint8{}, 0, false
+}
+
+// parseHex parses rgb, rgba, rrggbb, and rrggbbaa hex colors.
+func parseHex(h string) ([3]uint8, float64, bool) {
+	if len(h) == 3 || len(h) == 4 {
+		var b strings.Builder
+		for _, r := range h {
+			b.WriteRune(r)
+			b.WriteRune(r)
+		}
+		h = b.String()
+	}
+	if len(h) != 6 && len(h) != 8 {
+		return [3]uint8{}, 0, false
+	}
+
+	n, err := strconv.ParseUint(h, 16, 32)
+	if err != nil {
+		return [3]uint8{}, 0, false
+	}
+
+	alpha := 1.0
+	if len(h) == 8 {
+		alpha = math.Round(float64(n&0xff)/255*100) / 100
+		n >>= 8
+	}
+
+	return [3]uint8{uint8(n >> 16), uint8(n >> 8), uint8(n)}, alpha, true
+}
+
+// parseNum parses a number or a percentage of max.
+func parseNum(s string, max float64) (float64, bool) {
+	pct := strings.HasSuffix(s, "%")
+
+	v, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil {
+		return 0, false
+	}
+	if pct {
+		v = v / 100 * max
+	}
+	return v, true
+}
+
+// brightness returns the perceived brightness (0-1) of a color.
+func brightness(c [3]uint8) float64 {
+	return (0.299*float64(c[0]) + 0.587*float64(c[1]) + 0.114*float64(c[2])) / 255
+}
+
+func toHSL(c [3]uint8) (float64, float64, float64) {
+	var (
+		r, g, b = float64(c[0]) / 255, float64(c[1]) / 255, float64(c[2]) / 255
+		max     = math.Max(r, math.Max(g, b))
+		min     = math.Min(r, math.Min(g, b))
+		l       = (max + min) / 2
+	)
+
+	if max == min {
+		return 0, 0, l
+	}
+
+	d := max - min
+	s := d / (2 - max - min)
+	if l <= 0.5 {
+		s = d / (max + min)
+	}
+
+	var h float64
+	switch max {
+	case r:
+		h = (g - b) / d
+		if g < b {
+			h += 6
+		}
+	case g:
+		h = (b-r)/d + 2
+	default:
+		h = (r-g)/d + 4
+	}
+
+	return h / 6, s, l
+}
+
+func fromHSL(h, s, l float64) [3]uint8 {
+	if s == 0 {
+		v := uint8(math.Round(l * 255))
+		return [3]uint8{v, v, v}
+	}
+
+	q := l * (1 + s)
+	if l >= 0.5 {
+		q = l + s - l*s
+	}
+	p := 2*l - q
+
+	hue := func(t float64) uint8 {
+		if t < 0 {
+			t++
+		} else if t > 1 {
+			t--
+		}
+
+		var v float64
+		switch {
+		case t < 1.0/6:
+			v = p + (q-p)*6*t
+		case t < 0.5:
+			v = q
+		case t < 2.0/3:
+			v = p + (q-p)*(2.0/3-t)*6
+		default:
+			v = p
+		}
+		return uint8(math.Round(v * 255))
+	}
+
+	return [3]uint8{hue(h + 1.0/3), hue(h), hue(h - 1.0/3)}
+}
@@ -0,0 +1,349 @@
+// Package gallery fetches templates and their assets from a remote template
+// gallery. A gallery is a JSON index of templates served over HTTP(S) or
+// from a Git repository on a host that serves raw files (GitHub, GitLab).
+// Paths in the index are relative to the index and paths of assets in
+// template bodies are relative to the body.
+package gallery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// Name of the index file in gallery repositories and directories.
+	indexFile = "index.json"
+
+	maxIndexSize = 1024 * 1024
+	maxBodySize  = 1024 * 1024
+
+	// MaxAssetSize is the max size of an asset that's fetched.
+	MaxAssetSize = 5 * 1024 * 1024
+
+	// MaxAssets is the max number of assets that a template can reference.
+	MaxAssets = 50
+)
+
+var (
+	// src="", background="" attributes and CSS url() references.
+	regexpAttrRef = regexp.MustCompile(`(?i)\b(?:src|background)\s*=\s*["']([^"']+)["']`)
+	regexpCSSRef  = regexp.MustCompile(`(?i)url\(\s*["']?([^"')]+?)["']?\s*\)`)
+
+	regexpID = regexp.MustCompile(`^[a-z0-9_\-]+$`)
+)
+
+// Index is the index of templates in a gallery.
+type Index struct {
+	Name      string     `json:"name"`
+	Templates []Template `json:"templates"`
+}
+
+// Template is a template in a gallery index.
+type Template struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+
+	// campaign | tx
+	Type      string `json:"type"`
+	Subject   string `json:"subject"`
+	Preheader string `json:"preheader"`
+
+	// Paths (or URLs) of the HTML body and the thumbnail image.
+	Body      string `json:"body"`
+	Thumbnail string `json:"thumbnail"`
+}
+
+// Asset is a file referenced in a template body. Ref is the reference
+// as it is in the body and URL is the absolute URL it resolves to.
+type Asset struct {
+	Ref string `json:"ref"`
+	URL string `json:"url"`
+}
+
+// Gallery fetches templates from a remote gallery.
+type Gallery struct {
+	index  *url.URL
+	client *http.Client
+}
+
+// New returns a new instance of Gallery. The URL is that of the index file,
+// or that of a GitHub or GitLab repository (optionally, a /tree/ref/dir
+// in it) with an index.json at its root (or in the dir).
+func New(rawURL string, timeout time.Duration) (*Gallery, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("gallery URL should be http:// or https://")
+	}
+
+	if r, ok := repoIndexURL(u); ok {
+		u = r
+	} else if strings.HasSuffix(u.Path, "/") {
+		u.Path += indexFile
+	}
+
+	if timeout == 0 {
+		timeout = time.Second * 10
+	}
+
+	return &Gallery{
+		index:  u,
+		client: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Index fetches the gallery's index. The body and thumbnail URLs of the
+// templates are resolved to absolute URLs and templates without a valid ID
+// or a body are skipped.
+func (g *Gallery) Index() (Index, error) {
+	b, _, err := g.Fetch(g.index.String(), maxIndexSize)
+	if err != nil {
+		return Index{}, err
+	}
+
+	var out Index
+	if err := json.Unmarshal(b, &out); err != nil {
+		return Index{}, fmt.Errorf("invalid gallery index: %v", err)
+	}
+
+	var (
+		tpls = make([]Template, 0, len(out.Templates))
+		seen = make(map[string]bool)
+	)
+	for _, t := range out.Templates {
+		if !regexpID.MatchString(t.ID) || seen[t.ID] || t.Body == "" {
+			continue
+		}
+		seen[t.ID] = true
+
+		if t.Type != "tx" {
+			t.Type = "campaign"
+		}
+		if t.Name == "" {
+			t.Name = t.ID
+		}
+
+		body, err := g.index.Parse(t.Body)
+		if err != nil {
+			continue
+		}
+		t.Body = body.String()
+
+		if t.Thumbnail != "" {
+			if u, err := g.index.Parse(t.Thumbnail); err == nil {
+				t.Thumbnail = u.String()
+			} else {
+				t.Thumbnail = ""
+			}
+		}
+
+		tpls = append(tpls, t)
+	}
+	out.Templates = tpls
+
+	return out, nil
+}
+
+// Template fetches the index entry and the HTML body of a template.
+func (g *Gallery) Template(id string) (Template, string, error) {
+	idx, err := g.Index()
+	if err != nil {
+		return Template{}, "", err
+	}
+
+	for _, t := range idx.Templates {
+		if t.ID != id {
+			continue
+		}
+
+		b, _, err := g.Fetch(t.Body, maxBodySize)
+		if err != nil {
+			return Template{}, "", err
+		}
+		return t, string(b), nil
+	}
+
+	return Template{}, "", fmt.Errorf("template '%s' not found in the gallery", id)
+}
+
+// Assets returns the files referenced in a template's body that are in the
+// gallery, in the order they're referenced. Template expressions, data URIs,
+// and files elsewhere on the web are not assets.
+func (g *Gallery) Assets(t Template, body string) ([]Asset, error) {
+	base, err := url.Parse(t.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		root = g.root()
+		seen = make(map[string]bool)
+		out  []Asset
+	)
+	for _, re := range []*regexp.Regexp{regexpAttrRef, regexpCSSRef} {
+		for _, m := range re.FindAllStringSubmatch(body, -1) {
+			ref := strings.TrimSpace(m[1])
+			if seen[ref] || !isFileRef(ref) {
+				continue
+			}
+			seen[ref] = true
+
+			u, err := base.Parse(ref)
+			if err != nil {
+				continue
+			}
+
+			// Only pull files that are in the gallery.
+			if u.Scheme != root.Scheme || u.Host != root.Host || !strings.HasPrefix(u.Path, root.Path) {
+				continue
+			}
+			out = append(out, Asset{Ref: ref, URL: u.String()})
+		}
+	}
+
+	if len(out) > MaxAssets {
+		return nil, fmt.Errorf("template references more than %d assets", MaxAssets)
+	}
+
+	return out, nil
+}
+
+// ReplaceAssets replaces the references to assets in a body with the
+// given URLs by reference, eg: the URLs of the assets in the media library.
+func ReplaceAssets(body string, urls map[string]string) string {
+	for _, re := range []*regexp.Regexp{regexpAttrRef, regexpCSSRef} {
+		body = re.ReplaceAllStringFunc(body, func(m string) string {
+			sub := re.FindStringSubmatchIndex(m)
+			ref := strings.TrimSpace(m[sub[2]:sub[3]])
+
+			u, ok := urls[ref]
+			if !ok {
+				return m
+			}
+			return m[:sub[2]] + u + m[sub[3]:]
+		})
+	}
+
+	return body
+}
+
+// Fetch fetches a file from the gallery and returns its contents and type.
+func (g *Gallery) Fetch(u string, maxSize int64) ([]byte, string, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("User-Agent", "listmonk")
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("%s responded with %d %s", u, resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	// Read one byte over the limit to know whether the file is too big.
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(b)) > maxSize {
+		return nil, "", fmt.Errorf("%s is bigger than %d KB", u, maxSize/1024)
+	}
+
+	return b, resp.Header.Get("Content-Type"), nil
+}
+
+// root returns the URL of the directory of the index, under which
+// all the files of the gallery are.
+func (g *Gallery) root() *url.URL {
+	u := *g.index
+	u.Path = path.Dir(u.Path)
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	u.RawQuery = ""
+	u.Fragment = ""
+	return &u
+}
+
+// isFileRef checks whether a reference in a body can be a file.
+func isFileRef(ref string) bool {
+	if ref == "" || strings.Contains(ref, "{{") || strings.HasPrefix(ref, "#") {
+		return false
+	}
+
+	r := strings.ToLower(ref)
+	for _, p := range []string{"data:", "cid:", "mailto:", "tel:", "javascript:"} {
+		if strings.HasPrefix(r, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// repoIndexURL returns the raw URL of the index file in a GitHub or GitLab
+// repository URL, eg: https://github.com/org/repo or
+// https://gitlab.com/group/repo/-/tree/main/templates.
+func repoIndexURL(u *url.URL) (*url.URL, bool) {
+	var (
+		p   = strings.Trim(u.Path, "/")
+		ref = "HEAD"
+		dir = ""
+	)
+
+	switch u.Host {
+	case "github.com":
+		parts := strings.SplitN(p, "/", 5)
+		if len(parts) < 2 || (len(parts) > 2 && (parts[2] != "tree" || len(parts) < 4)) {
+			return nil, false
+		}
+		if len(parts) > 3 {
+			ref = parts[3]
+		}
+		if len(parts) > 4 {
+			dir = parts[4]
+		}
+
+		return &url.URL{
+			Scheme: "https",
+			Host:   "raw.githubusercontent.com",
+			Path:   path.Join("/", parts[0], strings.TrimSuffix(parts[1], ".git"), ref, dir, indexFile),
+		}, true
+
+	case "gitlab.com":
+		proj, tree, _ := strings.Cut(p, "/-/")
+		if strings.Count(proj, "/") < 1 {
+			return nil, false
+		}
+		if tree != "" {
+			parts := strings.SplitN(tree, "/", 3)
+			if parts[0] != "tree" || len(parts) < 2 {
+				return nil, false
+			}
+			ref = parts[1]
+			if len(parts) > 2 {
+				dir = parts[2]
+			}
+		}
+
+		return &url.URL{
+			Scheme: "https",
+			Host:   u.Host,
+			Path:   path.Join("/", strings.TrimSuffix(proj, ".git"), "-", "raw", ref, dir, indexFile),
+		}, true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,354 @@
+// Package htmltext converts HTML e-mail bodies to readable plain text with
+// the headings, paragraphs, and lists preserved and the links footnoted.
+package htmltext
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Elements whose content isn't text.
+var skipTags = map[string]bool{
+	"head":     true,
+	"title":    true,
+	"style":    true,
+	"script":   true,
+	"noscript": true,
+	"template": true,
+}
+
+// Elements that are separated from their surroundings by a line break (1)
+// or a blank line (2).
+var blockTags = map[string]int{
+	"p":          2,
+	"h1":         2,
+	"h2":         2,
+	"h3":         2,
+	"h4":         2,
+	"h5":         2,
+	"h6":         2,
+	"blockquote": 2,
+	"pre":        2,
+	"table":      2,
+	"ul":         2,
+	"ol":         2,
+	"div":        1,
+	"tr":         1,
+	"li":         1,
+	"section":    1,
+	"article":    1,
+	"header":     1,
+	"footer":     1,
+	"center":     1,
+}
+
+var voidTags = map[string]bool{
+	"area":   true,
+	"base":   true,
+	"br":     true,
+	"col":    true,
+	"embed":  true,
+	"hr":     true,
+	"img":    true,
+	"input":  true,
+	"link":   true,
+	"meta":   true,
+	"source": true,
+	"track":  true,
+	"wbr":    true,
+}
+
+type converter struct {
+	out bytes.Buffer
+
+	// Number of line breaks and whether a space are to be written before
+	// the next text.
+	breaks int
+	space  bool
+
+	// Depth of the hidden element whose content is skipped, and <pre> depth.
+	skip int
+	pre  int
+
+	// Item counters of the lists being converted. -1 is an unordered list.
+	lists []int
+
+	// Links whose text is being converted and the footnoted URLs.
+	links []link
+	urls  []string
+}
+
+// link is a link whose text starts at the given offset in the output.
+type link struct {
+	url   string
+	start int
+}
+
+// FromHTML converts an HTML document or fragment to plain text.
+func FromHTML(b []byte) []byte {
+	c := &converter{}
+	z := html.NewTokenizer(bytes.NewReader(b))
+
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			// io.EOF or a malformed document, which is converted up to the error.
+			break
+		}
+
+		t := z.Token()
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if c.skip > 0 {
+				if tt == html.StartTagToken && !voidTags[t.Data] {
+					c.skip++
+				}
+				continue
+			}
+			if tt == html.StartTagToken && !voidTags[t.Data] && (skipTags[t.Data] || isHidden(t)) {
+				c.skip = 1
+				continue
+			}
+			c.start(t)
+			if tt == html.SelfClosingTagToken && !voidTags[t.Data] {
+				c.end(t)
+			}
+
+		case html.EndTagToken:
+			if c.skip > 0 {
+				if !voidTags[t.Data] {
+					c.skip--
+				}
+				continue
+			}
+			c.end(t)
+
+		case html.TextToken:
+			if c.skip == 0 {
+				c.text(t.Data)
+			}
+		}
+	}
+
+	out := bytes.TrimSpace(c.out.Bytes())
+	if len(c.urls) > 0 {
+		out = append(out, '\n', '\n')
+		for i, u := range c.urls {
+			out = append(out, fmt.Sprintf("[%d] %s\n", i+1, u)...)
+		}
+	}
+
+	return out
+}
+
+func (c *converter) start(t html.Token) {
+	c.lineBreak(c.blockBreaks(t.Data))
+
+	switch t.Data {
+	case "br":
+		c.write("\n")
+		c.breaks, c.space = 0, false
+
+	case "hr":
+		c.lineBreak(2)
+		c.write("--------")
+		c.lineBreak(2)
+
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		c.write(strings.Repeat("#", int(t.Data[1]-'0')) + " ")
+
+	case "pre":
+		c.pre++
+
+	case "ul":
+		c.lists = append(c.lists, -1)
+
+	case "ol":
+		c.lists = append(c.lists, 0)
+
+	case "li":
+		prefix := "- "
+		if n := len(c.lists); n > 0 && c.lists[n-1] >= 0 {
+			c.lists[n-1]++
+			prefix = fmt.Sprintf("%d. ", c.lists[n-1])
+		}
+		indent := ""
+		if len(c.lists) > 1 {
+			indent = strings.Repeat("  ", len(c.lists)-1)
+		}
+		c.write(indent + prefix)
+
+	case "img":
+		if alt := strings.TrimSpace(attr(t, "alt")); alt != "" {
+			c.text(alt)
+		}
+
+	case "a":
+		c.links = append(c.links, link{url: linkURL(attr(t, "href")), start: c.out.Len()})
+	}
+}
+
+func (c *converter) end(t html.Token) {
+	switch t.Data {
+	case "pre":
+		if c.pre > 0 {
+			c.pre--
+		}
+
+	case "ul", "ol":
+		if len(c.lists) > 0 {
+			c.lists = c.lists[:len(c.lists)-1]
+		}
+
+	case "td", "th":
+		c.space = true
+
+	case "a":
+		if len(c.links) == 0 {
+			break
+		}
+		l := c.links[len(c.links)-1]
+		c.links = c.links[:len(c.links)-1]
+
+		u := l.url
+		if u == "" {
+			break
+		}
+
+		// Links without text are written as the URL, and links whose text
+		// is the URL itself aren't footnoted.
+		text := ""
+		if l.start <= c.out.Len() {
+			text = strings.TrimSpace(c.out.String()[l.start:])
+		}
+		if text == "" {
+			c.text(u)
+			break
+		}
+		if text == u || strings.TrimPrefix(strings.TrimPrefix(u, "https://"), "http://") == text {
+			break
+		}
+
+		n := 0
+		for i, v := range c.urls {
+			if v == u {
+				n = i + 1
+				break
+			}
+		}
+		if n == 0 {
+			c.urls = append(c.urls, u)
+			n = len(c.urls)
+		}
+		c.space = true
+		c.text(fmt.Sprintf("[%d]", n))
+	}
+
+	c.lineBreak(c.blockBreaks(t.Data))
+}
+
+// blockBreaks returns the number of line breaks that separate an element from
+// its surroundings. Lists nested in lists are only on lines of their own.
+func (c *converter) blockBreaks(tag string) int {
+	if (tag == "ul" || tag == "ol") && len(c.lists) > 0 {
+		return 1
+	}
+	return blockTags[tag]
+}
+
+// text writes text with its whitespace collapsed, except in <pre>.
+func (c *converter) text(s string) {
+	if c.pre > 0 {
+		lines := strings.Split(s, "\n")
+		for i, l := range lines {
+			if i > 0 {
+				c.out.WriteByte('\n')
+			}
+			if l != "" {
+				c.write(l)
+			}
+		}
+		return
+	}
+
+	if s == "" {
+		return
+	}
+	if isSpace(s[0]) {
+		c.space = true
+	}
+
+	for _, w := range strings.Fields(s) {
+		c.write(w)
+		c.space = true
+	}
+
+	if !isSpace(s[len(s)-1]) {
+		c.space = false
+	}
+}
+
+// write writes s after the pending line breaks or space.
+func (c *converter) write(s string) {
+	if c.out.Len() > 0 {
+		if c.breaks > 0 {
+			c.out.Truncate(len(bytes.TrimRight(c.out.Bytes(), " ")))
+			c.out.WriteString(strings.Repeat("\n", c.breaks))
+		} else if c.space {
+			if b := c.out.Bytes()[c.out.Len()-1]; b != ' ' && b != '\n' {
+				c.out.WriteByte(' ')
+			}
+		}
+	}
+
+	c.out.WriteString(s)
+	c.breaks, c.space = 0, false
+}
+
+// lineBreak requests n line breaks before the next text, unless the text so
+// far already ends with them.
+func (c *converter) lineBreak(n int) {
+	if n == 0 {
+		return
+	}
+
+	have := len(c.out.Bytes()) - len(bytes.TrimRight(c.out.Bytes(), "\n"))
+	if n-have > c.breaks {
+		c.breaks = n - have
+	}
+	c.space = false
+}
+
+// linkURL returns the URL of a link that's footnoted, which are the links
+// that aren't anchors or scripts.
+func linkURL(href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+		return ""
+	}
+	return href
+}
+
+// isHidden returns whether an element is hidden with an inline style, which
+// is commonly used for preview text.
+func isHidden(t html.Token) bool {
+	s := strings.ReplaceAll(strings.ToLower(attr(t, "style")), " ", "")
+	return strings.Contains(s, "display:none") || strings.Contains(s, "visibility:hidden") ||
+		strings.Contains(s, "mso-hide:all")
+}
+
+func attr(t html.Token, name string) string {
+	for _, a := range t.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\f'
+}
@@ -0,0 +1,70 @@
+package manager
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/knadh/listmonk/models"
+)
+
+// Template functions that need the subscribers' lists and engagement loaded.
+var subscriberMetaFuncs = []string{"InList", "Engagement", "EngagedWithin"}
+
+// needsSubscriberMeta checks whether a campaign's body or content blocks use
+// any of the template functions that need the subscribers' lists and engagement.
+func needsSubscriberMeta(c *models.Campaign) bool {
+	bodies := []string{c.Body, c.AltBody.String, c.BodyAMP.String}
+	for _, b := range c.ContentBlocks {
+		bodies = append(bodies, b.Condition, b.Body)
+	}
+	for _, v := range c.LangVariants {
+		bodies = append(bodies, v.Body, v.AltBody)
+	}
+
+	for _, b := range bodies {
+		for _, f := range subscriberMetaFuncs {
+			if strings.Contains(b, f) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// inList checks whether a subscriber has an active (not unsubscribed)
+// subscription to the given list, by ID or name.
+func inList(s models.Subscriber, list interface{}) bool {
+	if len(s.Lists) == 0 {
+		return false
+	}
+
+	var lists []struct {
+		ID     int    `json:"id"`
+		Name   string `json:"name"`
+		Status string `json:"subscription_status"`
+	}
+	if err := json.Unmarshal(s.Lists, &lists); err != nil {
+		return false
+	}
+
+	for _, l := range lists {
+		if l.Status == models.SubscriptionStatusUnsubscribed {
+			continue
+		}
+
+		switch v := list.(type) {
+		case int:
+			if l.ID == v {
+				return true
+			}
+		case string:
+			if strings.EqualFold(l.Name, v) || strconv.Itoa(l.ID) == v {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,79 @@
+package manager
+
+import "unicode/utf16"
+
+const (
+	// GSM-7 characters and the extension characters that take two septets.
+	gsm7Chars    = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	gsm7ExtChars = "^{}\\[~]|€\f"
+)
+
+var (
+	gsm7    = makeRuneSet(gsm7Chars)
+	gsm7Ext = makeRuneSet(gsm7ExtChars)
+)
+
+// MessageCost is the estimated cost of sending a message via a messenger.
+type MessageCost struct {
+	// Cost per message, or per SMS segment if PerSegment is set.
+	Cost       float64
+	PerSegment bool
+}
+
+// messageCost returns the cost config of the given messenger.
+func (m *Manager) messageCost(messenger string) MessageCost {
+	if c, ok := m.cfg.Costs[messenger]; ok {
+		return c
+	}
+	return MessageCost{Cost: m.cfg.DefaultCost}
+}
+
+// estimateCost returns the estimated cost of sent messages (and SMS segments)
+// via the given messenger.
+func (m *Manager) estimateCost(messenger string, sent, segments int64) float64 {
+	c := m.messageCost(messenger)
+	if c.PerSegment {
+		return float64(segments) * c.Cost
+	}
+	return float64(sent) * c.Cost
+}
+
+// smsSegments returns the number of SMS segments the given text is split into.
+// Texts that only have GSM-7 characters fit 160 septets in a single segment
+// and 153 per segment in multi-part messages. Others are sent as UCS-2 that
+// fits 70 characters in a single segment and 67 per segment in multi-part messages.
+func smsSegments(text string) int {
+	var (
+		n      = 0
+		isGSM7 = true
+	)
+	for _, r := range text {
+		if gsm7[r] {
+			n++
+		} else if gsm7Ext[r] {
+			n += 2
+		} else {
+			isGSM7 = false
+			break
+		}
+	}
+
+	single, multi := 160, 153
+	if !isGSM7 {
+		n = len(utf16.Encode([]rune(text)))
+		single, multi = 70, 67
+	}
+
+	if n <= single {
+		return 1
+	}
+	return (n + multi - 1) / multi
+}
+
+func makeRuneSet(s string) map[rune]bool {
+	out := make(map[rune]bool, len(s))
+	for _, r := range s {
+		out[r] = true
+	}
+	return out
+}
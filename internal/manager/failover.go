@@ -0,0 +1,173 @@
+package manager
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/knadh/listmonk/models"
+)
+
+// Status codes (SMTP replies, HTTP responses) in the text of messenger errors.
+var regexpErrCode = regexp.MustCompile(`\b([45])[0-9]{2}\b`)
+
+// Text of connection errors that may have lost their types to wrapping.
+var connErrors = []string{"connection refused", "connection reset", "broken pipe",
+	"no such host", "network is unreachable", "EOF", "timeout"}
+
+// delivery is the outcome of a campaign message: the messenger it was
+// delivered through, or the error with which it failed.
+type delivery struct {
+	subID     int64
+	messenger string
+	status    string
+	err       string
+	errType   string
+}
+
+// push pushes a campaign message through the messenger that's currently in
+// use by the pipe and returns its name. If the messenger errors FailoverErrors
+// times in a row, the pipe fails over to the next messenger in the campaign's
+// failover list and the message is retried on it.
+func (p *pipe) push(msg models.Message) (string, error) {
+	for {
+		idx := int(p.msgr.Load())
+		name := p.msgrs[idx]
+
+		err := p.m.messengers[name].Push(msg)
+		if err == nil {
+			p.msgrErrors.Store(0)
+			return name, nil
+		}
+
+		// There's nothing to fail over to.
+		if idx >= len(p.msgrs)-1 || p.m.cfg.FailoverErrors < 1 {
+			return name, err
+		}
+
+		if int(p.msgrErrors.Add(1)) < p.m.cfg.FailoverErrors {
+			return name, err
+		}
+
+		// Another worker may have already failed over.
+		if p.msgr.CompareAndSwap(int32(idx), int32(idx+1)) {
+			p.msgrErrors.Store(0)
+			p.m.log.Printf("messenger %s errored %d times (%v). failing over campaign (%s) to %s",
+				name, p.m.cfg.FailoverErrors, err, p.camp.Name, p.msgrs[idx+1])
+		}
+	}
+}
+
+// addDelivery records a delivered message and its estimated cost.
+func (p *pipe) addDelivery(subID int64, messenger string, cost float64) {
+	p.delivMut.Lock()
+	p.delivs = append(p.delivs, delivery{subID: subID, messenger: messenger, status: models.DeliveryStatusSent})
+	p.cost += cost
+	p.delivMut.Unlock()
+}
+
+// addDeliverySkipped records a message that was skipped for the given reason,
+// eg: the subscriber's frequency cap.
+func (p *pipe) addDeliverySkipped(subID int64, reason error) {
+	p.delivMut.Lock()
+	p.delivs = append(p.delivs, delivery{subID: subID, status: models.DeliveryStatusSkipped, err: reason.Error()})
+	p.delivMut.Unlock()
+}
+
+// addDeliveryError records a message that couldn't be rendered or sent
+// and the category of the error.
+func (p *pipe) addDeliveryError(subID int64, messenger, errType string, err error) {
+	p.delivMut.Lock()
+	p.delivs = append(p.delivs, delivery{subID: subID, messenger: messenger,
+		status: models.DeliveryStatusErrored, err: err.Error(), errType: errType})
+	p.delivMut.Unlock()
+}
+
+// sendErrorType returns the category of an error with which a messenger
+// failed to send a message: a connection error, a 4xx (temporary) or a 5xx
+// (permanent) SMTP or HTTP error, or an empty string if it's unknown.
+func sendErrorType(err error) string {
+	var tErr *textproto.Error
+	if errors.As(err, &tErr) {
+		return errCodeType(tErr.Code / 100)
+	}
+
+	var nErr net.Error
+	if errors.As(err, &nErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return models.DeliveryErrorConnection
+	}
+
+	msg := err.Error()
+	for _, e := range connErrors {
+		if strings.Contains(msg, e) {
+			return models.DeliveryErrorConnection
+		}
+	}
+
+	if m := regexpErrCode.FindStringSubmatch(msg); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		return errCodeType(n)
+	}
+
+	return ""
+}
+
+func errCodeType(class int) string {
+	switch class {
+	case 4:
+		return models.DeliveryError4xx
+	case 5:
+		return models.DeliveryError5xx
+	}
+
+	return ""
+}
+
+// takeCost returns the estimated cost of messages delivered since the last
+// call and resets it, as in the database, it's stored cumulatively.
+func (p *pipe) takeCost() float64 {
+	p.delivMut.Lock()
+	cost := p.cost
+	p.cost = 0
+	p.delivMut.Unlock()
+
+	return cost
+}
+
+// flushDeliveries writes the outcomes of the messages since the last flush
+// and the messengers they were delivered through to the DB.
+func (p *pipe) flushDeliveries() {
+	p.delivMut.Lock()
+	delivs := p.delivs
+	p.delivs = nil
+	p.delivMut.Unlock()
+
+	if len(delivs) == 0 {
+		return
+	}
+
+	var (
+		subIDs   = make([]int64, len(delivs))
+		msgrs    = make([]string, len(delivs))
+		statuses = make([]string, len(delivs))
+		errs     = make([]string, len(delivs))
+		errTypes = make([]string, len(delivs))
+	)
+	for i, d := range delivs {
+		subIDs[i] = d.subID
+		msgrs[i] = d.messenger
+		statuses[i] = d.status
+		errs[i] = d.err
+		errTypes[i] = d.errType
+	}
+
+	if err := p.m.store.RecordDeliveries(p.camp.ID, p.camp.ContentVersion, subIDs, msgrs, statuses, errs, errTypes); err != nil {
+		p.m.log.Printf("error recording campaign deliveries (%s): %v", p.camp.Name, err)
+	}
+}
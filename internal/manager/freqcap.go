@@ -0,0 +1,230 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+)
+
+const (
+	capDay  = time.Hour * 24
+	capWeek = capDay * 7
+)
+
+var (
+	errFrequencyCapped  = errors.New("subscriber's frequency cap exceeded")
+	errHeldPastDeadline = errors.New("held past the send deadline for the subscriber's frequency cap or quiet hours")
+)
+
+// FrequencyCap is the max number of campaigns that a subscriber can be sent
+// in a rolling day and week. 0 is no limit. Campaign messages over the cap
+// are skipped, unless Defer is set, in which case they're held until the
+// subscriber is under the cap again.
+type FrequencyCap struct {
+	Daily  int
+	Weekly int
+	Defer  bool
+}
+
+// QuietHours is a daily do-not-disturb window (HH:MM) in the subscribers'
+// timezones, during which campaign messages to them are held until it ends.
+// Subscribers without a (valid) timezone are in the default timezone.
+type QuietHours struct {
+	Start string
+	End   string
+}
+
+// IsZero returns true if the cap doesn't limit anything.
+func (f FrequencyCap) IsZero() bool {
+	return f.Daily < 1 && f.Weekly < 1
+}
+
+// merge returns the stricter of the two caps.
+func (f FrequencyCap) merge(daily, weekly int) FrequencyCap {
+	if daily > 0 && (f.Daily < 1 || daily < f.Daily) {
+		f.Daily = daily
+	}
+	if weekly > 0 && (f.Weekly < 1 || weekly < f.Weekly) {
+		f.Weekly = weekly
+	}
+	return f
+}
+
+// next returns the time at which a subscriber with campaigns sent to them
+// at the given times (oldest first) is under the cap again, or a zero time
+// if they're under it at t.
+func (f FrequencyCap) next(t time.Time, sentAt []time.Time) time.Time {
+	var out time.Time
+	for _, c := range []struct {
+		max    int
+		period time.Duration
+	}{{f.Daily, capDay}, {f.Weekly, capWeek}} {
+		if c.max < 1 {
+			continue
+		}
+
+		// Sends in the period.
+		var (
+			since = t.Add(-c.period)
+			in    = sentAt
+		)
+		for len(in) > 0 && !in[0].After(since) {
+			in = in[1:]
+		}
+		if len(in) < c.max {
+			continue
+		}
+
+		// The subscriber's under the cap once enough of the sends are out of the period.
+		if at := in[len(in)-c.max].Add(c.period); at.After(out) {
+			out = at
+		}
+	}
+
+	return out
+}
+
+// quietHours is a parsed QuietHours.
+type quietHours struct {
+	start, end time.Duration
+	def        *time.Location
+
+	// Subscriber timezones that have been loaded.
+	locs map[string]*time.Location
+	mut  sync.Mutex
+}
+
+// newQuietHours parses the quiet hours. It returns nil if there are none.
+func newQuietHours(q QuietHours, def *time.Location) (*quietHours, error) {
+	if q.Start == "" && q.End == "" {
+		return nil, nil
+	}
+
+	start, err := parseClock(q.Start)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseClock(q.End)
+	if err != nil {
+		return nil, err
+	}
+	if start == end {
+		return nil, fmt.Errorf("quiet hours start and end are the same: %s", q.Start)
+	}
+
+	// The quiet hours span midnight.
+	if end < start {
+		end += capDay
+	}
+
+	return &quietHours{start: start, end: end, def: def, locs: make(map[string]*time.Location)}, nil
+}
+
+// ValidateQuietHours returns an error if the quiet hours are invalid.
+func ValidateQuietHours(q QuietHours) error {
+	_, err := newQuietHours(q, time.UTC)
+	return err
+}
+
+// next returns the time at which the quiet hours in the given timezone end
+// if t is in them, or a zero time if it isn't.
+func (q *quietHours) next(t time.Time, tz string) time.Time {
+	var (
+		loc = q.location(tz)
+		lt  = t.In(loc)
+	)
+
+	// Quiet hours that start on the previous day may span midnight into today.
+	for i := -1; i <= 0; i++ {
+		day := time.Date(lt.Year(), lt.Month(), lt.Day()+i, 0, 0, 0, 0, loc)
+
+		start, end := clockAt(day, q.start), clockAt(day, q.end)
+		if !t.Before(start) && t.Before(end) {
+			return end
+		}
+	}
+
+	return time.Time{}
+}
+
+// location returns the timezone with the given name, or the default
+// timezone if it's empty or unknown.
+func (q *quietHours) location(tz string) *time.Location {
+	if tz == "" {
+		return q.def
+	}
+
+	q.mut.Lock()
+	defer q.mut.Unlock()
+
+	loc, ok := q.locs[tz]
+	if !ok {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			l = q.def
+		}
+		loc = l
+		q.locs[tz] = loc
+	}
+
+	return loc
+}
+
+// loadFrequencyCap loads the frequency cap of the campaign, which is the
+// stricter of the global cap and those of the campaign's lists.
+func (p *pipe) loadFrequencyCap() error {
+	// Opt-in confirmations aren't capped.
+	if p.camp.Type == models.CampaignTypeOptin {
+		return nil
+	}
+
+	daily, weekly, err := p.m.store.GetCampaignFrequencyCap(p.camp.ID)
+	if err != nil {
+		return fmt.Errorf("error fetching campaign frequency cap (%s): %v", p.camp.Name, err)
+	}
+
+	c := p.m.cfg.FrequencyCap.merge(daily, weekly)
+	if !c.IsZero() {
+		p.freqCap = &c
+	}
+
+	return nil
+}
+
+// holdSubscriber returns the time until which a campaign message to the
+// subscriber has to be held for their frequency cap or quiet hours, or a
+// zero time if it can be sent right away. An error is returned if the message
+// is to be skipped as the subscriber is over the cap, or as it'd have to be
+// held past the campaign's send deadline.
+func (p *pipe) holdSubscriber(tz string, sentAt []time.Time) (time.Time, error) {
+	var (
+		now = time.Now()
+		at  time.Time
+	)
+
+	if p.freqCap != nil {
+		at = p.freqCap.next(now, sentAt)
+		if !at.IsZero() && !p.freqCap.Defer {
+			return at, errFrequencyCapped
+		}
+	}
+
+	if p.m.quiet != nil && p.camp.Type != models.CampaignTypeOptin {
+		t := now
+		if at.After(t) {
+			t = at
+		}
+		if q := p.m.quiet.next(t, tz); !q.IsZero() {
+			at = q
+		}
+	}
+
+	if p.camp.SendUntil.Valid && at.After(p.camp.SendUntil.Time) {
+		return at, errHeldPastDeadline
+	}
+
+	return at, nil
+}
@@ -6,6 +6,8 @@ import (
 	"html/template"
 	"log"
 	"net/textproto"
+	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -23,17 +25,44 @@ const (
 	ContentTpl = "content"
 
 	dummyUUID = "00000000-0000-0000-0000-000000000000"
+
+	// SeedUUID is the subscriber UUID in messages sent to the seed addresses.
+	// Views and clicks from them aren't recorded.
+	SeedUUID = "00000000-0000-0000-0000-000000000001"
+)
+
+// Campaign lifecycle events.
+const (
+	EventCampaignScheduled = "campaign.scheduled"
+	EventCampaignStarted   = "campaign.started"
+	EventCampaignPaused    = "campaign.paused"
+	EventCampaignCancelled = "campaign.cancelled"
+	EventCampaignFinished  = "campaign.finished"
+	EventCampaignError     = "campaign.error"
 )
 
 // Store represents a data backend, such as a database,
 // that provides subscriber and campaign records.
 type Store interface {
-	NextCampaigns(currentIDs []int64, sentCounts []int64) ([]*models.Campaign, error)
-	NextSubscribers(campID, limit int) ([]models.Subscriber, error)
+	NextCampaigns(currentIDs []int64, sentCounts []int64, segments []int64, costs []float64, localLead time.Duration) ([]*models.Campaign, error)
+	NextSubscribers(campID, limit int, timezones []string) ([]models.Subscriber, error)
 	GetCampaign(campID int) (*models.Campaign, error)
+	GetCampaignTimezones(campID int) ([]string, error)
+	UpdateCampaignTZBucket(campID int, sendAt time.Time) error
+	UpdateCampaignRollout(campID int, heldUntil time.Time, checked bool) error
+	CountCampaignBounces(campID int) (int, int, error)
 	GetAttachment(mediaID int) (models.Attachment, error)
 	UpdateCampaignStatus(campID int, status string) error
-	UpdateCampaignCounts(campID int, toSend int, sent int, lastSubID int) error
+	ExpireCampaign(campID int) error
+	UpdateCampaignCounts(campID int, toSend int, sent int, lastSubID int, segments int, cost float64) error
+	RewindCampaign(campID int, lastSubID int) error
+	RecordDeliveries(campID, contentVersion int, subIDs []int64, messengers, statuses, errs, errTypes []string) error
+	CountDeliveries(messenger string, since time.Time) (int, error)
+	AddMessengerUsage(messengers, dates []string, counts []int) error
+	CountMessengerUsage(messenger string, day, month time.Time) (int, int, error)
+	GetCampaignFrequencyCap(campID int) (int, int, error)
+	GetSubscriberSends(campID int, subIDs []int64) (map[int64][]time.Time, error)
+	LoadSubscriberMeta(subs []models.Subscriber) error
 	CreateLink(url string) (string, error)
 	BlocklistSubscriber(id int64) error
 	DeleteSubscriber(id int64) error
@@ -48,9 +77,32 @@ type Messenger interface {
 	Close() error
 }
 
+// AttachmentScanner scans attachments before they're sent. Scan returns
+// the name of the threat found in a file, if any.
+type AttachmentScanner interface {
+	Scan(name string, b []byte) (string, error)
+}
+
+// AttachmentLimiter is an optional interface that Messengers can implement
+// to limit the total size (bytes) of attachments in a message. 0 is no limit.
+type AttachmentLimiter interface {
+	MaxAttachmentSize() int64
+}
+
+// ChannelMessenger is an optional interface that Messengers that deliver to
+// a subscriber channel other than e-mail (phone|push|messenger) implement.
+// Campaign messages on them are only sent to the subscribers who have an
+// identity on the channel and have consented to it.
+type ChannelMessenger interface {
+	Channel() string
+}
+
 // CampStats contains campaign stats like per minute send rate.
 type CampStats struct {
 	SendRate int
+
+	// Number of messages that errored in the current run.
+	Errors int
 }
 
 // Manager handles the scheduling, processing, and queuing of campaigns
@@ -70,13 +122,17 @@ type Manager struct {
 	tpls    map[int]*models.Template
 	tplsMut sync.RWMutex
 
+	// Template partials by name that are included with {{ Partial "name" }}.
+	partials    map[string]*models.TemplatePartial
+	partialsMut sync.RWMutex
+
 	// Links generated using Track() are cached here so as to not query
 	// the database for the link UUID for every message sent. This has to
 	// be locked as it may be used externally when previewing campaigns.
 	links    map[string]string
 	linksMut sync.RWMutex
 
-	nextPipes chan *pipe
+	nextPipes *pipeQueue
 	campMsgQ  chan CampaignMessage
 	msgQ      chan models.Message
 
@@ -86,6 +142,16 @@ type Manager struct {
 	slidingCount int
 	slidingStart time.Time
 
+	// Per recipient domain send rate limits.
+	throttle *domainThrottle
+
+	// Daily send volumes of messengers that are being warmed up.
+	warmups *warmupQuota
+	quotas  *sendQuotas
+
+	// Do-not-disturb window of subscribers.
+	quiet *quietHours
+
 	tplFuncs template.FuncMap
 }
 
@@ -95,14 +161,24 @@ type CampaignMessage struct {
 	Campaign   *models.Campaign
 	Subscriber models.Subscriber
 
-	from     string
-	to       string
-	subject  string
-	body     []byte
-	altBody  []byte
-	unsubURL string
+	from      string
+	to        string
+	subject   string
+	preheader string
+	body      []byte
+	altBody   []byte
+	ampBody   []byte
+	unsubURL  string
 
-	pipe *pipe
+	// Number of tracked links rendered in the HTML body, which are counted
+	// while countLinks is set.
+	numLinks   int
+	countLinks bool
+
+	// Pipe of the campaign that the message is sent from and the pipe's
+	// timezone bucket that it was fetched in.
+	pipe   *pipe
+	bucket int
 }
 
 // Config has parameters for configuring the manager.
@@ -112,6 +188,7 @@ type Config struct {
 	Concurrency           int
 	MessageRate           int
 	MaxSendErrors         int
+	FailoverErrors        int
 	SlidingWindow         bool
 	SlidingWindowDuration time.Duration
 	SlidingWindowRate     int
@@ -120,6 +197,7 @@ type Config struct {
 	IndividualTracking    bool
 	LinkTrackURL          string
 	UnsubURL              string
+	PrefsURL              string
 	OptinURL              string
 	MessageURL            string
 	ViewTrackURL          string
@@ -127,6 +205,49 @@ type Config struct {
 	RootURL               string
 	UnsubHeader           bool
 
+	// Max total size (bytes) of attachments in a campaign message. 0 is no limit.
+	MaxAttachmentSize int64
+
+	// Optional scanner that campaign and transactional attachments are
+	// scanned with before they're sent.
+	AttachmentScanner AttachmentScanner
+
+	// Max number of messages that can be sent to recipients of a
+	// domain (eg: yahoo.com) in a window of time across all campaigns.
+	DomainLimits map[string]DomainLimit
+
+	// Optional callback that returns true if the domain of a recipient's
+	// e-mail is blocklisted. Campaign messages to them are skipped.
+	DomainBlocklisted func(email string) bool
+
+	// Internal addresses that every campaign is also sent to when it starts
+	// for checking deliverability. They're excluded from the campaign's stats.
+	SeedEmails []string
+
+	// Daily send volume ramps of messengers (SMTP servers) that are being
+	// warmed up on new IPs. Messages over a day's volume are held and
+	// sent on the following days.
+	Warmups map[string][]Warmup
+
+	// Daily and monthly send quotas of messengers.
+	Quotas map[string]Quota
+
+	// Max number of campaigns that a subscriber can be sent in a day and a
+	// week, which lists can make stricter, and the daily window in which no
+	// campaigns are sent to subscribers.
+	FrequencyCap FrequencyCap
+	QuietHours   QuietHours
+
+	// Estimated costs of messages per messenger. Messengers that aren't
+	// in the map cost DefaultCost per message.
+	Costs       map[string]MessageCost
+	DefaultCost float64
+
+	// DefaultTimezone is the timezone in which the send_at wall-clock time of
+	// local time campaigns is read. Subscribers without a (valid) timezone
+	// attribute are also sent to in this timezone.
+	DefaultTimezone *time.Location
+
 	// Interval to scan the DB for active campaign checkpoints.
 	ScanInterval time.Duration
 
@@ -136,6 +257,10 @@ type Config struct {
 	// (exposed to the internet, private etc.) where only one does campaign
 	// processing while the others handle other kinds of traffic.
 	ScanCampaigns bool
+
+	// Optional callback that's called with the campaign lifecycle events
+	// (EventCampaign*) in the manager and the reason for them, if any.
+	EventCB func(event string, campID int, reason string)
 }
 
 type msgError struct {
@@ -156,6 +281,9 @@ func New(cfg Config, store Store, notifCB models.AdminNotifCallback, i *i18n.I18
 	if cfg.MessageRate < 1 {
 		cfg.MessageRate = 1
 	}
+	if cfg.DefaultTimezone == nil {
+		cfg.DefaultTimezone = time.UTC
+	}
 
 	m := &Manager{
 		cfg:          cfg,
@@ -166,14 +294,24 @@ func New(cfg Config, store Store, notifCB models.AdminNotifCallback, i *i18n.I18
 		messengers:   make(map[string]Messenger),
 		pipes:        make(map[int]*pipe),
 		tpls:         make(map[int]*models.Template),
+		partials:     make(map[string]*models.TemplatePartial),
 		links:        make(map[string]string),
-		nextPipes:    make(chan *pipe, 1000),
+		nextPipes:    newPipeQueue(),
 		campMsgQ:     make(chan CampaignMessage, cfg.Concurrency*cfg.MessageRate*2),
 		msgQ:         make(chan models.Message, cfg.Concurrency*cfg.MessageRate*2),
 		slidingStart: time.Now(),
+		throttle:     newDomainThrottle(cfg.DomainLimits),
 	}
+	m.warmups = newWarmupQuota(cfg.Warmups, cfg.DefaultTimezone, store.CountDeliveries)
+	m.quotas = newSendQuotas(cfg.Quotas, cfg.DefaultTimezone, store.CountMessengerUsage)
 	m.tplFuncs = m.makeGnericFuncMap()
 
+	q, err := newQuietHours(cfg.QuietHours, cfg.DefaultTimezone)
+	if err != nil {
+		l.Printf("error loading quiet hours. ignoring: %v", err)
+	}
+	m.quiet = q
+
 	return m
 }
 
@@ -188,8 +326,13 @@ func (m *Manager) AddMessenger(msg Messenger) error {
 }
 
 // PushMessage pushes an arbitrary non-campaign Message to be sent out by the workers.
-// It times out if the queue is busy.
+// It times out if the queue is busy, and returns ErrQuotaExceeded if the
+// messenger's send quota is exhausted.
 func (m *Manager) PushMessage(msg models.Message) error {
+	if _, err := m.quotas.reserve(msg.Messenger, false); err != nil {
+		return err
+	}
+
 	t := time.NewTicker(pushTimeout)
 	defer t.Stop()
 
@@ -203,8 +346,13 @@ func (m *Manager) PushMessage(msg models.Message) error {
 }
 
 // PushCampaignMessage pushes a campaign messages into a queue to be sent out by the workers.
-// It times out if the queue is busy.
+// It times out if the queue is busy, and returns ErrQuotaExceeded if the
+// messenger's send quota is exhausted.
 func (m *Manager) PushCampaignMessage(msg CampaignMessage) error {
+	if _, err := m.quotas.reserve(msg.Campaign.Messenger, false); err != nil {
+		return err
+	}
+
 	t := time.NewTicker(pushTimeout)
 	defer t.Stop()
 
@@ -237,15 +385,16 @@ func (m *Manager) HasRunningCampaigns() bool {
 
 // GetCampaignStats returns campaign statistics.
 func (m *Manager) GetCampaignStats(id int) CampStats {
-	n := 0
+	var out CampStats
 
 	m.pipesMut.Lock()
 	if c, ok := m.pipes[id]; ok {
-		n = int(c.rate.Rate())
+		out.SendRate = int(c.rate.Rate())
+		out.Errors = int(c.errors.Load())
 	}
 	m.pipesMut.Unlock()
 
-	return CampStats{SendRate: n}
+	return out
 }
 
 // Run is a blocking function (that should be invoked as a goroutine)
@@ -261,14 +410,22 @@ func (m *Manager) Run() {
 		go m.scanCampaigns(m.cfg.ScanInterval)
 	}
 
+	// Periodically record the messages sent through messengers.
+	go m.flushUsage(time.Second * 5)
+
 	// Spawn N message workers.
 	for i := 0; i < m.cfg.Concurrency; i++ {
 		go m.worker()
 	}
 
 	// Indefinitely wait on the pipe queue to fetch the next set of subscribers
-	// for any active campaigns.
-	for p := range m.nextPipes {
+	// for any active campaigns in the order of their priorities.
+	for {
+		p, ok := m.nextPipes.pop()
+		if !ok {
+			return
+		}
+
 		has, err := p.NextSubscribers()
 		if err != nil {
 			m.log.Printf("error processing campaign batch (%s): %v", p.camp.Name, err)
@@ -276,11 +433,14 @@ func (m *Manager) Run() {
 		}
 
 		if has {
-			// There are more subscribers to fetch. Queue again.
-			select {
-			case m.nextPipes <- p:
-			default:
+			// The pipe is waiting for its next timezone bucket to be due.
+			// scanCampaigns() queues it again when it is.
+			if p.holdUntil.Load() > 0 {
+				continue
 			}
+
+			// There are more subscribers to fetch. Queue again.
+			m.nextPipes.push(p)
 		} else {
 			// Mark the pseudo counter that's added in makePipe() that is used
 			// to force a wait on a pipe.
@@ -319,23 +479,65 @@ func (m *Manager) GetTpl(id int) (*models.Template, error) {
 // TemplateFuncs returns the template functions to be applied into
 // compiled campaign templates.
 func (m *Manager) TemplateFuncs(c *models.Campaign) template.FuncMap {
+	// UTM params that are appended to every tracked link in the campaign.
+	var utm url.Values
+	if c != nil {
+		u, err := makeUTMParams(c)
+		if err != nil {
+			m.log.Printf("error loading UTM params (%s): %v", c.Name, err)
+		}
+		utm = u
+	}
+
+	// Links and views are tracked on the campaign's (or its lists')
+	// tracking domain instead of the root URL, if there's one.
+	linkURL, viewURL := m.cfg.LinkTrackURL, m.cfg.ViewTrackURL
+	if c != nil {
+		d := c.TrackingDomain
+		if d == "" {
+			d = c.ListTrackingDomain
+		}
+		if d != "" {
+			linkURL = d + strings.TrimPrefix(linkURL, m.cfg.RootURL)
+			viewURL = d + strings.TrimPrefix(viewURL, m.cfg.RootURL)
+		}
+	}
+
 	f := template.FuncMap{
 		"TrackLink": func(url string, msg *CampaignMessage) string {
 			subUUID := msg.Subscriber.UUID
-			if !m.cfg.IndividualTracking {
+			if !m.cfg.IndividualTracking && subUUID != SeedUUID {
 				subUUID = dummyUUID
 			}
 
-			return m.trackLink(url, msg.Campaign.UUID, subUUID)
+			// Links in the HTML body are numbered by their positions.
+			pos := 0
+			if msg.countLinks {
+				msg.numLinks++
+				pos = msg.numLinks
+			}
+
+			url = appendUTMParams(strings.ReplaceAll(url, "&amp;", "&"), utm)
+			return m.trackLink(url, linkURL, msg.Campaign.UUID, subUUID, pos)
 		},
 		"TrackView": func(msg *CampaignMessage) template.HTML {
 			subUUID := msg.Subscriber.UUID
-			if !m.cfg.IndividualTracking {
+			if !m.cfg.IndividualTracking && subUUID != SeedUUID {
 				subUUID = dummyUUID
 			}
 
 			return template.HTML(fmt.Sprintf(`<img src="%s" alt="" />`,
-				fmt.Sprintf(m.cfg.ViewTrackURL, msg.Campaign.UUID, subUUID)))
+				fmt.Sprintf(viewURL, msg.Campaign.UUID, subUUID)))
+		},
+		"Preheader": func(msg *CampaignMessage) template.HTML {
+			if msg.preheader == "" {
+				return ""
+			}
+
+			// The text is followed by invisible padding so that clients don't
+			// fill the rest of the preview with the body's text.
+			return template.HTML(`<div style="display:none;font-size:1px;line-height:1px;max-height:0;max-width:0;opacity:0;overflow:hidden;mso-hide:all;">` +
+				template.HTMLEscapeString(msg.preheader) + strings.Repeat("&#847;&zwnj;&nbsp;", 90) + `</div>`)
 		},
 		"UnsubscribeURL": func(msg *CampaignMessage) string {
 			return msg.unsubURL
@@ -343,6 +545,9 @@ func (m *Manager) TemplateFuncs(c *models.Campaign) template.FuncMap {
 		"ManageURL": func(msg *CampaignMessage) string {
 			return msg.unsubURL + "?manage=true"
 		},
+		"PreferencesURL": func(msg *CampaignMessage) string {
+			return fmt.Sprintf(m.cfg.PrefsURL, msg.Subscriber.UUID)
+		},
 		"OptinURL": func(msg *CampaignMessage) string {
 			// Add list IDs.
 			// TODO: Show private lists list on optin e-mail
@@ -354,15 +559,50 @@ func (m *Manager) TemplateFuncs(c *models.Campaign) template.FuncMap {
 		"ArchiveURL": func() string {
 			return m.cfg.ArchiveURL
 		},
+		"CampaignArchiveURL": func(msg *CampaignMessage) string {
+			id := msg.Campaign.UUID
+			if msg.Campaign.ArchiveSlug.Valid {
+				id = msg.Campaign.ArchiveSlug.String
+			}
+
+			u := m.cfg.ArchiveURL + "/" + url.PathEscape(id)
+
+			// Subscribers-only campaigns are accessed with the subscriber's UUID.
+			if msg.Campaign.ArchiveAccess == models.CampaignArchiveAccessSubscriber {
+				u += "?token=" + msg.Subscriber.UUID
+			}
+			return u
+		},
 		"RootURL": func() string {
 			return m.cfg.RootURL
 		},
+		"InList": func(msg *CampaignMessage, list interface{}) bool {
+			return inList(msg.Subscriber, list)
+		},
+		"Engagement": func(msg *CampaignMessage) models.SubscriberEngagement {
+			if msg.Subscriber.Engagement == nil {
+				return models.SubscriberEngagement{}
+			}
+			return *msg.Subscriber.Engagement
+		},
+		"EngagedWithin": func(msg *CampaignMessage, dur string) (bool, error) {
+			d, err := time.ParseDuration(dur)
+			if err != nil {
+				return false, err
+			}
+
+			e := msg.Subscriber.Engagement
+			return e != nil && e.LastEngagedAt.Valid && time.Since(e.LastEngagedAt.Time) <= d, nil
+		},
 	}
 
 	for k, v := range m.tplFuncs {
 		f[k] = v
 	}
 
+	// Partials are compiled with the campaign's functions.
+	f["Partial"] = m.partialFunc(f)
+
 	return f
 }
 
@@ -371,18 +611,23 @@ func (m *Manager) GenericTemplateFuncs() template.FuncMap {
 }
 
 // StopCampaign marks a running campaign as stopped so that all its queued messages are ignored.
-func (m *Manager) StopCampaign(id int) {
+// It returns false if the campaign isn't being processed.
+func (m *Manager) StopCampaign(id int) bool {
 	m.pipesMut.RLock()
-	if p, ok := m.pipes[id]; ok {
+	p, ok := m.pipes[id]
+	if ok {
 		p.Stop(false)
 	}
 	m.pipesMut.RUnlock()
+
+	return ok
 }
 
 // Close closes and exits the campaign manager.
 func (m *Manager) Close() {
-	close(m.nextPipes)
+	m.nextPipes.close()
 	close(m.msgQ)
+	m.recordUsage()
 }
 
 // scanCampaigns is a blocking function that periodically scans the data source
@@ -396,8 +641,10 @@ func (m *Manager) scanCampaigns(tick time.Duration) {
 		select {
 		// Periodically scan the data source for campaigns to process.
 		case <-t.C:
-			ids, counts := m.getCurrentCampaigns()
-			campaigns, err := m.store.NextCampaigns(ids, counts)
+			m.releaseHeldPipes()
+
+			ids, counts, segments, costs := m.getCurrentCampaigns()
+			campaigns, err := m.store.NextCampaigns(ids, counts, segments, costs, m.localLead())
 			if err != nil {
 				m.log.Printf("error fetching campaigns: %v", err)
 				continue
@@ -411,14 +658,9 @@ func (m *Manager) scanCampaigns(tick time.Duration) {
 					continue
 				}
 				m.log.Printf("start processing campaign (%s)", c.Name)
+				m.fireEvent(EventCampaignStarted, c.ID, "")
 
-				// If subscriber processing is busy, move on. Blocking and waiting
-				// can end up in a race condition where the waiting campaign's
-				// state in the data source has changed.
-				select {
-				case m.nextPipes <- p:
-				default:
-				}
+				m.nextPipes.push(p)
 			}
 		}
 	}
@@ -437,8 +679,8 @@ func (m *Manager) worker() {
 				return
 			}
 
-			// If the campaign has ended, ignore the message.
-			if msg.pipe != nil && msg.pipe.stopped.Load() {
+			// If the campaign has ended or is past its send deadline, ignore the message.
+			if msg.pipe != nil && (msg.pipe.stopped.Load() || msg.pipe.expire()) {
 				msg.pipe.wg.Done()
 				continue
 			}
@@ -458,6 +700,7 @@ func (m *Manager) worker() {
 				ContentType: msg.Campaign.ContentType,
 				Body:        msg.body,
 				AltBody:     msg.altBody,
+				AMPBody:     msg.ampBody,
 				Subscriber:  msg.Subscriber,
 				Campaign:    msg.Campaign,
 				Attachments: msg.Campaign.Attachments,
@@ -482,11 +725,39 @@ func (m *Manager) worker() {
 				}
 			}
 
+			// The campaign's List-ID overrides the one in the custom headers and,
+			// as message headers replace them, the messenger's default headers.
+			if msg.Campaign.ListIDHeader != "" {
+				h.Set("List-Id", msg.Campaign.ListIDHeader)
+			}
+
 			out.Headers = h
 
-			err := m.messengers[msg.Campaign.Messenger].Push(out)
+			// Campaign messages are pushed via the pipe that fails over to the
+			// campaign's failover messengers. Test messages don't have a pipe.
+			var (
+				msgr = msg.Campaign.Messenger
+				err  error
+			)
+			if msg.pipe != nil {
+				msgr, err = msg.pipe.push(out)
+			} else {
+				err = m.messengers[msgr].Push(out)
+			}
 			if err != nil {
 				m.log.Printf("error sending message in campaign %s: subscriber %d: %v", msg.Campaign.Name, msg.Subscriber.ID, err)
+			} else {
+				m.quotas.addSent(msgr)
+			}
+
+			// Count SMS segments for messengers that are charged per segment.
+			segments := 0
+			if err == nil && msg.pipe != nil && m.messageCost(msgr).PerSegment {
+				if len(out.AltBody) > 0 {
+					segments = smsSegments(string(out.AltBody))
+				} else {
+					segments = smsSegments(string(out.Body))
+				}
 			}
 
 			// Increment the send rate or the error counter if there was an error.
@@ -495,14 +766,14 @@ func (m *Manager) worker() {
 				msg.pipe.wg.Done()
 
 				if err != nil {
+					msg.pipe.addDeliveryError(int64(msg.Subscriber.ID), msgr, sendErrorType(err), err)
 					msg.pipe.OnError()
 				} else {
-					id := uint64(msg.Subscriber.ID)
-					if id > msg.pipe.lastID.Load() {
-						msg.pipe.lastID.Store(uint64(msg.Subscriber.ID))
-					}
+					msg.pipe.setLastID(msg.Subscriber.ID, msg.bucket)
 					msg.pipe.rate.Incr(1)
 					msg.pipe.sent.Add(1)
+					msg.pipe.segments.Add(int64(segments))
+					msg.pipe.addDelivery(int64(msg.Subscriber.ID), msgr, m.estimateCost(msgr, 1, int64(segments)))
 				}
 			}
 
@@ -515,6 +786,8 @@ func (m *Manager) worker() {
 			err := m.messengers[msg.Messenger].Push(msg)
 			if err != nil {
 				m.log.Printf("error sending message '%s': %v", msg.Subject, err)
+			} else {
+				m.quotas.addSent(msg.Messenger)
 			}
 		}
 	}
@@ -533,26 +806,33 @@ func (m *Manager) getRunningCampaignIDs() []int64 {
 }
 
 // getCurrentCampaigns returns the IDs of campaigns currently being processed
-// and their sent counts.
-func (m *Manager) getCurrentCampaigns() ([]int64, []int64) {
+// and their sent counts, SMS segment counts, and estimated costs. It also
+// flushes the campaigns' delivery records to the DB.
+func (m *Manager) getCurrentCampaigns() ([]int64, []int64, []int64, []float64) {
 	// Needs to return an empty slice in case there are no campaigns.
 	m.pipesMut.RLock()
 	defer m.pipesMut.RUnlock()
 
 	var (
-		ids    = make([]int64, 0, len(m.pipes))
-		counts = make([]int64, 0, len(m.pipes))
+		ids      = make([]int64, 0, len(m.pipes))
+		counts   = make([]int64, 0, len(m.pipes))
+		segments = make([]int64, 0, len(m.pipes))
+		costs    = make([]float64, 0, len(m.pipes))
 	)
 	for _, p := range m.pipes {
 		ids = append(ids, int64(p.camp.ID))
 
 		// Get the sent counts for campaigns and reset them to 0
 		// as in the database, they're stored cumulatively (sent += $newSent).
-		counts = append(counts, p.sent.Load())
-		p.sent.Store(0)
+		sent, segs := p.sent.Swap(0), p.segments.Swap(0)
+		counts = append(counts, sent)
+		segments = append(segments, segs)
+		costs = append(costs, p.takeCost())
+
+		p.flushDeliveries()
 	}
 
-	return ids, counts
+	return ids, counts, segments, costs
 }
 
 // isCampaignProcessing checks if the campaign is being processed.
@@ -565,13 +845,18 @@ func (m *Manager) isCampaignProcessing(id int) bool {
 
 // trackLink register a URL and return its UUID to be used in message templates
 // for tracking links.
-func (m *Manager) trackLink(url, campUUID, subUUID string) string {
+func (m *Manager) trackLink(url, trackURL, campUUID, subUUID string, pos int) string {
 	url = strings.ReplaceAll(url, "&amp;", "&")
 
+	// Position of the link in the body, if any, which is recorded with clicks.
+	if pos > 0 {
+		trackURL += "?p=" + strconv.Itoa(pos)
+	}
+
 	m.linksMut.RLock()
 	if uu, ok := m.links[url]; ok {
 		m.linksMut.RUnlock()
-		return fmt.Sprintf(m.cfg.LinkTrackURL, uu, campUUID, subUUID)
+		return fmt.Sprintf(trackURL, uu, campUUID, subUUID)
 	}
 	m.linksMut.RUnlock()
 
@@ -588,7 +873,7 @@ func (m *Manager) trackLink(url, campUUID, subUUID string) string {
 	m.links[url] = uu
 	m.linksMut.Unlock()
 
-	return fmt.Sprintf(m.cfg.LinkTrackURL, uu, campUUID, subUUID)
+	return fmt.Sprintf(trackURL, uu, campUUID, subUUID)
 }
 
 // sendNotif sends a notification to registered admin e-mails.
@@ -607,6 +892,13 @@ func (m *Manager) sendNotif(c *models.Campaign, status, reason string) error {
 	return m.notifCB(subject, data)
 }
 
+// fireEvent calls the event callback, if there's one, with a campaign event.
+func (m *Manager) fireEvent(event string, campID int, reason string) {
+	if m.cfg.EventCB != nil {
+		m.cfg.EventCB(event, campID, reason)
+	}
+}
+
 func (m *Manager) makeGnericFuncMap() template.FuncMap {
 	f := template.FuncMap{
 		"Date": func(layout string) string {
@@ -626,24 +918,89 @@ func (m *Manager) makeGnericFuncMap() template.FuncMap {
 	for k, v := range sprig.GenericFuncMap() {
 		f[k] = v
 	}
+	f["Partial"] = m.partialFunc(f)
 
 	return f
 }
 
 func (m *Manager) attachMedia(c *models.Campaign) error {
 	// Load any media/attachments.
+	var (
+		max  = m.MaxAttachmentSize(c.Messenger)
+		size int64
+		out  = make([]models.Attachment, 0, len(c.MediaIDs))
+	)
 	for _, mid := range []int64(c.MediaIDs) {
 		a, err := m.store.GetAttachment(int(mid))
 		if err != nil {
 			return fmt.Errorf("error fetching attachment %d on campaign %s: %v", mid, c.Name, err)
 		}
 
-		c.Attachments = append(c.Attachments, a)
+		size += int64(len(a.Content))
+		if max > 0 && size > max {
+			return fmt.Errorf("attachments on campaign %s exceed the max size of %d KB", c.Name, max/1024)
+		}
+
+		out = append(out, a)
+	}
+
+	if err := m.ScanAttachments(out); err != nil {
+		return fmt.Errorf("error in attachments on campaign %s: %v", c.Name, err)
 	}
+	c.Attachments = out
 
 	return nil
 }
 
+// ScanAttachments scans the given attachments with the attachment scanner,
+// if there's one, and returns an error if any of them is flagged or can't
+// be scanned.
+func (m *Manager) ScanAttachments(atts []models.Attachment) error {
+	if m.cfg.AttachmentScanner == nil {
+		return nil
+	}
+
+	for _, a := range atts {
+		threat, err := m.cfg.AttachmentScanner.Scan(a.Name, a.Content)
+		if err != nil {
+			m.log.Printf("error scanning attachment %s: %v", a.Name, err)
+			return fmt.Errorf("error scanning attachment %s: %v", a.Name, err)
+		}
+
+		if threat != "" {
+			m.log.Printf("attachment %s flagged by scanner: %s", a.Name, threat)
+			return fmt.Errorf("attachment %s flagged by scanner: %s", a.Name, threat)
+		}
+	}
+
+	return nil
+}
+
+// MaxAttachmentSize returns the max total size (bytes) of attachments in a message
+// sent via the given messenger. It's the smaller of the global limit and the
+// messenger's own limit, if it has one. 0 is no limit.
+func (m *Manager) MaxAttachmentSize(messenger string) int64 {
+	n := m.cfg.MaxAttachmentSize
+
+	if l, ok := m.messengers[messenger].(AttachmentLimiter); ok {
+		if max := l.MaxAttachmentSize(); max > 0 && (n == 0 || max < n) {
+			n = max
+		}
+	}
+
+	return n
+}
+
+// messengerChannel returns the subscriber channel that a messenger delivers
+// to, or an empty string for e-mail.
+func (m *Manager) messengerChannel(messenger string) string {
+	if c, ok := m.messengers[messenger].(ChannelMessenger); ok {
+		return c.Channel()
+	}
+
+	return ""
+}
+
 // MakeAttachmentHeader is a helper function that returns a
 // textproto.MIMEHeader tailored for attachments, primarily
 // email. If no encoding is given, base64 is assumed.
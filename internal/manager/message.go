@@ -3,14 +3,19 @@ package manager
 import (
 	"bytes"
 	"fmt"
+	"strings"
 
+	"github.com/knadh/listmonk/internal/htmltext"
 	"github.com/knadh/listmonk/models"
 )
 
 // NewCampaignMessage creates and returns a CampaignMessage that is made available
 // to message templates while they're compiled. It represents a message from
-// a campaign that's bound to a single Subscriber.
+// a campaign that's bound to a single Subscriber. If the campaign has a
+// language variant for the subscriber's locale, it's rendered instead.
 func (m *Manager) NewCampaignMessage(c *models.Campaign, s models.Subscriber) (CampaignMessage, error) {
+	c = c.ForLocale(s.Locale)
+
 	msg := CampaignMessage{
 		Campaign:   c,
 		Subscriber: s,
@@ -28,37 +33,93 @@ func (m *Manager) NewCampaignMessage(c *models.Campaign, s models.Subscriber) (C
 	return msg, nil
 }
 
+// RenderCampaignSubject renders only the subject and the preheader of a
+// campaign (or its language variant) for a subscriber.
+func (m *Manager) RenderCampaignSubject(c *models.Campaign, s models.Subscriber) (string, string, error) {
+	c = c.ForLocale(s.Locale)
+
+	msg := CampaignMessage{
+		Campaign:   c,
+		Subscriber: s,
+
+		subject:  c.Subject,
+		from:     c.FromEmail,
+		to:       s.Email,
+		unsubURL: fmt.Sprintf(m.cfg.UnsubURL, c.UUID, s.UUID),
+	}
+	if err := msg.renderSubject(); err != nil {
+		return "", "", err
+	}
+
+	return msg.subject, msg.preheader, nil
+}
+
 // render takes a Message, executes its pre-compiled Campaign.Tpl
 // and applies the resultant bytes to Message.body to be used in messages.
 func (m *CampaignMessage) render() error {
-	out := bytes.Buffer{}
-
-	// Render the subject if it's a template.
-	if m.Campaign.SubjectTpl != nil {
-		if err := m.Campaign.SubjectTpl.ExecuteTemplate(&out, models.ContentTpl, m); err != nil {
-			return err
-		}
-		m.subject = out.String()
-		out.Reset()
+	if err := m.renderSubject(); err != nil {
+		return err
 	}
 
+	out := bytes.Buffer{}
+
 	// Compile the main template.
-	if err := m.Campaign.Tpl.ExecuteTemplate(&out, models.BaseTpl, m); err != nil {
+	m.numLinks, m.countLinks = 0, true
+	err := m.Campaign.Tpl.ExecuteTemplate(&out, models.BaseTpl, m)
+	m.countLinks = false
+	if err != nil {
 		return err
 	}
 	m.body = out.Bytes()
 
-	// Is there an alt body?
-	if m.Campaign.ContentType != models.CampaignContentTypePlain && m.Campaign.AltBody.Valid {
+	// Is there an alt body? If there isn't one, it's generated from the
+	// rendered HTML body.
+	if m.Campaign.ContentType != models.CampaignContentTypePlain {
 		if m.Campaign.AltBodyTpl != nil {
 			b := bytes.Buffer{}
 			if err := m.Campaign.AltBodyTpl.ExecuteTemplate(&b, models.ContentTpl, m); err != nil {
 				return err
 			}
 			m.altBody = b.Bytes()
-		} else {
+		} else if m.Campaign.AltBody.Valid && strings.TrimSpace(m.Campaign.AltBody.String) != "" {
 			m.altBody = []byte(m.Campaign.AltBody.String)
+		} else {
+			m.altBody = htmltext.FromHTML(m.body)
+		}
+	}
+
+	// Is there an AMP body?
+	if m.Campaign.ContentType != models.CampaignContentTypePlain && m.Campaign.AMPTpl != nil {
+		b := bytes.Buffer{}
+		if err := m.Campaign.AMPTpl.ExecuteTemplate(&b, models.BaseTpl, m); err != nil {
+			return err
+		}
+		m.ampBody = b.Bytes()
+	}
+
+	return nil
+}
+
+// renderSubject executes the campaign's pre-compiled subject and preheader
+// templates, if they're templates.
+func (m *CampaignMessage) renderSubject() error {
+	out := bytes.Buffer{}
+
+	// Render the subject if it's a template.
+	if m.Campaign.SubjectTpl != nil {
+		if err := m.Campaign.SubjectTpl.ExecuteTemplate(&out, models.ContentTpl, m); err != nil {
+			return err
+		}
+		m.subject = out.String()
+		out.Reset()
+	}
+
+	// Render the preheader.
+	if m.Campaign.PreheaderTpl != nil {
+		if err := m.Campaign.PreheaderTpl.ExecuteTemplate(&out, models.ContentTpl, m); err != nil {
+			return err
 		}
+		m.preheader = strings.TrimSpace(out.String())
 	}
 
 	return nil
@@ -69,6 +130,11 @@ func (m *CampaignMessage) Subject() string {
 	return m.subject
 }
 
+// Preheader returns the message's preview text.
+func (m *CampaignMessage) Preheader() string {
+	return m.preheader
+}
+
 // Body returns a copy of the message body.
 func (m *CampaignMessage) Body() []byte {
 	out := make([]byte, len(m.body))
@@ -82,3 +148,10 @@ func (m *CampaignMessage) AltBody() []byte {
 	copy(out, m.altBody)
 	return out
 }
+
+// AMPBody returns a copy of the message's AMP body.
+func (m *CampaignMessage) AMPBody() []byte {
+	out := make([]byte, len(m.ampBody))
+	copy(out, m.ampBody)
+	return out
+}
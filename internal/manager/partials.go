@@ -0,0 +1,80 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"sync"
+
+	"github.com/knadh/listmonk/models"
+)
+
+// compiledPartial is a template partial compiled with the functions of
+// a template that includes it.
+type compiledPartial struct {
+	src *models.TemplatePartial
+	tpl *template.Template
+}
+
+// CachePartials replaces the cached template partials.
+func (m *Manager) CachePartials(partials []models.TemplatePartial) {
+	out := make(map[string]*models.TemplatePartial, len(partials))
+	for _, p := range partials {
+		p := p
+		out[p.Name] = &p
+	}
+
+	m.partialsMut.Lock()
+	m.partials = out
+	m.partialsMut.Unlock()
+}
+
+// HasPartial checks whether there's a cached template partial by the given name.
+func (m *Manager) HasPartial(name string) bool {
+	m.partialsMut.RLock()
+	_, ok := m.partials[name]
+	m.partialsMut.RUnlock()
+
+	return ok
+}
+
+// partialFunc returns the Partial template function that renders a template
+// partial with the data of the template that includes it. Partials are
+// compiled with the template's functions on first use, and are recompiled
+// if they've changed since.
+func (m *Manager) partialFunc(f template.FuncMap) func(string, interface{}) (template.HTML, error) {
+	var (
+		mut      sync.Mutex
+		compiled = make(map[string]compiledPartial)
+	)
+
+	return func(name string, data interface{}) (template.HTML, error) {
+		m.partialsMut.RLock()
+		p, ok := m.partials[name]
+		m.partialsMut.RUnlock()
+		if !ok {
+			return "", fmt.Errorf("partial %s not found", name)
+		}
+
+		mut.Lock()
+		c, ok := compiled[name]
+		if !ok || c.src != p {
+			tpl, err := p.Compile(f)
+			if err != nil {
+				mut.Unlock()
+				return "", err
+			}
+
+			c = compiledPartial{src: p, tpl: tpl}
+			compiled[name] = c
+		}
+		mut.Unlock()
+
+		var b bytes.Buffer
+		if err := c.tpl.ExecuteTemplate(&b, models.PartialTpl, data); err != nil {
+			return "", err
+		}
+
+		return template.HTML(b.String()), nil
+	}
+}
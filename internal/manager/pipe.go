@@ -1,6 +1,7 @@
 package manager
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 	"sync/atomic"
@@ -15,11 +16,72 @@ type pipe struct {
 	rate       *ratecounter.RateCounter
 	wg         *sync.WaitGroup
 	sent       atomic.Int64
-	lastID     atomic.Uint64
+	segments   atomic.Int64
 	errors     atomic.Uint64
 	stopped    atomic.Bool
 	withErrors atomic.Bool
 
+	// Whether the campaign was stopped at its send deadline (send_until).
+	expired atomic.Bool
+
+	// Optional sending window outside of which the pipe is held.
+	window *sendWindow
+
+	// Scheduling priority, pass, and whether the pipe is in the queue (pipeQueue).
+	priority int
+	pass     float64
+	queued   bool
+
+	// Timezone buckets of a local time campaign (send_at_local) in the
+	// order of their send times, the index of the bucket being processed,
+	// and the unix timestamp until which the pipe is on hold waiting for it.
+	buckets   []tzBucket
+	bucket    int
+	holdUntil atomic.Int64
+
+	// Highest subscriber sent to in the timezone bucket being processed,
+	// which is the campaign's subscriber checkpoint, and that bucket.
+	lastID       int
+	lastIDBucket int
+	lastIDMut    sync.Mutex
+
+	// Staged sending of the campaign while it's in its initial stage or
+	// on hold after it.
+	rollout *rollout
+
+	// Reason with which the campaign is paused, other than errors.
+	pauseReason string
+
+	// Subscriber after which the campaign resumes when it's paused in the
+	// middle of a fetched batch, whose checkpoint is already past the batch.
+	rewind   atomic.Bool
+	rewindTo atomic.Int64
+
+	// Frequency cap of the campaign's subscribers, if any.
+	freqCap *FrequencyCap
+
+	// Number of messages that are waiting for their recipient domain's
+	// rate limit window.
+	deferred atomic.Int64
+
+	// Closed when the pipe is stopped.
+	done chan struct{}
+
+	// Whether subscribers' lists and engagement have to be loaded for
+	// rendering the campaign's conditional content.
+	withMeta bool
+
+	// Messengers the campaign is sent through in the order of failover,
+	// the index of the one in use, and its consecutive error count.
+	msgrs      []string
+	msgr       atomic.Int32
+	msgrErrors atomic.Int32
+
+	// Messages delivered since the last flush and their estimated cost.
+	delivs   []delivery
+	cost     float64
+	delivMut sync.Mutex
+
 	m *Manager
 }
 
@@ -28,7 +90,28 @@ func (m *Manager) newPipe(c *models.Campaign) (*pipe, error) {
 	// Validate messenger.
 	if _, ok := m.messengers[c.Messenger]; !ok {
 		m.store.UpdateCampaignStatus(c.ID, models.CampaignStatusCancelled)
-		return nil, fmt.Errorf("unknown messenger %s on campaign %s", c.Messenger, c.Name)
+		err := fmt.Errorf("unknown messenger %s on campaign %s", c.Messenger, c.Name)
+		m.fireEvent(EventCampaignError, c.ID, err.Error())
+		return nil, err
+	}
+
+	// Failover messengers that have since been removed are skipped.
+	msgrs := []string{c.Messenger}
+	for _, name := range c.Failover {
+		if _, ok := m.messengers[name]; !ok {
+			m.log.Printf("skipping unknown failover messenger %s on campaign %s", name, c.Name)
+			continue
+		}
+		msgrs = append(msgrs, name)
+	}
+
+	// Load any media/attachments. Pause the campaign if they can't be sent.
+	// They're loaded before the template is compiled so that the compiled
+	// language variants of the campaign carry them too.
+	if err := m.attachMedia(c); err != nil {
+		m.store.UpdateCampaignStatus(c.ID, models.CampaignStatusPaused)
+		m.fireEvent(EventCampaignError, c.ID, err.Error())
+		return nil, err
 	}
 
 	// Load the template.
@@ -36,17 +119,43 @@ func (m *Manager) newPipe(c *models.Campaign) (*pipe, error) {
 		return nil, err
 	}
 
-	// Load any media/attachments.
-	if err := m.attachMedia(c); err != nil {
-		return nil, err
+	window, err := newSendWindow(c.SendWindow, m.cfg.DefaultTimezone)
+	if err != nil {
+		return nil, fmt.Errorf("error loading sending window on campaign %s: %v", c.Name, err)
 	}
 
 	// Add the campaign to the active map.
 	p := &pipe{
-		camp: c,
-		rate: ratecounter.NewRateCounter(time.Minute),
-		wg:   &sync.WaitGroup{},
-		m:    m,
+		camp:     c,
+		rate:     ratecounter.NewRateCounter(time.Minute),
+		wg:       &sync.WaitGroup{},
+		msgrs:    msgrs,
+		window:   window,
+		priority: campPriority(c),
+		done:     make(chan struct{}),
+		withMeta: needsSubscriberMeta(c),
+		m:        m,
+	}
+
+	// Send the campaign to the seed addresses once, when it starts.
+	if len(m.cfg.SeedEmails) > 0 && c.Sent == 0 {
+		go p.sendSeeds()
+	}
+
+	// Bucket the subscribers of local time campaigns by timezone.
+	if c.SendAtLocal && c.SendAt.Valid {
+		if err := p.loadTZBuckets(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Stage the sending of campaigns with a rollout.
+	if err := p.loadRollout(); err != nil {
+		return nil, err
+	}
+
+	if err := p.loadFrequencyCap(); err != nil {
+		return nil, err
 	}
 
 	// Increment the waitgroup so that Wait() blocks immediately. This is necessary
@@ -70,22 +179,120 @@ func (m *Manager) newPipe(c *models.Campaign) (*pipe, error) {
 	return p, nil
 }
 
+var (
+	// errDomainBlocklisted is the reason for skipping messages to subscribers
+	// whose domains are blocklisted.
+	errDomainBlocklisted = errors.New("recipient domain is blocklisted")
+
+	// errNoChannel is the reason for skipping messages to subscribers who
+	// don't have a consented identity on the messenger's channel.
+	errNoChannel = errors.New("recipient has not consented to the channel")
+)
+
 // NextSubscribers processes the next batch of subscribers in a given campaign.
 // It returns a bool indicating whether any subscribers were processed
 // in the current batch or not. A false indicates that all subscribers
 // have been processed, or that a campaign has been paused or cancelled.
 func (p *pipe) NextSubscribers() (bool, error) {
+	if p.stopped.Load() || p.expire() {
+		return false, nil
+	}
+
+	// Hold the pipe while it has a batch worth of messages waiting for their
+	// domain rate limits so that they don't pile up in memory.
+	if p.deferred.Load() >= int64(p.m.cfg.BatchSize) {
+		p.holdUntil.Store(time.Now().Unix())
+		return true, nil
+	}
+
+	// Outside the campaign's sending window, hold the pipe until it opens,
+	// or until the send deadline if that's before.
+	if p.window != nil {
+		if at := p.window.next(time.Now()); !at.IsZero() {
+			if p.camp.SendUntil.Valid && p.camp.SendUntil.Time.Before(at) {
+				at = p.camp.SendUntil.Time
+			}
+
+			p.m.log.Printf("campaign (%s) is outside its sending window. holding until %s",
+				p.camp.Name, at.Format(time.RFC822Z))
+			p.holdUntil.Store(at.Unix())
+			return true, nil
+		}
+	}
+
+	// For local time campaigns, only fetch subscribers in the current timezone
+	// bucket, and if it isn't due yet, hold the pipe until it is.
+	var timezones []string
+	if len(p.buckets) > 0 {
+		b := p.buckets[p.bucket]
+		if time.Now().Before(b.sendAt) {
+			// Wake up at the send deadline if the bucket is due after it.
+			at := b.sendAt
+			if p.camp.SendUntil.Valid && p.camp.SendUntil.Time.Before(at) {
+				at = p.camp.SendUntil.Time
+			}
+			p.holdUntil.Store(at.Unix())
+			return true, nil
+		}
+		timezones = b.timezones
+	}
+
+	// Staged campaigns are only sent to the subscribers in their initial
+	// stage, and are then held until their rates are checked.
+	limit := p.m.cfg.BatchSize
+	if p.rollout != nil {
+		n, err := p.rolloutBatch(limit)
+		if err != nil {
+			return false, err
+		}
+		if n == 0 {
+			return !p.stopped.Load(), nil
+		}
+		limit = n
+	}
+
 	// Fetch a batch of subscribers.
-	subs, err := p.m.store.NextSubscribers(p.camp.ID, p.m.cfg.BatchSize)
+	subs, err := p.m.store.NextSubscribers(p.camp.ID, limit, timezones)
 	if err != nil {
 		return false, fmt.Errorf("error fetching campaign subscribers (%s): %v", p.camp.Name, err)
 	}
+	if p.rollout != nil {
+		p.rollout.queued += len(subs)
+	}
+
+	// Load the list subscriptions and engagement that content blocks are
+	// conditioned on.
+	if len(subs) > 0 && p.withMeta {
+		if err := p.m.store.LoadSubscriberMeta(subs); err != nil {
+			return false, fmt.Errorf("error loading subscriber meta (%s): %v", p.camp.Name, err)
+		}
+	}
 
 	// There are no subscribers.
 	if len(subs) == 0 {
+		// Move on to the next timezone bucket, if there's one.
+		if p.bucket < len(p.buckets)-1 {
+			if err := p.setTZBucket(p.bucket + 1); err != nil {
+				return false, err
+			}
+			return true, nil
+		}
+
 		return false, nil
 	}
 
+	// Campaigns recently sent to the subscribers for their frequency caps.
+	var sends map[int64][]time.Time
+	if p.freqCap != nil {
+		ids := make([]int64, len(subs))
+		for i, s := range subs {
+			ids[i] = int64(s.ID)
+		}
+		if sends, err = p.m.store.GetSubscriberSends(p.camp.ID, ids); err != nil {
+			return false, fmt.Errorf("error fetching subscriber sends (%s): %v", p.camp.Name, err)
+		}
+	}
+
 	// Is there a sliding window limit configured?
 	hasSliding := p.m.cfg.SlidingWindow &&
 		p.m.cfg.SlidingWindowRate > 0 &&
@@ -93,9 +300,74 @@ func (p *pipe) NextSubscribers() (bool, error) {
 
 	// Push messages.
 	for _, s := range subs {
+		// Skip subscribers whose domains were blocklisted after they subscribed.
+		if p.m.cfg.DomainBlocklisted != nil && p.m.cfg.DomainBlocklisted(s.Email) {
+			p.addDeliverySkipped(int64(s.ID), errDomainBlocklisted)
+			continue
+		}
+
+		// Skip subscribers who can't be messaged on the messenger's channel.
+		if ch := p.m.messengerChannel(p.msgrs[p.msgr.Load()]); ch != "" {
+			if _, ok := s.Channels.Target(ch); !ok {
+				p.addDeliverySkipped(int64(s.ID), errNoChannel)
+				continue
+			}
+		}
+
+		// Skip subscribers over their frequency cap, and hold the messages to
+		// the subscribers who have to wait for it or their quiet hours.
+		hold, err := p.holdSubscriber(s.Timezone, sends[int64(s.ID)])
+		if err != nil {
+			p.addDeliverySkipped(int64(s.ID), err)
+			continue
+		}
+
 		msg, err := p.newMessage(s)
 		if err != nil {
 			p.m.log.Printf("error rendering message (%s) (%s): %v", p.camp.Name, s.Email, err)
+			p.addDeliveryError(int64(s.ID), "", models.DeliveryErrorRendering, err)
+			continue
+		}
+
+		// If the recipient's domain has hit its rate limit, defer the message
+		// to the domain's next window. If the messenger is being warmed up
+		// and its daily volume is exhausted, defer it to the next day, and
+		// if its send quota is exhausted, to when the quota resets.
+		msgr := p.msgrs[p.msgr.Load()]
+		at := p.m.throttle.reserve(s.Email)
+		if w := p.m.warmups.reserve(msgr); w.After(at) {
+			at = w
+		}
+		if hold.After(at) {
+			at = hold
+		}
+		q, err := p.m.quotas.reserve(msgr, true)
+		if err != nil {
+			// The messenger's quota refuses messages over it. Stop fetching and
+			// pause the campaign once the messages already queued or deferred
+			// within the quota are sent, which stopping the pipe would discard.
+			// It resumes from this subscriber, as the fetch has moved the
+			// checkpoint past the unsent rest of the batch.
+			p.pauseReason = fmt.Sprintf("Send quota of messenger %s exceeded", msgr)
+			p.m.log.Printf("campaign (%s) %s. pausing", p.camp.Name, p.pauseReason)
+			p.setRewind(s.ID - 1)
+			p.withErrors.Store(true)
+			p.wg.Done()
+			return false, nil
+		}
+		if q.After(at) {
+			at = q
+		}
+		if !at.IsZero() {
+			// The message can't go out before the send deadline, and neither
+			// can the ones after it.
+			if p.camp.SendUntil.Valid && at.After(p.camp.SendUntil.Time) {
+				p.wg.Done()
+				p.stopExpired()
+				return false, nil
+			}
+
+			p.deferMessage(msg, at)
 			continue
 		}
 
@@ -162,7 +434,34 @@ func (p *pipe) Stop(withErrors bool) {
 		p.withErrors.Store(true)
 	}
 
-	p.stopped.Store(true)
+	if p.stopped.CompareAndSwap(false, true) {
+		close(p.done)
+	}
+}
+
+// setRewind sets the subscriber after which the campaign resumes.
+func (p *pipe) setRewind(subID int) {
+	p.rewindTo.Store(int64(subID))
+	p.rewind.Store(true)
+}
+
+// expire stops the pipe if the campaign is past its send deadline and
+// returns whether it is.
+func (p *pipe) expire() bool {
+	if !p.camp.SendUntil.Valid || time.Now().Before(p.camp.SendUntil.Time) {
+		return false
+	}
+
+	p.stopExpired()
+	return true
+}
+
+// stopExpired stops the pipe as the campaign has reached its send deadline.
+func (p *pipe) stopExpired() {
+	if p.expired.CompareAndSwap(false, true) {
+		p.m.log.Printf("campaign (%s) reached its send deadline. stopping", p.camp.Name)
+	}
+	p.Stop(false)
 }
 
 func (p *pipe) newMessage(s models.Subscriber) (CampaignMessage, error) {
@@ -172,11 +471,38 @@ func (p *pipe) newMessage(s models.Subscriber) (CampaignMessage, error) {
 	}
 
 	msg.pipe = p
+	msg.bucket = p.bucket
 	p.wg.Add(1)
 
 	return msg, nil
 }
 
+// setLastID moves the subscriber checkpoint up to a subscriber that's been
+// sent to. Messages of a previous timezone bucket that are still being sent
+// don't move the checkpoint of the current one, which starts from scratch.
+func (p *pipe) setLastID(subID, bucket int) {
+	p.lastIDMut.Lock()
+	if bucket == p.lastIDBucket && subID > p.lastID {
+		p.lastID = subID
+	}
+	p.lastIDMut.Unlock()
+}
+
+// resetLastID resets the subscriber checkpoint for a new timezone bucket.
+func (p *pipe) resetLastID(bucket int) {
+	p.lastIDMut.Lock()
+	p.lastID = 0
+	p.lastIDBucket = bucket
+	p.lastIDMut.Unlock()
+}
+
+// getLastID returns the subscriber checkpoint.
+func (p *pipe) getLastID() int {
+	p.lastIDMut.Lock()
+	defer p.lastIDMut.Unlock()
+	return p.lastID
+}
+
 func (p *pipe) cleanup() {
 	defer func() {
 		p.m.pipesMut.Lock()
@@ -184,23 +510,53 @@ func (p *pipe) cleanup() {
 		p.m.pipesMut.Unlock()
 	}()
 
-	// Update campaign's "sent" count.
-	if err := p.m.store.UpdateCampaignCounts(p.camp.ID, 0, int(p.sent.Load()), int(p.lastID.Load())); err != nil {
+	p.flushDeliveries()
+
+	// Update campaign's "sent" count and the estimated cost.
+	sent, segments := p.sent.Load(), p.segments.Load()
+	if err := p.m.store.UpdateCampaignCounts(p.camp.ID, 0, int(sent), p.getLastID(),
+		int(segments), p.takeCost()); err != nil {
 		p.m.log.Printf("error updating campaign counts (%s): %v", p.camp.Name, err)
 	}
 
-	// The campaign was auto-paused due to errors.
+	// Move the checkpoint back to the last subscriber that was processed.
+	if p.rewind.Load() {
+		if err := p.m.store.RewindCampaign(p.camp.ID, int(p.rewindTo.Load())); err != nil {
+			p.m.log.Printf("error rewinding campaign (%s): %v", p.camp.Name, err)
+		}
+	}
+
+	// The campaign was auto-paused due to errors, a failed rollout, or an
+	// exhausted send quota.
 	if p.withErrors.Load() {
+		reason := "Too many errors"
+		if p.rollout != nil && p.rollout.failed != "" {
+			reason = p.rollout.failed
+		} else if p.pauseReason != "" {
+			reason = p.pauseReason
+		}
+
 		if err := p.m.store.UpdateCampaignStatus(p.camp.ID, models.CampaignStatusPaused); err != nil {
 			p.m.log.Printf("error updating campaign (%s) status to %s: %v", p.camp.Name, models.CampaignStatusPaused, err)
 		} else {
 			p.m.log.Printf("set campaign (%s) to %s", p.camp.Name, models.CampaignStatusPaused)
 		}
 
-		_ = p.m.sendNotif(p.camp, models.CampaignStatusPaused, "Too many errors")
+		_ = p.m.sendNotif(p.camp, models.CampaignStatusPaused, reason)
+		p.m.fireEvent(EventCampaignError, p.camp.ID, reason)
 		return
 	}
 
+	// The campaign was stopped at its send deadline with subscribers left.
+	// Finish it as expired.
+	reason := ""
+	if p.expired.Load() {
+		if err := p.m.store.ExpireCampaign(p.camp.ID); err != nil {
+			p.m.log.Printf("error expiring campaign (%s): %v", p.camp.Name, err)
+		}
+		reason = "Send deadline reached"
+	}
+
 	// Fetch the up-to-date campaign status from the DB.
 	c, err := p.m.store.GetCampaign(p.camp.ID)
 	if err != nil {
@@ -221,5 +577,14 @@ func (p *pipe) cleanup() {
 	}
 
 	// Notify the admin.
-	_ = p.m.sendNotif(c, c.Status, "")
+	_ = p.m.sendNotif(c, c.Status, reason)
+
+	switch c.Status {
+	case models.CampaignStatusFinished:
+		p.m.fireEvent(EventCampaignFinished, c.ID, reason)
+	case models.CampaignStatusPaused:
+		p.m.fireEvent(EventCampaignPaused, c.ID, reason)
+	case models.CampaignStatusCancelled:
+		p.m.fireEvent(EventCampaignCancelled, c.ID, reason)
+	}
 }
@@ -0,0 +1,183 @@
+package manager
+
+import (
+	"io"
+	"log"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/paulbellamy/ratecounter"
+)
+
+// quotaStore is a Store that returns a fixed batch of subscribers and
+// records the checkpoints and status that the pipe writes.
+type quotaStore struct {
+	Store
+
+	subs    []models.Subscriber
+	lastID  int
+	rewound int
+	status  string
+}
+
+func (s *quotaStore) NextSubscribers(campID, limit int, timezones []string) ([]models.Subscriber, error) {
+	// As in the DB, the fetch moves the checkpoint past the whole batch.
+	s.lastID = s.subs[len(s.subs)-1].ID
+	return s.subs, nil
+}
+
+func (s *quotaStore) CountMessengerUsage(messenger string, day, month time.Time) (int, int, error) {
+	return 0, 0, nil
+}
+
+func (s *quotaStore) CountDeliveries(messenger string, since time.Time) (int, error) {
+	return 0, nil
+}
+
+func (s *quotaStore) RecordDeliveries(campID, version int, subIDs []int64, msgrs, statuses, errs, errTypes []string) error {
+	return nil
+}
+
+func (s *quotaStore) UpdateCampaignCounts(campID int, toSend int, sent int, lastSubID int, segments int, cost float64) error {
+	return nil
+}
+
+func (s *quotaStore) RewindCampaign(campID int, lastSubID int) error {
+	s.rewound = lastSubID
+	s.lastID = lastSubID
+	return nil
+}
+
+func (s *quotaStore) UpdateCampaignStatus(campID int, status string) error {
+	s.status = status
+	return nil
+}
+
+// testMessenger records the subscribers that messages are pushed to.
+type testMessenger struct {
+	subIDs []int
+	mut    sync.Mutex
+}
+
+func (t *testMessenger) Name() string { return "email" }
+
+func (t *testMessenger) Push(m models.Message) error {
+	t.mut.Lock()
+	t.subIDs = append(t.subIDs, m.Subscriber.ID)
+	t.mut.Unlock()
+	return nil
+}
+
+func (t *testMessenger) Flush() error { return nil }
+func (t *testMessenger) Close() error { return nil }
+
+func TestNextSubscribersQuotaRewind(t *testing.T) {
+	// The second subscriber's message is deferred to the domain's next rate
+	// limit window, and the third one is over the quota.
+	st := &quotaStore{subs: []models.Subscriber{
+		{Base: models.Base{ID: 1}, Email: "one@slow.listmonk.app"},
+		{Base: models.Base{ID: 2}, Email: "two@slow.listmonk.app"},
+		{Base: models.Base{ID: 3}, Email: "three@listmonk.app"},
+		{Base: models.Base{ID: 4}, Email: "four@listmonk.app"},
+	}}
+
+	m := New(Config{
+		UnsubURL:     "%s/%s",
+		MessageRate:  10,
+		Quotas:       map[string]Quota{"email": {Daily: 2, Refuse: true}},
+		DomainLimits: map[string]DomainLimit{"slow.listmonk.app": {Rate: 1, Duration: time.Millisecond * 100}},
+	}, st, func(string, interface{}) error { return nil }, nil, log.New(io.Discard, "", 0))
+
+	msgr := &testMessenger{}
+	if err := m.AddMessenger(msgr); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &models.Campaign{Name: "quota", Messenger: "email", TemplateBody: `{{ template "content" . }}`, Body: "hello"}
+	if err := c.CompileTemplate(m.TemplateFuncs(c)); err != nil {
+		t.Fatalf("error compiling template: %v", err)
+	}
+	c.ID = 1
+
+	p := &pipe{
+		camp:  c,
+		rate:  ratecounter.NewRateCounter(time.Minute),
+		wg:    &sync.WaitGroup{},
+		msgrs: []string{"email"},
+		done:  make(chan struct{}),
+		m:     m,
+	}
+	m.pipes[c.ID] = p
+
+	// As in newPipe() and the worker pool, the pipe is cleaned up once all
+	// of its messages are processed.
+	p.wg.Add(1)
+	finished := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		p.Stop(false)
+		p.cleanup()
+		close(finished)
+	}()
+	go m.worker()
+	defer close(m.campMsgQ)
+
+	has, err := p.NextSubscribers()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if has {
+		t.Error("expected the pipe to stop at the quota")
+	}
+	p.wg.Done()
+
+	select {
+	case <-finished:
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for the pipe to finish")
+	}
+
+	// The messages that were queued and deferred within the quota are sent.
+	msgr.mut.Lock()
+	sort.Ints(msgr.subIDs)
+	if !reflect.DeepEqual(msgr.subIDs, []int{1, 2}) {
+		t.Errorf("expected messages to subscribers [1 2], got %v", msgr.subIDs)
+	}
+	msgr.mut.Unlock()
+
+	// The campaign is paused and resumes from the first subscriber that
+	// wasn't sent to.
+	if st.status != models.CampaignStatusPaused {
+		t.Errorf("expected the campaign to be paused, got %q", st.status)
+	}
+	if st.rewound != 2 || st.lastID != 2 {
+		t.Errorf("expected the checkpoint to be rewound to 2, got %d (%d)", st.rewound, st.lastID)
+	}
+}
+
+func TestNextSubscribersNoRewind(t *testing.T) {
+	st := &quotaStore{subs: []models.Subscriber{
+		{Base: models.Base{ID: 1}, Email: "one@listmonk.app"},
+	}}
+
+	m := New(Config{UnsubURL: "%s/%s"}, st, func(string, interface{}) error { return nil }, nil, log.New(io.Discard, "", 0))
+
+	c := &models.Campaign{Name: "noquota", Messenger: "email", TemplateBody: `{{ template "content" . }}`, Body: "hello"}
+	if err := c.CompileTemplate(m.TemplateFuncs(c)); err != nil {
+		t.Fatalf("error compiling template: %v", err)
+	}
+
+	p := &pipe{camp: c, wg: &sync.WaitGroup{}, msgrs: []string{"email"}, done: make(chan struct{}), m: m}
+	p.wg.Add(1)
+
+	if has, err := p.NextSubscribers(); err != nil || !has {
+		t.Fatalf("expected the batch to be processed, got %v, %v", has, err)
+	}
+	if p.rewind.Load() {
+		t.Error("expected no rewind without a quota")
+	}
+}
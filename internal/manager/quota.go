@@ -0,0 +1,207 @@
+package manager
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Quota is the max number of messages that can be sent through a messenger
+// in a calendar day and month. 0 is no limit. Campaign messages over the
+// quota are held until it resets, unless Refuse is set, in which case the
+// campaign is paused. Other messages over the quota are always refused.
+type Quota struct {
+	Daily   int
+	Monthly int
+	Refuse  bool
+}
+
+// ErrQuotaExceeded is returned for messages that are refused as their
+// messenger's send quota is exhausted.
+var ErrQuotaExceeded = errors.New("messenger send quota exceeded")
+
+// quotaPeriod is the day and month in which a messenger's messages are being
+// sent or scheduled and the number of messages in them.
+type quotaPeriod struct {
+	day     time.Time
+	month   time.Time
+	daily   int
+	monthly int
+}
+
+// usageKey is a messenger and the day (YYYY-MM-DD) on which messages were
+// sent through it.
+type usageKey struct {
+	messenger string
+	date      string
+}
+
+// sendQuotas enforces the send quotas of messengers across all the campaigns
+// and other messages, and accounts the messages sent through every messenger.
+type sendQuotas struct {
+	quotas  map[string]Quota
+	periods map[string]*quotaPeriod
+	loc     *time.Location
+	mut     sync.Mutex
+
+	// Messages sent through messengers per day that are yet to be recorded.
+	sent    map[usageKey]int
+	sentMut sync.Mutex
+
+	// count returns the number of messages already sent through a messenger
+	// on a day and in the month it's in, for picking up from where a
+	// previous run left off.
+	count func(messenger string, day, month time.Time) (int, int, error)
+}
+
+func newSendQuotas(quotas map[string]Quota, loc *time.Location, count func(string, time.Time, time.Time) (int, int, error)) *sendQuotas {
+	q := make(map[string]Quota, len(quotas))
+	for name, v := range quotas {
+		if v.Daily > 0 || v.Monthly > 0 {
+			q[name] = v
+		}
+	}
+
+	return &sendQuotas{
+		quotas:  q,
+		periods: make(map[string]*quotaPeriod),
+		loc:     loc,
+		sent:    make(map[usageKey]int),
+		count:   count,
+	}
+}
+
+// reserve reserves a send slot for a message on the given messenger and
+// returns the time at which the message can be sent. A zero time means that
+// it can be sent right away. Campaign messages (hold) over the quota are
+// scheduled into the next day or month. For other messages, and quotas that
+// refuse messages over them, ErrQuotaExceeded is returned instead.
+func (s *sendQuotas) reserve(messenger string, hold bool) (time.Time, error) {
+	q, ok := s.quotas[messenger]
+	if !ok {
+		return time.Time{}, nil
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	var (
+		now   = time.Now().In(s.loc)
+		today = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, s.loc)
+	)
+
+	p, ok := s.periods[messenger]
+	if !ok || p.day.Before(today) {
+		p = &quotaPeriod{day: today, month: time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, s.loc)}
+
+		// Count the messages that have already been sent, eg: before a restart.
+		if d, m, err := s.count(messenger, p.day, p.month); err == nil {
+			p.daily, p.monthly = d, m
+		}
+		s.periods[messenger] = p
+	}
+
+	// Messages that can't be held are refused once campaign messages have
+	// been held past today.
+	if !hold && p.day.After(now) {
+		return time.Time{}, ErrQuotaExceeded
+	}
+
+	for {
+		var (
+			dayFull   = q.Daily > 0 && p.daily >= q.Daily
+			monthFull = q.Monthly > 0 && p.monthly >= q.Monthly
+		)
+		if !dayFull && !monthFull {
+			break
+		}
+
+		// Messages that are refused don't take up the quota.
+		if q.Refuse || !hold {
+			return time.Time{}, ErrQuotaExceeded
+		}
+
+		if monthFull {
+			// Schedule the message into the next month.
+			p.month = p.month.AddDate(0, 1, 0)
+			p.day = p.month
+			p.daily, p.monthly = 0, 0
+			continue
+		}
+
+		// Schedule the message into the next day, which may be in the next month.
+		p.day = time.Date(p.day.Year(), p.day.Month(), p.day.Day()+1, 0, 0, 0, 0, s.loc)
+		p.daily = 0
+		if p.day.Month() != p.month.Month() {
+			p.month = p.day
+			p.monthly = 0
+		}
+	}
+	p.daily++
+	p.monthly++
+
+	if p.day.After(now) {
+		return p.day, nil
+	}
+	return time.Time{}, nil
+}
+
+// addSent accounts a message that was sent through a messenger.
+func (s *sendQuotas) addSent(messenger string) {
+	k := usageKey{messenger: messenger, date: time.Now().In(s.loc).Format("2006-01-02")}
+
+	s.sentMut.Lock()
+	s.sent[k]++
+	s.sentMut.Unlock()
+}
+
+// takeSent returns the messages sent through messengers per day since the
+// last call and resets them.
+func (s *sendQuotas) takeSent() ([]string, []string, []int) {
+	s.sentMut.Lock()
+	sent := s.sent
+	s.sent = make(map[usageKey]int)
+	s.sentMut.Unlock()
+
+	var (
+		msgrs  = make([]string, 0, len(sent))
+		dates  = make([]string, 0, len(sent))
+		counts = make([]int, 0, len(sent))
+	)
+	for k, n := range sent {
+		msgrs = append(msgrs, k.messenger)
+		dates = append(dates, k.date)
+		counts = append(counts, n)
+	}
+
+	return msgrs, dates, counts
+}
+
+// flushUsage is a blocking function that periodically records the messages
+// sent through messengers per day in the DB.
+func (m *Manager) flushUsage(tick time.Duration) {
+	t := time.NewTicker(tick)
+	defer t.Stop()
+
+	for range t.C {
+		m.recordUsage()
+	}
+}
+
+// recordUsage records the messages sent through messengers since the last
+// call in the DB.
+func (m *Manager) recordUsage() {
+	msgrs, dates, counts := m.quotas.takeSent()
+	if len(msgrs) == 0 {
+		return
+	}
+
+	if err := m.store.AddMessengerUsage(msgrs, dates, counts); err != nil {
+		m.log.Printf("error recording messenger usage: %v", err)
+	}
+}
+
+// Quotas returns the send quotas of messengers.
+func (m *Manager) Quotas() map[string]Quota {
+	return m.quotas.quotas
+}
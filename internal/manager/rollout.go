@@ -0,0 +1,129 @@
+package manager
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// rollout is the state of a staged campaign (models.Rollout) that's in its
+// initial stage or on hold after it.
+type rollout struct {
+	// Number of subscribers in the initial stage and the number of them
+	// that have been queued.
+	size   int
+	queued int
+
+	hold      time.Duration
+	heldUntil time.Time
+
+	// Reason with which the campaign is paused if its rates after the hold
+	// are over the thresholds.
+	failed string
+}
+
+// loadRollout loads the staged sending of a campaign, unless it doesn't have
+// one or its rates have already been checked after the hold.
+func (p *pipe) loadRollout() error {
+	r := p.camp.Rollout
+	if r.Percent <= 0 || p.camp.RolloutCheckedAt.Valid || p.camp.Retrying {
+		return nil
+	}
+
+	hold, err := time.ParseDuration(r.Hold)
+	if err != nil {
+		return fmt.Errorf("error parsing rollout hold on campaign %s: %v", p.camp.Name, err)
+	}
+
+	out := &rollout{hold: hold}
+	if p.camp.RolloutHeldUntil.Valid {
+		// The initial stage has already been sent.
+		out.heldUntil = p.camp.RolloutHeldUntil.Time
+	} else {
+		// The campaign's to_send is from before it was picked up for
+		// processing, which updates it. Fetch the current one.
+		c, err := p.m.store.GetCampaign(p.camp.ID)
+		if err != nil {
+			return fmt.Errorf("error fetching campaign (%s) for rollout: %v", p.camp.Name, err)
+		}
+
+		out.size = int(math.Ceil(float64(c.ToSend) * float64(r.Percent) / 100))
+		out.queued = p.camp.Sent
+	}
+
+	p.rollout = out
+	return nil
+}
+
+// rolloutBatch returns the number of subscribers, up to limit, that can be
+// fetched in the next batch of a staged campaign. 0 means that the pipe is on
+// hold after the initial stage, or that it has been stopped as its bounce or
+// complaint rate after the hold is over the threshold.
+func (p *pipe) rolloutBatch(limit int) (int, error) {
+	r := p.rollout
+
+	// Initial stage.
+	if r.heldUntil.IsZero() {
+		if n := r.size - r.queued; n > 0 {
+			if n < limit {
+				limit = n
+			}
+			return limit, nil
+		}
+
+		// The initial stage has been queued. Hold the campaign.
+		r.heldUntil = time.Now().Add(r.hold)
+		if err := p.m.store.UpdateCampaignRollout(p.camp.ID, r.heldUntil, false); err != nil {
+			return 0, fmt.Errorf("error updating campaign rollout (%s): %v", p.camp.Name, err)
+		}
+		p.m.log.Printf("campaign (%s) rollout sent to %d subscribers. holding until %s",
+			p.camp.Name, r.queued, r.heldUntil.Format(time.RFC822Z))
+	}
+
+	if time.Now().Before(r.heldUntil) {
+		// Wake up at the send deadline if the hold ends after it.
+		at := r.heldUntil
+		if p.camp.SendUntil.Valid && p.camp.SendUntil.Time.Before(at) {
+			at = p.camp.SendUntil.Time
+		}
+		p.holdUntil.Store(at.Unix())
+		return 0, nil
+	}
+
+	// The hold is over. Check the rates.
+	bounces, complaints, err := p.m.store.CountCampaignBounces(p.camp.ID)
+	if err != nil {
+		return 0, fmt.Errorf("error counting campaign bounces (%s): %v", p.camp.Name, err)
+	}
+
+	var (
+		sent = math.Max(float64(p.camp.Sent)+float64(p.sent.Load()), 1)
+		cfg  = p.camp.Rollout
+
+		bounceRate    = float64(bounces) / sent * 100
+		complaintRate = float64(complaints) / sent * 100
+	)
+	if cfg.MaxBounceRate > 0 && bounceRate > cfg.MaxBounceRate {
+		r.failed = fmt.Sprintf("Rollout bounce rate %.2f%% is over %.2f%%", bounceRate, cfg.MaxBounceRate)
+	} else if cfg.MaxComplaintRate > 0 && complaintRate > cfg.MaxComplaintRate {
+		r.failed = fmt.Sprintf("Rollout complaint rate %.2f%% is over %.2f%%", complaintRate, cfg.MaxComplaintRate)
+	}
+
+	// The rates aren't checked again, so that a campaign that's paused
+	// here and resumed is sent to the rest of its subscribers.
+	if err := p.m.store.UpdateCampaignRollout(p.camp.ID, r.heldUntil, true); err != nil {
+		return 0, fmt.Errorf("error updating campaign rollout (%s): %v", p.camp.Name, err)
+	}
+
+	if r.failed != "" {
+		p.m.log.Printf("campaign (%s) %s. pausing", p.camp.Name, r.failed)
+		p.Stop(true)
+		return 0, nil
+	}
+
+	p.m.log.Printf("campaign (%s) rollout passed (bounces %.2f%%, complaints %.2f%%). continuing",
+		p.camp.Name, bounceRate, complaintRate)
+	p.rollout = nil
+
+	return limit, nil
+}
@@ -0,0 +1,113 @@
+package manager
+
+import (
+	"sync"
+
+	"github.com/knadh/listmonk/models"
+)
+
+// pipeQueue is the queue of campaign pipes that have subscribers to be fetched.
+// Pipes are picked by weighted fair (stride) scheduling. Every pipe has a pass
+// that advances by the inverse of its campaign's priority each time it's
+// picked to process a batch, and the pipe with the lowest pass is picked next.
+// Campaigns that run alongside each other thus process batches in proportion to
+// their priorities, and as a pipe that's queued doesn't start behind the
+// others, a high priority campaign that starts preempts the lower priority
+// ones from the next batch.
+type pipeQueue struct {
+	pipes []*pipe
+
+	// Pass of the pipe that was picked last.
+	pass float64
+
+	closed bool
+	mut    sync.Mutex
+
+	// Signals pop() that pipes have been queued.
+	signal chan struct{}
+}
+
+func newPipeQueue() *pipeQueue {
+	return &pipeQueue{signal: make(chan struct{}, 1)}
+}
+
+// push queues a pipe, unless it's already queued.
+func (q *pipeQueue) push(p *pipe) {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+
+	if q.closed || p.queued {
+		return
+	}
+
+	// A pipe that was on hold doesn't get to catch up with the others
+	// all at once.
+	if p.pass < q.pass {
+		p.pass = q.pass
+	}
+	p.queued = true
+	q.pipes = append(q.pipes, p)
+
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+// pop blocks until there's a pipe in the queue and returns the one that's
+// due. It returns false once the queue is closed.
+func (q *pipeQueue) pop() (*pipe, bool) {
+	for {
+		q.mut.Lock()
+		if q.closed {
+			q.mut.Unlock()
+			return nil, false
+		}
+
+		if len(q.pipes) > 0 {
+			// The pipe with the lowest pass, of the highest priority on ties,
+			// in the order of queueing.
+			idx := 0
+			for i, p := range q.pipes[1:] {
+				b := q.pipes[idx]
+				if p.pass < b.pass || (p.pass == b.pass && p.priority > b.priority) {
+					idx = i + 1
+				}
+			}
+
+			p := q.pipes[idx]
+			q.pipes = append(q.pipes[:idx], q.pipes[idx+1:]...)
+			q.pass = p.pass
+			p.pass += 1 / float64(p.priority)
+			p.queued = false
+			q.mut.Unlock()
+
+			return p, true
+		}
+		q.mut.Unlock()
+
+		<-q.signal
+	}
+}
+
+// close closes the queue and unblocks pop().
+func (q *pipeQueue) close() {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+
+	if !q.closed {
+		q.closed = true
+		close(q.signal)
+	}
+}
+
+// campPriority returns the scheduling priority of a campaign.
+func campPriority(c *models.Campaign) int {
+	if c.Priority < models.CampaignPriorityMin {
+		return models.CampaignPriorityDefault
+	}
+	if c.Priority > models.CampaignPriorityMax {
+		return models.CampaignPriorityMax
+	}
+	return c.Priority
+}
@@ -0,0 +1,39 @@
+package manager
+
+import (
+	"strings"
+
+	"github.com/knadh/listmonk/models"
+)
+
+// sendSeeds queues the campaign's messages to the seed addresses. They're
+// queued without the pipe so that they aren't counted and recorded as
+// deliveries, and are rendered for a seed subscriber whose views and clicks
+// aren't tracked.
+func (p *pipe) sendSeeds() {
+	for _, email := range p.m.cfg.SeedEmails {
+		name := email
+		if i := strings.IndexByte(email, '@'); i > 0 {
+			name = email[:i]
+		}
+
+		sub := models.Subscriber{
+			UUID:    SeedUUID,
+			Email:   email,
+			Name:    name,
+			Attribs: models.JSON{},
+			Status:  models.SubscriberStatusEnabled,
+		}
+
+		msg, err := p.m.NewCampaignMessage(p.camp, sub)
+		if err != nil {
+			p.m.log.Printf("error rendering seed message (%s) (%s): %v", p.camp.Name, email, err)
+			continue
+		}
+
+		if p.stopped.Load() {
+			return
+		}
+		p.m.campMsgQ <- msg
+	}
+}
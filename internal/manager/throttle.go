@@ -0,0 +1,104 @@
+package manager
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// DomainLimit is the max number of messages that can be sent to recipients
+// of a domain in a window of time.
+type DomainLimit struct {
+	Rate     int
+	Duration time.Duration
+}
+
+// domainWindow is the window of time in which a domain's messages are
+// being sent or scheduled and the number of messages in it.
+type domainWindow struct {
+	start time.Time
+	count int
+}
+
+// domainThrottle enforces per recipient domain send rate limits across all
+// the campaigns being processed.
+type domainThrottle struct {
+	limits  map[string]DomainLimit
+	windows map[string]*domainWindow
+	mut     sync.Mutex
+}
+
+func newDomainThrottle(limits map[string]DomainLimit) *domainThrottle {
+	l := make(map[string]DomainLimit, len(limits))
+	for d, v := range limits {
+		if v.Rate > 0 && v.Duration > 0 {
+			l[strings.ToLower(d)] = v
+		}
+	}
+
+	return &domainThrottle{
+		limits:  l,
+		windows: make(map[string]*domainWindow),
+	}
+}
+
+// reserve reserves a send slot for a message to the given e-mail address
+// and returns the time at which the message can be sent. A zero time means
+// that it can be sent right away.
+func (t *domainThrottle) reserve(email string) time.Time {
+	if len(t.limits) == 0 {
+		return time.Time{}
+	}
+
+	domain := email
+	if i := strings.LastIndexByte(email, '@'); i > -1 {
+		domain = email[i+1:]
+	}
+	domain = strings.ToLower(domain)
+
+	lim, ok := t.limits[domain]
+	if !ok {
+		return time.Time{}
+	}
+
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	now := time.Now()
+	w, ok := t.windows[domain]
+	if !ok || now.Sub(w.start) >= lim.Duration {
+		// Start a new window.
+		w = &domainWindow{start: now}
+		t.windows[domain] = w
+	} else if w.count >= lim.Rate {
+		// The window is full. Schedule the message into the next one.
+		w.start = w.start.Add(lim.Duration)
+		w.count = 0
+	}
+	w.count++
+
+	if w.start.After(now) {
+		return w.start
+	}
+	return time.Time{}
+}
+
+// deferMessage queues a throttled campaign message at the given time. If the
+// pipe is stopped in the meantime, the message is discarded.
+func (p *pipe) deferMessage(msg CampaignMessage, at time.Time) {
+	p.deferred.Add(1)
+
+	go func() {
+		defer p.deferred.Add(-1)
+
+		t := time.NewTimer(time.Until(at))
+		defer t.Stop()
+
+		select {
+		case <-t.C:
+			p.m.campMsgQ <- msg
+		case <-p.done:
+			p.wg.Done()
+		}
+	}()
+}
@@ -0,0 +1,136 @@
+package manager
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// maxTZOffset is the largest UTC offset of any timezone (Pacific/Kiritimati).
+const maxTZOffset = time.Hour * 14
+
+// tzBucket is a group of subscriber timezones in which a local time
+// campaign's send_at wall-clock time falls on the same instant.
+type tzBucket struct {
+	sendAt    time.Time
+	timezones []string
+}
+
+// makeTZBuckets groups the given timezone names by the instant at which the
+// wall-clock time of sendAt (in the def timezone) occurs in each of them.
+// Empty and unknown timezone names fall back to def. The buckets are
+// ordered by their send times.
+func makeTZBuckets(sendAt time.Time, def *time.Location, timezones []string) []tzBucket {
+	var (
+		wall    = sendAt.In(def)
+		buckets = make(map[int64]*tzBucket)
+	)
+	for _, tz := range timezones {
+		loc := def
+		if tz != "" {
+			if l, err := time.LoadLocation(tz); err == nil {
+				loc = l
+			}
+		}
+
+		t := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), 0, loc)
+		b, ok := buckets[t.Unix()]
+		if !ok {
+			b = &tzBucket{sendAt: t}
+			buckets[t.Unix()] = b
+		}
+		b.timezones = append(b.timezones, tz)
+	}
+
+	out := make([]tzBucket, 0, len(buckets))
+	for _, b := range buckets {
+		out = append(out, *b)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].sendAt.Before(out[j].sendAt)
+	})
+
+	return out
+}
+
+// loadTZBuckets loads the timezone buckets of a local time campaign and
+// picks the bucket to process, resuming from the one that was being
+// processed previously, if any.
+func (p *pipe) loadTZBuckets() error {
+	tzs, err := p.m.store.GetCampaignTimezones(p.camp.ID)
+	if err != nil {
+		return fmt.Errorf("error fetching campaign timezones (%s): %v", p.camp.Name, err)
+	}
+
+	// The wall-clock time of campaigns scheduled in a timezone is in it.
+	def := p.m.cfg.DefaultTimezone
+	if tz := p.camp.SendAtTimezone; tz != "" {
+		if loc, err := time.LoadLocation(tz); err == nil {
+			def = loc
+		}
+	}
+
+	p.buckets = makeTZBuckets(p.camp.ScheduledAt(), def, tzs)
+	if len(p.buckets) == 0 {
+		return nil
+	}
+
+	idx := 0
+	if at := p.camp.TZBucketAt; at.Valid {
+		for idx < len(p.buckets)-1 && p.buckets[idx].sendAt.Before(at.Time) {
+			idx++
+		}
+
+		// Same bucket. Continue from the last subscriber checkpoint.
+		if p.buckets[idx].sendAt.Equal(at.Time) {
+			p.bucket = idx
+			return nil
+		}
+	}
+
+	return p.setTZBucket(idx)
+}
+
+// setTZBucket moves the pipe to the given timezone bucket. The campaign's
+// subscriber checkpoint is reset as every bucket is fetched from the beginning.
+func (p *pipe) setTZBucket(idx int) error {
+	b := p.buckets[idx]
+	if err := p.m.store.UpdateCampaignTZBucket(p.camp.ID, b.sendAt); err != nil {
+		return fmt.Errorf("error updating campaign timezone bucket (%s): %v", p.camp.Name, err)
+	}
+
+	p.bucket = idx
+	p.resetLastID(idx)
+	p.m.log.Printf("campaign (%s) timezone bucket %d/%d: %v at %s", p.camp.Name,
+		idx+1, len(p.buckets), b.timezones, b.sendAt.Format(time.RFC822Z))
+
+	return nil
+}
+
+// releaseHeldPipes queues pipes that are on hold for a timezone bucket
+// that's now due or for their deferred messages (domain rate limits),
+// or that have been stopped in the meantime.
+func (m *Manager) releaseHeldPipes() {
+	now := time.Now().Unix()
+
+	m.pipesMut.RLock()
+	defer m.pipesMut.RUnlock()
+
+	for _, p := range m.pipes {
+		h := p.holdUntil.Load()
+		if h == 0 || (h > now && !p.stopped.Load()) {
+			continue
+		}
+
+		if p.holdUntil.CompareAndSwap(h, 0) {
+			m.nextPipes.push(p)
+		}
+	}
+}
+
+// localLead returns how far ahead of their send_at local time campaigns
+// have to start to reach subscribers in the earliest timezone.
+func (m *Manager) localLead() time.Duration {
+	_, offset := time.Now().In(m.cfg.DefaultTimezone).Zone()
+	return maxTZOffset - time.Duration(offset)*time.Second
+}
@@ -0,0 +1,94 @@
+package manager
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMakeTZBuckets(t *testing.T) {
+	sendAt := time.Date(2024, 3, 5, 9, 0, 0, 0, time.UTC)
+	tzs := []string{"Asia/Kolkata", "Europe/London", "", "Invalid/Zone", "Asia/Tokyo"}
+
+	// Empty and unknown timezones fall into the default timezone's bucket,
+	// and Europe/London is on UTC in March.
+	exp := []tzBucket{
+		{sendAt: time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), timezones: []string{"Asia/Tokyo"}},
+		{sendAt: time.Date(2024, 3, 5, 3, 30, 0, 0, time.UTC), timezones: []string{"Asia/Kolkata"}},
+		{sendAt: sendAt, timezones: []string{"Europe/London", "", "Invalid/Zone"}},
+	}
+
+	out := makeTZBuckets(sendAt, time.UTC, tzs)
+	if len(out) != len(exp) {
+		t.Fatalf("expected %d buckets, got %d: %+v", len(exp), len(out), out)
+	}
+	for i, b := range out {
+		if !b.sendAt.Equal(exp[i].sendAt) || !reflect.DeepEqual(b.timezones, exp[i].timezones) {
+			t.Errorf("bucket %d: expected %v %v, got %v %v", i, exp[i].sendAt, exp[i].timezones, b.sendAt, b.timezones)
+		}
+	}
+}
+
+func TestMakeTZBucketsDefaultTimezone(t *testing.T) {
+	ist, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The wall-clock time is that of sendAt in the default timezone, 09:00 IST.
+	sendAt := time.Date(2024, 3, 5, 3, 30, 0, 0, time.UTC)
+	out := makeTZBuckets(sendAt, ist, []string{"", "UTC"})
+	if len(out) != 2 {
+		t.Fatalf("expected 2 buckets, got %d: %+v", len(out), out)
+	}
+	if !out[0].sendAt.Equal(sendAt) || out[0].timezones[0] != "" {
+		t.Errorf("expected the default timezone's bucket at %v, got %v %v", sendAt, out[0].sendAt, out[0].timezones)
+	}
+	if exp := time.Date(2024, 3, 5, 9, 0, 0, 0, time.UTC); !out[1].sendAt.Equal(exp) || out[1].timezones[0] != "UTC" {
+		t.Errorf("expected the UTC bucket at %v, got %v %v", exp, out[1].sendAt, out[1].timezones)
+	}
+}
+
+func TestMakeTZBucketsEmpty(t *testing.T) {
+	if out := makeTZBuckets(time.Now(), time.UTC, nil); len(out) != 0 {
+		t.Errorf("expected no buckets, got %+v", out)
+	}
+}
+
+func TestLocalLead(t *testing.T) {
+	cases := []struct {
+		loc  *time.Location
+		lead time.Duration
+	}{
+		{time.UTC, time.Hour * 14},
+		{time.FixedZone("IST", 5*3600+1800), time.Hour*8 + time.Minute*30},
+		{time.FixedZone("EST", -5*3600), time.Hour * 19},
+		{time.FixedZone("LINT", 14*3600), 0},
+	}
+
+	for _, c := range cases {
+		m := &Manager{cfg: Config{DefaultTimezone: c.loc}}
+		if lead := m.localLead(); lead != c.lead {
+			t.Errorf("localLead() in %s: expected %v, got %v", c.loc, c.lead, lead)
+		}
+	}
+}
+
+func TestLastIDBucket(t *testing.T) {
+	p := &pipe{}
+	p.setLastID(5, 0)
+
+	// A message of the previous bucket that's sent after the pipe has moved
+	// on to the next one doesn't move its checkpoint.
+	p.resetLastID(1)
+	p.setLastID(9, 0)
+	if id := p.getLastID(); id != 0 {
+		t.Errorf("expected the checkpoint to be 0, got %d", id)
+	}
+
+	p.setLastID(3, 1)
+	p.setLastID(2, 1)
+	if id := p.getLastID(); id != 3 {
+		t.Errorf("expected the checkpoint to be 3, got %d", id)
+	}
+}
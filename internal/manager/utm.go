@@ -0,0 +1,86 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/knadh/listmonk/models"
+)
+
+// makeUTMParams evaluates the template expressions in a campaign's UTM
+// params, eg: {{ .Name }}, with the campaign and returns the params.
+func makeUTMParams(c *models.Campaign) (url.Values, error) {
+	out := make(url.Values, len(c.UTMParams))
+	for k, v := range c.UTMParams {
+		if strings.Contains(v, "{{") {
+			tpl, err := template.New("utm").Parse(v)
+			if err != nil {
+				return nil, fmt.Errorf("error compiling UTM param %s: %v", k, err)
+			}
+
+			var b bytes.Buffer
+			if err := tpl.Execute(&b, c); err != nil {
+				return nil, fmt.Errorf("error evaluating UTM param %s: %v", k, err)
+			}
+			v = b.String()
+		}
+		out.Set(k, v)
+	}
+
+	return out, nil
+}
+
+// appendUTMParams appends the UTM params to the query of a URL, before
+// its fragment, if any. Params that the URL already has are left as is.
+func appendUTMParams(u string, params url.Values) string {
+	if len(params) == 0 {
+		return u
+	}
+
+	p, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+
+	var (
+		q    = p.Query()
+		keys = make([]string, 0, len(params))
+	)
+	for k := range params {
+		if !q.Has(k) {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return u
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		if b.Len() > 0 {
+			b.WriteByte('&')
+		}
+		b.WriteString(url.QueryEscape(k) + "=" + url.QueryEscape(params.Get(k)))
+	}
+
+	// Append to the raw URL instead of re-encoding it to leave the
+	// rest of it untouched.
+	base, frag, hasFrag := strings.Cut(u, "#")
+	switch {
+	case !strings.Contains(base, "?"):
+		base += "?"
+	case !strings.HasSuffix(base, "?") && !strings.HasSuffix(base, "&"):
+		base += "&"
+	}
+	base += b.String()
+
+	if hasFrag {
+		return base + "#" + frag
+	}
+	return base
+}
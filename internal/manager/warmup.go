@@ -0,0 +1,130 @@
+package manager
+
+import (
+	"sync"
+	"time"
+)
+
+// Warmup is the daily send volume ramp of a messenger (SMTP server) on a new
+// IP. Schedule[n] is the max number of messages that can be sent on the nth
+// day since Start. After the last day of the schedule, there's no limit.
+type Warmup struct {
+	Start    time.Time
+	Schedule []int
+}
+
+// limit returns the max number of messages that can be sent on the day
+// that starts at the given time. -1 means that there's no limit.
+func (w Warmup) limit(day time.Time) int {
+	// Days are counted on the calendar so that DST changes don't shift them.
+	var (
+		sy, sm, sd = w.Start.Date()
+		dy, dm, dd = day.Date()
+		n          = int(time.Date(dy, dm, dd, 0, 0, 0, 0, time.UTC).Sub(time.Date(sy, sm, sd, 0, 0, 0, 0, time.UTC)).Hours() / 24)
+	)
+	if n < 0 {
+		n = 0
+	}
+	if n >= len(w.Schedule) {
+		return -1
+	}
+	return w.Schedule[n]
+}
+
+// warmupDay is the day on which a messenger's messages are being sent or
+// scheduled and the number of messages in it.
+type warmupDay struct {
+	start time.Time
+	count int
+}
+
+// warmupQuota enforces the daily send volumes of messengers that are being
+// warmed up across all the campaigns being processed. A messenger may have
+// multiple warm-ups (eg: the pooled e-mail messenger), in which case its
+// daily volume is the sum of theirs.
+type warmupQuota struct {
+	warmups map[string][]Warmup
+	days    map[string]*warmupDay
+	loc     *time.Location
+	mut     sync.Mutex
+
+	// count returns the number of messages already sent through a messenger
+	// since a given time, for picking up from where a previous run left off.
+	count func(messenger string, since time.Time) (int, error)
+}
+
+func newWarmupQuota(warmups map[string][]Warmup, loc *time.Location, count func(string, time.Time) (int, error)) *warmupQuota {
+	w := make(map[string][]Warmup, len(warmups))
+	for name, v := range warmups {
+		if len(v) > 0 {
+			w[name] = v
+		}
+	}
+
+	return &warmupQuota{
+		warmups: w,
+		days:    make(map[string]*warmupDay),
+		loc:     loc,
+		count:   count,
+	}
+}
+
+// limit returns the max number of messages that can be sent through a
+// messenger on the given day. -1 means that there's no limit.
+func (q *warmupQuota) limit(messenger string, day time.Time) int {
+	total := 0
+	for _, w := range q.warmups[messenger] {
+		l := w.limit(day)
+		if l < 0 {
+			return -1
+		}
+		total += l
+	}
+	return total
+}
+
+// reserve reserves a send slot for a message on the given messenger and
+// returns the time at which the message can be sent. A zero time means that
+// it can be sent right away. Messages over a day's volume are scheduled into
+// the following days.
+func (q *warmupQuota) reserve(messenger string) time.Time {
+	if _, ok := q.warmups[messenger]; !ok {
+		return time.Time{}
+	}
+
+	q.mut.Lock()
+	defer q.mut.Unlock()
+
+	var (
+		now   = time.Now().In(q.loc)
+		today = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, q.loc)
+	)
+
+	d, ok := q.days[messenger]
+	if !ok || d.start.Before(today) {
+		d = &warmupDay{start: today}
+
+		// Count the messages that have already been sent today, eg: before a restart.
+		if n, err := q.count(messenger, today); err == nil {
+			d.count = n
+		}
+		q.days[messenger] = d
+	}
+
+	for {
+		l := q.limit(messenger, d.start)
+		if l < 0 || d.count < l {
+			break
+		}
+
+		// The day's volume is exhausted. Schedule the message into the next day.
+		d.start = d.start.AddDate(0, 0, 1)
+		d.count = 0
+	}
+	d.count++
+
+	if d.start.After(now) {
+		return d.start
+	}
+	return time.Time{}
+}
@@ -0,0 +1,122 @@
+package manager
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+)
+
+// sendWindow is a parsed models.SendWindow.
+type sendWindow struct {
+	days       [7]bool
+	start, end time.Duration
+	loc        *time.Location
+}
+
+// newSendWindow parses a campaign's sending window. Windows in no timezone
+// are in def. It returns nil if the window doesn't restrict the delivery.
+func newSendWindow(w models.SendWindow, def *time.Location) (*sendWindow, error) {
+	if w.IsZero() {
+		return nil, nil
+	}
+
+	out := &sendWindow{loc: def, end: time.Hour * 24}
+
+	if len(w.Days) == 0 {
+		for d := range out.days {
+			out.days[d] = true
+		}
+	}
+	for _, d := range w.Days {
+		if d < 0 || d > 6 {
+			return nil, fmt.Errorf("invalid day %d", d)
+		}
+		out.days[d] = true
+	}
+
+	if w.Start != "" || w.End != "" {
+		start, err := parseClock(w.Start)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClock(w.End)
+		if err != nil {
+			return nil, err
+		}
+		if start == end {
+			return nil, fmt.Errorf("window start and end are the same: %s", w.Start)
+		}
+
+		// The window spans midnight.
+		if end < start {
+			end += time.Hour * 24
+		}
+		out.start, out.end = start, end
+	}
+
+	if w.Timezone != "" {
+		loc, err := time.LoadLocation(w.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %s", w.Timezone)
+		}
+		out.loc = loc
+	}
+
+	return out, nil
+}
+
+// ValidateSendWindow returns an error if a campaign's sending window is invalid.
+func ValidateSendWindow(w models.SendWindow) error {
+	_, err := newSendWindow(w, time.UTC)
+	return err
+}
+
+// next returns the time at which the window next opens, or a zero time if
+// it's open at t.
+func (w *sendWindow) next(t time.Time) time.Time {
+	var (
+		lt   = t.In(w.loc)
+		next time.Time
+	)
+
+	// Windows that open on the previous day may span midnight into today.
+	for i := -1; i <= 7; i++ {
+		day := time.Date(lt.Year(), lt.Month(), lt.Day()+i, 0, 0, 0, 0, w.loc)
+		if !w.days[day.Weekday()] {
+			continue
+		}
+
+		start, end := w.at(day, w.start), w.at(day, w.end)
+		if !t.Before(start) && t.Before(end) {
+			return time.Time{}
+		}
+		if start.After(t) && (next.IsZero() || start.Before(next)) {
+			next = start
+		}
+	}
+
+	return next
+}
+
+// at returns the wall-clock time that's d into a day in the window's timezone.
+func (w *sendWindow) at(day time.Time, d time.Duration) time.Time {
+	return clockAt(day.In(w.loc), d)
+}
+
+// clockAt returns the wall-clock time that's d into a day in its timezone. It's
+// computed from the hours and minutes, and not by adding d, so that DST changes
+// don't shift it.
+func clockAt(day time.Time, d time.Duration) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), int(d/time.Hour), int(d%time.Hour/time.Minute), 0, 0, day.Location())
+}
+
+// parseClock parses an HH:MM time of day.
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
@@ -0,0 +1,317 @@
+package email
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/rand"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/knadh/smtppool"
+)
+
+// ctAMP is the MIME type of the AMP for Email part.
+const ctAMP = "text/x-amp-html"
+
+// ampConn is an idle connection that AMP messages are sent on.
+type ampConn struct {
+	cl           *smtp.Client
+	lastActivity time.Time
+}
+
+// sendAMP sends an e-mail with an AMP for Email part. smtppool only composes
+// text and HTML alternatives and can't send a message composed elsewhere, so
+// the message is composed here and sent on the server's AMP connections, which
+// are dialed with the same options as the pool and reused like its connections.
+func (s *Server) sendAMP(em smtppool.Email, amp []byte) error {
+	msg, err := makeAMPMessage(em, amp)
+	if err != nil {
+		return err
+	}
+
+	from := em.Sender
+	if from == "" {
+		from = em.From
+	}
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return err
+	}
+
+	var rcpts []string
+	for _, l := range [][]string{em.To, em.Cc, em.Bcc} {
+		for _, a := range l {
+			addr, err := mail.ParseAddress(a)
+			if err != nil {
+				return err
+			}
+			rcpts = append(rcpts, addr.Address)
+		}
+	}
+
+	cl, err := s.getAMPConn()
+	if err != nil {
+		return err
+	}
+
+	err = sendMessage(cl, sender.Address, rcpts, msg)
+
+	// As in the pool, only SMTP errors, eg: a rejected recipient, leave the
+	// connection usable. It's RSET before it's reused.
+	if _, ok := err.(*textproto.Error); (err == nil || ok) && cl.Reset() == nil {
+		s.putAMPConn(cl)
+	} else {
+		cl.Close()
+	}
+
+	return err
+}
+
+// sendMessage sends a raw message on an SMTP connection.
+func sendMessage(cl *smtp.Client, from string, rcpts []string, msg []byte) error {
+	if err := cl.Mail(from); err != nil {
+		return err
+	}
+	for _, r := range rcpts {
+		if err := cl.Rcpt(r); err != nil {
+			return err
+		}
+	}
+
+	w, err := cl.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		w.Close()
+		return err
+	}
+
+	return w.Close()
+}
+
+// getAMPConn returns an idle AMP connection, or a new one if there are none.
+// Connections that have been idle for longer than the pool's idle timeout are
+// closed.
+func (s *Server) getAMPConn() (*smtp.Client, error) {
+	for {
+		select {
+		case c := <-s.ampConns:
+			if s.IdleTimeout > 0 && time.Since(c.lastActivity) > s.IdleTimeout {
+				c.cl.Close()
+				continue
+			}
+			return c.cl, nil
+		default:
+			return s.dial()
+		}
+	}
+}
+
+// putAMPConn keeps a connection for reuse, or closes it if there are already
+// as many idle AMP connections as the pool's max connections.
+func (s *Server) putAMPConn(cl *smtp.Client) {
+	select {
+	case s.ampConns <- ampConn{cl: cl, lastActivity: time.Now()}:
+	default:
+		cl.Quit()
+	}
+}
+
+// closeAMPConns closes the idle AMP connections.
+func (s *Server) closeAMPConns() {
+	for {
+		select {
+		case c := <-s.ampConns:
+			c.cl.Quit()
+		default:
+			return
+		}
+	}
+}
+
+// dial connects and authenticates to the server with the same options as the pool.
+func (s *Server) dial() (*smtp.Client, error) {
+	var (
+		conn net.Conn
+		err  error
+		addr = net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	)
+	if s.TLSConfig != nil && s.SSL {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: s.PoolWaitTimeout}, "tcp", addr, s.TLSConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, s.PoolWaitTimeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cl, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if s.HelloHostname != "" {
+		cl.Hello(s.HelloHostname)
+	}
+
+	// STARTTLS.
+	if s.TLSConfig != nil && !s.SSL {
+		if ok, _ := cl.Extension("STARTTLS"); !ok {
+			cl.Close()
+			return nil, errors.New("SMTP STARTTLS extension not found")
+		}
+		if err := cl.StartTLS(s.TLSConfig); err != nil {
+			cl.Close()
+			return nil, err
+		}
+	}
+
+	if s.Auth != nil {
+		if ok, _ := cl.Extension("AUTH"); !ok {
+			cl.Close()
+			return nil, errors.New("SMTP AUTH extension not found")
+		}
+		if err := cl.Auth(s.Auth); err != nil {
+			cl.Close()
+			return nil, err
+		}
+	}
+
+	return cl, nil
+}
+
+// makeAMPMessage composes a MIME message with a multipart/alternative body of
+// text/plain, text/x-amp-html, and text/html parts, in that order, as AMP
+// supporting clients expect. Attachments are added in an outer multipart/mixed.
+func makeAMPMessage(em smtppool.Email, amp []byte) ([]byte, error) {
+	var (
+		buf = &bytes.Buffer{}
+		hdr = textproto.MIMEHeader{}
+	)
+
+	for k, v := range em.Headers {
+		hdr[k] = v
+	}
+	hdr.Set("From", em.From)
+	if len(em.To) > 0 {
+		hdr.Set("To", strings.Join(em.To, ", "))
+	}
+	if len(em.Cc) > 0 {
+		hdr.Set("Cc", strings.Join(em.Cc, ", "))
+	}
+	hdr.Set("Subject", mime.QEncoding.Encode("utf-8", em.Subject))
+	if hdr.Get("Message-Id") == "" {
+		hdr.Set("Message-Id", makeMessageID())
+	}
+	if hdr.Get("Date") == "" {
+		hdr.Set("Date", time.Now().Format(time.RFC1123Z))
+	}
+	hdr.Set("MIME-Version", "1.0")
+
+	var (
+		outer = multipart.NewWriter(buf)
+		alt   = outer
+	)
+	if len(em.Attachments) > 0 {
+		hdr.Set("Content-Type", "multipart/mixed;\r\n boundary="+outer.Boundary())
+	} else {
+		hdr.Set("Content-Type", "multipart/alternative;\r\n boundary="+outer.Boundary())
+	}
+	writeHeader(buf, hdr)
+	buf.WriteString("\r\n")
+
+	// Nest the alternatives in the mixed part.
+	if len(em.Attachments) > 0 {
+		alt = multipart.NewWriter(buf)
+		if _, err := outer.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {"multipart/alternative;\r\n boundary=" + alt.Boundary()},
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, p := range []struct {
+		typ  string
+		body []byte
+	}{
+		{"text/plain", em.Text},
+		{ctAMP, amp},
+		{"text/html", em.HTML},
+	} {
+		if len(p.body) == 0 {
+			continue
+		}
+
+		if _, err := alt.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.typ + "; charset=UTF-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		}); err != nil {
+			return nil, err
+		}
+
+		qp := quotedprintable.NewWriter(buf)
+		if _, err := qp.Write(p.body); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if alt != outer {
+		if err := alt.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, a := range em.Attachments {
+		w, err := outer.CreatePart(a.Header)
+		if err != nil {
+			return nil, err
+		}
+
+		// Base64 encode and wrap the content at 76 chars.
+		b := base64.StdEncoding.EncodeToString(a.Content)
+		for len(b) > 76 {
+			w.Write([]byte(b[:76] + "\r\n"))
+			b = b[76:]
+		}
+		w.Write([]byte(b + "\r\n"))
+	}
+
+	if err := outer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeHeader(buf *bytes.Buffer, hdr textproto.MIMEHeader) {
+	for k, vals := range hdr {
+		for _, v := range vals {
+			buf.WriteString(k + ": " + v + "\r\n")
+		}
+	}
+}
+
+func makeMessageID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	return fmt.Sprintf("<%d.%d@%s>", time.Now().UnixNano(), rand.Int63(), host)
+}
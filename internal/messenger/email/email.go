@@ -21,6 +21,9 @@ const (
 
 // Server represents an SMTP server's credentials.
 type Server struct {
+	// Optional name with which the server is also available as an individual
+	// messenger.
+	Name          string            `json:"name"`
 	Username      string            `json:"username"`
 	Password      string            `json:"password"`
 	AuthProtocol  string            `json:"auth_protocol"`
@@ -28,21 +31,29 @@ type Server struct {
 	TLSSkipVerify bool              `json:"tls_skip_verify"`
 	EmailHeaders  map[string]string `json:"email_headers"`
 
+	// Max total size (KB) of attachments in a message. 0 is no limit.
+	MaxAttachmentSize int `json:"max_attachment_size"`
+
 	// Rest of the options are embedded directly from the smtppool lib.
 	// The JSON tag is for config unmarshal to work.
 	smtppool.Opt `json:",squash"`
 
 	pool *smtppool.Pool
+
+	// Idle connections that AMP messages, which the pool can't send, are sent on.
+	ampConns chan ampConn
 }
 
 // Emailer is the SMTP e-mail messenger.
 type Emailer struct {
+	name    string
 	servers []*Server
 }
 
 // New returns an SMTP e-mail Messenger backend with the given SMTP servers.
 func New(servers ...Server) (*Emailer, error) {
 	e := &Emailer{
+		name:    emName,
 		servers: make([]*Server, 0, len(servers)),
 	}
 
@@ -83,15 +94,46 @@ func New(servers ...Server) (*Emailer, error) {
 		}
 
 		s.pool = pool
+
+		n := s.MaxConns
+		if n < 1 {
+			n = 1
+		}
+		s.ampConns = make(chan ampConn, n)
 		e.servers = append(e.servers, &s)
 	}
 
 	return e, nil
 }
 
+// NewNamed returns an SMTP e-mail Messenger backend with the given SMTP servers
+// that's identified by the given name instead of the default "email".
+func NewNamed(name string, servers ...Server) (*Emailer, error) {
+	e, err := New(servers...)
+	if err != nil {
+		return nil, err
+	}
+	e.name = name
+
+	return e, nil
+}
+
 // Name returns the Server's name.
 func (e *Emailer) Name() string {
-	return emName
+	return e.name
+}
+
+// MaxAttachmentSize returns the max total size (bytes) of attachments in a
+// message. As messages are sent to a random server, it's the smallest limit
+// across all servers.
+func (e *Emailer) MaxAttachmentSize() int64 {
+	var n int64
+	for _, s := range e.servers {
+		if l := int64(s.MaxAttachmentSize) * 1024; l > 0 && (n == 0 || l < n) {
+			n = l
+		}
+	}
+	return n
 }
 
 // Push pushes a message to the server.
@@ -137,9 +179,13 @@ func (e *Emailer) Push(m models.Message) error {
 		em.Headers.Set(k, v)
 	}
 
-	// Attach e-mail level headers.
+	// Attach e-mail level headers. They replace the SMTP level
+	// headers of the same name.
 	for k, v := range m.Headers {
-		em.Headers.Set(k, v[0])
+		em.Headers.Del(k)
+		for _, val := range v {
+			em.Headers.Add(k, val)
+		}
 	}
 
 	// If the `Return-Path` header is set, it should be set as the
@@ -173,6 +219,11 @@ func (e *Emailer) Push(m models.Message) error {
 		if len(m.AltBody) > 0 {
 			em.Text = m.AltBody
 		}
+
+		// AMP messages can't be composed by the pool.
+		if len(m.AMPBody) > 0 {
+			return srv.sendAMP(em, m.AMPBody)
+		}
 	}
 
 	return srv.pool.Send(em)
@@ -187,6 +238,7 @@ func (e *Emailer) Flush() error {
 func (e *Emailer) Close() error {
 	for _, s := range e.servers {
 		s.pool.Close()
+		s.closeAMPConns()
 	}
 	return nil
 }
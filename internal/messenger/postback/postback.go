@@ -20,6 +20,7 @@ type postback struct {
 	FromEmail   string       `json:"from_email"`
 	ContentType string       `json:"content_type"`
 	Body        string       `json:"body"`
+	AMPBody     string       `json:"amp_body,omitempty"`
 	Recipients  []recipient  `json:"recipients"`
 	Campaign    *campaign    `json:"campaign"`
 	Attachments []attachment `json:"attachments"`
@@ -34,11 +35,12 @@ type campaign struct {
 }
 
 type recipient struct {
-	UUID    string      `json:"uuid"`
-	Email   string      `json:"email"`
-	Name    string      `json:"name"`
-	Attribs models.JSON `json:"attribs"`
-	Status  string      `json:"status"`
+	UUID     string                    `json:"uuid"`
+	Email    string                    `json:"email"`
+	Name     string                    `json:"name"`
+	Attribs  models.JSON               `json:"attribs"`
+	Status   string                    `json:"status"`
+	Channels models.SubscriberChannels `json:"channels"`
 }
 
 type attachment struct {
@@ -56,6 +58,13 @@ type Options struct {
 	MaxConns int           `json:"max_conns"`
 	Retries  int           `json:"retries"`
 	Timeout  time.Duration `json:"timeout"`
+
+	// Subscriber channel (phone|push|messenger) that the messenger delivers
+	// to. Empty is e-mail.
+	Channel string `json:"channel"`
+
+	// Max total size (KB) of attachments in a message. 0 is no limit.
+	MaxAttachmentSize int `json:"max_attachment_size"`
 }
 
 // Postback represents an HTTP Message server.
@@ -93,6 +102,16 @@ func (p *Postback) Name() string {
 	return p.o.Name
 }
 
+// Channel returns the subscriber channel that the messenger delivers to.
+func (p *Postback) Channel() string {
+	return p.o.Channel
+}
+
+// MaxAttachmentSize returns the max total size (bytes) of attachments in a message.
+func (p *Postback) MaxAttachmentSize() int64 {
+	return int64(p.o.MaxAttachmentSize) * 1024
+}
+
 // Push pushes a message to the server.
 func (p *Postback) Push(m models.Message) error {
 	pb := postback{
@@ -100,12 +119,14 @@ func (p *Postback) Push(m models.Message) error {
 		FromEmail:   m.From,
 		ContentType: m.ContentType,
 		Body:        string(m.Body),
+		AMPBody:     string(m.AMPBody),
 		Recipients: []recipient{{
-			UUID:    m.Subscriber.UUID,
-			Email:   m.Subscriber.Email,
-			Name:    m.Subscriber.Name,
-			Status:  m.Subscriber.Status,
-			Attribs: m.Subscriber.Attribs,
+			UUID:     m.Subscriber.UUID,
+			Email:    m.Subscriber.Email,
+			Name:     m.Subscriber.Name,
+			Status:   m.Subscriber.Status,
+			Attribs:  m.Subscriber.Attribs,
+			Channels: m.Subscriber.Channels,
 		}},
 	}
 
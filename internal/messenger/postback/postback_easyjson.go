@@ -46,6 +46,8 @@ func easyjsonDf11841fDecodeGithubComKnadhListmonkInternalMessengerPostback(in *j
 			out.ContentType = string(in.String())
 		case "body":
 			out.Body = string(in.String())
+		case "amp_body":
+			out.AMPBody = string(in.String())
 		case "recipients":
 			if in.IsNull() {
 				in.Skip()
@@ -136,6 +138,11 @@ func easyjsonDf11841fEncodeGithubComKnadhListmonkInternalMessengerPostback(out *
 		out.RawString(prefix)
 		out.String(string(in.Body))
 	}
+	if in.AMPBody != "" {
+		const prefix string = ",\"amp_body\":"
+		out.RawString(prefix)
+		out.String(string(in.AMPBody))
+	}
 	{
 		const prefix string = ",\"recipients\":"
 		out.RawString(prefix)
@@ -539,6 +546,22 @@ func easyjsonDf11841fDecodeGithubComKnadhListmonkInternalMessengerPostback1(in *
 			}
 		case "status":
 			out.Status = string(in.String())
+		case "channels":
+			if in.IsNull() {
+				in.Skip()
+			} else {
+				in.Delim('{')
+				out.Channels = make(models.SubscriberChannels)
+				for !in.IsDelim('}') {
+					key := string(in.String())
+					in.WantColon()
+					var v25 models.SubscriberChannel
+					easyjsonDf11841fDecodeGithubComKnadhListmonkModels(in, &v25)
+					(out.Channels)[key] = v25
+					in.WantComma()
+				}
+				in.Delim('}')
+			}
 		default:
 			in.SkipRecursive()
 		}
@@ -600,5 +623,75 @@ func easyjsonDf11841fEncodeGithubComKnadhListmonkInternalMessengerPostback1(out
 		out.RawString(prefix)
 		out.String(string(in.Status))
 	}
+	{
+		const prefix string = ",\"channels\":"
+		out.RawString(prefix)
+		if in.Channels == nil && (out.Flags&jwriter.NilMapAsEmpty) == 0 {
+			out.RawString(`null`)
+		} else {
+			out.RawByte('{')
+			v26First := true
+			for v26Name, v26Value := range in.Channels {
+				if v26First {
+					v26First = false
+				} else {
+					out.RawByte(',')
+				}
+				out.String(string(v26Name))
+				out.RawByte(':')
+				easyjsonDf11841fEncodeGithubComKnadhListmonkModels(out, v26Value)
+			}
+			out.RawByte('}')
+		}
+	}
+	out.RawByte('}')
+}
+func easyjsonDf11841fDecodeGithubComKnadhListmonkModels(in *jlexer.Lexer, out *models.SubscriberChannel) {
+	isTopLevel := in.IsStart()
+	if in.IsNull() {
+		if isTopLevel {
+			in.Consumed()
+		}
+		in.Skip()
+		return
+	}
+	in.Delim('{')
+	for !in.IsDelim('}') {
+		key := in.UnsafeFieldName(false)
+		in.WantColon()
+		if in.IsNull() {
+			in.Skip()
+			in.WantComma()
+			continue
+		}
+		switch key {
+		case "value":
+			out.Value = string(in.String())
+		case "consent":
+			out.Consent = bool(in.Bool())
+		default:
+			in.SkipRecursive()
+		}
+		in.WantComma()
+	}
+	in.Delim('}')
+	if isTopLevel {
+		in.Consumed()
+	}
+}
+func easyjsonDf11841fEncodeGithubComKnadhListmonkModels(out *jwriter.Writer, in models.SubscriberChannel) {
+	out.RawByte('{')
+	first := true
+	_ = first
+	{
+		const prefix string = ",\"value\":"
+		out.RawString(prefix[1:])
+		out.String(string(in.Value))
+	}
+	{
+		const prefix string = ",\"consent\":"
+		out.RawString(prefix)
+		out.Bool(bool(in.Consent))
+	}
 	out.RawByte('}')
 }
@@ -0,0 +1,1025 @@
+package migrations
+
+import (
+	"log"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/knadh/koanf/v2"
+	"github.com/knadh/stuffbin"
+)
+
+// V4_0_0 performs the DB migrations.
+func V4_0_0(db *sqlx.DB, fs stuffbin.FileSystem, ko *koanf.Koanf, lo *log.Logger) error {
+	// Insert new settings.
+	if _, err := db.Exec(`
+		INSERT INTO settings (key, value) VALUES
+		('app.default_timezone', '"UTC"'),
+		('app.search_attribs', '[]'),
+		('app.search_attribs_indexed', '[]'),
+		('app.max_attachment_size', '10240'),
+		('costs.currency', '"USD"'),
+		('costs.default', '0'),
+		('costs.messengers', '[]'),
+		('security.scan_attachments', 'false'),
+		('security.scan_type', '"clamav"'),
+		('security.scan_url', '"tcp://localhost:3310"'),
+		('security.scan_timeout', '"10s"'),
+		('app.failover_errors', '5'),
+		('app.domain_limits', '[]'),
+		('app.seed_emails', '[]'),
+		('privacy.tracking_domains', '[]'),
+		('app.test_list_id', '0'),
+		('app.test_variants', '[]'),
+		('app.attrib_schema', '[]'),
+		('privacy.frequencies', '[]'),
+		('privacy.topics', '[]'),
+		('webhooks', '[]'),
+		('app.frequency_cap_daily', '0'),
+		('app.frequency_cap_weekly', '0'),
+		('app.frequency_cap_action', '"skip"'),
+		('app.quiet_hours_start', '""'),
+		('app.quiet_hours_end', '""'),
+		('app.attrib_triggers', '[]'),
+		('privacy.soft_delete', 'false'),
+		('privacy.soft_delete_purge_days', '30'),
+		('privacy.hygiene_unconfirmed_days', '0'),
+		('privacy.hygiene_unengaged_months', '0'),
+		('privacy.hygiene_blocklisted_days', '0'),
+		('privacy.block_disposable_emails', 'false'),
+		('privacy.disposable_domains_url', '"https://raw.githubusercontent.com/disposable-email-domains/disposable-email-domains/main/disposable_email_blocklist.conf"'),
+		('app.mjml_url', '""'),
+		('app.mjml_username', '""'),
+		('app.mjml_password', '""'),
+		('app.mjml_timeout', '"10s"'),
+		('app.template_lint_block', 'false'),
+		('app.template_gallery_url', '""')
+		ON CONFLICT DO NOTHING;
+	`); err != nil {
+		return err
+	}
+
+	// Per-subscriber timezone scheduling.
+	if _, err := db.Exec(`
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS send_at_local BOOLEAN NOT NULL DEFAULT false;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS tz_bucket_at TIMESTAMP WITH TIME ZONE NULL;
+	`); err != nil {
+		return err
+	}
+
+	// AMP for Email bodies.
+	if _, err := db.Exec(`
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS body_amp TEXT NULL;
+		ALTER TABLE templates ADD COLUMN IF NOT EXISTS body_amp TEXT NOT NULL DEFAULT '';
+	`); err != nil {
+		return err
+	}
+
+	// Campaign cost tracking.
+	if _, err := db.Exec(`
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS segments INT NOT NULL DEFAULT 0;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS cost NUMERIC(16, 6) NOT NULL DEFAULT 0;
+	`); err != nil {
+		return err
+	}
+
+	// Messenger failover and delivery records.
+	if _, err := db.Exec(`
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS failover_messengers TEXT[] NOT NULL DEFAULT '{}';
+
+		CREATE TABLE IF NOT EXISTS campaign_deliveries (
+			id               BIGSERIAL PRIMARY KEY,
+			campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			subscriber_id    INTEGER NULL REFERENCES subscribers(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			messenger        TEXT NOT NULL,
+			created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_deliveries_camp_id ON campaign_deliveries(campaign_id);
+		CREATE INDEX IF NOT EXISTS idx_deliveries_subscriber_id ON campaign_deliveries(subscriber_id);
+	`); err != nil {
+		return err
+	}
+
+	// Conditional content blocks.
+	if _, err := db.Exec(`ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS content_blocks JSONB NOT NULL DEFAULT '[]'`); err != nil {
+		return err
+	}
+
+	// UTM params appended to tracked links.
+	if _, err := db.Exec(`ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS utm_params JSONB NOT NULL DEFAULT '{}'`); err != nil {
+		return err
+	}
+
+	// Alternate link and view tracking domains.
+	if _, err := db.Exec(`
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS tracking_domain TEXT NOT NULL DEFAULT '';
+		ALTER TABLE lists ADD COLUMN IF NOT EXISTS tracking_domain TEXT NOT NULL DEFAULT '';
+	`); err != nil {
+		return err
+	}
+
+	// Versions of the content of campaigns that are edited while being sent.
+	if _, err := db.Exec(`
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS content_version INTEGER NOT NULL DEFAULT 1;
+		ALTER TABLE campaign_deliveries ADD COLUMN IF NOT EXISTS content_version INTEGER NOT NULL DEFAULT 1;
+
+		CREATE TABLE IF NOT EXISTS campaign_versions (
+			id               BIGSERIAL PRIMARY KEY,
+			campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			version          INTEGER NOT NULL,
+			subject          TEXT NOT NULL,
+			body             TEXT NOT NULL,
+			altbody          TEXT NULL,
+			body_amp         TEXT NULL,
+			content_type     content_type NOT NULL,
+			template_id      INTEGER NULL REFERENCES templates(id) ON DELETE SET NULL,
+			content_blocks   JSONB NOT NULL DEFAULT '[]',
+			created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			UNIQUE (campaign_id, version)
+		);
+	`); err != nil {
+		return err
+	}
+
+	// Send deadlines of campaigns.
+	if _, err := db.Exec(`
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS send_until TIMESTAMP WITH TIME ZONE NULL;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS expired BOOLEAN NOT NULL DEFAULT false;
+	`); err != nil {
+		return err
+	}
+
+	// Test batches of campaigns.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS campaign_tests (
+			id               BIGSERIAL PRIMARY KEY,
+			campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			content_version  INTEGER NOT NULL,
+			subject          TEXT NOT NULL,
+			variants         TEXT[] NOT NULL DEFAULT '{}',
+			recipients       INTEGER NOT NULL DEFAULT 0,
+			created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_camp_tests_camp_id ON campaign_tests(campaign_id);
+	`); err != nil {
+		return err
+	}
+
+	// Revisions of the content of campaigns.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS campaign_revisions (
+			id               BIGSERIAL PRIMARY KEY,
+			campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			subject          TEXT NOT NULL,
+			body             TEXT NOT NULL,
+			altbody          TEXT NULL,
+			body_amp         TEXT NULL,
+			content_type     content_type NOT NULL,
+			template_id      INTEGER NULL REFERENCES templates(id) ON DELETE SET NULL,
+			content_blocks   JSONB NOT NULL DEFAULT '[]',
+			created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_camp_revs_camp_id ON campaign_revisions(campaign_id);
+
+		-- The current content of existing campaigns is their first revision.
+		INSERT INTO campaign_revisions (campaign_id, subject, body, altbody, body_amp, content_type, template_id, content_blocks)
+			SELECT id, subject, body, altbody, body_amp, content_type, template_id, content_blocks FROM campaigns
+			WHERE NOT EXISTS (SELECT 1 FROM campaign_revisions WHERE campaign_id = campaigns.id);
+	`); err != nil {
+		return err
+	}
+
+	// Sending windows of campaigns.
+	if _, err := db.Exec(`ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS send_window JSONB NOT NULL DEFAULT '{}'`); err != nil {
+		return err
+	}
+
+	// Scheduling priorities of campaigns.
+	if _, err := db.Exec(`ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS priority SMALLINT NOT NULL DEFAULT 5 CHECK (priority BETWEEN 1 AND 10)`); err != nil {
+		return err
+	}
+
+	// List-ID header overrides of campaigns.
+	if _, err := db.Exec(`ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS list_id_header VARCHAR(300) NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+
+	// RSS/Atom feeds that are sent as campaigns.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS rss_feeds (
+			id               SERIAL PRIMARY KEY,
+			uuid             uuid NOT NULL UNIQUE,
+			name             TEXT NOT NULL,
+			url              TEXT NOT NULL,
+			enabled          BOOLEAN NOT NULL DEFAULT true,
+			poll_interval    TEXT NOT NULL DEFAULT '1h',
+			list_ids         INTEGER[] NOT NULL DEFAULT '{}',
+			template_id      INTEGER NULL REFERENCES templates(id) ON DELETE SET NULL,
+			subject          TEXT NOT NULL DEFAULT '',
+			from_email       TEXT NOT NULL DEFAULT '',
+			messenger        TEXT NOT NULL DEFAULT 'email',
+			body             TEXT NOT NULL DEFAULT '',
+			max_items        INTEGER NOT NULL DEFAULT 10,
+			auto_send        BOOLEAN NOT NULL DEFAULT true,
+			checked_at       TIMESTAMP WITH TIME ZONE NULL,
+			last_error       TEXT NOT NULL DEFAULT '',
+			created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+
+		-- Items of RSS feeds that have been seen, and the campaigns they were sent in.
+		CREATE TABLE IF NOT EXISTS rss_feed_items (
+			feed_id          INTEGER NOT NULL REFERENCES rss_feeds(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			guid             TEXT NOT NULL,
+			campaign_id      INTEGER NULL REFERENCES campaigns(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			PRIMARY KEY (feed_id, guid)
+		);
+	`); err != nil {
+		return err
+	}
+
+	// Access control of campaigns on the public archive.
+	if _, err := db.Exec(`
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS archive_access TEXT NOT NULL DEFAULT 'public'
+			CHECK (archive_access IN ('public', 'password', 'subscriber'));
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS archive_password TEXT NOT NULL DEFAULT '';
+	`); err != nil {
+		return err
+	}
+
+	// Recipients of campaigns frozen when they're scheduled.
+	if _, err := db.Exec(`
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS freeze_recipients BOOLEAN NOT NULL DEFAULT false;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS recipients_frozen_at TIMESTAMP WITH TIME ZONE NULL;
+
+		CREATE TABLE IF NOT EXISTS campaign_recipients (
+			id               BIGSERIAL PRIMARY KEY,
+			campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			subscriber_id    INTEGER NULL REFERENCES subscribers(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			email            TEXT NOT NULL DEFAULT '',
+			created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_camp_recipients_camp_sub ON campaign_recipients (campaign_id, subscriber_id);
+	`); err != nil {
+		return err
+	}
+
+	// Delivery outcomes of every message of campaigns.
+	if _, err := db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'delivery_status') THEN
+				CREATE TYPE delivery_status AS ENUM ('queued', 'sent', 'errored', 'bounced');
+			END IF;
+		END$$;
+
+		ALTER TABLE campaign_deliveries ADD COLUMN IF NOT EXISTS status delivery_status NOT NULL DEFAULT 'sent';
+		ALTER TABLE campaign_deliveries ADD COLUMN IF NOT EXISTS error TEXT NOT NULL DEFAULT '';
+		ALTER TABLE campaign_deliveries ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW();
+	`); err != nil {
+		return err
+	}
+
+	// Language variants of the content of campaigns.
+	if _, err := db.Exec(`ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS lang_variants JSONB NOT NULL DEFAULT '[]'`); err != nil {
+		return err
+	}
+
+	// Categories and retries of errored campaign messages.
+	if _, err := db.Exec(`
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS retrying BOOLEAN NOT NULL DEFAULT false;
+		ALTER TABLE campaign_deliveries ADD COLUMN IF NOT EXISTS error_type TEXT NOT NULL DEFAULT '';
+		ALTER TABLE campaign_deliveries ADD COLUMN IF NOT EXISTS retries INTEGER NOT NULL DEFAULT 0;
+	`); err != nil {
+		return err
+	}
+
+	// Actions triggered by the views and clicks of campaigns.
+	if _, err := db.Exec(`ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS engagement_rules JSONB NOT NULL DEFAULT '[]'`); err != nil {
+		return err
+	}
+
+	// Lists whose subscribers are excluded from campaigns.
+	if _, err := db.Exec(`ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS exclude_list_ids INTEGER[] NOT NULL DEFAULT '{}'`); err != nil {
+		return err
+	}
+
+	// Staged sending (rollout) of campaigns.
+	if _, err := db.Exec(`
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS rollout JSONB NOT NULL DEFAULT '{}';
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS rollout_held_until TIMESTAMP WITH TIME ZONE NULL;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS rollout_checked_at TIMESTAMP WITH TIME ZONE NULL;
+	`); err != nil {
+		return err
+	}
+
+	// Preheaders (preview text) on campaigns and templates.
+	if _, err := db.Exec(`
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS preheader TEXT NOT NULL DEFAULT '';
+		ALTER TABLE templates ADD COLUMN IF NOT EXISTS preheader TEXT NOT NULL DEFAULT '';
+	`); err != nil {
+		return err
+	}
+
+	// Campaigns scheduled in a timezone.
+	if _, err := db.Exec(`
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS send_at_timezone TEXT NOT NULL DEFAULT '';
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS send_at_wall TIMESTAMP WITHOUT TIME ZONE NULL;
+	`); err != nil {
+		return err
+	}
+
+	// Positions of clicked links in campaign bodies.
+	if _, err := db.Exec(`ALTER TABLE link_clicks ADD COLUMN IF NOT EXISTS position INTEGER NULL;`); err != nil {
+		return err
+	}
+
+	// Messenger send quotas and usage.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS messenger_usage (
+			messenger        TEXT NOT NULL,
+			date             DATE NOT NULL,
+			sent             INTEGER NOT NULL DEFAULT 0,
+
+			PRIMARY KEY (messenger, date)
+		);
+		INSERT INTO settings (key, value) VALUES ('app.messenger_quotas', '[]') ON CONFLICT DO NOTHING;
+	`); err != nil {
+		return err
+	}
+
+	// Campaign dry runs.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS campaign_simulations (
+			campaign_id      INTEGER NOT NULL PRIMARY KEY REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			status           TEXT NOT NULL DEFAULT 'running',
+			error            TEXT NOT NULL DEFAULT '',
+			rendered         INTEGER NOT NULL DEFAULT 0,
+			errors           INTEGER NOT NULL DEFAULT 0,
+			domains          JSONB NOT NULL DEFAULT '[]',
+			error_samples    JSONB NOT NULL DEFAULT '[]',
+			started_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			updated_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+	`); err != nil {
+		return err
+	}
+
+	// Audit trail of subscriber erasures.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS subscriber_erasures (
+			id               SERIAL PRIMARY KEY,
+			subscriber_id    INTEGER NULL REFERENCES subscribers(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			reason           TEXT NOT NULL DEFAULT '',
+			erased_by        TEXT NOT NULL DEFAULT '',
+			subscriptions    INTEGER NOT NULL DEFAULT 0,
+			views            INTEGER NOT NULL DEFAULT 0,
+			clicks           INTEGER NOT NULL DEFAULT 0,
+			deliveries       INTEGER NOT NULL DEFAULT 0,
+			bounces          INTEGER NOT NULL DEFAULT 0,
+			created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_sub_erasures_date ON subscriber_erasures(created_at);
+	`); err != nil {
+		return err
+	}
+
+	// Subscriber engagement scores.
+	if _, err := db.Exec(`
+		ALTER TABLE subscribers ADD COLUMN IF NOT EXISTS engagement_score DOUBLE PRECISION NOT NULL DEFAULT 0;
+		ALTER TABLE subscribers ADD COLUMN IF NOT EXISTS engagement_updated_at TIMESTAMP WITH TIME ZONE NULL;
+		CREATE INDEX IF NOT EXISTS idx_subs_engagement_score ON subscribers(engagement_score);
+	`); err != nil {
+		return err
+	}
+
+	// Saved segments.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS segments (
+			id               SERIAL PRIMARY KEY,
+			uuid             uuid NOT NULL UNIQUE,
+			name             TEXT NOT NULL,
+			description      TEXT NOT NULL DEFAULT '',
+			query            TEXT NOT NULL,
+			subscriber_count INTEGER NOT NULL DEFAULT 0,
+			refreshed_at     TIMESTAMP WITH TIME ZONE NULL,
+			created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			updated_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+		CREATE TABLE IF NOT EXISTS segment_subscribers (
+			segment_id       INTEGER NOT NULL REFERENCES segments(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			PRIMARY KEY(segment_id, subscriber_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_segment_subs_sub_id ON segment_subscribers(subscriber_id);
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS segment_ids INTEGER[] NOT NULL DEFAULT '{}';
+	`); err != nil {
+		return err
+	}
+
+	// Background bulk subscriber jobs.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS subscriber_jobs (
+			id               SERIAL PRIMARY KEY,
+			action           TEXT NOT NULL,
+			query            TEXT NOT NULL DEFAULT '',
+			list_ids         INTEGER[] NOT NULL DEFAULT '{}',
+			target_list_ids  INTEGER[] NOT NULL DEFAULT '{}',
+			sub_status       TEXT NOT NULL DEFAULT '',
+			created_by       TEXT NOT NULL DEFAULT '',
+			status           TEXT NOT NULL DEFAULT 'running',
+			error            TEXT NOT NULL DEFAULT '',
+			matched          INTEGER NOT NULL DEFAULT 0,
+			processed        INTEGER NOT NULL DEFAULT 0,
+			created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			updated_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			finished_at      TIMESTAMP WITH TIME ZONE NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_sub_jobs_date ON subscriber_jobs(created_at);
+	`); err != nil {
+		return err
+	}
+
+	// Pending subscriber e-mail changes.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS subscriber_email_changes (
+			subscriber_id    INTEGER NOT NULL PRIMARY KEY REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			email            TEXT NOT NULL,
+			token            UUID NOT NULL UNIQUE,
+			created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+	`); err != nil {
+		return err
+	}
+
+	// Per-list double opt-in e-mails and redirects.
+	if _, err := db.Exec(`
+		ALTER TABLE lists ADD COLUMN IF NOT EXISTS optin_template_id INTEGER NULL;
+		ALTER TABLE lists ADD COLUMN IF NOT EXISTS optin_subject TEXT NOT NULL DEFAULT '';
+		ALTER TABLE lists ADD COLUMN IF NOT EXISTS optin_from_email TEXT NOT NULL DEFAULT '';
+		ALTER TABLE lists ADD COLUMN IF NOT EXISTS optin_redirect_url TEXT NOT NULL DEFAULT '';
+	`); err != nil {
+		return err
+	}
+
+	// Subscriber notes.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS subscriber_notes (
+			id               SERIAL PRIMARY KEY,
+			subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			author           TEXT NOT NULL DEFAULT '',
+			note             TEXT NOT NULL,
+			created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			updated_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_sub_notes_sub_id ON subscriber_notes(subscriber_id);
+	`); err != nil {
+		return err
+	}
+
+	// Per-list frequency caps and campaign messages skipped for them.
+	if _, err := db.Exec(`
+		ALTER TABLE lists ADD COLUMN IF NOT EXISTS frequency_cap_daily INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE lists ADD COLUMN IF NOT EXISTS frequency_cap_weekly INTEGER NOT NULL DEFAULT 0;
+	`); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`ALTER TYPE delivery_status ADD VALUE IF NOT EXISTS 'skipped'`); err != nil {
+		return err
+	}
+
+	// Domain blocklist hit counters.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS domain_blocklist_hits (
+			domain           TEXT NOT NULL PRIMARY KEY,
+			hits             BIGINT NOT NULL DEFAULT 0,
+			last_hit_at      TIMESTAMP WITH TIME ZONE NULL
+		);
+	`); err != nil {
+		return err
+	}
+
+	// Subscriber tags, campaigns sent to tags, and bulk tag jobs.
+	if _, err := db.Exec(`
+		ALTER TABLE subscribers ADD COLUMN IF NOT EXISTS tags VARCHAR(100)[] NOT NULL DEFAULT '{}';
+		CREATE INDEX IF NOT EXISTS idx_subs_tags ON subscribers USING GIN(tags);
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS subscriber_tags VARCHAR(100)[] NOT NULL DEFAULT '{}';
+		ALTER TABLE subscriber_jobs ADD COLUMN IF NOT EXISTS tags VARCHAR(100)[] NOT NULL DEFAULT '{}';
+	`); err != nil {
+		return err
+	}
+
+	// Subscription TTLs and re-permission e-mails of lists.
+	if _, err := db.Exec(`
+		ALTER TABLE lists ADD COLUMN IF NOT EXISTS subscription_ttl INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE lists ADD COLUMN IF NOT EXISTS repermission_grace INTEGER NOT NULL DEFAULT 14;
+		ALTER TABLE subscriber_lists ADD COLUMN IF NOT EXISTS repermission_sent_at TIMESTAMP WITH TIME ZONE NULL;
+	`); err != nil {
+		return err
+	}
+
+	// Soft-deleted subscribers.
+	if _, err := db.Exec(`ALTER TYPE subscriber_status ADD VALUE IF NOT EXISTS 'deleted'`); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`
+		ALTER TABLE subscribers ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE NULL;
+		ALTER TABLE subscribers ADD COLUMN IF NOT EXISTS restore_status subscriber_status NULL;
+		CREATE INDEX IF NOT EXISTS idx_subs_deleted_at ON subscribers(deleted_at) WHERE deleted_at IS NOT NULL;
+
+		-- Exclude soft-deleted subscribers from the cached counts.
+		DROP MATERIALIZED VIEW IF EXISTS mat_dashboard_counts;
+		CREATE MATERIALIZED VIEW mat_dashboard_counts AS
+		WITH subs AS (
+			SELECT COUNT(*) AS num, status FROM subscribers GROUP BY status
+		)
+		SELECT NOW() AS updated_at,
+			JSON_BUILD_OBJECT(
+				'subscribers', JSON_BUILD_OBJECT(
+					'total', (SELECT SUM(num) FROM subs WHERE status != 'deleted'),
+					'blocklisted', (SELECT num FROM subs WHERE status='blocklisted'),
+					'deleted', (SELECT num FROM subs WHERE status='deleted'),
+					'orphans', (
+						SELECT COUNT(id) FROM subscribers
+						LEFT JOIN subscriber_lists ON (subscribers.id = subscriber_lists.subscriber_id)
+						WHERE subscriber_lists.subscriber_id IS NULL AND subscribers.status != 'deleted'
+					)
+				),
+				'lists', JSON_BUILD_OBJECT(
+					'total', (SELECT COUNT(*) FROM lists),
+					'private', (SELECT COUNT(*) FROM lists WHERE type='private'),
+					'public', (SELECT COUNT(*) FROM lists WHERE type='public'),
+					'optin_single', (SELECT COUNT(*) FROM lists WHERE optin='single'),
+					'optin_double', (SELECT COUNT(*) FROM lists WHERE optin='double')
+				),
+				'campaigns', JSON_BUILD_OBJECT(
+					'total', (SELECT COUNT(*) FROM campaigns),
+					'by_status', (
+						SELECT JSON_OBJECT_AGG (status, num) FROM
+						(SELECT status, COUNT(*) AS num FROM campaigns GROUP BY status) r
+					)
+				),
+				'messages', (SELECT SUM(sent) AS messages FROM campaigns)
+			) AS data;
+		CREATE UNIQUE INDEX IF NOT EXISTS mat_dashboard_stats_idx ON mat_dashboard_counts (updated_at);
+
+		DROP MATERIALIZED VIEW IF EXISTS mat_list_subscriber_stats;
+		CREATE MATERIALIZED VIEW mat_list_subscriber_stats AS
+		SELECT NOW() AS updated_at, lists.id AS list_id, subscriber_lists.status, COUNT(subscribers.id) AS subscriber_count FROM lists
+		LEFT JOIN subscriber_lists ON (subscriber_lists.list_id = lists.id)
+		LEFT JOIN subscribers ON (subscribers.id = subscriber_lists.subscriber_id AND subscribers.status != 'deleted')
+		GROUP BY lists.id, subscriber_lists.status
+		UNION ALL
+		SELECT NOW() AS updated_at, 0 AS list_id, NULL AS status, COUNT(*) AS subscriber_count FROM subscribers WHERE status != 'deleted';
+		CREATE UNIQUE INDEX IF NOT EXISTS mat_list_subscriber_stats_idx ON mat_list_subscriber_stats (list_id, status);
+	`); err != nil {
+		return err
+	}
+
+	// Identities and consent flags of subscribers on non-e-mail channels.
+	if _, err := db.Exec(`ALTER TABLE subscribers ADD COLUMN IF NOT EXISTS channels JSONB NOT NULL DEFAULT '{}'`); err != nil {
+		return err
+	}
+
+	// Full-text and trigram search over subscribers.
+	if _, err := db.Exec(`CREATE EXTENSION IF NOT EXISTS pg_trgm`); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`
+		ALTER TABLE subscribers ADD COLUMN IF NOT EXISTS search_text TEXT NOT NULL DEFAULT '';
+
+		CREATE OR REPLACE FUNCTION subscriber_search_text(email TEXT, name TEXT, attribs JSONB) RETURNS TEXT AS $$
+			SELECT LOWER(CONCAT_WS(' ', email, name, (
+				SELECT STRING_AGG(attribs->>k, ' ') FROM JSONB_ARRAY_ELEMENTS_TEXT(
+					COALESCE((SELECT value FROM settings WHERE key = 'app.search_attribs'), '[]')
+				) AS k
+			)))
+		$$ LANGUAGE SQL STABLE;
+
+		CREATE OR REPLACE FUNCTION subscriber_search_text_trigger() RETURNS TRIGGER AS $$
+		BEGIN
+			NEW.search_text = subscriber_search_text(NEW.email, NEW.name, NEW.attribs);
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		DROP TRIGGER IF EXISTS trg_subscriber_search_text ON subscribers;
+		CREATE TRIGGER trg_subscriber_search_text BEFORE INSERT OR UPDATE OF email, name, attribs ON subscribers
+			FOR EACH ROW EXECUTE FUNCTION subscriber_search_text_trigger();
+
+		UPDATE subscribers SET search_text = subscriber_search_text(email, name, attribs) WHERE search_text = '';
+
+		CREATE INDEX IF NOT EXISTS idx_subs_search_trgm ON subscribers USING GIN(search_text gin_trgm_ops);
+		CREATE INDEX IF NOT EXISTS idx_subs_search_fts ON subscribers USING GIN(TO_TSVECTOR('simple', search_text));
+	`); err != nil {
+		return err
+	}
+
+	// External IDs of subscribers synced from other systems.
+	if _, err := db.Exec(`ALTER TABLE subscribers ADD COLUMN IF NOT EXISTS external_id TEXT NULL UNIQUE`); err != nil {
+		return err
+	}
+
+	// Structured filters that segment queries are compiled from.
+	if _, err := db.Exec(`ALTER TABLE segments ADD COLUMN IF NOT EXISTS filter JSONB NULL`); err != nil {
+		return err
+	}
+
+	// API tokens with roles.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS api_tokens (
+			id               SERIAL PRIMARY KEY,
+			name             TEXT NOT NULL,
+			username         TEXT NOT NULL UNIQUE,
+			token_hash       TEXT NOT NULL,
+			role             TEXT NOT NULL,
+			last_used_at     TIMESTAMP WITH TIME ZONE NULL,
+			created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+	`); err != nil {
+		return err
+	}
+
+	// Immutable records of the consent of subscribers to their subscriptions.
+	if _, err := db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'consent_type') THEN
+				CREATE TYPE consent_type AS ENUM ('subscription', 'confirmation');
+			END IF;
+		END$$;
+
+		CREATE TABLE IF NOT EXISTS subscriber_consents (
+			id               BIGSERIAL PRIMARY KEY,
+			subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE,
+			type             consent_type NOT NULL,
+			list_ids         INTEGER[] NOT NULL DEFAULT '{}',
+			ip               TEXT NOT NULL DEFAULT '',
+			user_agent       TEXT NOT NULL DEFAULT '',
+			source           TEXT NOT NULL DEFAULT '',
+			url              TEXT NOT NULL DEFAULT '',
+			created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_sub_consents_sub_id ON subscriber_consents(subscriber_id);
+
+		CREATE OR REPLACE FUNCTION subscriber_consents_immutable() RETURNS TRIGGER AS $$
+		BEGIN
+			IF (NEW.type, NEW.list_ids, NEW.ip, NEW.user_agent, NEW.source, NEW.url, NEW.created_at) IS DISTINCT FROM
+				(OLD.type, OLD.list_ids, OLD.ip, OLD.user_agent, OLD.source, OLD.url, OLD.created_at) THEN
+				RAISE EXCEPTION 'subscriber consent records can not be modified';
+			END IF;
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		DROP TRIGGER IF EXISTS trg_subscriber_consents_immutable ON subscriber_consents;
+		CREATE TRIGGER trg_subscriber_consents_immutable BEFORE UPDATE ON subscriber_consents
+			FOR EACH ROW EXECUTE FUNCTION subscriber_consents_immutable();
+
+		UPDATE settings SET value = value || '["consents"]'
+			WHERE key = 'privacy.exportable' AND NOT value ? 'consents';
+	`); err != nil {
+		return err
+	}
+
+	// Daily snapshots of list subscriber counts.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS list_snapshots (
+			list_id          INTEGER NOT NULL REFERENCES lists(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			date             DATE NOT NULL,
+			confirmed        INTEGER NOT NULL DEFAULT 0,
+			unconfirmed      INTEGER NOT NULL DEFAULT 0,
+			unsubscribed     INTEGER NOT NULL DEFAULT 0,
+			blocklisted      INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (list_id, date)
+		);
+		CREATE INDEX IF NOT EXISTS idx_list_snapshots_date ON list_snapshots(date);
+	`); err != nil {
+		return err
+	}
+
+	// Disposable e-mail domains.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS disposable_domains (
+			domain           TEXT NOT NULL PRIMARY KEY,
+			created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+	`); err != nil {
+		return err
+	}
+
+	// Alternate e-mails of subscribers.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS subscriber_emails (
+			id               SERIAL PRIMARY KEY,
+			subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			email            TEXT NOT NULL,
+			token            UUID NULL UNIQUE,
+			verified_at      TIMESTAMP WITH TIME ZONE NULL,
+			bounces          INTEGER NOT NULL DEFAULT 0,
+			last_bounced_at  TIMESTAMP WITH TIME ZONE NULL,
+			created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_sub_emails_email ON subscriber_emails(LOWER(email));
+		CREATE INDEX IF NOT EXISTS idx_sub_emails_sub ON subscriber_emails(subscriber_id);
+	`); err != nil {
+		return err
+	}
+
+	// Subscriber locales and timezones, which are copied from the locale and timezone
+	// attributes that were used for them. The attributes are left as they are.
+	if _, err := db.Exec(`
+		ALTER TABLE subscribers ADD COLUMN IF NOT EXISTS locale TEXT NOT NULL DEFAULT '';
+		ALTER TABLE subscribers ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT '';
+		CREATE INDEX IF NOT EXISTS idx_subs_timezone ON subscribers(timezone);
+
+		UPDATE subscribers SET locale = REPLACE(attribs->>'locale', '_', '-')
+			WHERE locale = '' AND JSONB_TYPEOF(attribs->'locale') = 'string'
+			AND attribs->>'locale' ~ '^[a-zA-Z]{2,3}([-_][a-zA-Z0-9]{2,8})?$';
+		UPDATE subscribers SET timezone = attribs->>'timezone'
+			WHERE timezone = '' AND JSONB_TYPEOF(attribs->'timezone') = 'string'
+			AND attribs->>'timezone' IN (SELECT name FROM pg_timezone_names);
+	`); err != nil {
+		return err
+	}
+
+	// Folders that lists are organised in.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS list_folders (
+			id              SERIAL PRIMARY KEY,
+			name            TEXT NOT NULL,
+			parent_id       INTEGER NULL REFERENCES list_folders(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_list_folders_parent ON list_folders(parent_id);
+
+		ALTER TABLE lists ADD COLUMN IF NOT EXISTS folder_id INTEGER NULL REFERENCES list_folders(id) ON DELETE SET NULL ON UPDATE CASCADE;
+		CREATE INDEX IF NOT EXISTS idx_lists_folder ON lists(folder_id);
+	`); err != nil {
+		return err
+	}
+
+	// Sending defaults of lists.
+	if _, err := db.Exec(`
+		ALTER TABLE lists ADD COLUMN IF NOT EXISTS default_from_email TEXT NOT NULL DEFAULT '';
+		ALTER TABLE lists ADD COLUMN IF NOT EXISTS default_reply_to TEXT NOT NULL DEFAULT '';
+		ALTER TABLE lists ADD COLUMN IF NOT EXISTS default_template_id INTEGER NULL;
+		ALTER TABLE lists ADD COLUMN IF NOT EXISTS default_messenger TEXT NOT NULL DEFAULT '';
+	`); err != nil {
+		return err
+	}
+
+	// Webhooks of lists and the outbox of their subscription events.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS list_webhooks (
+			id               SERIAL PRIMARY KEY,
+			list_id          INTEGER NOT NULL REFERENCES lists(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			url              TEXT NOT NULL,
+			events           TEXT[] NOT NULL DEFAULT '{}',
+			secret           TEXT NOT NULL DEFAULT '',
+			enabled          BOOLEAN NOT NULL DEFAULT true,
+			created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			updated_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_list_webhooks_list ON list_webhooks(list_id);
+
+		CREATE TABLE IF NOT EXISTS list_events (
+			id               BIGSERIAL PRIMARY KEY,
+			list_id          INTEGER NOT NULL REFERENCES lists(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			event            TEXT NOT NULL,
+			created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+
+		CREATE OR REPLACE FUNCTION list_events_trigger() RETURNS TRIGGER AS $$
+		DECLARE
+			ev TEXT;
+		BEGIN
+			IF TG_OP = 'INSERT' THEN
+				IF NEW.status != 'unsubscribed' THEN
+					ev = 'list.subscribed';
+				END IF;
+			ELSIF NEW.status = 'unsubscribed' AND OLD.status != 'unsubscribed' THEN
+				ev = 'list.unsubscribed';
+			ELSIF OLD.status = 'unsubscribed' AND NEW.status != 'unsubscribed' THEN
+				ev = 'list.subscribed';
+			ELSIF OLD.status = 'unconfirmed' AND NEW.status = 'confirmed' THEN
+				ev = 'list.confirmed';
+			END IF;
+
+			IF ev IS NOT NULL AND EXISTS (SELECT 1 FROM list_webhooks WHERE list_id = NEW.list_id AND enabled) THEN
+				INSERT INTO list_events (list_id, subscriber_id, event) VALUES (NEW.list_id, NEW.subscriber_id, ev);
+			END IF;
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		DROP TRIGGER IF EXISTS trg_list_events ON subscriber_lists;
+		CREATE TRIGGER trg_list_events AFTER INSERT OR UPDATE OF status ON subscriber_lists
+			FOR EACH ROW EXECUTE FUNCTION list_events_trigger();
+	`); err != nil {
+		return err
+	}
+
+	// Syncs of lists with CRMs.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS crm_syncs (
+			id               SERIAL PRIMARY KEY,
+			uuid             uuid NOT NULL UNIQUE,
+			name             TEXT NOT NULL,
+			provider         TEXT NOT NULL,
+			segment          TEXT NOT NULL,
+			api_key          TEXT NOT NULL DEFAULT '',
+			list_id          INTEGER NOT NULL REFERENCES lists(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			mapping          JSONB NOT NULL DEFAULT '{}',
+			conflict         TEXT NOT NULL DEFAULT 'listmonk',
+			pull             BOOLEAN NOT NULL DEFAULT true,
+			push_unsubscribes BOOLEAN NOT NULL DEFAULT true,
+			push_bounces     BOOLEAN NOT NULL DEFAULT true,
+			enabled          BOOLEAN NOT NULL DEFAULT true,
+			sync_interval    TEXT NOT NULL DEFAULT '1h',
+			synced_at        TIMESTAMP WITH TIME ZONE NULL,
+			ran_at           TIMESTAMP WITH TIME ZONE NULL,
+			pulled           INTEGER NOT NULL DEFAULT 0,
+			pushed           INTEGER NOT NULL DEFAULT 0,
+			last_error       TEXT NOT NULL DEFAULT '',
+			created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+	`); err != nil {
+		return err
+	}
+
+	// Hosted subscription forms.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS subscription_forms (
+			id               SERIAL PRIMARY KEY,
+			uuid             uuid NOT NULL UNIQUE,
+			name             TEXT NOT NULL,
+			enabled          BOOLEAN NOT NULL DEFAULT true,
+			list_ids         INTEGER[] NOT NULL DEFAULT '{}',
+			choose_lists     BOOLEAN NOT NULL DEFAULT false,
+			fields           JSONB NOT NULL DEFAULT '[]',
+			title            TEXT NOT NULL DEFAULT '',
+			description      TEXT NOT NULL DEFAULT '',
+			submit_label     TEXT NOT NULL DEFAULT '',
+			success_message  TEXT NOT NULL DEFAULT '',
+			redirect_url     TEXT NOT NULL DEFAULT '',
+			theme            JSONB NOT NULL DEFAULT '{}',
+			created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+
+		CREATE TABLE IF NOT EXISTS subscription_form_stats (
+			form_id          INTEGER NOT NULL REFERENCES subscription_forms(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			day              DATE NOT NULL,
+			views            INTEGER NOT NULL DEFAULT 0,
+			conversions      INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (form_id, day)
+		);
+	`); err != nil {
+		return err
+	}
+
+	// Opt-in reminders.
+	if _, err := db.Exec(`
+		ALTER TABLE lists ADD COLUMN IF NOT EXISTS optin_reminder_days INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE lists ADD COLUMN IF NOT EXISTS optin_reminder_max INTEGER NOT NULL DEFAULT 2;
+		ALTER TABLE subscriber_lists ADD COLUMN IF NOT EXISTS optin_reminders INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE subscriber_lists ADD COLUMN IF NOT EXISTS optin_reminded_at TIMESTAMP WITH TIME ZONE NULL;
+	`); err != nil {
+		return err
+	}
+
+	// Lists of list scoped API tokens.
+	if _, err := db.Exec(`ALTER TABLE api_tokens ADD COLUMN IF NOT EXISTS list_ids INTEGER[] NOT NULL DEFAULT '{}'`); err != nil {
+		return err
+	}
+
+	// Archived lists.
+	if _, err := db.Exec(`
+		ALTER TABLE lists ADD COLUMN IF NOT EXISTS archived BOOLEAN NOT NULL DEFAULT false;
+		ALTER TABLE lists ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP WITH TIME ZONE NULL;
+
+		CREATE OR REPLACE FUNCTION archived_lists_trigger() RETURNS TRIGGER AS $$
+		DECLARE
+			arch TIMESTAMP WITH TIME ZONE;
+		BEGIN
+			SELECT archived_at INTO arch FROM lists WHERE id = NEW.list_id AND archived;
+			IF NOT FOUND THEN
+				RETURN NEW;
+			END IF;
+
+			IF TG_OP = 'INSERT' THEN
+				IF NEW.created_at < arch OR EXISTS (SELECT 1 FROM subscriber_lists
+					WHERE subscriber_id = NEW.subscriber_id AND list_id = NEW.list_id) THEN
+					RETURN NEW;
+				END IF;
+				RETURN NULL;
+			ELSIF OLD.status = 'unsubscribed' AND NEW.status != 'unsubscribed' THEN
+				NEW.status = OLD.status;
+			END IF;
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		DROP TRIGGER IF EXISTS trg_archived_lists ON subscriber_lists;
+		CREATE TRIGGER trg_archived_lists BEFORE INSERT OR UPDATE OF status ON subscriber_lists
+			FOR EACH ROW EXECUTE FUNCTION archived_lists_trigger();
+	`); err != nil {
+		return err
+	}
+
+	// Dynamic lists.
+	if _, err := db.Exec(`ALTER TYPE list_type ADD VALUE IF NOT EXISTS 'dynamic'`); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`
+		ALTER TABLE lists ADD COLUMN IF NOT EXISTS query TEXT NOT NULL DEFAULT '';
+		ALTER TABLE lists ADD COLUMN IF NOT EXISTS refreshed_at TIMESTAMP WITH TIME ZONE NULL;
+	`); err != nil {
+		return err
+	}
+
+	// List exclusions.
+	if _, err := db.Exec(`
+		ALTER TABLE lists ADD COLUMN IF NOT EXISTS exclude_list_ids INTEGER[] NOT NULL DEFAULT '{}';
+
+		CREATE OR REPLACE FUNCTION list_exclusions(list_ids INT[]) RETURNS INT[] AS $$
+			SELECT COALESCE(ARRAY_AGG(DISTINCT x), '{}') FROM lists, UNNEST(lists.exclude_list_ids) AS x
+				WHERE lists.id = ANY(list_ids) AND NOT x = ANY(list_ids)
+		$$ LANGUAGE SQL STABLE;
+	`); err != nil {
+		return err
+	}
+
+	// MJML templates.
+	if _, err := db.Exec(`ALTER TABLE templates ADD COLUMN IF NOT EXISTS body_mjml TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+
+	// Revisions of the content of templates.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS template_revisions (
+			id               BIGSERIAL PRIMARY KEY,
+			template_id      INTEGER NOT NULL REFERENCES templates(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			subject          TEXT NOT NULL,
+			body             TEXT NOT NULL,
+			body_amp         TEXT NOT NULL DEFAULT '',
+			body_mjml        TEXT NOT NULL DEFAULT '',
+			preheader        TEXT NOT NULL DEFAULT '',
+			created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_tpl_revs_tpl_id ON template_revisions(template_id);
+
+		-- The current content of existing templates is their first revision.
+		INSERT INTO template_revisions (template_id, subject, body, body_amp, body_mjml, preheader)
+			SELECT id, subject, body, body_amp, body_mjml, preheader FROM templates
+			WHERE NOT EXISTS (SELECT 1 FROM template_revisions WHERE template_id = templates.id);
+	`); err != nil {
+		return err
+	}
+
+	// Template partials.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS template_partials (
+			id               SERIAL PRIMARY KEY,
+			name             TEXT NOT NULL UNIQUE,
+			body             TEXT NOT NULL,
+			created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+	`); err != nil {
+		return err
+	}
+
+	// Visual e-mail builder documents.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS builder_docs (
+			id               SERIAL PRIMARY KEY,
+			campaign_id      INTEGER NULL UNIQUE REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			template_id      INTEGER NULL UNIQUE REFERENCES templates(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			doc              JSONB NOT NULL,
+			created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+			CHECK ((campaign_id IS NULL) != (template_id IS NULL))
+		);
+	`); err != nil {
+		return err
+	}
+
+	// Language variants of templates.
+	if _, err := db.Exec(`ALTER TABLE templates ADD COLUMN IF NOT EXISTS lang_variants JSONB NOT NULL DEFAULT '[]'`); err != nil {
+		return err
+	}
+
+	// List folders of API tokens.
+	if _, err := db.Exec(`ALTER TABLE api_tokens ADD COLUMN IF NOT EXISTS folder_ids INTEGER[] NOT NULL DEFAULT '{}'`); err != nil {
+		return err
+	}
+
+	return nil
+}
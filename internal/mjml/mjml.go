@@ -0,0 +1,139 @@
+// Package mjml compiles MJML markup to responsive HTML using an external
+// MJML API (https://mjml.io/api) compatible service, either the hosted
+// API or a self-hosted instance.
+package mjml
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Opt represents the compiler options.
+type Opt struct {
+	// eg: https://api.mjml.io/v1/render
+	URL      string        `json:"url"`
+	Username string        `json:"username"`
+	Password string        `json:"password"`
+	Timeout  time.Duration `json:"timeout"`
+}
+
+// Compiler compiles MJML with an external MJML API service.
+type Compiler struct {
+	o      Opt
+	client *http.Client
+}
+
+// Error is an error in the MJML markup reported by the compiler.
+type Error struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+	TagName string `json:"tagName"`
+}
+
+// Errors is the list of errors in the MJML markup reported by the compiler.
+type Errors []Error
+
+type compileReq struct {
+	MJML string `json:"mjml"`
+}
+
+type compileResp struct {
+	HTML    string `json:"html"`
+	Errors  Errors `json:"errors"`
+	Message string `json:"message"`
+}
+
+// New returns a new instance of Compiler.
+func New(o Opt) (*Compiler, error) {
+	u, err := url.Parse(o.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("MJML URL should be http:// or https://")
+	}
+
+	if o.Timeout == 0 {
+		o.Timeout = time.Second * 10
+	}
+
+	return &Compiler{
+		o: o,
+		client: &http.Client{
+			Timeout: o.Timeout,
+			Transport: &http.Transport{
+				MaxIdleConnsPerHost:   10,
+				MaxConnsPerHost:       100,
+				ResponseHeaderTimeout: o.Timeout,
+				IdleConnTimeout:       o.Timeout,
+			},
+		}}, nil
+}
+
+// Compile compiles the given MJML markup to HTML. If the markup is invalid,
+// the returned error is of the type Errors.
+func (c *Compiler) Compile(src string) (string, error) {
+	b, err := json.Marshal(compileReq{MJML: src})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.o.URL, bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.o.Username != "" || c.o.Password != "" {
+		req.SetBasicAuth(c.o.Username, c.o.Password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	var r compileResp
+	if err := json.Unmarshal(body, &r); err != nil {
+		return "", fmt.Errorf("invalid response from MJML service (%d)", resp.StatusCode)
+	}
+
+	// The MJML API returns the markup errors with a 400 response
+	// and the HTML with the errors that it could recover from.
+	if len(r.Errors) > 0 {
+		return "", r.Errors
+	}
+	if resp.StatusCode != http.StatusOK {
+		if r.Message != "" {
+			return "", fmt.Errorf("MJML service error (%d): %s", resp.StatusCode, r.Message)
+		}
+		return "", fmt.Errorf("MJML service error (%d)", resp.StatusCode)
+	}
+	if r.HTML == "" {
+		return "", fmt.Errorf("empty response from MJML service")
+	}
+
+	return r.HTML, nil
+}
+
+// Error returns the markup errors, one per line.
+func (e Errors) Error() string {
+	out := make([]string, 0, len(e))
+	for _, m := range e {
+		if m.Line > 0 {
+			out = append(out, fmt.Sprintf("line %d: %s", m.Line, m.Message))
+		} else {
+			out = append(out, m.Message)
+		}
+	}
+
+	return strings.Join(out, "\n")
+}
@@ -0,0 +1,307 @@
+// Package rss fetches and parses RSS 2.0, RSS 1.0 (RDF), and Atom feeds.
+package rss
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Max size of a feed document that's read.
+const maxFeedSize = 10 * 1024 * 1024
+
+// Feed is a parsed feed.
+type Feed struct {
+	Title       string `json:"title"`
+	URL         string `json:"url"`
+	Description string `json:"description"`
+	Items       []Item `json:"items"`
+}
+
+// Item is an item (RSS) or entry (Atom) in a feed. GUID is the unique ID
+// of the item, falling back to its URL, or a hash of its title and
+// description if it has neither.
+type Item struct {
+	GUID        string    `json:"guid"`
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	Description string    `json:"description"`
+	Content     string    `json:"content"`
+	Author      string    `json:"author"`
+	Published   time.Time `json:"published"`
+}
+
+// Links are slices as RSS feeds often have <atom:link> elements next to
+// the <link>.
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Links       []string `xml:"link"`
+	GUID        string   `xml:"guid"`
+	Description string   `xml:"description"`
+	Content     string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	Author      string   `xml:"author"`
+	Creator     string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	PubDate     string   `xml:"pubDate"`
+	Date        string   `xml:"http://purl.org/dc/elements/1.1/ date"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Links       []string  `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+// rssDoc is an RSS 2.0 <rss> or an RSS 1.0 <rdf:RDF> document. In the latter,
+// items are siblings of the channel.
+type rssDoc struct {
+	Channel rssChannel `xml:"channel"`
+	Items   []rssItem  `xml:"item"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Links     []atomLink `xml:"link"`
+	Summary   string     `xml:"summary"`
+	Content   string     `xml:"content"`
+	Author    string     `xml:"author>name"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+}
+
+type atomDoc struct {
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+var dateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC3339,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04 -0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// Fetch fetches and parses the feed at the given URL.
+func Fetch(client *http.Client, url string) (Feed, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return Feed{}, err
+	}
+	req.Header.Set("User-Agent", "listmonk")
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/xml, text/xml;q=0.9, */*;q=0.8")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Feed{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Feed{}, fmt.Errorf("feed responded with %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxFeedSize))
+	if err != nil {
+		return Feed{}, err
+	}
+
+	return Parse(b)
+}
+
+// Parse parses an RSS or Atom feed document.
+func Parse(b []byte) (Feed, error) {
+	// Find the root element to pick the format.
+	dec := newDecoder(b)
+	var root xml.StartElement
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			return Feed{}, fmt.Errorf("error parsing feed: %v", err)
+		}
+		if s, ok := t.(xml.StartElement); ok {
+			root = s
+			break
+		}
+	}
+
+	switch strings.ToLower(root.Name.Local) {
+	case "rss", "rdf":
+		var d rssDoc
+		if err := newDecoder(b).Decode(&d); err != nil {
+			return Feed{}, fmt.Errorf("error parsing RSS feed: %v", err)
+		}
+		return d.feed(), nil
+
+	case "feed":
+		var d atomDoc
+		if err := newDecoder(b).Decode(&d); err != nil {
+			return Feed{}, fmt.Errorf("error parsing Atom feed: %v", err)
+		}
+		return d.feed(), nil
+	}
+
+	return Feed{}, fmt.Errorf("unknown feed format <%s>", root.Name.Local)
+}
+
+func (d rssDoc) feed() Feed {
+	out := Feed{
+		Title:       strings.TrimSpace(d.Channel.Title),
+		URL:         rssURL(d.Channel.Links),
+		Description: strings.TrimSpace(d.Channel.Description),
+	}
+
+	for _, i := range append(d.Channel.Items, d.Items...) {
+		it := Item{
+			GUID:        strings.TrimSpace(i.GUID),
+			Title:       strings.TrimSpace(i.Title),
+			URL:         rssURL(i.Links),
+			Description: strings.TrimSpace(i.Description),
+			Content:     strings.TrimSpace(i.Content),
+			Author:      strings.TrimSpace(i.Creator),
+			Published:   parseDate(i.PubDate, i.Date),
+		}
+		if it.Author == "" {
+			it.Author = strings.TrimSpace(i.Author)
+		}
+		out.Items = append(out.Items, it.normalize())
+	}
+
+	return out
+}
+
+func (d atomDoc) feed() Feed {
+	out := Feed{
+		Title:       strings.TrimSpace(d.Title),
+		URL:         atomURL(d.Links),
+		Description: strings.TrimSpace(d.Subtitle),
+	}
+
+	for _, e := range d.Entries {
+		it := Item{
+			GUID:        strings.TrimSpace(e.ID),
+			Title:       strings.TrimSpace(e.Title),
+			URL:         atomURL(e.Links),
+			Description: strings.TrimSpace(e.Summary),
+			Content:     strings.TrimSpace(e.Content),
+			Author:      strings.TrimSpace(e.Author),
+			Published:   parseDate(e.Published, e.Updated),
+		}
+		if it.Description == "" {
+			it.Description = it.Content
+		}
+		out.Items = append(out.Items, it.normalize())
+	}
+
+	return out
+}
+
+// normalize fills in the GUID and content of an item that doesn't have them.
+func (i Item) normalize() Item {
+	if i.Content == "" {
+		i.Content = i.Description
+	}
+
+	if i.GUID == "" {
+		i.GUID = i.URL
+	}
+	if i.GUID == "" {
+		h := sha1.Sum([]byte(i.Title + "\n" + i.Description))
+		i.GUID = hex.EncodeToString(h[:])
+	}
+
+	return i
+}
+
+// rssURL returns the first non-empty link of an RSS channel or item.
+func rssURL(links []string) string {
+	for _, l := range links {
+		if l = strings.TrimSpace(l); l != "" {
+			return l
+		}
+	}
+
+	return ""
+}
+
+// atomURL returns the alternate (web page) link of an Atom feed or entry.
+func atomURL(links []atomLink) string {
+	for _, l := range links {
+		if l.Rel == "" || l.Rel == "alternate" {
+			return strings.TrimSpace(l.Href)
+		}
+	}
+	if len(links) > 0 {
+		return strings.TrimSpace(links[0].Href)
+	}
+
+	return ""
+}
+
+// parseDate parses the first of the given dates that's in a known format.
+func parseDate(dates ...string) time.Time {
+	for _, d := range dates {
+		d = strings.TrimSpace(d)
+		if d == "" {
+			continue
+		}
+
+		for _, l := range dateLayouts {
+			if t, err := time.Parse(l, d); err == nil {
+				return t
+			}
+		}
+	}
+
+	return time.Time{}
+}
+
+func newDecoder(b []byte) *xml.Decoder {
+	dec := xml.NewDecoder(bytes.NewReader(b))
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+	dec.CharsetReader = charsetReader
+
+	return dec
+}
+
+// charsetReader converts ISO-8859-1 documents to UTF-8. UTF-8 and ASCII
+// documents are read as they are.
+func charsetReader(charset string, r io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "utf-8", "utf8", "us-ascii", "ascii":
+		return r, nil
+	case "iso-8859-1", "iso8859-1", "latin1", "latin-1":
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+
+		out := make([]rune, len(b))
+		for i, c := range b {
+			out[i] = rune(c)
+		}
+		return strings.NewReader(string(out)), nil
+	}
+
+	return nil, errors.New("unsupported feed charset " + charset)
+}
@@ -0,0 +1,121 @@
+package subimporter
+
+import (
+	"strings"
+	"sync"
+)
+
+// domainBlocklist is the set of blocklisted e-mail domains, which can be
+// swapped at runtime, with the number of e-mails that were blocked by
+// each of its entries since the hits were last taken.
+type domainBlocklist struct {
+	domains      map[string]string
+	hasWildcards bool
+	hits         map[string]int
+	sync.RWMutex
+}
+
+// set replaces the blocklist. Entries are lowercase domains, optionally with
+// *. as the subdomain prefix to block the domain and all its subdomains.
+func (b *domainBlocklist) set(entries []string) {
+	domains := make(map[string]string, len(entries))
+	hasWildcards := false
+	for _, d := range entries {
+		domains[d] = d
+
+		// Domains with *. as the subdomain prefix, strip that
+		// and add the full domain to the blocklist as well.
+		// eg: *.example.com => example.com
+		if strings.Contains(d, "*.") {
+			hasWildcards = true
+			if _, ok := domains[strings.TrimPrefix(d, "*.")]; !ok {
+				domains[strings.TrimPrefix(d, "*.")] = d
+			}
+		}
+	}
+
+	b.Lock()
+	b.domains = domains
+	b.hasWildcards = hasWildcards
+	b.Unlock()
+}
+
+// match returns the blocklist entry that blocks the given lowercase domain
+// and records a hit for it.
+func (b *domainBlocklist) match(domain string) (string, bool) {
+	b.RLock()
+	entry, ok := b.domains[domain]
+
+	// If there are wildcards in the blocklist and the email domain has a subdomain, check that.
+	if !ok && b.hasWildcards && strings.Count(domain, ".") > 1 {
+		parts := strings.Split(domain, ".")
+
+		// Replace the first part of the subdomain with * and check if that exists in the blocklist.
+		// Eg: test.mail.example.com => *.mail.example.com
+		parts[0] = "*"
+		entry, ok = b.domains[strings.Join(parts, ".")]
+	}
+	b.RUnlock()
+
+	if !ok {
+		return "", false
+	}
+
+	b.Lock()
+	b.hits[entry]++
+	b.Unlock()
+
+	return entry, true
+}
+
+// takeHits returns the hits recorded since the last call and resets them.
+func (b *domainBlocklist) takeHits() map[string]int {
+	b.Lock()
+	defer b.Unlock()
+
+	out := b.hits
+	b.hits = make(map[string]int)
+	return out
+}
+
+// domainSet is a set of lowercase e-mail domains, which can be swapped at
+// runtime, that matches the domains and all their subdomains.
+type domainSet struct {
+	domains map[string]struct{}
+	sync.RWMutex
+}
+
+// set replaces the domains in the set.
+func (d *domainSet) set(domains []string) {
+	m := make(map[string]struct{}, len(domains))
+	for _, v := range domains {
+		m[v] = struct{}{}
+	}
+
+	d.Lock()
+	d.domains = m
+	d.Unlock()
+}
+
+// has checks whether the given lowercase domain, or any of its parent
+// domains, is in the set. eg: mail.example.com matches example.com.
+func (d *domainSet) has(domain string) bool {
+	d.RLock()
+	defer d.RUnlock()
+
+	if len(d.domains) == 0 {
+		return false
+	}
+
+	for {
+		if _, ok := d.domains[domain]; ok {
+			return true
+		}
+
+		_, parent, ok := strings.Cut(domain, ".")
+		if !ok || !strings.Contains(parent, ".") {
+			return false
+		}
+		domain = parent
+	}
+}
@@ -1,5 +1,5 @@
-// Package subimporter implements a bulk ZIP/CSV importer of subscribers.
-// It implements a simple queue for buffering imports and committing records
+// Package subimporter implements a bulk ZIP/CSV importer of subscribers,
+// and an importer of the members of Mailchimp audiences. It implements a simple queue for buffering imports and committing records
 // to DB along with ZIP and CSV handling utilities. It is meant to be used as
 // a singleton as each Importer instance is stateful, where it keeps track of
 // an import in progress. Only one import should happen on a single importer
@@ -19,8 +19,10 @@ import (
 	"net/mail"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gofrs/uuid/v5"
 	"github.com/knadh/listmonk/internal/i18n"
@@ -46,15 +48,26 @@ const (
 
 	ModeSubscribe = "subscribe"
 	ModeBlocklist = "blocklist"
+
+	// Strategies for subscribe imports. Upserts insert new subscribers and update
+	// existing ones, update-only imports skip new subscribers, and skip-existing
+	// imports leave existing subscribers untouched.
+	StrategyUpsert       = "upsert"
+	StrategyUpdateOnly   = "update_only"
+	StrategySkipExisting = "skip_existing"
+
+	// Statuses of the records in an import's report.
+	ReportSkipped = "skipped"
+	ReportErrored = "errored"
 )
 
 // Importer represents the bulk CSV subscriber import system.
 type Importer struct {
-	opt                   Options
-	db                    *sql.DB
-	i18n                  *i18n.I18n
-	domainBlocklist       map[string]bool
-	hasBlocklistWildcards bool
+	opt             Options
+	db              *sql.DB
+	i18n            *i18n.I18n
+	domainBlocklist *domainBlocklist
+	disposable      *domainSet
 
 	stop   chan bool
 	status Status
@@ -70,6 +83,13 @@ type Options struct {
 
 	// Lookup table for blocklisted domains.
 	DomainBlocklist []string
+
+	// Disposable e-mail domains that new subscribers' e-mails are rejected on.
+	DisposableDomains []string
+
+	// Schema of the subscriber attributes that's enforced on imports and
+	// subscriber writes.
+	AttribSchema []models.AttribField
 }
 
 // Session represents a single import session.
@@ -78,6 +98,11 @@ type Session struct {
 	subQueue chan SubReq
 	log      *log.Logger
 
+	// CSV report of the records that were skipped or errored.
+	report     *csv.Writer
+	reportFile *os.File
+	reportMut  sync.Mutex
+
 	opt SessionOpt
 }
 
@@ -87,6 +112,7 @@ type SessionOpt struct {
 	Mode      string `json:"mode"`
 	SubStatus string `json:"subscription_status"`
 	Overwrite bool   `json:"overwrite"`
+	Strategy  string `json:"strategy"`
 	Delim     string `json:"delim"`
 	ListIDs   []int  `json:"lists"`
 }
@@ -96,8 +122,13 @@ type Status struct {
 	Name     string `json:"name"`
 	Total    int    `json:"total"`
 	Imported int    `json:"imported"`
+	Skipped  int    `json:"skipped"`
+	Errored  int    `json:"errored"`
 	Status   string `json:"status"`
 	logBuf   *bytes.Buffer
+
+	// Path to the CSV report of the skipped and errored records.
+	reportPath string
 }
 
 // SubReq is a wrapper over the Subscriber model.
@@ -106,6 +137,12 @@ type SubReq struct {
 	Lists          []int    `json:"lists"`
 	ListUUIDs      []string `json:"list_uuids"`
 	PreconfirmSubs bool     `json:"preconfirm_subscriptions"`
+
+	// Subscription status of the subscriber that overrides the session's, if set.
+	subStatus string
+
+	// Number of the record in the import, for reporting.
+	row int
 }
 
 type importStatusTpl struct {
@@ -123,9 +160,23 @@ var (
 	csvHeaders = map[string]bool{
 		"email":      true,
 		"name":       true,
-		"attributes": true}
+		"attributes": true,
+		"locale":     true,
+		"timezone":   true}
+
+	// Language codes, eg: fr or pt-BR.
+	regexLocale = regexp.MustCompile(`^[a-zA-Z]{2,3}([-_][a-zA-Z0-9]{2,8})?$`)
 
 	regexCleanStr = regexp.MustCompile("[[:^ascii:]]")
+
+	// E.164 phone numbers, eg: +919876543210.
+	regexPhone = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+	// Max lengths of the channel identities other than phone numbers.
+	channelMaxLens = map[string]int{
+		models.SubscriberChannelPush:      4096,
+		models.SubscriberChannelMessenger: stdInputMaxLen,
+	}
 )
 
 // New returns a new instance of Importer.
@@ -134,25 +185,43 @@ func New(opt Options, db *sql.DB, i *i18n.I18n) *Importer {
 		opt:             opt,
 		db:              db,
 		i18n:            i,
-		domainBlocklist: make(map[string]bool, len(opt.DomainBlocklist)),
+		domainBlocklist: &domainBlocklist{hits: make(map[string]int)},
+		disposable:      &domainSet{},
 		status:          Status{Status: StatusNone, logBuf: bytes.NewBuffer(nil)},
 		stop:            make(chan bool, 1),
 	}
+	im.domainBlocklist.set(opt.DomainBlocklist)
+	im.disposable.set(opt.DisposableDomains)
 
-	// Domain blocklist.
-	for _, d := range opt.DomainBlocklist {
-		im.domainBlocklist[d] = true
+	return &im
+}
 
-		// Domains with *. as the subdomain prefix, strip that
-		// and add the full domain to the blocklist as well.
-		// eg: *.example.com => example.com
-		if strings.Contains(d, "*.") {
-			im.hasBlocklistWildcards = true
-			im.domainBlocklist[strings.TrimPrefix(d, "*.")] = true
-		}
+// SetDomainBlocklist replaces the blocklisted e-mail domains.
+func (im *Importer) SetDomainBlocklist(domains []string) {
+	im.domainBlocklist.set(domains)
+}
+
+// SetDisposableDomains replaces the disposable e-mail domains. An empty list
+// turns off the check.
+func (im *Importer) SetDisposableDomains(domains []string) {
+	im.disposable.set(domains)
+}
+
+// MatchBlocklistedDomain returns the domain blocklist entry (eg: *.example.com)
+// that blocks the given e-mail, if any, and records a hit for it.
+func (im *Importer) MatchBlocklistedDomain(email string) (string, bool) {
+	_, domain, ok := strings.Cut(strings.ToLower(email), "@")
+	if !ok {
+		return "", false
 	}
 
-	return &im
+	return im.domainBlocklist.match(domain)
+}
+
+// TakeDomainBlocklistHits returns the number of e-mails blocked by each
+// domain blocklist entry since the last call.
+func (im *Importer) TakeDomainBlocklistHits() map[string]int {
+	return im.domainBlocklist.takeHits()
 }
 
 // NewSession returns an new instance of Session. It takes the name
@@ -162,17 +231,32 @@ func (im *Importer) NewSession(opt SessionOpt) (*Session, error) {
 		return nil, errors.New("an import is already running")
 	}
 
+	// Create the report, replacing the last session's.
+	f, err := os.CreateTemp("", "listmonk-import-report-*.csv")
+	if err != nil {
+		return nil, err
+	}
+	report := csv.NewWriter(f)
+	if err := report.Write([]string{"row", "email", "status", "reason"}); err != nil {
+		f.Close()
+		return nil, err
+	}
+
 	im.Lock()
+	im.removeReport()
 	im.status = Status{Status: StatusImporting,
-		Name:   opt.Filename,
-		logBuf: bytes.NewBuffer(nil)}
+		Name:       opt.Filename,
+		logBuf:     bytes.NewBuffer(nil),
+		reportPath: f.Name()}
 	im.Unlock()
 
 	s := &Session{
-		im:       im,
-		log:      log.New(im.status.logBuf, "", log.Ldate|log.Ltime|log.Lshortfile),
-		subQueue: make(chan SubReq, commitBatchSize),
-		opt:      opt,
+		im:         im,
+		log:        log.New(im.status.logBuf, "", log.Ldate|log.Ltime|log.Lshortfile),
+		subQueue:   make(chan SubReq, commitBatchSize),
+		report:     report,
+		reportFile: f,
+		opt:        opt,
 	}
 
 	s.log.Printf("processing '%s'", opt.Filename)
@@ -188,6 +272,8 @@ func (im *Importer) GetStats() Status {
 		Status:   im.status.Status,
 		Total:    im.status.Total,
 		Imported: im.status.Imported,
+		Skipped:  im.status.Skipped,
+		Errored:  im.status.Errored,
 	}
 }
 
@@ -202,6 +288,35 @@ func (im *Importer) GetLogs() []byte {
 	return im.status.logBuf.Bytes()
 }
 
+// GetReport returns the CSV report of the records that were skipped or
+// errored in the last import session once it's done.
+func (im *Importer) GetReport() (*os.File, error) {
+	if !im.isDone() {
+		return nil, ErrIsImporting
+	}
+
+	im.RLock()
+	path := im.status.reportPath
+	im.RUnlock()
+
+	if path == "" {
+		return nil, os.ErrNotExist
+	}
+	return os.Open(path)
+}
+
+// removeReport deletes the report of the last import session, if any.
+// It should be called with the lock held.
+func (im *Importer) removeReport() {
+	if im.status.reportPath == "" {
+		return
+	}
+	if err := os.Remove(im.status.reportPath); err != nil && !os.IsNotExist(err) {
+		log.Printf("error removing import report: %v", err)
+	}
+	im.status.reportPath = ""
+}
+
 // setStatus sets the Importer's status.
 func (im *Importer) setStatus(status string) {
 	im.Lock()
@@ -252,10 +367,40 @@ func (im *Importer) sendNotif(status string) error {
 	return im.opt.NotifCB(subject, out)
 }
 
+// addReport records a skipped or errored record in the session's report.
+func (s *Session) addReport(row int, email, status, reason string) {
+	s.reportMut.Lock()
+	if err := s.report.Write([]string{strconv.Itoa(row), email, status, reason}); err == nil {
+		s.report.Flush()
+	}
+	s.reportMut.Unlock()
+
+	s.im.Lock()
+	if status == ReportErrored {
+		s.im.status.Errored++
+	} else {
+		s.im.status.Skipped++
+	}
+	s.im.Unlock()
+}
+
+// closeReport flushes and closes the session's report.
+func (s *Session) closeReport() {
+	s.reportMut.Lock()
+	defer s.reportMut.Unlock()
+
+	s.report.Flush()
+	if err := s.reportFile.Close(); err != nil {
+		s.log.Printf("error closing import report: %v", err)
+	}
+}
+
 // Start is a blocking function that selects on a channel queue until all
 // subscriber entries in the import session are imported. It should be
 // invoked as a goroutine.
 func (s *Session) Start() {
+	defer s.closeReport()
+
 	var (
 		tx    *sql.Tx
 		stmt  *sql.Stmt
@@ -264,6 +409,9 @@ func (s *Session) Start() {
 		cur   = 0
 
 		listIDs = make([]int, len(s.opt.ListIDs))
+
+		// Lists that individual subscribers are added to in addition to the session's.
+		subListIDs = map[int]bool{}
 	)
 
 	for i, v := range s.opt.ListIDs {
@@ -271,7 +419,7 @@ func (s *Session) Start() {
 	}
 
 	for sub := range s.subQueue {
-		if cur == 0 {
+		if tx == nil {
 			// New transaction batch.
 			tx, err = s.im.db.Begin()
 			if err != nil {
@@ -294,12 +442,41 @@ func (s *Session) Start() {
 		}
 
 		if s.opt.Mode == ModeSubscribe {
-			_, err = stmt.Exec(uu, sub.Email, sub.Name, sub.Attribs, pq.Array(listIDs), s.opt.SubStatus, s.opt.Overwrite)
+			var (
+				ids    = listIDs
+				status = s.opt.SubStatus
+			)
+			if len(sub.Lists) > 0 {
+				ids = append(append(make([]int, 0, len(listIDs)+len(sub.Lists)), listIDs...), sub.Lists...)
+				for _, id := range sub.Lists {
+					subListIDs[id] = true
+				}
+			}
+			if sub.subStatus != "" {
+				status = sub.subStatus
+			}
+
+			// No row is returned for the subscribers that are skipped by the strategy.
+			var (
+				subUUID string
+				subID   int
+			)
+			err = stmt.QueryRow(uu, sub.Email, sub.Name, sub.Attribs, pq.Array(ids), status, s.opt.Overwrite, s.opt.Strategy,
+				sub.Locale, sub.Timezone).Scan(&subUUID, &subID)
+			if err == sql.ErrNoRows {
+				reason := "subscriber already exists"
+				if s.opt.Strategy == StrategyUpdateOnly {
+					reason = "subscriber doesn't exist"
+				}
+				s.addReport(sub.row, sub.Email, ReportSkipped, reason)
+				continue
+			}
 		} else if s.opt.Mode == ModeBlocklist {
-			_, err = stmt.Exec(uu, sub.Email, sub.Name, sub.Attribs)
+			_, err = stmt.Exec(uu, sub.Email, sub.Name, sub.Attribs, sub.Locale, sub.Timezone)
 		}
 		if err != nil {
 			s.log.Printf("error executing insert: %v", err)
+			s.addReport(sub.row, sub.Email, ReportErrored, err.Error())
 			tx.Rollback()
 			break
 		}
@@ -316,12 +493,17 @@ func (s *Session) Start() {
 				s.log.Printf("imported %d", total)
 			}
 
+			tx = nil
 			cur = 0
 		}
 	}
 
+	for id := range subListIDs {
+		listIDs = append(listIDs, id)
+	}
+
 	// Queue's closed and there's nothing left to commit.
-	if cur == 0 {
+	if tx == nil {
 		s.im.setStatus(StatusFinished)
 		s.log.Printf("imported finished")
 		if _, err := s.im.opt.UpdateListDateStmt.Exec(pq.Array(listIDs)); err != nil {
@@ -515,6 +697,7 @@ func (s *Session) LoadCSV(srcPath string, delim rune) error {
 		} else if err != nil {
 			if err, ok := err.(*csv.ParseError); ok && err.Err == csv.ErrFieldCount {
 				s.log.Printf("skipping line %d. %v", i, err)
+				s.addReport(i, "", ReportSkipped, err.Error())
 				continue
 			} else {
 				s.log.Printf("error reading CSV '%s'", err)
@@ -525,6 +708,7 @@ func (s *Session) LoadCSV(srcPath string, delim rune) error {
 		lnCols := len(cols)
 		if lnCols < lnHdr {
 			s.log.Printf("skipping line %d. column count (%d) does not match minimum header count (%d)", i, lnCols, lnHdr)
+			s.addReport(i, "", ReportSkipped, fmt.Sprintf("column count (%d) does not match minimum header count (%d)", lnCols, lnHdr))
 			continue
 		}
 
@@ -535,16 +719,19 @@ func (s *Session) LoadCSV(srcPath string, delim rune) error {
 			row[key] = cols[hdrKeys[key]]
 		}
 
-		sub := SubReq{}
+		sub := SubReq{row: i}
 		sub.Email = row["email"]
 
 		if v, ok := row["name"]; ok {
 			sub.Name = v
 		}
+		sub.Locale = row["locale"]
+		sub.Timezone = row["timezone"]
 
 		sub, err = s.im.ValidateFields(sub)
 		if err != nil {
 			s.log.Printf("skipping line %d: %s: %v", i, sub.Email, err)
+			s.addReport(i, sub.Email, ReportSkipped, err.Error())
 			continue
 		}
 
@@ -561,6 +748,15 @@ func (s *Session) LoadCSV(srcPath string, delim rune) error {
 			}
 		}
 
+		// Blocklisting doesn't touch the attributes.
+		if s.opt.Mode == ModeSubscribe {
+			if sub.Attribs, err = s.im.ValidateAttribs(sub.Attribs); err != nil {
+				s.log.Printf("skipping line %d: %s: %v", i, sub.Email, err)
+				s.addReport(i, sub.Email, ReportSkipped, err.Error())
+				continue
+			}
+		}
+
 		// Send the subscriber to the queue.
 		s.subQueue <- sub
 	}
@@ -574,6 +770,7 @@ func (s *Session) LoadCSV(srcPath string, delim rune) error {
 func (im *Importer) Stop() {
 	if im.getStatus() != StatusImporting {
 		im.Lock()
+		im.removeReport()
 		im.status = Status{Status: StatusNone}
 		im.Unlock()
 		return
@@ -601,32 +798,28 @@ func (im *Importer) SanitizeEmail(email string) (string, error) {
 
 	// Check if the e-mail's domain is blocklisted. The e-mail domain and blocklist config
 	// are always lowercase.
-	d := strings.Split(em.Address, "@")
-	if len(d) == 2 {
-		domain := d[1]
-
-		// Check the domain as-is.
-		if _, ok := im.domainBlocklist[domain]; ok {
-			return "", errors.New(im.i18n.T("subscribers.domainBlocklisted"))
-		}
-
-		// If there are wildcards in the blocklist and the email domain has a subdomain, check that.
-		if im.hasBlocklistWildcards && strings.Count(domain, ".") > 1 {
-			parts := strings.Split(domain, ".")
+	if _, ok := im.MatchBlocklistedDomain(em.Address); ok {
+		return "", errors.New(im.i18n.T("subscribers.domainBlocklisted"))
+	}
 
-			// Replace the first part of the subdomain with * and check if that exists in the blocklist.
-			// Eg: test.mail.example.com => *.mail.example.com
-			parts[0] = "*"
-			domain = strings.Join(parts, ".")
+	return em.Address, nil
+}
 
-			if _, ok := im.domainBlocklist[domain]; ok {
-				return "", errors.New(im.i18n.T("subscribers.domainBlocklisted"))
-			}
-		}
+// SanitizeSubscriberEmail sanitizes the e-mail of a new subscriber, or the new
+// e-mail of a subscriber, like SanitizeEmail and also rejects e-mails on
+// disposable e-mail domains.
+func (im *Importer) SanitizeSubscriberEmail(email string) (string, error) {
+	em, err := im.SanitizeEmail(email)
+	if err != nil {
+		return "", err
+	}
 
+	_, domain, _ := strings.Cut(em, "@")
+	if im.disposable.has(domain) {
+		return "", errors.New(im.i18n.T("subscribers.disposableEmail"))
 	}
 
-	return em.Address, nil
+	return em, nil
 }
 
 // ValidateFields validates incoming subscriber field values and returns sanitized fields.
@@ -635,7 +828,7 @@ func (im *Importer) ValidateFields(s SubReq) (SubReq, error) {
 		return s, errors.New(im.i18n.T("subscribers.invalidEmail"))
 	}
 
-	em, err := im.SanitizeEmail(s.Email)
+	em, err := im.SanitizeSubscriberEmail(s.Email)
 	if err != nil {
 		return s, err
 	}
@@ -654,9 +847,117 @@ func (im *Importer) ValidateFields(s SubReq) (SubReq, error) {
 		s.Name = strings.Join(parts, " ")
 	}
 
+	if s.Locale, err = im.SanitizeLocale(s.Locale); err != nil {
+		return s, err
+	}
+	if s.Timezone, err = im.SanitizeTimezone(s.Timezone); err != nil {
+		return s, err
+	}
+
 	return s, nil
 }
 
+// SanitizeLocale validates a subscriber's locale, a language code, eg: fr
+// or pt-BR, and returns it with the separator normalized to a hyphen.
+func (im *Importer) SanitizeLocale(locale string) (string, error) {
+	locale = strings.TrimSpace(locale)
+	if locale == "" {
+		return "", nil
+	}
+
+	if !regexLocale.MatchString(locale) {
+		return "", errors.New(im.i18n.Ts("subscribers.invalidLocale", "name", locale))
+	}
+
+	return strings.ReplaceAll(locale, "_", "-"), nil
+}
+
+// SanitizeTimezone validates a subscriber's IANA timezone, eg: Europe/Berlin.
+func (im *Importer) SanitizeTimezone(tz string) (string, error) {
+	tz = strings.TrimSpace(tz)
+	if tz == "" {
+		return "", nil
+	}
+
+	// time.LoadLocation() accepts "Local", which is the server's timezone.
+	if _, err := time.LoadLocation(tz); err != nil || tz == "Local" || len(tz) > stdInputMaxLen {
+		return "", errors.New(im.i18n.Ts("subscribers.invalidTimezone", "name", tz))
+	}
+
+	return tz, nil
+}
+
+// ValidateAttribs validates subscriber attributes against the attribute schema
+// and returns them with the values normalized and the defaults of the missing
+// attributes filled in. Attributes that aren't in the schema are left as they are.
+func (im *Importer) ValidateAttribs(attribs models.JSON) (models.JSON, error) {
+	if len(im.opt.AttribSchema) == 0 {
+		return attribs, nil
+	}
+
+	out := make(models.JSON, len(attribs))
+	for k, v := range attribs {
+		out[k] = v
+	}
+
+	for _, f := range im.opt.AttribSchema {
+		v, ok := out[f.Name]
+		if !ok || v == nil {
+			if f.Default != nil {
+				out[f.Name] = f.Default
+				continue
+			}
+			if f.Required {
+				return attribs, errors.New(im.i18n.Ts("subscribers.attribRequired", "name", f.Name))
+			}
+			continue
+		}
+
+		val, ok := f.Check(v)
+		if !ok {
+			return attribs, errors.New(im.i18n.Ts("subscribers.invalidAttrib", "name", f.Name, "type", f.Type))
+		}
+		out[f.Name] = val
+	}
+
+	return out, nil
+}
+
+// ValidateChannels validates subscriber channel identities and returns them
+// sanitized. Channels without an identity are dropped.
+func (im *Importer) ValidateChannels(channels models.SubscriberChannels) (models.SubscriberChannels, error) {
+	if channels == nil {
+		return nil, nil
+	}
+
+	out := make(models.SubscriberChannels, len(channels))
+	for name, ch := range channels {
+		ch.Value = strings.TrimSpace(ch.Value)
+		if ch.Value == "" {
+			continue
+		}
+
+		switch name {
+		case models.SubscriberChannelPhone:
+			// Drop the separators that phone numbers are commonly written with.
+			ch.Value = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "", ".", "").Replace(ch.Value)
+			if !regexPhone.MatchString(ch.Value) {
+				return nil, errors.New(im.i18n.Ts("subscribers.invalidChannel", "name", name))
+			}
+		case models.SubscriberChannelPush, models.SubscriberChannelMessenger:
+			if len(ch.Value) > channelMaxLens[name] || strings.ContainsAny(ch.Value, " \t\r\n") {
+				return nil, errors.New(im.i18n.Ts("subscribers.invalidChannel", "name", name))
+			}
+		default:
+			return nil, errors.New(im.i18n.Ts("subscribers.invalidChannel", "name", name))
+		}
+
+		out[name] = ch
+	}
+
+	return out, nil
+}
+
 // mapCSVHeaders takes a list of headers obtained from a CSV file, a map of known headers,
 // and returns a new map with each of the headers in the known map mapped by the position (0-n)
 // in the given CSV list.
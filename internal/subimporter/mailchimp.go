@@ -0,0 +1,395 @@
+package subimporter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+)
+
+const (
+	mailchimpAPIURL = "https://%s.api.mailchimp.com/3.0"
+
+	// mailchimpPageSize is the number of records fetched in a single API request.
+	// 1000 is the maximum allowed by the API.
+	mailchimpPageSize = 1000
+
+	mailchimpTimeout = time.Second * 30
+)
+
+// Mailchimp member statuses.
+const (
+	mailchimpStatusSubscribed   = "subscribed"
+	mailchimpStatusUnsubscribed = "unsubscribed"
+	mailchimpStatusCleaned      = "cleaned"
+	mailchimpStatusPending      = "pending"
+)
+
+// MailchimpOpt represents the options for importing the members of a
+// Mailchimp audience.
+type MailchimpOpt struct {
+	APIKey     string `json:"api_key"`
+	AudienceID string `json:"audience_id"`
+
+	// Merge field tags (eg: PHONE) mapped to the attribute keys that they're
+	// imported into. If it's empty, all merge fields other than FNAME and LNAME,
+	// that form the name, are imported with their tags lowercased as the keys.
+	Fields map[string]string `json:"fields"`
+
+	// Attribute that a member's tags are imported into as a list. Optional.
+	TagsAttrib string `json:"tags_attrib"`
+
+	// Tags mapped to the IDs of the lists that the members with the tags are
+	// subscribed to, in addition to the lists of the import.
+	TagLists map[string][]int `json:"tag_lists"`
+}
+
+// MailchimpAudience represents a Mailchimp audience with its merge fields and tags.
+type MailchimpAudience struct {
+	ID      string           `json:"id"`
+	Name    string           `json:"name"`
+	Members int              `json:"members"`
+	Fields  []MailchimpField `json:"fields"`
+	Tags    []string         `json:"tags"`
+}
+
+// MailchimpField represents a merge field of a Mailchimp audience.
+type MailchimpField struct {
+	Tag  string `json:"tag"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type mailchimpMember struct {
+	Email       string                 `json:"email_address"`
+	FullName    string                 `json:"full_name"`
+	Status      string                 `json:"status"`
+	MergeFields map[string]interface{} `json:"merge_fields"`
+	Tags        []struct {
+		Name string `json:"name"`
+	} `json:"tags"`
+	Language string `json:"language"`
+	Location struct {
+		Timezone string `json:"timezone"`
+	} `json:"location"`
+}
+
+type mailchimpClient struct {
+	apiKey  string
+	rootURL string
+	c       *http.Client
+}
+
+// The datacenter of an account that's the suffix of its API keys, eg: xxxx-us6.
+var regexMailchimpDC = regexp.MustCompile(`-([a-z0-9]+)$`)
+
+func newMailchimpClient(apiKey string) (*mailchimpClient, error) {
+	apiKey = strings.TrimSpace(apiKey)
+
+	m := regexMailchimpDC.FindStringSubmatch(apiKey)
+	if m == nil {
+		return nil, errors.New("invalid Mailchimp API key")
+	}
+
+	return &mailchimpClient{
+		apiKey:  apiKey,
+		rootURL: fmt.Sprintf(mailchimpAPIURL, m[1]),
+		c:       &http.Client{Timeout: mailchimpTimeout},
+	}, nil
+}
+
+// get makes a GET request to the given API path and unmarshals the JSON response into out.
+func (m *mailchimpClient) get(path string, params url.Values, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, m.rootURL+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth("listmonk", m.apiKey)
+
+	resp, err := m.c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// Errors are described in the response as problem details.
+		var e struct {
+			Title  string `json:"title"`
+			Detail string `json:"detail"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Detail == "" {
+			return fmt.Errorf("Mailchimp API returned %d", resp.StatusCode)
+		}
+		return fmt.Errorf("Mailchimp API: %s: %s", e.Title, e.Detail)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// GetMailchimpAudiences retrieves the audiences of a Mailchimp account along
+// with their merge fields and tags, that can be mapped to attributes and lists
+// on import.
+func GetMailchimpAudiences(apiKey string) ([]MailchimpAudience, error) {
+	mc, err := newMailchimpClient(apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var res struct {
+		Lists []struct {
+			ID    string `json:"id"`
+			Name  string `json:"name"`
+			Stats struct {
+				Members int `json:"member_count"`
+			} `json:"stats"`
+		} `json:"lists"`
+	}
+	if err := mc.get("/lists", url.Values{
+		"count":  {strconv.Itoa(mailchimpPageSize)},
+		"fields": {"lists.id,lists.name,lists.stats.member_count"},
+	}, &res); err != nil {
+		return nil, err
+	}
+
+	out := make([]MailchimpAudience, 0, len(res.Lists))
+	for _, l := range res.Lists {
+		a := MailchimpAudience{
+			ID:      l.ID,
+			Name:    l.Name,
+			Members: l.Stats.Members,
+			Fields:  []MailchimpField{},
+			Tags:    []string{},
+		}
+
+		var fields struct {
+			Fields []MailchimpField `json:"merge_fields"`
+		}
+		if err := mc.get("/lists/"+url.PathEscape(l.ID)+"/merge-fields", url.Values{
+			"count":  {strconv.Itoa(mailchimpPageSize)},
+			"fields": {"merge_fields.tag,merge_fields.name,merge_fields.type"},
+		}, &fields); err != nil {
+			return nil, err
+		}
+		a.Fields = append(a.Fields, fields.Fields...)
+
+		// Tags are static segments on Mailchimp.
+		var tags struct {
+			Segments []struct {
+				Name string `json:"name"`
+			} `json:"segments"`
+		}
+		if err := mc.get("/lists/"+url.PathEscape(l.ID)+"/segments", url.Values{
+			"type":   {"static"},
+			"count":  {strconv.Itoa(mailchimpPageSize)},
+			"fields": {"segments.name"},
+		}, &tags); err != nil {
+			return nil, err
+		}
+		for _, t := range tags.Segments {
+			a.Tags = append(a.Tags, t.Name)
+		}
+
+		out = append(out, a)
+	}
+
+	return out, nil
+}
+
+// LoadMailchimp pulls the members of a Mailchimp audience page by page from
+// the Mailchimp API, and validates and imports them. In the subscribe mode,
+// subscribed and pending members are imported with their subscriptions marked
+// as the session's subscription status and unconfirmed respectively, and
+// unsubscribed members as unsubscribed. In the blocklist mode, unsubscribed
+// and cleaned (bounced) members are blocklisted. Other members are skipped.
+func (s *Session) LoadMailchimp(o MailchimpOpt) error {
+	if s.im.isDone() {
+		return ErrIsImporting
+	}
+
+	// Default status is "failed" in case the function
+	// returns at one of the many possible errors.
+	failed := true
+	defer func() {
+		if failed {
+			s.im.setStatus(StatusFailed)
+		}
+	}()
+
+	mc, err := newMailchimpClient(o.APIKey)
+	if err != nil {
+		s.log.Printf("error connecting to Mailchimp: %v", err)
+		return err
+	}
+
+	// Lists that are already a part of the import are skipped in the tag lists.
+	sessLists := make(map[int]bool, len(s.opt.ListIDs))
+	for _, id := range s.opt.ListIDs {
+		sessLists[id] = true
+	}
+
+	var (
+		path   = "/lists/" + url.PathEscape(o.AudienceID) + "/members"
+		offset = 0
+		total  = 0
+	)
+	for {
+		var res struct {
+			Members []mailchimpMember `json:"members"`
+			Total   int               `json:"total_items"`
+		}
+		if err := mc.get(path, url.Values{
+			"count":  {strconv.Itoa(mailchimpPageSize)},
+			"offset": {strconv.Itoa(offset)},
+			"fields": {"total_items,members.email_address,members.full_name,members.status,members.merge_fields,members.tags,members.language,members.location.timezone"},
+		}, &res); err != nil {
+			s.log.Printf("error fetching members from Mailchimp (offset %d): %v", offset, err)
+			return err
+		}
+
+		if offset == 0 {
+			total = res.Total
+			s.im.Lock()
+			s.im.status.Total = total
+			s.im.Unlock()
+		}
+
+		for n, m := range res.Members {
+			// Check for the stop signal.
+			select {
+			case <-s.im.stop:
+				failed = false
+				close(s.subQueue)
+				s.log.Println("stop request received")
+				return nil
+			default:
+			}
+
+			row := offset + n + 1
+			sub, ok := s.mailchimpSubReq(m, o, sessLists)
+			if !ok {
+				s.log.Printf("skipping %s: member status is %s", m.Email, m.Status)
+				s.addReport(row, m.Email, ReportSkipped, fmt.Sprintf("member status is %s", m.Status))
+				continue
+			}
+			sub.row = row
+
+			sub, err = s.im.ValidateFields(sub)
+			if err != nil {
+				s.log.Printf("skipping %s: %v", m.Email, err)
+				s.addReport(row, m.Email, ReportSkipped, err.Error())
+				continue
+			}
+
+			// Blocklisting doesn't touch the attributes.
+			if s.opt.Mode == ModeSubscribe {
+				if sub.Attribs, err = s.im.ValidateAttribs(sub.Attribs); err != nil {
+					s.log.Printf("skipping %s: %v", sub.Email, err)
+					s.addReport(row, sub.Email, ReportSkipped, err.Error())
+					continue
+				}
+			}
+
+			// Send the subscriber to the queue.
+			s.subQueue <- sub
+		}
+
+		offset += len(res.Members)
+		s.log.Printf("fetched %d of %d members from Mailchimp", offset, total)
+
+		if len(res.Members) < mailchimpPageSize || offset >= total {
+			break
+		}
+	}
+
+	close(s.subQueue)
+	failed = false
+	return nil
+}
+
+// mailchimpSubReq maps a Mailchimp member to a subscriber. It returns false
+// if the member is not to be imported in the session's mode.
+func (s *Session) mailchimpSubReq(m mailchimpMember, o MailchimpOpt, sessLists map[int]bool) (SubReq, bool) {
+	sub := SubReq{}
+	sub.Email = m.Email
+
+	switch s.opt.Mode {
+	case ModeSubscribe:
+		switch m.Status {
+		case mailchimpStatusSubscribed:
+			sub.subStatus = s.opt.SubStatus
+		case mailchimpStatusPending:
+			sub.subStatus = models.SubscriptionStatusUnconfirmed
+		case mailchimpStatusUnsubscribed:
+			sub.subStatus = models.SubscriptionStatusUnsubscribed
+		default:
+			return sub, false
+		}
+	case ModeBlocklist:
+		if m.Status != mailchimpStatusUnsubscribed && m.Status != mailchimpStatusCleaned {
+			return sub, false
+		}
+	}
+
+	// Name.
+	first, _ := m.MergeFields["FNAME"].(string)
+	last, _ := m.MergeFields["LNAME"].(string)
+	sub.Name = strings.TrimSpace(first + " " + last)
+	if sub.Name == "" {
+		sub.Name = m.FullName
+	}
+
+	// Mailchimp's language and timezone guesses are dropped if they're invalid
+	// instead of skipping the member.
+	if l, err := s.im.SanitizeLocale(m.Language); err == nil {
+		sub.Locale = l
+	}
+	if tz, err := s.im.SanitizeTimezone(m.Location.Timezone); err == nil {
+		sub.Timezone = tz
+	}
+
+	// Merge fields.
+	sub.Attribs = models.JSON{}
+	for tag, v := range m.MergeFields {
+		if str, ok := v.(string); ok && str == "" {
+			continue
+		}
+
+		key := strings.ToLower(tag)
+		if len(o.Fields) > 0 {
+			key = o.Fields[tag]
+		} else if tag == "FNAME" || tag == "LNAME" {
+			continue
+		}
+
+		if key != "" {
+			sub.Attribs[key] = v
+		}
+	}
+
+	// Tags.
+	tags := make([]string, 0, len(m.Tags))
+	seen := map[int]bool{}
+	for _, t := range m.Tags {
+		tags = append(tags, t.Name)
+
+		for _, id := range o.TagLists[t.Name] {
+			if !sessLists[id] && !seen[id] {
+				sub.Lists = append(sub.Lists, id)
+				seen[id] = true
+			}
+		}
+	}
+	if o.TagsAttrib != "" && len(tags) > 0 {
+		sub.Attribs[o.TagsAttrib] = tags
+	}
+
+	return sub, true
+}
@@ -0,0 +1,125 @@
+// Package textdiff computes line by line differences between two texts.
+package textdiff
+
+import (
+	"strings"
+)
+
+const (
+	OpEqual  = "equal"
+	OpInsert = "insert"
+	OpDelete = "delete"
+
+	// Max number of line comparisons (lines in a x lines in b) beyond which
+	// the texts are diffed as a whole, that is, a is deleted and b inserted.
+	maxCells = 4_000_000
+)
+
+// Line is a line of a diff.
+type Line struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// Lines returns the line by line diff that turns a into b, computed from
+// the longest common subsequence of their lines.
+func Lines(a, b string) []Line {
+	var (
+		al = split(a)
+		bl = split(b)
+	)
+
+	// Skip the common prefix and suffix, which is most of the text when
+	// revisions of a text are diffed.
+	pre := 0
+	for pre < len(al) && pre < len(bl) && al[pre] == bl[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(al)-pre && suf < len(bl)-pre && al[len(al)-1-suf] == bl[len(bl)-1-suf] {
+		suf++
+	}
+
+	out := make([]Line, 0, len(al)+len(bl))
+	for _, l := range al[:pre] {
+		out = append(out, Line{Op: OpEqual, Text: l})
+	}
+	out = append(out, diff(al[pre:len(al)-suf], bl[pre:len(bl)-suf])...)
+	for _, l := range al[len(al)-suf:] {
+		out = append(out, Line{Op: OpEqual, Text: l})
+	}
+
+	return out
+}
+
+// HasChanges returns whether a diff has any inserted or deleted lines.
+func HasChanges(lines []Line) bool {
+	for _, l := range lines {
+		if l.Op != OpEqual {
+			return true
+		}
+	}
+	return false
+}
+
+func diff(a, b []string) []Line {
+	out := make([]Line, 0, len(a)+len(b))
+
+	if len(a)*len(b) > maxCells {
+		for _, l := range a {
+			out = append(out, Line{Op: OpDelete, Text: l})
+		}
+		for _, l := range b {
+			out = append(out, Line{Op: OpInsert, Text: l})
+		}
+		return out
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, Line{Op: OpEqual, Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, Line{Op: OpDelete, Text: a[i]})
+			i++
+		default:
+			out = append(out, Line{Op: OpInsert, Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		out = append(out, Line{Op: OpDelete, Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		out = append(out, Line{Op: OpInsert, Text: b[j]})
+	}
+
+	return out
+}
+
+func split(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+}
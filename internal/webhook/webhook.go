@@ -0,0 +1,187 @@
+// Package webhook posts JSON event payloads to configured HTTP endpoints
+// (outgoing webhooks) so that external systems can react to events in listmonk.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Max number of events that can be queued for delivery. Events beyond it
+// are dropped.
+const queueSize = 1000
+
+// Hook is an HTTP endpoint that's posted the events it's subscribed to.
+// If Events is empty, it's posted all events. If Secret is set, payloads
+// are signed with it.
+type Hook struct {
+	Name   string   `json:"name"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret"`
+}
+
+// Opt represents the dispatcher options.
+type Opt struct {
+	Timeout time.Duration
+
+	// Number of times a failed delivery is retried with an exponential backoff.
+	MaxRetries int
+}
+
+// payload is the JSON body that's posted to a hook.
+type payload struct {
+	Event     string      `json:"event"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+type delivery struct {
+	hook  Hook
+	event string
+	body  []byte
+}
+
+// Dispatcher delivers events to hooks in the background.
+type Dispatcher struct {
+	hooks []Hook
+	opt   Opt
+	c     *http.Client
+	q     chan delivery
+	log   *log.Logger
+}
+
+// New returns a new Dispatcher and starts its delivery worker.
+func New(hooks []Hook, o Opt, l *log.Logger) *Dispatcher {
+	d := &Dispatcher{
+		hooks: hooks,
+		opt:   o,
+		c:     &http.Client{Timeout: o.Timeout},
+		q:     make(chan delivery, queueSize),
+		log:   l,
+	}
+	go d.worker()
+
+	return d
+}
+
+// Enabled returns whether there are any hooks to dispatch events to.
+func (d *Dispatcher) Enabled() bool {
+	return d != nil && len(d.hooks) > 0
+}
+
+// Dispatch queues an event and its data for delivery to the hooks that are
+// subscribed to it. It doesn't block.
+func (d *Dispatcher) Dispatch(event string, data interface{}) {
+	if !d.Enabled() {
+		return
+	}
+
+	d.DispatchTo(d.hooks, event, data)
+}
+
+// DispatchTo queues an event and its data for delivery to the given hooks,
+// instead of the dispatcher's own, that are subscribed to it. It doesn't block.
+func (d *Dispatcher) DispatchTo(hooks []Hook, event string, data interface{}) {
+	var body []byte
+	for _, h := range hooks {
+		if !h.subscribed(event) {
+			continue
+		}
+
+		if body == nil {
+			b, err := json.Marshal(payload{Event: event, Timestamp: time.Now(), Data: data})
+			if err != nil {
+				d.log.Printf("error encoding webhook event %s: %v", event, err)
+				return
+			}
+			body = b
+		}
+
+		select {
+		case d.q <- delivery{hook: h, event: event, body: body}:
+		default:
+			d.log.Printf("webhook queue is full. dropping event %s to %s", event, h.URL)
+		}
+	}
+}
+
+func (d *Dispatcher) worker() {
+	for dl := range d.q {
+		go d.deliver(dl)
+	}
+}
+
+// deliver posts an event to a hook, retrying on errors.
+func (d *Dispatcher) deliver(dl delivery) {
+	wait := time.Second
+	for n := 0; ; n++ {
+		err := d.post(dl)
+		if err == nil {
+			return
+		}
+
+		if n >= d.opt.MaxRetries {
+			d.log.Printf("error posting webhook event %s to %s: %v", dl.event, dl.hook.URL, err)
+			return
+		}
+
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+func (d *Dispatcher) post(dl delivery) error {
+	req, err := http.NewRequest(http.MethodPost, dl.hook.URL, bytes.NewReader(dl.body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "listmonk")
+	req.Header.Set("X-Listmonk-Event", dl.event)
+
+	// HMAC-SHA256 signature of the payload with the hook's secret.
+	if dl.hook.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(dl.hook.Secret))
+		mac.Write(dl.body)
+		req.Header.Set("X-Listmonk-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	r, err := d.c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Drain and close the body to let the Transport reuse the connection.
+		io.Copy(io.Discard, r.Body)
+		r.Body.Close()
+	}()
+
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return fmt.Errorf("non-OK response: %d", r.StatusCode)
+	}
+
+	return nil
+}
+
+func (h Hook) subscribed(event string) bool {
+	if len(h.Events) == 0 {
+		return true
+	}
+
+	for _, e := range h.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
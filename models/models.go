@@ -12,6 +12,7 @@ import (
 	"strings"
 	txttpl "text/template"
 	"time"
+	"unicode/utf8"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/jmoiron/sqlx/types"
@@ -29,12 +30,29 @@ const (
 	SubscriberStatusEnabled     = "enabled"
 	SubscriberStatusDisabled    = "disabled"
 	SubscriberStatusBlockListed = "blocklisted"
+	SubscriberStatusDeleted     = "deleted"
+
+	// Subscriber channels other than e-mail.
+	SubscriberChannelPhone     = "phone"
+	SubscriberChannelPush      = "push"
+	SubscriberChannelMessenger = "messenger"
 
 	// Subscription.
 	SubscriptionStatusUnconfirmed  = "unconfirmed"
 	SubscriptionStatusConfirmed    = "confirmed"
 	SubscriptionStatusUnsubscribed = "unsubscribed"
 
+	// API token roles.
+	APITokenRoleSubscribe = "subscribe"
+	APITokenRoleAnalyst   = "analyst"
+
+	// Subscriber consent.
+	ConsentTypeSubscription = "subscription"
+	ConsentTypeConfirmation = "confirmation"
+	ConsentSourceForm       = "form"
+	ConsentSourceAPI        = "api"
+	ConsentSourceOptin      = "optin"
+
 	// Campaign.
 	CampaignStatusDraft         = "draft"
 	CampaignStatusScheduled     = "scheduled"
@@ -49,9 +67,84 @@ const (
 	CampaignContentTypeMarkdown = "markdown"
 	CampaignContentTypePlain    = "plain"
 
+	// Scheduling priorities of campaigns that run alongside each other.
+	CampaignPriorityMin     = 1
+	CampaignPriorityMax     = 10
+	CampaignPriorityDefault = 5
+
+	// Who can view a campaign on the public archive.
+	CampaignArchiveAccessPublic     = "public"
+	CampaignArchiveAccessPassword   = "password"
+	CampaignArchiveAccessSubscriber = "subscriber"
+
+	// Events and actions of campaign engagement rules.
+	EngagementEventView       = "view"
+	EngagementEventClick      = "click"
+	EngagementActionAddList   = "add_list"
+	EngagementActionUnsubList = "unsubscribe_list"
+	EngagementActionSetAttrib = "set_attrib"
+
+	// Subscriber attributes with the e-mail frequency and the topics that
+	// subscribers pick in the preference center.
+	SubscriberFrequencyAttrib = "frequency"
+	SubscriberTopicsAttrib    = "topics"
+
+	// Types of subscriber attributes in the attribute schema.
+	AttribTypeString = "string"
+	AttribTypeNumber = "number"
+	AttribTypeBool   = "bool"
+	AttribTypeDate   = "date"
+	AttribTypeEnum   = "enum"
+
+	// Actions on messages over a messenger's send quota.
+	QuotaActionQueue  = "queue"
+	QuotaActionRefuse = "refuse"
+
+	// Actions on campaign messages to subscribers over their frequency cap.
+	FrequencyCapActionSkip  = "skip"
+	FrequencyCapActionDefer = "defer"
+
+	// Statuses of campaign dry runs.
+	SimulationStatusRunning   = "running"
+	SimulationStatusFinished  = "finished"
+	SimulationStatusCancelled = "cancelled"
+	SimulationStatusFailed    = "failed"
+
+	// Actions of background bulk subscriber jobs.
+	SubscriberJobActionBlocklist   = "blocklist"
+	SubscriberJobActionDelete      = "delete"
+	SubscriberJobActionSoftDelete  = "soft_delete"
+	SubscriberJobActionRestore     = "restore"
+	SubscriberJobActionAdd         = "add"
+	SubscriberJobActionRemove      = "remove"
+	SubscriberJobActionUnsubscribe = "unsubscribe"
+	SubscriberJobActionTag         = "tag"
+	SubscriberJobActionUntag       = "untag"
+
+	// Statuses of background bulk subscriber jobs.
+	SubscriberJobStatusRunning   = "running"
+	SubscriberJobStatusFinished  = "finished"
+	SubscriberJobStatusCancelled = "cancelled"
+	SubscriberJobStatusFailed    = "failed"
+
+	// Outcomes of campaign messages in the delivery log.
+	DeliveryStatusQueued  = "queued"
+	DeliveryStatusSent    = "sent"
+	DeliveryStatusErrored = "errored"
+	DeliveryStatusBounced = "bounced"
+	DeliveryStatusSkipped = "skipped"
+
+	// Categories of the errors of campaign messages. Connection and 4xx
+	// (temporary) errors are recoverable and can be retried.
+	DeliveryErrorConnection = "connection"
+	DeliveryError4xx        = "4xx"
+	DeliveryError5xx        = "5xx"
+	DeliveryErrorRendering  = "rendering"
+
 	// List.
 	ListTypePrivate = "private"
 	ListTypePublic  = "public"
+	ListTypeDynamic = "dynamic"
 	ListOptinSingle = "single"
 	ListOptinDouble = "double"
 
@@ -67,6 +160,12 @@ const (
 	// ContentTpl is the name of the compiled message.
 	ContentTpl = "content"
 
+	// BlockTplPrefix is the prefix of the names of compiled content blocks.
+	BlockTplPrefix = "block:"
+
+	// PartialTpl is the name of compiled template partials.
+	PartialTpl = "partial"
+
 	// Headers attached to e-mails for bounce tracking.
 	EmailHeaderSubscriberUUID = "X-Listmonk-Subscriber"
 	EmailHeaderCampaignUUID   = "X-Listmonk-Campaign"
@@ -79,6 +178,9 @@ const (
 	EmailHeaderDeliveredTo = "Delivered-To"
 	EmailHeaderReceived    = "Received"
 
+	EmailHeaderAuthResults    = "Authentication-Results"
+	EmailHeaderARCAuthResults = "ARC-Authentication-Results"
+
 	BounceTypeHard      = "hard"
 	BounceTypeSoft      = "soft"
 	BounceTypeComplaint = "complaint"
@@ -92,6 +194,88 @@ const (
 // similar to url.Values{}
 type Headers []map[string]string
 
+// ContentBlock is a named block of campaign content that's rendered with
+// {{ Block "name" }} for subscribers that match its condition, a Go template
+// expression, eg: eq .Subscriber.Attribs.plan "pro". An empty condition always
+// matches.
+type ContentBlock struct {
+	Name      string `json:"name"`
+	Condition string `json:"condition"`
+	Body      string `json:"body"`
+}
+
+// ContentBlocks represents a campaign's named conditional content blocks.
+type ContentBlocks []ContentBlock
+
+// LangVariant is a campaign's content in another language that's sent to
+// subscribers whose locale attribute matches Lang, eg: "fr" or "pt-BR".
+// An empty subject or alt body falls back to the campaign's.
+type LangVariant struct {
+	Lang    string `json:"lang"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+	AltBody string `json:"altbody"`
+}
+
+// LangVariants represents a campaign's language variants.
+type LangVariants []LangVariant
+
+// TemplateLangVariant is a template's body (and subject for tx templates)
+// in another language that's used for subscribers whose locale matches Lang.
+// An empty subject falls back to the template's.
+type TemplateLangVariant struct {
+	Lang    string `json:"lang"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// TemplateLangVariants represents a template's language variants.
+type TemplateLangVariants []TemplateLangVariant
+
+// EngagementRule is an action that's applied to a subscriber when they view
+// a campaign, or click a link in it whose URL contains URL (any link if it's
+// empty): adding them to or unsubscribing them from a list, or setting an
+// attribute to a value.
+type EngagementRule struct {
+	Event  string `json:"event"`
+	URL    string `json:"url"`
+	Action string `json:"action"`
+	ListID int    `json:"list_id"`
+	Attrib string `json:"attrib"`
+	Value  string `json:"value"`
+}
+
+// EngagementRules represents a campaign's engagement rules.
+type EngagementRules []EngagementRule
+
+// UTMParams are the query params (eg: utm_source) that are appended to every
+// tracked link in a campaign. Values can have template expressions that are
+// evaluated with the campaign, eg: {{ .Name }}.
+type UTMParams map[string]string
+
+// Rollout is the staged sending of a campaign. The campaign is first sent to
+// Percent of its subscribers, held for Hold (duration string), and then
+// continued only if its bounce and complaint rates (% of the messages sent)
+// are under MaxBounceRate and MaxComplaintRate, which aren't checked if 0.
+// Otherwise, it's paused. A 0 Percent is no staged sending.
+type Rollout struct {
+	Percent          int     `json:"percent"`
+	Hold             string  `json:"hold"`
+	MaxBounceRate    float64 `json:"max_bounce_rate"`
+	MaxComplaintRate float64 `json:"max_complaint_rate"`
+}
+
+// SendWindow restricts the delivery of a campaign to the hours from Start to
+// End (HH:MM) on Days of the week (0 is Sunday) in Timezone. An End before
+// Start is a window that spans midnight. Empty hours are the whole day, and
+// empty days are every day. An empty window doesn't restrict the delivery.
+type SendWindow struct {
+	Days     []int  `json:"days"`
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Timezone string `json:"timezone"`
+}
+
 // regTplFunc represents contains a regular expression for wrapping and
 // substituting a Go template function from the user's shorthand to a full
 // function call.
@@ -100,6 +284,47 @@ type regTplFunc struct {
 	replace string
 }
 
+var (
+	regBodyTag   = regexp.MustCompile(`(?i)<body[^>]*>`)
+	regPreheader = regexp.MustCompile(`{{(\s+)?Preheader\b`)
+)
+
+// Placeholder of masked personal data.
+const maskedValue = "***"
+
+// apiTokenRoutes are the API routes (method and path) that API tokens of each
+// role can access.
+var apiTokenRoutes = map[string]map[string]bool{
+	APITokenRoleSubscribe: {
+		"GET /api/health":       true,
+		"POST /api/subscribers": true,
+	},
+	APITokenRoleAnalyst: {
+		"GET /api/health":                    true,
+		"GET /api/dashboard/charts":          true,
+		"GET /api/dashboard/counts":          true,
+		"GET /api/subscribers":               true,
+		"GET /api/subscribers/:id":           true,
+		"GET /api/subscribers/:id/bounces":   true,
+		"GET /api/bounces":                   true,
+		"GET /api/bounces/:id":               true,
+		"GET /api/bounces/auth-stats":        true,
+		"GET /api/lists":                     true,
+		"GET /api/lists/:id":                 true,
+		"GET /api/lists/:id/stats":           true,
+		"GET /api/lists/folders":             true,
+		"GET /api/lists/folders/:id":         true,
+		"GET /api/lists/snapshots":           true,
+		"GET /api/campaigns":                 true,
+		"GET /api/campaigns/:id":             true,
+		"GET /api/campaigns/:id/links":       true,
+		"GET /api/campaigns/analytics/:type": true,
+		"GET /api/segments":                  true,
+		"GET /api/segments/:id":              true,
+		"GET /api/segments/:id/stats":        true,
+	},
+}
+
 var regTplFuncs = []regTplFunc{
 	// Regular expression for matching {{ TrackLink "http://link.com" }} in the template
 	// and substituting it with {{ Track "http://link.com" . }} (the dot context)
@@ -118,9 +343,23 @@ var regTplFuncs = []regTplFunc{
 	},
 
 	{
-		regExp:  regexp.MustCompile(`{{(\s+)?(TrackView|UnsubscribeURL|ManageURL|OptinURL|MessageURL)(\s+)?}}`),
+		regExp:  regexp.MustCompile(`{{(\s+)?(TrackView|UnsubscribeURL|ManageURL|PreferencesURL|OptinURL|MessageURL|CampaignArchiveURL|Preheader)(\s+)?}}`),
 		replace: `{{ $2 . }}`,
 	},
+
+	// Convert {{ Block "name" }} to the named content block's template.
+	{
+		regExp:  regexp.MustCompile(`{{(\s+)?Block(\s+)?"(.+?)"(\s+)?}}`),
+		replace: `{{ template "` + BlockTplPrefix + `$3" . }}`,
+	},
+
+	regPartial,
+}
+
+// Convert {{ Partial "name" }} to {{ Partial "name" . }} (the dot context).
+var regPartial = regTplFunc{
+	regExp:  regexp.MustCompile(`{{(\s+)?Partial(\s+)?"(.+?)"(\s+)?}}`),
+	replace: `{{ Partial "$3" . }}`,
 }
 
 // AdminNotifCallback is a callback function that's called
@@ -163,9 +402,45 @@ type Subscriber struct {
 	Email   string         `db:"email" json:"email" form:"email"`
 	Name    string         `db:"name" json:"name" form:"name"`
 	Attribs JSON           `db:"attribs" json:"attribs"`
+	Tags    pq.StringArray `db:"tags" json:"tags"`
 	Status  string         `db:"status" json:"status"`
 	Lists   types.JSONText `db:"lists" json:"lists"`
+
+	// Optional ID of the subscriber in an external system that it's synced from.
+	ExternalID null.String `db:"external_id" json:"external_id"`
+
+	// Identities on non-e-mail channels, keyed by channel.
+	Channels SubscriberChannels `db:"channels" json:"channels"`
+
+	// Language, eg: "pt-BR", that picks the language variants of campaigns
+	// that are sent to the subscriber, and their IANA timezone, eg: "Europe/Berlin".
+	Locale   string `db:"locale" json:"locale"`
+	Timezone string `db:"timezone" json:"timezone"`
+
+	// Text that the subscriber is searched by. It's maintained by the DB.
+	SearchText string `db:"search_text" json:"-"`
+
+	// Rolling engagement score as of EngagementUpdatedAt.
+	EngagementScore     float64   `db:"engagement_score" json:"engagement_score"`
+	EngagementUpdatedAt null.Time `db:"engagement_updated_at" json:"engagement_updated_at"`
+
+	// When the subscriber was soft-deleted, if they're deleted, and the
+	// status that they're restored to.
+	DeletedAt     null.Time   `db:"deleted_at" json:"deleted_at"`
+	RestoreStatus null.String `db:"restore_status" json:"-"`
+
+	// Engagement is only loaded for rendering campaigns with content blocks.
+	Engagement *SubscriberEngagement `db:"-" json:"-"`
 }
+
+// SubscriberEngagement is a subscriber's engagement across all campaigns.
+type SubscriberEngagement struct {
+	SubscriberID  int       `db:"subscriber_id" json:"-"`
+	Views         int       `db:"views" json:"views"`
+	Clicks        int       `db:"clicks" json:"clicks"`
+	LastEngagedAt null.Time `db:"last_engaged_at" json:"last_engaged_at"`
+}
+
 type subLists struct {
 	SubscriberID int            `db:"subscriber_id"`
 	Lists        types.JSONText `db:"lists"`
@@ -179,6 +454,226 @@ type Subscription struct {
 	Meta                  json.RawMessage `db:"meta" json:"meta"`
 }
 
+// SubscriberErasure is the audit record of a subscriber that was irreversibly
+// anonymized by an operator.
+type SubscriberErasure struct {
+	ID            int       `db:"id" json:"id"`
+	SubscriberID  null.Int  `db:"subscriber_id" json:"subscriber_id"`
+	Reason        string    `db:"reason" json:"reason"`
+	ErasedBy      string    `db:"erased_by" json:"erased_by"`
+	Subscriptions int       `db:"subscriptions" json:"subscriptions"`
+	Views         int       `db:"views" json:"views"`
+	Clicks        int       `db:"clicks" json:"clicks"`
+	Deliveries    int       `db:"deliveries" json:"deliveries"`
+	Bounces       int       `db:"bounces" json:"bounces"`
+	CreatedAt     null.Time `db:"created_at" json:"created_at"`
+
+	Total int `db:"total" json:"-"`
+}
+
+// SubscriberDuplicate is a group of likely duplicate subscribers that share
+// a normalized e-mail or a name (Key), oldest first.
+type SubscriberDuplicate struct {
+	Key         string          `db:"key" json:"key"`
+	Subscribers json.RawMessage `db:"subscribers" json:"subscribers"`
+
+	Total int `db:"total" json:"-"`
+}
+
+// SubscriberEmailChange is a pending change of a subscriber's e-mail that's
+// applied once the new e-mail is confirmed with the token sent to it.
+type SubscriberEmailChange struct {
+	SubscriberID int       `db:"subscriber_id" json:"subscriber_id"`
+	Email        string    `db:"email" json:"email"`
+	Token        string    `db:"token" json:"-"`
+	CreatedAt    null.Time `db:"created_at" json:"created_at"`
+}
+
+// SubscriberEmail is an alternate e-mail of a subscriber in addition to their
+// primary e-mail, which can be made the primary e-mail once it's verified.
+type SubscriberEmail struct {
+	ID            int         `db:"id" json:"id"`
+	SubscriberID  int         `db:"subscriber_id" json:"subscriber_id"`
+	Email         string      `db:"email" json:"email"`
+	Token         null.String `db:"token" json:"-"`
+	VerifiedAt    null.Time   `db:"verified_at" json:"verified_at"`
+	Bounces       int         `db:"bounces" json:"bounces"`
+	LastBouncedAt null.Time   `db:"last_bounced_at" json:"last_bounced_at"`
+	CreatedAt     null.Time   `db:"created_at" json:"created_at"`
+}
+
+// SubscriberConsent is the immutable record of a subscriber's subscription or
+// opt-in confirmation request that's retained as proof of their consent.
+type SubscriberConsent struct {
+	ID           int64         `db:"id" json:"id"`
+	SubscriberID int           `db:"subscriber_id" json:"subscriber_id"`
+	Type         string        `db:"type" json:"type"`
+	ListIDs      pq.Int64Array `db:"list_ids" json:"list_ids"`
+	IP           string        `db:"ip" json:"ip"`
+	UserAgent    string        `db:"user_agent" json:"user_agent"`
+	Source       string        `db:"source" json:"source"`
+	URL          string        `db:"url" json:"url"`
+	CreatedAt    null.Time     `db:"created_at" json:"created_at"`
+
+	// Pseudofields.
+	Lists types.JSONText `db:"lists" json:"lists"`
+}
+
+// ListSnapshot is the count of the subscribers in a list by their status on a day.
+type ListSnapshot struct {
+	ListID       int    `db:"list_id" json:"list_id"`
+	ListName     string `db:"list_name" json:"list_name"`
+	Date         string `db:"date" json:"date"`
+	Confirmed    int    `db:"confirmed" json:"confirmed"`
+	Unconfirmed  int    `db:"unconfirmed" json:"unconfirmed"`
+	Unsubscribed int    `db:"unsubscribed" json:"unsubscribed"`
+	Blocklisted  int    `db:"blocklisted" json:"blocklisted"`
+}
+
+// OptinReminderStats are the numbers of a list's subscribers who were sent
+// opt-in reminders and who confirmed after them. Attempts has the numbers by
+// the number of reminders that the subscribers were sent.
+type OptinReminderStats struct {
+	Reminded                 int            `db:"reminded" json:"reminded"`
+	RemindersSent            int            `db:"reminders_sent" json:"reminders_sent"`
+	Confirmed                int            `db:"confirmed" json:"confirmed"`
+	ConfirmedWithoutReminder int            `db:"confirmed_without_reminder" json:"confirmed_without_reminder"`
+	Unconfirmed              int            `db:"unconfirmed" json:"unconfirmed"`
+	Attempts                 types.JSONText `db:"attempts" json:"attempts"`
+}
+
+// ListStats are the growth, churn, and confirmation rate of a list in the
+// last Days days, and the average open, click, and bounce rates of the
+// campaigns sent to it in them. Rates are percentages.
+type ListStats struct {
+	Subscribers      int     `db:"subscribers" json:"subscribers"`
+	SubscribersStart int     `db:"subscribers_start" json:"subscribers_start"`
+	Subscribed       int     `db:"subscribed" json:"subscribed"`
+	Unsubscribed     int     `db:"unsubscribed" json:"unsubscribed"`
+	NetGrowth        int     `db:"net_growth" json:"net_growth"`
+	GrowthRate       float64 `db:"growth_rate" json:"growth_rate"`
+	ChurnRate        float64 `db:"churn_rate" json:"churn_rate"`
+	ConfirmationRate float64 `db:"confirmation_rate" json:"confirmation_rate"`
+	Campaigns        int     `db:"campaigns" json:"campaigns"`
+	OpenRate         float64 `db:"open_rate" json:"open_rate"`
+	ClickRate        float64 `db:"click_rate" json:"click_rate"`
+	BounceRate       float64 `db:"bounce_rate" json:"bounce_rate"`
+	Days             int     `db:"-" json:"days"`
+}
+
+// ListMergeResult is the number of subscriptions and campaigns that merging
+// a list into another one changes, or would change. Moved is the subscriptions
+// that are moved, Conflicts is the subscribers who are on both lists, of whom
+// StatusChanged have their status changed by the merge rule.
+type ListMergeResult struct {
+	Moved         int    `db:"moved" json:"moved"`
+	Conflicts     int    `db:"conflicts" json:"conflicts"`
+	StatusChanged int    `db:"status_changed" json:"status_changed"`
+	Campaigns     int    `db:"campaigns" json:"campaigns"`
+	StatusRule    string `db:"-" json:"status_rule"`
+	SourceAction  string `db:"-" json:"source_action"`
+	DryRun        bool   `db:"-" json:"dry_run"`
+}
+
+// ListBundleSubscriber is a subscriber of a list with their subscription
+// status in a list bundle.
+type ListBundleSubscriber struct {
+	ID                    int            `db:"id" json:"-"`
+	Email                 string         `db:"email" json:"email"`
+	Name                  string         `db:"name" json:"name"`
+	Attribs               JSON           `db:"attribs" json:"attribs"`
+	Status                string         `db:"status" json:"status"`
+	Tags                  pq.StringArray `db:"tags" json:"tags"`
+	Locale                string         `db:"locale" json:"locale"`
+	Timezone              string         `db:"timezone" json:"timezone"`
+	SubscriptionStatus    string         `db:"subscription_status" json:"subscription_status"`
+	SubscriptionCreatedAt null.Time      `db:"subscription_created_at" json:"subscription_created_at"`
+}
+
+// ListBundleImportResult is the number of subscribers that importing a list
+// bundle created, the number that were subscribed to the list, and the number
+// that were skipped as invalid or duplicate.
+type ListBundleImportResult struct {
+	Created    int `db:"created" json:"created"`
+	Subscribed int `db:"subscribed" json:"subscribed"`
+	Skipped    int `db:"-" json:"skipped"`
+}
+
+// HygieneRules are the list hygiene rules that are applied to subscribers
+// periodically. A rule is off if its value is 0.
+type HygieneRules struct {
+	UnconfirmedDays int `json:"unconfirmed_days"`
+	UnengagedMonths int `json:"unengaged_months"`
+	BlocklistedDays int `json:"blocklisted_days"`
+}
+
+// HygieneResult is the number of subscriptions and subscribers that the list
+// hygiene rules were, or would be, applied to.
+type HygieneResult struct {
+	UnconfirmedSubscriptions int `db:"unconfirmed_subscriptions" json:"unconfirmed_subscriptions"`
+	UnengagedSubscribers     int `db:"unengaged_subscribers" json:"unengaged_subscribers"`
+	BlocklistedSubscribers   int `db:"blocklisted_subscribers" json:"blocklisted_subscribers"`
+}
+
+// SubscriberNote is a note that an admin has recorded on a subscriber, eg: on
+// a support interaction or a manual decision.
+type SubscriberNote struct {
+	ID           int       `db:"id" json:"id"`
+	SubscriberID int       `db:"subscriber_id" json:"subscriber_id"`
+	Author       string    `db:"author" json:"author"`
+	Note         string    `db:"note" json:"note"`
+	CreatedAt    null.Time `db:"created_at" json:"created_at"`
+	UpdatedAt    null.Time `db:"updated_at" json:"updated_at"`
+
+	// Pseudofields.
+	SubscriberEmail string `db:"subscriber_email" json:"subscriber_email"`
+	SubscriberName  string `db:"subscriber_name" json:"subscriber_name"`
+	Total           int    `db:"total" json:"-"`
+}
+
+// SubscriberTag is a tag on subscribers with the number of subscribers that have it.
+type SubscriberTag struct {
+	Tag             string `db:"tag" json:"tag"`
+	SubscriberCount int    `db:"subscriber_count" json:"subscriber_count"`
+}
+
+// SubscriptionRepermission is a subscriber's list subscriptions that are
+// pending re-permission.
+type SubscriptionRepermission struct {
+	SubscriberID int           `db:"subscriber_id"`
+	ListIDs      pq.Int64Array `db:"list_ids"`
+}
+
+// SubscriptionOptinReminder is a subscriber's unconfirmed list subscriptions
+// that are due an opt-in reminder.
+type SubscriptionOptinReminder struct {
+	SubscriberID int           `db:"subscriber_id"`
+	ListIDs      pq.Int64Array `db:"list_ids"`
+}
+
+// SubscriberJob is a bulk action on the subscribers that match a query, which
+// runs in the background in batches. Matched is the number of subscribers that
+// matched the query when the job was started.
+type SubscriberJob struct {
+	ID            int            `db:"id" json:"id"`
+	Action        string         `db:"action" json:"action"`
+	Query         string         `db:"query" json:"query"`
+	ListIDs       pq.Int64Array  `db:"list_ids" json:"list_ids"`
+	TargetListIDs pq.Int64Array  `db:"target_list_ids" json:"target_list_ids"`
+	SubStatus     string         `db:"sub_status" json:"sub_status"`
+	Tags          pq.StringArray `db:"tags" json:"tags"`
+	CreatedBy     string         `db:"created_by" json:"created_by"`
+	Status        string         `db:"status" json:"status"`
+	Error         string         `db:"error" json:"error"`
+	Matched       int            `db:"matched" json:"matched"`
+	Processed     int            `db:"processed" json:"processed"`
+	CreatedAt     null.Time      `db:"created_at" json:"created_at"`
+	UpdatedAt     null.Time      `db:"updated_at" json:"updated_at"`
+	FinishedAt    null.Time      `db:"finished_at" json:"finished_at"`
+
+	Total int `db:"total" json:"-"`
+}
+
 // SubscriberExportProfile represents a subscriber's collated data in JSON for export.
 type SubscriberExportProfile struct {
 	Email         string          `db:"email" json:"-"`
@@ -186,17 +681,64 @@ type SubscriberExportProfile struct {
 	Subscriptions json.RawMessage `db:"subscriptions" json:"subscriptions,omitempty"`
 	CampaignViews json.RawMessage `db:"campaign_views" json:"campaign_views,omitempty"`
 	LinkClicks    json.RawMessage `db:"link_clicks" json:"link_clicks,omitempty"`
+	Consents      json.RawMessage `db:"consents" json:"consents,omitempty"`
 }
 
 // JSON is the wrapper for reading and writing arbitrary JSONB fields from the DB.
 type JSON map[string]interface{}
 
+// SubscriberChannel is a subscriber's identity on a channel, eg: a phone
+// number, and whether they've consented to be messaged on it.
+type SubscriberChannel struct {
+	Value   string `json:"value"`
+	Consent bool   `json:"consent"`
+}
+
+// SubscriberChannels is a subscriber's channel identities keyed by channel
+// (phone|push|messenger).
+type SubscriberChannels map[string]SubscriberChannel
+
 // StringIntMap is used to define DB Scan()s.
 type StringIntMap map[string]int
 
 // Subscribers represents a slice of Subscriber.
 type Subscribers []Subscriber
 
+// AttribField is the definition of a subscriber attribute in the attribute
+// schema. Attributes that aren't in the schema are free-form.
+type AttribField struct {
+	Name     string      `json:"name"`
+	Type     string      `json:"type"`
+	Required bool        `json:"required"`
+	Default  interface{} `json:"default"`
+
+	// Values allowed for enum attributes.
+	Options []string `json:"options"`
+}
+
+// AttribTrigger is an automation that's run when a subscriber's attribute
+// Attrib changes to Value (any value if it's empty): sending them the
+// transactional template TemplateID and adding them to the list ListID.
+// Either is optional.
+type AttribTrigger struct {
+	Attrib     string `json:"attrib"`
+	Value      string `json:"value"`
+	TemplateID int    `json:"template_id"`
+	ListID     int    `json:"list_id"`
+}
+
+// SubscriberQueryPlan is the result of validating and explaining
+// an arbitrary subscriber query expression.
+type SubscriberQueryPlan struct {
+	Valid bool   `json:"valid"`
+	Error string `json:"error,omitempty"`
+
+	// Estimated number of matching subscribers and the query
+	// plan's total cost from the Postgres query planner.
+	Count    int     `json:"count"`
+	PlanCost float64 `json:"plan_cost"`
+}
+
 // SubscriberExport represents a subscriber record that is exported to raw data.
 type SubscriberExport struct {
 	Base
@@ -206,6 +748,18 @@ type SubscriberExport struct {
 	Name    string `db:"name" json:"name"`
 	Attribs string `db:"attribs" json:"attribs"`
 	Status  string `db:"status" json:"status"`
+
+	Tags            pq.StringArray `db:"tags" json:"tags"`
+	ExternalID      null.String    `db:"external_id" json:"external_id"`
+	Locale          string         `db:"locale" json:"locale"`
+	Timezone        string         `db:"timezone" json:"timezone"`
+	EngagementScore float64        `db:"engagement_score" json:"engagement_score"`
+
+	// Values of the exported attributes in the order they were requested in.
+	AttribValues pq.StringArray `db:"attrib_values" json:"-"`
+
+	// JSON array of the subscriber's consent records.
+	Consents string `db:"consents" json:"consents"`
 }
 
 // List represents a mailing list.
@@ -218,10 +772,59 @@ type List struct {
 	Optin            string         `db:"optin" json:"optin"`
 	Tags             pq.StringArray `db:"tags" json:"tags"`
 	Description      string         `db:"description" json:"description"`
+	TrackingDomain   string         `db:"tracking_domain" json:"tracking_domain"`
+	FolderID         null.Int       `db:"folder_id" json:"folder_id"`
 	SubscriberCount  int            `db:"-" json:"subscriber_count"`
 	SubscriberCounts StringIntMap   `db:"subscriber_statuses" json:"subscriber_statuses"`
 	SubscriberID     int            `db:"subscriber_id" json:"-"`
 
+	// Optional transactional template, subject, and sender of the double
+	// opt-in e-mails of the list instead of the default ones, and the URL
+	// that subscribers are redirected to on confirming.
+	OptinTemplateID  null.Int `db:"optin_template_id" json:"optin_template_id"`
+	OptinSubject     string   `db:"optin_subject" json:"optin_subject"`
+	OptinFromEmail   string   `db:"optin_from_email" json:"optin_from_email"`
+	OptinRedirectURL string   `db:"optin_redirect_url" json:"optin_redirect_url"`
+
+	// Optional sender, Reply-To, template, and messenger that campaigns
+	// targeting the list are created with. The sender, Reply-To, and
+	// messenger also apply to the list's opt-in and re-permission e-mails.
+	DefaultFromEmail  string   `db:"default_from_email" json:"default_from_email"`
+	DefaultReplyTo    string   `db:"default_reply_to" json:"default_reply_to"`
+	DefaultTemplateID null.Int `db:"default_template_id" json:"default_template_id"`
+	DefaultMessenger  string   `db:"default_messenger" json:"default_messenger"`
+
+	// Max campaigns that the list's subscribers can be sent in a rolling
+	// day and week. 0 is no limit.
+	FrequencyCapDaily  int `db:"frequency_cap_daily" json:"frequency_cap_daily"`
+	FrequencyCapWeekly int `db:"frequency_cap_weekly" json:"frequency_cap_weekly"`
+
+	// Days of inactivity after which subscribers are sent a re-permission
+	// e-mail (0 is never), and the days they have to renew before they're
+	// unsubscribed.
+	SubscriptionTTL   int `db:"subscription_ttl" json:"subscription_ttl"`
+	RepermissionGrace int `db:"repermission_grace" json:"repermission_grace"`
+
+	// Days after subscribing, or the last reminder, after which unconfirmed
+	// subscribers of double opt-in lists are sent the opt-in e-mail again
+	// (0 is never), and the max number of reminders they're sent.
+	OptinReminderDays int `db:"optin_reminder_days" json:"optin_reminder_days"`
+	OptinReminderMax  int `db:"optin_reminder_max" json:"optin_reminder_max"`
+
+	// The subscriber query of a dynamic list, whose subscriptions are
+	// materialized from it, and when they last were.
+	Query       string    `db:"query" json:"query"`
+	RefreshedAt null.Time `db:"refreshed_at" json:"refreshed_at"`
+
+	// Lists whose subscribers are excluded from campaigns to the list,
+	// unless the campaign is sent to them too.
+	ExcludeListIDs pq.Int64Array `db:"exclude_list_ids" json:"exclude_list_ids"`
+
+	// Archived lists are hidden from list pickers and can't be subscribed to
+	// or targeted by campaigns, but their subscriptions are kept.
+	Archived   bool      `db:"archived" json:"archived"`
+	ArchivedAt null.Time `db:"archived_at" json:"archived_at"`
+
 	// This is only relevant when querying the lists of a subscriber.
 	SubscriptionStatus    string    `db:"subscription_status" json:"subscription_status,omitempty"`
 	SubscriptionCreatedAt null.Time `db:"subscription_created_at" json:"subscription_created_at,omitempty"`
@@ -232,6 +835,47 @@ type List struct {
 	Total int `db:"total" json:"-"`
 }
 
+// ListFolder represents a folder that lists are organised in, which can be
+// nested in another folder.
+type ListFolder struct {
+	Base
+
+	Name     string   `db:"name" json:"name"`
+	ParentID null.Int `db:"parent_id" json:"parent_id"`
+
+	// Pseudofield for the number of lists directly in the folder.
+	Lists int `db:"lists" json:"lists"`
+}
+
+// ListWebhook is an HTTP endpoint that's posted the subscription events of a list.
+// If Events is empty, it's posted all events.
+type ListWebhook struct {
+	ID        int            `db:"id" json:"id"`
+	ListID    int            `db:"list_id" json:"list_id"`
+	URL       string         `db:"url" json:"url"`
+	Events    pq.StringArray `db:"events" json:"events"`
+	Secret    string         `db:"secret" json:"secret"`
+	Enabled   bool           `db:"enabled" json:"enabled"`
+	CreatedAt null.Time      `db:"created_at" json:"created_at"`
+	UpdatedAt null.Time      `db:"updated_at" json:"updated_at"`
+}
+
+// ListEvent is a subscription event of a list that's dispatched to its webhooks.
+type ListEvent struct {
+	ID             int64     `db:"id"`
+	Event          string    `db:"event"`
+	CreatedAt      null.Time `db:"created_at"`
+	ListID         int       `db:"list_id"`
+	ListUUID       string    `db:"list_uuid"`
+	ListName       string    `db:"list_name"`
+	SubscriberID   int       `db:"subscriber_id"`
+	SubscriberUUID string    `db:"subscriber_uuid"`
+	Email          string    `db:"email"`
+	Name           string    `db:"name"`
+	Attribs        JSON      `db:"attribs"`
+	Status         string    `db:"status"`
+}
+
 // Campaign represents an e-mail campaign.
 type Campaign struct {
 	Base
@@ -244,24 +888,65 @@ type Campaign struct {
 	FromEmail         string          `db:"from_email" json:"from_email"`
 	Body              string          `db:"body" json:"body"`
 	AltBody           null.String     `db:"altbody" json:"altbody"`
+	BodyAMP           null.String     `db:"body_amp" json:"body_amp"`
+	Preheader         string          `db:"preheader" json:"preheader"`
 	SendAt            null.Time       `db:"send_at" json:"send_at"`
+	SendAtLocal       bool            `db:"send_at_local" json:"send_at_local"`
+	SendAtTimezone    string          `db:"send_at_timezone" json:"send_at_timezone"`
+	SendAtWall        null.Time       `db:"send_at_wall" json:"-"`
+	SendUntil         null.Time       `db:"send_until" json:"send_until"`
+	SendWindow        SendWindow      `db:"send_window" json:"send_window"`
+	Priority          int             `db:"priority" json:"priority"`
+	ListIDHeader      string          `db:"list_id_header" json:"list_id_header"`
+	FreezeRecipients  bool            `db:"freeze_recipients" json:"freeze_recipients"`
+	RecipientsFrozen  null.Time       `db:"recipients_frozen_at" json:"recipients_frozen_at"`
+	Retrying          bool            `db:"retrying" json:"retrying"`
+	Expired           bool            `db:"expired" json:"expired"`
+	Rollout           Rollout         `db:"rollout" json:"rollout"`
+	RolloutHeldUntil  null.Time       `db:"rollout_held_until" json:"rollout_held_until"`
+	RolloutCheckedAt  null.Time       `db:"rollout_checked_at" json:"rollout_checked_at"`
 	Status            string          `db:"status" json:"status"`
 	ContentType       string          `db:"content_type" json:"content_type"`
 	Tags              pq.StringArray  `db:"tags" json:"tags"`
 	Headers           Headers         `db:"headers" json:"headers"`
 	TemplateID        int             `db:"template_id" json:"template_id"`
 	Messenger         string          `db:"messenger" json:"messenger"`
+	Failover          pq.StringArray  `db:"failover_messengers" json:"failover_messengers"`
 	Archive           bool            `db:"archive" json:"archive"`
 	ArchiveSlug       null.String     `db:"archive_slug" json:"archive_slug"`
 	ArchiveTemplateID int             `db:"archive_template_id" json:"archive_template_id"`
 	ArchiveMeta       json.RawMessage `db:"archive_meta" json:"archive_meta"`
+	ArchiveAccess     string          `db:"archive_access" json:"archive_access"`
+	ArchivePassword   string          `db:"archive_password" json:"-"`
+	ContentBlocks     ContentBlocks   `db:"content_blocks" json:"content_blocks"`
+	LangVariants      LangVariants    `db:"lang_variants" json:"lang_variants"`
+	EngagementRules   EngagementRules `db:"engagement_rules" json:"engagement_rules"`
+	ExcludeListIDs    pq.Int64Array   `db:"exclude_list_ids" json:"exclude_list_ids"`
+	SegmentIDs        pq.Int64Array   `db:"segment_ids" json:"segment_ids"`
+	SubscriberTags    pq.StringArray  `db:"subscriber_tags" json:"subscriber_tags"`
+	UTMParams         UTMParams       `db:"utm_params" json:"utm_params"`
+	TrackingDomain    string          `db:"tracking_domain" json:"tracking_domain"`
+	ContentVersion    int             `db:"content_version" json:"content_version"`
 
 	// TemplateBody is joined in from templates by the next-campaigns query.
-	TemplateBody        string             `db:"template_body" json:"-"`
-	ArchiveTemplateBody string             `db:"archive_template_body" json:"-"`
-	Tpl                 *template.Template `json:"-"`
-	SubjectTpl          *txttpl.Template   `json:"-"`
-	AltBodyTpl          *template.Template `json:"-"`
+	TemplateBody         string               `db:"template_body" json:"-"`
+	TemplateLangVariants TemplateLangVariants `db:"template_lang_variants" json:"-"`
+	TemplateBodyAMP      string               `db:"template_body_amp" json:"-"`
+	TemplatePreheader    string               `db:"template_preheader" json:"-"`
+	ArchiveTemplateBody  string               `db:"archive_template_body" json:"-"`
+	Tpl                  *template.Template   `json:"-"`
+	SubjectTpl           *txttpl.Template     `json:"-"`
+	AltBodyTpl           *template.Template   `json:"-"`
+	PreheaderTpl         *txttpl.Template     `json:"-"`
+	AMPTpl               *template.Template   `json:"-"`
+
+	// Compiled copies of the campaign with the content of its language
+	// variants, keyed by the lowercased language, eg: "pt-br".
+	langCamps map[string]*Campaign
+
+	// Tracking domain of the first of the campaign's lists that has one,
+	// which is used when the campaign doesn't have one.
+	ListTrackingDomain string `db:"list_tracking_domain" json:"-"`
 
 	// List of media (attachment) IDs obtained from the next-campaign query
 	// while sending a campaign.
@@ -292,6 +977,13 @@ type CampaignMeta struct {
 	StartedAt null.Time `db:"started_at" json:"started_at"`
 	ToSend    int       `db:"to_send" json:"to_send"`
 	Sent      int       `db:"sent" json:"sent"`
+
+	// Estimated cost and SMS segments sent.
+	Segments int     `db:"segments" json:"segments"`
+	Cost     float64 `db:"cost" json:"cost"`
+
+	// Send time of the timezone bucket being processed in a send_at_local campaign.
+	TZBucketAt null.Time `db:"tz_bucket_at" json:"-"`
 }
 
 type CampaignStats struct {
@@ -299,10 +991,208 @@ type CampaignStats struct {
 	Status    string    `db:"status" json:"status"`
 	ToSend    int       `db:"to_send" json:"to_send"`
 	Sent      int       `db:"sent" json:"sent"`
+	Segments  int       `db:"segments" json:"segments"`
+	Cost      float64   `db:"cost" json:"cost"`
 	Started   null.Time `db:"started_at" json:"started_at"`
 	UpdatedAt null.Time `db:"updated_at" json:"updated_at"`
 	Rate      int       `json:"rate"`
 	NetRate   int       `json:"net_rate"`
+
+	// Only in the stats of a single campaign.
+	Bounces    int `db:"bounces" json:"bounces"`
+	Complaints int `db:"complaints" json:"complaints"`
+	Errors     int `json:"errors"`
+}
+
+// CampaignLinkClicks is the number of clicks on a link at a position in a
+// campaign's body.
+type CampaignLinkClicks struct {
+	URL          string   `db:"url" json:"url"`
+	Position     null.Int `db:"position" json:"position"`
+	Clicks       int      `db:"clicks" json:"clicks"`
+	UniqueClicks int      `db:"unique_clicks" json:"unique_clicks"`
+}
+
+// BlocklistedDomain is a domain blocklist entry with the number of e-mails
+// that it has blocked.
+type BlocklistedDomain struct {
+	Domain    string    `db:"domain" json:"domain"`
+	Hits      int64     `db:"hits" json:"hits"`
+	LastHitAt null.Time `db:"last_hit_at" json:"last_hit_at"`
+}
+
+// MessengerUsage is the number of messages sent through a messenger on the
+// current day and in the current month, and its send quotas, if any.
+type MessengerUsage struct {
+	Messenger    string `db:"messenger" json:"messenger"`
+	Daily        int    `db:"daily" json:"daily"`
+	Monthly      int    `db:"monthly" json:"monthly"`
+	DailyQuota   int    `db:"-" json:"daily_quota"`
+	MonthlyQuota int    `db:"-" json:"monthly_quota"`
+	QuotaAction  string `db:"-" json:"quota_action"`
+}
+
+// CampaignSimulation is a dry run of a campaign that renders the messages to
+// all its recipients without sending them.
+type CampaignSimulation struct {
+	CampaignID   int            `db:"campaign_id" json:"campaign_id"`
+	Status       string         `db:"status" json:"status"`
+	Error        string         `db:"error" json:"error"`
+	Rendered     int            `db:"rendered" json:"rendered"`
+	Errors       int            `db:"errors" json:"errors"`
+	Domains      types.JSONText `db:"domains" json:"domains"`
+	ErrorSamples types.JSONText `db:"error_samples" json:"error_samples"`
+	StartedAt    time.Time      `db:"started_at" json:"started_at"`
+	UpdatedAt    time.Time      `db:"updated_at" json:"updated_at"`
+}
+
+// SimulationDomain is the number of messages of a dry run to a recipient domain.
+type SimulationDomain struct {
+	Domain string `json:"domain"`
+	Count  int    `json:"count"`
+}
+
+// SimulationError is a message of a dry run that couldn't be rendered.
+type SimulationError struct {
+	SubscriberID int    `json:"subscriber_id"`
+	Email        string `json:"email"`
+	Error        string `json:"error"`
+}
+
+// CampaignDelivery is the count of a campaign's messages that were
+// delivered through a messenger.
+type CampaignDelivery struct {
+	Messenger       string    `db:"messenger" json:"messenger"`
+	Count           int       `db:"count" json:"count"`
+	LastDeliveredAt null.Time `db:"last_delivered_at" json:"last_delivered_at"`
+}
+
+// SubscriberCampaign is a campaign that was sent to a subscriber.
+type SubscriberCampaign struct {
+	CampaignID     int       `db:"campaign_id" json:"campaign_id"`
+	CampaignUUID   string    `db:"campaign_uuid" json:"campaign_uuid"`
+	Name           string    `db:"name" json:"name"`
+	Subject        string    `db:"subject" json:"subject"`
+	Messenger      string    `db:"messenger" json:"messenger"`
+	Status         string    `db:"status" json:"status"`
+	ContentVersion int       `db:"content_version" json:"content_version"`
+	SentAt         null.Time `db:"sent_at" json:"sent_at"`
+
+	// When the subscriber first viewed the campaign and clicked a link in it.
+	Viewed    bool      `db:"viewed" json:"viewed"`
+	ViewedAt  null.Time `db:"viewed_at" json:"viewed_at"`
+	Clicked   bool      `db:"clicked" json:"clicked"`
+	ClickedAt null.Time `db:"clicked_at" json:"clicked_at"`
+
+	Total int `db:"total" json:"-"`
+}
+
+// CampaignDeliveryLog is the outcome of a campaign's message to a subscriber.
+type CampaignDeliveryLog struct {
+	ID             int64     `db:"id" json:"id"`
+	SubscriberID   null.Int  `db:"subscriber_id" json:"subscriber_id"`
+	SubscriberUUID string    `db:"subscriber_uuid" json:"subscriber_uuid"`
+	Email          string    `db:"email" json:"email"`
+	Name           string    `db:"name" json:"name"`
+	Messenger      string    `db:"messenger" json:"messenger"`
+	Status         string    `db:"status" json:"status"`
+	Error          string    `db:"error" json:"error"`
+	ErrorType      string    `db:"error_type" json:"error_type"`
+	Retries        int       `db:"retries" json:"retries"`
+	ContentVersion int       `db:"content_version" json:"content_version"`
+	CreatedAt      null.Time `db:"created_at" json:"created_at"`
+	UpdatedAt      null.Time `db:"updated_at" json:"updated_at"`
+
+	Total int `db:"total" json:"-"`
+}
+
+// CampaignRecipient is a subscriber in the frozen recipients of a campaign.
+type CampaignRecipient struct {
+	SubscriberID null.Int  `db:"subscriber_id" json:"subscriber_id"`
+	UUID         string    `db:"uuid" json:"uuid"`
+	Email        string    `db:"email" json:"email"`
+	Name         string    `db:"name" json:"name"`
+	CreatedAt    null.Time `db:"created_at" json:"created_at"`
+
+	Total int `db:"total" json:"-"`
+}
+
+// CampaignVersion is a version of a campaign's content and the number of
+// messages that were sent with it.
+type CampaignVersion struct {
+	Version       int           `db:"version" json:"version"`
+	Subject       string        `db:"subject" json:"subject"`
+	Body          string        `db:"body" json:"body"`
+	AltBody       null.String   `db:"altbody" json:"altbody"`
+	BodyAMP       null.String   `db:"body_amp" json:"body_amp"`
+	ContentType   string        `db:"content_type" json:"content_type"`
+	TemplateID    null.Int      `db:"template_id" json:"template_id"`
+	ContentBlocks ContentBlocks `db:"content_blocks" json:"content_blocks"`
+	Current       bool          `db:"current" json:"current"`
+	Recipients    int           `db:"recipients" json:"recipients"`
+	CreatedAt     null.Time     `db:"created_at" json:"created_at"`
+}
+
+// CampaignRevision is a snapshot of a campaign's content that's taken
+// every time it's saved.
+type CampaignRevision struct {
+	ID            int64         `db:"id" json:"id"`
+	CampaignID    int           `db:"campaign_id" json:"campaign_id"`
+	Subject       string        `db:"subject" json:"subject"`
+	Body          string        `db:"body" json:"body"`
+	AltBody       null.String   `db:"altbody" json:"altbody"`
+	BodyAMP       null.String   `db:"body_amp" json:"body_amp"`
+	ContentType   string        `db:"content_type" json:"content_type"`
+	TemplateID    null.Int      `db:"template_id" json:"template_id"`
+	ContentBlocks ContentBlocks `db:"content_blocks" json:"content_blocks"`
+	CreatedAt     null.Time     `db:"created_at" json:"created_at"`
+}
+
+// TemplateRevision is a snapshot of a template's content that's taken
+// every time it's saved.
+type TemplateRevision struct {
+	ID         int64     `db:"id" json:"id"`
+	TemplateID int       `db:"template_id" json:"template_id"`
+	Subject    string    `db:"subject" json:"subject"`
+	Body       string    `db:"body" json:"body"`
+	BodyAMP    string    `db:"body_amp" json:"body_amp"`
+	BodyMJML   string    `db:"body_mjml" json:"body_mjml"`
+	Preheader  string    `db:"preheader" json:"preheader"`
+	CreatedAt  null.Time `db:"created_at" json:"created_at"`
+}
+
+// CampaignTest is a test batch of a campaign and the version of the
+// campaign's content it was sent for.
+type CampaignTest struct {
+	ID             int64          `db:"id" json:"id"`
+	CampaignID     int            `db:"campaign_id" json:"campaign_id"`
+	ContentVersion int            `db:"content_version" json:"content_version"`
+	Subject        string         `db:"subject" json:"subject"`
+	Variants       pq.StringArray `db:"variants" json:"variants"`
+	Recipients     int            `db:"recipients" json:"recipients"`
+	CreatedAt      null.Time      `db:"created_at" json:"created_at"`
+}
+
+// CampaignTag is a tag and the aggregate stats of the campaigns tagged with it.
+type CampaignTag struct {
+	Tag       string  `db:"tag" json:"tag"`
+	Campaigns int     `db:"campaigns" json:"campaigns"`
+	Sent      int     `db:"sent" json:"sent"`
+	OpenRate  float64 `db:"open_rate" json:"open_rate"`
+	ClickRate float64 `db:"click_rate" json:"click_rate"`
+}
+
+// CampaignCost is the estimated cost of a campaign.
+type CampaignCost struct {
+	ID        int            `db:"id" json:"id"`
+	Name      string         `db:"name" json:"name"`
+	Tags      pq.StringArray `db:"tags" json:"tags"`
+	Messenger string         `db:"messenger" json:"messenger"`
+	Status    string         `db:"status" json:"status"`
+	Sent      int            `db:"sent" json:"sent"`
+	Segments  int            `db:"segments" json:"segments"`
+	Cost      float64        `db:"cost" json:"cost"`
+	StartedAt null.Time      `db:"started_at" json:"started_at"`
 }
 
 type CampaignAnalyticsCount struct {
@@ -328,11 +1218,234 @@ type Template struct {
 	Subject   string `db:"subject" json:"subject"`
 	Type      string `db:"type" json:"type"`
 	Body      string `db:"body" json:"body,omitempty"`
+	BodyAMP   string `db:"body_amp" json:"body_amp,omitempty"`
+	Preheader string `db:"preheader" json:"preheader"`
 	IsDefault bool   `db:"is_default" json:"is_default"`
 
+	// BodyMJML is the MJML source of MJML templates that Body is compiled from.
+	BodyMJML string `db:"body_mjml" json:"body_mjml,omitempty"`
+
+	LangVariants TemplateLangVariants `db:"lang_variants" json:"lang_variants"`
+
 	// Only relevant to tx (transactional) templates.
 	SubjectTpl *txttpl.Template   `json:"-"`
 	Tpl        *template.Template `json:"-"`
+
+	// Compiled copies of the template with the content of its language
+	// variants, keyed by the lowercased language, eg: "pt-br".
+	langTpls map[string]*Template
+}
+
+// TemplatePartial is a named fragment of content, eg: a header, a footer,
+// that's included in templates and campaigns with {{ Partial "name" }}.
+type TemplatePartial struct {
+	Base
+
+	Name string `db:"name" json:"name"`
+	Body string `db:"body" json:"body"`
+}
+
+// BuilderDoc is the block-based document of the visual e-mail builder that
+// the body of a campaign or a template is rendered from.
+type BuilderDoc struct {
+	Base
+
+	CampaignID null.Int       `db:"campaign_id" json:"campaign_id"`
+	TemplateID null.Int       `db:"template_id" json:"template_id"`
+	Doc        types.JSONText `db:"doc" json:"doc"`
+}
+
+// Segment is a saved subscriber query (SQL expression) whose matching
+// subscribers are materialized, and counted, when it's refreshed.
+type Segment struct {
+	Base
+
+	UUID            string         `db:"uuid" json:"uuid"`
+	Name            string         `db:"name" json:"name"`
+	Description     string         `db:"description" json:"description"`
+	Query           string         `db:"query" json:"query"`
+	Filter          *SegmentFilter `db:"filter" json:"filter"`
+	SubscriberCount int            `db:"subscriber_count" json:"subscriber_count"`
+	RefreshedAt     null.Time      `db:"refreshed_at" json:"refreshed_at"`
+
+	// Pseudofields.
+	Campaigns int `db:"campaigns" json:"campaigns"`
+}
+
+// SegmentFilter is a node in the structured filter of a segment that's
+// compiled to its query. A node is either a group of Rules combined with
+// the "and" or "or" Op, or a condition with an Op on a Field and a value.
+type SegmentFilter struct {
+	Op    string          `json:"op"`
+	Rules []SegmentFilter `json:"rules,omitempty"`
+	Field string          `json:"field,omitempty"`
+	Val   interface{}     `json:"value,omitempty"`
+}
+
+// SegmentStats are the stats of the subscribers in a segment as of its last
+// refresh. Views, clicks, and bounces are of the last Days days.
+type SegmentStats struct {
+	Statuses        types.JSONText `db:"statuses" json:"statuses"`
+	EngagementScore float64        `db:"engagement_score" json:"engagement_score"`
+	Views           int            `db:"views" json:"views"`
+	Clicks          int            `db:"clicks" json:"clicks"`
+	Bounces         int            `db:"bounces" json:"bounces"`
+	Days            int            `db:"-" json:"days"`
+}
+
+// RSSFeed is an RSS or Atom feed that's polled for new items that are
+// sent as campaigns to its lists.
+type RSSFeed struct {
+	Base
+
+	UUID         string        `db:"uuid" json:"uuid"`
+	Name         string        `db:"name" json:"name"`
+	URL          string        `db:"url" json:"url"`
+	Enabled      bool          `db:"enabled" json:"enabled"`
+	PollInterval string        `db:"poll_interval" json:"poll_interval"`
+	ListIDs      pq.Int64Array `db:"list_ids" json:"list_ids"`
+	TemplateID   null.Int      `db:"template_id" json:"template_id"`
+	Subject      string        `db:"subject" json:"subject"`
+	FromEmail    string        `db:"from_email" json:"from_email"`
+	Messenger    string        `db:"messenger" json:"messenger"`
+	Body         string        `db:"body" json:"body"`
+	MaxItems     int           `db:"max_items" json:"max_items"`
+	AutoSend     bool          `db:"auto_send" json:"auto_send"`
+	CheckedAt    null.Time     `db:"checked_at" json:"checked_at"`
+	LastError    string        `db:"last_error" json:"last_error"`
+
+	// Pseudofields.
+	Lists          types.JSONText `db:"lists" json:"lists"`
+	ItemsSent      int            `db:"items_sent" json:"items_sent"`
+	LastCampaignID null.Int       `db:"last_campaign_id" json:"last_campaign_id"`
+}
+
+// CRMSync syncs a list with a list (segment) of contacts in a CRM. The
+// contacts are pulled into the list and the unsubscriptions and bounces
+// of the list's subscribers are pushed to the CRM.
+type CRMSync struct {
+	Base
+
+	UUID             string         `db:"uuid" json:"uuid"`
+	Name             string         `db:"name" json:"name"`
+	Provider         string         `db:"provider" json:"provider"`
+	Segment          string         `db:"segment" json:"segment"`
+	APIKey           string         `db:"api_key" json:"api_key"`
+	ListID           int            `db:"list_id" json:"list_id"`
+	Mapping          CRMSyncMapping `db:"mapping" json:"mapping"`
+	Conflict         string         `db:"conflict" json:"conflict"`
+	Pull             bool           `db:"pull" json:"pull"`
+	PushUnsubscribes bool           `db:"push_unsubscribes" json:"push_unsubscribes"`
+	PushBounces      bool           `db:"push_bounces" json:"push_bounces"`
+	Enabled          bool           `db:"enabled" json:"enabled"`
+	SyncInterval     string         `db:"sync_interval" json:"sync_interval"`
+	SyncedAt         null.Time      `db:"synced_at" json:"synced_at"`
+	RanAt            null.Time      `db:"ran_at" json:"ran_at"`
+	Pulled           int            `db:"pulled" json:"pulled"`
+	Pushed           int            `db:"pushed" json:"pushed"`
+	LastError        string         `db:"last_error" json:"last_error"`
+
+	// Pseudofield.
+	ListName string `db:"list_name" json:"list_name"`
+}
+
+// CRMSyncMapping maps the properties of CRM contacts to subscriber fields.
+type CRMSyncMapping struct {
+	// Properties whose values, joined by spaces, are the name of subscribers.
+	Name []string `json:"name"`
+
+	// Properties and the subscriber attributes they're copied to.
+	Attribs map[string]string `json:"attribs"`
+
+	// Property that the statuses of subscribers are pushed to.
+	Status string `json:"status"`
+}
+
+// CRMSyncChange is a change in the status of a subscriber that's pushed to a CRM.
+type CRMSyncChange struct {
+	Email  string `db:"email"`
+	Status string `db:"status"`
+}
+
+// SubscriptionForm is a hosted subscription form of one or more lists. The
+// values of its custom fields are stored as subscriber attributes.
+type SubscriptionForm struct {
+	Base
+
+	UUID           string                 `db:"uuid" json:"uuid"`
+	Name           string                 `db:"name" json:"name"`
+	Enabled        bool                   `db:"enabled" json:"enabled"`
+	ListIDs        pq.Int64Array          `db:"list_ids" json:"list_ids"`
+	ChooseLists    bool                   `db:"choose_lists" json:"choose_lists"`
+	Fields         SubscriptionFormFields `db:"fields" json:"fields"`
+	Title          string                 `db:"title" json:"title"`
+	Description    string                 `db:"description" json:"description"`
+	SubmitLabel    string                 `db:"submit_label" json:"submit_label"`
+	SuccessMessage string                 `db:"success_message" json:"success_message"`
+	RedirectURL    string                 `db:"redirect_url" json:"redirect_url"`
+	Theme          SubscriptionFormTheme  `db:"theme" json:"theme"`
+
+	// Pseudofields.
+	Lists       types.JSONText `db:"lists" json:"lists"`
+	Views       int            `db:"views" json:"views"`
+	Conversions int            `db:"conversions" json:"conversions"`
+}
+
+// SubscriptionFormField is a custom field on a subscription form whose value
+// is stored as the subscriber attribute Attrib. Type is one of the attribute
+// types (AttribType*).
+type SubscriptionFormField struct {
+	Attrib      string   `json:"attrib"`
+	Label       string   `json:"label"`
+	Type        string   `json:"type"`
+	Required    bool     `json:"required"`
+	Placeholder string   `json:"placeholder"`
+	Options     []string `json:"options"`
+}
+
+// SubscriptionFormFields is used to define DB Scan()s.
+type SubscriptionFormFields []SubscriptionFormField
+
+// SubscriptionFormTheme is the look of a hosted subscription form. Colors are
+// hex codes and CSS is added to the page as it is.
+type SubscriptionFormTheme struct {
+	AccentColor     string `json:"accent_color"`
+	BackgroundColor string `json:"background_color"`
+	TextColor       string `json:"text_color"`
+	CSS             string `json:"css"`
+}
+
+// SubscriptionFormStat is the number of views and conversions of a
+// subscription form on a day.
+type SubscriptionFormStat struct {
+	Day         string `db:"day" json:"day"`
+	Views       int    `db:"views" json:"views"`
+	Conversions int    `db:"conversions" json:"conversions"`
+}
+
+// APIToken is an API credential with a role that limits what it can access.
+// subscribe tokens can only add subscribers to their lists, and analyst tokens
+// can only read subscriber, bounce, list, and campaign data, with the personal
+// data of subscribers masked. subscribe tokens can also add subscribers to
+// the lists in their list folders. Token is only set when the token is created.
+type APIToken struct {
+	Base
+
+	Name       string        `db:"name" json:"name"`
+	Username   string        `db:"username" json:"username"`
+	Role       string        `db:"role" json:"role"`
+	Token      string        `db:"-" json:"token,omitempty"`
+	ListIDs    pq.Int64Array `db:"list_ids" json:"list_ids"`
+	FolderIDs  pq.Int64Array `db:"folder_ids" json:"folder_ids"`
+	LastUsedAt null.Time     `db:"last_used_at" json:"last_used_at"`
+
+	// The UUIDs of the token's lists. When a token is authenticated, its
+	// lists include the lists in its folders and their subfolders.
+	ListUUIDs pq.StringArray `db:"list_uuids" json:"-"`
+
+	// Pseudofields.
+	Lists   types.JSONText `db:"lists" json:"lists"`
+	Folders types.JSONText `db:"folders" json:"folders"`
 }
 
 // Bounce represents a single bounce event.
@@ -356,6 +1469,14 @@ type Bounce struct {
 	Total int `db:"total" json:"-"`
 }
 
+// BounceAuthStat is the number of bounces with a particular authentication
+// method and result (eg: spf=fail) recorded from the bounce e-mail headers.
+type BounceAuthStat struct {
+	Method string `db:"method" json:"method"`
+	Result string `db:"result" json:"result"`
+	Count  int    `db:"count" json:"count"`
+}
+
 // Message is the message pushed to a Messenger.
 type Message struct {
 	From        string
@@ -364,6 +1485,7 @@ type Message struct {
 	ContentType string
 	Body        []byte
 	AltBody     []byte
+	AMPBody     []byte
 	Headers     textproto.MIMEHeader
 	Attachments []Attachment
 
@@ -463,6 +1585,79 @@ func (subs Subscribers) LoadLists(stmt *sqlx.Stmt) error {
 	return nil
 }
 
+// LoadEngagement lazy loads the engagement of all the subscribers
+// in the Subscribers slice and attaches them to their Engagement property.
+func (subs Subscribers) LoadEngagement(stmt *sqlx.Stmt) error {
+	var out []SubscriberEngagement
+	if err := stmt.Select(&out, pq.Array(subs.GetIDs())); err != nil {
+		return err
+	}
+
+	if len(subs) != len(out) {
+		return errors.New("subscriber engagement count does not match")
+	}
+
+	for i := range out {
+		if out[i].SubscriberID == subs[i].ID {
+			subs[i].Engagement = &out[i]
+		}
+	}
+
+	return nil
+}
+
+// Check checks if a value (as decoded from JSON) is of the attribute's type
+// and returns it normalized: numbers as float64, and dates as YYYY-MM-DD, or
+// RFC3339 if they have a time.
+func (f AttribField) Check(v interface{}) (interface{}, bool) {
+	switch f.Type {
+	case AttribTypeString:
+		s, ok := v.(string)
+		return s, ok
+
+	case AttribTypeNumber:
+		switch n := v.(type) {
+		case float64:
+			return n, true
+		case int:
+			return float64(n), true
+		case json.Number:
+			f, err := n.Float64()
+			return f, err == nil
+		}
+
+	case AttribTypeBool:
+		b, ok := v.(bool)
+		return b, ok
+
+	case AttribTypeDate:
+		s, ok := v.(string)
+		if !ok {
+			return nil, false
+		}
+		s = strings.TrimSpace(s)
+		if t, err := time.Parse("2006-01-02", s); err == nil {
+			return t.Format("2006-01-02"), true
+		}
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			return t.Format(time.RFC3339), true
+		}
+
+	case AttribTypeEnum:
+		s, ok := v.(string)
+		if !ok {
+			return nil, false
+		}
+		for _, o := range f.Options {
+			if s == o {
+				return s, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
 // Value returns the JSON marshalled SubscriberAttribs.
 func (s JSON) Value() (driver.Value, error) {
 	return json.Marshal(s)
@@ -481,6 +1676,92 @@ func (s JSON) Scan(src interface{}) error {
 	return fmt.Errorf("could not not decode type %T -> %T", src, s)
 }
 
+// Value returns the JSON marshalled SubscriberChannels. A nil map is NULL.
+func (s SubscriberChannels) Value() (driver.Value, error) {
+	if s == nil {
+		return nil, nil
+	}
+	return json.Marshal(s)
+}
+
+// Scan unmarshals JSONB from the DB.
+func (s *SubscriberChannels) Scan(src interface{}) error {
+	if src == nil {
+		*s = SubscriberChannels{}
+		return nil
+	}
+
+	if data, ok := src.([]byte); ok {
+		return json.Unmarshal(data, s)
+	}
+	return fmt.Errorf("could not not decode type %T -> %T", src, s)
+}
+
+// Target returns the subscriber's identity on a channel if they've
+// consented to be messaged on it.
+func (s SubscriberChannels) Target(channel string) (string, bool) {
+	ch, ok := s[channel]
+	if !ok || !ch.Consent || ch.Value == "" {
+		return "", false
+	}
+	return ch.Value, true
+}
+
+// Value returns the JSON marshalled SegmentFilter.
+func (s SegmentFilter) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+// Scan unmarshals JSONB from the DB.
+func (s *SegmentFilter) Scan(src interface{}) error {
+	if data, ok := src.([]byte); ok {
+		return json.Unmarshal(data, s)
+	}
+	return fmt.Errorf("could not not decode type %T -> %T", src, s)
+}
+
+// Value returns the JSON marshalled CRMSyncMapping.
+func (m CRMSyncMapping) Value() (driver.Value, error) {
+	return json.Marshal(m)
+}
+
+// Scan unmarshals JSONB from the DB.
+func (m *CRMSyncMapping) Scan(src interface{}) error {
+	if data, ok := src.([]byte); ok {
+		return json.Unmarshal(data, m)
+	}
+	return fmt.Errorf("could not not decode type %T -> %T", src, m)
+}
+
+// Value returns the JSON marshalled SubscriptionFormFields.
+func (f SubscriptionFormFields) Value() (driver.Value, error) {
+	if f == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(f)
+}
+
+// Scan unmarshals JSONB from the DB.
+func (f *SubscriptionFormFields) Scan(src interface{}) error {
+	if data, ok := src.([]byte); ok {
+		return json.Unmarshal(data, f)
+	}
+	return fmt.Errorf("could not not decode type %T -> %T", src, f)
+}
+
+// Value returns the JSON marshalled SubscriptionFormTheme.
+func (t SubscriptionFormTheme) Value() (driver.Value, error) {
+	return json.Marshal(t)
+}
+
+// Scan unmarshals JSONB from the DB.
+func (t *SubscriptionFormTheme) Scan(src interface{}) error {
+	if data, ok := src.([]byte); ok {
+		return json.Unmarshal(data, t)
+	}
+	return fmt.Errorf("could not not decode type %T -> %T", src, t)
+}
+
 // Scan unmarshals JSONB from the DB.
 func (s StringIntMap) Scan(src interface{}) error {
 	if src == nil {
@@ -546,8 +1827,37 @@ func (c *Campaign) CompileTemplate(f template.FuncMap) error {
 		c.SubjectTpl = subjTpl
 	}
 
-	// Compile the base template.
+	// Compile the preheader, which is the campaign's or the template's.
+	c.PreheaderTpl = nil
+	preheader := c.Preheader
+	if preheader == "" {
+		preheader = c.TemplatePreheader
+	}
+	if preheader != "" {
+		for _, r := range regTplFuncs {
+			preheader = r.regExp.ReplaceAllString(preheader, r.replace)
+		}
+
+		var txtFuncs map[string]interface{} = f
+		preTpl, err := txttpl.New(ContentTpl).Funcs(txtFuncs).Parse(preheader)
+		if err != nil {
+			return fmt.Errorf("error compiling preheader: %v", err)
+		}
+		c.PreheaderTpl = preTpl
+	}
+
+	// Compile the base template. If there's a preheader that neither the
+	// template nor the message places with {{ Preheader }}, it's inserted
+	// at the top of the <body>.
 	body := c.TemplateBody
+	if c.PreheaderTpl != nil && c.ContentType != CampaignContentTypePlain &&
+		!regPreheader.MatchString(body) && !regPreheader.MatchString(c.Body) {
+		if loc := regBodyTag.FindStringIndex(body); loc != nil {
+			body = body[:loc[1]] + "{{ Preheader }}" + body[loc[1]:]
+		} else {
+			body = "{{ Preheader }}" + body
+		}
+	}
 	for _, r := range regTplFuncs {
 		body = r.regExp.ReplaceAllString(body, r.replace)
 	}
@@ -581,8 +1891,23 @@ func (c *Campaign) CompileTemplate(f template.FuncMap) error {
 	if err != nil {
 		return fmt.Errorf("error inserting child template: %v", err)
 	}
+	// Compile the named content blocks into the message template.
+	for _, b := range c.ContentBlocks {
+		src := b.Body
+		if strings.TrimSpace(b.Condition) != "" {
+			src = "{{ if " + b.Condition + " }}" + b.Body + "{{ end }}"
+		}
+		for _, r := range regTplFuncs {
+			src = r.regExp.ReplaceAllString(src, r.replace)
+		}
+
+		if _, err := out.New(BlockTplPrefix + b.Name).Parse(src); err != nil {
+			return fmt.Errorf("error compiling content block %s: %v", b.Name, err)
+		}
+	}
 	c.Tpl = out
 
+	c.AltBodyTpl = nil
 	if strings.Contains(c.AltBody.String, "{{") {
 		b := c.AltBody.String
 		for _, r := range regTplFuncs {
@@ -595,9 +1920,183 @@ func (c *Campaign) CompileTemplate(f template.FuncMap) error {
 		c.AltBodyTpl = bTpl
 	}
 
+	// If there's an AMP body, compile it, wrapped in the template's AMP
+	// body if it has one.
+	if c.BodyAMP.Valid && c.BodyAMP.String != "" {
+		amp := c.BodyAMP.String
+		for _, r := range regTplFuncs {
+			amp = r.regExp.ReplaceAllString(amp, r.replace)
+		}
+		ampTpl, err := template.New(ContentTpl).Funcs(f).Parse(amp)
+		if err != nil {
+			return fmt.Errorf("error compiling AMP message: %v", err)
+		}
+
+		base := `{{ template "content" . }}`
+		if c.TemplateBodyAMP != "" {
+			base = c.TemplateBodyAMP
+			for _, r := range regTplFuncs {
+				base = r.regExp.ReplaceAllString(base, r.replace)
+			}
+		}
+		baseTpl, err := template.New(BaseTpl).Funcs(f).Parse(base)
+		if err != nil {
+			return fmt.Errorf("error compiling base AMP template: %v", err)
+		}
+
+		out, err := baseTpl.AddParseTree(ContentTpl, ampTpl.Tree)
+		if err != nil {
+			return fmt.Errorf("error inserting child AMP template: %v", err)
+		}
+		c.AMPTpl = out
+	}
+
+	// Compile the language variants as copies of the campaign with their
+	// content, for every language that the campaign or its template has a
+	// variant in. The content and the template of a language are picked
+	// separately, so a "pt-BR" template variant and a "pt" content variant
+	// are both used for "pt-BR".
+	c.langCamps = nil
+	var langs []string
+	for _, v := range c.LangVariants {
+		langs = append(langs, normalizeLang(v.Lang))
+	}
+	for _, v := range c.TemplateLangVariants {
+		langs = append(langs, normalizeLang(v.Lang))
+	}
+	for _, l := range langs {
+		if _, ok := c.langCamps[l]; ok {
+			continue
+		}
+
+		lc := *c
+		lc.LangVariants = nil
+		lc.TemplateLangVariants = nil
+		lc.SubjectTpl = nil
+		if v, ok := c.LangVariants.find(l); ok {
+			if v.Subject != "" {
+				lc.Subject = v.Subject
+			}
+			lc.Body = v.Body
+			if v.AltBody != "" {
+				lc.AltBody = null.NewString(v.AltBody, true)
+			}
+		}
+		if v, ok := c.TemplateLangVariants.find(l); ok {
+			lc.TemplateBody = v.Body
+		}
+
+		if err := lc.CompileTemplate(f); err != nil {
+			return fmt.Errorf("error compiling %s variant: %v", l, err)
+		}
+
+		if c.langCamps == nil {
+			c.langCamps = make(map[string]*Campaign, len(langs))
+		}
+		c.langCamps[l] = &lc
+	}
+
 	return nil
 }
 
+// ScheduledAt returns the time at which a scheduled campaign is sent. For
+// campaigns scheduled in a timezone, it's the wall-clock time of send_at in
+// the timezone per the current timezone rules, so that it doesn't drift
+// across DST changes.
+func (c *Campaign) ScheduledAt() time.Time {
+	if c.SendAtWall.Valid && c.SendAtTimezone != "" {
+		if loc, err := time.LoadLocation(c.SendAtTimezone); err == nil {
+			w := c.SendAtWall.Time
+			return time.Date(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), w.Second(), 0, loc)
+		}
+	}
+
+	return c.SendAt.Time
+}
+
+// ForLocale returns the compiled copy of the campaign with the content of
+// the language variant that matches a locale, eg: "pt-BR", or its base
+// language, eg: "pt". If there's no matching variant, the campaign itself
+// is returned.
+func (c *Campaign) ForLocale(locale string) *Campaign {
+	if len(c.langCamps) == 0 || locale == "" {
+		return c
+	}
+
+	for _, l := range localeFallbacks(locale) {
+		if lc, ok := c.langCamps[l]; ok {
+			return lc
+		}
+	}
+
+	return c
+}
+
+// ForLocale returns the compiled copy of the template with the content of
+// the language variant that matches a locale, falling back to its parent
+// languages, eg: "zh-Hant-TW", "zh-Hant", and "zh". If there's no matching
+// variant, the template itself is returned.
+func (t *Template) ForLocale(locale string) *Template {
+	if len(t.langTpls) == 0 || locale == "" {
+		return t
+	}
+
+	for _, l := range localeFallbacks(locale) {
+		if lt, ok := t.langTpls[l]; ok {
+			return lt
+		}
+	}
+
+	return t
+}
+
+func (l LangVariants) find(lang string) (LangVariant, bool) {
+	for _, fl := range localeFallbacks(lang) {
+		for _, v := range l {
+			if normalizeLang(v.Lang) == fl {
+				return v, true
+			}
+		}
+	}
+	return LangVariant{}, false
+}
+
+func (l TemplateLangVariants) find(lang string) (TemplateLangVariant, bool) {
+	for _, fl := range localeFallbacks(lang) {
+		for _, v := range l {
+			if normalizeLang(v.Lang) == fl {
+				return v, true
+			}
+		}
+	}
+	return TemplateLangVariant{}, false
+}
+
+// localeFallbacks returns the normalized languages that a locale is looked up
+// as, from the most specific to its base language, eg: "zh-Hant-TW" is looked
+// up as "zh-hant-tw", "zh-hant", and "zh".
+func localeFallbacks(locale string) []string {
+	l := normalizeLang(locale)
+	if l == "" {
+		return nil
+	}
+
+	out := []string{l}
+	for {
+		i := strings.LastIndex(l, "-")
+		if i < 1 {
+			break
+		}
+		l = l[:i]
+		out = append(out, l)
+	}
+	return out
+}
+
+func normalizeLang(l string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(l), "_", "-"))
+}
+
 // ConvertContent converts a campaign's body from one format to another,
 // for example, Markdown to HTML.
 func (c *Campaign) ConvertContent(from, to string) (string, error) {
@@ -625,7 +2124,8 @@ func (c *Campaign) ConvertContent(from, to string) (string, error) {
 // Compile compiles a template body and subject (only for tx templates) and
 // caches the templat references to be executed later.
 func (t *Template) Compile(f template.FuncMap) error {
-	tpl, err := template.New(BaseTpl).Funcs(f).Parse(t.Body)
+	body := regPartial.regExp.ReplaceAllString(t.Body, regPartial.replace)
+	tpl, err := template.New(BaseTpl).Funcs(f).Parse(body)
 	if err != nil {
 		return fmt.Errorf("error compiling transactional template: %v", err)
 	}
@@ -642,10 +2142,50 @@ func (t *Template) Compile(f template.FuncMap) error {
 		t.SubjectTpl = subjTpl
 	}
 
+	// Compile the language variants as copies of the template with their content.
+	t.langTpls = nil
+	for _, v := range t.LangVariants {
+		lt := *t
+		lt.LangVariants = nil
+		lt.SubjectTpl = nil
+		lt.Body = v.Body
+		if v.Subject != "" {
+			lt.Subject = v.Subject
+		}
+
+		if err := lt.Compile(f); err != nil {
+			return fmt.Errorf("error compiling %s variant: %v", v.Lang, err)
+		}
+
+		if t.langTpls == nil {
+			t.langTpls = make(map[string]*Template, len(t.LangVariants))
+		}
+		t.langTpls[normalizeLang(v.Lang)] = &lt
+	}
+
 	return nil
 }
 
+// Compile compiles a template partial with the functions of the template
+// that includes it.
+func (p *TemplatePartial) Compile(f template.FuncMap) (*template.Template, error) {
+	body := p.Body
+	for _, r := range regTplFuncs {
+		body = r.regExp.ReplaceAllString(body, r.replace)
+	}
+
+	tpl, err := template.New(PartialTpl).Funcs(f).Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("error compiling partial %s: %v", p.Name, err)
+	}
+
+	return tpl, nil
+}
+
 func (m *TxMessage) Render(sub Subscriber, tpl *Template) error {
+	// Use the template's language variant for the subscriber's locale, if any.
+	tpl = tpl.ForLocale(sub.Locale)
+
 	data := struct {
 		Subscriber Subscriber
 		Tx         *TxMessage
@@ -702,6 +2242,64 @@ func (s Subscriber) LastName() string {
 	return s.Name
 }
 
+// MaskPII masks the subscriber's e-mail and redacts their name, attributes,
+// external ID, locale, timezone, channel identities, and the meta of their
+// subscriptions, which can hold opt-in IPs.
+func (s *Subscriber) MaskPII() {
+	s.Email = MaskEmail(s.Email)
+	s.Name = ""
+	s.Attribs = JSON{}
+	s.ExternalID = null.String{}
+	s.Locale = ""
+	s.Timezone = ""
+
+	for k, ch := range s.Channels {
+		ch.Value = maskedValue
+		s.Channels[k] = ch
+	}
+
+	var lists []map[string]json.RawMessage
+	if err := json.Unmarshal(s.Lists, &lists); err == nil {
+		for _, l := range lists {
+			delete(l, "meta")
+		}
+		if b, err := json.Marshal(lists); err == nil {
+			s.Lists = b
+		}
+	}
+}
+
+// MaskPII masks the e-mail of the bounce and redacts its meta, which holds
+// the bounce message.
+func (b *Bounce) MaskPII() {
+	b.Email = MaskEmail(b.Email)
+	b.Meta = json.RawMessage(`{}`)
+}
+
+// CanAccess returns whether an API token with the token's role can access
+// the API route with the given method and route path, eg: GET /api/subscribers.
+func (t APIToken) CanAccess(method, path string) bool {
+	return apiTokenRoutes[t.Role][method+" "+path]
+}
+
+// MasksPII returns whether the personal data of subscribers is masked in
+// the responses to the token's requests.
+func (t APIToken) MasksPII() bool {
+	return t.Role == APITokenRoleAnalyst
+}
+
+// MaskEmail masks all but the first character of the local part of an
+// e-mail, eg: j***@example.com.
+func MaskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 1 {
+		return maskedValue
+	}
+
+	_, n := utf8.DecodeRuneInString(email)
+	return email[:n] + maskedValue + email[at:]
+}
+
 // Scan implements the sql.Scanner interface.
 func (h *Headers) Scan(src interface{}) error {
 	var b []byte
@@ -738,3 +2336,176 @@ func (h Headers) Value() (driver.Value, error) {
 
 	return "[]", nil
 }
+
+// Scan implements the sql.Scanner interface.
+func (b *ContentBlocks) Scan(src interface{}) error {
+	var v []byte
+	switch src := src.(type) {
+	case []byte:
+		v = src
+	case string:
+		v = []byte(src)
+	case nil:
+		return nil
+	}
+
+	return json.Unmarshal(v, b)
+}
+
+// Value implements the driver.Valuer interface.
+func (b ContentBlocks) Value() (driver.Value, error) {
+	if len(b) == 0 {
+		return "[]", nil
+	}
+
+	return json.Marshal(b)
+}
+
+// Scan implements the sql.Scanner interface.
+func (e *EngagementRules) Scan(src interface{}) error {
+	var v []byte
+	switch src := src.(type) {
+	case []byte:
+		v = src
+	case string:
+		v = []byte(src)
+	case nil:
+		return nil
+	}
+
+	return json.Unmarshal(v, e)
+}
+
+// Value implements the driver.Valuer interface.
+func (e EngagementRules) Value() (driver.Value, error) {
+	if len(e) == 0 {
+		return "[]", nil
+	}
+
+	return json.Marshal(e)
+}
+
+// Scan implements the sql.Scanner interface.
+func (l *LangVariants) Scan(src interface{}) error {
+	var v []byte
+	switch src := src.(type) {
+	case []byte:
+		v = src
+	case string:
+		v = []byte(src)
+	case nil:
+		return nil
+	}
+
+	return json.Unmarshal(v, l)
+}
+
+// Value implements the driver.Valuer interface.
+func (l LangVariants) Value() (driver.Value, error) {
+	if len(l) == 0 {
+		return "[]", nil
+	}
+
+	return json.Marshal(l)
+}
+
+// Scan implements the sql.Scanner interface.
+func (l *TemplateLangVariants) Scan(src interface{}) error {
+	var v []byte
+	switch src := src.(type) {
+	case []byte:
+		v = src
+	case string:
+		v = []byte(src)
+	case nil:
+		return nil
+	}
+
+	return json.Unmarshal(v, l)
+}
+
+// Value implements the driver.Valuer interface.
+func (l TemplateLangVariants) Value() (driver.Value, error) {
+	if len(l) == 0 {
+		return "[]", nil
+	}
+
+	return json.Marshal(l)
+}
+
+// Scan implements the sql.Scanner interface.
+func (u *UTMParams) Scan(src interface{}) error {
+	var v []byte
+	switch src := src.(type) {
+	case []byte:
+		v = src
+	case string:
+		v = []byte(src)
+	case nil:
+		return nil
+	}
+
+	return json.Unmarshal(v, u)
+}
+
+// Value implements the driver.Valuer interface.
+func (u UTMParams) Value() (driver.Value, error) {
+	if len(u) == 0 {
+		return "{}", nil
+	}
+
+	return json.Marshal(u)
+}
+
+// Scan implements the sql.Scanner interface.
+func (r *Rollout) Scan(src interface{}) error {
+	var v []byte
+	switch src := src.(type) {
+	case []byte:
+		v = src
+	case string:
+		v = []byte(src)
+	case nil:
+		return nil
+	}
+
+	return json.Unmarshal(v, r)
+}
+
+// Value implements the driver.Valuer interface.
+func (r Rollout) Value() (driver.Value, error) {
+	if r.Percent == 0 {
+		return "{}", nil
+	}
+
+	return json.Marshal(r)
+}
+
+// IsZero returns whether the window is empty and doesn't restrict delivery.
+func (w SendWindow) IsZero() bool {
+	return len(w.Days) == 0 && w.Start == "" && w.End == ""
+}
+
+// Scan implements the sql.Scanner interface.
+func (w *SendWindow) Scan(src interface{}) error {
+	var v []byte
+	switch src := src.(type) {
+	case []byte:
+		v = src
+	case string:
+		v = []byte(src)
+	case nil:
+		return nil
+	}
+
+	return json.Unmarshal(v, w)
+}
+
+// Value implements the driver.Valuer interface.
+func (w SendWindow) Value() (driver.Value, error) {
+	if w.IsZero() {
+		return "{}", nil
+	}
+
+	return json.Marshal(w)
+}
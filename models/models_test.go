@@ -0,0 +1,135 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	null "gopkg.in/volatiletech/null.v6"
+)
+
+func TestMaskEmail(t *testing.T) {
+	cases := map[string]string{
+		"john@example.com":     "j***@example.com",
+		"j@example.com":        "j***@example.com",
+		"émile@example.com":    "é***@example.com",
+		"a@b@example.com":      "a***@example.com",
+		"@example.com":         "***",
+		"":                     "***",
+		"not-an-email-address": "***",
+	}
+
+	for in, out := range cases {
+		if got := MaskEmail(in); got != out {
+			t.Errorf("MaskEmail(%q): expected %q, got %q", in, out, got)
+		}
+	}
+}
+
+func TestSubscriberMaskPII(t *testing.T) {
+	s := Subscriber{
+		UUID:    "9e8d0a37-ba6a-4f92-8b6a-4de2ee0e8116",
+		Email:   "john@example.com",
+		Name:    "John Doe",
+		Attribs: JSON{"city": "Bengaluru"},
+		Status:  SubscriberStatusEnabled,
+		Lists:   []byte(`[{"id": 1, "name": "Newsletter", "meta": {"optin_ip": "10.0.0.1"}}]`),
+
+		ExternalID: null.StringFrom("crm-1234"),
+		Locale:     "pt-BR",
+		Timezone:   "America/Sao_Paulo",
+		Channels: SubscriberChannels{
+			SubscriberChannelPhone: {Value: "+15550100", Consent: true},
+		},
+	}
+	s.MaskPII()
+
+	if s.Email != "j***@example.com" || s.Name != "" || len(s.Attribs) != 0 {
+		t.Errorf("expected the e-mail to be masked and the name and attribs redacted, got %q, %q, %v", s.Email, s.Name, s.Attribs)
+	}
+	if s.ExternalID.Valid || s.Locale != "" || s.Timezone != "" {
+		t.Errorf("expected the external ID, locale, and timezone to be redacted, got %v, %q, %q", s.ExternalID, s.Locale, s.Timezone)
+	}
+	if ch := s.Channels[SubscriberChannelPhone]; ch.Value != maskedValue || !ch.Consent {
+		t.Errorf("expected the channel identity to be redacted with its consent, got %+v", ch)
+	}
+	if s.UUID == "" || s.Status != SubscriberStatusEnabled {
+		t.Error("expected the subscriber's other fields to be retained")
+	}
+
+	var lists []map[string]interface{}
+	if err := json.Unmarshal(s.Lists, &lists); err != nil {
+		t.Fatalf("error decoding masked lists: %v", err)
+	}
+	if len(lists) != 1 || lists[0]["name"] != "Newsletter" {
+		t.Errorf("expected the lists to be retained, got %s", s.Lists)
+	}
+	if _, ok := lists[0]["meta"]; ok {
+		t.Errorf("expected the subscription meta to be redacted, got %s", s.Lists)
+	}
+}
+
+func TestBounceMaskPII(t *testing.T) {
+	b := Bounce{Email: "john@example.com", Meta: json.RawMessage(`{"message": "550 john@example.com unknown"}`)}
+	b.MaskPII()
+
+	if b.Email != "j***@example.com" || string(b.Meta) != "{}" {
+		t.Errorf("expected the e-mail to be masked and the meta redacted, got %q, %s", b.Email, b.Meta)
+	}
+}
+
+func TestAPITokenCanAccess(t *testing.T) {
+	var (
+		sub      = APIToken{Role: APITokenRoleSubscribe}
+		analyst  = APIToken{Role: APITokenRoleAnalyst}
+		noRole   = APIToken{}
+		badRole  = APIToken{Role: "admin"}
+		anyToken = []APIToken{sub, analyst, noRole, badRole}
+	)
+
+	cases := []struct {
+		tok            APIToken
+		method, path   string
+		expectedAccess bool
+	}{
+		{sub, "POST", "/api/subscribers", true},
+		{sub, "GET", "/api/health", true},
+		{sub, "GET", "/api/subscribers", false},
+		{sub, "PUT", "/api/subscribers/:id", false},
+		{sub, "POST", "/api/subscribers/", false},
+		{sub, "post", "/api/subscribers", false},
+
+		{analyst, "GET", "/api/subscribers", true},
+		{analyst, "GET", "/api/subscribers/:id", true},
+		{analyst, "GET", "/api/bounces", true},
+		{analyst, "GET", "/api/lists/folders", true},
+		{analyst, "GET", "/api/campaigns/analytics/:type", true},
+		{analyst, "POST", "/api/subscribers", false},
+		{analyst, "DELETE", "/api/subscribers/:id", false},
+		{analyst, "GET", "/api/subscribers/export", false},
+		{analyst, "GET", "/api/subscribers/:id/export", false},
+		{analyst, "GET", "/api/settings", false},
+
+		{noRole, "POST", "/api/subscribers", false},
+		{badRole, "GET", "/api/health", false},
+	}
+	for _, c := range cases {
+		if got := c.tok.CanAccess(c.method, c.path); got != c.expectedAccess {
+			t.Errorf("%q token CanAccess(%s %s): expected %v, got %v", c.tok.Role, c.method, c.path, c.expectedAccess, got)
+		}
+	}
+
+	// API tokens can never manage API tokens.
+	for _, tok := range anyToken {
+		for _, m := range []string{"GET", "POST", "PUT", "DELETE"} {
+			for _, p := range []string{"/api/tokens", "/api/tokens/:id"} {
+				if tok.CanAccess(m, p) {
+					t.Errorf("%q token can access %s %s", tok.Role, m, p)
+				}
+			}
+		}
+	}
+
+	if sub.MasksPII() || !analyst.MasksPII() || noRole.MasksPII() {
+		t.Error("expected only analyst tokens to mask personal data")
+	}
+}
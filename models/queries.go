@@ -21,18 +21,66 @@ type Queries struct {
 	GetSubscribersByEmails          *sqlx.Stmt `query:"get-subscribers-by-emails"`
 	GetSubscriberLists              *sqlx.Stmt `query:"get-subscriber-lists"`
 	GetSubscriptions                *sqlx.Stmt `query:"get-subscriptions"`
+	GetSubscriberEngagement         *sqlx.Stmt `query:"get-subscriber-engagement"`
+	QuerySubscriberCampaigns        *sqlx.Stmt `query:"query-subscriber-campaigns"`
+	GetSubscriberConsents           *sqlx.Stmt `query:"get-subscriber-consents"`
+	InsertSubscriberConsent         *sqlx.Stmt `query:"insert-subscriber-consent"`
 	GetSubscriberListsLazy          *sqlx.Stmt `query:"get-subscriber-lists-lazy"`
 	UpdateSubscriber                *sqlx.Stmt `query:"update-subscriber"`
 	UpdateSubscriberWithLists       *sqlx.Stmt `query:"update-subscriber-with-lists"`
 	BlocklistSubscribers            *sqlx.Stmt `query:"blocklist-subscribers"`
 	AddSubscribersToLists           *sqlx.Stmt `query:"add-subscribers-to-lists"`
 	DeleteSubscriptions             *sqlx.Stmt `query:"delete-subscriptions"`
+	AddSubscriberTags               *sqlx.Stmt `query:"add-subscriber-tags"`
+	RemoveSubscriberTags            *sqlx.Stmt `query:"remove-subscriber-tags"`
+	GetSubscriberTags               *sqlx.Stmt `query:"get-subscriber-tags"`
+	RenameSubscriberTag             *sqlx.Stmt `query:"rename-subscriber-tag"`
+	DeleteSubscriberTag             *sqlx.Stmt `query:"delete-subscriber-tag"`
+	MarkSubscriptionsRepermission   *sqlx.Stmt `query:"mark-subscriptions-repermission"`
+	ClearSubscriptionsRepermission  *sqlx.Stmt `query:"clear-subscriptions-repermission"`
+	RenewSubscriptions              *sqlx.Stmt `query:"renew-subscriptions"`
+	ExpireSubscriptions             *sqlx.Stmt `query:"expire-subscriptions"`
+	GetDueOptinReminders            *sqlx.Stmt `query:"get-due-optin-reminders"`
+	RecordOptinReminders            *sqlx.Stmt `query:"record-optin-reminders"`
 	DeleteUnconfirmedSubscriptions  *sqlx.Stmt `query:"delete-unconfirmed-subscriptions"`
+	RunSubscriberHygiene            *sqlx.Stmt `query:"run-subscriber-hygiene"`
 	ConfirmSubscriptionOptin        *sqlx.Stmt `query:"confirm-subscription-optin"`
+	ResubscribeSubscriber           *sqlx.Stmt `query:"resubscribe-subscriber"`
 	UnsubscribeSubscribersFromLists *sqlx.Stmt `query:"unsubscribe-subscribers-from-lists"`
 	DeleteSubscribers               *sqlx.Stmt `query:"delete-subscribers"`
+	SoftDeleteSubscribers           *sqlx.Stmt `query:"soft-delete-subscribers"`
+	RestoreSubscribers              *sqlx.Stmt `query:"restore-subscribers"`
+	PurgeDeletedSubscribers         *sqlx.Stmt `query:"purge-deleted-subscribers"`
+	GetDeletedSubscriber            *sqlx.Stmt `query:"get-deleted-subscriber"`
+	PurgeDeletedSubscriberByEmail   *sqlx.Stmt `query:"purge-deleted-subscriber-by-email"`
 	DeleteBlocklistedSubscribers    *sqlx.Stmt `query:"delete-blocklisted-subscribers"`
 	DeleteOrphanSubscribers         *sqlx.Stmt `query:"delete-orphan-subscribers"`
+	EraseSubscriber                 *sqlx.Stmt `query:"erase-subscriber"`
+	QuerySubscriberErasures         *sqlx.Stmt `query:"query-subscriber-erasures"`
+	MergeSubscribers                *sqlx.Stmt `query:"merge-subscribers"`
+	QuerySubscriberDuplicates       *sqlx.Stmt `query:"query-subscriber-duplicates"`
+	CreateSubscriberEmailChange     *sqlx.Stmt `query:"create-subscriber-email-change"`
+	GetSubscriberEmailChange        *sqlx.Stmt `query:"get-subscriber-email-change"`
+	ConfirmSubscriberEmailChange    *sqlx.Stmt `query:"confirm-subscriber-email-change"`
+	DeleteSubscriberEmailChange     *sqlx.Stmt `query:"delete-subscriber-email-change"`
+	GetSubscriberEmails             *sqlx.Stmt `query:"get-subscriber-emails"`
+	GetSubscriberEmailOwner         *sqlx.Stmt `query:"get-subscriber-email-owner"`
+	CreateSubscriberEmail           *sqlx.Stmt `query:"create-subscriber-email"`
+	VerifySubscriberEmail           *sqlx.Stmt `query:"verify-subscriber-email"`
+	SetPrimarySubscriberEmail       *sqlx.Stmt `query:"set-primary-subscriber-email"`
+	DeleteSubscriberEmail           *sqlx.Stmt `query:"delete-subscriber-email"`
+	RecordSubscriberEmailBounce     *sqlx.Stmt `query:"record-subscriber-email-bounce"`
+	CreateSubscriberJob             *sqlx.Stmt `query:"create-subscriber-job"`
+	UpdateSubscriberJob             *sqlx.Stmt `query:"update-subscriber-job"`
+	GetSubscriberJob                *sqlx.Stmt `query:"get-subscriber-job"`
+	QuerySubscriberJobs             *sqlx.Stmt `query:"query-subscriber-jobs"`
+	CreateSubscriberNote            *sqlx.Stmt `query:"create-subscriber-note"`
+	UpdateSubscriberNote            *sqlx.Stmt `query:"update-subscriber-note"`
+	DeleteSubscriberNote            *sqlx.Stmt `query:"delete-subscriber-note"`
+	QuerySubscriberNotes            *sqlx.Stmt `query:"query-subscriber-notes"`
+	GetMaxSubscriberID              *sqlx.Stmt `query:"get-max-subscriber-id"`
+	ReindexSubscriberSearch         *sqlx.Stmt `query:"reindex-subscriber-search"`
+	SetSubscriberSearchIndexed      *sqlx.Stmt `query:"set-subscriber-search-indexed"`
 	UnsubscribeByCampaign           *sqlx.Stmt `query:"unsubscribe-by-campaign"`
 	ExportSubscriberData            *sqlx.Stmt `query:"export-subscriber-data"`
 
@@ -41,20 +89,46 @@ type Queries struct {
 	QuerySubscribersCount                  string     `query:"query-subscribers-count"`
 	QuerySubscribersCountAll               *sqlx.Stmt `query:"query-subscribers-count-all"`
 	QuerySubscribersForExport              string     `query:"query-subscribers-for-export"`
+	SampleSubscribers                      string     `query:"sample-subscribers"`
 	QuerySubscribersTpl                    string     `query:"query-subscribers-template"`
 	DeleteSubscribersByQuery               string     `query:"delete-subscribers-by-query"`
+	SoftDeleteSubscribersByQuery           string     `query:"soft-delete-subscribers-by-query"`
+	RestoreSubscribersByQuery              string     `query:"restore-subscribers-by-query"`
 	AddSubscribersToListsByQuery           string     `query:"add-subscribers-to-lists-by-query"`
 	BlocklistSubscribersByQuery            string     `query:"blocklist-subscribers-by-query"`
 	DeleteSubscriptionsByQuery             string     `query:"delete-subscriptions-by-query"`
 	UnsubscribeSubscribersFromListsByQuery string     `query:"unsubscribe-subscribers-from-lists-by-query"`
+	AddSubscriberTagsByQuery               string     `query:"add-subscriber-tags-by-query"`
+	RemoveSubscriberTagsByQuery            string     `query:"remove-subscriber-tags-by-query"`
 
-	CreateList      *sqlx.Stmt `query:"create-list"`
-	QueryLists      string     `query:"query-lists"`
-	GetLists        *sqlx.Stmt `query:"get-lists"`
-	GetListsByOptin *sqlx.Stmt `query:"get-lists-by-optin"`
-	UpdateList      *sqlx.Stmt `query:"update-list"`
-	UpdateListsDate *sqlx.Stmt `query:"update-lists-date"`
-	DeleteLists     *sqlx.Stmt `query:"delete-lists"`
+	CreateList                  *sqlx.Stmt `query:"create-list"`
+	QueryLists                  string     `query:"query-lists"`
+	GetLists                    *sqlx.Stmt `query:"get-lists"`
+	GetListsByOptin             *sqlx.Stmt `query:"get-lists-by-optin"`
+	UpdateList                  *sqlx.Stmt `query:"update-list"`
+	GetDynamicLists             *sqlx.Stmt `query:"get-dynamic-lists"`
+	RefreshDynamicList          string     `query:"refresh-dynamic-list"`
+	ArchiveList                 *sqlx.Stmt `query:"archive-list"`
+	UpdateListsDate             *sqlx.Stmt `query:"update-lists-date"`
+	DeleteLists                 *sqlx.Stmt `query:"delete-lists"`
+	MergeLists                  *sqlx.Stmt `query:"merge-lists"`
+	GetListBundleSubscribers    *sqlx.Stmt `query:"get-list-bundle-subscribers"`
+	ImportListBundleSubscribers *sqlx.Stmt `query:"import-list-bundle-subscribers"`
+	RecordListSnapshots         *sqlx.Stmt `query:"record-list-snapshots"`
+	GetListSnapshots            *sqlx.Stmt `query:"get-list-snapshots"`
+	GetListStats                *sqlx.Stmt `query:"get-list-stats"`
+	GetListOptinReminderStats   *sqlx.Stmt `query:"get-list-optin-reminder-stats"`
+
+	GetListFolders   *sqlx.Stmt `query:"get-list-folders"`
+	CreateListFolder *sqlx.Stmt `query:"create-list-folder"`
+	UpdateListFolder *sqlx.Stmt `query:"update-list-folder"`
+	DeleteListFolder *sqlx.Stmt `query:"delete-list-folder"`
+
+	GetListWebhooks   *sqlx.Stmt `query:"get-list-webhooks"`
+	CreateListWebhook *sqlx.Stmt `query:"create-list-webhook"`
+	UpdateListWebhook *sqlx.Stmt `query:"update-list-webhook"`
+	DeleteListWebhook *sqlx.Stmt `query:"delete-list-webhook"`
+	NextListEvents    *sqlx.Stmt `query:"next-list-events"`
 
 	CreateCampaign        *sqlx.Stmt `query:"create-campaign"`
 	QueryCampaigns        string     `query:"query-campaigns"`
@@ -62,6 +136,9 @@ type Queries struct {
 	GetCampaignForPreview *sqlx.Stmt `query:"get-campaign-for-preview"`
 	GetCampaignStats      *sqlx.Stmt `query:"get-campaign-stats"`
 	GetCampaignStatus     *sqlx.Stmt `query:"get-campaign-status"`
+	GetCampaignProgress   *sqlx.Stmt `query:"get-campaign-progress"`
+	GetCampaignLinkClicks *sqlx.Stmt `query:"get-campaign-link-clicks"`
+	GetCampaignCosts      *sqlx.Stmt `query:"get-campaign-costs"`
 	GetArchivedCampaigns  *sqlx.Stmt `query:"get-archived-campaigns"`
 
 	// These two queries are read as strings and based on settings.individual_tracking=on/off,
@@ -74,29 +151,119 @@ type Queries struct {
 	DeleteCampaignViews        *sqlx.Stmt `query:"delete-campaign-views"`
 	DeleteCampaignLinkClicks   *sqlx.Stmt `query:"delete-campaign-link-clicks"`
 
-	NextCampaigns            *sqlx.Stmt `query:"next-campaigns"`
-	NextCampaignSubscribers  *sqlx.Stmt `query:"next-campaign-subscribers"`
-	GetOneCampaignSubscriber *sqlx.Stmt `query:"get-one-campaign-subscriber"`
-	UpdateCampaign           *sqlx.Stmt `query:"update-campaign"`
-	UpdateCampaignStatus     *sqlx.Stmt `query:"update-campaign-status"`
-	UpdateCampaignCounts     *sqlx.Stmt `query:"update-campaign-counts"`
-	UpdateCampaignArchive    *sqlx.Stmt `query:"update-campaign-archive"`
-	RegisterCampaignView     *sqlx.Stmt `query:"register-campaign-view"`
-	DeleteCampaign           *sqlx.Stmt `query:"delete-campaign"`
+	NextCampaigns             *sqlx.Stmt `query:"next-campaigns"`
+	NextCampaignSubscribers   *sqlx.Stmt `query:"next-campaign-subscribers"`
+	GetOneCampaignSubscriber  *sqlx.Stmt `query:"get-one-campaign-subscriber"`
+	GetCampaignTimezones      *sqlx.Stmt `query:"get-campaign-timezones"`
+	UpdateCampaign            *sqlx.Stmt `query:"update-campaign"`
+	UpdateCampaignStatus      *sqlx.Stmt `query:"update-campaign-status"`
+	ExpireCampaign            *sqlx.Stmt `query:"expire-campaign"`
+	UpdateCampaignCounts      *sqlx.Stmt `query:"update-campaign-counts"`
+	RewindCampaignSubscribers *sqlx.Stmt `query:"rewind-campaign-subscribers"`
+	RecordCampaignDeliveries  *sqlx.Stmt `query:"record-campaign-deliveries"`
+	GetCampaignFrequencyCap   *sqlx.Stmt `query:"get-campaign-frequency-cap"`
+	GetSubscriberSends        *sqlx.Stmt `query:"get-subscriber-sends"`
+	CountMessengerDeliveries  *sqlx.Stmt `query:"count-messenger-deliveries"`
+	AddMessengerUsage         *sqlx.Stmt `query:"add-messenger-usage"`
+	GetMessengerUsage         *sqlx.Stmt `query:"get-messenger-usage"`
+	AddDomainBlocklistHits    *sqlx.Stmt `query:"add-domain-blocklist-hits"`
+	GetDomainBlocklistHits    *sqlx.Stmt `query:"get-domain-blocklist-hits"`
+	ClearDomainBlocklistHits  *sqlx.Stmt `query:"clear-domain-blocklist-hits"`
+	GetDisposableDomains      *sqlx.Stmt `query:"get-disposable-domains"`
+	ReplaceDisposableDomains  *sqlx.Stmt `query:"replace-disposable-domains"`
+	GetCampaignDeliveries     *sqlx.Stmt `query:"get-campaign-deliveries"`
+	GetCampaignVersions       *sqlx.Stmt `query:"get-campaign-versions"`
+	GetCampaignRevisions      *sqlx.Stmt `query:"get-campaign-revisions"`
+	GetCampaignRevision       *sqlx.Stmt `query:"get-campaign-revision"`
+	InsertCampaignTest        *sqlx.Stmt `query:"insert-campaign-test"`
+	GetCampaignTests          *sqlx.Stmt `query:"get-campaign-tests"`
+	GetCampaignTags           *sqlx.Stmt `query:"get-campaign-tags"`
+	AddCampaignTag            *sqlx.Stmt `query:"add-campaign-tag"`
+	RenameCampaignTag         *sqlx.Stmt `query:"rename-campaign-tag"`
+	DeleteCampaignTag         *sqlx.Stmt `query:"delete-campaign-tag"`
+	UpdateCampaignArchive     *sqlx.Stmt `query:"update-campaign-archive"`
+	IsCampaignSubscriber      *sqlx.Stmt `query:"is-campaign-subscriber"`
+	UpdateCampaignTZBucket    *sqlx.Stmt `query:"update-campaign-tz-bucket"`
+	UpdateCampaignRollout     *sqlx.Stmt `query:"update-campaign-rollout"`
+	CountCampaignBounces      *sqlx.Stmt `query:"count-campaign-bounces"`
+	RegisterCampaignView      *sqlx.Stmt `query:"register-campaign-view"`
+	DeleteCampaign            *sqlx.Stmt `query:"delete-campaign"`
+
+	FreezeCampaignRecipients   *sqlx.Stmt `query:"freeze-campaign-recipients"`
+	UnfreezeCampaignRecipients *sqlx.Stmt `query:"unfreeze-campaign-recipients"`
+	GetCampaignRecipients      *sqlx.Stmt `query:"get-campaign-recipients"`
+	GetCampaignAudience        *sqlx.Stmt `query:"get-campaign-audience"`
+	GetSimulationSubscribers   *sqlx.Stmt `query:"get-campaign-simulation-subscribers"`
+	StartCampaignSimulation    *sqlx.Stmt `query:"start-campaign-simulation"`
+	UpdateCampaignSimulation   *sqlx.Stmt `query:"update-campaign-simulation"`
+	GetCampaignSimulation      *sqlx.Stmt `query:"get-campaign-simulation"`
+	QueryCampaignDeliveryLog   *sqlx.Stmt `query:"query-campaign-delivery-log"`
+	RetryCampaignErrors        *sqlx.Stmt `query:"retry-campaign-errors"`
+	GetCampaignEngagementRules *sqlx.Stmt `query:"get-campaign-engagement-rules"`
+	SetSubscriberAttrib        *sqlx.Stmt `query:"set-subscriber-attrib"`
 
 	InsertMedia *sqlx.Stmt `query:"insert-media"`
 	GetMedia    *sqlx.Stmt `query:"get-media"`
 	QueryMedia  *sqlx.Stmt `query:"query-media"`
 	DeleteMedia *sqlx.Stmt `query:"delete-media"`
 
-	CreateTemplate     *sqlx.Stmt `query:"create-template"`
-	GetTemplates       *sqlx.Stmt `query:"get-templates"`
-	UpdateTemplate     *sqlx.Stmt `query:"update-template"`
-	SetDefaultTemplate *sqlx.Stmt `query:"set-default-template"`
-	DeleteTemplate     *sqlx.Stmt `query:"delete-template"`
+	CreateTemplate          *sqlx.Stmt `query:"create-template"`
+	GetTemplates            *sqlx.Stmt `query:"get-templates"`
+	UpdateTemplate          *sqlx.Stmt `query:"update-template"`
+	SetDefaultTemplate      *sqlx.Stmt `query:"set-default-template"`
+	DeleteTemplate          *sqlx.Stmt `query:"delete-template"`
+	GetTemplateRevisions    *sqlx.Stmt `query:"get-template-revisions"`
+	GetTemplateRevision     *sqlx.Stmt `query:"get-template-revision"`
+	GetTemplatePartials     *sqlx.Stmt `query:"get-template-partials"`
+	CreateTemplatePartial   *sqlx.Stmt `query:"create-template-partial"`
+	UpdateTemplatePartial   *sqlx.Stmt `query:"update-template-partial"`
+	DeleteTemplatePartial   *sqlx.Stmt `query:"delete-template-partial"`
+	GetTemplatePartialUsage *sqlx.Stmt `query:"get-template-partial-usage"`
+
+	GetBuilderDoc            *sqlx.Stmt `query:"get-builder-doc"`
+	UpsertCampaignBuilderDoc *sqlx.Stmt `query:"upsert-campaign-builder-doc"`
+	UpsertTemplateBuilderDoc *sqlx.Stmt `query:"upsert-template-builder-doc"`
+	DeleteBuilderDoc         *sqlx.Stmt `query:"delete-builder-doc"`
+
+	GetSegments     *sqlx.Stmt `query:"get-segments"`
+	CreateSegment   *sqlx.Stmt `query:"create-segment"`
+	UpdateSegment   *sqlx.Stmt `query:"update-segment"`
+	DeleteSegment   *sqlx.Stmt `query:"delete-segment"`
+	RefreshSegment  string     `query:"refresh-segment"`
+	GetSegmentStats *sqlx.Stmt `query:"get-segment-stats"`
+
+	GetRSSFeeds                *sqlx.Stmt `query:"get-rss-feeds"`
+	CreateRSSFeed              *sqlx.Stmt `query:"create-rss-feed"`
+	UpdateRSSFeed              *sqlx.Stmt `query:"update-rss-feed"`
+	UpdateRSSFeedChecked       *sqlx.Stmt `query:"update-rss-feed-checked"`
+	DeleteRSSFeed              *sqlx.Stmt `query:"delete-rss-feed"`
+	InsertRSSFeedItems         *sqlx.Stmt `query:"insert-rss-feed-items"`
+	UpdateRSSFeedItemsCampaign *sqlx.Stmt `query:"update-rss-feed-items-campaign"`
+
+	GetCRMSyncs       *sqlx.Stmt `query:"get-crm-syncs"`
+	CreateCRMSync     *sqlx.Stmt `query:"create-crm-sync"`
+	UpdateCRMSync     *sqlx.Stmt `query:"update-crm-sync"`
+	UpdateCRMSyncRan  *sqlx.Stmt `query:"update-crm-sync-ran"`
+	DeleteCRMSync     *sqlx.Stmt `query:"delete-crm-sync"`
+	GetCRMSyncChanges *sqlx.Stmt `query:"get-crm-sync-changes"`
+	UpsertCRMContact  *sqlx.Stmt `query:"upsert-crm-contact"`
+
+	GetSubscriptionForms       *sqlx.Stmt `query:"get-subscription-forms"`
+	CreateSubscriptionForm     *sqlx.Stmt `query:"create-subscription-form"`
+	UpdateSubscriptionForm     *sqlx.Stmt `query:"update-subscription-form"`
+	DeleteSubscriptionForm     *sqlx.Stmt `query:"delete-subscription-form"`
+	GetSubscriptionFormStats   *sqlx.Stmt `query:"get-subscription-form-stats"`
+	RecordSubscriptionFormStat *sqlx.Stmt `query:"record-subscription-form-stat"`
+
+	GetAPITokens   *sqlx.Stmt `query:"get-api-tokens"`
+	CreateAPIToken *sqlx.Stmt `query:"create-api-token"`
+	UpdateAPIToken *sqlx.Stmt `query:"update-api-token"`
+	DeleteAPIToken *sqlx.Stmt `query:"delete-api-token"`
+	AuthAPIToken   *sqlx.Stmt `query:"auth-api-token"`
 
 	CreateLink        *sqlx.Stmt `query:"create-link"`
 	RegisterLinkClick *sqlx.Stmt `query:"register-link-click"`
+	GetLinkURL        *sqlx.Stmt `query:"get-link-url"`
 
 	GetSettings    *sqlx.Stmt `query:"get-settings"`
 	UpdateSettings *sqlx.Stmt `query:"update-settings"`
@@ -104,6 +271,7 @@ type Queries struct {
 	// GetStats *sqlx.Stmt `query:"get-stats"`
 	RecordBounce              *sqlx.Stmt `query:"record-bounce"`
 	QueryBounces              string     `query:"query-bounces"`
+	GetBounceAuthStats        *sqlx.Stmt `query:"get-bounce-auth-stats"`
 	DeleteBounces             *sqlx.Stmt `query:"delete-bounces"`
 	DeleteBouncesBySubscriber *sqlx.Stmt `query:"delete-bounces-by-subscriber"`
 	GetDBInfo                 string     `query:"get-db-info"`
@@ -8,38 +8,97 @@ type Settings struct {
 	AppFaviconURL                 string   `json:"app.favicon_url"`
 	AppFromEmail                  string   `json:"app.from_email"`
 	AppNotifyEmails               []string `json:"app.notify_emails"`
+	AppSeedEmails                 []string `json:"app.seed_emails"`
 	EnablePublicSubPage           bool     `json:"app.enable_public_subscription_page"`
 	EnablePublicArchive           bool     `json:"app.enable_public_archive"`
 	EnablePublicArchiveRSSContent bool     `json:"app.enable_public_archive_rss_content"`
 	SendOptinConfirmation         bool     `json:"app.send_optin_confirmation"`
 	CheckUpdates                  bool     `json:"app.check_updates"`
 	AppLang                       string   `json:"app.lang"`
+	AppDefaultTimezone            string   `json:"app.default_timezone"`
+	AppMaxAttachmentSize          int      `json:"app.max_attachment_size"`
+	AppSearchAttribs              []string `json:"app.search_attribs"`
+	AppMJMLURL                    string   `json:"app.mjml_url"`
+	AppMJMLUsername               string   `json:"app.mjml_username"`
+	AppMJMLPassword               string   `json:"app.mjml_password,omitempty"`
+	AppMJMLTimeout                string   `json:"app.mjml_timeout"`
+	AppTemplateLintBlock          bool     `json:"app.template_lint_block"`
+	AppTemplateGalleryURL         string   `json:"app.template_gallery_url"`
+
+	AppTestListID   int `json:"app.test_list_id"`
+	AppTestVariants []struct {
+		Name          string   `json:"name"`
+		SubjectPrefix string   `json:"subject_prefix"`
+		Emails        []string `json:"emails"`
+	} `json:"app.test_variants"`
+	AppAttribSchema   []AttribField   `json:"app.attrib_schema"`
+	AppAttribTriggers []AttribTrigger `json:"app.attrib_triggers"`
 
 	AppBatchSize             int    `json:"app.batch_size"`
 	AppConcurrency           int    `json:"app.concurrency"`
 	AppMaxSendErrors         int    `json:"app.max_send_errors"`
+	AppFailoverErrors        int    `json:"app.failover_errors"`
 	AppMessageRate           int    `json:"app.message_rate"`
 	CacheSlowQueries         bool   `json:"app.cache_slow_queries"`
 	CacheSlowQueriesInterval string `json:"app.cache_slow_queries_interval"`
+	AppDomainLimits          []struct {
+		Domain   string `json:"domain"`
+		Rate     int    `json:"rate"`
+		Duration string `json:"duration"`
+	} `json:"app.domain_limits"`
+	AppMessengerQuotas []struct {
+		Messenger string `json:"messenger"`
+		Daily     int    `json:"daily"`
+		Monthly   int    `json:"monthly"`
+		Action    string `json:"action"`
+	} `json:"app.messenger_quotas"`
+	AppFrequencyCapDaily  int    `json:"app.frequency_cap_daily"`
+	AppFrequencyCapWeekly int    `json:"app.frequency_cap_weekly"`
+	AppFrequencyCapAction string `json:"app.frequency_cap_action"`
+	AppQuietHoursStart    string `json:"app.quiet_hours_start"`
+	AppQuietHoursEnd      string `json:"app.quiet_hours_end"`
+
+	CostCurrency   string  `json:"costs.currency"`
+	CostDefault    float64 `json:"costs.default"`
+	CostMessengers []struct {
+		Messenger  string  `json:"messenger"`
+		Cost       float64 `json:"cost"`
+		PerSegment bool    `json:"per_segment"`
+	} `json:"costs.messengers"`
 
 	AppMessageSlidingWindow         bool   `json:"app.message_sliding_window"`
 	AppMessageSlidingWindowDuration string `json:"app.message_sliding_window_duration"`
 	AppMessageSlidingWindowRate     int    `json:"app.message_sliding_window_rate"`
 
-	PrivacyIndividualTracking bool     `json:"privacy.individual_tracking"`
-	PrivacyUnsubHeader        bool     `json:"privacy.unsubscribe_header"`
-	PrivacyAllowBlocklist     bool     `json:"privacy.allow_blocklist"`
-	PrivacyAllowPreferences   bool     `json:"privacy.allow_preferences"`
-	PrivacyAllowExport        bool     `json:"privacy.allow_export"`
-	PrivacyAllowWipe          bool     `json:"privacy.allow_wipe"`
-	PrivacyExportable         []string `json:"privacy.exportable"`
-	PrivacyRecordOptinIP      bool     `json:"privacy.record_optin_ip"`
-	DomainBlocklist           []string `json:"privacy.domain_blocklist"`
+	PrivacyIndividualTracking     bool     `json:"privacy.individual_tracking"`
+	PrivacyUnsubHeader            bool     `json:"privacy.unsubscribe_header"`
+	PrivacyAllowBlocklist         bool     `json:"privacy.allow_blocklist"`
+	PrivacyAllowPreferences       bool     `json:"privacy.allow_preferences"`
+	PrivacyFrequencies            []string `json:"privacy.frequencies"`
+	PrivacyTopics                 []string `json:"privacy.topics"`
+	PrivacyAllowExport            bool     `json:"privacy.allow_export"`
+	PrivacyAllowWipe              bool     `json:"privacy.allow_wipe"`
+	PrivacyExportable             []string `json:"privacy.exportable"`
+	PrivacyRecordOptinIP          bool     `json:"privacy.record_optin_ip"`
+	PrivacySoftDelete             bool     `json:"privacy.soft_delete"`
+	PrivacySoftDeletePurgeDays    int      `json:"privacy.soft_delete_purge_days"`
+	PrivacyHygieneUnconfirmedDays int      `json:"privacy.hygiene_unconfirmed_days"`
+	PrivacyHygieneUnengagedMonths int      `json:"privacy.hygiene_unengaged_months"`
+	PrivacyHygieneBlocklistedDays int      `json:"privacy.hygiene_blocklisted_days"`
+	PrivacyBlockDisposableEmails  bool     `json:"privacy.block_disposable_emails"`
+	PrivacyDisposableDomainsURL   string   `json:"privacy.disposable_domains_url"`
+	DomainBlocklist               []string `json:"privacy.domain_blocklist"`
+	PrivacyTrackingDomains        []string `json:"privacy.tracking_domains"`
 
 	SecurityEnableCaptcha bool   `json:"security.enable_captcha"`
 	SecurityCaptchaKey    string `json:"security.captcha_key"`
 	SecurityCaptchaSecret string `json:"security.captcha_secret"`
 
+	SecurityScanAttachments bool   `json:"security.scan_attachments"`
+	SecurityScanType        string `json:"security.scan_type"`
+	SecurityScanURL         string `json:"security.scan_url"`
+	SecurityScanTimeout     string `json:"security.scan_timeout"`
+
 	UploadProvider             string   `json:"upload.provider"`
 	UploadExtensions           []string `json:"upload.extensions"`
 	UploadFilesystemUploadPath string   `json:"upload.filesystem.upload_path"`
@@ -58,6 +117,7 @@ type Settings struct {
 	SMTP []struct {
 		UUID          string              `json:"uuid"`
 		Enabled       bool                `json:"enabled"`
+		Name          string              `json:"name"`
 		Host          string              `json:"host"`
 		HelloHostname string              `json:"hello_hostname"`
 		Port          int                 `json:"port"`
@@ -67,10 +127,18 @@ type Settings struct {
 		EmailHeaders  []map[string]string `json:"email_headers"`
 		MaxConns      int                 `json:"max_conns"`
 		MaxMsgRetries int                 `json:"max_msg_retries"`
+		MaxAttachSize int                 `json:"max_attachment_size"`
 		IdleTimeout   string              `json:"idle_timeout"`
 		WaitTimeout   string              `json:"wait_timeout"`
 		TLSType       string              `json:"tls_type"`
 		TLSSkipVerify bool                `json:"tls_skip_verify"`
+
+		// Daily send volume ramp for warming up a new IP.
+		Warmup struct {
+			Enabled  bool   `json:"enabled"`
+			Start    string `json:"start"`
+			Schedule []int  `json:"schedule"`
+		} `json:"warmup"`
 	} `json:"smtp"`
 
 	Messengers []struct {
@@ -83,8 +151,19 @@ type Settings struct {
 		MaxConns      int    `json:"max_conns"`
 		Timeout       string `json:"timeout"`
 		MaxMsgRetries int    `json:"max_msg_retries"`
+		MaxAttachSize int    `json:"max_attachment_size"`
+		Channel       string `json:"channel"`
 	} `json:"messengers"`
 
+	Webhooks []struct {
+		UUID    string   `json:"uuid"`
+		Enabled bool     `json:"enabled"`
+		Name    string   `json:"name"`
+		URL     string   `json:"url"`
+		Events  []string `json:"events"`
+		Secret  string   `json:"secret,omitempty"`
+	} `json:"webhooks"`
+
 	BounceEnabled        bool `json:"bounce.enabled"`
 	BounceEnableWebhooks bool `json:"bounce.webhooks_enabled"`
 	BounceActions        map[string]struct {
@@ -1,17 +1,21 @@
 
 -- subscribers
 -- name: get-subscriber
--- Get a single subscriber by id or UUID or email.
+-- Get a single subscriber by id or UUID or email or external ID. Soft-deleted subscribers are excluded.
+-- Subscribers are also found by their verified alternate e-mails.
 SELECT * FROM subscribers WHERE
     CASE
         WHEN $1 > 0 THEN id = $1
         WHEN $2 != '' THEN uuid = $2::UUID
-        WHEN $3 != '' THEN email = $3
-    END;
+        WHEN $3 != '' THEN (email = $3 OR id = (
+            SELECT subscriber_id FROM subscriber_emails WHERE LOWER(email) = LOWER($3) AND verified_at IS NOT NULL
+        ))
+        WHEN $4 != '' THEN external_id = $4
+    END AND status != 'deleted';
 
 -- name: get-subscribers-by-emails
 -- Get subscribers by emails.
-SELECT * FROM subscribers WHERE email=ANY($1);
+SELECT * FROM subscribers WHERE email=ANY($1) AND status != 'deleted';
 
 -- name: get-subscriber-lists
 WITH sub AS (
@@ -25,10 +29,66 @@ SELECT * FROM lists
           WHEN CARDINALITY($4::UUID[]) > 0 THEN uuid = ANY($4::UUID[])
           ELSE TRUE
     END)
-    AND (CASE WHEN $5 != '' THEN subscriber_lists.status = $5::subscription_status ELSE TRUE END)
-    AND (CASE WHEN $6 != '' THEN lists.optin = $6::list_optin ELSE TRUE END)
+    -- Unsubscribed subscriptions that are being rejoined await opt-in like unconfirmed ones
+    -- irrespective of the lists' opt-in.
+    AND (CASE WHEN $5 != '' THEN subscriber_lists.status = $5::subscription_status
+            OR ($5 = 'unconfirmed' AND subscriber_lists.status = 'unsubscribed' AND subscriber_lists.meta->>'resubscribe' IS NOT NULL)
+        ELSE TRUE END)
+    AND (CASE WHEN $6 != '' THEN lists.optin = $6::list_optin
+            OR ($5 = 'unconfirmed' AND subscriber_lists.status = 'unsubscribed' AND subscriber_lists.meta->>'resubscribe' IS NOT NULL)
+        ELSE TRUE END)
     ORDER BY id;
 
+-- name: get-subscriber-engagement
+-- Returns the view and click counts and the last engagement time of the given subscribers
+-- across all campaigns in the same order as the given subscriber IDs.
+SELECT s.id AS subscriber_id,
+    (SELECT COUNT(*) FROM campaign_views WHERE subscriber_id = s.id) AS views,
+    (SELECT COUNT(*) FROM link_clicks WHERE subscriber_id = s.id) AS clicks,
+    GREATEST(
+        (SELECT MAX(created_at) FROM campaign_views WHERE subscriber_id = s.id),
+        (SELECT MAX(created_at) FROM link_clicks WHERE subscriber_id = s.id)
+    ) AS last_engaged_at
+FROM UNNEST($1::INT[]) WITH ORDINALITY AS s(id, n) ORDER BY s.n;
+
+-- name: query-subscriber-campaigns
+-- Campaigns whose messages were sent to a subscriber, latest first, with when they
+-- first viewed them and clicked links in them.
+SELECT COUNT(*) OVER () AS total, d.campaign_id, campaigns.uuid AS campaign_uuid,
+    campaigns.name, campaigns.subject, d.messenger, d.status, d.content_version, d.created_at AS sent_at,
+    v.viewed_at, l.clicked_at, v.viewed_at IS NOT NULL AS viewed, l.clicked_at IS NOT NULL AS clicked
+    FROM campaign_deliveries d
+    JOIN campaigns ON (campaigns.id = d.campaign_id)
+    LEFT JOIN LATERAL (
+        SELECT MIN(created_at) AS viewed_at FROM campaign_views
+        WHERE campaign_id = d.campaign_id AND subscriber_id = d.subscriber_id
+    ) v ON TRUE
+    LEFT JOIN LATERAL (
+        SELECT MIN(created_at) AS clicked_at FROM link_clicks
+        WHERE campaign_id = d.campaign_id AND subscriber_id = d.subscriber_id
+    ) l ON TRUE
+    WHERE d.subscriber_id = $1 AND d.status = ANY('{sent, bounced}')
+    ORDER BY d.created_at DESC, d.id DESC OFFSET $2 LIMIT $3;
+
+-- name: get-subscriber-consents
+-- The lists pseudofield has the IDs and names of the lists that were consented to.
+SELECT subscriber_consents.*, COALESCE((
+        SELECT JSON_AGG(JSON_BUILD_OBJECT('id', id, 'name', name) ORDER BY id) FROM lists
+        WHERE id = ANY(subscriber_consents.list_ids)
+    ), '[]') AS lists
+    FROM subscriber_consents WHERE subscriber_id = $1 ORDER BY id DESC;
+
+-- name: insert-subscriber-consent
+-- Records the consent of the subscriber $1 to their subscriptions to the lists $3.
+INSERT INTO subscriber_consents (subscriber_id, type, list_ids, ip, user_agent, source, url)
+    SELECT subscribers.id, $2, ARRAY(
+        SELECT list_id FROM subscriber_lists
+        LEFT JOIN lists ON (lists.id = subscriber_lists.list_id)
+        WHERE subscriber_lists.subscriber_id = subscribers.id AND lists.uuid = ANY($3::UUID[])
+        ORDER BY list_id
+    ), $4, $5, $6, $7
+    FROM subscribers WHERE subscribers.uuid = $1;
+
 -- name: get-subscriber-lists-lazy
 -- Get lists associations of subscribers given a list of subscriber IDs.
 -- This query is used to lazy load given a list of subscriber IDs.
@@ -76,8 +136,8 @@ SELECT lists.*,
 
 -- name: insert-subscriber
 WITH sub AS (
-    INSERT INTO subscribers (uuid, email, name, status, attribs)
-    VALUES($1, $2, $3, $4, $5)
+    INSERT INTO subscribers (uuid, email, name, status, attribs, tags, channels, external_id, locale, timezone)
+    VALUES($1, $2, $3, $4, $5, COALESCE($9::VARCHAR(100)[], '{}'), COALESCE($10::JSONB, '{}'), NULLIF($11, ''), $12, $13)
     RETURNING id, status
 ),
 listIDs AS (
@@ -103,21 +163,35 @@ subs AS (
 SELECT id from sub;
 
 -- name: upsert-subscriber
--- Upserts a subscriber where existing subscribers get their names and attributes overwritten.
--- If $7 = true, update values, otherwise, skip.
-WITH sub AS (
-    INSERT INTO subscribers as s (uuid, email, name, attribs, status)
-    VALUES($1, $2, $3, $4, 'enabled')
+-- Upserts a subscriber where existing subscribers get their names and attributes overwritten,
+-- and their locales and timezones if $9 and $10 aren't empty. If $7 = true, update values, otherwise, skip. The strategy $8 decides what happens
+-- to new and existing subscribers: 'update_only' skips new subscribers and 'skip_existing'
+-- leaves existing subscribers untouched, in which case no row is returned.
+-- E-mails that are the verified alternate e-mails of subscribers update those subscribers.
+WITH em AS (
+    SELECT COALESCE((
+        SELECT subscribers.email FROM subscriber_emails
+        JOIN subscribers ON (subscribers.id = subscriber_emails.subscriber_id)
+        WHERE LOWER(subscriber_emails.email) = LOWER($2) AND subscriber_emails.verified_at IS NOT NULL
+    ), $2::TEXT) AS email
+),
+sub AS (
+    INSERT INTO subscribers as s (uuid, email, name, attribs, status, locale, timezone)
+    SELECT $1::UUID, (SELECT email FROM em), $3::TEXT, $4::JSONB, 'enabled', $9::TEXT, $10::TEXT
+    WHERE $8 != 'update_only' OR EXISTS (SELECT 1 FROM subscribers WHERE email = (SELECT email FROM em))
     ON CONFLICT (email)
     DO UPDATE SET
         name=(CASE WHEN $7 THEN $3 ELSE s.name END),
         attribs=(CASE WHEN $7 THEN $4 ELSE s.attribs END),
+        locale=(CASE WHEN $7 AND $9 != '' THEN $9 ELSE s.locale END),
+        timezone=(CASE WHEN $7 AND $10 != '' THEN $10 ELSE s.timezone END),
         updated_at=NOW()
+    WHERE $8 != 'skip_existing'
     RETURNING uuid, id
 ),
 subs AS (
     INSERT INTO subscriber_lists (subscriber_id, list_id, status)
-    VALUES((SELECT id FROM sub), UNNEST($5::INT[]), $6)
+    SELECT sub.id, UNNEST($5::INT[]), $6::subscription_status FROM sub
     ON CONFLICT (subscriber_id, list_id) DO UPDATE
     SET updated_at=NOW(), status=(CASE WHEN $7 THEN $6 ELSE subscriber_lists.status END)
 )
@@ -129,8 +203,8 @@ SELECT uuid, id from sub;
 -- existing subscriptions are marked as 'unsubscribed'.
 -- This is used in the bulk importer.
 WITH sub AS (
-    INSERT INTO subscribers (uuid, email, name, attribs, status)
-    VALUES($1, $2, $3, $4, 'blocklisted')
+    INSERT INTO subscribers (uuid, email, name, attribs, status, locale, timezone)
+    VALUES($1, $2, $3, $4, 'blocklisted', $5, $6)
     ON CONFLICT (email) DO UPDATE SET status='blocklisted', updated_at=NOW()
     RETURNING id
 )
@@ -138,23 +212,35 @@ UPDATE subscriber_lists SET status='unsubscribed', updated_at=NOW()
     WHERE subscriber_id = (SELECT id FROM sub);
 
 -- name: update-subscriber
+-- Tags and channels are left as they are if $6 and $7 are NULL, and the external ID if $8 is empty.
 UPDATE subscribers SET
     email=(CASE WHEN $2 != '' THEN $2 ELSE email END),
     name=(CASE WHEN $3 != '' THEN $3 ELSE name END),
     status=(CASE WHEN $4 != '' THEN $4::subscriber_status ELSE status END),
     attribs=(CASE WHEN $5 != '' THEN $5::JSONB ELSE attribs END),
+    tags=COALESCE($6::VARCHAR(100)[], tags),
+    channels=COALESCE($7::JSONB, channels),
+    external_id=COALESCE(NULLIF($8, ''), external_id),
+    locale=$9,
+    timezone=$10,
     updated_at=NOW()
 WHERE id = $1;
 
 -- name: update-subscriber-with-lists
 -- Updates a subscriber's data, and given a list of list_ids, inserts subscriptions
--- for them while deleting existing subscriptions not in the list.
+-- for them while deleting existing subscriptions not in the list. Tags and channels are
+-- left as they are if $10 and $11 are NULL, and the external ID if $12 is empty.
 WITH s AS (
     UPDATE subscribers SET
         email=(CASE WHEN $2 != '' THEN $2 ELSE email END),
         name=(CASE WHEN $3 != '' THEN $3 ELSE name END),
         status=(CASE WHEN $4 != '' THEN $4::subscriber_status ELSE status END),
         attribs=(CASE WHEN $5 != '' THEN $5::JSONB ELSE attribs END),
+        tags=COALESCE($10::VARCHAR(100)[], tags),
+        channels=COALESCE($11::JSONB, channels),
+        external_id=COALESCE(NULLIF($12, ''), external_id),
+        locale=$13,
+        timezone=$14,
         updated_at=NOW()
     WHERE id = $1 RETURNING id
 ),
@@ -188,6 +274,35 @@ INSERT INTO subscriber_lists (subscriber_id, list_id, status)
 -- Delete one or more subscribers by ID or UUID.
 DELETE FROM subscribers WHERE CASE WHEN ARRAY_LENGTH($1::INT[], 1) > 0 THEN id = ANY($1) ELSE uuid = ANY($2::UUID[]) END;
 
+-- name: soft-delete-subscribers
+-- Soft-deletes one or more subscribers by ID, retaining their data and subscriptions so that
+-- they can be restored. Subscribers that are already soft-deleted are deleted permanently.
+WITH subs AS (
+    SELECT id, status FROM subscribers WHERE id = ANY($1::INT[])
+),
+del AS (
+    DELETE FROM subscribers WHERE id = ANY(SELECT id FROM subs WHERE status = 'deleted')
+)
+UPDATE subscribers SET status='deleted', restore_status=status, deleted_at=NOW(), updated_at=NOW()
+    WHERE id = ANY(SELECT id FROM subs WHERE status != 'deleted');
+
+-- name: restore-subscribers
+-- Restores soft-deleted subscribers to the status they had before they were deleted.
+UPDATE subscribers SET status=COALESCE(restore_status, 'enabled'), restore_status=NULL, deleted_at=NULL, updated_at=NOW()
+    WHERE id = ANY($1::INT[]) AND status = 'deleted';
+
+-- name: purge-deleted-subscribers
+-- Permanently deletes the subscribers that were soft-deleted more than $1 days ago.
+DELETE FROM subscribers WHERE status = 'deleted' AND deleted_at < NOW() - MAKE_INTERVAL(days => $1);
+
+-- name: get-deleted-subscriber
+-- Returns the ID of the soft-deleted subscriber whose e-mail is $1, if there's one.
+SELECT id FROM subscribers WHERE LOWER(email) = LOWER($1) AND status = 'deleted';
+
+-- name: purge-deleted-subscriber-by-email
+-- Permanently deletes the soft-deleted subscriber whose e-mail is $1, if there's one.
+DELETE FROM subscribers WHERE LOWER(email) = LOWER($1) AND status = 'deleted';
+
 -- name: delete-blocklisted-subscribers
 DELETE FROM subscribers WHERE status = 'blocklisted';
 
@@ -195,6 +310,331 @@ DELETE FROM subscribers WHERE status = 'blocklisted';
 DELETE FROM subscribers a WHERE NOT EXISTS
     (SELECT 1 FROM subscriber_lists b WHERE b.subscriber_id = a.id);
 
+-- name: erase-subscriber
+-- Irreversibly anonymizes a subscriber and records the erasure. The profile is scrubbed
+-- and given a new UUID ($2), subscriptions are deleted, and campaign views, link clicks,
+-- deliveries, and frozen recipients are unlinked from it, retaining the aggregate counts.
+-- Bounces remain on the anonymous record for the campaign bounce rates, with their meta scrubbed.
+-- Admin notes, consent records, alternate e-mails, and pending e-mail changes on it are deleted.
+WITH sub AS (
+    UPDATE subscribers SET uuid=$2::UUID, email=$2::TEXT || '@erased.invalid', name='', attribs='{}', tags='{}',
+        external_id=NULL, channels='{}', locale='', timezone='',
+        status='blocklisted', engagement_score=0, engagement_updated_at=NULL, updated_at=NOW()
+    WHERE id = $1
+    RETURNING id
+),
+subs AS (
+    DELETE FROM subscriber_lists WHERE subscriber_id = (SELECT id FROM sub) RETURNING 1
+),
+views AS (
+    UPDATE campaign_views SET subscriber_id=NULL WHERE subscriber_id = (SELECT id FROM sub) RETURNING 1
+),
+clicks AS (
+    UPDATE link_clicks SET subscriber_id=NULL WHERE subscriber_id = (SELECT id FROM sub) RETURNING 1
+),
+deliveries AS (
+    UPDATE campaign_deliveries SET subscriber_id=NULL WHERE subscriber_id = (SELECT id FROM sub) RETURNING 1
+),
+recipients AS (
+    UPDATE campaign_recipients SET subscriber_id=NULL, email='' WHERE subscriber_id = (SELECT id FROM sub)
+),
+bounces AS (
+    UPDATE bounces SET meta='{}' WHERE subscriber_id = (SELECT id FROM sub) RETURNING 1
+),
+notes AS (
+    DELETE FROM subscriber_notes WHERE subscriber_id = (SELECT id FROM sub)
+),
+consents AS (
+    DELETE FROM subscriber_consents WHERE subscriber_id = (SELECT id FROM sub)
+),
+emails AS (
+    DELETE FROM subscriber_emails WHERE subscriber_id = (SELECT id FROM sub)
+),
+emailChanges AS (
+    DELETE FROM subscriber_email_changes WHERE subscriber_id = (SELECT id FROM sub)
+),
+sims AS (
+    UPDATE campaign_simulations SET error_samples=(
+        SELECT COALESCE(JSONB_AGG(e), '[]') FROM JSONB_ARRAY_ELEMENTS(error_samples) e
+        WHERE (e->>'subscriber_id')::INT != (SELECT id FROM sub)
+    )
+    WHERE error_samples @> JSONB_BUILD_ARRAY(JSONB_BUILD_OBJECT('subscriber_id', (SELECT id FROM sub)))
+)
+INSERT INTO subscriber_erasures (subscriber_id, reason, erased_by, subscriptions, views, clicks, deliveries, bounces)
+    SELECT id, $3, $4, (SELECT COUNT(*) FROM subs), (SELECT COUNT(*) FROM views), (SELECT COUNT(*) FROM clicks),
+        (SELECT COUNT(*) FROM deliveries), (SELECT COUNT(*) FROM bounces)
+    FROM sub
+    RETURNING *;
+
+-- name: query-subscriber-erasures
+SELECT COUNT(*) OVER () AS total, * FROM subscriber_erasures
+    ORDER BY created_at DESC OFFSET $1 LIMIT (CASE WHEN $2 < 1 THEN NULL ELSE $2 END);
+
+-- name: merge-subscribers
+-- Merges the subscribers $2 into the subscriber $1 and deletes them. Subscriptions are combined with
+-- the earliest subscription date and the strongest status (unsubscribed over confirmed over unconfirmed).
+-- Top-level attribs and channel identities are combined with $1's keys taking precedence over those
+-- of the most recently updated subscribers, and tags are combined. $1's external ID is retained, or
+-- taken from the most recently updated subscriber that has one. The most restrictive subscriber status
+-- is retained, other than the deleted status of $2, and the decayed engagement scores are added up. Campaign views, link clicks, deliveries, bounces, frozen campaign recipients,
+-- segment memberships, notes, consent records, and alternate e-mails are moved over to $1, and the
+-- primary e-mails of $2 are added to $1 as verified alternate e-mails.
+WITH target AS (
+    SELECT id FROM subscribers WHERE id = $1 AND NOT (id = ANY($2::INT[]))
+),
+srcs AS (
+    SELECT id FROM subscribers WHERE id = ANY($2::INT[]) AND EXISTS (SELECT 1 FROM target)
+),
+subs AS (
+    INSERT INTO subscriber_lists (subscriber_id, list_id, meta, status, created_at, updated_at)
+        SELECT (SELECT id FROM target), list_id, (ARRAY_AGG(meta ORDER BY updated_at DESC))[1],
+            MAX(status), MIN(created_at), NOW()
+        FROM subscriber_lists WHERE subscriber_id IN (SELECT id FROM srcs) GROUP BY list_id
+    ON CONFLICT (subscriber_id, list_id) DO UPDATE SET status = GREATEST(subscriber_lists.status, EXCLUDED.status),
+        created_at = LEAST(subscriber_lists.created_at, EXCLUDED.created_at), updated_at = NOW()
+),
+attribs AS (
+    SELECT COALESCE(JSONB_OBJECT_AGG(a.key, a.value), '{}') AS attribs FROM (
+        SELECT DISTINCT ON (kv.key) kv.key, kv.value FROM subscribers s, JSONB_EACH(s.attribs) kv
+        WHERE s.id IN (SELECT id FROM target UNION ALL SELECT id FROM srcs)
+        ORDER BY kv.key, (s.id = $1) DESC, s.updated_at DESC
+    ) a
+),
+channels AS (
+    SELECT COALESCE(JSONB_OBJECT_AGG(c.key, c.value), '{}') AS channels FROM (
+        SELECT DISTINCT ON (kv.key) kv.key, kv.value FROM subscribers s, JSONB_EACH(s.channels) kv
+        WHERE s.id IN (SELECT id FROM target UNION ALL SELECT id FROM srcs)
+        ORDER BY kv.key, (s.id = $1) DESC, s.updated_at DESC
+    ) c
+),
+-- The subscribers are deleted before $1 takes over an external ID of theirs, which is unique.
+del AS (
+    DELETE FROM subscribers WHERE id IN (SELECT id FROM srcs) RETURNING external_id, updated_at
+),
+sub AS (
+    UPDATE subscribers SET attribs = (SELECT attribs FROM attribs),
+        channels = (SELECT channels FROM channels),
+        external_id = COALESCE(subscribers.external_id, (SELECT d.external_id FROM del d
+            WHERE d.external_id IS NOT NULL ORDER BY d.updated_at DESC LIMIT 1)),
+        name = (CASE WHEN subscribers.name != '' THEN subscribers.name ELSE COALESCE(
+            (SELECT s.name FROM subscribers s WHERE s.id IN (SELECT id FROM srcs) AND s.name != ''
+                ORDER BY s.updated_at DESC LIMIT 1), '') END),
+        status = (SELECT MAX(s.status) FROM subscribers s WHERE s.id IN (SELECT id FROM target)
+            OR (s.id IN (SELECT id FROM srcs) AND s.status != 'deleted')),
+        engagement_score = (SELECT COALESCE(SUM(s.engagement_score * POWER(0.5,
+            EXTRACT(EPOCH FROM NOW() - s.engagement_updated_at) / (30 * 86400))), 0)
+            FROM subscribers s WHERE s.id IN (SELECT id FROM target UNION ALL SELECT id FROM srcs)),
+        engagement_updated_at = NOW(),
+        tags = ARRAY(SELECT DISTINCT t FROM subscribers s, UNNEST(s.tags) t
+            WHERE s.id IN (SELECT id FROM target UNION ALL SELECT id FROM srcs) ORDER BY t),
+        updated_at = NOW()
+    WHERE id = (SELECT id FROM target)
+    RETURNING id
+),
+views AS (
+    UPDATE campaign_views SET subscriber_id = (SELECT id FROM target) WHERE subscriber_id IN (SELECT id FROM srcs)
+),
+clicks AS (
+    UPDATE link_clicks SET subscriber_id = (SELECT id FROM target) WHERE subscriber_id IN (SELECT id FROM srcs)
+),
+deliveries AS (
+    UPDATE campaign_deliveries SET subscriber_id = (SELECT id FROM target) WHERE subscriber_id IN (SELECT id FROM srcs)
+),
+bounces AS (
+    UPDATE bounces SET subscriber_id = (SELECT id FROM target) WHERE subscriber_id IN (SELECT id FROM srcs)
+),
+-- A subscriber can only be a campaign's recipient once. The rest are unlinked on deletion.
+recipients AS (
+    UPDATE campaign_recipients SET subscriber_id = (SELECT id FROM target) WHERE id IN (
+        SELECT DISTINCT ON (r.campaign_id) r.id FROM campaign_recipients r
+        WHERE r.subscriber_id IN (SELECT id FROM srcs) AND NOT EXISTS (
+            SELECT 1 FROM campaign_recipients WHERE campaign_id = r.campaign_id AND subscriber_id = $1
+        )
+        ORDER BY r.campaign_id, r.id
+    )
+),
+segs AS (
+    INSERT INTO segment_subscribers (segment_id, subscriber_id)
+        SELECT DISTINCT segment_id, (SELECT id FROM target) FROM segment_subscribers
+        WHERE subscriber_id IN (SELECT id FROM srcs)
+    ON CONFLICT DO NOTHING
+),
+notes AS (
+    UPDATE subscriber_notes SET subscriber_id = (SELECT id FROM target) WHERE subscriber_id IN (SELECT id FROM srcs)
+),
+consents AS (
+    UPDATE subscriber_consents SET subscriber_id = (SELECT id FROM target) WHERE subscriber_id IN (SELECT id FROM srcs)
+),
+emails AS (
+    UPDATE subscriber_emails SET subscriber_id = (SELECT id FROM target) WHERE subscriber_id IN (SELECT id FROM srcs)
+),
+primaryEmails AS (
+    INSERT INTO subscriber_emails (subscriber_id, email, verified_at)
+        SELECT (SELECT id FROM target), email, NOW() FROM subscribers WHERE id IN (SELECT id FROM srcs)
+    ON CONFLICT DO NOTHING
+)
+SELECT id FROM sub;
+
+-- name: query-subscriber-duplicates
+-- Returns groups of likely duplicate subscribers that share an e-mail or, if $1 = 'name', a name.
+-- E-mails are compared case-insensitively without the +tag in the local part and the dots
+-- in Gmail addresses, which Gmail ignores.
+WITH subs AS (
+    SELECT id, uuid, email, name, status, created_at, (CASE
+        WHEN $1 = 'name' THEN LOWER(TRIM(name))
+        WHEN email_domain IN ('gmail.com', 'googlemail.com') THEN REPLACE(email_local, '.', '') || '@gmail.com'
+        ELSE email_local || '@' || email_domain
+    END) AS key
+    FROM (
+        SELECT *, REGEXP_REPLACE(SPLIT_PART(LOWER(email), '@', 1), '\+.*$', '') AS email_local,
+            SPLIT_PART(LOWER(email), '@', 2) AS email_domain
+        FROM subscribers WHERE status != 'deleted'
+    ) s
+)
+SELECT COUNT(*) OVER () AS total, key, JSON_AGG(JSON_BUILD_OBJECT('id', id, 'uuid', uuid, 'email', email,
+    'name', name, 'status', status, 'created_at', created_at) ORDER BY created_at) AS subscribers
+    FROM subs WHERE key != '' GROUP BY key HAVING COUNT(*) > 1
+    ORDER BY COUNT(*) DESC, key OFFSET $2 LIMIT (CASE WHEN $3 < 1 THEN NULL ELSE $3 END);
+
+-- name: create-subscriber-email-change
+-- Records a pending change of a subscriber's e-mail to $2, replacing any earlier one,
+-- unless the e-mail belongs to another subscriber or is a verified alternate e-mail.
+INSERT INTO subscriber_email_changes (subscriber_id, email, token)
+    SELECT id, $2, $3 FROM subscribers WHERE id = $1
+    AND NOT EXISTS (SELECT 1 FROM subscribers WHERE LOWER(email) = LOWER($2))
+    AND NOT EXISTS (SELECT 1 FROM subscriber_emails WHERE LOWER(email) = LOWER($2) AND verified_at IS NOT NULL)
+    ON CONFLICT (subscriber_id) DO UPDATE SET email=$2, token=$3, created_at=NOW()
+    RETURNING *;
+
+-- name: get-subscriber-email-change
+-- Returns the pending e-mail change of the subscriber $1 or with the token $2 unless it has expired ($3).
+SELECT * FROM subscriber_email_changes
+    WHERE (CASE WHEN $1 > 0 THEN subscriber_id = $1 ELSE token = $2::UUID END)
+    AND created_at > NOW() - $3::INTERVAL;
+
+-- name: confirm-subscriber-email-change
+-- Applies the pending e-mail change with the token $1 unless it has expired ($2). The
+-- subscriber retains their UUID and history.
+WITH ch AS (
+    DELETE FROM subscriber_email_changes WHERE token = $1 RETURNING *
+)
+UPDATE subscribers SET email=ch.email, updated_at=NOW()
+    FROM ch WHERE subscribers.id = ch.subscriber_id AND ch.created_at > NOW() - $2::INTERVAL
+    RETURNING subscribers.id;
+
+-- name: delete-subscriber-email-change
+DELETE FROM subscriber_email_changes WHERE subscriber_id = $1;
+
+-- name: get-subscriber-emails
+-- Returns the alternate e-mails of the subscriber $1, or the one with the ID $2, or the
+-- unverified one with the token $3 unless it has expired ($4).
+SELECT * FROM subscriber_emails WHERE
+    CASE
+        WHEN $3 != '' THEN token = $3::UUID AND verified_at IS NULL AND created_at > NOW() - $4::INTERVAL
+        WHEN $2 > 0 THEN id = $2 AND subscriber_id = $1
+        ELSE subscriber_id = $1
+    END
+    ORDER BY id;
+
+-- name: get-subscriber-email-owner
+-- Returns the ID of the subscriber with the verified alternate e-mail $1.
+SELECT subscriber_id FROM subscriber_emails WHERE LOWER(email) = LOWER($1) AND verified_at IS NOT NULL;
+
+-- name: create-subscriber-email
+-- Adds the alternate e-mail $2 to the subscriber $1 with the verification token $3, unless the
+-- e-mail is the primary e-mail of a subscriber. An e-mail that's already an alternate e-mail of
+-- the subscriber is given the new token if it's unverified.
+INSERT INTO subscriber_emails (subscriber_id, email, token)
+    SELECT id, $2, $3 FROM subscribers WHERE id = $1
+    AND NOT EXISTS (SELECT 1 FROM subscribers WHERE LOWER(email) = LOWER($2))
+    ON CONFLICT ((LOWER(email))) DO UPDATE SET token=$3, created_at=NOW()
+        WHERE subscriber_emails.subscriber_id = $1 AND subscriber_emails.verified_at IS NULL
+    RETURNING *;
+
+-- name: verify-subscriber-email
+-- Verifies the alternate e-mail with the token $1 unless it has expired ($2), or the
+-- e-mail has become the primary e-mail of a subscriber in the meantime.
+UPDATE subscriber_emails SET token=NULL, verified_at=NOW()
+    WHERE token = $1::UUID AND verified_at IS NULL AND created_at > NOW() - $2::INTERVAL
+    AND NOT EXISTS (SELECT 1 FROM subscribers WHERE LOWER(subscribers.email) = LOWER(subscriber_emails.email))
+    RETURNING *;
+
+-- name: set-primary-subscriber-email
+-- Swaps the verified alternate e-mail $2 of the subscriber $1 with their primary e-mail,
+-- which becomes a verified alternate e-mail in its place with no bounces.
+WITH alt AS (
+    SELECT * FROM subscriber_emails WHERE id = $2 AND subscriber_id = $1 AND verified_at IS NOT NULL
+),
+sub AS (
+    UPDATE subscriber_emails SET email = (SELECT email FROM subscribers WHERE id = $1), bounces = 0, last_bounced_at = NULL
+        WHERE id = (SELECT id FROM alt)
+    RETURNING id
+)
+UPDATE subscribers SET email = (SELECT email FROM alt), updated_at = NOW()
+    WHERE id = $1 AND EXISTS (SELECT 1 FROM sub)
+    RETURNING id;
+
+-- name: delete-subscriber-email
+DELETE FROM subscriber_emails WHERE id = $2 AND subscriber_id = $1;
+
+-- name: record-subscriber-email-bounce
+-- Counts a bounce on the alternate e-mail $1 and returns the ID of its subscriber.
+UPDATE subscriber_emails SET bounces = bounces + 1, last_bounced_at = NOW()
+    WHERE LOWER(email) = LOWER($1)
+    RETURNING subscriber_id;
+
+-- name: create-subscriber-note
+INSERT INTO subscriber_notes (subscriber_id, author, note)
+    SELECT id, $2, $3 FROM subscribers WHERE id = $1
+    RETURNING *;
+
+-- name: update-subscriber-note
+UPDATE subscriber_notes SET note=$3, updated_at=NOW()
+    WHERE id = $2 AND subscriber_id = $1
+    RETURNING *;
+
+-- name: delete-subscriber-note
+DELETE FROM subscriber_notes WHERE id = $2 AND subscriber_id = $1;
+
+-- name: query-subscriber-notes
+-- Returns the notes of the subscriber $1, or of all subscribers if it's 0, optionally
+-- matching the ILIKE pattern $2, latest first.
+SELECT COUNT(*) OVER () AS total, n.*, s.email AS subscriber_email, s.name AS subscriber_name
+    FROM subscriber_notes n
+    LEFT JOIN subscribers s ON (s.id = n.subscriber_id)
+    WHERE ($1 = 0 OR n.subscriber_id = $1)
+    AND ($2 = '' OR n.note ILIKE $2 OR n.author ILIKE $2)
+    ORDER BY n.created_at DESC OFFSET $3 LIMIT (CASE WHEN $4 < 1 THEN NULL ELSE $4 END);
+
+-- name: create-subscriber-job
+INSERT INTO subscriber_jobs (action, query, list_ids, target_list_ids, sub_status, created_by, matched, tags)
+    VALUES($1, $2, $3, $4, $5, $6, $7, $8) RETURNING *;
+
+-- name: update-subscriber-job
+-- A job that's no longer running is finished.
+UPDATE subscriber_jobs SET status=$2, error=$3, processed=$4, updated_at=NOW(),
+    finished_at=(CASE WHEN $2 != 'running' THEN NOW() ELSE NULL END)
+    WHERE id = $1;
+
+-- name: get-subscriber-job
+SELECT * FROM subscriber_jobs WHERE id = $1;
+
+-- name: query-subscriber-jobs
+SELECT COUNT(*) OVER () AS total, * FROM subscriber_jobs
+    ORDER BY created_at DESC OFFSET $1 LIMIT (CASE WHEN $2 < 1 THEN NULL ELSE $2 END);
+
+-- name: get-max-subscriber-id
+SELECT COALESCE(MAX(id), 0) FROM subscribers;
+
+-- name: reindex-subscriber-search
+-- Recomputes the search text of the subscribers with IDs in the range ($1, $2].
+UPDATE subscribers SET search_text = subscriber_search_text(email, name, attribs)
+    WHERE id > $1 AND id <= $2;
+
+-- name: set-subscriber-search-indexed
+-- Records the attributes that the subscriber search text was last computed with.
+UPDATE settings SET value = $1, updated_at = NOW() WHERE key = 'app.search_attribs_indexed';
+
 -- name: blocklist-subscribers
 WITH b AS (
     UPDATE subscribers SET status='blocklisted', updated_at=NOW()
@@ -212,15 +652,63 @@ INSERT INTO subscriber_lists (subscriber_id, list_id, status)
 DELETE FROM subscriber_lists
     WHERE (subscriber_id, list_id) = ANY(SELECT a, b FROM UNNEST($1::INT[]) a, UNNEST($2::INT[]) b);
 
+-- name: add-subscriber-tags
+UPDATE subscribers SET tags=ARRAY(SELECT DISTINCT t FROM UNNEST(tags || $2::VARCHAR(100)[]) t ORDER BY t), updated_at=NOW()
+    WHERE id = ANY($1::INT[]) AND NOT (tags @> $2::VARCHAR(100)[]);
+
+-- name: remove-subscriber-tags
+UPDATE subscribers SET tags=ARRAY(SELECT t FROM UNNEST(tags) t WHERE t != ALL($2::VARCHAR(100)[])), updated_at=NOW()
+    WHERE id = ANY($1::INT[]) AND tags && $2::VARCHAR(100)[];
+
+-- name: get-subscriber-tags
+-- Returns all the tags on subscribers with the number of subscribers that have each.
+SELECT tag, COUNT(*) AS subscriber_count FROM subscribers, UNNEST(subscribers.tags) AS tag
+    GROUP BY tag ORDER BY tag;
+
+-- name: rename-subscriber-tag
+-- Renames a tag on all subscribers and in the campaigns that are sent to it.
+WITH camps AS (
+    UPDATE campaigns SET subscriber_tags=ARRAY(SELECT DISTINCT t FROM UNNEST(ARRAY_REPLACE(subscriber_tags, $1, $2)) t ORDER BY t)
+    WHERE subscriber_tags @> ARRAY[$1]::VARCHAR(100)[]
+)
+UPDATE subscribers SET tags=ARRAY(SELECT DISTINCT t FROM UNNEST(ARRAY_REPLACE(tags, $1, $2)) t ORDER BY t), updated_at=NOW()
+    WHERE tags @> ARRAY[$1]::VARCHAR(100)[];
+
+-- name: delete-subscriber-tag
+-- Removes a tag from all subscribers and the campaigns that are sent to it.
+WITH camps AS (
+    UPDATE campaigns SET subscriber_tags=ARRAY_REMOVE(subscriber_tags, $1) WHERE subscriber_tags @> ARRAY[$1]::VARCHAR(100)[]
+)
+UPDATE subscribers SET tags=ARRAY_REMOVE(tags, $1), updated_at=NOW()
+    WHERE tags @> ARRAY[$1]::VARCHAR(100)[];
+
 -- name: confirm-subscription-optin
+-- Confirms the subscriber's subscriptions to the lists $2 that they haven't unsubscribed from,
+-- or that they're rejoining. Blocklisted subscribers can't confirm.
 WITH subID AS (
-    SELECT id FROM subscribers WHERE uuid = $1::UUID
+    SELECT id FROM subscribers WHERE uuid = $1::UUID AND status != 'blocklisted'
 ),
 listIDs AS (
     SELECT id FROM lists WHERE uuid = ANY($2::UUID[])
 )
-UPDATE subscriber_lists SET status='confirmed', meta=meta || $3, updated_at=NOW()
-    WHERE subscriber_id = (SELECT id FROM subID) AND list_id = ANY(SELECT id FROM listIDs);
+UPDATE subscriber_lists SET status='confirmed', meta=(meta - 'resubscribe') || $3, updated_at=NOW()
+    WHERE subscriber_id = (SELECT id FROM subID) AND list_id = ANY(SELECT id FROM listIDs)
+    AND (status != 'unsubscribed' OR meta->>'resubscribe' IS NOT NULL);
+
+-- name: resubscribe-subscriber
+-- Subscribes the existing subscriber $1 to the lists $2 (IDs) or $3 (UUIDs) again. New subscriptions
+-- are added as unconfirmed. Subscriptions that were unsubscribed remain so, marked as being rejoined,
+-- until they're confirmed with opt-in on lists of any opt-in type, and the rest are left as they are.
+-- Returns the IDs of the lists that were added or marked.
+WITH listIDs AS (
+    SELECT id FROM lists WHERE
+        (CASE WHEN CARDINALITY($2::INT[]) > 0 THEN id=ANY($2) ELSE uuid=ANY($3::UUID[]) END)
+)
+INSERT INTO subscriber_lists (subscriber_id, list_id, status)
+    SELECT $1, id, 'unconfirmed' FROM listIDs
+ON CONFLICT (subscriber_id, list_id) DO UPDATE SET meta=subscriber_lists.meta || '{"resubscribe": true}', updated_at=NOW()
+    WHERE subscriber_lists.status = 'unsubscribed'
+RETURNING list_id;
 
 -- name: unsubscribe-subscribers-from-lists
 WITH listIDs AS (
@@ -250,6 +738,141 @@ UPDATE subscriber_lists SET status = 'unsubscribed', updated_at=NOW() WHERE
     -- If $3 is false, unsubscribe from the campaign's lists, otherwise all lists.
     CASE WHEN $3 IS FALSE THEN list_id = ANY(SELECT list_id FROM lists) ELSE list_id != 0 END;
 
+-- name: mark-subscriptions-repermission
+-- Marks a batch of the subscriptions to lists with a subscription TTL that haven't had any
+-- activity (subscribing, confirming, renewing, views, or clicks) within it as pending
+-- re-permission, and returns them grouped by subscriber. Archived lists are skipped.
+WITH due AS (
+    SELECT sl.subscriber_id, sl.list_id FROM subscriber_lists sl
+    JOIN lists ON (lists.id = sl.list_id)
+    JOIN subscribers s ON (s.id = sl.subscriber_id)
+    WHERE lists.subscription_ttl > 0 AND NOT lists.archived AND sl.repermission_sent_at IS NULL AND s.status = 'enabled'
+        AND (sl.status = 'confirmed' OR (sl.status = 'unconfirmed' AND lists.optin = 'single'))
+        AND GREATEST(sl.created_at, sl.updated_at,
+            (SELECT MAX(created_at) FROM campaign_views WHERE subscriber_id = sl.subscriber_id),
+            (SELECT MAX(created_at) FROM link_clicks WHERE subscriber_id = sl.subscriber_id)
+        ) < NOW() - MAKE_INTERVAL(days => lists.subscription_ttl)
+    ORDER BY sl.subscriber_id
+    LIMIT $1
+),
+marked AS (
+    UPDATE subscriber_lists sl SET repermission_sent_at=NOW() FROM due
+        WHERE sl.subscriber_id = due.subscriber_id AND sl.list_id = due.list_id
+    RETURNING sl.subscriber_id, sl.list_id
+)
+SELECT subscriber_id, ARRAY_AGG(list_id) AS list_ids FROM marked GROUP BY subscriber_id;
+
+-- name: clear-subscriptions-repermission
+-- Clears the pending re-permission of a subscriber's subscriptions, eg: when the e-mail couldn't be sent.
+UPDATE subscriber_lists SET repermission_sent_at=NULL WHERE subscriber_id = $1 AND list_id = ANY($2::INT[]);
+
+-- name: renew-subscriptions
+-- Renews a subscriber's subscriptions to the given lists (UUIDs), or to all the lists that are
+-- pending re-permission if there are none.
+WITH sub AS (
+    SELECT id FROM subscribers WHERE uuid = $1::UUID
+)
+UPDATE subscriber_lists SET repermission_sent_at=NULL, updated_at=NOW()
+    WHERE subscriber_id = (SELECT id FROM sub) AND status != 'unsubscribed' AND
+    (CASE WHEN CARDINALITY($2::UUID[]) > 0 THEN list_id = ANY(SELECT id FROM lists WHERE uuid = ANY($2::UUID[]))
+        ELSE repermission_sent_at IS NOT NULL END);
+
+-- name: expire-subscriptions
+-- Clears the pending re-permission of the subscriptions that have had activity since the
+-- re-permission e-mail was sent (or whose list no longer has a TTL or is archived) and unsubscribes the rest
+-- of the ones that weren't renewed within their list's grace period. Returns the unsubscribed
+-- subscriber IDs.
+WITH pending AS (
+    SELECT sl.subscriber_id, sl.list_id, sl.repermission_sent_at, lists.repermission_grace,
+        (lists.subscription_ttl = 0 OR lists.archived OR GREATEST(sl.updated_at,
+            (SELECT MAX(created_at) FROM campaign_views WHERE subscriber_id = sl.subscriber_id),
+            (SELECT MAX(created_at) FROM link_clicks WHERE subscriber_id = sl.subscriber_id)
+        ) >= sl.repermission_sent_at) AS active
+    FROM subscriber_lists sl
+    JOIN lists ON (lists.id = sl.list_id)
+    WHERE sl.repermission_sent_at IS NOT NULL AND sl.status != 'unsubscribed'
+),
+renewed AS (
+    UPDATE subscriber_lists sl SET repermission_sent_at=NULL FROM pending p
+        WHERE p.active AND sl.subscriber_id = p.subscriber_id AND sl.list_id = p.list_id
+)
+UPDATE subscriber_lists sl SET status='unsubscribed', repermission_sent_at=NULL, updated_at=NOW() FROM pending p
+    WHERE NOT p.active AND p.repermission_sent_at < NOW() - MAKE_INTERVAL(days => p.repermission_grace)
+    AND sl.subscriber_id = p.subscriber_id AND sl.list_id = p.list_id
+    RETURNING sl.subscriber_id;
+
+-- name: get-due-optin-reminders
+-- Returns a batch of the unconfirmed subscriptions to double opt-in lists with reminders that
+-- weren't confirmed within the list's reminder interval of subscribing or the last reminder,
+-- and haven't been sent all of the list's reminders, grouped by subscriber. Archived lists are skipped.
+SELECT sl.subscriber_id, ARRAY_AGG(sl.list_id) AS list_ids FROM subscriber_lists sl
+    JOIN lists ON (lists.id = sl.list_id)
+    JOIN subscribers s ON (s.id = sl.subscriber_id)
+    WHERE lists.optin = 'double' AND lists.optin_reminder_days > 0 AND NOT lists.archived AND sl.status = 'unconfirmed'
+        AND s.status = 'enabled' AND sl.optin_reminders < lists.optin_reminder_max
+        AND GREATEST(sl.updated_at, sl.optin_reminded_at) < NOW() - MAKE_INTERVAL(days => lists.optin_reminder_days)
+    GROUP BY sl.subscriber_id
+    ORDER BY sl.subscriber_id
+    LIMIT $1;
+
+-- name: record-optin-reminders
+-- Records an opt-in reminder sent to the subscriber $1 for the lists $2.
+UPDATE subscriber_lists SET optin_reminders=optin_reminders+1, optin_reminded_at=NOW()
+    WHERE subscriber_id = $1 AND list_id = ANY($2::INT[]);
+
+-- name: run-subscriber-hygiene
+-- Applies the list hygiene rules, each of which is off if its value is 0, and returns the
+-- number of subscriptions and subscribers that are affected. Nothing is changed if $4 = true.
+-- $1: unconfirmed double opt-in subscriptions older than these many days are deleted.
+-- $2: enabled subscribers older than these many months who were sent campaigns in as many months
+--     but didn't view or click any of them are unsubscribed from all their lists.
+-- $3: blocklisted subscribers who haven't been updated in these many days are deleted.
+WITH blocklisted AS (
+    SELECT id FROM subscribers
+    WHERE $3 > 0 AND status = 'blocklisted' AND updated_at < NOW() - MAKE_INTERVAL(days => $3::INT)
+),
+unconfirmed AS (
+    SELECT subscriber_id, list_id FROM subscriber_lists
+    WHERE $1 > 0 AND status = 'unconfirmed' AND created_at < NOW() - MAKE_INTERVAL(days => $1::INT)
+        AND list_id IN (SELECT id FROM lists WHERE optin = 'double')
+        AND subscriber_id NOT IN (SELECT id FROM blocklisted)
+),
+unengaged AS (
+    SELECT id FROM subscribers
+    WHERE $2 > 0 AND status = 'enabled' AND created_at < NOW() - MAKE_INTERVAL(months => $2::INT)
+        AND EXISTS (
+            SELECT 1 FROM subscriber_lists sl WHERE sl.subscriber_id = subscribers.id AND sl.status != 'unsubscribed'
+            AND (sl.subscriber_id, sl.list_id) NOT IN (SELECT subscriber_id, list_id FROM unconfirmed)
+        )
+        AND EXISTS (
+            SELECT 1 FROM campaign_deliveries WHERE subscriber_id = subscribers.id AND status = 'sent'
+            AND created_at > NOW() - MAKE_INTERVAL(months => $2::INT)
+        )
+        AND NOT EXISTS (
+            SELECT 1 FROM campaign_views WHERE subscriber_id = subscribers.id
+            AND created_at > NOW() - MAKE_INTERVAL(months => $2::INT)
+        )
+        AND NOT EXISTS (
+            SELECT 1 FROM link_clicks WHERE subscriber_id = subscribers.id
+            AND created_at > NOW() - MAKE_INTERVAL(months => $2::INT)
+        )
+),
+delUnconfirmed AS (
+    DELETE FROM subscriber_lists sl USING unconfirmed u
+    WHERE NOT $4 AND sl.subscriber_id = u.subscriber_id AND sl.list_id = u.list_id
+),
+unsub AS (
+    UPDATE subscriber_lists SET status = 'unsubscribed', updated_at = NOW()
+    WHERE NOT $4 AND subscriber_id IN (SELECT id FROM unengaged) AND status != 'unsubscribed'
+        AND (subscriber_id, list_id) NOT IN (SELECT subscriber_id, list_id FROM unconfirmed)
+),
+delBlocklisted AS (
+    DELETE FROM subscribers WHERE NOT $4 AND id IN (SELECT id FROM blocklisted)
+)
+SELECT (SELECT COUNT(*) FROM unconfirmed) AS unconfirmed_subscriptions,
+    (SELECT COUNT(*) FROM unengaged) AS unengaged_subscribers,
+    (SELECT COUNT(*) FROM blocklisted) AS blocklisted_subscribers;
+
 -- name: delete-unconfirmed-subscriptions
 WITH optins AS (
     SELECT id FROM lists WHERE optin = 'double'
@@ -260,7 +883,9 @@ DELETE FROM subscriber_lists
 -- privacy
 -- name: export-subscriber-data
 WITH prof AS (
-    SELECT id, uuid, email, name, attribs, status, created_at, updated_at FROM subscribers WHERE
+    SELECT id, uuid, email, ARRAY(
+            SELECT e.email FROM subscriber_emails e WHERE e.subscriber_id = subscribers.id ORDER BY e.id
+        ) AS alternate_emails, name, attribs, locale, timezone, status, created_at, updated_at FROM subscribers WHERE
     CASE WHEN $1 > 0 THEN id = $1 ELSE uuid = $2 END
 ),
 subs AS (
@@ -282,12 +907,20 @@ clicks AS (
         LEFT JOIN links ON (links.id = link_clicks.link_id)
         WHERE subscriber_id = (SELECT id FROM prof)
         GROUP BY links.id ORDER BY links.id
+),
+consents AS (
+    SELECT type, ARRAY(
+            SELECT (CASE WHEN lists.type = 'private' THEN 'Private list' ELSE lists.name END)
+            FROM lists WHERE id = ANY(subscriber_consents.list_ids) ORDER BY id
+        ) AS lists, ip, user_agent, source, url, created_at
+    FROM subscriber_consents WHERE subscriber_id = (SELECT id FROM prof) ORDER BY id
 )
 SELECT (SELECT email FROM prof) as email,
         COALESCE((SELECT JSON_AGG(t) FROM prof t), '{}') AS profile,
         COALESCE((SELECT JSON_AGG(t) FROM subs t), '[]') AS subscriptions,
         COALESCE((SELECT JSON_AGG(t) FROM views t), '[]') AS campaign_views,
-        COALESCE((SELECT JSON_AGG(t) FROM clicks t), '[]') AS link_clicks;
+        COALESCE((SELECT JSON_AGG(t) FROM clicks t), '[]') AS link_clicks,
+        COALESCE((SELECT JSON_AGG(t) FROM consents t), '[]') AS consents;
 
 -- Partial and RAW queries used to construct arbitrary subscriber
 -- queries for segmentation follow.
@@ -330,19 +963,54 @@ SELECT SUM(subscriber_count) AS total FROM mat_list_subscriber_stats
     WHERE list_id = ANY(CASE WHEN CARDINALITY($1::INT[]) > 0 THEN $1 ELSE '{0}' END)
     AND ($2 = '' OR status = $2::subscription_status);
 
+-- name: sample-subscribers
+-- raw: true
+-- Returns a random sample of $4 distinct subscribers that match the arbitrary expression in the
+-- optional lists. If $3 (seed) is given, the sample is repeatable: the same seed picks the same
+-- subscribers out of the same matches.
+SELECT * FROM subscribers WHERE id IN (
+    SELECT subscribers.id FROM subscribers
+    LEFT JOIN subscriber_lists
+    ON (
+        -- Optional list filtering.
+        (CASE WHEN CARDINALITY($1::INT[]) > 0 THEN true ELSE false END)
+        AND subscriber_lists.subscriber_id = subscribers.id
+        AND ($2 = '' OR subscriber_lists.status = $2::subscription_status)
+    )
+    WHERE (CARDINALITY($1) = 0 OR subscriber_lists.list_id = ANY($1::INT[]))
+    %query%
+)
+ORDER BY (CASE WHEN $3 = '' THEN RANDOM() END), MD5(uuid::TEXT || $3) LIMIT $4;
+
 -- name: query-subscribers-for-export
 -- raw: true
 -- Unprepared statement for issuring arbitrary WHERE conditions for
 -- searching subscribers to do bulk CSV export.
 -- %s = arbitrary expression
+-- $5 = attribute keys whose values are returned in the same order in attrib_values.
+-- consents is a JSON array of the subscriber's consent records.
 SELECT subscribers.id,
        subscribers.uuid,
        subscribers.email,
        subscribers.name,
        subscribers.status,
        subscribers.attribs,
+       subscribers.tags,
+       subscribers.external_id,
+       subscribers.locale,
+       subscribers.timezone,
+       subscribers.engagement_score,
        subscribers.created_at,
-       subscribers.updated_at
+       subscribers.updated_at,
+       ARRAY(
+           SELECT COALESCE(subscribers.attribs->>a.key, '')
+           FROM UNNEST($5::TEXT[]) WITH ORDINALITY AS a(key, n) ORDER BY a.n
+       ) AS attrib_values,
+       COALESCE((
+           SELECT JSON_AGG(JSON_BUILD_OBJECT('type', type, 'list_ids', list_ids, 'ip', ip, 'user_agent', user_agent,
+               'source', source, 'url', url, 'created_at', created_at) ORDER BY id)
+           FROM subscriber_consents WHERE subscriber_id = subscribers.id
+       ), '[]') AS consents
        FROM subscribers
     LEFT JOIN subscriber_lists
     ON (
@@ -379,6 +1047,18 @@ LIMIT (CASE WHEN $1 THEN 1 END)
 WITH subs AS (%s)
 DELETE FROM subscribers WHERE id=ANY(SELECT id FROM subs);
 
+-- name: soft-delete-subscribers-by-query
+-- raw: true
+WITH subs AS (%s)
+UPDATE subscribers SET status='deleted', restore_status=status, deleted_at=NOW(), updated_at=NOW()
+    WHERE id=ANY(SELECT id FROM subs) AND status != 'deleted';
+
+-- name: restore-subscribers-by-query
+-- raw: true
+WITH subs AS (%s)
+UPDATE subscribers SET status=COALESCE(restore_status, 'enabled'), restore_status=NULL, deleted_at=NULL, updated_at=NOW()
+    WHERE id=ANY(SELECT id FROM subs) AND status = 'deleted';
+
 -- name: blocklist-subscribers-by-query
 -- raw: true
 WITH subs AS (%s),
@@ -408,14 +1088,166 @@ WITH subs AS (%s)
 UPDATE subscriber_lists SET status='unsubscribed', updated_at=NOW()
     WHERE (subscriber_id, list_id) = ANY(SELECT a, b FROM UNNEST(ARRAY(SELECT id FROM subs)) a, UNNEST($3::INT[]) b);
 
+-- name: add-subscriber-tags-by-query
+-- raw: true
+WITH subs AS (%s)
+UPDATE subscribers SET tags=ARRAY(SELECT DISTINCT t FROM UNNEST(tags || $3::VARCHAR(100)[]) t ORDER BY t), updated_at=NOW()
+    WHERE id = ANY(SELECT id FROM subs) AND NOT (tags @> $3::VARCHAR(100)[]);
+
+-- name: remove-subscriber-tags-by-query
+-- raw: true
+WITH subs AS (%s)
+UPDATE subscribers SET tags=ARRAY(SELECT t FROM UNNEST(tags) t WHERE t != ALL($3::VARCHAR(100)[])), updated_at=NOW()
+    WHERE id = ANY(SELECT id FROM subs) AND tags && $3::VARCHAR(100)[];
+
+
+-- list folders
+-- name: get-list-folders
+-- The lists pseudofield is the number of lists directly in a folder.
+SELECT list_folders.*, (SELECT COUNT(*) FROM lists WHERE lists.folder_id = list_folders.id) AS lists
+    FROM list_folders WHERE ($1 = 0 OR id = $1) ORDER BY name;
+
+-- name: create-list-folder
+INSERT INTO list_folders (name, parent_id) VALUES($1, $2) RETURNING id;
+
+-- name: update-list-folder
+-- A folder can't be moved into itself or any of its subfolders.
+WITH RECURSIVE subs AS (
+    SELECT id FROM list_folders WHERE id = $1
+    UNION
+    SELECT f.id FROM list_folders f JOIN subs ON (f.parent_id = subs.id)
+)
+UPDATE list_folders SET name=$2, parent_id=$3, updated_at=NOW()
+    WHERE id = $1 AND ($3::INT IS NULL OR $3 NOT IN (SELECT id FROM subs));
+
+-- name: delete-list-folder
+-- The lists and subfolders of the folder are moved to its parent folder.
+WITH f AS (
+    SELECT id, parent_id FROM list_folders WHERE id = $1
+),
+ls AS (
+    UPDATE lists SET folder_id = (SELECT parent_id FROM f) WHERE folder_id = (SELECT id FROM f)
+),
+subs AS (
+    UPDATE list_folders SET parent_id = (SELECT parent_id FROM f) WHERE parent_id = (SELECT id FROM f)
+)
+DELETE FROM list_folders WHERE id = (SELECT id FROM f);
+
+-- list webhooks
+-- name: get-list-webhooks
+-- Returns the webhooks of the lists $1, only the enabled ones if $2 is true.
+SELECT * FROM list_webhooks WHERE list_id = ANY($1::INT[]) AND ($2 = false OR enabled) ORDER BY id;
+
+-- name: create-list-webhook
+INSERT INTO list_webhooks (list_id, url, events, secret, enabled)
+    SELECT id, $2, $3, $4, $5 FROM lists WHERE id = $1
+    RETURNING *;
+
+-- name: update-list-webhook
+-- An empty secret retains the existing one.
+UPDATE list_webhooks SET url=$3, events=$4, secret=(CASE WHEN $5 = '' THEN secret ELSE $5 END),
+    enabled=$6, updated_at=NOW()
+    WHERE id = $2 AND list_id = $1
+    RETURNING *;
+
+-- name: delete-list-webhook
+DELETE FROM list_webhooks WHERE id = $2 AND list_id = $1;
+
+-- name: next-list-events
+-- Removes and returns the oldest $1 list events that are yet to be dispatched
+-- with their lists and subscribers.
+WITH ev AS (
+    DELETE FROM list_events WHERE id IN (
+        SELECT id FROM list_events ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED
+    )
+    RETURNING *
+)
+SELECT ev.id, ev.event, ev.created_at, ev.list_id, lists.uuid AS list_uuid, lists.name AS list_name,
+    ev.subscriber_id, subscribers.uuid AS subscriber_uuid, subscribers.email, subscribers.name,
+    subscribers.attribs, subscribers.status
+    FROM ev
+    JOIN lists ON (lists.id = ev.list_id)
+    JOIN subscribers ON (subscribers.id = ev.subscriber_id)
+    ORDER BY ev.id;
+
+-- segments
+-- name: get-segments
+-- The campaigns pseudofield is the number of campaigns that are sent to a segment.
+SELECT segments.*,
+    (SELECT COUNT(*) FROM campaigns WHERE segments.id = ANY(campaigns.segment_ids)) AS campaigns
+    FROM segments WHERE ($1 = 0 OR id = $1) ORDER BY name;
+
+-- name: create-segment
+INSERT INTO segments (uuid, name, description, query, filter) VALUES($1, $2, $3, $4, $5) RETURNING id;
+
+-- name: update-segment
+-- A segment whose query changes is counted afresh.
+UPDATE segments SET
+    name=$2,
+    description=$3,
+    refreshed_at=(CASE WHEN query != $4 THEN NULL ELSE refreshed_at END),
+    query=$4,
+    filter=$5,
+    updated_at=NOW()
+WHERE id = $1;
+
+-- name: delete-segment
+-- The segment is removed from the campaigns that are sent to it.
+WITH camps AS (
+    UPDATE campaigns SET segment_ids=ARRAY_REMOVE(segment_ids, $1) WHERE $1 = ANY(segment_ids)
+)
+DELETE FROM segments WHERE id = $1;
+
+-- name: refresh-segment
+-- raw: true
+-- Materializes the subscribers that match a segment's query in segment_subscribers
+-- and caches their count. $3 = segment ID.
+WITH subs AS (%s),
+del AS (
+    DELETE FROM segment_subscribers s WHERE s.segment_id = $3
+        AND NOT EXISTS (SELECT 1 FROM subs WHERE subs.id = s.subscriber_id)
+),
+ins AS (
+    INSERT INTO segment_subscribers (segment_id, subscriber_id)
+        (SELECT $3, id FROM subs) ON CONFLICT DO NOTHING
+)
+UPDATE segments SET subscriber_count=(SELECT COUNT(*) FROM subs), refreshed_at=NOW() WHERE id = $3;
+
+-- name: get-segment-stats
+-- Returns the number of subscribers in a segment by their status, their average engagement
+-- score, and the views, clicks, and bounces of them across all campaigns in the last $2 days.
+WITH subs AS (
+    SELECT subscribers.id, subscribers.status, subscribers.engagement_score FROM segment_subscribers
+    INNER JOIN subscribers ON (subscribers.id = segment_subscribers.subscriber_id)
+    WHERE segment_subscribers.segment_id = $1
+)
+SELECT
+    COALESCE((SELECT JSON_OBJECT_AGG(status, num) FROM
+        (SELECT status, COUNT(*) AS num FROM subs GROUP BY status) s), '{}') AS statuses,
+    COALESCE((SELECT AVG(engagement_score) FROM subs), 0) AS engagement_score,
+    (SELECT COUNT(*) FROM campaign_views WHERE subscriber_id = ANY(SELECT id FROM subs)
+        AND created_at > NOW() - ($2 * INTERVAL '1 day')) AS views,
+    (SELECT COUNT(*) FROM link_clicks WHERE subscriber_id = ANY(SELECT id FROM subs)
+        AND created_at > NOW() - ($2 * INTERVAL '1 day')) AS clicks,
+    (SELECT COUNT(*) FROM bounces WHERE subscriber_id = ANY(SELECT id FROM subs)
+        AND created_at > NOW() - ($2 * INTERVAL '1 day')) AS bounces;
+
 
 -- lists
 -- name: get-lists
-SELECT * FROM lists WHERE (CASE WHEN $1 = '' THEN 1=1 ELSE type=$1::list_type END)
+-- Archived lists are left out.
+SELECT * FROM lists WHERE (CASE WHEN $1 = '' THEN 1=1 ELSE type=$1::list_type END) AND NOT archived
     ORDER BY CASE WHEN $2 = 'id' THEN id END, CASE WHEN $2 = 'name' THEN name END;
 
 -- name: query-lists
-WITH ls AS (
+-- $9 is the folder the lists are in, where 0 is no folder and -1 is any folder,
+-- and $10 includes the lists in the folder's subfolders.
+WITH RECURSIVE folders AS (
+    SELECT id FROM list_folders WHERE id = $9
+    UNION
+    SELECT f.id FROM list_folders f JOIN folders ON (f.parent_id = folders.id) WHERE $10
+),
+ls AS (
 	SELECT COUNT(*) OVER () AS total, lists.* FROM lists WHERE
     CASE
         WHEN $1 > 0 THEN id = $1
@@ -426,6 +1258,11 @@ WITH ls AS (
     AND ($4 = '' OR type = $4::list_type)
     AND ($5 = '' OR optin = $5::list_optin)
     AND (CARDINALITY($6::VARCHAR(100)[]) = 0 OR $6 <@ tags)
+    AND (CASE
+        WHEN $9 < 0 THEN TRUE
+        WHEN $9 = 0 THEN folder_id IS NULL
+        ELSE folder_id IN (SELECT id FROM folders)
+    END)
     OFFSET $7 LIMIT (CASE WHEN $8 < 1 THEN NULL ELSE $8 END)
 ),
 statuses AS (
@@ -446,7 +1283,10 @@ SELECT * FROM lists WHERE (CASE WHEN $1 != '' THEN optin=$1::list_optin ELSE TRU
     END) ORDER BY name;
 
 -- name: create-list
-INSERT INTO lists (uuid, name, type, optin, tags, description) VALUES($1, $2, $3, $4, $5, $6) RETURNING id;
+INSERT INTO lists (uuid, name, type, optin, tags, description, tracking_domain, optin_template_id, optin_subject, optin_from_email, optin_redirect_url,
+    frequency_cap_daily, frequency_cap_weekly, subscription_ttl, repermission_grace, folder_id,
+    default_from_email, default_reply_to, default_template_id, default_messenger, optin_reminder_days, optin_reminder_max, query, exclude_list_ids)
+    VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24) RETURNING id;
 
 -- name: update-list
 UPDATE lists SET
@@ -455,15 +1295,252 @@ UPDATE lists SET
     optin=(CASE WHEN $4 != '' THEN $4::list_optin ELSE optin END),
     tags=$5::VARCHAR(100)[],
     description=(CASE WHEN $6 != '' THEN $6 ELSE description END),
+    tracking_domain=$7,
+    optin_template_id=$8,
+    optin_subject=$9,
+    optin_from_email=$10,
+    optin_redirect_url=$11,
+    frequency_cap_daily=$12,
+    frequency_cap_weekly=$13,
+    subscription_ttl=$14,
+    repermission_grace=$15,
+    folder_id=$16,
+    default_from_email=$17,
+    default_reply_to=$18,
+    default_template_id=$19,
+    default_messenger=$20,
+    optin_reminder_days=$21,
+    optin_reminder_max=$22,
+    query=$23,
+    -- Dynamic lists whose query has changed are refreshed afresh.
+    refreshed_at=(CASE WHEN query = $23 THEN refreshed_at ELSE NULL END),
+    exclude_list_ids=$24,
     updated_at=NOW()
 WHERE id = $1;
 
+-- name: get-dynamic-lists
+-- Returns the dynamic lists that aren't archived, or those of the campaign $1 if it's set.
+SELECT * FROM lists WHERE type = 'dynamic' AND NOT archived
+    AND ($1 = 0 OR id IN (SELECT list_id FROM campaign_lists WHERE campaign_id = $1))
+    ORDER BY id;
+
+-- name: refresh-dynamic-list
+-- raw: true
+-- Materializes the subscribers that match a dynamic list's query as confirmed subscriptions
+-- and removes the subscriptions of the ones that no longer match. Unsubscriptions are kept
+-- so that the subscribers aren't subscribed again. $3 = list ID.
+WITH subs AS (%s),
+del AS (
+    DELETE FROM subscriber_lists sl WHERE sl.list_id = $3 AND sl.status != 'unsubscribed'
+        AND NOT EXISTS (SELECT 1 FROM subs WHERE subs.id = sl.subscriber_id)
+),
+ins AS (
+    INSERT INTO subscriber_lists (subscriber_id, list_id, status)
+        (SELECT id, $3, 'confirmed' FROM subs) ON CONFLICT (subscriber_id, list_id) DO NOTHING
+)
+UPDATE lists SET refreshed_at=NOW() WHERE id = $3;
+
+-- name: archive-list
+UPDATE lists SET archived=$2, archived_at=(CASE WHEN NOT $2 THEN NULL WHEN archived THEN archived_at ELSE NOW() END), updated_at=NOW()
+    WHERE id = $1;
+
 -- name: update-lists-date
 UPDATE lists SET updated_at=NOW() WHERE id = ANY($1);
 
 -- name: delete-lists
 DELETE FROM lists WHERE id = ALL($1);
 
+-- name: merge-lists
+-- Merges the list $2 into the list $1. The subscriptions to $2 are moved to $1 with their status,
+-- and for subscribers on both lists, the status on $1 is decided by the rule $3: target keeps
+-- the status on $1, source takes the one on $2, and confirmed and unsubscribed take the most and
+-- the least subscribed status of the two. Campaigns that are yet to finish are retargeted, where
+-- exclusions of $2 are replaced with $1 unless the campaign is sent to $1, as are the exclusions
+-- of $2 by other lists. Returns the number of subscriptions that are (or would be) changed and
+-- campaigns that are retargeted. Nothing is changed if $4 = true.
+WITH src AS (
+    SELECT subscriber_id, status FROM subscriber_lists WHERE list_id = $2
+),
+conflicts AS (
+    SELECT s.subscriber_id, t.status AS old_status,
+        (CASE $3
+            WHEN 'source' THEN s.status
+            WHEN 'confirmed' THEN (CASE WHEN 'confirmed' IN (s.status, t.status) THEN 'confirmed'
+                WHEN 'unconfirmed' IN (s.status, t.status) THEN 'unconfirmed' ELSE 'unsubscribed' END)::subscription_status
+            WHEN 'unsubscribed' THEN (CASE WHEN 'unsubscribed' IN (s.status, t.status) THEN 'unsubscribed'
+                WHEN 'unconfirmed' IN (s.status, t.status) THEN 'unconfirmed' ELSE 'confirmed' END)::subscription_status
+            ELSE t.status
+        END) AS new_status
+    FROM src s JOIN subscriber_lists t ON (t.subscriber_id = s.subscriber_id AND t.list_id = $1)
+),
+camps AS (
+    SELECT id, EXISTS (SELECT 1 FROM campaign_lists WHERE campaign_id = campaigns.id AND list_id = $1) AS has_target
+    FROM campaigns WHERE status IN ('draft', 'scheduled', 'running', 'paused')
+        AND ($2 = ANY(exclude_list_ids) OR EXISTS (SELECT 1 FROM campaign_lists WHERE campaign_id = campaigns.id AND list_id = $2))
+),
+moved AS (
+    UPDATE subscriber_lists SET list_id = $1, updated_at = NOW()
+    WHERE NOT $4 AND list_id = $2 AND subscriber_id NOT IN (SELECT subscriber_id FROM conflicts)
+),
+updated AS (
+    UPDATE subscriber_lists sl SET status = c.new_status, updated_at = NOW() FROM conflicts c
+    WHERE NOT $4 AND sl.list_id = $1 AND sl.subscriber_id = c.subscriber_id AND c.new_status != c.old_status
+),
+deleted AS (
+    DELETE FROM subscriber_lists WHERE NOT $4 AND list_id = $2 AND subscriber_id IN (SELECT subscriber_id FROM conflicts)
+),
+retargeted AS (
+    UPDATE campaign_lists SET list_id = $1, list_name = (SELECT name FROM lists WHERE id = $1)
+    WHERE NOT $4 AND list_id = $2 AND campaign_id IN (SELECT id FROM camps WHERE NOT has_target)
+),
+dropped AS (
+    DELETE FROM campaign_lists WHERE NOT $4 AND list_id = $2 AND campaign_id IN (SELECT id FROM camps WHERE has_target)
+),
+excluded AS (
+    UPDATE campaigns SET exclude_list_ids = (CASE WHEN camps.has_target THEN ARRAY_REMOVE(exclude_list_ids, $2)
+        ELSE ARRAY_REPLACE(exclude_list_ids, $2, $1) END), updated_at = NOW()
+    FROM camps WHERE NOT $4 AND campaigns.id = camps.id AND $2 = ANY(campaigns.exclude_list_ids)
+),
+listExcluded AS (
+    UPDATE lists SET exclude_list_ids = (CASE WHEN id = $1 THEN ARRAY_REMOVE(exclude_list_ids, $2)
+        ELSE ARRAY_REPLACE(exclude_list_ids, $2, $1) END), updated_at = NOW()
+    WHERE NOT $4 AND $2 = ANY(exclude_list_ids)
+)
+SELECT (SELECT COUNT(*) FROM src) - (SELECT COUNT(*) FROM conflicts) AS moved,
+    (SELECT COUNT(*) FROM conflicts) AS conflicts,
+    (SELECT COUNT(*) FROM conflicts WHERE new_status != old_status) AS status_changed,
+    (SELECT COUNT(*) FROM camps) AS campaigns;
+
+-- name: get-list-bundle-subscribers
+-- Returns a batch of $3 subscribers of the list $1 after the subscriber ID $2 with their
+-- subscription statuses, for a list bundle. Soft-deleted subscribers are left out.
+SELECT subscribers.id, subscribers.email, subscribers.name, subscribers.attribs, subscribers.status,
+    subscribers.tags, subscribers.locale, subscribers.timezone,
+    subscriber_lists.status AS subscription_status, subscriber_lists.created_at AS subscription_created_at
+    FROM subscriber_lists
+    INNER JOIN subscribers ON (subscribers.id = subscriber_lists.subscriber_id)
+    WHERE subscriber_lists.list_id = $1 AND subscribers.id > $2 AND subscribers.status != 'deleted'
+    ORDER BY subscribers.id LIMIT $3;
+
+-- name: import-list-bundle-subscribers
+-- Creates the subscribers in the JSON array $2 that don't exist and subscribes all of them to
+-- the list $1 with their subscription statuses. Existing subscribers are left as they are other
+-- than their subscription to the list. Returns the number of created and subscribed subscribers.
+WITH subs AS (
+    SELECT * FROM JSONB_TO_RECORDSET($2::JSONB) AS x(uuid UUID, email TEXT, name TEXT, attribs JSONB,
+        status subscriber_status, tags VARCHAR(100)[], locale TEXT, timezone TEXT,
+        subscription_status subscription_status, subscription_created_at TIMESTAMP WITH TIME ZONE)
+),
+ins AS (
+    INSERT INTO subscribers (uuid, email, name, attribs, status, tags, locale, timezone)
+        SELECT uuid, email, name, COALESCE(attribs, '{}'), status, COALESCE(tags, '{}'), locale, timezone FROM subs
+        ON CONFLICT DO NOTHING
+        RETURNING id, email
+),
+ids AS (
+    SELECT id, email FROM ins
+    UNION ALL
+    SELECT id, LOWER(email) FROM subscribers WHERE LOWER(email) = ANY(SELECT email FROM subs)
+),
+subscribed AS (
+    INSERT INTO subscriber_lists (subscriber_id, list_id, status, created_at)
+        SELECT ids.id, $1, subs.subscription_status, COALESCE(subs.subscription_created_at, NOW())
+        FROM subs INNER JOIN ids ON (ids.email = subs.email)
+        ON CONFLICT (subscriber_id, list_id) DO UPDATE SET status = EXCLUDED.status, updated_at = NOW()
+        RETURNING subscriber_id
+)
+SELECT (SELECT COUNT(*) FROM ins) AS created, (SELECT COUNT(*) FROM subscribed) AS subscribed;
+
+-- name: record-list-snapshots
+-- Records the counts of the subscribers in every list by their status on the day $1.
+-- Blocklisted subscribers are counted as blocklisted regardless of their subscription status,
+-- and soft-deleted subscribers aren't counted.
+INSERT INTO list_snapshots (list_id, date, confirmed, unconfirmed, unsubscribed, blocklisted)
+    SELECT lists.id, $1::DATE,
+        COUNT(*) FILTER (WHERE subscribers.status IN ('enabled', 'disabled') AND subscriber_lists.status = 'confirmed'),
+        COUNT(*) FILTER (WHERE subscribers.status IN ('enabled', 'disabled') AND subscriber_lists.status = 'unconfirmed'),
+        COUNT(*) FILTER (WHERE subscribers.status IN ('enabled', 'disabled') AND subscriber_lists.status = 'unsubscribed'),
+        COUNT(*) FILTER (WHERE subscribers.status = 'blocklisted')
+    FROM lists
+    LEFT JOIN subscriber_lists ON (subscriber_lists.list_id = lists.id)
+    LEFT JOIN subscribers ON (subscribers.id = subscriber_lists.subscriber_id)
+    GROUP BY lists.id
+ON CONFLICT (list_id, date) DO UPDATE SET confirmed = EXCLUDED.confirmed, unconfirmed = EXCLUDED.unconfirmed,
+    unsubscribed = EXCLUDED.unsubscribed, blocklisted = EXCLUDED.blocklisted;
+
+-- name: get-list-snapshots
+-- Returns the daily snapshots of the lists $1, or all lists if it's empty, between the days $2 and $3.
+SELECT list_snapshots.list_id, lists.name AS list_name, TO_CHAR(list_snapshots.date, 'YYYY-MM-DD') AS date,
+    confirmed, unconfirmed, unsubscribed, blocklisted
+    FROM list_snapshots
+    LEFT JOIN lists ON (lists.id = list_snapshots.list_id)
+    WHERE (CARDINALITY($1::INT[]) = 0 OR list_snapshots.list_id = ANY($1)) AND list_snapshots.date BETWEEN $2::DATE AND $3::DATE
+    ORDER BY list_snapshots.list_id, list_snapshots.date;
+
+
+-- name: get-list-optin-reminder-stats
+-- Returns the numbers of the list's subscribers who were sent opt-in reminders and who confirmed
+-- after them, overall and by the number of reminders they were sent, and the ones who confirmed
+-- without a reminder.
+WITH sl AS (
+    SELECT status, optin_reminders FROM subscriber_lists WHERE list_id = $1
+),
+attempts AS (
+    SELECT optin_reminders AS attempt, COUNT(*) AS subscribers,
+        COUNT(*) FILTER (WHERE status = 'confirmed') AS confirmed
+    FROM sl WHERE optin_reminders > 0 GROUP BY optin_reminders
+)
+SELECT COUNT(*) FILTER (WHERE optin_reminders > 0) AS reminded,
+    COALESCE(SUM(optin_reminders), 0) AS reminders_sent,
+    COUNT(*) FILTER (WHERE optin_reminders > 0 AND status = 'confirmed') AS confirmed,
+    COUNT(*) FILTER (WHERE optin_reminders = 0 AND status = 'confirmed') AS confirmed_without_reminder,
+    COUNT(*) FILTER (WHERE status = 'unconfirmed') AS unconfirmed,
+    COALESCE((SELECT JSON_AGG(a ORDER BY a.attempt) FROM attempts a), '[]') AS attempts
+    FROM sl;
+
+-- name: get-list-stats
+-- Returns the growth, churn, and confirmation rate of the list $1 in the last $2 days, and the
+-- average unique open, click, and bounce rates of the regular campaigns sent to it that were
+-- started in them. Rates are percentages. Churn is of the subscribers at the start of the window,
+-- and the confirmation rate is of the subscriptions made in it.
+WITH since AS (
+    SELECT NOW() - ($2 * INTERVAL '1 day') AS t
+),
+sl AS (
+    SELECT status, created_at, updated_at FROM subscriber_lists WHERE list_id = $1
+),
+counts AS (
+    SELECT COUNT(*) FILTER (WHERE status != 'unsubscribed') AS subscribers,
+        COUNT(*) FILTER (WHERE created_at < since.t
+            AND NOT (status = 'unsubscribed' AND updated_at < since.t)) AS subscribers_start,
+        COUNT(*) FILTER (WHERE created_at >= since.t) AS subscribed,
+        COUNT(*) FILTER (WHERE created_at >= since.t AND status = 'confirmed') AS confirmed,
+        COUNT(*) FILTER (WHERE status = 'unsubscribed' AND updated_at >= since.t) AS unsubscribed
+    FROM sl, since
+),
+camps AS (
+    SELECT c.id, c.sent FROM campaigns c
+    JOIN campaign_lists cl ON (cl.campaign_id = c.id)
+    WHERE cl.list_id = $1 AND c.type = 'regular' AND c.sent > 0
+        AND c.started_at >= (SELECT t FROM since)
+),
+rates AS (
+    SELECT
+        (SELECT COUNT(DISTINCT subscriber_id) FROM campaign_views WHERE campaign_id = camps.id)::FLOAT / camps.sent AS opens,
+        (SELECT COUNT(DISTINCT subscriber_id) FROM link_clicks WHERE campaign_id = camps.id)::FLOAT / camps.sent AS clicks,
+        (SELECT COUNT(DISTINCT subscriber_id) FROM bounces WHERE campaign_id = camps.id)::FLOAT / camps.sent AS bounces
+    FROM camps
+)
+SELECT counts.subscribers, counts.subscribers_start, counts.subscribed, counts.unsubscribed,
+    counts.subscribed - counts.unsubscribed AS net_growth,
+    COALESCE(ROUND((counts.subscribed - counts.unsubscribed) * 100.0 / NULLIF(counts.subscribers_start, 0), 2), 0) AS growth_rate,
+    COALESCE(ROUND(counts.unsubscribed * 100.0 / NULLIF(counts.subscribers_start, 0), 2), 0) AS churn_rate,
+    COALESCE(ROUND(counts.confirmed * 100.0 / NULLIF(counts.subscribed, 0), 2), 0) AS confirmation_rate,
+    (SELECT COUNT(*) FROM camps) AS campaigns,
+    COALESCE((SELECT ROUND((AVG(opens) * 100)::NUMERIC, 2) FROM rates), 0) AS open_rate,
+    COALESCE((SELECT ROUND((AVG(clicks) * 100)::NUMERIC, 2) FROM rates), 0) AS click_rate,
+    COALESCE((SELECT ROUND((AVG(bounces) * 100)::NUMERIC, 2) FROM rates), 0) AS bounce_rate
+    FROM counts;
 
 -- campaigns
 -- name: create-campaign
@@ -493,18 +1570,36 @@ counts AS (
     )
     WHERE subscriber_lists.list_id=ANY($14::INT[])
     AND subscribers.status='enabled'
+    -- Subscribers in any of the excluded lists are not sent to.
+    AND NOT EXISTS (
+        SELECT 1 FROM subscriber_lists x WHERE x.subscriber_id = subscribers.id
+        AND x.list_id = ANY($35::INT[]) AND x.status != 'unsubscribed'
+    )
+    -- Only the subscribers in any of the segments are sent to, if there are segments.
+    AND (CARDINALITY($39::INT[]) = 0 OR EXISTS (
+        SELECT 1 FROM segment_subscribers WHERE segment_id = ANY($39::INT[]) AND subscriber_id = subscribers.id
+    ))
+    -- Only the subscribers with any of the tags are sent to, if there are tags.
+    AND (CARDINALITY($40::VARCHAR(100)[]) = 0 OR subscribers.tags && $40::VARCHAR(100)[])
 ),
 camp AS (
-    INSERT INTO campaigns (uuid, type, name, subject, from_email, body, altbody, content_type, send_at, headers, tags, messenger, template_id, to_send, max_subscriber_id, archive, archive_slug, archive_template_id, archive_meta)
+    INSERT INTO campaigns (uuid, type, name, subject, from_email, body, altbody, content_type, send_at, headers, tags, messenger, template_id, to_send, max_subscriber_id, archive, archive_slug, archive_template_id, archive_meta, send_at_local, body_amp, failover_messengers, content_blocks, utm_params, tracking_domain, send_until, send_window, priority, list_id_header, archive_access, archive_password, freeze_recipients, lang_variants, engagement_rules, exclude_list_ids, rollout, preheader, send_at_timezone, send_at_wall, segment_ids, subscriber_tags)
         SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12,
             (SELECT id FROM tpl), (SELECT to_send FROM counts),
             (SELECT max_sub_id FROM counts), $15, $16,
-            (CASE WHEN $17 = 0 THEN (SELECT id FROM tpl) ELSE $17 END), $18
-        RETURNING id
+            (CASE WHEN $17 = 0 THEN (SELECT id FROM tpl) ELSE $17 END), $18, $20,
+            (CASE WHEN $21 = '' THEN NULL ELSE $21 END), $22, $23, $24, $25, $26, $27, $28, $29, $30, $31, $32, $33, $34, $35, $36, $37, $38,
+            (CASE WHEN $38 != '' THEN $9::TIMESTAMP WITH TIME ZONE AT TIME ZONE $38 ELSE NULL END), $39, $40
+        RETURNING id, subject, body, altbody, body_amp, content_type, template_id, content_blocks
 ),
 med AS (
     INSERT INTO campaign_media (campaign_id, media_id, filename)
         (SELECT (SELECT id FROM camp), id, filename FROM media WHERE id=ANY($19::INT[]))
+),
+rev AS (
+    -- The first revision of the content.
+    INSERT INTO campaign_revisions (campaign_id, subject, body, altbody, body_amp, content_type, template_id, content_blocks)
+        SELECT id, subject, body, altbody, body_amp, content_type, template_id, content_blocks FROM camp
 )
 INSERT INTO campaign_lists (campaign_id, list_id, list_name)
     (SELECT (SELECT id FROM camp), id, name FROM lists WHERE id=ANY($14::INT[]))
@@ -518,10 +1613,13 @@ INSERT INTO campaign_lists (campaign_id, list_id, list_name)
 -- for pagination in the frontend, albeit being a field that'll repeat
 -- with every resultant row.
 SELECT  c.id, c.uuid, c.name, c.subject, c.from_email,
-        c.messenger, c.started_at, c.to_send, c.sent, c.type,
-        c.body, c.altbody, c.send_at, c.headers, c.status, c.content_type, c.tags,
-        c.template_id, c.archive, c.archive_slug, c.archive_template_id, c.archive_meta,
-        c.created_at, c.updated_at,
+        c.messenger, c.failover_messengers, c.started_at, c.to_send, c.sent, c.segments, c.cost, c.type,
+        c.body, c.altbody, c.body_amp, c.preheader,
+        -- Campaigns scheduled in a timezone are sent at the wall-clock time in it.
+        (CASE WHEN c.send_at_wall IS NOT NULL THEN c.send_at_wall AT TIME ZONE c.send_at_timezone ELSE c.send_at END) AS send_at,
+        c.send_at_timezone, c.send_at_wall, c.send_at_local, c.send_until, c.send_window, c.priority, c.list_id_header, c.freeze_recipients, c.recipients_frozen_at, c.retrying, c.expired, c.rollout, c.rollout_held_until, c.rollout_checked_at, c.headers, c.status, c.content_type, c.tags,
+        c.template_id, c.archive, c.archive_slug, c.archive_template_id, c.archive_meta, c.archive_access,
+        c.content_blocks, c.lang_variants, c.engagement_rules, c.exclude_list_ids, c.segment_ids, c.subscriber_tags, c.utm_params, c.tracking_domain, c.content_version, c.created_at, c.updated_at,
         COUNT(*) OVER () AS total,
         (
             SELECT COALESCE(ARRAY_TO_JSON(ARRAY_AGG(l)), '[]') FROM (
@@ -533,13 +1631,16 @@ SELECT  c.id, c.uuid, c.name, c.subject, c.from_email,
 FROM campaigns c
 WHERE ($1 = 0 OR id = $1)
     AND (CARDINALITY($2::campaign_status[]) = 0 OR status = ANY($2))
-    AND (CARDINALITY($3::VARCHAR(100)[]) = 0 OR $3 <@ tags)
+    -- Campaigns that have all the given tags, or any of them.
+    AND (CARDINALITY($3::VARCHAR(100)[]) = 0 OR (CASE WHEN $7 = 'any' THEN $3 && tags ELSE $3 <@ tags END))
     AND ($4 = '' OR TO_TSVECTOR(CONCAT(name, ' ', subject)) @@ TO_TSQUERY($4) OR CONCAT(c.name, ' ', c.subject) ILIKE $4)
 ORDER BY %order% OFFSET $5 LIMIT (CASE WHEN $6 < 1 THEN NULL ELSE $6 END);
 
 -- name: get-campaign
 SELECT campaigns.*,
-    COALESCE(templates.body, (SELECT body FROM templates WHERE is_default = true LIMIT 1)) AS template_body
+    COALESCE(templates.body, (SELECT body FROM templates WHERE is_default = true LIMIT 1)) AS template_body,
+    COALESCE(templates.lang_variants, (SELECT lang_variants FROM templates WHERE is_default = true LIMIT 1)) AS template_lang_variants,
+    COALESCE(templates.preheader, (SELECT preheader FROM templates WHERE is_default = true LIMIT 1)) AS template_preheader
     FROM campaigns
     LEFT JOIN templates ON (
         CASE WHEN $4 = 'default' THEN templates.id = campaigns.template_id
@@ -553,7 +1654,9 @@ SELECT campaigns.*,
 
 -- name: get-archived-campaigns
 SELECT COUNT(*) OVER () AS total, campaigns.*,
-    COALESCE(templates.body, (SELECT body FROM templates WHERE is_default = true LIMIT 1)) AS template_body
+    COALESCE(templates.body, (SELECT body FROM templates WHERE is_default = true LIMIT 1)) AS template_body,
+    COALESCE(templates.lang_variants, (SELECT lang_variants FROM templates WHERE is_default = true LIMIT 1)) AS template_lang_variants,
+    COALESCE(templates.preheader, (SELECT preheader FROM templates WHERE is_default = true LIMIT 1)) AS template_preheader
     FROM campaigns
     LEFT JOIN templates ON (
         CASE WHEN $3 = 'default' THEN templates.id = campaigns.template_id
@@ -604,8 +1707,22 @@ LEFT JOIN clicks AS c ON (c.campaign_id = id)
 LEFT JOIN bounces AS b ON (b.campaign_id = id)
 ORDER BY ARRAY_POSITION($1, id);
 
+-- name: get-campaign-costs
+-- Returns the estimated costs of campaigns started between two dates.
+SELECT id, name, tags, messenger, status, sent, segments, cost, started_at FROM campaigns
+    WHERE started_at IS NOT NULL AND started_at >= $1::TIMESTAMP WITH TIME ZONE AND started_at <= $2::TIMESTAMP WITH TIME ZONE
+    ORDER BY started_at DESC;
+
 -- name: get-campaign-for-preview
 SELECT campaigns.*, COALESCE(templates.body, (SELECT body FROM templates WHERE is_default = true LIMIT 1)) AS template_body,
+    COALESCE(templates.lang_variants, (SELECT lang_variants FROM templates WHERE is_default = true LIMIT 1)) AS template_lang_variants,
+    COALESCE(templates.body_amp, (SELECT body_amp FROM templates WHERE is_default = true LIMIT 1)) AS template_body_amp,
+    COALESCE(templates.preheader, (SELECT preheader FROM templates WHERE is_default = true LIMIT 1)) AS template_preheader,
+    -- The tracking domain of the first of the campaign's lists that has one.
+    COALESCE((SELECT lists.tracking_domain FROM campaign_lists
+        INNER JOIN lists ON (lists.id = campaign_lists.list_id)
+        WHERE campaign_lists.campaign_id = campaigns.id AND lists.tracking_domain != ''
+        ORDER BY lists.id LIMIT 1), '') AS list_tracking_domain,
 (
 	SELECT COALESCE(ARRAY_TO_JSON(ARRAY_AGG(l)), '[]') FROM (
 		SELECT COALESCE(campaign_lists.list_id, 0) AS id,
@@ -618,10 +1735,18 @@ LEFT JOIN templates ON (templates.id = (CASE WHEN $2=0 THEN campaigns.template_i
 WHERE campaigns.id = $1;
 
 -- name: get-campaign-status
-SELECT id, status, to_send, sent, started_at, updated_at
+SELECT id, status, to_send, sent, segments, cost, started_at, updated_at
     FROM campaigns
     WHERE status=$1;
 
+-- name: get-campaign-progress
+-- Progress stats of a campaign with its bounce (of any type) and complaint counts.
+SELECT id, status, to_send, sent, segments, cost, started_at, updated_at,
+    (SELECT COUNT(*) FROM bounces WHERE campaign_id = $1) AS bounces,
+    (SELECT COUNT(*) FROM bounces WHERE campaign_id = $1 AND type = 'complaint') AS complaints
+    FROM campaigns
+    WHERE id=$1;
+
 -- name: next-campaigns
 -- Retreives campaigns that are running (or scheduled and the time's up) and need
 -- to be processed. It updates the to_send count and max_subscriber_id of the campaign,
@@ -631,10 +1756,29 @@ SELECT id, status, to_send, sent, started_at, updated_at
 -- a campaign. This is used to fetch and slice subscribers for the campaign in next-campaign-subscribers.
 WITH camps AS (
     -- Get all running campaigns and their template bodies (if the template's deleted, the default template body instead)
-    SELECT campaigns.*, COALESCE(templates.body, (SELECT body FROM templates WHERE is_default = true LIMIT 1)) AS template_body
+    SELECT campaigns.*, COALESCE(templates.body, (SELECT body FROM templates WHERE is_default = true LIMIT 1)) AS template_body,
+        COALESCE(templates.lang_variants, (SELECT lang_variants FROM templates WHERE is_default = true LIMIT 1)) AS template_lang_variants,
+        COALESCE(templates.body_amp, (SELECT body_amp FROM templates WHERE is_default = true LIMIT 1)) AS template_body_amp,
+        COALESCE(templates.preheader, (SELECT preheader FROM templates WHERE is_default = true LIMIT 1)) AS template_preheader,
+        -- The tracking domain of the first of the campaign's lists that has one.
+        COALESCE((SELECT lists.tracking_domain FROM campaign_lists
+            INNER JOIN lists ON (lists.id = campaign_lists.list_id)
+            WHERE campaign_lists.campaign_id = campaigns.id AND lists.tracking_domain != ''
+            ORDER BY lists.id LIMIT 1), '') AS list_tracking_domain,
+        -- The lists excluded by the campaign's lists.
+        list_exclusions(ARRAY(SELECT list_id FROM campaign_lists WHERE campaign_id = campaigns.id)) AS list_exclude_ids
     FROM campaigns
     LEFT JOIN templates ON (templates.id = campaigns.template_id)
-    WHERE (status='running' OR (status='scheduled' AND NOW() >= campaigns.send_at))
+    WHERE (status='running' OR (status='scheduled' AND NOW() >= (
+        -- Campaigns scheduled in a timezone start at the wall-clock time in it
+        -- per the current timezone rules, so that they don't drift across DST changes.
+        CASE WHEN campaigns.send_at_wall IS NOT NULL THEN campaigns.send_at_wall AT TIME ZONE campaigns.send_at_timezone
+        ELSE campaigns.send_at END
+    ) - (
+        -- Local time campaigns start early enough to reach the subscribers in the
+        -- earliest timezone, which is $3 seconds ahead of send_at.
+        CASE WHEN campaigns.send_at_local THEN $3::INT * INTERVAL '1 second' ELSE INTERVAL '0' END
+    )))
     AND NOT(campaigns.id = ANY($1::INT[]))
 ),
 campLists AS (
@@ -659,6 +1803,25 @@ counts AS (
     LEFT JOIN campLists ON (campLists.campaign_id = camps.id)
     LEFT JOIN subscriber_lists ON (
         subscriber_lists.list_id = campLists.list_id AND
+        -- Campaigns with frozen recipients are only sent to them.
+        (camps.recipients_frozen_at IS NULL OR EXISTS (
+            SELECT 1 FROM campaign_recipients WHERE campaign_id = camps.id AND subscriber_id = subscriber_lists.subscriber_id
+        )) AND
+        -- Subscribers in any of the campaign's excluded lists, or the lists excluded
+        -- by its lists, are not sent to.
+        NOT EXISTS (
+            SELECT 1 FROM subscriber_lists x WHERE x.subscriber_id = subscriber_lists.subscriber_id
+            AND x.list_id = ANY(camps.exclude_list_ids || camps.list_exclude_ids) AND x.status != 'unsubscribed'
+        ) AND
+        -- Campaigns with segments are only sent to the subscribers in any of them.
+        (CARDINALITY(camps.segment_ids) = 0 OR EXISTS (
+            SELECT 1 FROM segment_subscribers WHERE segment_id = ANY(camps.segment_ids)
+            AND segment_subscribers.subscriber_id = subscriber_lists.subscriber_id
+        )) AND
+        -- Campaigns with subscriber tags are only sent to the subscribers with any of them.
+        (CARDINALITY(camps.subscriber_tags) = 0 OR EXISTS (
+            SELECT 1 FROM subscribers t WHERE t.id = subscriber_lists.subscriber_id AND t.tags && camps.subscriber_tags
+        )) AND
         (CASE
             -- For optin campaigns, only e-mail 'unconfirmed' subscribers belonging to 'double' optin lists.
             WHEN camps.type = 'optin' THEN subscriber_lists.status = 'unconfirmed' AND campLists.optin = 'double'
@@ -674,9 +1837,9 @@ counts AS (
     GROUP BY camps.id
 ),
 updateCounts AS (
-    WITH uc (campaign_id, sent_count) AS (SELECT * FROM unnest($1::INT[], $2::INT[]))
+    WITH uc (campaign_id, sent_count, segment_count, cost) AS (SELECT * FROM unnest($1::INT[], $2::INT[], $4::INT[], $5::NUMERIC[]))
     UPDATE campaigns
-    SET sent = sent + uc.sent_count
+    SET sent = sent + uc.sent_count, segments = segments + uc.segment_count, cost = cost + uc.cost
     FROM uc WHERE campaigns.id = uc.campaign_id
 ),
 u AS (
@@ -684,6 +1847,8 @@ u AS (
     UPDATE campaigns AS ca
     SET to_send = co.to_send,
         status = (CASE WHEN status != 'running' THEN 'running' ELSE status END),
+        send_at = (CASE WHEN ca.status = 'scheduled' AND ca.send_at_wall IS NOT NULL
+            THEN ca.send_at_wall AT TIME ZONE ca.send_at_timezone ELSE ca.send_at END),
         max_subscriber_id = co.max_subscriber_id,
         started_at=(CASE WHEN ca.started_at IS NULL THEN NOW() ELSE ca.started_at END)
     FROM (SELECT * FROM counts) co
@@ -735,12 +1900,26 @@ SELECT COUNT(%s) AS "count", url
     WHERE campaign_id=ANY($1) AND link_clicks.created_at >= $2 AND link_clicks.created_at <= $3
     GROUP BY links.url ORDER BY "count" DESC LIMIT 50;
 
+-- name: get-campaign-link-clicks
+-- Clicks on each of a campaign's links by their positions in the body. Clicks
+-- that were recorded without a position have a NULL position.
+SELECT links.url, link_clicks.position, COUNT(*) AS clicks,
+    COUNT(DISTINCT link_clicks.subscriber_id) AS unique_clicks
+    FROM link_clicks
+    INNER JOIN links ON (links.id = link_clicks.link_id)
+    WHERE link_clicks.campaign_id = $1
+    GROUP BY links.url, link_clicks.position
+    ORDER BY link_clicks.position NULLS LAST, clicks DESC;
+
 -- name: next-campaign-subscribers
 -- Returns a batch of subscribers in a given campaign starting from the last checkpoint
 -- (last_subscriber_id). Every fetch updates the checkpoint and the sent count, which means
 -- every fetch returns a new batch of subscribers until all rows are exhausted.
+-- If $3 (timezones) is not empty, only subscribers whose timezone is one of them are returned.
 WITH camps AS (
-    SELECT last_subscriber_id, max_subscriber_id, type FROM campaigns WHERE id = $1 AND status='running'
+    SELECT last_subscriber_id, max_subscriber_id, type, recipients_frozen_at, content_version, retrying,
+        exclude_list_ids || list_exclusions(ARRAY(SELECT list_id FROM campaign_lists WHERE campaign_id = $1)) AS exclude_list_ids,
+        segment_ids, subscriber_tags FROM campaigns WHERE id = $1 AND status='running'
 ),
 campLists AS (
     SELECT lists.id AS list_id, optin FROM lists
@@ -755,14 +1934,36 @@ subIDs AS (
         list_id = ANY((SELECT ARRAY_AGG(list_id) FROM campLists)::INT[]) AND
         status != 'unsubscribed' AND
         subscriber_id > (SELECT last_subscriber_id FROM camps) AND
-        subscriber_id <= (SELECT max_subscriber_id FROM camps)
+        subscriber_id <= (SELECT max_subscriber_id FROM camps) AND
+        ((SELECT recipients_frozen_at FROM camps) IS NULL OR EXISTS (
+            SELECT 1 FROM campaign_recipients WHERE campaign_id = $1 AND campaign_recipients.subscriber_id = subscriber_lists.subscriber_id
+        )) AND
+        NOT EXISTS (
+            SELECT 1 FROM subscriber_lists x WHERE x.subscriber_id = subscriber_lists.subscriber_id
+            AND x.list_id = ANY((SELECT exclude_list_ids FROM camps)) AND x.status != 'unsubscribed'
+        ) AND
+        (CARDINALITY((SELECT segment_ids FROM camps)) = 0 OR EXISTS (
+            SELECT 1 FROM segment_subscribers WHERE segment_id = ANY((SELECT segment_ids FROM camps))
+            AND segment_subscribers.subscriber_id = subscriber_lists.subscriber_id
+        )) AND
+        (CARDINALITY((SELECT subscriber_tags FROM camps)) = 0 OR EXISTS (
+            SELECT 1 FROM subscribers t WHERE t.id = subscriber_lists.subscriber_id AND t.tags && (SELECT subscriber_tags FROM camps)
+        )) AND
+        -- Campaigns that are retrying errored messages are only sent to the subscribers whose messages were re-queued.
+        (NOT (SELECT retrying FROM camps) OR EXISTS (
+            SELECT 1 FROM campaign_deliveries WHERE campaign_id = $1 AND campaign_deliveries.subscriber_id = subscriber_lists.subscriber_id
+            AND campaign_deliveries.status = 'queued'
+        )) AND
+        (CARDINALITY($3::TEXT[]) = 0 OR subscriber_id = ANY(
+            SELECT id FROM subscribers WHERE timezone = ANY($3::TEXT[])
+        ))
     ORDER BY subscriber_id LIMIT $2
 ),
 subs AS (
     SELECT subscribers.* FROM subIDs
     LEFT JOIN campLists ON (campLists.list_id = subIDs.list_id)
     INNER JOIN subscribers ON (
-        subscribers.status != 'blocklisted' AND
+        subscribers.status NOT IN ('blocklisted', 'deleted') AND
         subscribers.id = subIDs.subscriber_id AND
 
         (CASE
@@ -782,9 +1983,37 @@ u AS (
     UPDATE campaigns
     SET last_subscriber_id = (SELECT MAX(id) FROM subs), updated_at = NOW()
     WHERE (SELECT COUNT(id) FROM subs) > 0 AND id=$1
+),
+queued AS (
+    -- Record the messages as queued in the delivery log. Retried messages are already queued.
+    INSERT INTO campaign_deliveries (campaign_id, content_version, subscriber_id, messenger, status)
+        SELECT $1, (SELECT content_version FROM camps), id, '', 'queued' FROM subs WHERE NOT (SELECT retrying FROM camps)
 )
 SELECT * FROM subs;
 
+-- name: get-campaign-timezones
+-- Returns the distinct timezones of the subscribers in a campaign's lists.
+SELECT DISTINCT subscribers.timezone FROM subscribers
+    INNER JOIN subscriber_lists ON (subscriber_lists.subscriber_id = subscribers.id)
+    WHERE subscriber_lists.list_id = ANY(SELECT list_id FROM campaign_lists WHERE campaign_id = $1)
+    AND subscriber_lists.status != 'unsubscribed';
+
+-- name: update-campaign-tz-bucket
+-- Moves a local time campaign to the next timezone bucket and resets the subscriber checkpoint.
+UPDATE campaigns SET tz_bucket_at=$2, last_subscriber_id=0, updated_at=NOW() WHERE id=$1;
+
+-- name: update-campaign-rollout
+-- Records the time until which a staged campaign is held after its initial stage, and
+-- whether its bounce and complaint rates have been checked after the hold.
+UPDATE campaigns SET rollout_held_until=$2,
+    rollout_checked_at=(CASE WHEN $3 THEN NOW() ELSE NULL END), updated_at=NOW() WHERE id=$1;
+
+-- name: count-campaign-bounces
+-- Returns the number of subscribers who bounced, and who complained about, a campaign.
+SELECT COUNT(DISTINCT subscriber_id) FILTER (WHERE type != 'complaint') AS bounces,
+    COUNT(DISTINCT subscriber_id) FILTER (WHERE type = 'complaint') AS complaints
+    FROM bounces WHERE campaign_id = $1;
+
 -- name: delete-campaign-views
 DELETE FROM campaign_views WHERE created_at < $1;
 
@@ -796,11 +2025,14 @@ SELECT * FROM subscribers
 LEFT JOIN subscriber_lists ON (subscribers.id = subscriber_lists.subscriber_id AND subscriber_lists.status != 'unsubscribed')
 WHERE subscriber_lists.list_id=ANY(
     SELECT list_id FROM campaign_lists where campaign_id=$1 AND list_id IS NOT NULL
-)
+) AND subscribers.status != 'deleted'
 ORDER BY RANDOM() LIMIT 1;
 
 -- name: update-campaign
-WITH camp AS (
+WITH prev AS (
+    SELECT * FROM campaigns WHERE id = $1
+),
+camp AS (
     UPDATE campaigns SET
         name=$2,
         subject=$3,
@@ -809,7 +2041,8 @@ WITH camp AS (
         altbody=(CASE WHEN $6 = '' THEN NULL ELSE $6 END),
         content_type=$7::content_type,
         send_at=$8::TIMESTAMP WITH TIME ZONE,
-        status=(CASE WHEN NOT $9 THEN 'draft' ELSE status END),
+        -- Paused campaigns stay paused so that they can be resumed.
+        status=(CASE WHEN status = 'paused' THEN status WHEN NOT $9 THEN 'draft' ELSE status END),
         headers=$10,
         tags=$11::VARCHAR(100)[],
         messenger=$12,
@@ -818,8 +2051,56 @@ WITH camp AS (
         archive_slug=$16,
         archive_template_id=$17,
         archive_meta=$18,
+        send_at_local=$20,
+        body_amp=(CASE WHEN $21 = '' THEN NULL ELSE $21 END),
+        failover_messengers=$22,
+        content_blocks=$23,
+        utm_params=$24,
+        tracking_domain=$25,
+        send_until=$26::TIMESTAMP WITH TIME ZONE,
+        send_window=$27,
+        priority=$28,
+        list_id_header=$29,
+        archive_access=$30,
+        archive_password=$31,
+        freeze_recipients=$32,
+        lang_variants=$33,
+        engagement_rules=$34,
+        exclude_list_ids=$35,
+        segment_ids=$39,
+        subscriber_tags=$40,
+        rollout=$36,
+        preheader=$37,
+        send_at_timezone=$38,
+        send_at_wall=(CASE WHEN $38 != '' THEN $8::TIMESTAMP WITH TIME ZONE AT TIME ZONE $38 ELSE NULL END),
+        -- Editing the content of a campaign that's already being sent creates a new version.
+        content_version=(CASE WHEN sent > 0 AND (
+            subject != $3 OR body != $5 OR COALESCE(altbody, '') != $6 OR content_type != $7::content_type OR
+            template_id IS DISTINCT FROM $13 OR COALESCE(body_amp, '') != $21 OR content_blocks != $23::JSONB OR
+            lang_variants != $33::JSONB
+        ) THEN content_version + 1 ELSE content_version END),
         updated_at=NOW()
-    WHERE id = $1 RETURNING id
+    WHERE id = $1 RETURNING id, subject, body, altbody, body_amp, content_type, template_id, content_blocks, content_version
+),
+ver AS (
+    -- Keep the previous version of the content.
+    INSERT INTO campaign_versions (campaign_id, version, subject, body, altbody, body_amp, content_type, template_id, content_blocks)
+        SELECT prev.id, prev.content_version, prev.subject, prev.body, prev.altbody, prev.body_amp,
+            prev.content_type, prev.template_id, prev.content_blocks
+        FROM prev, camp WHERE camp.content_version > prev.content_version
+        ON CONFLICT (campaign_id, version) DO NOTHING
+),
+rev AS (
+    -- Snapshot the saved content, unless it's the same as the last snapshot.
+    INSERT INTO campaign_revisions (campaign_id, subject, body, altbody, body_amp, content_type, template_id, content_blocks)
+        SELECT camp.id, camp.subject, camp.body, camp.altbody, camp.body_amp, camp.content_type, camp.template_id, camp.content_blocks
+        FROM camp WHERE NOT EXISTS (
+            SELECT 1 FROM (SELECT * FROM campaign_revisions WHERE campaign_id = $1 ORDER BY id DESC LIMIT 1) r
+            WHERE r.subject = camp.subject AND r.body = camp.body
+                AND r.altbody IS NOT DISTINCT FROM camp.altbody AND r.body_amp IS NOT DISTINCT FROM camp.body_amp
+                AND r.content_type = camp.content_type AND r.template_id IS NOT DISTINCT FROM camp.template_id
+                AND r.content_blocks = camp.content_blocks
+        )
 ),
 clists AS (
     -- Reset list relationships
@@ -842,12 +2123,389 @@ INSERT INTO campaign_lists (campaign_id, list_id, list_name)
 UPDATE campaigns SET
     to_send=(CASE WHEN $2 != 0 THEN $2 ELSE to_send END),
     sent=sent+$3,
-    last_subscriber_id=(CASE WHEN $4 > 0 THEN $4 ELSE to_send END),
+    last_subscriber_id=(CASE WHEN $4 > 0 THEN $4 ELSE last_subscriber_id END),
+    segments=segments+$5,
+    cost=cost+$6,
     updated_at=NOW()
 WHERE id=$1;
 
+-- name: rewind-campaign-subscribers
+-- Moves the checkpoint (last_subscriber_id) of the campaign $1 back to the subscriber $2, eg: when it's
+-- paused in the middle of a fetched batch, so that the rest of the batch is fetched again when it's
+-- resumed, and removes the queued delivery records of the rest. Retried messages remain queued.
+WITH camp AS (
+    UPDATE campaigns SET last_subscriber_id=$2, updated_at=NOW() WHERE id=$1 RETURNING retrying
+)
+DELETE FROM campaign_deliveries WHERE campaign_id=$1 AND subscriber_id > $2 AND status='queued'
+    AND NOT (SELECT retrying FROM camp);
+
+-- name: record-campaign-deliveries
+-- Records the outcomes of a campaign's messages, updating the messages that were queued
+-- for the subscribers, or inserting them if they weren't.
+WITH d AS (
+    SELECT * FROM UNNEST($3::INT[], $4::TEXT[], $5::delivery_status[], $6::TEXT[], $7::TEXT[]) AS d(sub_id, messenger, status, error, error_type)
+),
+u AS (
+    UPDATE campaign_deliveries SET messenger=d.messenger, status=d.status, error=d.error, error_type=d.error_type,
+        content_version=$2, updated_at=NOW()
+    FROM d WHERE campaign_deliveries.campaign_id=$1 AND campaign_deliveries.subscriber_id=d.sub_id
+    AND campaign_deliveries.status='queued'
+    RETURNING campaign_deliveries.subscriber_id
+)
+INSERT INTO campaign_deliveries (campaign_id, content_version, subscriber_id, messenger, status, error, error_type)
+    SELECT $1, $2, sub_id, messenger, status, error, error_type FROM d WHERE sub_id NOT IN (SELECT subscriber_id FROM u);
+
+-- name: get-campaign-frequency-cap
+-- The strictest of the frequency caps of a campaign's lists. 0 is no limit.
+SELECT COALESCE(MIN(NULLIF(lists.frequency_cap_daily, 0)), 0) AS daily,
+    COALESCE(MIN(NULLIF(lists.frequency_cap_weekly, 0)), 0) AS weekly
+    FROM campaign_lists
+    INNER JOIN lists ON (lists.id = campaign_lists.list_id)
+    WHERE campaign_lists.campaign_id = $1;
+
+-- name: get-subscriber-sends
+-- The times (oldest first) at which other campaigns were sent to the given
+-- subscribers in the past week, for their frequency caps.
+WITH sends AS (
+    SELECT subscriber_id, MIN(created_at) AS created_at FROM campaign_deliveries
+    WHERE subscriber_id = ANY($2::INT[]) AND campaign_id != $1
+    AND status = ANY('{queued, sent, bounced}') AND created_at > NOW() - INTERVAL '7 days'
+    GROUP BY subscriber_id, campaign_id
+)
+SELECT subscriber_id, ARRAY_AGG(EXTRACT(EPOCH FROM created_at)::BIGINT ORDER BY created_at) AS sent_at
+    FROM sends GROUP BY subscriber_id;
+
+-- name: count-messenger-deliveries
+-- Number of campaign messages delivered through a messenger since a given time.
+SELECT COUNT(*) FROM campaign_deliveries WHERE messenger=$1 AND updated_at >= $2 AND status = ANY('{sent, bounced}');
+
+-- name: add-messenger-usage
+-- Adds to the number of messages sent through messengers per day.
+INSERT INTO messenger_usage (messenger, date, sent)
+    SELECT * FROM UNNEST($1::TEXT[], $2::DATE[], $3::INT[])
+    ON CONFLICT (messenger, date) DO UPDATE SET sent = messenger_usage.sent + EXCLUDED.sent;
+
+-- name: get-messenger-usage
+-- Number of messages sent through messengers on a day ($1) and in the month
+-- of the day that starts on $2, optionally for a single messenger ($3).
+SELECT messenger, COALESCE(SUM(sent) FILTER (WHERE date = $1::DATE), 0) AS daily, SUM(sent) AS monthly
+    FROM messenger_usage
+    WHERE date >= $2::DATE AND date < $2::DATE + INTERVAL '1 month' AND ($3 = '' OR messenger = $3)
+    GROUP BY messenger ORDER BY messenger;
+
+-- name: add-domain-blocklist-hits
+-- Adds to the number of e-mails blocked by domain blocklist entries.
+INSERT INTO domain_blocklist_hits (domain, hits, last_hit_at)
+    SELECT d, h, NOW() FROM UNNEST($1::TEXT[], $2::INT[]) AS t(d, h)
+    ON CONFLICT (domain) DO UPDATE SET hits = domain_blocklist_hits.hits + EXCLUDED.hits, last_hit_at = NOW();
+
+-- name: get-domain-blocklist-hits
+SELECT domain, hits, last_hit_at FROM domain_blocklist_hits WHERE domain = ANY($1::TEXT[]);
+
+-- name: clear-domain-blocklist-hits
+DELETE FROM domain_blocklist_hits WHERE domain = ANY($1::TEXT[]);
+
+-- name: get-disposable-domains
+SELECT domain FROM disposable_domains ORDER BY domain;
+
+-- name: replace-disposable-domains
+-- Replaces the disposable e-mail domains with the domains $1, retaining the existing ones.
+WITH del AS (
+    DELETE FROM disposable_domains WHERE domain NOT IN (SELECT UNNEST($1::TEXT[]))
+)
+INSERT INTO disposable_domains (domain) SELECT DISTINCT UNNEST($1::TEXT[])
+    ON CONFLICT (domain) DO NOTHING;
+
+-- name: get-campaign-deliveries
+-- Counts of a campaign's messages by the messenger they were delivered through,
+-- optionally for a single subscriber.
+SELECT messenger, COUNT(*) AS count, MAX(updated_at) AS last_delivered_at FROM campaign_deliveries
+    WHERE campaign_id=$1 AND ($2 = 0 OR subscriber_id=$2) AND status = ANY('{sent, bounced}')
+    GROUP BY messenger ORDER BY count DESC;
+
+-- name: query-campaign-delivery-log
+-- Per-message delivery outcomes of a campaign, optionally filtered by status, subscriber, or e-mail.
+SELECT COUNT(*) OVER () AS total, campaign_deliveries.id, campaign_deliveries.subscriber_id,
+    COALESCE(subscribers.uuid::TEXT, '') AS subscriber_uuid, COALESCE(subscribers.email, '') AS email,
+    COALESCE(subscribers.name, '') AS name, campaign_deliveries.messenger, campaign_deliveries.status,
+    campaign_deliveries.error, campaign_deliveries.error_type, campaign_deliveries.retries,
+    campaign_deliveries.content_version, campaign_deliveries.created_at, campaign_deliveries.updated_at
+    FROM campaign_deliveries
+    LEFT JOIN subscribers ON (subscribers.id = campaign_deliveries.subscriber_id)
+    WHERE campaign_deliveries.campaign_id = $1
+    AND (CARDINALITY($2::delivery_status[]) = 0 OR campaign_deliveries.status = ANY($2::delivery_status[]))
+    AND ($3 = 0 OR campaign_deliveries.subscriber_id = $3)
+    AND ($4 = '' OR subscribers.email ILIKE $4)
+    ORDER BY campaign_deliveries.id OFFSET $5 LIMIT $6;
+
+-- name: insert-campaign-test
+INSERT INTO campaign_tests (campaign_id, content_version, subject, variants, recipients)
+    VALUES($1, $2, $3, $4, $5) RETURNING *;
+
+-- name: get-campaign-tests
+SELECT * FROM campaign_tests WHERE campaign_id=$1 ORDER BY id DESC;
+
+-- name: get-campaign-revisions
+SELECT * FROM campaign_revisions WHERE campaign_id=$1 ORDER BY id DESC;
+
+-- name: get-campaign-revision
+-- Returns a revision of a campaign, or if $3 is true, the one before it.
+SELECT * FROM campaign_revisions WHERE campaign_id=$1
+    AND (CASE WHEN $3 THEN id < $2 ELSE id = $2 END)
+    ORDER BY id DESC LIMIT 1;
+
+-- name: get-campaign-versions
+-- Previous and current versions of a campaign's content with the number of
+-- messages sent with each, optionally to a single subscriber.
+WITH counts AS (
+    SELECT content_version, COUNT(*) AS recipients FROM campaign_deliveries
+    WHERE campaign_id=$1 AND ($2 = 0 OR subscriber_id=$2) AND status = ANY('{sent, bounced}')
+    GROUP BY content_version
+),
+versions AS (
+    SELECT version, subject, body, altbody, body_amp, content_type, template_id, content_blocks,
+        created_at, false AS current
+        FROM campaign_versions WHERE campaign_id=$1
+    UNION ALL
+    SELECT content_version, subject, body, altbody, body_amp, content_type, template_id, content_blocks,
+        updated_at, true FROM campaigns WHERE id=$1
+)
+SELECT versions.*, COALESCE(counts.recipients, 0) AS recipients FROM versions
+    LEFT JOIN counts ON (counts.content_version = versions.version)
+    ORDER BY versions.version;
+
+-- name: get-campaign-tags
+-- Tags of all campaigns with the number of campaigns, the total messages sent,
+-- and the average unique open and click rates of the campaigns tagged with them.
+WITH tags AS (
+    SELECT UNNEST(tags) AS tag, id, sent FROM campaigns WHERE CARDINALITY(tags) > 0
+),
+views AS (
+    SELECT campaign_id, COUNT(DISTINCT subscriber_id) AS num FROM campaign_views
+    WHERE campaign_id = ANY(SELECT id FROM tags) GROUP BY campaign_id
+),
+clicks AS (
+    SELECT campaign_id, COUNT(DISTINCT subscriber_id) AS num FROM link_clicks
+    WHERE campaign_id = ANY(SELECT id FROM tags) GROUP BY campaign_id
+)
+SELECT t.tag, COUNT(*) AS campaigns, COALESCE(SUM(t.sent), 0) AS sent,
+    COALESCE(AVG(LEAST(COALESCE(v.num, 0)::FLOAT / t.sent, 1)) FILTER (WHERE t.sent > 0), 0) AS open_rate,
+    COALESCE(AVG(LEAST(COALESCE(cl.num, 0)::FLOAT / t.sent, 1)) FILTER (WHERE t.sent > 0), 0) AS click_rate
+FROM tags t
+LEFT JOIN views v ON v.campaign_id = t.id
+LEFT JOIN clicks cl ON cl.campaign_id = t.id
+GROUP BY t.tag ORDER BY t.tag;
+
+-- name: add-campaign-tag
+-- Adds a tag to the given campaigns that don't already have it.
+UPDATE campaigns SET tags = ARRAY_APPEND(COALESCE(tags, '{}'), $2), updated_at=NOW()
+    WHERE id = ANY($1::INT[]) AND NOT (COALESCE(tags, '{}') @> ARRAY[$2]::VARCHAR(100)[]);
+
+-- name: rename-campaign-tag
+-- Renames a tag on all campaigns, retaining the order of tags and
+-- merging it with the new tag if a campaign already has it.
+UPDATE campaigns SET tags = ARRAY(
+        SELECT t FROM UNNEST(ARRAY_REPLACE(tags, $1, $2)) WITH ORDINALITY AS u(t, n)
+        GROUP BY t ORDER BY MIN(n)
+    ), updated_at=NOW()
+    WHERE tags @> ARRAY[$1]::VARCHAR(100)[];
+
+-- name: delete-campaign-tag
+UPDATE campaigns SET tags = ARRAY_REMOVE(tags, $1), updated_at=NOW()
+    WHERE tags @> ARRAY[$1]::VARCHAR(100)[];
+
 -- name: update-campaign-status
-UPDATE campaigns SET status=$2, updated_at=NOW() WHERE id = $1;
+WITH requeued AS (
+    -- Messages that were re-queued for a retry but weren't sent, eg: as the subscribers
+    -- have since unsubscribed, are marked as errored again when the campaign ends.
+    UPDATE campaign_deliveries SET status='errored', updated_at=NOW()
+    WHERE $2::campaign_status IN ('finished', 'cancelled') AND campaign_id = $1 AND status = 'queued' AND retries > 0
+)
+UPDATE campaigns SET status=$2,
+    retrying=(CASE WHEN $2 IN ('finished', 'cancelled') THEN false ELSE retrying END),
+    updated_at=NOW() WHERE id = $1;
+
+-- name: retry-campaign-errors
+-- Re-queues the errored messages of a finished campaign with the given error types and
+-- re-runs the campaign to send them again.
+WITH camp AS (
+    UPDATE campaigns SET status='running', retrying=true, last_subscriber_id=0, updated_at=NOW()
+    WHERE id = $1 AND status='finished' AND EXISTS (
+        SELECT 1 FROM campaign_deliveries WHERE campaign_id = $1 AND status='errored' AND error_type = ANY($2::TEXT[])
+    )
+    RETURNING id
+)
+UPDATE campaign_deliveries SET status='queued', retries=retries+1, updated_at=NOW()
+    WHERE campaign_id = (SELECT id FROM camp) AND status='errored' AND error_type = ANY($2::TEXT[]);
+
+-- name: freeze-campaign-recipients
+-- Snapshots the subscribers that a scheduled or running campaign with freeze_recipients would be
+-- sent to right now, unless they've already been frozen.
+WITH camp AS (
+    SELECT id, type, exclude_list_ids || list_exclusions(ARRAY(SELECT list_id FROM campaign_lists WHERE campaign_id = $1)) AS exclude_list_ids,
+        segment_ids, subscriber_tags FROM campaigns WHERE id = $1 AND freeze_recipients = true AND recipients_frozen_at IS NULL
+        AND status = ANY('{scheduled, running}')
+),
+subs AS (
+    SELECT DISTINCT ON (subscribers.id) subscribers.id, subscribers.email FROM campaign_lists
+    INNER JOIN lists ON (lists.id = campaign_lists.list_id)
+    INNER JOIN subscriber_lists ON (subscriber_lists.list_id = lists.id)
+    INNER JOIN subscribers ON (subscribers.id = subscriber_lists.subscriber_id)
+    WHERE campaign_lists.campaign_id = (SELECT id FROM camp) AND subscribers.status NOT IN ('blocklisted', 'deleted') AND
+    (CASE
+        WHEN (SELECT type FROM camp) = 'optin' THEN subscriber_lists.status = 'unconfirmed' AND lists.optin = 'double'
+        WHEN lists.optin = 'double' THEN subscriber_lists.status = 'confirmed'
+        ELSE subscriber_lists.status != 'unsubscribed'
+    END) AND
+    NOT EXISTS (
+        SELECT 1 FROM subscriber_lists x WHERE x.subscriber_id = subscribers.id
+        AND x.list_id = ANY((SELECT exclude_list_ids FROM camp)) AND x.status != 'unsubscribed'
+    ) AND
+    (CARDINALITY((SELECT segment_ids FROM camp)) = 0 OR EXISTS (
+        SELECT 1 FROM segment_subscribers WHERE segment_id = ANY((SELECT segment_ids FROM camp))
+        AND segment_subscribers.subscriber_id = subscribers.id
+    )) AND
+    (CARDINALITY((SELECT subscriber_tags FROM camp)) = 0 OR subscribers.tags && (SELECT subscriber_tags FROM camp))
+),
+ins AS (
+    INSERT INTO campaign_recipients (campaign_id, subscriber_id, email)
+        SELECT (SELECT id FROM camp), id, email FROM subs
+        ON CONFLICT (campaign_id, subscriber_id) DO NOTHING
+)
+UPDATE campaigns SET recipients_frozen_at=NOW(), to_send=(SELECT COUNT(*) FROM subs), updated_at=NOW()
+    WHERE id = (SELECT id FROM camp);
+
+-- name: unfreeze-campaign-recipients
+-- Discards the frozen recipients of a campaign that hasn't started, so that they're frozen again
+-- when it's scheduled.
+WITH camp AS (
+    SELECT id FROM campaigns WHERE id = $1 AND status = ANY('{draft, scheduled}') AND recipients_frozen_at IS NOT NULL
+),
+del AS (
+    DELETE FROM campaign_recipients WHERE campaign_id = (SELECT id FROM camp)
+)
+UPDATE campaigns SET recipients_frozen_at=NULL WHERE id = (SELECT id FROM camp);
+
+-- name: get-campaign-audience
+-- Returns a random sample of $3 subscribers that a campaign would be sent to right now, each with
+-- the total number of them. If $2 (list IDs) is given, it's used instead of the campaign's lists,
+-- and $4 (list IDs), $5 (segment IDs), and $6 (tags) instead of the campaign's excluded lists,
+-- segments, and subscriber tags. The lists excluded by the lists are always excluded.
+WITH camp AS (
+    SELECT id, type, recipients_frozen_at,
+        (CASE WHEN CARDINALITY($2::INT[]) > 0 THEN $4::INT[] ELSE exclude_list_ids END) || list_exclusions(
+            CASE WHEN CARDINALITY($2::INT[]) > 0 THEN $2::INT[]
+            ELSE ARRAY(SELECT list_id FROM campaign_lists WHERE campaign_id = $1) END
+        ) AS exclude_list_ids,
+        (CASE WHEN CARDINALITY($2::INT[]) > 0 THEN $5::INT[] ELSE segment_ids END) AS segment_ids,
+        (CASE WHEN CARDINALITY($2::INT[]) > 0 THEN $6::VARCHAR(100)[] ELSE subscriber_tags END) AS subscriber_tags
+    FROM campaigns WHERE id = $1
+),
+campLists AS (
+    SELECT id AS list_id, optin FROM lists WHERE id = ANY(
+        CASE WHEN CARDINALITY($2::INT[]) > 0 THEN $2::INT[]
+        ELSE (SELECT ARRAY_AGG(list_id) FROM campaign_lists WHERE campaign_id = $1)::INT[] END
+    )
+),
+subIDs AS (
+    SELECT DISTINCT subscriber_lists.subscriber_id FROM campLists
+    INNER JOIN subscriber_lists ON (subscriber_lists.list_id = campLists.list_id)
+    WHERE
+        (CASE
+            WHEN (SELECT type FROM camp) = 'optin' THEN subscriber_lists.status = 'unconfirmed' AND campLists.optin = 'double'
+            WHEN campLists.optin = 'double' THEN subscriber_lists.status = 'confirmed'
+            ELSE subscriber_lists.status != 'unsubscribed'
+        END) AND
+        NOT EXISTS (
+            SELECT 1 FROM subscriber_lists x WHERE x.subscriber_id = subscriber_lists.subscriber_id
+            AND x.list_id = ANY((SELECT exclude_list_ids FROM camp)) AND x.status != 'unsubscribed'
+        ) AND
+        (CARDINALITY((SELECT segment_ids FROM camp)) = 0 OR EXISTS (
+            SELECT 1 FROM segment_subscribers WHERE segment_id = ANY((SELECT segment_ids FROM camp))
+            AND segment_subscribers.subscriber_id = subscriber_lists.subscriber_id
+        )) AND
+        (CARDINALITY((SELECT subscriber_tags FROM camp)) = 0 OR EXISTS (
+            SELECT 1 FROM subscribers t WHERE t.id = subscriber_lists.subscriber_id AND t.tags && (SELECT subscriber_tags FROM camp)
+        )) AND
+        -- Campaigns with frozen recipients are only sent to them.
+        (CARDINALITY($2::INT[]) > 0 OR (SELECT recipients_frozen_at FROM camp) IS NULL OR EXISTS (
+            SELECT 1 FROM campaign_recipients WHERE campaign_id = $1 AND campaign_recipients.subscriber_id = subscriber_lists.subscriber_id
+        ))
+)
+SELECT COUNT(*) OVER () AS total, subscribers.* FROM subIDs
+    INNER JOIN subscribers ON (subscribers.id = subIDs.subscriber_id AND subscribers.status NOT IN ('blocklisted', 'deleted'))
+    ORDER BY RANDOM() LIMIT $3;
+
+-- name: get-campaign-simulation-subscribers
+-- Returns the next batch of $3 subscribers after the subscriber ID $2 that a campaign
+-- would be sent to right now, for a dry run of the campaign.
+WITH camp AS (
+    SELECT id, type, recipients_frozen_at,
+        exclude_list_ids || list_exclusions(ARRAY(SELECT list_id FROM campaign_lists WHERE campaign_id = $1)) AS exclude_list_ids,
+        segment_ids, subscriber_tags FROM campaigns WHERE id = $1
+),
+campLists AS (
+    SELECT lists.id AS list_id, optin FROM lists
+    INNER JOIN campaign_lists ON (campaign_lists.list_id = lists.id)
+    WHERE campaign_lists.campaign_id = $1
+),
+subIDs AS (
+    SELECT DISTINCT subscriber_lists.subscriber_id FROM campLists
+    INNER JOIN subscriber_lists ON (subscriber_lists.list_id = campLists.list_id)
+    WHERE
+        subscriber_lists.subscriber_id > $2 AND
+        (CASE
+            WHEN (SELECT type FROM camp) = 'optin' THEN subscriber_lists.status = 'unconfirmed' AND campLists.optin = 'double'
+            WHEN campLists.optin = 'double' THEN subscriber_lists.status = 'confirmed'
+            ELSE subscriber_lists.status != 'unsubscribed'
+        END) AND
+        NOT EXISTS (
+            SELECT 1 FROM subscriber_lists x WHERE x.subscriber_id = subscriber_lists.subscriber_id
+            AND x.list_id = ANY((SELECT exclude_list_ids FROM camp)) AND x.status != 'unsubscribed'
+        ) AND
+        (CARDINALITY((SELECT segment_ids FROM camp)) = 0 OR EXISTS (
+            SELECT 1 FROM segment_subscribers WHERE segment_id = ANY((SELECT segment_ids FROM camp))
+            AND segment_subscribers.subscriber_id = subscriber_lists.subscriber_id
+        )) AND
+        (CARDINALITY((SELECT subscriber_tags FROM camp)) = 0 OR EXISTS (
+            SELECT 1 FROM subscribers t WHERE t.id = subscriber_lists.subscriber_id AND t.tags && (SELECT subscriber_tags FROM camp)
+        )) AND
+        -- Campaigns with frozen recipients are only sent to them.
+        ((SELECT recipients_frozen_at FROM camp) IS NULL OR EXISTS (
+            SELECT 1 FROM campaign_recipients WHERE campaign_id = $1 AND campaign_recipients.subscriber_id = subscriber_lists.subscriber_id
+        ))
+)
+SELECT subscribers.* FROM subIDs
+    INNER JOIN subscribers ON (subscribers.id = subIDs.subscriber_id AND subscribers.status NOT IN ('blocklisted', 'deleted'))
+    ORDER BY subscribers.id LIMIT $3;
+
+-- name: start-campaign-simulation
+-- Starts a dry run of a campaign, replacing its last one.
+INSERT INTO campaign_simulations (campaign_id) VALUES($1)
+    ON CONFLICT (campaign_id) DO UPDATE SET status='running', error='', rendered=0, errors=0,
+        domains='[]', error_samples='[]', started_at=NOW(), updated_at=NOW()
+    RETURNING *;
+
+-- name: update-campaign-simulation
+UPDATE campaign_simulations SET status=$2, error=$3, rendered=$4, errors=$5, domains=$6, error_samples=$7, updated_at=NOW()
+    WHERE campaign_id = $1;
+
+-- name: get-campaign-simulation
+SELECT * FROM campaign_simulations WHERE campaign_id = $1;
+
+-- name: get-campaign-recipients
+SELECT COUNT(*) OVER () AS total, campaign_recipients.subscriber_id, campaign_recipients.email,
+    COALESCE(subscribers.name, '') AS name, COALESCE(subscribers.uuid::TEXT, '') AS uuid, campaign_recipients.created_at
+    FROM campaign_recipients
+    LEFT JOIN subscribers ON (subscribers.id = campaign_recipients.subscriber_id)
+    WHERE campaign_recipients.campaign_id = $1
+    AND ($2 = '' OR campaign_recipients.email ILIKE $2)
+    ORDER BY campaign_recipients.id OFFSET $3 LIMIT $4;
+
+-- name: expire-campaign
+-- Finishes a running campaign that has reached its send_until deadline. It's marked
+-- expired if there were subscribers left to send to.
+UPDATE campaigns SET status='finished', expired=(sent < to_send), updated_at=NOW() WHERE id = $1 AND status='running';
 
 -- name: update-campaign-archive
 UPDATE campaigns SET
@@ -855,9 +2513,22 @@ UPDATE campaigns SET
     archive_slug=(CASE WHEN $3::TEXT = '' THEN NULL ELSE $3 END),
     archive_template_id=(CASE WHEN $4 > 0 THEN $4 ELSE archive_template_id END),
     archive_meta=(CASE WHEN $5::TEXT != '' THEN $5::JSONB ELSE archive_meta END),
+    archive_access=$6,
+    archive_password=$7,
     updated_at=NOW()
     WHERE id=$1;
 
+-- name: is-campaign-subscriber
+-- Checks if the subscriber with the given UUID is subscribed to any of the lists of the campaign,
+-- which grants them access to the campaign on the archive.
+SELECT EXISTS (
+    SELECT 1 FROM subscribers
+    JOIN subscriber_lists ON (subscriber_lists.subscriber_id = subscribers.id)
+    JOIN campaign_lists ON (campaign_lists.list_id = subscriber_lists.list_id)
+    WHERE campaign_lists.campaign_id = $1 AND subscribers.uuid = $2
+    AND subscribers.status NOT IN ('blocklisted', 'deleted') AND subscriber_lists.status != 'unsubscribed'
+);
+
 -- name: delete-campaign
 DELETE FROM campaigns WHERE id=$1;
 
@@ -866,6 +2537,13 @@ WITH view AS (
     SELECT campaigns.id as campaign_id, subscribers.id AS subscriber_id FROM campaigns
     LEFT JOIN subscribers ON (CASE WHEN $2::TEXT != '' THEN subscribers.uuid = $2::UUID ELSE FALSE END)
     WHERE campaigns.uuid = $1
+),
+score AS (
+    -- A view adds 1 to the subscriber's decayed engagement score.
+    UPDATE subscribers SET engagement_score = COALESCE(engagement_score * POWER(0.5,
+        EXTRACT(EPOCH FROM NOW() - engagement_updated_at) / (30 * 86400)), 0) + 1,
+        engagement_updated_at = NOW()
+    WHERE id = (SELECT subscriber_id FROM view)
 )
 INSERT INTO campaign_views (campaign_id, subscriber_id)
     VALUES((SELECT campaign_id FROM view), (SELECT subscriber_id FROM view));
@@ -896,20 +2574,58 @@ DELETE FROM users WHERE $1 != 1 AND id=$1;
 -- name: get-templates
 -- Only if the second param ($2) is true, body is returned.
 SELECT id, name, type, subject, (CASE WHEN $2 = false THEN body ELSE '' END) as body,
-    is_default, created_at, updated_at
+    (CASE WHEN $2 = false THEN body_amp ELSE '' END) as body_amp,
+    (CASE WHEN $2 = false THEN body_mjml ELSE '' END) as body_mjml,
+    (CASE WHEN $2 = false THEN lang_variants ELSE '[]' END) as lang_variants, preheader, is_default, created_at, updated_at
     FROM templates WHERE ($1 = 0 OR id = $1) AND ($3 = '' OR type = $3::template_type)
     ORDER BY created_at;
 
 -- name: create-template
-INSERT INTO templates (name, type, subject, body) VALUES($1, $2, $3, $4) RETURNING id;
+WITH tpl AS (
+    INSERT INTO templates (name, type, subject, body, body_amp, preheader, body_mjml, lang_variants) VALUES($1, $2, $3, $4, $5, $6, $7, $8)
+        RETURNING id, subject, body, body_amp, body_mjml, preheader
+),
+rev AS (
+    -- The first revision of the content.
+    INSERT INTO template_revisions (template_id, subject, body, body_amp, body_mjml, preheader)
+        SELECT id, subject, body, body_amp, body_mjml, preheader FROM tpl
+)
+SELECT id FROM tpl;
 
 -- name: update-template
-UPDATE templates SET
-    name=(CASE WHEN $2 != '' THEN $2 ELSE name END),
-    subject=(CASE WHEN $3 != '' THEN $3 ELSE name END),
-    body=(CASE WHEN $4 != '' THEN $4 ELSE body END),
-    updated_at=NOW()
-WHERE id = $1;
+WITH tpl AS (
+    UPDATE templates SET
+        name=(CASE WHEN $2 != '' THEN $2 ELSE name END),
+        subject=(CASE WHEN $3 != '' THEN $3 ELSE name END),
+        body=(CASE WHEN $4 != '' THEN $4 ELSE body END),
+        body_amp=(CASE WHEN $5 != '' THEN $5 ELSE body_amp END),
+        preheader=$6,
+        body_mjml=$7,
+        lang_variants=$8,
+        updated_at=NOW()
+    WHERE id = $1
+    RETURNING id, subject, body, body_amp, body_mjml, preheader
+),
+rev AS (
+    -- Snapshot the saved content, unless it's the same as the last snapshot.
+    INSERT INTO template_revisions (template_id, subject, body, body_amp, body_mjml, preheader)
+        SELECT tpl.id, tpl.subject, tpl.body, tpl.body_amp, tpl.body_mjml, tpl.preheader
+        FROM tpl WHERE NOT EXISTS (
+            SELECT 1 FROM (SELECT * FROM template_revisions WHERE template_id = $1 ORDER BY id DESC LIMIT 1) r
+            WHERE r.subject = tpl.subject AND r.body = tpl.body AND r.body_amp = tpl.body_amp
+                AND r.body_mjml = tpl.body_mjml AND r.preheader = tpl.preheader
+        )
+)
+SELECT id FROM tpl;
+
+-- name: get-template-revisions
+SELECT * FROM template_revisions WHERE template_id=$1 ORDER BY id DESC;
+
+-- name: get-template-revision
+-- Returns a revision of a template, or if $3 is true, the one before it.
+SELECT * FROM template_revisions WHERE template_id=$1
+    AND (CASE WHEN $3 THEN id < $2 ELSE id = $2 END)
+    ORDER BY id DESC LIMIT 1;
 
 -- name: set-default-template
 WITH u AS (
@@ -919,7 +2635,7 @@ UPDATE templates SET is_default=false WHERE id != $1;
 
 -- name: delete-template
 -- Delete a template as long as there's more than one. On deletion, set all campaigns
--- with that template to the default template instead.
+-- with that template to the default template instead, and unset it as the default of lists.
 WITH tpl AS (
     DELETE FROM templates WHERE id = $1 AND (SELECT COUNT(id) FROM templates) > 1 AND is_default = false RETURNING id
 ),
@@ -928,9 +2644,286 @@ def AS (
 ),
 up AS (
     UPDATE campaigns SET template_id = (SELECT id FROM def) WHERE (SELECT id FROM tpl) > 0 AND template_id = $1
+),
+lists AS (
+    UPDATE lists SET default_template_id = NULL WHERE (SELECT id FROM tpl) > 0 AND default_template_id = $1
 )
 SELECT id FROM tpl;
 
+-- name: get-template-partials
+SELECT * FROM template_partials WHERE ($1 = 0 OR id = $1) ORDER BY name;
+
+-- name: create-template-partial
+INSERT INTO template_partials (name, body) VALUES($1, $2) RETURNING id;
+
+-- name: update-template-partial
+UPDATE template_partials SET name=$2, body=$3, updated_at=NOW() WHERE id = $1;
+
+-- name: delete-template-partial
+DELETE FROM template_partials WHERE id = $1;
+
+-- name: get-template-partial-usage
+-- Names of the templates, and the campaigns that are yet to be sent or are being
+-- sent, that include the partial $1 with {{ Partial "name" }}.
+SELECT name FROM templates WHERE body ~ ('\{\{\s*Partial\s+"' || $1 || '"')
+UNION ALL
+SELECT name FROM campaigns WHERE status IN ('draft', 'scheduled', 'running', 'paused')
+    AND body ~ ('\{\{\s*Partial\s+"' || $1 || '"');
+
+
+-- builder docs
+-- name: get-builder-doc
+-- The builder document of the campaign $1 or the template $2.
+SELECT * FROM builder_docs WHERE ($1 > 0 AND campaign_id = $1) OR ($2 > 0 AND template_id = $2);
+
+-- name: upsert-campaign-builder-doc
+INSERT INTO builder_docs (campaign_id, doc) VALUES($1, $2)
+    ON CONFLICT (campaign_id) DO UPDATE SET doc = $2, updated_at = NOW();
+
+-- name: upsert-template-builder-doc
+INSERT INTO builder_docs (template_id, doc) VALUES($1, $2)
+    ON CONFLICT (template_id) DO UPDATE SET doc = $2, updated_at = NOW();
+
+-- name: delete-builder-doc
+DELETE FROM builder_docs WHERE ($1 > 0 AND campaign_id = $1) OR ($2 > 0 AND template_id = $2);
+
+
+-- rss feeds
+-- name: get-rss-feeds
+-- The lists of a feed that have been deleted are skipped.
+SELECT rss_feeds.*,
+    COALESCE((SELECT JSON_AGG(JSON_BUILD_OBJECT('id', lists.id, 'name', lists.name) ORDER BY lists.id)
+        FROM lists WHERE lists.id = ANY(rss_feeds.list_ids)), '[]') AS lists,
+    (SELECT COUNT(*) FROM rss_feed_items WHERE feed_id = rss_feeds.id AND campaign_id IS NOT NULL) AS items_sent,
+    (SELECT MAX(campaign_id) FROM rss_feed_items WHERE feed_id = rss_feeds.id) AS last_campaign_id
+    FROM rss_feeds WHERE ($1 = 0 OR id = $1) AND ($2 = false OR enabled = true)
+    ORDER BY created_at;
+
+-- name: create-rss-feed
+INSERT INTO rss_feeds (uuid, name, url, enabled, poll_interval, list_ids, template_id, subject, from_email, messenger, body, max_items, auto_send)
+    VALUES($1, $2, $3, $4, $5, $6, NULLIF($7, 0), $8, $9, $10, $11, $12, $13) RETURNING id;
+
+-- name: update-rss-feed
+-- A feed whose URL changes is checked afresh, without sending the items in it.
+UPDATE rss_feeds SET
+    name=$2,
+    url=$3,
+    checked_at=(CASE WHEN url != $3 THEN NULL ELSE checked_at END),
+    enabled=$4,
+    poll_interval=$5,
+    list_ids=$6,
+    template_id=NULLIF($7, 0),
+    subject=$8,
+    from_email=$9,
+    messenger=$10,
+    body=$11,
+    max_items=$12,
+    auto_send=$13,
+    updated_at=NOW()
+WHERE id = $1;
+
+-- name: update-rss-feed-checked
+UPDATE rss_feeds SET checked_at=NOW(), last_error=$2 WHERE id = $1;
+
+-- name: delete-rss-feed
+DELETE FROM rss_feeds WHERE id = $1;
+
+-- name: insert-rss-feed-items
+-- Records the given item GUIDs of a feed as seen and returns the ones that
+-- weren't seen before.
+INSERT INTO rss_feed_items (feed_id, guid)
+    (SELECT $1, UNNEST($2::TEXT[]))
+    ON CONFLICT DO NOTHING RETURNING guid;
+
+-- name: update-rss-feed-items-campaign
+UPDATE rss_feed_items SET campaign_id = $3 WHERE feed_id = $1 AND guid = ANY($2::TEXT[]);
+
+-- crm syncs
+-- name: get-crm-syncs
+SELECT crm_syncs.*, COALESCE(lists.name, '') AS list_name FROM crm_syncs
+    LEFT JOIN lists ON (lists.id = crm_syncs.list_id)
+    WHERE ($1 = 0 OR crm_syncs.id = $1) AND ($2 = false OR crm_syncs.enabled = true)
+    ORDER BY crm_syncs.created_at;
+
+-- name: create-crm-sync
+INSERT INTO crm_syncs (uuid, name, provider, segment, api_key, list_id, mapping, conflict, pull,
+    push_unsubscribes, push_bounces, enabled, sync_interval)
+    VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING id;
+
+-- name: update-crm-sync
+-- An empty API key retains the existing one. A sync whose CRM, segment, or list
+-- changes only pushes the changes after it's updated.
+UPDATE crm_syncs SET
+    name=$2,
+    synced_at=(CASE WHEN (provider, segment, list_id) != ($3, $4, $6) THEN NOW() ELSE synced_at END),
+    provider=$3,
+    segment=$4,
+    api_key=(CASE WHEN $5 = '' THEN api_key ELSE $5 END),
+    list_id=$6,
+    mapping=$7,
+    conflict=$8,
+    pull=$9,
+    push_unsubscribes=$10,
+    push_bounces=$11,
+    enabled=$12,
+    sync_interval=$13,
+    updated_at=NOW()
+WHERE id = $1;
+
+-- name: update-crm-sync-ran
+-- Records a sync's run at $2, and if it succeeded ($3 = ''), that the changes up to it have been pushed.
+UPDATE crm_syncs SET ran_at=$2, last_error=$3, pulled=$4, pushed=$5,
+    synced_at=(CASE WHEN $3 = '' THEN $2 ELSE synced_at END)
+    WHERE id = $1;
+
+-- name: delete-crm-sync
+DELETE FROM crm_syncs WHERE id = $1;
+
+-- name: get-crm-sync-changes
+-- Returns the e-mails and statuses of the subscribers of the list $1 who unsubscribed
+-- from it (if $4) or bounced (if $5) after $2 and up to $3. The first sync of a list
+-- pushes the changes after the sync's creation.
+SELECT subscribers.email, 'unsubscribed' AS status FROM subscriber_lists
+    JOIN subscribers ON (subscribers.id = subscriber_lists.subscriber_id)
+    WHERE $4 AND subscriber_lists.list_id = $1 AND subscriber_lists.status = 'unsubscribed'
+    AND subscriber_lists.updated_at > $2 AND subscriber_lists.updated_at <= $3
+UNION
+SELECT subscribers.email, 'bounced' AS status FROM bounces
+    JOIN subscriber_lists ON (subscriber_lists.subscriber_id = bounces.subscriber_id AND subscriber_lists.list_id = $1)
+    JOIN subscribers ON (subscribers.id = bounces.subscriber_id)
+    WHERE $5 AND bounces.created_at > $2 AND bounces.created_at <= $3;
+
+-- name: upsert-crm-contact
+-- Upserts a contact pulled from a CRM and subscribes them to the list $5, confirmed, unless
+-- it's a double opt-in list. If $6 = true, the CRM's data wins: the attributes of existing
+-- subscribers are overwritten with the contact's, and their names too if $7 = true. Otherwise,
+-- only their missing attributes are filled in. Blocklisted and deleted subscribers, and those
+-- that have unsubscribed from the list, are left as they are.
+-- E-mails that are the verified alternate e-mails of subscribers update those subscribers.
+WITH em AS (
+    SELECT COALESCE((
+        SELECT subscribers.email FROM subscriber_emails
+        JOIN subscribers ON (subscribers.id = subscriber_emails.subscriber_id)
+        WHERE LOWER(subscriber_emails.email) = LOWER($2) AND subscriber_emails.verified_at IS NOT NULL
+    ), $2::TEXT) AS email
+),
+sub AS (
+    INSERT INTO subscribers AS s (uuid, email, name, attribs, status)
+    SELECT $1::UUID, (SELECT email FROM em), $3::TEXT, $4::JSONB, 'enabled'
+    ON CONFLICT (email) DO UPDATE SET
+        name=(CASE WHEN $6 AND $7 THEN EXCLUDED.name ELSE s.name END),
+        attribs=(CASE WHEN $6 THEN s.attribs || EXCLUDED.attribs ELSE EXCLUDED.attribs || s.attribs END),
+        updated_at=NOW()
+    WHERE s.status NOT IN ('blocklisted', 'deleted')
+    RETURNING id
+)
+INSERT INTO subscriber_lists (subscriber_id, list_id, status)
+    SELECT sub.id, lists.id, (CASE WHEN lists.optin = 'double' THEN 'unconfirmed' ELSE 'confirmed' END)::subscription_status
+    FROM sub JOIN lists ON (lists.id = $5)
+    ON CONFLICT (subscriber_id, list_id) DO NOTHING;
+
+-- subscription forms
+-- name: get-subscription-forms
+-- Retrieves all forms, or the one with the ID $1 or UUID $2, with their total views and conversions.
+-- The lists of a form that have been deleted are skipped.
+SELECT subscription_forms.*,
+    COALESCE((SELECT JSON_AGG(JSON_BUILD_OBJECT('id', lists.id, 'uuid', lists.uuid, 'name', lists.name,
+        'description', lists.description, 'optin', lists.optin) ORDER BY lists.id)
+        FROM lists WHERE lists.id = ANY(subscription_forms.list_ids)), '[]') AS lists,
+    COALESCE(stats.views, 0) AS views,
+    COALESCE(stats.conversions, 0) AS conversions
+    FROM subscription_forms
+    LEFT JOIN (
+        SELECT form_id, SUM(views) AS views, SUM(conversions) AS conversions
+        FROM subscription_form_stats GROUP BY form_id
+    ) stats ON (stats.form_id = subscription_forms.id)
+    WHERE ($1 = 0 OR subscription_forms.id = $1) AND ($2 = '' OR subscription_forms.uuid = $2::UUID)
+    ORDER BY subscription_forms.created_at;
+
+-- name: create-subscription-form
+INSERT INTO subscription_forms (uuid, name, enabled, list_ids, choose_lists, fields, title, description,
+    submit_label, success_message, redirect_url, theme)
+    VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id;
+
+-- name: update-subscription-form
+UPDATE subscription_forms SET
+    name=$2,
+    enabled=$3,
+    list_ids=$4,
+    choose_lists=$5,
+    fields=$6,
+    title=$7,
+    description=$8,
+    submit_label=$9,
+    success_message=$10,
+    redirect_url=$11,
+    theme=$12,
+    updated_at=NOW()
+WHERE id = $1;
+
+-- name: delete-subscription-form
+DELETE FROM subscription_forms WHERE id = $1;
+
+-- name: get-subscription-form-stats
+-- Retrieves the daily views and conversions of a form between the dates $2 and $3, with
+-- the days without any as zeroes.
+SELECT TO_CHAR(days.day, 'YYYY-MM-DD') AS day, COALESCE(s.views, 0) AS views, COALESCE(s.conversions, 0) AS conversions
+    FROM GENERATE_SERIES($2::DATE, $3::DATE, '1 day') AS days(day)
+    LEFT JOIN subscription_form_stats s ON (s.form_id = $1 AND s.day = days.day)
+    ORDER BY days.day;
+
+-- name: record-subscription-form-stat
+-- Adds $2 views and $3 conversions to today's stats of a form.
+INSERT INTO subscription_form_stats (form_id, day, views, conversions)
+    VALUES($1, CURRENT_DATE, $2, $3)
+    ON CONFLICT (form_id, day) DO UPDATE SET
+        views=subscription_form_stats.views + EXCLUDED.views,
+        conversions=subscription_form_stats.conversions + EXCLUDED.conversions;
+
+
+-- api tokens
+-- name: get-api-tokens
+-- Retrieves all API tokens, or the one with the ID $1, with the names of their lists and list folders.
+SELECT api_tokens.id, api_tokens.name, api_tokens.username, api_tokens.role, api_tokens.list_ids,
+    api_tokens.folder_ids, api_tokens.last_used_at, api_tokens.created_at, api_tokens.updated_at,
+    COALESCE((SELECT JSON_AGG(JSON_BUILD_OBJECT('id', lists.id, 'name', lists.name) ORDER BY lists.id)
+        FROM lists WHERE lists.id = ANY(api_tokens.list_ids)), '[]') AS lists,
+    COALESCE((SELECT JSON_AGG(JSON_BUILD_OBJECT('id', list_folders.id, 'name', list_folders.name) ORDER BY list_folders.id)
+        FROM list_folders WHERE list_folders.id = ANY(api_tokens.folder_ids)), '[]') AS folders
+    FROM api_tokens
+    WHERE ($1 = 0 OR api_tokens.id = $1)
+    ORDER BY api_tokens.created_at;
+
+-- name: create-api-token
+INSERT INTO api_tokens (name, username, token_hash, role, list_ids, folder_ids) VALUES($1, $2, $3, $4, $5, $6) RETURNING id;
+
+-- name: update-api-token
+UPDATE api_tokens SET name=$2, role=$3, list_ids=$4, folder_ids=$5, updated_at=NOW() WHERE id = $1;
+
+-- name: delete-api-token
+DELETE FROM api_tokens WHERE id = $1;
+
+-- name: auth-api-token
+-- Records the use of the API token with the username $1 and token hash $2 and returns it
+-- with the IDs and UUIDs of its lists, which include the lists in its folders and their
+-- subfolders.
+WITH RECURSIVE tok AS (
+    UPDATE api_tokens SET last_used_at=NOW() WHERE username = $1 AND token_hash = $2 RETURNING *
+),
+folders AS (
+    SELECT list_folders.id FROM list_folders, tok WHERE list_folders.id = ANY(tok.folder_ids)
+    UNION
+    SELECT f.id FROM list_folders f JOIN folders ON (f.parent_id = folders.id)
+),
+toklists AS (
+    SELECT lists.id, lists.uuid FROM lists, tok
+        WHERE lists.id = ANY(tok.list_ids) OR lists.folder_id IN (SELECT id FROM folders)
+)
+SELECT tok.id, tok.name, tok.username, tok.role, tok.folder_ids,
+    ARRAY(SELECT id FROM toklists) AS list_ids,
+    ARRAY(SELECT uuid::TEXT FROM toklists) AS list_uuids
+    FROM tok;
+
 
 -- media
 -- name: insert-media
@@ -950,16 +2943,36 @@ DELETE FROM media WHERE id=$1 RETURNING filename;
 -- name: create-link
 INSERT INTO links (uuid, url) VALUES($1, $2) ON CONFLICT (url) DO UPDATE SET url=EXCLUDED.url RETURNING uuid;
 
+-- name: get-link-url
+SELECT url FROM links WHERE uuid = $1;
+
+-- name: get-campaign-engagement-rules
+-- Returns the engagement rules of a campaign and the ID of the subscriber who engaged with it.
+SELECT campaigns.engagement_rules, subscribers.id AS subscriber_id FROM campaigns, subscribers
+    WHERE campaigns.uuid = $1::UUID AND subscribers.uuid = $2::UUID AND campaigns.engagement_rules != '[]';
+
+-- name: set-subscriber-attrib
+UPDATE subscribers SET attribs = attribs || JSONB_BUILD_OBJECT($2::TEXT, $3::TEXT), updated_at = NOW() WHERE id = $1;
+
 -- name: register-link-click
 WITH link AS(
     SELECT id, url FROM links WHERE uuid = $1
+),
+sub AS (
+    SELECT id FROM subscribers WHERE (CASE WHEN $3::TEXT != '' THEN subscribers.uuid = $3::UUID ELSE FALSE END)
+),
+score AS (
+    -- A click adds 3 to the subscriber's decayed engagement score.
+    UPDATE subscribers SET engagement_score = COALESCE(engagement_score * POWER(0.5,
+        EXTRACT(EPOCH FROM NOW() - engagement_updated_at) / (30 * 86400)), 0) + 3,
+        engagement_updated_at = NOW()
+    WHERE id = (SELECT id FROM sub) AND EXISTS (SELECT 1 FROM link)
 )
-INSERT INTO link_clicks (campaign_id, subscriber_id, link_id) VALUES(
+INSERT INTO link_clicks (campaign_id, subscriber_id, link_id, position) VALUES(
     (SELECT id FROM campaigns WHERE uuid = $2),
-    (SELECT id FROM subscribers WHERE
-        (CASE WHEN $3::TEXT != '' THEN subscribers.uuid = $3::UUID ELSE FALSE END)
-    ),
-    (SELECT id FROM link)
+    (SELECT id FROM sub),
+    (SELECT id FROM link),
+    NULLIF($4::INT, 0)
 ) RETURNING (SELECT url FROM link);
 
 -- name: get-dashboard-charts
@@ -989,14 +3002,27 @@ num AS (
     SELECT COUNT(*) + 1 AS num FROM bounces WHERE subscriber_id = (SELECT id FROM sub) AND type = $4
 ),
 -- block1 and block2 will run when $8 = 'blocklist' and the number of bounces exceed $8.
+-- block1 also subtracts the bounce from the subscriber's decayed engagement score, unless
+-- the subscriber is being deleted.
 block1 AS (
-    UPDATE subscribers SET status='blocklisted'
-    WHERE $9 = 'blocklist' AND (SELECT num FROM num) >= $8 AND id = (SELECT id FROM sub) AND (SELECT status FROM sub) != 'blocklisted'
+    UPDATE subscribers SET status=(
+        CASE WHEN $9 = 'blocklist' AND (SELECT num FROM num) >= $8 THEN 'blocklisted' ELSE status END
+    ),
+    engagement_score = COALESCE(engagement_score * POWER(0.5,
+        EXTRACT(EPOCH FROM NOW() - engagement_updated_at) / (30 * 86400)), 0)
+        - (CASE $4 WHEN 'complaint' THEN 10 WHEN 'hard' THEN 5 ELSE 2 END),
+    engagement_updated_at = NOW()
+    WHERE id = (SELECT id FROM sub) AND NOT ($9 = 'delete' AND (SELECT num FROM num) >= $8)
 ),
 block2 AS (
     UPDATE subscriber_lists SET status='unsubscribed'
     WHERE $9 = 'unsubscribe' AND (SELECT num FROM num) >= $8 AND subscriber_id = (SELECT id FROM sub) AND (SELECT status FROM sub) != 'blocklisted'
 ),
+deliv AS (
+    -- Mark the subscriber's message in the campaign as bounced in the delivery log.
+    UPDATE campaign_deliveries SET status='bounced', error=$4::TEXT, updated_at=NOW()
+    WHERE campaign_id = (SELECT id FROM camp) AND subscriber_id = (SELECT id FROM sub) AND status='sent'
+),
 bounce AS (
     -- Record the bounce if the subscriber is not already blocklisted;
     INSERT INTO bounces (subscriber_id, campaign_id, type, source, meta, created_at)
@@ -1032,6 +3058,14 @@ WHERE ($1 = 0 OR bounces.id = $1)
     AND ($4 = '' OR bounces.source = $4)
 ORDER BY %order% OFFSET $5 LIMIT $6;
 
+-- name: get-bounce-auth-stats
+-- Counts bounces by the authentication method and result (eg: spf=fail) parsed
+-- from the Authentication-Results headers of bounce e-mails.
+SELECT r.key AS method, r.value AS result, COUNT(*) AS count FROM bounces,
+    JSONB_EACH_TEXT(COALESCE(bounces.meta->'auth_results', '{}')) r
+    WHERE ($1 = 0 OR bounces.campaign_id = $1)
+    GROUP BY r.key, r.value ORDER BY r.key, count DESC;
+
 -- name: delete-bounces
 DELETE FROM bounces WHERE CARDINALITY($1::INT[]) = 0 OR id = ANY($1);
 
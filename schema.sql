@@ -1,12 +1,16 @@
-DROP TYPE IF EXISTS list_type CASCADE; CREATE TYPE list_type AS ENUM ('public', 'private', 'temporary');
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+DROP TYPE IF EXISTS list_type CASCADE; CREATE TYPE list_type AS ENUM ('public', 'private', 'temporary', 'dynamic');
 DROP TYPE IF EXISTS list_optin CASCADE; CREATE TYPE list_optin AS ENUM ('single', 'double');
-DROP TYPE IF EXISTS subscriber_status CASCADE; CREATE TYPE subscriber_status AS ENUM ('enabled', 'disabled', 'blocklisted');
+DROP TYPE IF EXISTS subscriber_status CASCADE; CREATE TYPE subscriber_status AS ENUM ('enabled', 'disabled', 'blocklisted', 'deleted');
 DROP TYPE IF EXISTS subscription_status CASCADE; CREATE TYPE subscription_status AS ENUM ('unconfirmed', 'confirmed', 'unsubscribed');
 DROP TYPE IF EXISTS campaign_status CASCADE; CREATE TYPE campaign_status AS ENUM ('draft', 'running', 'scheduled', 'paused', 'cancelled', 'finished');
+DROP TYPE IF EXISTS delivery_status CASCADE; CREATE TYPE delivery_status AS ENUM ('queued', 'sent', 'errored', 'bounced', 'skipped');
 DROP TYPE IF EXISTS campaign_type CASCADE; CREATE TYPE campaign_type AS ENUM ('regular', 'optin');
 DROP TYPE IF EXISTS content_type CASCADE; CREATE TYPE content_type AS ENUM ('richtext', 'html', 'plain', 'markdown');
 DROP TYPE IF EXISTS bounce_type CASCADE; CREATE TYPE bounce_type AS ENUM ('soft', 'hard', 'complaint');
 DROP TYPE IF EXISTS template_type CASCADE; CREATE TYPE template_type AS ENUM ('campaign', 'tx');
+DROP TYPE IF EXISTS consent_type CASCADE; CREATE TYPE consent_type AS ENUM ('subscription', 'confirmation');
 
 -- subscribers
 DROP TABLE IF EXISTS subscribers CASCADE;
@@ -16,8 +20,35 @@ CREATE TABLE subscribers (
     email           TEXT NOT NULL UNIQUE,
     name            TEXT NOT NULL,
     attribs         JSONB NOT NULL DEFAULT '{}',
+    tags            VARCHAR(100)[] NOT NULL DEFAULT '{}',
     status          subscriber_status NOT NULL DEFAULT 'enabled',
 
+    -- Optional ID of the subscriber in an external system that it's synced from.
+    external_id     TEXT NULL UNIQUE,
+
+    -- Identities on non-e-mail channels with their consent flags, keyed by channel, eg:
+    -- {"phone": {"value": "+919876543210", "consent": true}}
+    channels        JSONB NOT NULL DEFAULT '{}',
+
+    -- Language, eg: "pt-BR", that picks the language variants of campaigns, and
+    -- the IANA timezone, eg: "Europe/Berlin", that local time campaigns and quiet hours use.
+    locale          TEXT NOT NULL DEFAULT '',
+    timezone        TEXT NOT NULL DEFAULT '',
+
+    -- Lowercased e-mail, name, and the values of the app.search_attribs attributes
+    -- that subscribers are searched by. It's maintained by the trg_subscriber_search_text trigger.
+    search_text     TEXT NOT NULL DEFAULT '',
+
+    -- Rolling engagement score as of engagement_updated_at. Campaign views and link clicks
+    -- add to it and bounces subtract from it, and it halves every 30 days in between.
+    engagement_score      DOUBLE PRECISION NOT NULL DEFAULT 0,
+    engagement_updated_at TIMESTAMP WITH TIME ZONE NULL,
+
+    -- When the subscriber was soft-deleted (status = 'deleted') and the status
+    -- that they're restored to.
+    deleted_at      TIMESTAMP WITH TIME ZONE NULL,
+    restore_status  subscriber_status NULL,
+
     created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
@@ -25,6 +56,24 @@ DROP INDEX IF EXISTS idx_subs_email; CREATE UNIQUE INDEX idx_subs_email ON subsc
 DROP INDEX IF EXISTS idx_subs_status; CREATE INDEX idx_subs_status ON subscribers(status);
 DROP INDEX IF EXISTS idx_subs_created_at; CREATE INDEX idx_subs_created_at ON subscribers(created_at);
 DROP INDEX IF EXISTS idx_subs_updated_at; CREATE INDEX idx_subs_updated_at ON subscribers(updated_at);
+DROP INDEX IF EXISTS idx_subs_engagement_score; CREATE INDEX idx_subs_engagement_score ON subscribers(engagement_score);
+DROP INDEX IF EXISTS idx_subs_deleted_at; CREATE INDEX idx_subs_deleted_at ON subscribers(deleted_at) WHERE deleted_at IS NOT NULL;
+DROP INDEX IF EXISTS idx_subs_timezone; CREATE INDEX idx_subs_timezone ON subscribers(timezone);
+DROP INDEX IF EXISTS idx_subs_tags; CREATE INDEX idx_subs_tags ON subscribers USING GIN(tags);
+DROP INDEX IF EXISTS idx_subs_search_trgm; CREATE INDEX idx_subs_search_trgm ON subscribers USING GIN(search_text gin_trgm_ops);
+DROP INDEX IF EXISTS idx_subs_search_fts; CREATE INDEX idx_subs_search_fts ON subscribers USING GIN(TO_TSVECTOR('simple', search_text));
+
+-- list folders
+-- Folders that lists are organised in, which can be nested in other folders.
+DROP TABLE IF EXISTS list_folders CASCADE;
+CREATE TABLE list_folders (
+    id              SERIAL PRIMARY KEY,
+    name            TEXT NOT NULL,
+    parent_id       INTEGER NULL REFERENCES list_folders(id) ON DELETE SET NULL ON UPDATE CASCADE,
+    created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_list_folders_parent; CREATE INDEX idx_list_folders_parent ON list_folders(parent_id);
 
 -- lists
 DROP TABLE IF EXISTS lists CASCADE;
@@ -36,6 +85,53 @@ CREATE TABLE lists (
     optin           list_optin NOT NULL DEFAULT 'single',
     tags            VARCHAR(100)[],
     description     TEXT NOT NULL DEFAULT '',
+    tracking_domain TEXT NOT NULL DEFAULT '',
+    folder_id       INTEGER NULL REFERENCES list_folders(id) ON DELETE SET NULL ON UPDATE CASCADE,
+
+    -- Optional transactional template, subject, and sender of the double opt-in
+    -- e-mails of the list, and the page subscribers are sent to on confirming.
+    optin_template_id  INTEGER NULL,
+    optin_subject      TEXT NOT NULL DEFAULT '',
+    optin_from_email   TEXT NOT NULL DEFAULT '',
+    optin_redirect_url TEXT NOT NULL DEFAULT '',
+
+    -- Optional sender, Reply-To, template, and messenger that campaigns targeting the
+    -- list are created with. The sender, Reply-To, and messenger also apply to the
+    -- list's opt-in and re-permission e-mails.
+    default_from_email  TEXT NOT NULL DEFAULT '',
+    default_reply_to    TEXT NOT NULL DEFAULT '',
+    default_template_id INTEGER NULL,
+    default_messenger   TEXT NOT NULL DEFAULT '',
+
+    -- Max campaigns that the list's subscribers can be sent in a rolling day
+    -- and week. 0 is no limit.
+    frequency_cap_daily  INTEGER NOT NULL DEFAULT 0,
+    frequency_cap_weekly INTEGER NOT NULL DEFAULT 0,
+
+    -- Days after which subscriptions with no activity are sent a re-permission
+    -- e-mail (0 is never), and the days they have to renew before they're unsubscribed.
+    subscription_ttl   INTEGER NOT NULL DEFAULT 0,
+    repermission_grace INTEGER NOT NULL DEFAULT 14,
+
+    -- Days after subscribing, or the last reminder, after which unconfirmed subscribers
+    -- of double opt-in lists are sent the opt-in e-mail again (0 is never), and the max
+    -- number of reminders they're sent.
+    optin_reminder_days INTEGER NOT NULL DEFAULT 0,
+    optin_reminder_max  INTEGER NOT NULL DEFAULT 2,
+
+    -- The subscriber query of dynamic lists, whose subscriptions are materialized from
+    -- it periodically and before campaigns to them start, and when they last were.
+    query           TEXT NOT NULL DEFAULT '',
+    refreshed_at    TIMESTAMP WITH TIME ZONE NULL,
+
+    -- Lists whose subscribers are excluded from campaigns to the list, unless the
+    -- campaign targets them too, eg: a prospects list that excludes customers.
+    exclude_list_ids INTEGER[] NOT NULL DEFAULT '{}',
+
+    -- Archived lists are hidden from list pickers and can't be subscribed to or
+    -- targeted by campaigns, but their subscriptions and history are kept.
+    archived        BOOLEAN NOT NULL DEFAULT false,
+    archived_at     TIMESTAMP WITH TIME ZONE NULL,
 
     created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
@@ -45,6 +141,7 @@ DROP INDEX IF EXISTS idx_lists_optin; CREATE INDEX idx_lists_optin ON lists(opti
 DROP INDEX IF EXISTS idx_lists_name; CREATE INDEX idx_lists_name ON lists(name);
 DROP INDEX IF EXISTS idx_lists_created_at; CREATE INDEX idx_lists_created_at ON lists(created_at);
 DROP INDEX IF EXISTS idx_lists_updated_at; CREATE INDEX idx_lists_updated_at ON lists(updated_at);
+DROP INDEX IF EXISTS idx_lists_folder; CREATE INDEX idx_lists_folder ON lists(folder_id);
 
 
 DROP TABLE IF EXISTS subscriber_lists CASCADE;
@@ -54,6 +151,15 @@ CREATE TABLE subscriber_lists (
     meta               JSONB NOT NULL DEFAULT '{}',
     status             subscription_status NOT NULL DEFAULT 'unconfirmed',
 
+    -- When the subscriber was sent a re-permission e-mail for the list that they
+    -- haven't acted on yet.
+    repermission_sent_at TIMESTAMP WITH TIME ZONE NULL,
+
+    -- The number of opt-in reminders the subscriber has been sent for the list, and when
+    -- the last one was sent.
+    optin_reminders      INTEGER NOT NULL DEFAULT 0,
+    optin_reminded_at    TIMESTAMP WITH TIME ZONE NULL,
+
     created_at         TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at         TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
 
@@ -63,6 +169,37 @@ DROP INDEX IF EXISTS idx_sub_lists_sub_id; CREATE INDEX idx_sub_lists_sub_id ON
 DROP INDEX IF EXISTS idx_sub_lists_list_id; CREATE INDEX idx_sub_lists_list_id ON subscriber_lists(list_id);
 DROP INDEX IF EXISTS idx_sub_lists_status; CREATE INDEX idx_sub_lists_status ON subscriber_lists(status);
 
+-- segments
+-- Saved subscriber queries (SQL expressions) that campaigns can be sent to. The subscribers
+-- that match a segment are materialized in segment_subscribers when it's refreshed.
+DROP TABLE IF EXISTS segments CASCADE;
+CREATE TABLE segments (
+    id               SERIAL PRIMARY KEY,
+    uuid             uuid NOT NULL UNIQUE,
+    name             TEXT NOT NULL,
+    description      TEXT NOT NULL DEFAULT '',
+    query            TEXT NOT NULL,
+
+    -- Structured filter that the query is compiled from, if the segment was
+    -- defined with one instead of a raw SQL expression.
+    filter           JSONB NULL,
+
+    -- Number of matching subscribers as of the last refresh.
+    subscriber_count INTEGER NOT NULL DEFAULT 0,
+    refreshed_at     TIMESTAMP WITH TIME ZONE NULL,
+
+    created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+DROP TABLE IF EXISTS segment_subscribers CASCADE;
+CREATE TABLE segment_subscribers (
+    segment_id       INTEGER NOT NULL REFERENCES segments(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    PRIMARY KEY(segment_id, subscriber_id)
+);
+DROP INDEX IF EXISTS idx_segment_subs_sub_id; CREATE INDEX idx_segment_subs_sub_id ON segment_subscribers(subscriber_id);
+
 -- templates
 DROP TABLE IF EXISTS templates CASCADE;
 CREATE TABLE templates (
@@ -71,13 +208,47 @@ CREATE TABLE templates (
     type            template_type NOT NULL DEFAULT 'campaign',
     subject         TEXT NOT NULL,
     body            TEXT NOT NULL,
+    body_amp        TEXT NOT NULL DEFAULT '',
+
+    -- MJML source of MJML templates that body is compiled from.
+    body_mjml       TEXT NOT NULL DEFAULT '',
+
+    -- Hidden preview text shown by e-mail clients next to the subject.
+    preheader       TEXT NOT NULL DEFAULT '',
     is_default      BOOLEAN NOT NULL DEFAULT false,
 
+    -- Bodies (and subjects) in other languages picked by subscriber locales.
+    lang_variants   JSONB NOT NULL DEFAULT '[]',
+
     created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
 CREATE UNIQUE INDEX ON templates (is_default) WHERE is_default = true;
 
+-- Snapshots of the content of templates taken on every save that changes it.
+DROP TABLE IF EXISTS template_revisions CASCADE;
+CREATE TABLE template_revisions (
+    id               BIGSERIAL PRIMARY KEY,
+    template_id      INTEGER NOT NULL REFERENCES templates(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    subject          TEXT NOT NULL,
+    body             TEXT NOT NULL,
+    body_amp         TEXT NOT NULL DEFAULT '',
+    body_mjml        TEXT NOT NULL DEFAULT '',
+    preheader        TEXT NOT NULL DEFAULT '',
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_tpl_revs_tpl_id; CREATE INDEX idx_tpl_revs_tpl_id ON template_revisions(template_id);
+
+-- Named fragments of content that are included in templates and campaigns with {{ Partial "name" }}.
+DROP TABLE IF EXISTS template_partials CASCADE;
+CREATE TABLE template_partials (
+    id               SERIAL PRIMARY KEY,
+    name             TEXT NOT NULL UNIQUE,
+    body             TEXT NOT NULL,
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
 
 -- campaigns
 DROP TABLE IF EXISTS campaigns CASCADE;
@@ -89,8 +260,56 @@ CREATE TABLE campaigns (
     from_email       TEXT NOT NULL,
     body             TEXT NOT NULL,
     altbody          TEXT NULL,
+
+    -- Optional AMP for Email body sent as a text/x-amp-html part.
+    body_amp         TEXT NULL,
+
+    -- Hidden preview text. If empty, the template's preheader is used.
+    preheader        TEXT NOT NULL DEFAULT '',
     content_type     content_type NOT NULL DEFAULT 'richtext',
     send_at          TIMESTAMP WITH TIME ZONE,
+
+    -- If true, the campaign is delivered at send_at's wall-clock time (in send_at_timezone or
+    -- app.default_timezone) in every subscriber's own timezone (subscribers.timezone).
+    send_at_local    BOOLEAN NOT NULL DEFAULT false,
+
+    -- IANA timezone that send_at is scheduled in, and send_at's wall-clock time in it,
+    -- from which the send time is computed when the campaign starts.
+    send_at_timezone TEXT NOT NULL DEFAULT '',
+    send_at_wall     TIMESTAMP WITHOUT TIME ZONE NULL,
+
+    -- Optional deadline after which the campaign stops sending even if there are subscribers
+    -- left, in which case it's finished with expired=true.
+    send_until       TIMESTAMP WITH TIME ZONE NULL,
+    expired          BOOLEAN NOT NULL DEFAULT false,
+
+    -- Optional days of the week and hours of the day outside of which the campaign isn't sent:
+    -- {"days": [1, 2, 3, 4, 5], "start": "08:00", "end": "18:00", "timezone": "Europe/Berlin"}
+    send_window      JSONB NOT NULL DEFAULT '{}',
+
+    -- Scheduling priority (1-10) against the other campaigns being sent at the same time.
+    -- Running campaigns process batches of subscribers in proportion to their priorities.
+    priority         SMALLINT NOT NULL DEFAULT 5 CHECK (priority BETWEEN 1 AND 10),
+
+    -- Optional List-ID header (RFC 2919) that overrides the one in the custom headers and the messenger's defaults.
+    list_id_header   VARCHAR(300) NOT NULL DEFAULT '',
+
+    -- Snapshot the recipients (in campaign_recipients) when the campaign is scheduled
+    -- or started, so that subscribers added to its lists later aren't sent to.
+    freeze_recipients    BOOLEAN NOT NULL DEFAULT false,
+    recipients_frozen_at TIMESTAMP WITH TIME ZONE NULL,
+
+    -- Subscribers in any of these lists are not sent to, even if they're in the campaign's lists.
+    exclude_list_ids INTEGER[] NOT NULL DEFAULT '{}',
+
+    -- If set, only the subscribers in the campaign's lists who are in any of these segments are sent to.
+    segment_ids      INTEGER[] NOT NULL DEFAULT '{}',
+
+    -- If set, only the subscribers in the campaign's lists who have any of these tags are sent to.
+    subscriber_tags  VARCHAR(100)[] NOT NULL DEFAULT '{}',
+
+    -- The finished campaign is being re-run to retry its errored messages.
+    retrying         BOOLEAN NOT NULL DEFAULT false,
     headers          JSONB NOT NULL DEFAULT '[]',
     status           campaign_status NOT NULL DEFAULT 'draft',
     tags             VARCHAR(100)[],
@@ -101,6 +320,9 @@ CREATE TABLE campaigns (
 
     -- The ID of the messenger backend used to send this campaign. 
     messenger        TEXT NOT NULL,
+
+    -- Ordered list of messengers that the campaign fails over to if the messenger errors repeatedly.
+    failover_messengers TEXT[] NOT NULL DEFAULT '{}',
     template_id      INTEGER REFERENCES templates(id) ON DELETE SET DEFAULT DEFAULT 1,
 
     -- Progress and stats.
@@ -109,12 +331,45 @@ CREATE TABLE campaigns (
     max_subscriber_id  INT NOT NULL DEFAULT 0,
     last_subscriber_id INT NOT NULL DEFAULT 0,
 
+    -- Estimated cost and the number of SMS segments (for messengers charged per segment) sent.
+    segments           INT NOT NULL DEFAULT 0,
+    cost               NUMERIC(16, 6) NOT NULL DEFAULT 0,
+
+    -- For send_at_local campaigns, the send time of the timezone bucket being processed.
+    tz_bucket_at       TIMESTAMP WITH TIME ZONE NULL,
+
+    -- Staged sending: {"percent": 10, "hold": "4h", "max_bounce_rate": 2, "max_complaint_rate": 0.1}.
+    -- The campaign is held once the initial percentage is sent, and the rates are checked after the hold.
+    rollout            JSONB NOT NULL DEFAULT '{}',
+    rollout_held_until TIMESTAMP WITH TIME ZONE NULL,
+    rollout_checked_at TIMESTAMP WITH TIME ZONE NULL,
+
     -- Publishing.
     archive             BOOLEAN NOT NULL DEFAULT false,
     archive_slug        TEXT NULL UNIQUE,
     archive_template_id INTEGER REFERENCES templates(id) ON DELETE SET DEFAULT DEFAULT 1,
     archive_meta        JSONB NOT NULL DEFAULT '{}',
 
+    -- public, password (bcrypt hash in archive_password), or subscriber (only subscribers of the campaign's lists).
+    archive_access      TEXT NOT NULL DEFAULT 'public' CHECK (archive_access IN ('public', 'password', 'subscriber')),
+    archive_password    TEXT NOT NULL DEFAULT '',
+
+    -- Named conditional content blocks: [{"name": "", "condition": "", "body": ""}]
+    content_blocks      JSONB NOT NULL DEFAULT '[]',
+
+    -- Content in other languages that's sent to subscribers whose locale attribute matches:
+    -- [{"lang": "", "subject": "", "body": "", "altbody": ""}]
+    lang_variants       JSONB NOT NULL DEFAULT '[]',
+    utm_params          JSONB NOT NULL DEFAULT '{}',
+    tracking_domain     TEXT NOT NULL DEFAULT '',
+
+    -- Actions applied to subscribers when they view the campaign or click its links:
+    -- [{"event": "click", "url": "", "action": "add_list", "list_id": 0, "attrib": "", "value": ""}]
+    engagement_rules    JSONB NOT NULL DEFAULT '[]',
+
+    -- Incremented every time the content of a campaign that's being sent is edited.
+    content_version     INTEGER NOT NULL DEFAULT 1,
+
     started_at       TIMESTAMP WITH TIME ZONE,
     created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
@@ -152,6 +407,276 @@ DROP INDEX IF EXISTS idx_views_camp_id; CREATE INDEX idx_views_camp_id ON campai
 DROP INDEX IF EXISTS idx_views_subscriber_id; CREATE INDEX idx_views_subscriber_id ON campaign_views(subscriber_id);
 DROP INDEX IF EXISTS idx_views_date; CREATE INDEX idx_views_date ON campaign_views((TIMEZONE('UTC', created_at)::DATE));
 
+DROP TABLE IF EXISTS campaign_deliveries CASCADE;
+CREATE TABLE campaign_deliveries (
+    id               BIGSERIAL PRIMARY KEY,
+    campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+
+    -- Subscribers may be deleted, but the delivery records should remain.
+    subscriber_id    INTEGER NULL REFERENCES subscribers(id) ON DELETE SET NULL ON UPDATE CASCADE,
+
+    -- The messenger (or failover messenger) the message was delivered through.
+    messenger        TEXT NOT NULL,
+
+    -- The version of the campaign's content that was sent.
+    content_version  INTEGER NOT NULL DEFAULT 1,
+
+    -- Messages are queued when they're fetched for sending, and then sent or errored.
+    -- Sent messages may bounce later. error is the reason for errors and bounces.
+    status           delivery_status NOT NULL DEFAULT 'sent',
+    error            TEXT NOT NULL DEFAULT '',
+
+    -- Category of the error: connection, 4xx, 5xx, rendering, or empty if it's unknown.
+    -- Only connection and 4xx errors are retried, and retries is the number of retries.
+    error_type       TEXT NOT NULL DEFAULT '',
+    retries          INTEGER NOT NULL DEFAULT 0,
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_deliveries_camp_id; CREATE INDEX idx_deliveries_camp_id ON campaign_deliveries(campaign_id);
+DROP INDEX IF EXISTS idx_deliveries_subscriber_id; CREATE INDEX idx_deliveries_subscriber_id ON campaign_deliveries(subscriber_id);
+
+-- The last dry run of every campaign, which renders the messages to all of
+-- its recipients without sending them.
+DROP TABLE IF EXISTS campaign_simulations CASCADE;
+CREATE TABLE campaign_simulations (
+    campaign_id      INTEGER NOT NULL PRIMARY KEY REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+
+    -- running, finished, cancelled, or failed with the error.
+    status           TEXT NOT NULL DEFAULT 'running',
+    error            TEXT NOT NULL DEFAULT '',
+
+    -- Number of messages that were rendered and that couldn't be, the number of
+    -- rendered messages per recipient domain ([{domain, count}]), and a sample of
+    -- the rendering errors ([{subscriber_id, email, error}]).
+    rendered         INTEGER NOT NULL DEFAULT 0,
+    errors           INTEGER NOT NULL DEFAULT 0,
+    domains          JSONB NOT NULL DEFAULT '[]',
+    error_samples    JSONB NOT NULL DEFAULT '[]',
+    started_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Number of messages (campaign, transactional, and others) sent through each
+-- messenger per day, for send quotas. Days are in the default timezone.
+DROP TABLE IF EXISTS messenger_usage CASCADE;
+CREATE TABLE messenger_usage (
+    messenger        TEXT NOT NULL,
+    date             DATE NOT NULL,
+    sent             INTEGER NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (messenger, date)
+);
+
+-- Number of e-mails blocked by domain blocklist entries on import, subscription, and send.
+DROP TABLE IF EXISTS domain_blocklist_hits CASCADE;
+CREATE TABLE domain_blocklist_hits (
+    domain           TEXT NOT NULL PRIMARY KEY,
+    hits             BIGINT NOT NULL DEFAULT 0,
+    last_hit_at      TIMESTAMP WITH TIME ZONE NULL
+);
+
+-- Disposable e-mail domains fetched from the list at privacy.disposable_domains_url, which
+-- new subscribers' e-mails are checked against if privacy.block_disposable_emails is enabled.
+DROP TABLE IF EXISTS disposable_domains CASCADE;
+CREATE TABLE disposable_domains (
+    domain           TEXT NOT NULL PRIMARY KEY,
+    created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Previous versions of the content of campaigns that were edited while being sent.
+-- The current version is in the campaign itself.
+DROP TABLE IF EXISTS campaign_versions CASCADE;
+CREATE TABLE campaign_versions (
+    id               BIGSERIAL PRIMARY KEY,
+    campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    version          INTEGER NOT NULL,
+    subject          TEXT NOT NULL,
+    body             TEXT NOT NULL,
+    altbody          TEXT NULL,
+    body_amp         TEXT NULL,
+    content_type     content_type NOT NULL,
+    template_id      INTEGER NULL REFERENCES templates(id) ON DELETE SET NULL,
+    content_blocks   JSONB NOT NULL DEFAULT '[]',
+
+    -- When the version was replaced by the next one.
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    UNIQUE (campaign_id, version)
+);
+
+-- Test batches of campaigns sent to the QA list and the seed addresses of test variants,
+-- and the version of the campaign's content they were sent for.
+DROP TABLE IF EXISTS campaign_tests CASCADE;
+CREATE TABLE campaign_tests (
+    id               BIGSERIAL PRIMARY KEY,
+    campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    content_version  INTEGER NOT NULL,
+    subject          TEXT NOT NULL,
+    variants         TEXT[] NOT NULL DEFAULT '{}',
+    recipients       INTEGER NOT NULL DEFAULT 0,
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_camp_tests_camp_id; CREATE INDEX idx_camp_tests_camp_id ON campaign_tests(campaign_id);
+
+-- Snapshots of the content of campaigns taken on every save that changes it.
+DROP TABLE IF EXISTS campaign_revisions CASCADE;
+CREATE TABLE campaign_revisions (
+    id               BIGSERIAL PRIMARY KEY,
+    campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    subject          TEXT NOT NULL,
+    body             TEXT NOT NULL,
+    altbody          TEXT NULL,
+    body_amp         TEXT NULL,
+    content_type     content_type NOT NULL,
+    template_id      INTEGER NULL REFERENCES templates(id) ON DELETE SET NULL,
+    content_blocks   JSONB NOT NULL DEFAULT '[]',
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_camp_revs_camp_id; CREATE INDEX idx_camp_revs_camp_id ON campaign_revisions(campaign_id);
+
+-- Block-based documents of the visual e-mail builder that the bodies of campaigns and templates are rendered from.
+DROP TABLE IF EXISTS builder_docs CASCADE;
+CREATE TABLE builder_docs (
+    id               SERIAL PRIMARY KEY,
+    campaign_id      INTEGER NULL UNIQUE REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    template_id      INTEGER NULL UNIQUE REFERENCES templates(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    doc              JSONB NOT NULL,
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    CHECK ((campaign_id IS NULL) != (template_id IS NULL))
+);
+
+-- Recipients of campaigns snapshotted when they're scheduled or started (freeze_recipients).
+-- Subscribers may be deleted, so subscriber_id is nullable and a copy of the e-mail is maintained here.
+DROP TABLE IF EXISTS campaign_recipients CASCADE;
+CREATE TABLE campaign_recipients (
+    id               BIGSERIAL PRIMARY KEY,
+    campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    subscriber_id    INTEGER NULL REFERENCES subscribers(id) ON DELETE SET NULL ON UPDATE CASCADE,
+    email            TEXT NOT NULL DEFAULT '',
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+CREATE UNIQUE INDEX ON campaign_recipients (campaign_id, subscriber_id);
+
+-- RSS/Atom feeds that are polled for new items to send as campaigns.
+DROP TABLE IF EXISTS rss_feeds CASCADE;
+CREATE TABLE rss_feeds (
+    id               SERIAL PRIMARY KEY,
+    uuid             uuid NOT NULL UNIQUE,
+    name             TEXT NOT NULL,
+    url              TEXT NOT NULL,
+    enabled          BOOLEAN NOT NULL DEFAULT true,
+    poll_interval    TEXT NOT NULL DEFAULT '1h',
+    list_ids         INTEGER[] NOT NULL DEFAULT '{}',
+    template_id      INTEGER NULL REFERENCES templates(id) ON DELETE SET NULL,
+    subject          TEXT NOT NULL DEFAULT '',
+    from_email       TEXT NOT NULL DEFAULT '',
+    messenger        TEXT NOT NULL DEFAULT 'email',
+    body             TEXT NOT NULL DEFAULT '',
+    max_items        INTEGER NOT NULL DEFAULT 10,
+    auto_send        BOOLEAN NOT NULL DEFAULT true,
+    checked_at       TIMESTAMP WITH TIME ZONE NULL,
+    last_error       TEXT NOT NULL DEFAULT '',
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Items of RSS feeds that have been seen, and the campaigns they were sent in.
+DROP TABLE IF EXISTS rss_feed_items CASCADE;
+CREATE TABLE rss_feed_items (
+    feed_id          INTEGER NOT NULL REFERENCES rss_feeds(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    guid             TEXT NOT NULL,
+    campaign_id      INTEGER NULL REFERENCES campaigns(id) ON DELETE SET NULL ON UPDATE CASCADE,
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (feed_id, guid)
+);
+
+-- Syncs of lists with lists (segments) of contacts in CRMs. The contacts are pulled
+-- into the list, and the unsubscriptions and bounces of the list's subscribers are
+-- pushed to a contact property in the CRM.
+DROP TABLE IF EXISTS crm_syncs CASCADE;
+CREATE TABLE crm_syncs (
+    id               SERIAL PRIMARY KEY,
+    uuid             uuid NOT NULL UNIQUE,
+    name             TEXT NOT NULL,
+
+    -- hubspot or pipedrive, and the ID of the CRM list (HubSpot) or filter (Pipedrive).
+    provider         TEXT NOT NULL,
+    segment          TEXT NOT NULL,
+    api_key          TEXT NOT NULL DEFAULT '',
+    list_id          INTEGER NOT NULL REFERENCES lists(id) ON DELETE CASCADE ON UPDATE CASCADE,
+
+    -- CRM properties of the name, attributes, and status of subscribers, and
+    -- whose data is kept, listmonk's or the crm's, for existing subscribers.
+    mapping          JSONB NOT NULL DEFAULT '{}',
+    conflict         TEXT NOT NULL DEFAULT 'listmonk',
+    pull             BOOLEAN NOT NULL DEFAULT true,
+    push_unsubscribes BOOLEAN NOT NULL DEFAULT true,
+    push_bounces     BOOLEAN NOT NULL DEFAULT true,
+    enabled          BOOLEAN NOT NULL DEFAULT true,
+    sync_interval    TEXT NOT NULL DEFAULT '1h',
+
+    -- Changes after synced_at are pushed in the next sync. ran_at is the
+    -- last attempt, with the counts and error of it.
+    synced_at        TIMESTAMP WITH TIME ZONE NULL,
+    ran_at           TIMESTAMP WITH TIME ZONE NULL,
+    pulled           INTEGER NOT NULL DEFAULT 0,
+    pushed           INTEGER NOT NULL DEFAULT 0,
+    last_error       TEXT NOT NULL DEFAULT '',
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Hosted subscription forms of lists, with their custom fields that are
+-- stored as subscriber attributes, and their look.
+DROP TABLE IF EXISTS subscription_forms CASCADE;
+CREATE TABLE subscription_forms (
+    id               SERIAL PRIMARY KEY,
+    uuid             uuid NOT NULL UNIQUE,
+    name             TEXT NOT NULL,
+    enabled          BOOLEAN NOT NULL DEFAULT true,
+    list_ids         INTEGER[] NOT NULL DEFAULT '{}',
+    choose_lists     BOOLEAN NOT NULL DEFAULT false,
+    fields           JSONB NOT NULL DEFAULT '[]',
+    title            TEXT NOT NULL DEFAULT '',
+    description      TEXT NOT NULL DEFAULT '',
+    submit_label     TEXT NOT NULL DEFAULT '',
+    success_message  TEXT NOT NULL DEFAULT '',
+    redirect_url     TEXT NOT NULL DEFAULT '',
+    theme            JSONB NOT NULL DEFAULT '{}',
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Daily views and conversions (subscriptions) of subscription forms.
+DROP TABLE IF EXISTS subscription_form_stats CASCADE;
+CREATE TABLE subscription_form_stats (
+    form_id          INTEGER NOT NULL REFERENCES subscription_forms(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    day              DATE NOT NULL,
+    views            INTEGER NOT NULL DEFAULT 0,
+    conversions      INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (form_id, day)
+);
+
+-- api tokens
+-- API credentials whose role limits the endpoints they can access. subscribe tokens can
+-- only add subscribers to the lists in list_ids. Only the SHA-256 hash of the token is stored.
+DROP TABLE IF EXISTS api_tokens CASCADE;
+CREATE TABLE api_tokens (
+    id               SERIAL PRIMARY KEY,
+    name             TEXT NOT NULL,
+    username         TEXT NOT NULL UNIQUE,
+    token_hash       TEXT NOT NULL,
+    role             TEXT NOT NULL,
+    list_ids         INTEGER[] NOT NULL DEFAULT '{}',
+    folder_ids       INTEGER[] NOT NULL DEFAULT '{}',
+    last_used_at     TIMESTAMP WITH TIME ZONE NULL,
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
 -- media
 DROP TABLE IF EXISTS media CASCADE;
 CREATE TABLE media (
@@ -197,6 +722,9 @@ CREATE TABLE link_clicks (
 
     -- Subscribers may be deleted, but the link counts should remain.
     subscriber_id    INTEGER NULL REFERENCES subscribers(id) ON DELETE SET NULL ON UPDATE CASCADE,
+
+    -- Position (1-n) of the link among the tracked links in the campaign's HTML body.
+    position         INTEGER NULL,
     created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
 DROP INDEX IF EXISTS idx_clicks_camp_id; CREATE INDEX idx_clicks_camp_id ON link_clicks(campaign_id);
@@ -222,6 +750,19 @@ INSERT INTO settings (key, value) VALUES
     ('app.message_rate', '10'),
     ('app.batch_size', '1000'),
     ('app.max_send_errors', '1000'),
+    ('app.failover_errors', '5'),
+    ('app.domain_limits', '[]'),
+    ('app.messenger_quotas', '[]'),
+    ('app.frequency_cap_daily', '0'),
+    ('app.frequency_cap_weekly', '0'),
+    ('app.frequency_cap_action', '"skip"'),
+    ('app.quiet_hours_start', '""'),
+    ('app.quiet_hours_end', '""'),
+    ('app.seed_emails', '[]'),
+    ('app.test_list_id', '0'),
+    ('app.test_variants', '[]'),
+    ('app.attrib_schema', '[]'),
+    ('app.attrib_triggers', '[]'),
     ('app.message_sliding_window', 'false'),
     ('app.message_sliding_window_duration', '"1h"'),
     ('app.message_sliding_window_rate', '10000'),
@@ -234,18 +775,45 @@ INSERT INTO settings (key, value) VALUES
     ('app.check_updates', 'true'),
     ('app.notify_emails', '["admin1@mysite.com", "admin2@mysite.com"]'),
     ('app.lang', '"en"'),
+    ('app.default_timezone', '"UTC"'),
+    ('app.search_attribs', '[]'),
+    ('app.search_attribs_indexed', '[]'),
+    ('app.max_attachment_size', '10240'),
+    ('app.mjml_url', '""'),
+    ('app.mjml_username', '""'),
+    ('app.mjml_password', '""'),
+    ('app.mjml_timeout', '"10s"'),
+    ('app.template_lint_block', 'false'),
+    ('app.template_gallery_url', '""'),
+    ('costs.currency', '"USD"'),
+    ('costs.default', '0'),
+    ('costs.messengers', '[]'),
     ('privacy.individual_tracking', 'false'),
     ('privacy.unsubscribe_header', 'true'),
     ('privacy.allow_blocklist', 'true'),
     ('privacy.allow_export', 'true'),
     ('privacy.allow_wipe', 'true'),
     ('privacy.allow_preferences', 'true'),
-    ('privacy.exportable', '["profile", "subscriptions", "campaign_views", "link_clicks"]'),
+    ('privacy.frequencies', '[]'),
+    ('privacy.topics', '[]'),
+    ('privacy.exportable', '["profile", "subscriptions", "campaign_views", "link_clicks", "consents"]'),
     ('privacy.domain_blocklist', '[]'),
+    ('privacy.tracking_domains', '[]'),
     ('privacy.record_optin_ip', 'false'),
+    ('privacy.soft_delete', 'false'),
+    ('privacy.soft_delete_purge_days', '30'),
+    ('privacy.hygiene_unconfirmed_days', '0'),
+    ('privacy.hygiene_unengaged_months', '0'),
+    ('privacy.hygiene_blocklisted_days', '0'),
+    ('privacy.block_disposable_emails', 'false'),
+    ('privacy.disposable_domains_url', '"https://raw.githubusercontent.com/disposable-email-domains/disposable-email-domains/main/disposable_email_blocklist.conf"'),
     ('security.enable_captcha', 'false'),
     ('security.captcha_key', '""'),
     ('security.captcha_secret', '""'),
+    ('security.scan_attachments', 'false'),
+    ('security.scan_type', '"clamav"'),
+    ('security.scan_url', '"tcp://localhost:3310"'),
+    ('security.scan_timeout', '"10s"'),
     ('upload.provider', '"filesystem"'),
     ('upload.max_file_size', '5000'),
     ('upload.extensions', '["jpg","jpeg","png","gif","svg","*"]'),
@@ -265,6 +833,7 @@ INSERT INTO settings (key, value) VALUES
         '[{"enabled":true, "host":"smtp.yoursite.com","port":25,"auth_protocol":"cram","username":"username","password":"password","hello_hostname":"","max_conns":10,"idle_timeout":"15s","wait_timeout":"5s","max_msg_retries":2,"tls_type":"STARTTLS","tls_skip_verify":false,"email_headers":[]},
           {"enabled":false, "host":"smtp.gmail.com","port":465,"auth_protocol":"login","username":"username@gmail.com","password":"password","hello_hostname":"","max_conns":10,"idle_timeout":"15s","wait_timeout":"5s","max_msg_retries":2,"tls_type":"TLS","tls_skip_verify":false,"email_headers":[]}]'),
     ('messengers', '[]'),
+    ('webhooks', '[]'),
     ('bounce.enabled', 'false'),
     ('bounce.webhooks_enabled', 'false'),
     ('bounce.actions', '{"soft": {"count": 2, "action": "none"}, "hard": {"count": 1, "action": "blocklist"}, "complaint" : {"count": 1, "action": "blocklist"}}'),
@@ -279,6 +848,26 @@ INSERT INTO settings (key, value) VALUES
     ('appearance.public.custom_css', '""'),
     ('appearance.public.custom_js', '""');
 
+-- subscriber search
+CREATE OR REPLACE FUNCTION subscriber_search_text(email TEXT, name TEXT, attribs JSONB) RETURNS TEXT AS $$
+    SELECT LOWER(CONCAT_WS(' ', email, name, (
+        SELECT STRING_AGG(attribs->>k, ' ') FROM JSONB_ARRAY_ELEMENTS_TEXT(
+            COALESCE((SELECT value FROM settings WHERE key = 'app.search_attribs'), '[]')
+        ) AS k
+    )))
+$$ LANGUAGE SQL STABLE;
+
+CREATE OR REPLACE FUNCTION subscriber_search_text_trigger() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.search_text = subscriber_search_text(NEW.email, NEW.name, NEW.attribs);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_subscriber_search_text ON subscribers;
+CREATE TRIGGER trg_subscriber_search_text BEFORE INSERT OR UPDATE OF email, name, attribs ON subscribers
+    FOR EACH ROW EXECUTE FUNCTION subscriber_search_text_trigger();
+
 -- bounces
 DROP TABLE IF EXISTS bounces CASCADE;
 CREATE TABLE bounces (
@@ -295,6 +884,232 @@ DROP INDEX IF EXISTS idx_bounces_camp_id; CREATE INDEX idx_bounces_camp_id ON bo
 DROP INDEX IF EXISTS idx_bounces_source; CREATE INDEX idx_bounces_source ON bounces(source);
 DROP INDEX IF EXISTS idx_bounces_date; CREATE INDEX idx_bounces_date ON bounces((TIMEZONE('UTC', created_at)::DATE));
 
+-- Audit trail of the subscribers erased by operators. The erased subscriber is
+-- retained as an anonymous record, so no personal data is recorded here.
+DROP TABLE IF EXISTS subscriber_erasures CASCADE;
+CREATE TABLE subscriber_erasures (
+    id               SERIAL PRIMARY KEY,
+    subscriber_id    INTEGER NULL REFERENCES subscribers(id) ON DELETE SET NULL ON UPDATE CASCADE,
+    reason           TEXT NOT NULL DEFAULT '',
+    erased_by        TEXT NOT NULL DEFAULT '',
+
+    -- Number of subscriptions that were deleted, and campaign views, link clicks,
+    -- deliveries, and bounces that were unlinked from the subscriber or scrubbed.
+    subscriptions    INTEGER NOT NULL DEFAULT 0,
+    views            INTEGER NOT NULL DEFAULT 0,
+    clicks           INTEGER NOT NULL DEFAULT 0,
+    deliveries       INTEGER NOT NULL DEFAULT 0,
+    bounces          INTEGER NOT NULL DEFAULT 0,
+    created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_sub_erasures_date; CREATE INDEX idx_sub_erasures_date ON subscriber_erasures(created_at);
+
+-- Bulk actions on the subscribers that match a query, which run in the
+-- background in batches.
+DROP TABLE IF EXISTS subscriber_jobs CASCADE;
+CREATE TABLE subscriber_jobs (
+    id               SERIAL PRIMARY KEY,
+
+    -- blocklist, delete, soft_delete, restore, add, remove, unsubscribe, tag, or untag, on the subscribers
+    -- that match the query in the optional lists, with the target lists of the
+    -- list actions, the subscription status for add, and the tags of the tag actions.
+    action           TEXT NOT NULL,
+    query            TEXT NOT NULL DEFAULT '',
+    list_ids         INTEGER[] NOT NULL DEFAULT '{}',
+    target_list_ids  INTEGER[] NOT NULL DEFAULT '{}',
+    sub_status       TEXT NOT NULL DEFAULT '',
+    tags             VARCHAR(100)[] NOT NULL DEFAULT '{}',
+    created_by       TEXT NOT NULL DEFAULT '',
+
+    -- running, finished, cancelled, or failed with the error.
+    status           TEXT NOT NULL DEFAULT 'running',
+    error            TEXT NOT NULL DEFAULT '',
+
+    -- Number of subscribers that matched the query when the job was started,
+    -- and the number of them that have been processed.
+    matched          INTEGER NOT NULL DEFAULT 0,
+    processed        INTEGER NOT NULL DEFAULT 0,
+    created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    finished_at      TIMESTAMP WITH TIME ZONE NULL
+);
+DROP INDEX IF EXISTS idx_sub_jobs_date; CREATE INDEX idx_sub_jobs_date ON subscriber_jobs(created_at);
+
+-- Pending e-mail changes of subscribers that are applied once the new e-mail is
+-- confirmed with the token sent to it. A subscriber has at most one.
+DROP TABLE IF EXISTS subscriber_email_changes CASCADE;
+CREATE TABLE subscriber_email_changes (
+    subscriber_id    INTEGER NOT NULL PRIMARY KEY REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    email            TEXT NOT NULL,
+    token            UUID NOT NULL UNIQUE,
+    created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Alternate e-mails of subscribers in addition to their primary e-mail in subscribers.email.
+-- An e-mail is verified with the token sent to it, and can then be made the primary e-mail.
+-- Bounces of the verification e-mails are counted on the e-mail instead of the subscriber.
+DROP TABLE IF EXISTS subscriber_emails CASCADE;
+CREATE TABLE subscriber_emails (
+    id               SERIAL PRIMARY KEY,
+    subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    email            TEXT NOT NULL,
+    token            UUID NULL UNIQUE,
+    verified_at      TIMESTAMP WITH TIME ZONE NULL,
+    bounces          INTEGER NOT NULL DEFAULT 0,
+    last_bounced_at  TIMESTAMP WITH TIME ZONE NULL,
+    created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_sub_emails_email; CREATE UNIQUE INDEX idx_sub_emails_email ON subscriber_emails(LOWER(email));
+DROP INDEX IF EXISTS idx_sub_emails_sub; CREATE INDEX idx_sub_emails_sub ON subscriber_emails(subscriber_id);
+
+-- Notes that admins record on subscribers, eg: support interactions.
+DROP TABLE IF EXISTS subscriber_notes CASCADE;
+CREATE TABLE subscriber_notes (
+    id               SERIAL PRIMARY KEY,
+    subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    author           TEXT NOT NULL DEFAULT '',
+    note             TEXT NOT NULL,
+    created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_sub_notes_sub_id; CREATE INDEX idx_sub_notes_sub_id ON subscriber_notes(subscriber_id);
+
+-- Daily counts of the subscribers in lists by their status, for growth and churn over time.
+-- The row of the current day is updated periodically through the day.
+DROP TABLE IF EXISTS list_snapshots CASCADE;
+CREATE TABLE list_snapshots (
+    list_id          INTEGER NOT NULL REFERENCES lists(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    date             DATE NOT NULL,
+    confirmed        INTEGER NOT NULL DEFAULT 0,
+    unconfirmed      INTEGER NOT NULL DEFAULT 0,
+    unsubscribed     INTEGER NOT NULL DEFAULT 0,
+    blocklisted      INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (list_id, date)
+);
+DROP INDEX IF EXISTS idx_list_snapshots_date; CREATE INDEX idx_list_snapshots_date ON list_snapshots(date);
+
+-- Proof of the consent of subscribers to their subscriptions: the IP address, user agent,
+-- and source of their subscription and opt-in confirmation requests. Records can't be
+-- modified, except for being moved to another subscriber when subscribers are merged.
+DROP TABLE IF EXISTS subscriber_consents CASCADE;
+CREATE TABLE subscriber_consents (
+    id               BIGSERIAL PRIMARY KEY,
+    subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE,
+    type             consent_type NOT NULL,
+    list_ids         INTEGER[] NOT NULL DEFAULT '{}',
+    ip               TEXT NOT NULL DEFAULT '',
+    user_agent       TEXT NOT NULL DEFAULT '',
+
+    -- form, api, or optin, and the URL of the page the request was made on.
+    source           TEXT NOT NULL DEFAULT '',
+    url              TEXT NOT NULL DEFAULT '',
+    created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_sub_consents_sub_id; CREATE INDEX idx_sub_consents_sub_id ON subscriber_consents(subscriber_id);
+
+CREATE OR REPLACE FUNCTION subscriber_consents_immutable() RETURNS TRIGGER AS $$
+BEGIN
+    IF (NEW.type, NEW.list_ids, NEW.ip, NEW.user_agent, NEW.source, NEW.url, NEW.created_at) IS DISTINCT FROM
+        (OLD.type, OLD.list_ids, OLD.ip, OLD.user_agent, OLD.source, OLD.url, OLD.created_at) THEN
+        RAISE EXCEPTION 'subscriber consent records can not be modified';
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_subscriber_consents_immutable ON subscriber_consents;
+CREATE TRIGGER trg_subscriber_consents_immutable BEFORE UPDATE ON subscriber_consents
+    FOR EACH ROW EXECUTE FUNCTION subscriber_consents_immutable();
+
+-- Webhooks of lists that are posted the subscription events of the list.
+DROP TABLE IF EXISTS list_webhooks CASCADE;
+CREATE TABLE list_webhooks (
+    id               SERIAL PRIMARY KEY,
+    list_id          INTEGER NOT NULL REFERENCES lists(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    url              TEXT NOT NULL,
+    events           TEXT[] NOT NULL DEFAULT '{}',
+    secret           TEXT NOT NULL DEFAULT '',
+    enabled          BOOLEAN NOT NULL DEFAULT true,
+    created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_list_webhooks_list; CREATE INDEX idx_list_webhooks_list ON list_webhooks(list_id);
+
+-- Subscription events of the lists with enabled webhooks that are yet to be dispatched.
+-- They're recorded by a trigger so that every change to subscriptions, including
+-- imports and bulk actions, is captured.
+DROP TABLE IF EXISTS list_events CASCADE;
+CREATE TABLE list_events (
+    id               BIGSERIAL PRIMARY KEY,
+    list_id          INTEGER NOT NULL REFERENCES lists(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    event            TEXT NOT NULL,
+    created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE OR REPLACE FUNCTION list_events_trigger() RETURNS TRIGGER AS $$
+DECLARE
+    ev TEXT;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        IF NEW.status != 'unsubscribed' THEN
+            ev = 'list.subscribed';
+        END IF;
+    ELSIF NEW.status = 'unsubscribed' AND OLD.status != 'unsubscribed' THEN
+        ev = 'list.unsubscribed';
+    ELSIF OLD.status = 'unsubscribed' AND NEW.status != 'unsubscribed' THEN
+        ev = 'list.subscribed';
+    ELSIF OLD.status = 'unconfirmed' AND NEW.status = 'confirmed' THEN
+        ev = 'list.confirmed';
+    END IF;
+
+    IF ev IS NOT NULL AND EXISTS (SELECT 1 FROM list_webhooks WHERE list_id = NEW.list_id AND enabled) THEN
+        INSERT INTO list_events (list_id, subscriber_id, event) VALUES (NEW.list_id, NEW.subscriber_id, ev);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_list_events ON subscriber_lists;
+CREATE TRIGGER trg_list_events AFTER INSERT OR UPDATE OF status ON subscriber_lists
+    FOR EACH ROW EXECUTE FUNCTION list_events_trigger();
+
+-- Subscriptions to archived lists are skipped and unsubscribed subscribers of archived
+-- lists can't resubscribe. Existing subscriptions can still be updated, and memberships
+-- older than the archival, eg: of merged subscribers, can still be moved.
+CREATE OR REPLACE FUNCTION archived_lists_trigger() RETURNS TRIGGER AS $$
+DECLARE
+    arch TIMESTAMP WITH TIME ZONE;
+BEGIN
+    SELECT archived_at INTO arch FROM lists WHERE id = NEW.list_id AND archived;
+    IF NOT FOUND THEN
+        RETURN NEW;
+    END IF;
+
+    IF TG_OP = 'INSERT' THEN
+        IF NEW.created_at < arch OR EXISTS (SELECT 1 FROM subscriber_lists
+            WHERE subscriber_id = NEW.subscriber_id AND list_id = NEW.list_id) THEN
+            RETURN NEW;
+        END IF;
+        RETURN NULL;
+    ELSIF OLD.status = 'unsubscribed' AND NEW.status != 'unsubscribed' THEN
+        NEW.status = OLD.status;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_archived_lists ON subscriber_lists;
+CREATE TRIGGER trg_archived_lists BEFORE INSERT OR UPDATE OF status ON subscriber_lists
+    FOR EACH ROW EXECUTE FUNCTION archived_lists_trigger();
+
+-- The lists excluded by any of the given lists, other than the given lists themselves,
+-- whose subscribers aren't sent campaigns to the given lists.
+CREATE OR REPLACE FUNCTION list_exclusions(list_ids INT[]) RETURNS INT[] AS $$
+    SELECT COALESCE(ARRAY_AGG(DISTINCT x), '{}') FROM lists, UNNEST(lists.exclude_list_ids) AS x
+        WHERE lists.id = ANY(list_ids) AND NOT x = ANY(list_ids)
+$$ LANGUAGE SQL STABLE;
+
 
 
 -- materialized views
@@ -308,12 +1123,13 @@ CREATE MATERIALIZED VIEW mat_dashboard_counts AS
     SELECT NOW() AS updated_at,
         JSON_BUILD_OBJECT(
             'subscribers', JSON_BUILD_OBJECT(
-                'total', (SELECT SUM(num) FROM subs),
+                'total', (SELECT SUM(num) FROM subs WHERE status != 'deleted'),
                 'blocklisted', (SELECT num FROM subs WHERE status='blocklisted'),
+                'deleted', (SELECT num FROM subs WHERE status='deleted'),
                 'orphans', (
                     SELECT COUNT(id) FROM subscribers
                     LEFT JOIN subscriber_lists ON (subscribers.id = subscriber_lists.subscriber_id)
-                    WHERE subscriber_lists.subscriber_id IS NULL
+                    WHERE subscriber_lists.subscriber_id IS NULL AND subscribers.status != 'deleted'
                 )
             ),
             'lists', JSON_BUILD_OBJECT(
@@ -373,9 +1189,10 @@ DROP INDEX IF EXISTS mat_dashboard_charts_idx; CREATE UNIQUE INDEX mat_dashboard
 -- subscriber counts stats for lists
 DROP MATERIALIZED VIEW IF EXISTS mat_list_subscriber_stats;
 CREATE MATERIALIZED VIEW mat_list_subscriber_stats AS
-    SELECT NOW() AS updated_at, lists.id AS list_id, subscriber_lists.status, COUNT(*) AS subscriber_count FROM lists
+    SELECT NOW() AS updated_at, lists.id AS list_id, subscriber_lists.status, COUNT(subscribers.id) AS subscriber_count FROM lists
     LEFT JOIN subscriber_lists ON (subscriber_lists.list_id = lists.id)
+    LEFT JOIN subscribers ON (subscribers.id = subscriber_lists.subscriber_id AND subscribers.status != 'deleted')
     GROUP BY lists.id, subscriber_lists.status
     UNION ALL
-    SELECT NOW() AS updated_at, 0 AS list_id, NULL AS status, COUNT(*) AS subscriber_count FROM subscribers;
+    SELECT NOW() AS updated_at, 0 AS list_id, NULL AS status, COUNT(*) AS subscriber_count FROM subscribers WHERE status != 'deleted';
 DROP INDEX IF EXISTS mat_list_subscriber_stats_idx; CREATE UNIQUE INDEX mat_list_subscriber_stats_idx ON mat_list_subscriber_stats (list_id, status);